@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/titan-commerce/backend/cell-router/internal/discovery"
+	"github.com/titan-commerce/backend/cell-router/internal/migration"
+	"github.com/titan-commerce/backend/cell-router/internal/override"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// AdminAPI exposes cell pinning, user migration and the service registry
+type AdminAPI struct {
+	router   *CellRouter
+	migrator *migration.Migrator
+	registry *discovery.Registry
+}
+
+// NewAdminAPI creates the admin API handlers
+func NewAdminAPI(router *CellRouter, migrator *migration.Migrator, registry *discovery.Registry) *AdminAPI {
+	return &AdminAPI{router: router, migrator: migrator, registry: registry}
+}
+
+// Register mounts the admin routes on mux
+func (a *AdminAPI) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /overrides", a.handleListOverrides)
+	mux.HandleFunc("PUT /overrides", a.handlePutOverride)
+	mux.HandleFunc("DELETE /overrides", a.handleDeleteOverride)
+	mux.HandleFunc("POST /migrations", a.handleStartMigration)
+	mux.HandleFunc("GET /migrations", a.handleListMigrations)
+	mux.HandleFunc("GET /migrations/{id}", a.handleGetMigration)
+	mux.HandleFunc("GET /registry/instances", a.handleListInstances)
+	mux.HandleFunc("PUT /registry/instances", a.handleRegisterInstance)
+	mux.HandleFunc("DELETE /registry/instances/{id}", a.handleDeregisterInstance)
+}
+
+func (a *AdminAPI) handleListOverrides(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"overrides": a.router.overrides.List(),
+	})
+}
+
+func (a *AdminAPI) handlePutOverride(w http.ResponseWriter, req *http.Request) {
+	var o override.Override
+	if err := json.NewDecoder(req.Body).Decode(&o); err != nil {
+		writeError(w, errors.Wrap(errors.ErrInvalidInput, "invalid override", err))
+		return
+	}
+	if !a.router.HasCell(o.CellID) {
+		writeError(w, errors.New(errors.ErrInvalidInput, "unknown cell"))
+		return
+	}
+	if a.router.IsFrozen(o.UserID) {
+		writeError(w, errors.New(errors.ErrConflict, "user is being migrated"))
+		return
+	}
+
+	// Freezing is owned by the migration workflow
+	o.Frozen = false
+	if err := a.router.overrides.Put(req.Context(), &o); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, o)
+}
+
+func (a *AdminAPI) handleDeleteOverride(w http.ResponseWriter, req *http.Request) {
+	userID := req.URL.Query().Get("user_id")
+	if userID == "" {
+		writeError(w, errors.New(errors.ErrInvalidInput, "user_id is required"))
+		return
+	}
+	if a.router.IsFrozen(userID) {
+		writeError(w, errors.New(errors.ErrConflict, "user is being migrated"))
+		return
+	}
+	if err := a.router.overrides.Delete(req.Context(), userID); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type startMigrationRequest struct {
+	UserID     string `json:"user_id"`
+	TargetCell int    `json:"target_cell"`
+}
+
+func (a *AdminAPI) handleStartMigration(w http.ResponseWriter, req *http.Request) {
+	var body startMigrationRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, errors.Wrap(errors.ErrInvalidInput, "invalid migration request", err))
+		return
+	}
+	if !a.router.HasCell(body.TargetCell) {
+		writeError(w, errors.New(errors.ErrInvalidInput, "unknown cell"))
+		return
+	}
+
+	source := a.router.RouteToCellID(body.UserID)
+	mig, err := a.migrator.Start(req.Context(), body.UserID, source, body.TargetCell)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, mig)
+}
+
+func (a *AdminAPI) handleListMigrations(w http.ResponseWriter, req *http.Request) {
+	userID := req.URL.Query().Get("user_id")
+	if userID == "" {
+		writeError(w, errors.New(errors.ErrInvalidInput, "user_id is required"))
+		return
+	}
+
+	migrations, err := a.migrator.ListForUser(req.Context(), userID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"migrations": migrations})
+}
+
+func (a *AdminAPI) handleGetMigration(w http.ResponseWriter, req *http.Request) {
+	mig, err := a.migrator.Get(req.Context(), req.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, mig)
+}
+
+func (a *AdminAPI) handleListInstances(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"instances": a.registry.Instances()})
+}
+
+// handleRegisterInstance registers a replica or renews its lease. Replicas
+// call it on startup and then every few seconds as a heartbeat.
+func (a *AdminAPI) handleRegisterInstance(w http.ResponseWriter, req *http.Request) {
+	var reg discovery.Registration
+	if err := json.NewDecoder(req.Body).Decode(&reg); err != nil {
+		writeError(w, errors.Wrap(errors.ErrInvalidInput, "invalid registration", err))
+		return
+	}
+	if !a.router.HasCell(reg.CellID) {
+		writeError(w, errors.New(errors.ErrInvalidInput, "unknown cell"))
+		return
+	}
+
+	reg, err := a.registry.Register(reg)
+	if err != nil {
+		writeError(w, errors.Wrap(errors.ErrInvalidInput, "invalid registration", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, reg)
+}
+
+func (a *AdminAPI) handleDeregisterInstance(w http.ResponseWriter, req *http.Request) {
+	a.registry.Deregister(req.PathValue("id"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	if appErr, ok := err.(*errors.AppError); ok {
+		writeJSON(w, appErr.HTTPStatus, appErr)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,181 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// ErrNoLiveReplica is returned by Pick when every replica of the service is
+// cooling down after a failure
+var ErrNoLiveReplica = errors.New("no live replica")
+
+// pool is the replica set of one service in one cell
+type pool struct {
+	addrs []string
+	next  atomic.Uint64
+}
+
+// Directory holds the endpoints discovered for every cell and balances
+// requests round-robin across a service's replicas. Replicas reported as
+// failing are skipped until their cooldown expires.
+type Directory struct {
+	cells    map[int]map[string]*pool
+	down     map[string]time.Time
+	cooldown time.Duration
+	mu       sync.RWMutex
+	logger   *logger.Logger
+}
+
+// NewDirectory creates an empty directory
+func NewDirectory(cooldown time.Duration, log *logger.Logger) *Directory {
+	return &Directory{
+		cells:    make(map[int]map[string]*pool),
+		down:     make(map[string]time.Time),
+		cooldown: cooldown,
+		logger:   log,
+	}
+}
+
+// Run applies snapshots from the provider until ctx is cancelled. It blocks
+// until the first snapshot has been applied so routing never starts empty,
+// and gives up if none arrives within timeout, e.g. because the DNS records
+// do not resolve.
+func (d *Directory) Run(ctx context.Context, provider Provider, timeout time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	updates, err := provider.Watch(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	select {
+	case snap, ok := <-updates:
+		if !ok {
+			cancel()
+			return fmt.Errorf("%s discovery closed before the first snapshot", provider.Name())
+		}
+		d.Apply(snap)
+	case <-time.After(timeout):
+		cancel()
+		return fmt.Errorf("%s discovery found no endpoints within %s", provider.Name(), timeout)
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	}
+
+	go func() {
+		defer cancel()
+		for snap := range updates {
+			d.Apply(snap)
+		}
+	}()
+	return nil
+}
+
+// Apply replaces the directory contents with a snapshot
+func (d *Directory) Apply(snap Snapshot) {
+	cells := make(map[int]map[string]*pool)
+	for _, e := range snap {
+		services, ok := cells[e.CellID]
+		if !ok {
+			services = make(map[string]*pool)
+			cells[e.CellID] = services
+		}
+		p, ok := services[e.Service]
+		if !ok {
+			p = &pool{}
+			services[e.Service] = p
+		}
+		p.addrs = append(p.addrs, e.Address)
+	}
+	for _, services := range cells {
+		for _, p := range services {
+			sort.Strings(p.addrs)
+		}
+	}
+
+	d.mu.Lock()
+	d.cells = cells
+	d.mu.Unlock()
+
+	d.logger.Infof("Discovered %d endpoints across %d cells", len(snap), len(cells))
+}
+
+// Pick returns the next replica of a service in a cell. If the cell does
+// not run the service, the cell's gateway is used instead. It fails with
+// ErrNoLiveReplica if every replica is cooling down, so the caller can move
+// on to another cell.
+func (d *Directory) Pick(cellID int, service string) (string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	services, ok := d.cells[cellID]
+	if !ok {
+		return "", fmt.Errorf("no endpoints discovered for cell %d", cellID)
+	}
+	p, ok := services[service]
+	if !ok {
+		if p, ok = services[DefaultService]; !ok {
+			return "", fmt.Errorf("cell %d has no %s or %s endpoints", cellID, service, DefaultService)
+		}
+	}
+
+	now := time.Now()
+	n := uint64(len(p.addrs))
+	start := p.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		addr := p.addrs[(start+i)%n]
+		if until, isDown := d.down[addr]; !isDown || now.After(until) {
+			return addr, nil
+		}
+	}
+
+	return "", fmt.Errorf("cell %d %s: %w", cellID, service, ErrNoLiveReplica)
+}
+
+// MarkDown takes a replica out of rotation for the cooldown period.
+// Replicas whose cooldown has passed are forgotten, so addresses that
+// discovery has since dropped do not pile up.
+func (d *Directory) MarkDown(addr string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for a, until := range d.down {
+		if now.After(until) {
+			delete(d.down, a)
+		}
+	}
+	d.down[addr] = now.Add(d.cooldown)
+}
+
+// Replicas returns every replica address in a cell
+func (d *Directory) Replicas(cellID int) []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var result []string
+	for _, p := range d.cells[cellID] {
+		result = append(result, p.addrs...)
+	}
+	return result
+}
+
+// Services returns the replica count of each service in a cell
+func (d *Directory) Services(cellID int) map[string]int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	result := make(map[string]int)
+	for name, p := range d.cells[cellID] {
+		result[name] = len(p.addrs)
+	}
+	return result
+}
@@ -0,0 +1,128 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+func newTestDirectory() *Directory {
+	return NewDirectory(time.Minute, logger.New(logger.Config{Level: "error", ServiceName: "test"}))
+}
+
+func TestDirectory_BalancesAcrossReplicas(t *testing.T) {
+	d := newTestDirectory()
+	d.Apply(Snapshot{
+		{CellID: 1, Service: "order-service", Address: "10.0.0.1:9000"},
+		{CellID: 1, Service: "order-service", Address: "10.0.0.2:9000"},
+	})
+
+	seen := map[string]int{}
+	for i := 0; i < 10; i++ {
+		addr, err := d.Pick(1, "order-service")
+		if err != nil {
+			t.Fatalf("Pick() error = %v", err)
+		}
+		seen[addr]++
+	}
+	if seen["10.0.0.1:9000"] != 5 || seen["10.0.0.2:9000"] != 5 {
+		t.Errorf("uneven balancing: %v", seen)
+	}
+}
+
+func TestDirectory_SkipsMarkedDownReplica(t *testing.T) {
+	d := newTestDirectory()
+	d.Apply(Snapshot{
+		{CellID: 1, Service: "order-service", Address: "10.0.0.1:9000"},
+		{CellID: 1, Service: "order-service", Address: "10.0.0.2:9000"},
+	})
+	d.MarkDown("10.0.0.1:9000")
+
+	for i := 0; i < 4; i++ {
+		if addr, _ := d.Pick(1, "order-service"); addr != "10.0.0.2:9000" {
+			t.Fatalf("Pick() = %s, want the healthy replica", addr)
+		}
+	}
+}
+
+func TestDirectory_FallsBackToGateway(t *testing.T) {
+	d := newTestDirectory()
+	d.Apply(Snapshot{{CellID: 1, Service: DefaultService, Address: "10.0.0.9:8080"}})
+
+	addr, err := d.Pick(1, "cart-service")
+	if err != nil || addr != "10.0.0.9:8080" {
+		t.Errorf("Pick() = %s, %v; want gateway", addr, err)
+	}
+	if _, err := d.Pick(2, "cart-service"); err == nil {
+		t.Error("Pick() on an unknown cell should fail")
+	}
+}
+
+func TestRegistry_WatchSeesRegistrations(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := NewRegistry(time.Minute)
+	updates, _ := r.Watch(ctx)
+	if snap := <-updates; len(snap) != 0 {
+		t.Fatalf("initial snapshot = %v, want empty", snap)
+	}
+
+	r.Register(Registration{InstanceID: "order-1", CellID: 1, Service: "order-service", Address: "10.0.0.1:9000"})
+	if snap := <-updates; len(snap) != 1 || snap[0].Address != "10.0.0.1:9000" {
+		t.Errorf("snapshot after register = %v", snap)
+	}
+
+	r.Deregister("order-1")
+	if snap := <-updates; len(snap) != 0 {
+		t.Errorf("snapshot after deregister = %v, want empty", snap)
+	}
+}
+
+func TestDirectory_NoLiveReplica(t *testing.T) {
+	d := newTestDirectory()
+	d.Apply(Snapshot{{CellID: 1, Service: "order-service", Address: "10.0.0.1:9000"}})
+	d.MarkDown("10.0.0.1:9000")
+
+	if _, err := d.Pick(1, "order-service"); !errors.Is(err, ErrNoLiveReplica) {
+		t.Errorf("Pick() error = %v, want ErrNoLiveReplica", err)
+	}
+}
+
+func TestDirectory_ForgetsExpiredCooldowns(t *testing.T) {
+	d := NewDirectory(time.Millisecond, logger.New(logger.Config{Level: "error", ServiceName: "test"}))
+	d.MarkDown("10.0.0.1:9000")
+	time.Sleep(5 * time.Millisecond)
+	d.MarkDown("10.0.0.2:9000")
+
+	if _, ok := d.down["10.0.0.1:9000"]; ok || len(d.down) != 1 {
+		t.Errorf("down = %v, want only the latest replica", d.down)
+	}
+}
+
+// unresolvable is a provider whose lookups never succeed
+type unresolvable struct{}
+
+func (unresolvable) Name() string { return "unresolvable" }
+
+func (unresolvable) Watch(ctx context.Context) (<-chan Snapshot, error) {
+	return poll(ctx, 10*time.Millisecond, func(context.Context) (Snapshot, error) {
+		return nil, errors.New("no such host")
+	}, func(error) {}), nil
+}
+
+func TestDirectory_RunGivesUpWithoutFirstSnapshot(t *testing.T) {
+	d := newTestDirectory()
+
+	start := time.Now()
+	err := d.Run(context.Background(), unresolvable{}, 50*time.Millisecond)
+	if err == nil {
+		t.Fatal("Run() should fail when no snapshot arrives")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run() took %s to give up", elapsed)
+	}
+}
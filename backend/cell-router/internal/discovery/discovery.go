@@ -0,0 +1,81 @@
+package discovery
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultService is the per-cell ingress that receives traffic not bound to
+// a specific service
+const DefaultService = "gateway"
+
+// Endpoint is one replica of a service inside a cell
+type Endpoint struct {
+	CellID  int    `json:"cell_id"`
+	Service string `json:"service"`
+	Address string `json:"address"` // host:port
+}
+
+// Snapshot is the complete set of endpoints known to a provider
+type Snapshot []Endpoint
+
+// Provider discovers cell endpoints. Watch delivers the current snapshot
+// first and then a new snapshot whenever the endpoint set changes, until
+// ctx is cancelled.
+type Provider interface {
+	Name() string
+	Watch(ctx context.Context) (<-chan Snapshot, error)
+}
+
+// poll calls fetch every interval and forwards snapshots that differ from the
+// previous one. It backs the providers that have no native change feed.
+func poll(ctx context.Context, interval time.Duration, fetch func(context.Context) (Snapshot, error), onError func(error)) <-chan Snapshot {
+	out := make(chan Snapshot, 1)
+
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var last Snapshot
+		first := true
+		for {
+			snap, err := fetch(ctx)
+			if err != nil {
+				onError(err)
+			} else if first || !equal(last, snap) {
+				select {
+				case out <- snap:
+				case <-ctx.Done():
+					return
+				}
+				last, first = snap, false
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return out
+}
+
+func equal(a, b Snapshot) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[Endpoint]int, len(a))
+	for _, e := range a {
+		seen[e]++
+	}
+	for _, e := range b {
+		if seen[e] == 0 {
+			return false
+		}
+		seen[e]--
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// DefaultSRVTemplate names the SRV record of a service in a cell. {service}
+// and {cell} (zero-padded to three digits) are substituted.
+const DefaultSRVTemplate = "_grpc._tcp.{service}.cell-{cell}.svc.cluster.local"
+
+// DNSProvider resolves each cell's services through DNS SRV records, so
+// replica sets and ports come from the cluster DNS instead of config
+type DNSProvider struct {
+	template string
+	services []string
+	cells    func() []int
+	interval time.Duration
+	resolver *net.Resolver
+	logger   *logger.Logger
+}
+
+// NewDNSProvider creates a provider that looks up every service in every
+// cell returned by cells
+func NewDNSProvider(template string, services []string, cells func() []int, interval time.Duration, log *logger.Logger) *DNSProvider {
+	if template == "" {
+		template = DefaultSRVTemplate
+	}
+	return &DNSProvider{
+		template: template,
+		services: services,
+		cells:    cells,
+		interval: interval,
+		resolver: net.DefaultResolver,
+		logger:   log,
+	}
+}
+
+func (p *DNSProvider) Name() string { return "dns" }
+
+func (p *DNSProvider) Watch(ctx context.Context) (<-chan Snapshot, error) {
+	if len(p.services) == 0 {
+		return nil, fmt.Errorf("dns discovery needs at least one service")
+	}
+	return poll(ctx, p.interval, p.resolve, func(err error) {
+		p.logger.Error(err, "DNS SRV discovery failed, keeping current endpoints")
+	}), nil
+}
+
+func (p *DNSProvider) resolve(ctx context.Context) (Snapshot, error) {
+	var snap Snapshot
+	var failures int
+
+	for _, cellID := range p.cells() {
+		for _, service := range p.services {
+			name := strings.NewReplacer(
+				"{service}", service,
+				"{cell}", fmt.Sprintf("%03d", cellID),
+			).Replace(p.template)
+
+			_, records, err := p.resolver.LookupSRV(ctx, "", "", name)
+			if err != nil {
+				// A cell may simply not run this service
+				failures++
+				continue
+			}
+			for _, srv := range records {
+				host := strings.TrimSuffix(srv.Target, ".")
+				snap = append(snap, Endpoint{
+					CellID:  cellID,
+					Service: service,
+					Address: net.JoinHostPort(host, strconv.Itoa(int(srv.Port))),
+				})
+			}
+		}
+	}
+
+	if len(snap) == 0 && failures > 0 {
+		return nil, fmt.Errorf("no SRV records resolved (%d lookups failed)", failures)
+	}
+	return snap, nil
+}
@@ -0,0 +1,152 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Registration is a service replica announcing itself to the registry
+type Registration struct {
+	InstanceID string    `json:"instance_id"`
+	CellID     int       `json:"cell_id"`
+	Service    string    `json:"service"`
+	Address    string    `json:"address"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Registry is a lease-based registry that services register with on
+// startup and keep alive by re-registering. Replicas that stop
+// heartbeating drop out after the TTL. It is also a Provider whose watchers
+// are notified on every change.
+type Registry struct {
+	instances map[string]Registration
+	watchers  map[chan Snapshot]struct{}
+	ttl       time.Duration
+	mu        sync.Mutex
+}
+
+// NewRegistry creates a registry with the given lease TTL
+func NewRegistry(ttl time.Duration) *Registry {
+	return &Registry{
+		instances: make(map[string]Registration),
+		watchers:  make(map[chan Snapshot]struct{}),
+		ttl:       ttl,
+	}
+}
+
+func (r *Registry) Name() string { return "registry" }
+
+// Register creates or renews a replica's lease
+func (r *Registry) Register(reg Registration) (Registration, error) {
+	if reg.InstanceID == "" || reg.Service == "" || reg.Address == "" {
+		return Registration{}, fmt.Errorf("instance_id, service and address are required")
+	}
+	if reg.CellID <= 0 {
+		return Registration{}, fmt.Errorf("cell_id must be positive")
+	}
+	reg.ExpiresAt = time.Now().Add(r.ttl)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev, existed := r.instances[reg.InstanceID]
+	r.instances[reg.InstanceID] = reg
+
+	prev.ExpiresAt = reg.ExpiresAt
+	if !existed || prev != reg {
+		r.notifyLocked()
+	}
+	return reg, nil
+}
+
+// Deregister removes a replica immediately, e.g. on graceful shutdown
+func (r *Registry) Deregister(instanceID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.instances[instanceID]; ok {
+		delete(r.instances, instanceID)
+		r.notifyLocked()
+	}
+}
+
+// Instances returns every live registration
+func (r *Registry) Instances() []Registration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]Registration, 0, len(r.instances))
+	for _, reg := range r.instances {
+		result = append(result, reg)
+	}
+	return result
+}
+
+// Watch implements Provider
+func (r *Registry) Watch(ctx context.Context) (<-chan Snapshot, error) {
+	ch := make(chan Snapshot, 1)
+
+	r.mu.Lock()
+	r.watchers[ch] = struct{}{}
+	ch <- r.snapshotLocked()
+	r.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		r.mu.Lock()
+		delete(r.watchers, ch)
+		close(ch)
+		r.mu.Unlock()
+	}()
+
+	return ch, nil
+}
+
+// ExpireLoop drops expired leases until ctx is cancelled
+func (r *Registry) ExpireLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			r.mu.Lock()
+			changed := false
+			for id, reg := range r.instances {
+				if now.After(reg.ExpiresAt) {
+					delete(r.instances, id)
+					changed = true
+				}
+			}
+			if changed {
+				r.notifyLocked()
+			}
+			r.mu.Unlock()
+		}
+	}
+}
+
+// notifyLocked pushes the latest snapshot to every watcher, replacing any
+// snapshot the watcher has not consumed yet
+func (r *Registry) notifyLocked() {
+	snap := r.snapshotLocked()
+	for ch := range r.watchers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- snap
+	}
+}
+
+func (r *Registry) snapshotLocked() Snapshot {
+	snap := make(Snapshot, 0, len(r.instances))
+	for _, reg := range r.instances {
+		snap = append(snap, Endpoint{CellID: reg.CellID, Service: reg.Service, Address: reg.Address})
+	}
+	return snap
+}
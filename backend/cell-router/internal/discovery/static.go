@@ -0,0 +1,70 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// staticFile is the on-disk format of the static provider:
+//
+//	{"cells": [{"cell_id": 1, "services": {"gateway": ["10.0.1.10:8080"]}}]}
+type staticFile struct {
+	Cells []struct {
+		CellID   int                 `json:"cell_id"`
+		Services map[string][]string `json:"services"`
+	} `json:"cells"`
+}
+
+// StaticProvider reads endpoints from a JSON file and re-reads it when the
+// file changes
+type StaticProvider struct {
+	path     string
+	interval time.Duration
+	logger   *logger.Logger
+}
+
+// NewStaticProvider creates a provider for the file at path
+func NewStaticProvider(path string, interval time.Duration, log *logger.Logger) *StaticProvider {
+	return &StaticProvider{path: path, interval: interval, logger: log}
+}
+
+func (p *StaticProvider) Name() string { return "static" }
+
+func (p *StaticProvider) Watch(ctx context.Context) (<-chan Snapshot, error) {
+	// Fail fast on a missing or malformed file at startup
+	if _, err := p.load(); err != nil {
+		return nil, err
+	}
+	return poll(ctx, p.interval, func(context.Context) (Snapshot, error) {
+		return p.load()
+	}, func(err error) {
+		p.logger.Error(err, "Failed to reload static endpoints, keeping current ones")
+	}), nil
+}
+
+func (p *StaticProvider) load() (Snapshot, error) {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read endpoints file: %w", err)
+	}
+
+	var file staticFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse endpoints file: %w", err)
+	}
+
+	var snap Snapshot
+	for _, cell := range file.Cells {
+		for service, addrs := range cell.Services {
+			for _, addr := range addrs {
+				snap = append(snap, Endpoint{CellID: cell.CellID, Service: service, Address: addr})
+			}
+		}
+	}
+	return snap, nil
+}
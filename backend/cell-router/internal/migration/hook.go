@@ -0,0 +1,90 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Hook copies one service's data for a user between cells. Each service
+// that keeps per-user state in a cell implements the matching endpoints.
+type Hook interface {
+	Service() string
+	Export(ctx context.Context, endpoint, userID string) ([]byte, error)
+	Import(ctx context.Context, endpoint, userID string, data []byte) error
+	Purge(ctx context.Context, endpoint, userID string) error
+}
+
+// HTTPHook calls a service's migration endpoints inside a cell:
+//
+//	GET    /internal/migration/<service>/users/<user_id>  export
+//	PUT    /internal/migration/<service>/users/<user_id>  import
+//	DELETE /internal/migration/<service>/users/<user_id>  purge
+//
+// The export payload is opaque to the router and passed to import unchanged.
+type HTTPHook struct {
+	service string
+	client  *http.Client
+}
+
+// NewHTTPHook creates a hook for a service
+func NewHTTPHook(service string, timeout time.Duration) *HTTPHook {
+	return &HTTPHook{
+		service: service,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (h *HTTPHook) Service() string { return h.service }
+
+func (h *HTTPHook) Export(ctx context.Context, endpoint, userID string) ([]byte, error) {
+	resp, err := h.do(ctx, http.MethodGet, endpoint, userID, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func (h *HTTPHook) Import(ctx context.Context, endpoint, userID string, data []byte) error {
+	resp, err := h.do(ctx, http.MethodPut, endpoint, userID, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (h *HTTPHook) Purge(ctx context.Context, endpoint, userID string) error {
+	resp, err := h.do(ctx, http.MethodDelete, endpoint, userID, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (h *HTTPHook) do(ctx context.Context, method, endpoint, userID string, body []byte) (*http.Response, error) {
+	u := fmt.Sprintf("http://%s/internal/migration/%s/users/%s", endpoint, h.service, url.PathEscape(userID))
+
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, h.service, err)
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: status %d: %s", method, h.service, resp.StatusCode, msg)
+	}
+	return resp, nil
+}
@@ -0,0 +1,111 @@
+package migration
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/titan-commerce/backend/cell-router/internal/override"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// ErrNotOwner is returned when a migration was taken over by another router
+var ErrNotOwner = errors.New(errors.ErrConflict, "migration is owned by another router")
+
+// State is the lifecycle state of a user migration
+type State string
+
+const (
+	StatePending   State = "PENDING"
+	StateFrozen    State = "FROZEN"
+	StateCopying   State = "COPYING"
+	StateFlipped   State = "FLIPPED"
+	StateCompleted State = "COMPLETED"
+	StateFailed    State = "FAILED"
+)
+
+// StepStatus is the progress of a single service's data copy
+type StepStatus string
+
+const (
+	StepPending    StepStatus = "PENDING"
+	StepExported   StepStatus = "EXPORTED"
+	StepImported   StepStatus = "IMPORTED"
+	StepFailed     StepStatus = "FAILED"
+	StepRolledBack StepStatus = "ROLLED_BACK"
+)
+
+// Step tracks the copy of one service's data for the user
+type Step struct {
+	Service   string     `json:"service"`
+	Status    StepStatus `json:"status"`
+	Bytes     int        `json:"bytes"`
+	Error     string     `json:"error,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Migration moves one user's data from one cell to another
+type Migration struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	SourceCell int       `json:"source_cell"`
+	TargetCell int       `json:"target_cell"`
+	State      State     `json:"state"`
+	Steps      []Step    `json:"steps"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// Owner is the router replica running the migration. It heartbeats while
+	// it does; a migration whose heartbeat goes stale is recovered by
+	// another replica.
+	Owner       string    `json:"owner"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+
+	// Previous is the override in place before the migration started, so a
+	// failed migration can put the user back exactly where they were
+	Previous *override.Override `json:"previous_override,omitempty"`
+}
+
+// NewMigration creates a pending migration with one step per service
+func NewMigration(userID string, sourceCell, targetCell int, services []string, previous *override.Override) *Migration {
+	now := time.Now()
+	m := &Migration{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		SourceCell: sourceCell,
+		TargetCell: targetCell,
+		State:      StatePending,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Previous:   previous,
+	}
+	for _, svc := range services {
+		m.Steps = append(m.Steps, Step{Service: svc, Status: StepPending, UpdatedAt: now})
+	}
+	return m
+}
+
+// IsTerminal reports whether the migration has finished, successfully or not
+func (m *Migration) IsTerminal() bool {
+	return m.State == StateCompleted || m.State == StateFailed
+}
+
+// Repository persists migrations
+type Repository interface {
+	// Save records a new migration, failing with ErrConflict if the user
+	// already has one that is not terminal
+	Save(ctx context.Context, m *Migration) error
+	// Update records progress made by the migration's owner and renews its
+	// heartbeat, failing with ErrNotOwner if another router took it over
+	Update(ctx context.Context, m *Migration) error
+	// Heartbeat renews the owner's heartbeat. It reports false if another
+	// router took the migration over or it has finished.
+	Heartbeat(ctx context.Context, id, owner string) (bool, error)
+	// Claim hands an unfinished migration to owner if its heartbeat is older
+	// than ttl, reporting whether it did
+	Claim(ctx context.Context, id, owner string, ttl time.Duration) (bool, error)
+	FindByID(ctx context.Context, id string) (*Migration, error)
+	FindByUserID(ctx context.Context, userID string) ([]*Migration, error)
+	FindActive(ctx context.Context) ([]*Migration, error)
+}
@@ -0,0 +1,406 @@
+package migration
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/titan-commerce/backend/cell-router/internal/override"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+const (
+	// MigrationTimeout bounds a single migration run end to end
+	MigrationTimeout = 10 * time.Minute
+	// HeartbeatInterval is how often the owner of a migration checks in
+	HeartbeatInterval = 10 * time.Second
+	// HeartbeatTTL is how long a migration may go without a heartbeat before
+	// another replica recovers it
+	HeartbeatTTL = 30 * time.Second
+)
+
+// EndpointResolver resolves the endpoint of a service inside a cell
+type EndpointResolver interface {
+	ServiceEndpoint(cellID int, service string) (string, error)
+}
+
+// Migrator moves users between cells:
+//
+//  1. freeze  - pin the user to the source cell with writes blocked
+//  2. copy    - export each service's data from the source, import into the target
+//  3. flip    - pin the user to the target cell, still frozen
+//  4. release - unfreeze the user on the target cell
+//
+// Any failure before the flip purges what was imported into the target and
+// restores the user's previous override.
+//
+// Every router replica runs a migrator. A migration is owned by the replica
+// that started it and heartbeats while it runs; Recover only takes over
+// migrations whose heartbeat went stale.
+type Migrator struct {
+	owner     string
+	repo      Repository
+	overrides *override.Table
+	cells     EndpointResolver
+	hooks     []Hook
+	settle    time.Duration
+	logger    *logger.Logger
+}
+
+// NewMigrator creates a migrator. settle is how long to wait after freezing
+// so every router replica has picked up the frozen override; it should be at
+// least the override refresh interval.
+func NewMigrator(repo Repository, overrides *override.Table, cells EndpointResolver, hooks []Hook, settle time.Duration, log *logger.Logger) *Migrator {
+	return &Migrator{
+		owner:     instanceID(),
+		repo:      repo,
+		overrides: overrides,
+		cells:     cells,
+		hooks:     hooks,
+		settle:    settle,
+		logger:    log,
+	}
+}
+
+// Start validates and records a migration, then runs it in the background.
+// Progress is visible through Get.
+func (m *Migrator) Start(ctx context.Context, userID string, sourceCell, targetCell int) (*Migration, error) {
+	if userID == "" {
+		return nil, errors.New(errors.ErrInvalidInput, "user ID is required")
+	}
+	// Without hooks nothing would be copied and the user would land on an
+	// empty cell
+	if len(m.hooks) == 0 {
+		return nil, errors.New(errors.ErrInvalidInput, "no services are configured for migration")
+	}
+	if sourceCell == targetCell {
+		return nil, errors.New(errors.ErrInvalidInput, "user is already on the target cell")
+	}
+	for _, h := range m.hooks {
+		if _, err := m.cells.ServiceEndpoint(targetCell, h.Service()); err != nil {
+			return nil, errors.Wrap(errors.ErrInvalidInput, "target cell cannot receive "+h.Service()+" data", err)
+		}
+	}
+
+	var previous *override.Override
+	if o, ok := m.overrides.Lookup(userID); ok {
+		copied := *o
+		previous = &copied
+	}
+
+	services := make([]string, 0, len(m.hooks))
+	for _, h := range m.hooks {
+		services = append(services, h.Service())
+	}
+
+	// Save refuses a second migration in flight for the user
+	mig := NewMigration(userID, sourceCell, targetCell, services, previous)
+	mig.Owner = m.owner
+	if err := m.repo.Save(ctx, mig); err != nil {
+		return nil, err
+	}
+
+	m.logger.Infof("Migration %s started: user %s cell %d -> %d", mig.ID, userID, sourceCell, targetCell)
+
+	go func() {
+		runCtx, cancel := context.WithTimeout(context.Background(), MigrationTimeout)
+		defer cancel()
+		m.run(runCtx, mig)
+	}()
+
+	return mig, nil
+}
+
+// Get returns a migration by ID
+func (m *Migrator) Get(ctx context.Context, id string) (*Migration, error) {
+	return m.repo.FindByID(ctx, id)
+}
+
+// ListForUser returns every migration recorded for a user
+func (m *Migrator) ListForUser(ctx context.Context, userID string) ([]*Migration, error) {
+	return m.repo.FindByUserID(ctx, userID)
+}
+
+// Recover takes over migrations whose owner stopped heartbeating, e.g.
+// because its router crashed. Migrations that already flipped are released;
+// anything earlier is rolled back so no user stays frozen. A migration that
+// cannot be released or restored is left active, and the next pass, once
+// its heartbeat is stale again, tries again.
+func (m *Migrator) Recover(ctx context.Context) error {
+	active, err := m.repo.FindActive(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, stale := range active {
+		claimed, err := m.repo.Claim(ctx, stale.ID, m.owner, HeartbeatTTL)
+		if err != nil {
+			m.logger.Errorf(err, "Failed to claim migration %s", stale.ID)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		// Reread it: the last owner may have made progress since the scan
+		mig, err := m.repo.FindByID(ctx, stale.ID)
+		if err != nil {
+			m.logger.Errorf(err, "Failed to load claimed migration %s", stale.ID)
+			continue
+		}
+
+		m.logger.Warnf("Recovering migration %s in state %s from router %s", mig.ID, mig.State, stale.Owner)
+		mig.Owner = m.owner
+		if mig.State == StateFlipped {
+			if err := m.release(ctx, mig); err != nil {
+				m.logger.Errorf(err, "Failed to release migration %s, retrying on the next pass", mig.ID)
+			}
+			continue
+		}
+		m.rollback(ctx, mig, fmt.Errorf("interrupted: router %s stopped heartbeating", stale.Owner))
+	}
+	return nil
+}
+
+// Watch runs Recover every interval until ctx is done
+func (m *Migrator) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Recover(ctx); err != nil {
+				m.logger.Error(err, "Failed to recover stale migrations")
+			}
+		}
+	}
+}
+
+func (m *Migrator) run(ctx context.Context, mig *Migration) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go m.heartbeat(ctx, mig.ID, cancel)
+
+	if err := m.freeze(ctx, mig); err != nil {
+		m.fail(ctx, mig, err)
+		return
+	}
+	if err := m.copy(ctx, mig); err != nil {
+		m.fail(ctx, mig, err)
+		return
+	}
+	if err := m.flip(ctx, mig); err != nil {
+		m.fail(ctx, mig, err)
+		return
+	}
+	if err := m.release(context.WithoutCancel(ctx), mig); err != nil {
+		// The user already lives on the target cell; only the freeze is
+		// left. The heartbeat stops with this run, so recovery retries it.
+		m.logger.Errorf(err, "Migration %s flipped but release failed, leaving it to recovery", mig.ID)
+		return
+	}
+	m.logger.Infof("Migration %s completed: user %s now on cell %d", mig.ID, mig.UserID, mig.TargetCell)
+}
+
+// heartbeat keeps the migration owned until ctx is done. If another router
+// took it over, the run is cancelled with ErrNotOwner.
+func (m *Migrator) heartbeat(ctx context.Context, id string, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			owned, err := m.repo.Heartbeat(ctx, id, m.owner)
+			if err != nil {
+				m.logger.Errorf(err, "Failed to renew heartbeat of migration %s", id)
+				continue
+			}
+			if !owned {
+				cancel(ErrNotOwner)
+				return
+			}
+		}
+	}
+}
+
+// fail rolls the migration back, unless another router took it over and
+// rolls it back itself
+func (m *Migrator) fail(ctx context.Context, mig *Migration, err error) {
+	if stderrors.Is(err, ErrNotOwner) || stderrors.Is(context.Cause(ctx), ErrNotOwner) {
+		m.logger.Warnf("Migration %s was taken over by another router, stopping", mig.ID)
+		return
+	}
+	// Rollback must still run when the migration timed out
+	m.rollback(context.WithoutCancel(ctx), mig, err)
+}
+
+func (m *Migrator) freeze(ctx context.Context, mig *Migration) error {
+	err := m.overrides.Put(ctx, &override.Override{
+		UserID:    mig.UserID,
+		CellID:    mig.SourceCell,
+		Reason:    "migration " + mig.ID,
+		Frozen:    true,
+		CreatedBy: "migrator",
+	})
+	if err != nil {
+		return err
+	}
+	if err := m.setState(ctx, mig, StateFrozen); err != nil {
+		return err
+	}
+
+	// Let in-flight writes drain and other replicas observe the freeze
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(m.settle):
+		return nil
+	}
+}
+
+func (m *Migrator) copy(ctx context.Context, mig *Migration) error {
+	if err := m.setState(ctx, mig, StateCopying); err != nil {
+		return err
+	}
+
+	for i, hook := range m.hooks {
+		step := &mig.Steps[i]
+
+		source, err := m.cells.ServiceEndpoint(mig.SourceCell, hook.Service())
+		if err != nil {
+			m.failStep(ctx, mig, step, err)
+			return err
+		}
+		target, err := m.cells.ServiceEndpoint(mig.TargetCell, hook.Service())
+		if err != nil {
+			m.failStep(ctx, mig, step, err)
+			return err
+		}
+
+		data, err := hook.Export(ctx, source, mig.UserID)
+		if err != nil {
+			m.failStep(ctx, mig, step, err)
+			return fmt.Errorf("export %s: %w", hook.Service(), err)
+		}
+		step.Status = StepExported
+		step.Bytes = len(data)
+		step.UpdatedAt = time.Now()
+		m.save(ctx, mig)
+
+		if err := hook.Import(ctx, target, mig.UserID, data); err != nil {
+			m.failStep(ctx, mig, step, err)
+			return fmt.Errorf("import %s: %w", hook.Service(), err)
+		}
+		step.Status = StepImported
+		step.UpdatedAt = time.Now()
+		m.save(ctx, mig)
+	}
+	return nil
+}
+
+func (m *Migrator) flip(ctx context.Context, mig *Migration) error {
+	err := m.overrides.Put(ctx, &override.Override{
+		UserID:    mig.UserID,
+		CellID:    mig.TargetCell,
+		Reason:    "migration " + mig.ID,
+		Frozen:    true,
+		CreatedBy: "migrator",
+	})
+	if err != nil {
+		return err
+	}
+	return m.setState(ctx, mig, StateFlipped)
+}
+
+func (m *Migrator) release(ctx context.Context, mig *Migration) error {
+	err := m.overrides.Put(ctx, &override.Override{
+		UserID:    mig.UserID,
+		CellID:    mig.TargetCell,
+		Reason:    fmt.Sprintf("migrated from cell %d (migration %s)", mig.SourceCell, mig.ID),
+		CreatedBy: "migrator",
+	})
+	if err != nil {
+		return err
+	}
+	return m.setState(ctx, mig, StateCompleted)
+}
+
+// rollback purges imported data from the target cell and restores the
+// user's previous routing
+func (m *Migrator) rollback(ctx context.Context, mig *Migration, cause error) {
+	m.logger.Errorf(cause, "Migration %s failed, rolling back", mig.ID)
+
+	for i, hook := range m.hooks {
+		step := &mig.Steps[i]
+		if step.Status != StepImported && step.Status != StepFailed {
+			continue
+		}
+		target, err := m.cells.ServiceEndpoint(mig.TargetCell, hook.Service())
+		if err == nil {
+			err = hook.Purge(ctx, target, mig.UserID)
+		}
+		if err != nil {
+			m.logger.Errorf(err, "Failed to purge %s data for user %s from cell %d", hook.Service(), mig.UserID, mig.TargetCell)
+			continue
+		}
+		step.Status = StepRolledBack
+		step.UpdatedAt = time.Now()
+	}
+
+	var err error
+	if mig.Previous != nil {
+		restored := *mig.Previous
+		restored.Frozen = false
+		err = m.overrides.Put(ctx, &restored)
+	} else {
+		err = m.overrides.Delete(ctx, mig.UserID)
+	}
+	mig.Error = cause.Error()
+	if err != nil {
+		// Failing now would leave the user frozen for good
+		m.logger.Errorf(err, "Failed to restore routing for user %s, leaving migration %s to recovery", mig.UserID, mig.ID)
+		m.save(ctx, mig)
+		return
+	}
+	if err := m.setState(ctx, mig, StateFailed); err != nil {
+		m.logger.Errorf(err, "Failed to record rollback of migration %s", mig.ID)
+	}
+}
+
+func (m *Migrator) failStep(ctx context.Context, mig *Migration, step *Step, err error) {
+	step.Status = StepFailed
+	step.Error = err.Error()
+	step.UpdatedAt = time.Now()
+	m.save(ctx, mig)
+}
+
+func (m *Migrator) setState(ctx context.Context, mig *Migration, state State) error {
+	mig.State = state
+	mig.UpdatedAt = time.Now()
+	return m.repo.Update(ctx, mig)
+}
+
+func (m *Migrator) save(ctx context.Context, mig *Migration) {
+	mig.UpdatedAt = time.Now()
+	if err := m.repo.Update(ctx, mig); err != nil {
+		m.logger.Errorf(err, "Failed to record progress for migration %s", mig.ID)
+	}
+}
+
+// instanceID names this router replica as the owner of its migrations
+func instanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "cell-router"
+	}
+	return host + "-" + uuid.New().String()[:8]
+}
@@ -0,0 +1,227 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/titan-commerce/backend/cell-router/internal/override"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+type fakeCells struct{}
+
+func (fakeCells) ServiceEndpoint(cellID int, service string) (string, error) {
+	return fmt.Sprintf("cell-%d", cellID), nil
+}
+
+// fakeHook stores exported data per endpoint so tests can inspect each cell
+type fakeHook struct {
+	data      map[string][]byte
+	failWrite bool
+}
+
+func (h *fakeHook) Service() string { return "orders" }
+
+func (h *fakeHook) Export(ctx context.Context, endpoint, userID string) ([]byte, error) {
+	return h.data[endpoint+"/"+userID], nil
+}
+
+func (h *fakeHook) Import(ctx context.Context, endpoint, userID string, data []byte) error {
+	if h.failWrite {
+		return fmt.Errorf("import rejected")
+	}
+	h.data[endpoint+"/"+userID] = data
+	return nil
+}
+
+func (h *fakeHook) Purge(ctx context.Context, endpoint, userID string) error {
+	delete(h.data, endpoint+"/"+userID)
+	return nil
+}
+
+func runMigration(t *testing.T, hook *fakeHook) (*Migration, *override.Table) {
+	t.Helper()
+	ctx := context.Background()
+	log := logger.New(logger.Config{Level: "error", ServiceName: "test"})
+
+	overrides, _ := override.NewTable(ctx, override.NewMemoryStore(), log)
+	repo := NewMemoryRepository()
+	migrator := NewMigrator(repo, overrides, fakeCells{}, []Hook{hook}, 0, log)
+
+	mig, err := migrator.Start(ctx, "user-1", 1, 2)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		current, _ := migrator.Get(ctx, mig.ID)
+		if current.IsTerminal() {
+			return current, overrides
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("migration did not finish")
+	return nil, nil
+}
+
+func TestMigrator_MovesUserAndReleases(t *testing.T) {
+	hook := &fakeHook{data: map[string][]byte{"cell-1/user-1": []byte("orders")}}
+
+	mig, overrides := runMigration(t, hook)
+
+	if mig.State != StateCompleted {
+		t.Fatalf("state = %s (%s), want COMPLETED", mig.State, mig.Error)
+	}
+	if string(hook.data["cell-2/user-1"]) != "orders" {
+		t.Errorf("data not copied to target cell")
+	}
+	o, ok := overrides.Lookup("user-1")
+	if !ok || o.CellID != 2 || o.Frozen {
+		t.Errorf("override = %+v, want unfrozen pin to cell 2", o)
+	}
+}
+
+func TestMigrator_RollsBackOnImportFailure(t *testing.T) {
+	hook := &fakeHook{data: map[string][]byte{"cell-1/user-1": []byte("orders")}, failWrite: true}
+
+	mig, overrides := runMigration(t, hook)
+
+	if mig.State != StateFailed {
+		t.Fatalf("state = %s, want FAILED", mig.State)
+	}
+	if _, ok := overrides.Lookup("user-1"); ok {
+		t.Errorf("override should be removed after rollback")
+	}
+	if mig.Steps[0].Status != StepRolledBack {
+		t.Errorf("step status = %s, want ROLLED_BACK", mig.Steps[0].Status)
+	}
+}
+
+func TestMigrator_RefusesWithoutHooks(t *testing.T) {
+	ctx := context.Background()
+	log := logger.New(logger.Config{Level: "error", ServiceName: "test"})
+	overrides, _ := override.NewTable(ctx, override.NewMemoryStore(), log)
+	migrator := NewMigrator(NewMemoryRepository(), overrides, fakeCells{}, nil, 0, log)
+
+	if _, err := migrator.Start(ctx, "user-1", 1, 2); err == nil {
+		t.Fatal("Start() without hooks should fail")
+	}
+	if _, ok := overrides.Lookup("user-1"); ok {
+		t.Error("a refused migration should not pin the user")
+	}
+}
+
+func TestMemoryRepository_OneActiveMigrationPerUser(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+
+	first := NewMigration("user-1", 1, 2, []string{"orders"}, nil)
+	if err := repo.Save(ctx, first); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := repo.Save(ctx, NewMigration("user-1", 1, 3, []string{"orders"}, nil)); err == nil {
+		t.Fatal("Save() of a second active migration should fail")
+	}
+
+	first.State = StateCompleted
+	repo.Update(ctx, first)
+	if err := repo.Save(ctx, NewMigration("user-1", 2, 3, []string{"orders"}, nil)); err != nil {
+		t.Errorf("Save() after the first completed: %v", err)
+	}
+}
+
+// flakyStore fails every override write while failing is set
+type flakyStore struct {
+	*override.MemoryStore
+	failing bool
+}
+
+func (s *flakyStore) Put(ctx context.Context, o *override.Override) error {
+	if s.failing {
+		return fmt.Errorf("store unavailable")
+	}
+	return s.MemoryStore.Put(ctx, o)
+}
+
+// flipped records a migration another router flipped, with a heartbeat age
+// old
+func flipped(t *testing.T, repo *MemoryRepository, userID, owner string, age time.Duration) *Migration {
+	t.Helper()
+	mig := NewMigration(userID, 1, 2, []string{"orders"}, nil)
+	mig.Owner = owner
+	mig.State = StateFlipped
+	if err := repo.Save(context.Background(), mig); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	stored := repo.migrations[mig.ID]
+	stored.HeartbeatAt = time.Now().Add(-age)
+	repo.migrations[mig.ID] = stored
+	return mig
+}
+
+func TestMigrator_RecoverOnlyTakesOverStaleMigrations(t *testing.T) {
+	ctx := context.Background()
+	log := logger.New(logger.Config{Level: "error", ServiceName: "test"})
+	overrides, _ := override.NewTable(ctx, override.NewMemoryStore(), log)
+	repo := NewMemoryRepository()
+	migrator := NewMigrator(repo, overrides, fakeCells{}, []Hook{&fakeHook{}}, 0, log)
+
+	live := flipped(t, repo, "user-live", "router-a", time.Second)
+	crashed := flipped(t, repo, "user-crashed", "router-b", 2*HeartbeatTTL)
+
+	if err := migrator.Recover(ctx); err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+
+	if got, _ := migrator.Get(ctx, live.ID); got.State != StateFlipped || got.Owner != "router-a" {
+		t.Errorf("live migration = %s owned by %s, want it left to router-a", got.State, got.Owner)
+	}
+	if got, _ := migrator.Get(ctx, crashed.ID); got.State != StateCompleted {
+		t.Errorf("crashed migration state = %s, want COMPLETED", got.State)
+	}
+	if o, ok := overrides.Lookup("user-crashed"); !ok || o.CellID != 2 || o.Frozen {
+		t.Errorf("override = %+v, want unfrozen pin to cell 2", o)
+	}
+
+	// The router it was taken from can no longer record progress
+	crashed.State = StateFailed
+	if err := repo.Update(ctx, crashed); err != ErrNotOwner {
+		t.Errorf("Update() by the old owner error = %v, want ErrNotOwner", err)
+	}
+}
+
+func TestMigrator_RecoverRetriesFailedRelease(t *testing.T) {
+	ctx := context.Background()
+	log := logger.New(logger.Config{Level: "error", ServiceName: "test"})
+	store := &flakyStore{MemoryStore: override.NewMemoryStore(), failing: true}
+	overrides, _ := override.NewTable(ctx, store, log)
+	repo := NewMemoryRepository()
+	migrator := NewMigrator(repo, overrides, fakeCells{}, []Hook{&fakeHook{}}, 0, log)
+
+	mig := flipped(t, repo, "user-1", "router-b", 2*HeartbeatTTL)
+
+	if err := migrator.Recover(ctx); err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+	if got, _ := migrator.Get(ctx, mig.ID); got.State != StateFlipped {
+		t.Fatalf("state = %s, want FLIPPED until the release goes through", got.State)
+	}
+
+	// Once the heartbeat is stale again, the next pass releases the user
+	store.failing = false
+	stored := repo.migrations[mig.ID]
+	stored.HeartbeatAt = time.Now().Add(-2 * HeartbeatTTL)
+	repo.migrations[mig.ID] = stored
+	if err := migrator.Recover(ctx); err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+	if got, _ := migrator.Get(ctx, mig.ID); got.State != StateCompleted {
+		t.Errorf("state = %s, want COMPLETED", got.State)
+	}
+	if overrides.IsFrozen("user-1") {
+		t.Error("user should no longer be frozen")
+	}
+}
@@ -0,0 +1,289 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// PostgresRepository persists migrations in the cell_migrations table
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository creates a repository on an open database
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// Save records a new migration. A user has at most one migration in
+// flight; the partial unique index on user_id enforces it, so two routers
+// starting one at once cannot both succeed.
+func (r *PostgresRepository) Save(ctx context.Context, m *Migration) error {
+	steps, previous, err := marshalDetails(m)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO cell_migrations (
+			id, user_id, source_cell, target_cell, state, steps, previous_override,
+			error, created_at, updated_at, owner, heartbeat_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW())
+	`
+
+	_, err = r.db.ExecContext(ctx, query,
+		m.ID, m.UserID, m.SourceCell, m.TargetCell, m.State, steps, previous,
+		m.Error, m.CreatedAt, m.UpdatedAt, m.Owner,
+	)
+	if isUniqueViolation(err) {
+		return errors.New(errors.ErrConflict, "a migration is already in progress for this user")
+	}
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to save migration", err)
+	}
+	return nil
+}
+
+// Update records progress. Heartbeats use the database clock, so replicas
+// with skewed clocks agree on which are stale.
+func (r *PostgresRepository) Update(ctx context.Context, m *Migration) error {
+	steps, previous, err := marshalDetails(m)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE cell_migrations
+		SET state = $2, steps = $3, previous_override = $4, error = $5, updated_at = $6,
+			heartbeat_at = NOW()
+		WHERE id = $1 AND owner = $7
+	`
+
+	result, err := r.db.ExecContext(ctx, query, m.ID, m.State, steps, previous, m.Error, m.UpdatedAt, m.Owner)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to update migration", err)
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+func (r *PostgresRepository) Heartbeat(ctx context.Context, id, owner string) (bool, error) {
+	query := `
+		UPDATE cell_migrations SET heartbeat_at = NOW()
+		WHERE id = $1 AND owner = $2 AND state NOT IN ($3, $4)
+	`
+	return r.exec(ctx, "failed to renew migration heartbeat", query, id, owner, StateCompleted, StateFailed)
+}
+
+func (r *PostgresRepository) Claim(ctx context.Context, id, owner string, ttl time.Duration) (bool, error) {
+	query := `
+		UPDATE cell_migrations SET owner = $2, heartbeat_at = NOW()
+		WHERE id = $1 AND state NOT IN ($3, $4)
+		  AND heartbeat_at < NOW() - make_interval(secs => $5)
+	`
+	return r.exec(ctx, "failed to claim migration", query, id, owner, StateCompleted, StateFailed, ttl.Seconds())
+}
+
+// exec runs a conditional update, reporting whether it matched a row
+func (r *PostgresRepository) exec(ctx context.Context, msg, query string, args ...interface{}) (bool, error) {
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, errors.Wrap(errors.ErrInternal, msg, err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(errors.ErrInternal, msg, err)
+	}
+	return updated > 0, nil
+}
+
+func (r *PostgresRepository) FindByID(ctx context.Context, id string) (*Migration, error) {
+	migrations, err := r.query(ctx, `WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(migrations) == 0 {
+		return nil, errors.New(errors.ErrNotFound, "migration not found")
+	}
+	return migrations[0], nil
+}
+
+func (r *PostgresRepository) FindByUserID(ctx context.Context, userID string) ([]*Migration, error) {
+	return r.query(ctx, `WHERE user_id = $1 ORDER BY created_at DESC`, userID)
+}
+
+func (r *PostgresRepository) FindActive(ctx context.Context) ([]*Migration, error) {
+	return r.query(ctx, `WHERE state NOT IN ($1, $2) ORDER BY created_at`, StateCompleted, StateFailed)
+}
+
+func (r *PostgresRepository) query(ctx context.Context, where string, args ...interface{}) ([]*Migration, error) {
+	query := `
+		SELECT id, user_id, source_cell, target_cell, state, steps, previous_override,
+			   error, created_at, updated_at, owner, heartbeat_at
+		FROM cell_migrations ` + where
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to query migrations", err)
+	}
+	defer rows.Close()
+
+	var result []*Migration
+	for rows.Next() {
+		var m Migration
+		var steps, previous []byte
+		if err := rows.Scan(
+			&m.ID, &m.UserID, &m.SourceCell, &m.TargetCell, &m.State, &steps, &previous,
+			&m.Error, &m.CreatedAt, &m.UpdatedAt, &m.Owner, &m.HeartbeatAt,
+		); err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to scan migration", err)
+		}
+		if err := json.Unmarshal(steps, &m.Steps); err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to decode migration steps", err)
+		}
+		if len(previous) > 0 {
+			if err := json.Unmarshal(previous, &m.Previous); err != nil {
+				return nil, errors.Wrap(errors.ErrInternal, "failed to decode previous override", err)
+			}
+		}
+		result = append(result, &m)
+	}
+	return result, rows.Err()
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return stderrors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// marshalDetails encodes the JSONB columns. They are passed as strings since
+// lib/pq sends []byte as bytea.
+func marshalDetails(m *Migration) (string, sql.NullString, error) {
+	steps, err := json.Marshal(m.Steps)
+	if err != nil {
+		return "", sql.NullString{}, errors.Wrap(errors.ErrInternal, "failed to encode migration steps", err)
+	}
+	var previous sql.NullString
+	if m.Previous != nil {
+		data, err := json.Marshal(m.Previous)
+		if err != nil {
+			return "", sql.NullString{}, errors.Wrap(errors.ErrInternal, "failed to encode previous override", err)
+		}
+		previous = sql.NullString{String: string(data), Valid: true}
+	}
+	return string(steps), previous, nil
+}
+
+// MemoryRepository keeps migrations in process memory
+type MemoryRepository struct {
+	migrations map[string]Migration
+	mu         sync.RWMutex
+}
+
+// NewMemoryRepository creates an empty in-memory repository
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{migrations: make(map[string]Migration)}
+}
+
+func (r *MemoryRepository) Save(ctx context.Context, m *Migration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.migrations {
+		if existing.UserID == m.UserID && !existing.IsTerminal() {
+			return errors.New(errors.ErrConflict, fmt.Sprintf("migration %s is already in progress for this user", existing.ID))
+		}
+	}
+	r.put(m)
+	return nil
+}
+
+func (r *MemoryRepository) Update(ctx context.Context, m *Migration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.migrations[m.ID]; ok && existing.Owner != m.Owner {
+		return ErrNotOwner
+	}
+	r.put(m)
+	return nil
+}
+
+func (r *MemoryRepository) Heartbeat(ctx context.Context, id, owner string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.migrations[id]
+	if !ok || m.Owner != owner || m.IsTerminal() {
+		return false, nil
+	}
+	m.HeartbeatAt = time.Now()
+	r.migrations[id] = m
+	return true, nil
+}
+
+func (r *MemoryRepository) Claim(ctx context.Context, id, owner string, ttl time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.migrations[id]
+	if !ok || m.IsTerminal() || time.Since(m.HeartbeatAt) <= ttl {
+		return false, nil
+	}
+	m.Owner = owner
+	m.HeartbeatAt = time.Now()
+	r.migrations[id] = m
+	return true, nil
+}
+
+func (r *MemoryRepository) put(m *Migration) {
+	copied := *m
+	copied.Steps = append([]Step(nil), m.Steps...)
+	copied.HeartbeatAt = time.Now()
+	r.migrations[m.ID] = copied
+}
+
+func (r *MemoryRepository) FindByID(ctx context.Context, id string) (*Migration, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m, ok := r.migrations[id]
+	if !ok {
+		return nil, errors.New(errors.ErrNotFound, "migration not found")
+	}
+	return &m, nil
+}
+
+func (r *MemoryRepository) FindByUserID(ctx context.Context, userID string) ([]*Migration, error) {
+	return r.filter(func(m *Migration) bool { return m.UserID == userID }), nil
+}
+
+func (r *MemoryRepository) FindActive(ctx context.Context) ([]*Migration, error) {
+	return r.filter(func(m *Migration) bool { return !m.IsTerminal() }), nil
+}
+
+func (r *MemoryRepository) filter(match func(*Migration) bool) []*Migration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []*Migration
+	for _, m := range r.migrations {
+		m := m
+		if match(&m) {
+			result = append(result, &m)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result
+}
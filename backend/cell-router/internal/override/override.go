@@ -0,0 +1,194 @@
+package override
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// Override pins a user to a cell regardless of where the hash ring puts them.
+// A frozen override also blocks the user's writes while their data is moved.
+type Override struct {
+	UserID    string    `json:"user_id"`
+	CellID    int       `json:"cell_id"`
+	Reason    string    `json:"reason"`
+	Frozen    bool      `json:"frozen"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Store persists overrides
+type Store interface {
+	Get(ctx context.Context, userID string) (*Override, error)
+	Put(ctx context.Context, o *Override) error
+	Delete(ctx context.Context, userID string) error
+	List(ctx context.Context) ([]*Override, error)
+}
+
+// Table is the in-memory view of the override store that the routing hot
+// path reads. Writes go through to the store; a periodic refresh picks up
+// changes made by other router replicas.
+type Table struct {
+	store     Store
+	overrides map[string]*Override
+	mu        sync.RWMutex
+	logger    *logger.Logger
+}
+
+// NewTable creates a table and loads the current overrides
+func NewTable(ctx context.Context, store Store, log *logger.Logger) (*Table, error) {
+	t := &Table{
+		store:     store,
+		overrides: make(map[string]*Override),
+		logger:    log,
+	}
+	if err := t.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Lookup returns the override for a user, if any
+func (t *Table) Lookup(userID string) (*Override, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	o, ok := t.overrides[userID]
+	return o, ok
+}
+
+// IsFrozen reports whether the user's writes are currently blocked
+func (t *Table) IsFrozen(userID string) bool {
+	o, ok := t.Lookup(userID)
+	return ok && o.Frozen
+}
+
+// Put creates or replaces an override
+func (t *Table) Put(ctx context.Context, o *Override) error {
+	if o.UserID == "" {
+		return errors.New(errors.ErrInvalidInput, "user ID is required")
+	}
+	if o.CellID <= 0 {
+		return errors.New(errors.ErrInvalidInput, "cell ID must be positive")
+	}
+	o.UpdatedAt = time.Now()
+
+	if err := t.store.Put(ctx, o); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.overrides[o.UserID] = o
+	t.mu.Unlock()
+	return nil
+}
+
+// Delete removes a user's override so they route by hash again
+func (t *Table) Delete(ctx context.Context, userID string) error {
+	if err := t.store.Delete(ctx, userID); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	delete(t.overrides, userID)
+	t.mu.Unlock()
+	return nil
+}
+
+// List returns all overrides
+func (t *Table) List() []*Override {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	result := make([]*Override, 0, len(t.overrides))
+	for _, o := range t.overrides {
+		result = append(result, o)
+	}
+	return result
+}
+
+// Refresh reloads every override from the store
+func (t *Table) Refresh(ctx context.Context) error {
+	list, err := t.store.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	overrides := make(map[string]*Override, len(list))
+	for _, o := range list {
+		overrides[o.UserID] = o
+	}
+
+	t.mu.Lock()
+	t.overrides = overrides
+	t.mu.Unlock()
+	return nil
+}
+
+// Watch refreshes the table every interval until ctx is cancelled
+func (t *Table) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.Refresh(ctx); err != nil {
+				t.logger.Error(err, "Failed to refresh cell overrides")
+			}
+		}
+	}
+}
+
+// MemoryStore keeps overrides in process memory. It is used when the router
+// runs without a database, e.g. locally.
+type MemoryStore struct {
+	overrides map[string]Override
+	mu        sync.RWMutex
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{overrides: make(map[string]Override)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, userID string) (*Override, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	o, ok := s.overrides[userID]
+	if !ok {
+		return nil, errors.New(errors.ErrNotFound, "override not found")
+	}
+	return &o, nil
+}
+
+func (s *MemoryStore) Put(ctx context.Context, o *Override) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.overrides[o.UserID] = *o
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.overrides, userID)
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]*Override, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*Override, 0, len(s.overrides))
+	for _, o := range s.overrides {
+		o := o
+		result = append(result, &o)
+	}
+	return result, nil
+}
@@ -0,0 +1,88 @@
+package override
+
+import (
+	"context"
+	"database/sql"
+
+	_ "github.com/lib/pq"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// PostgresStore persists overrides in the cell_overrides table
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore creates a store on an open database
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Get(ctx context.Context, userID string) (*Override, error) {
+	query := `
+		SELECT user_id, cell_id, reason, frozen, created_by, updated_at
+		FROM cell_overrides WHERE user_id = $1
+	`
+
+	var o Override
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(
+		&o.UserID, &o.CellID, &o.Reason, &o.Frozen, &o.CreatedBy, &o.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errors.New(errors.ErrNotFound, "override not found")
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to get override", err)
+	}
+	return &o, nil
+}
+
+func (s *PostgresStore) Put(ctx context.Context, o *Override) error {
+	query := `
+		INSERT INTO cell_overrides (user_id, cell_id, reason, frozen, created_by, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE SET
+			cell_id = EXCLUDED.cell_id,
+			reason = EXCLUDED.reason,
+			frozen = EXCLUDED.frozen,
+			created_by = EXCLUDED.created_by,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := s.db.ExecContext(ctx, query, o.UserID, o.CellID, o.Reason, o.Frozen, o.CreatedBy, o.UpdatedAt)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to save override", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM cell_overrides WHERE user_id = $1`, userID)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to delete override", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) List(ctx context.Context) ([]*Override, error) {
+	query := `
+		SELECT user_id, cell_id, reason, frozen, created_by, updated_at
+		FROM cell_overrides
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to list overrides", err)
+	}
+	defer rows.Close()
+
+	var result []*Override
+	for rows.Next() {
+		var o Override
+		if err := rows.Scan(&o.UserID, &o.CellID, &o.Reason, &o.Frozen, &o.CreatedBy, &o.UpdatedAt); err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to scan override", err)
+		}
+		result = append(result, &o)
+	}
+	return result, rows.Err()
+}
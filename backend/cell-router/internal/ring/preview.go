@@ -0,0 +1,105 @@
+package ring
+
+import (
+	"math"
+	"sort"
+)
+
+// CellShare is the fraction of the keyspace a cell owns before and after a
+// topology change
+type CellShare struct {
+	CellID int     `json:"cell_id"`
+	Before float64 `json:"before"`
+	After  float64 `json:"after"`
+}
+
+// Movement is the fraction of the keyspace that moves between two cells
+type Movement struct {
+	FromCell int     `json:"from_cell"`
+	ToCell   int     `json:"to_cell"`
+	Fraction float64 `json:"fraction"`
+	Users    int64   `json:"estimated_users,omitempty"`
+}
+
+// ChangePreview describes the impact of moving from one ring to another
+type ChangePreview struct {
+	MovedFraction  float64     `json:"moved_fraction"`
+	EstimatedUsers int64       `json:"estimated_users_moved,omitempty"`
+	Shares         []CellShare `json:"shares"`
+	Movements      []Movement  `json:"movements"`
+}
+
+// Preview computes exactly which part of the hash space changes owner when
+// switching from the current ring to next. Because user IDs are hashed
+// uniformly, the moved fraction multiplied by totalUsers estimates how many
+// users would be remapped. totalUsers may be zero to skip the estimate.
+func Preview(current, next *Ring, totalUsers int64) *ChangePreview {
+	// Every arc between two consecutive tokens of either ring is owned by a
+	// single cell in each ring, so walking the merged token list is exact.
+	points := make([]uint64, 0, len(current.tokens)+len(next.tokens))
+	for _, t := range current.tokens {
+		points = append(points, t.hash)
+	}
+	for _, t := range next.tokens {
+		points = append(points, t.hash)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i] < points[j] })
+
+	before := make(map[int]float64)
+	after := make(map[int]float64)
+	moves := make(map[[2]int]float64)
+	var moved float64
+
+	prev := points[len(points)-1]
+	for _, p := range points {
+		// Arc (prev, p]; the first arc wraps around the top of the ring
+		if p == prev {
+			continue
+		}
+		width := float64(p-prev) / math.MaxUint64
+		prev = p
+
+		from := current.tokens[current.search(p)].cellID
+		to := next.tokens[next.search(p)].cellID
+		before[from] += width
+		after[to] += width
+		if from != to {
+			moved += width
+			moves[[2]int{from, to}] += width
+		}
+	}
+
+	preview := &ChangePreview{
+		MovedFraction:  moved,
+		EstimatedUsers: int64(math.Round(moved * float64(totalUsers))),
+	}
+
+	ids := make(map[int]bool)
+	for id := range before {
+		ids[id] = true
+	}
+	for id := range after {
+		ids[id] = true
+	}
+	for id := range ids {
+		preview.Shares = append(preview.Shares, CellShare{CellID: id, Before: before[id], After: after[id]})
+	}
+	sort.Slice(preview.Shares, func(i, j int) bool { return preview.Shares[i].CellID < preview.Shares[j].CellID })
+
+	for key, fraction := range moves {
+		preview.Movements = append(preview.Movements, Movement{
+			FromCell: key[0],
+			ToCell:   key[1],
+			Fraction: fraction,
+			Users:    int64(math.Round(fraction * float64(totalUsers))),
+		})
+	}
+	sort.Slice(preview.Movements, func(i, j int) bool {
+		if preview.Movements[i].FromCell == preview.Movements[j].FromCell {
+			return preview.Movements[i].ToCell < preview.Movements[j].ToCell
+		}
+		return preview.Movements[i].FromCell < preview.Movements[j].FromCell
+	})
+
+	return preview
+}
@@ -0,0 +1,136 @@
+package ring
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// DefaultVirtualNodes is the number of ring tokens a cell of weight 1 owns
+const DefaultVirtualNodes = 128
+
+// token is a single virtual node position on the ring
+type token struct {
+	hash   uint64
+	cellID int
+}
+
+// Ring is an immutable consistent-hash ring built from a topology.
+// Each cell owns VirtualNodes*Weight tokens, so adding or removing a cell
+// only moves the keys that fall on its tokens.
+type Ring struct {
+	tokens   []token
+	cells    map[int]Cell
+	cellIDs  []int
+	topology *Topology
+}
+
+// New builds a ring from a topology
+func New(topo *Topology) (*Ring, error) {
+	if err := topo.Validate(); err != nil {
+		return nil, err
+	}
+
+	vnodes := topo.VirtualNodes
+	if vnodes <= 0 {
+		vnodes = DefaultVirtualNodes
+	}
+
+	r := &Ring{
+		cells:    make(map[int]Cell, len(topo.Cells)),
+		topology: topo,
+	}
+
+	for _, cell := range topo.Cells {
+		r.cells[cell.ID] = cell
+		r.cellIDs = append(r.cellIDs, cell.ID)
+
+		// Drained cells stay addressable but own no keys
+		if cell.Drained {
+			continue
+		}
+		for i := 0; i < vnodes*cell.Weight; i++ {
+			r.tokens = append(r.tokens, token{
+				hash:   hashKey(fmt.Sprintf("cell-%d#%d", cell.ID, i)),
+				cellID: cell.ID,
+			})
+		}
+	}
+
+	if len(r.tokens) == 0 {
+		return nil, fmt.Errorf("topology has no active cells")
+	}
+
+	sort.Slice(r.tokens, func(i, j int) bool {
+		if r.tokens[i].hash == r.tokens[j].hash {
+			return r.tokens[i].cellID < r.tokens[j].cellID
+		}
+		return r.tokens[i].hash < r.tokens[j].hash
+	})
+	sort.Ints(r.cellIDs)
+
+	return r, nil
+}
+
+// Locate returns the cell that owns the given key
+func (r *Ring) Locate(key string) int {
+	return r.tokens[r.search(hashKey(key))].cellID
+}
+
+// Successors returns up to n distinct cells in ring order starting at the
+// key's owner. The first entry is always the primary cell; the rest are the
+// failover candidates for that key.
+func (r *Ring) Successors(key string, n int) []int {
+	if n > len(r.cellIDs) {
+		n = len(r.cellIDs)
+	}
+
+	result := make([]int, 0, n)
+	seen := make(map[int]bool, n)
+	start := r.search(hashKey(key))
+
+	for i := 0; i < len(r.tokens) && len(result) < n; i++ {
+		t := r.tokens[(start+i)%len(r.tokens)]
+		if !seen[t.cellID] {
+			seen[t.cellID] = true
+			result = append(result, t.cellID)
+		}
+	}
+
+	return result
+}
+
+// Cell returns a cell definition by ID
+func (r *Ring) Cell(cellID int) (Cell, bool) {
+	cell, ok := r.cells[cellID]
+	return cell, ok
+}
+
+// CellIDs returns all cell IDs in the topology, including drained ones
+func (r *Ring) CellIDs() []int {
+	return append([]int(nil), r.cellIDs...)
+}
+
+// Topology returns the topology the ring was built from
+func (r *Ring) Topology() *Topology {
+	return r.topology
+}
+
+// search returns the index of the first token at or after hash, wrapping
+// around to the start of the ring
+func (r *Ring) search(hash uint64) int {
+	idx := sort.Search(len(r.tokens), func(i int) bool {
+		return r.tokens[i].hash >= hash
+	})
+	if idx == len(r.tokens) {
+		idx = 0
+	}
+	return idx
+}
+
+// hashKey hashes a key onto the 64-bit ring space
+func hashKey(key string) uint64 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
@@ -0,0 +1,92 @@
+package ring
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestRing_LocateIsStable(t *testing.T) {
+	r, err := New(DefaultTopology(10))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		if a, b := r.Locate(key), r.Locate(key); a != b {
+			t.Fatalf("Locate(%q) not stable: %d != %d", key, a, b)
+		}
+	}
+}
+
+func TestRing_SuccessorsAreDistinct(t *testing.T) {
+	r, _ := New(DefaultTopology(5))
+
+	got := r.Successors("user-123", 3)
+	if len(got) != 3 {
+		t.Fatalf("Successors() returned %d cells, want 3", len(got))
+	}
+	if got[0] != r.Locate("user-123") {
+		t.Errorf("first successor %d is not the primary cell %d", got[0], r.Locate("user-123"))
+	}
+	seen := map[int]bool{}
+	for _, id := range got {
+		if seen[id] {
+			t.Errorf("duplicate cell %d in successors %v", id, got)
+		}
+		seen[id] = true
+	}
+}
+
+func TestPreview_AddingCellMovesOnlyItsShare(t *testing.T) {
+	current, _ := New(DefaultTopology(10))
+	next, _ := New(DefaultTopology(11))
+
+	preview := Preview(current, next, 1000000)
+
+	// The new cell should take roughly 1/11 of the keyspace, all of it
+	// moving into cell 11
+	if math.Abs(preview.MovedFraction-1.0/11) > 0.03 {
+		t.Errorf("MovedFraction = %f, want about %f", preview.MovedFraction, 1.0/11)
+	}
+	for _, m := range preview.Movements {
+		if m.ToCell != 11 {
+			t.Errorf("unexpected movement %d -> %d", m.FromCell, m.ToCell)
+		}
+	}
+}
+
+func TestPreview_WeightedCellOwnsMore(t *testing.T) {
+	topo := DefaultTopology(4)
+	topo.Cells[0].Weight = 3
+	weighted, _ := New(topo)
+	equal, _ := New(DefaultTopology(4))
+
+	preview := Preview(equal, weighted, 0)
+
+	for _, share := range preview.Shares {
+		if share.CellID == 1 && math.Abs(share.After-0.5) > 0.05 {
+			t.Errorf("cell 1 share = %f, want about 0.5", share.After)
+		}
+	}
+}
+
+func TestPreview_DrainedCellMovesEverything(t *testing.T) {
+	current, _ := New(DefaultTopology(4))
+	topo := DefaultTopology(4)
+	topo.Cells[1].Drained = true
+	next, _ := New(topo)
+
+	preview := Preview(current, next, 0)
+	for _, share := range preview.Shares {
+		if share.CellID == 2 && share.After != 0 {
+			t.Errorf("drained cell still owns %f of the keyspace", share.After)
+		}
+	}
+	for _, m := range preview.Movements {
+		if m.FromCell != 2 {
+			t.Errorf("unexpected movement %d -> %d", m.FromCell, m.ToCell)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package ring
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Cell is a single cell entry in the topology
+type Cell struct {
+	ID      int  `json:"id"`
+	Weight  int  `json:"weight"`
+	Drained bool `json:"drained,omitempty"`
+}
+
+// Topology describes the set of cells the router distributes users across
+type Topology struct {
+	VirtualNodes int    `json:"virtual_nodes"`
+	Cells        []Cell `json:"cells"`
+}
+
+// DefaultTopology returns n equally weighted cells
+func DefaultTopology(n int) *Topology {
+	topo := &Topology{VirtualNodes: DefaultVirtualNodes}
+	for i := 1; i <= n; i++ {
+		topo.Cells = append(topo.Cells, Cell{
+			ID:     i,
+			Weight: 1,
+		})
+	}
+	topo.applyDefaults()
+	return topo
+}
+
+// LoadTopology reads a topology from a JSON file
+func LoadTopology(path string) (*Topology, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read topology file: %w", err)
+	}
+	return ParseTopology(data)
+}
+
+// ParseTopology decodes and validates a JSON topology
+func ParseTopology(data []byte) (*Topology, error) {
+	var topo Topology
+	if err := json.Unmarshal(data, &topo); err != nil {
+		return nil, fmt.Errorf("failed to parse topology: %w", err)
+	}
+	topo.applyDefaults()
+	if err := topo.Validate(); err != nil {
+		return nil, err
+	}
+	return &topo, nil
+}
+
+// Validate checks the topology for duplicate or malformed cells
+func (t *Topology) Validate() error {
+	if len(t.Cells) == 0 {
+		return fmt.Errorf("topology must contain at least one cell")
+	}
+
+	seen := make(map[int]bool, len(t.Cells))
+	for _, cell := range t.Cells {
+		if cell.ID <= 0 {
+			return fmt.Errorf("cell ID must be positive, got %d", cell.ID)
+		}
+		if cell.Weight <= 0 {
+			return fmt.Errorf("cell %d must have a positive weight", cell.ID)
+		}
+		if seen[cell.ID] {
+			return fmt.Errorf("cell %d is defined more than once", cell.ID)
+		}
+		seen[cell.ID] = true
+	}
+	return nil
+}
+
+func (t *Topology) applyDefaults() {
+	if t.VirtualNodes <= 0 {
+		t.VirtualNodes = DefaultVirtualNodes
+	}
+	for i := range t.Cells {
+		if t.Cells[i].Weight == 0 {
+			t.Cells[i].Weight = 1
+		}
+	}
+}
@@ -1,86 +1,215 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/binary"
+	"context"
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/titan-commerce/backend/cell-router/internal/discovery"
+	"github.com/titan-commerce/backend/cell-router/internal/migration"
+	"github.com/titan-commerce/backend/cell-router/internal/override"
+	"github.com/titan-commerce/backend/cell-router/internal/ring"
+	auth "github.com/titan-commerce/backend/pkg/auth"
 	"github.com/titan-commerce/backend/pkg/config"
 	"github.com/titan-commerce/backend/pkg/logger"
 )
 
 const (
-	TotalCells      = 500
-	HealthCheckFreq = 5 * time.Second
+	DefaultTotalCells  = 500
+	HealthCheckFreq    = 5 * time.Second
+	HealthCheckTimeout = 2 * time.Second
+	UnhealthyThreshold = 3
+	MaxFailoverCells   = 3
+
+	OverrideRefreshFreq  = 5 * time.Second
+	MigrationHookTimeout = 2 * time.Minute
+
+	ReplicaCooldown   = 10 * time.Second
+	RegistryLeaseTTL  = 30 * time.Second
+	DiscoveryPollFreq = 15 * time.Second
+	DiscoveryTimeout  = 30 * time.Second // For the first snapshot at startup
 )
 
 // CellHealth tracks health status of cells
 type CellHealth struct {
-	CellID      int
-	Status      string // "healthy", "degraded", "unhealthy"
-	Endpoint    string
-	LastCheck   time.Time
+	CellID       int
+	Status       string // "healthy", "degraded", "unhealthy"
+	LastCheck    time.Time
 	FailureCount int
 }
 
 // CellRouter routes users to cells using consistent hashing
 type CellRouter struct {
-	cells  map[int]*CellHealth
-	mu     sync.RWMutex
-	logger *logger.Logger
+	cells     map[int]*CellHealth
+	ring      *ring.Ring
+	overrides *override.Table
+	directory *discovery.Directory
+	mu        sync.RWMutex
+	logger    *logger.Logger
 }
 
-// NewCellRouter creates a new cell router
-func NewCellRouter(log *logger.Logger) *CellRouter {
+// NewCellRouter creates a new cell router for the given topology. Overrides
+// pin individual users to a cell ahead of the hash ring; the directory holds
+// the discovered service endpoints of every cell.
+func NewCellRouter(log *logger.Logger, topo *ring.Topology, overrides *override.Table, directory *discovery.Directory) (*CellRouter, error) {
 	router := &CellRouter{
-		cells:  make(map[int]*CellHealth),
-		logger: log,
+		cells:     make(map[int]*CellHealth),
+		overrides: overrides,
+		directory: directory,
+		logger:    log,
+	}
+
+	if err := router.SetTopology(topo); err != nil {
+		return nil, err
 	}
 
-	// Initialize cells
-	for i := 1; i <= TotalCells; i++ {
-		router.cells[i] = &CellHealth{
-			CellID:   i,
-			Status:   "healthy",
-			Endpoint: fmt.Sprintf("cell-%03d.svc.cluster.local:9000", i),
+	return router, nil
+}
+
+// SetTopology rebuilds the hash ring and the cell table. Health state is
+// kept for cells that exist in both the old and the new topology.
+func (r *CellRouter) SetTopology(topo *ring.Topology) error {
+	newRing, err := ring.New(topo)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cells := make(map[int]*CellHealth, len(topo.Cells))
+	for _, c := range topo.Cells {
+		health, ok := r.cells[c.ID]
+		if !ok {
+			health = &CellHealth{CellID: c.ID, Status: "healthy"}
 		}
+		cells[c.ID] = health
 	}
 
-	return router
+	r.cells = cells
+	r.ring = newRing
+	return nil
+}
+
+// Ring returns the current hash ring
+func (r *CellRouter) Ring() *ring.Ring {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.ring
 }
 
-// RouteToCellID calculates the cell ID for a given user ID using consistent hashing
+// RouteToCellID returns the cell for a user: their pinned cell if they have
+// an override, otherwise the owner on the consistent-hash ring
 func (r *CellRouter) RouteToCellID(userID string) int {
-	hash := sha256.Sum256([]byte(userID))
-	hashInt := binary.BigEndian.Uint64(hash[:8])
-	cellID := int(hashInt%uint64(TotalCells)) + 1
-	return cellID
+	if o, ok := r.overrides.Lookup(userID); ok {
+		return o.CellID
+	}
+	return r.Ring().Locate(userID)
+}
+
+// IsFrozen reports whether the user's writes are blocked by a migration
+func (r *CellRouter) IsFrozen(userID string) bool {
+	return r.overrides.IsFrozen(userID)
 }
 
-// GetCellEndpoint returns the endpoint for a cell
-func (r *CellRouter) GetCellEndpoint(cellID int) (string, error) {
+// HasCell reports whether a cell is part of the topology
+func (r *CellRouter) HasCell(cellID int) bool {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
+	_, ok := r.cells[cellID]
+	return ok
+}
 
-	cell, exists := r.cells[cellID]
-	if !exists {
+// ServiceEndpoint picks a replica of a service in a cell, balancing
+// round-robin across the replicas the directory knows about
+func (r *CellRouter) ServiceEndpoint(cellID int, service string) (string, error) {
+	if !r.HasCell(cellID) {
 		return "", fmt.Errorf("cell %d does not exist", cellID)
 	}
+	return r.directory.Pick(cellID, service)
+}
+
+// ResolveCell returns the cell serving a user. The primary cell is the
+// user's pinned cell or their ring owner; if it is unhealthy, the next healthy
+// cell on the ring is used.
+func (r *CellRouter) ResolveCell(userID string) (int, error) {
+	cells, err := r.failoverOrder(userID)
+	if err != nil {
+		return 0, err
+	}
+	return cells[0], nil
+}
+
+// ResolveEndpoint picks the cell and replica of a service that serve a user.
+// It walks the same cells as ResolveCell and moves on to the next one while
+// a cell has no replica out of cooldown, rather than failing the request.
+func (r *CellRouter) ResolveEndpoint(userID, service string) (int, string, error) {
+	cells, err := r.failoverOrder(userID)
+	if err != nil {
+		return 0, "", err
+	}
 
-	// If cell is unhealthy, failover to next cell
-	if cell.Status == "unhealthy" {
-		nextCellID := (cellID % TotalCells) + 1
-		r.logger.Warnf("Cell %d unhealthy, failing over to cell %d", cellID, nextCellID)
-		if nextCell, ok := r.cells[nextCellID]; ok && nextCell.Status == "healthy" {
-			return nextCell.Endpoint, nil
+	var lastErr error
+	for _, cellID := range cells {
+		endpoint, err := r.ServiceEndpoint(cellID, service)
+		if err == nil {
+			if cellID != cells[0] {
+				r.logger.Warnf("No live %s replica in cell %d, failing over to cell %d", service, cells[0], cellID)
+			}
+			return cellID, endpoint, nil
 		}
+		lastErr = err
 	}
+	return 0, "", lastErr
+}
+
+// failoverOrder lists the cells that may serve a user, best first: the
+// pinned cell or ring owner, then the healthy ring successors. If every
+// candidate is unhealthy the user is kept on their home cell.
+func (r *CellRouter) failoverOrder(userID string) ([]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-	return cell.Endpoint, nil
+	candidates := r.ring.Successors(userID, MaxFailoverCells)
+	if o, ok := r.overrides.Lookup(userID); ok {
+		candidates = append([]int{o.CellID}, candidates...)
+	}
+	primary := candidates[0]
+
+	var healthy []int
+	for _, cellID := range candidates {
+		cell, ok := r.cells[cellID]
+		if !ok || cell.Status == "unhealthy" {
+			continue
+		}
+		if len(healthy) == 0 && cellID != primary {
+			r.logger.Warnf("Cell %d unhealthy, failing over to cell %d", primary, cellID)
+		}
+		healthy = append(healthy, cellID)
+	}
+	if len(healthy) > 0 {
+		return healthy, nil
+	}
+
+	// Every candidate is down; keep the user on their home cell
+	if _, ok := r.cells[primary]; !ok {
+		return nil, fmt.Errorf("cell %d does not exist", primary)
+	}
+	return []int{primary}, nil
 }
 
 // HealthCheck performs health checks on all cells
@@ -90,20 +219,42 @@ func (r *CellRouter) HealthCheck() {
 
 	for range ticker.C {
 		r.logger.Debug("Running health checks on all cells...")
-		
+
+		r.mu.RLock()
 		for cellID := range r.cells {
 			go r.checkCellHealth(cellID)
 		}
+		r.mu.RUnlock()
 	}
 }
 
+// checkCellHealth probes every discovered replica in the cell. Unreachable
+// replicas are taken out of rotation; the cell only counts as failing when
+// none of its replicas answer.
 func (r *CellRouter) checkCellHealth(cellID int) {
-	r.mu.Lock()
-	cell := r.cells[cellID]
-	r.mu.Unlock()
+	r.mu.RLock()
+	cell, ok := r.cells[cellID]
+	r.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	reachable := 0
+	for _, addr := range r.directory.Replicas(cellID) {
+		conn, err := net.DialTimeout("tcp", addr, HealthCheckTimeout)
+		if err != nil {
+			r.directory.MarkDown(addr)
+			continue
+		}
+		conn.Close()
+		reachable++
+	}
+
+	if reachable == 0 {
+		r.RecordFailure(cellID)
+		return
+	}
 
-	// Simulate health check (in production, would make actual HTTP/gRPC call)
-	// For now, mark all cells as healthy
 	r.mu.Lock()
 	cell.Status = "healthy"
 	cell.LastCheck = time.Now()
@@ -111,6 +262,30 @@ func (r *CellRouter) checkCellHealth(cellID int) {
 	r.mu.Unlock()
 }
 
+// RecordFailure counts a failed probe or proxied request against a cell.
+// A cell is degraded after its first failure and unhealthy once it reaches
+// UnhealthyThreshold consecutive failures.
+func (r *CellRouter) RecordFailure(cellID int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cell, ok := r.cells[cellID]
+	if !ok {
+		return
+	}
+
+	cell.FailureCount++
+	cell.LastCheck = time.Now()
+	if cell.FailureCount >= UnhealthyThreshold {
+		if cell.Status != "unhealthy" {
+			r.logger.Warnf("Cell %d marked unhealthy after %d failures", cellID, cell.FailureCount)
+		}
+		cell.Status = "unhealthy"
+	} else {
+		cell.Status = "degraded"
+	}
+}
+
 // HTTP handlers
 func (r *CellRouter) handleRoute(w http.ResponseWriter, req *http.Request) {
 	userID := req.URL.Query().Get("user_id")
@@ -119,10 +294,9 @@ func (r *CellRouter) handleRoute(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	cellID := r.RouteToCellID(userID)
-	endpoint, err := r.GetCellEndpoint(cellID)
+	cellID, endpoint, err := r.ResolveEndpoint(userID, discovery.DefaultService)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
 		return
 	}
 
@@ -135,26 +309,149 @@ func (r *CellRouter) handleCells(w http.ResponseWriter, req *http.Request) {
 	defer r.mu.RUnlock()
 
 	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"total_cells":%d,"cells":[`, TotalCells)
-	
+	fmt.Fprintf(w, `{"total_cells":%d,"cells":[`, len(r.cells))
+
 	first := true
 	for _, cell := range r.cells {
 		if !first {
 			fmt.Fprintf(w, ",")
 		}
-		fmt.Fprintf(w, `{"cell_id":%d,"status":"%s","endpoint":"%s"}`, 
-			cell.CellID, cell.Status, cell.Endpoint)
+		services, _ := json.Marshal(r.directory.Services(cell.CellID))
+		fmt.Fprintf(w, `{"cell_id":%d,"status":"%s","services":%s}`,
+			cell.CellID, cell.Status, services)
 		first = false
 	}
-	
+
 	fmt.Fprintf(w, "]}")
 }
 
+func (r *CellRouter) handleTopology(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, r.Ring().Topology())
+}
+
+// handleTopologyPreview reports how many users a proposed topology would move
+func (r *CellRouter) handleTopologyPreview(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var totalUsers int64
+	if v := req.URL.Query().Get("total_users"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, "total_users must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		totalUsers = n
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	topo, err := ring.ParseTopology(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	next, err := ring.New(topo)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ring.Preview(r.Ring(), next, totalUsers))
+}
+
 func (r *CellRouter) handleHealth(w http.ResponseWriter, req *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	fmt.Fprintf(w, `{"status":"healthy"}`)
 }
 
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// migrationHooks builds the export/import hooks for the comma-separated list
+// of services that keep per-user data in a cell
+func migrationHooks(services string) []migration.Hook {
+	var hooks []migration.Hook
+	for _, svc := range strings.Split(services, ",") {
+		if svc = strings.TrimSpace(svc); svc != "" {
+			hooks = append(hooks, migration.NewHTTPHook(svc, MigrationHookTimeout))
+		}
+	}
+	return hooks
+}
+
+// newDiscoveryProvider selects where cell endpoints come from:
+//
+//	dns (default) - SRV records per service (DISCOVERY_SERVICES, DNS_SRV_TEMPLATE)
+//	static        - JSON file in DISCOVERY_FILE
+//	registry      - services register themselves with this router; the
+//	                registry lives in this process, so it only suits a
+//	                single router replica
+func newDiscoveryProvider(kind string, router *CellRouter, registry *discovery.Registry, log *logger.Logger) (discovery.Provider, error) {
+	switch kind {
+	case "registry":
+		return registry, nil
+	case "static":
+		path := os.Getenv("DISCOVERY_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("DISCOVERY_FILE is required for static discovery")
+		}
+		return discovery.NewStaticProvider(path, DiscoveryPollFreq, log), nil
+	case "", "dns":
+		var services []string
+		for _, svc := range strings.Split(os.Getenv("DISCOVERY_SERVICES"), ",") {
+			if svc = strings.TrimSpace(svc); svc != "" {
+				services = append(services, svc)
+			}
+		}
+		if len(services) == 0 {
+			services = []string{discovery.DefaultService}
+		}
+		cells := func() []int { return router.Ring().CellIDs() }
+		return discovery.NewDNSProvider(os.Getenv("DNS_SRV_TEMPLATE"), services, cells, DiscoveryPollFreq, log), nil
+	default:
+		return nil, fmt.Errorf("unknown discovery provider %q", kind)
+	}
+}
+
+// loadTopology reads the topology file if one is configured, otherwise it
+// falls back to the default equally weighted cell set
+func loadTopology(path string) (*ring.Topology, error) {
+	if path == "" {
+		return ring.DefaultTopology(DefaultTotalCells), nil
+	}
+	return ring.LoadTopology(path)
+}
+
+// watchTopology reloads the topology file on SIGHUP
+func watchTopology(router *CellRouter, path string, log *logger.Logger) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	for range sighup {
+		topo, err := loadTopology(path)
+		if err != nil {
+			log.Error(err, "Failed to reload topology, keeping current one")
+			continue
+		}
+		if err := router.SetTopology(topo); err != nil {
+			log.Error(err, "Rejected new topology, keeping current one")
+			continue
+		}
+		log.Infof("Topology reloaded: %d cells", len(topo.Cells))
+	}
+}
+
 func main() {
 	cfg, err := config.Load()
 	if err != nil {
@@ -170,30 +467,138 @@ func main() {
 	})
 
 	log.Info("Starting Cell Router...")
-	log.Infof("Managing %d cells", TotalCells)
 
-	router := NewCellRouter(log)
+	topologyFile := os.Getenv("CELL_TOPOLOGY_FILE")
+	topo, err := loadTopology(topologyFile)
+	if err != nil {
+		log.Fatal(err, "Failed to load cell topology")
+	}
+	log.Infof("Managing %d cells (%d virtual nodes per weight unit)", len(topo.Cells), topo.VirtualNodes)
+
+	// Overrides and migrations are persisted when a database is configured
+	var overrideStore override.Store = override.NewMemoryStore()
+	var migrationRepo migration.Repository = migration.NewMemoryRepository()
+	if cfg.DatabaseURL != "" {
+		db, err := sql.Open("postgres", cfg.DatabaseURL)
+		if err != nil {
+			log.Fatal(err, "Failed to connect to database")
+		}
+		overrideStore = override.NewPostgresStore(db)
+		migrationRepo = migration.NewPostgresRepository(db)
+	} else {
+		log.Warn("DATABASE_URL not set, cell overrides will not survive a restart")
+	}
+
+	ctx := context.Background()
+	overrides, err := override.NewTable(ctx, overrideStore, log)
+	if err != nil {
+		log.Fatal(err, "Failed to load cell overrides")
+	}
+	log.Infof("Loaded %d cell overrides", len(overrides.List()))
+
+	directory := discovery.NewDirectory(ReplicaCooldown, log)
+	router, err := NewCellRouter(log, topo, overrides, directory)
+	if err != nil {
+		log.Fatal(err, "Failed to build hash ring")
+	}
+
+	registry := discovery.NewRegistry(RegistryLeaseTTL)
+	provider, err := newDiscoveryProvider(os.Getenv("DISCOVERY_PROVIDER"), router, registry, log)
+	if err != nil {
+		log.Fatal(err, "Invalid discovery configuration")
+	}
+	if err := directory.Run(ctx, provider, DiscoveryTimeout); err != nil {
+		log.Fatal(err, "Failed to discover cell endpoints")
+	}
+	log.Infof("Cell endpoints discovered via %s provider", provider.Name())
+
+	hooks := migrationHooks(os.Getenv("MIGRATION_SERVICES"))
+	if len(hooks) == 0 {
+		log.Warn("MIGRATION_SERVICES not set, user migrations are disabled")
+	}
+	migrator := migration.NewMigrator(migrationRepo, overrides, router, hooks, OverrideRefreshFreq+time.Second, log)
+	if err := migrator.Recover(ctx); err != nil {
+		log.Error(err, "Failed to recover interrupted migrations")
+	}
+	go migrator.Watch(ctx, migration.HeartbeatInterval)
 
 	// Start health checks in background
 	go router.HealthCheck()
-
-	// HTTP server
-	http.HandleFunc("/route", router.handleRoute)
-	http.HandleFunc("/cells", router.handleCells)
-	http.HandleFunc("/health", router.handleHealth)
+	go overrides.Watch(ctx, OverrideRefreshFreq)
+	go registry.ExpireLoop(ctx, RegistryLeaseTTL/3)
+	go watchTopology(router, topologyFile, log)
+
+	// Lookup API: read-only routing answers for clients that route themselves
+	lookup := http.NewServeMux()
+	lookup.HandleFunc("/route", router.handleRoute)
+	lookup.HandleFunc("/cells", router.handleCells)
+	lookup.HandleFunc("/health", router.handleHealth)
+	lookup.HandleFunc("/topology", router.handleTopology)
+
+	// Admin API: everything that changes routing. It is only ever served on
+	// ADMIN_HTTP_PORT, which must not be exposed outside the cluster.
+	admin := http.NewServeMux()
+	admin.Handle("/", lookup)
+	admin.HandleFunc("/topology/preview", router.handleTopologyPreview)
+	NewAdminAPI(router, migrator, registry).Register(admin)
 
 	port := cfg.HTTPPort
 	if port == 0 {
 		port = 8080
 	}
+	adminPort, err := strconv.Atoi(os.Getenv("ADMIN_HTTP_PORT"))
+	if err != nil || adminPort == 0 {
+		adminPort = 8081
+	}
+	if adminPort == port {
+		log.Fatal(fmt.Errorf("ADMIN_HTTP_PORT %d is the public port", adminPort), "Invalid admin port")
+	}
+
+	go func() {
+		log.Infof("Cell Router admin API listening on :%d", adminPort)
+		log.Info("Endpoints:")
+		log.Info("  POST /topology/preview         - Preview users moved by a topology change")
+		log.Info("  GET|PUT|DELETE /overrides      - Manage cell pinning overrides")
+		log.Info("  POST /migrations               - Move a user to another cell")
+		log.Info("  GET /migrations/{id}           - Migration progress")
+		log.Info("  PUT /registry/instances        - Register or renew a service replica")
+		if err := http.ListenAndServe(fmt.Sprintf(":%d", adminPort), admin); err != nil {
+			log.Fatal(err, "Failed to start admin server")
+		}
+	}()
+
+	// Proxy mode is the default: clients only ever see the data plane. Lookup
+	// mode hands out internal cell endpoints, so it must be asked for.
+	switch mode := os.Getenv("ROUTER_MODE"); mode {
+	case "", "proxy":
+	case "lookup":
+		log.Warn("ROUTER_MODE=lookup, cell endpoints are served to clients on the public port")
+		log.Infof("Cell Router lookup API listening on :%d", port)
+		log.Info("Endpoints:")
+		log.Info("  GET /route?user_id=<user-id>  - Route user to cell")
+		log.Info("  GET /cells                     - List all cells")
+		log.Info("  GET /health                    - Health check")
+		log.Info("  GET /topology                  - Current cell topology")
+		if err := http.ListenAndServe(fmt.Sprintf(":%d", port), lookup); err != nil {
+			log.Fatal(err, "Failed to start server")
+		}
+		return
+	default:
+		log.Fatal(fmt.Errorf("unknown ROUTER_MODE %q", mode), "Invalid router mode")
+	}
 
-	log.Infof("Cell Router listening on :%d", port)
-	log.Info("Endpoints:")
-	log.Info("  GET /route?user_id=<user-id>  - Route user to cell")
-	log.Info("  GET /cells                     - List all cells")
-	log.Info("  GET /health                    - Health check")
+	jwtService := auth.NewJWTService(cfg.JWTSecret, cfg.JWTAccessExpiry, 7)
+	proxy := NewCellProxy(router, jwtService, log)
+
+	// h2c lets gRPC clients speak cleartext HTTP/2 to the router
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           h2c.NewHandler(proxy, &http2.Server{}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
 
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil); err != nil {
-		log.Fatal(err, "Failed to start server")
+	log.Infof("Cell Router proxy listening on :%d (HTTP/1.1, WebSocket, gRPC)", port)
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatal(err, "Failed to start proxy server")
 	}
 }
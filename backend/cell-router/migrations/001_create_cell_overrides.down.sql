@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS cell_migrations;
+DROP TABLE IF EXISTS cell_overrides;
@@ -0,0 +1,28 @@
+-- Cell Router Database Migration
+
+CREATE TABLE IF NOT EXISTS cell_overrides (
+    user_id VARCHAR(64) PRIMARY KEY,
+    cell_id INTEGER NOT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    frozen BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by VARCHAR(64) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_cell_overrides_cell_id ON cell_overrides(cell_id);
+
+CREATE TABLE IF NOT EXISTS cell_migrations (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(64) NOT NULL,
+    source_cell INTEGER NOT NULL,
+    target_cell INTEGER NOT NULL,
+    state VARCHAR(20) NOT NULL,
+    steps JSONB NOT NULL DEFAULT '[]',
+    previous_override JSONB,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_cell_migrations_user_id ON cell_migrations(user_id);
+CREATE INDEX idx_cell_migrations_state ON cell_migrations(state);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_cell_migrations_active_user;
@@ -0,0 +1,5 @@
+-- At most one migration in flight per user
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cell_migrations_active_user
+    ON cell_migrations(user_id)
+    WHERE state NOT IN ('COMPLETED', 'FAILED');
@@ -0,0 +1,2 @@
+ALTER TABLE cell_migrations DROP COLUMN IF EXISTS heartbeat_at;
+ALTER TABLE cell_migrations DROP COLUMN IF EXISTS owner;
@@ -0,0 +1,4 @@
+-- The router replica running each migration, and when it last checked in
+
+ALTER TABLE cell_migrations ADD COLUMN IF NOT EXISTS owner VARCHAR(128) NOT NULL DEFAULT '';
+ALTER TABLE cell_migrations ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMP NOT NULL DEFAULT NOW();
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/titan-commerce/backend/cell-router/internal/discovery"
+	auth "github.com/titan-commerce/backend/pkg/auth"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+const (
+	ProxyDialTimeout      = 2 * time.Second
+	ProxyIdleConnTimeout  = 90 * time.Second
+	ProxyMaxIdlePerHost   = 64
+	ProxyResponseTimeout  = 30 * time.Second
+	HeaderUserID          = "X-User-ID"
+	HeaderCellID          = "X-Cell-ID"
+	HeaderRoutedBy        = "X-Routed-By"
+	grpcStatusUnavailable = "14"
+	grpcStatusUnauthed    = "16"
+)
+
+type proxyContextKey struct{}
+
+// proxyTarget is the resolved upstream for a single request
+type proxyTarget struct {
+	cellID   int
+	endpoint string
+}
+
+// CellProxy is the data-plane reverse proxy. It authenticates the caller,
+// hashes the user onto a cell and forwards HTTP/1.1, WebSocket upgrades and
+// gRPC (HTTP/2 cleartext) to that cell, so internal endpoints never reach
+// clients.
+type CellProxy struct {
+	router    *CellRouter
+	jwt       *auth.JWTService
+	httpProxy *httputil.ReverseProxy
+	grpcProxy *httputil.ReverseProxy
+	logger    *logger.Logger
+}
+
+// NewCellProxy creates a proxy with pooled upstream connections
+func NewCellProxy(router *CellRouter, jwt *auth.JWTService, log *logger.Logger) *CellProxy {
+	dialer := &net.Dialer{Timeout: ProxyDialTimeout, KeepAlive: 30 * time.Second}
+
+	// HTTP/1.1 pool, also used for WebSocket upgrades
+	httpTransport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          ProxyMaxIdlePerHost * 16,
+		MaxIdleConnsPerHost:   ProxyMaxIdlePerHost,
+		IdleConnTimeout:       ProxyIdleConnTimeout,
+		ResponseHeaderTimeout: ProxyResponseTimeout,
+		ForceAttemptHTTP2:     false,
+	}
+
+	// gRPC needs HTTP/2 end to end; cells speak h2c inside the cluster and a
+	// single multiplexed connection per cell is reused across requests
+	grpcTransport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+		ReadIdleTimeout: 30 * time.Second,
+		PingTimeout:     5 * time.Second,
+	}
+
+	p := &CellProxy{
+		router: router,
+		jwt:    jwt,
+		logger: log,
+	}
+
+	p.httpProxy = &httputil.ReverseProxy{
+		Rewrite:      p.rewrite,
+		Transport:    httpTransport,
+		ErrorHandler: p.handleUpstreamError,
+	}
+	p.grpcProxy = &httputil.ReverseProxy{
+		Rewrite:       p.rewrite,
+		Transport:     grpcTransport,
+		ErrorHandler:  p.handleUpstreamError,
+		FlushInterval: -1, // stream responses immediately
+	}
+
+	return p
+}
+
+// ServeHTTP routes the request to the caller's cell
+func (p *CellProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	userID, err := p.authenticate(req)
+	if err != nil {
+		p.writeError(w, req, http.StatusUnauthorized, grpcStatusUnauthed, "unauthenticated")
+		return
+	}
+
+	// Writes are blocked while the user's data is being moved between cells.
+	// gRPC methods are all POST, so every gRPC call counts as a write.
+	if p.router.IsFrozen(userID) && isWrite(req) {
+		w.Header().Set("Retry-After", "5")
+		p.writeError(w, req, http.StatusServiceUnavailable, grpcStatusUnavailable, "account is being migrated, retry shortly")
+		return
+	}
+
+	cellID, endpoint, err := p.router.ResolveEndpoint(userID, serviceForRequest(req))
+	if err != nil {
+		p.logger.Error(err, "Failed to resolve service endpoint")
+		p.writeError(w, req, http.StatusServiceUnavailable, grpcStatusUnavailable, "no cell available")
+		return
+	}
+
+	// Never trust identity headers supplied by the client
+	req.Header.Del(HeaderUserID)
+	req.Header.Del(HeaderCellID)
+	req.Header.Set(HeaderUserID, userID)
+	req.Header.Set(HeaderCellID, fmt.Sprintf("%d", cellID))
+
+	ctx := context.WithValue(req.Context(), proxyContextKey{}, proxyTarget{cellID: cellID, endpoint: endpoint})
+	req = req.WithContext(ctx)
+
+	if isGRPC(req) {
+		p.grpcProxy.ServeHTTP(w, req)
+		return
+	}
+	p.httpProxy.ServeHTTP(w, req)
+}
+
+func (p *CellProxy) rewrite(pr *httputil.ProxyRequest) {
+	target := pr.In.Context().Value(proxyContextKey{}).(proxyTarget)
+	pr.Out.URL.Scheme = "http"
+	pr.Out.URL.Host = target.endpoint
+	pr.Out.Host = target.endpoint
+	if pr.Out.URL.Query().Has("access_token") {
+		q := pr.Out.URL.Query()
+		q.Del("access_token")
+		pr.Out.URL.RawQuery = q.Encode()
+	}
+	pr.SetXForwarded()
+	pr.Out.Header.Set(HeaderRoutedBy, "cell-router")
+}
+
+// handleUpstreamError takes the failing replica out of rotation so the next
+// requests go to its siblings, counts the failure against its cell, and
+// reports it in the protocol the client speaks
+func (p *CellProxy) handleUpstreamError(w http.ResponseWriter, req *http.Request, err error) {
+	target, _ := req.Context().Value(proxyContextKey{}).(proxyTarget)
+
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	p.logger.Errorf(err, "Proxy to cell %d (%s) failed", target.cellID, target.endpoint)
+	p.router.directory.MarkDown(target.endpoint)
+	p.router.RecordFailure(target.cellID)
+	p.writeError(w, req, http.StatusBadGateway, grpcStatusUnavailable, "cell unavailable")
+}
+
+// authenticate extracts the user ID from the bearer token. Browsers cannot
+// set headers on WebSocket handshakes, so the token may also be passed as
+// the access_token query parameter for upgrade requests.
+func (p *CellProxy) authenticate(req *http.Request) (string, error) {
+	token := ""
+	if h := req.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		token = strings.TrimPrefix(h, "Bearer ")
+	} else if isUpgrade(req) {
+		token = req.URL.Query().Get("access_token")
+	}
+	if token == "" {
+		return "", fmt.Errorf("missing bearer token")
+	}
+
+	claims, err := p.jwt.VerifyAccessToken(token)
+	if err != nil {
+		return "", err
+	}
+	if claims.UserID == "" {
+		return "", fmt.Errorf("token has no user ID")
+	}
+	return claims.UserID, nil
+}
+
+func (p *CellProxy) writeError(w http.ResponseWriter, req *http.Request, httpStatus int, grpcStatus, msg string) {
+	if isGRPC(req) {
+		// gRPC clients read the status from headers/trailers, not the HTTP code
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Grpc-Status", grpcStatus)
+		w.Header().Set("Grpc-Message", msg)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Error(w, msg, httpStatus)
+}
+
+// serviceForRequest names the cell service a request is for. gRPC methods
+// map by proto package ("/order.v1.OrderService/CreateOrder" goes to
+// order-service); everything else goes to the cell's gateway.
+func serviceForRequest(req *http.Request) string {
+	if isGRPC(req) {
+		method := strings.TrimPrefix(req.URL.Path, "/")
+		if pkg, _, ok := strings.Cut(method, "."); ok && pkg != "" {
+			return pkg + "-service"
+		}
+	}
+	return discovery.DefaultService
+}
+
+func isGRPC(req *http.Request) bool {
+	return req.ProtoMajor == 2 && strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc")
+}
+
+func isWrite(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return isUpgrade(req)
+	default:
+		return true
+	}
+}
+
+func isUpgrade(req *http.Request) bool {
+	return strings.EqualFold(req.Header.Get("Upgrade"), "websocket")
+}
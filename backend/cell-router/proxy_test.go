@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/titan-commerce/backend/cell-router/internal/discovery"
+	"github.com/titan-commerce/backend/cell-router/internal/override"
+	"github.com/titan-commerce/backend/cell-router/internal/ring"
+	auth "github.com/titan-commerce/backend/pkg/auth"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+func newTestProxy(t *testing.T, upstream *httptest.Server) (*CellProxy, *auth.JWTService) {
+	t.Helper()
+
+	endpoint := strings.TrimPrefix(upstream.URL, "http://")
+	topo := &ring.Topology{Cells: []ring.Cell{{ID: 1, Weight: 1}}}
+
+	log := logger.New(logger.Config{Level: "error", ServiceName: "test"})
+	overrides, _ := override.NewTable(context.Background(), override.NewMemoryStore(), log)
+	directory := discovery.NewDirectory(time.Second, log)
+	directory.Apply(discovery.Snapshot{{CellID: 1, Service: discovery.DefaultService, Address: endpoint}})
+
+	router, err := NewCellRouter(log, topo, overrides, directory)
+	if err != nil {
+		t.Fatalf("NewCellRouter() error = %v", err)
+	}
+
+	jwt := auth.NewJWTService("test-secret", 15, 7)
+	return NewCellProxy(router, jwt, log), jwt
+}
+
+func TestCellProxy_ForwardsAuthenticatedUser(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get(HeaderUserID)+"@"+r.Header.Get(HeaderCellID))
+	}))
+	defer upstream.Close()
+
+	proxy, jwt := newTestProxy(t, upstream)
+	token, _ := jwt.GenerateAccessToken("user-123", "u@example.com", "", nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/orders", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(HeaderUserID, "spoofed")
+	rec := httptest.NewRecorder()
+
+	proxy.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if got := rec.Body.String(); got != "user-123@1" {
+		t.Errorf("upstream saw %q, want %q", got, "user-123@1")
+	}
+}
+
+func TestCellProxy_RejectsMissingToken(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("upstream should not be called")
+	}))
+	defer upstream.Close()
+
+	proxy, _ := newTestProxy(t, upstream)
+	rec := httptest.NewRecorder()
+
+	proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/orders", nil))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", rec.Code)
+	}
+}
+
+func TestCellProxy_FailsOverWhenCellHasNoLiveReplica(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get(HeaderCellID))
+	}))
+	defer upstream.Close()
+	live := strings.TrimPrefix(upstream.URL, "http://")
+
+	topo := &ring.Topology{Cells: []ring.Cell{{ID: 1, Weight: 1}, {ID: 2, Weight: 1}}}
+	log := logger.New(logger.Config{Level: "error", ServiceName: "test"})
+	overrides, _ := override.NewTable(context.Background(), override.NewMemoryStore(), log)
+	directory := discovery.NewDirectory(time.Minute, log)
+	router, err := NewCellRouter(log, topo, overrides, directory)
+	if err != nil {
+		t.Fatalf("NewCellRouter() error = %v", err)
+	}
+
+	home := router.Ring().Locate("user-123")
+	other := 3 - home
+	directory.Apply(discovery.Snapshot{
+		{CellID: home, Service: discovery.DefaultService, Address: "127.0.0.1:1"},
+		{CellID: other, Service: discovery.DefaultService, Address: live},
+	})
+
+	jwt := auth.NewJWTService("test-secret", 15, 7)
+	proxy := NewCellProxy(router, jwt, log)
+	token, _ := jwt.GenerateAccessToken("user-123", "u@example.com", "", nil)
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/orders", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The home replica refuses the connection and is taken out of rotation
+	if rec := send(); rec.Code != http.StatusBadGateway {
+		t.Fatalf("first request status = %d, want 502", rec.Code)
+	}
+	router.mu.RLock()
+	failures := router.cells[home].FailureCount
+	router.mu.RUnlock()
+	if failures != 1 {
+		t.Errorf("home cell failures = %d, want 1", failures)
+	}
+
+	rec := send()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("second request status = %d, want 200", rec.Code)
+	}
+	if want := fmt.Sprintf("%d", other); rec.Body.String() != want {
+		t.Errorf("served by cell %s, want %s", rec.Body.String(), want)
+	}
+}
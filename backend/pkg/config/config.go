@@ -24,6 +24,8 @@ type Config struct {
 	JWTSecret        string
 	JWTRefreshSecret string
 	JWTAccessExpiry  int
+	RegistryURL      string
+	AdvertiseAddr    string
 }
 
 func Load() (*Config, error) {
@@ -45,6 +47,8 @@ func Load() (*Config, error) {
 		JWTSecret:        getEnv("JWT_SECRET", "changeme-in-production"),
 		JWTRefreshSecret: getEnv("JWT_REFRESH_SECRET", "changeme-refresh-secret"),
 		JWTAccessExpiry:  getEnvInt("JWT_ACCESS_EXPIRY", 15),
+		RegistryURL:      getEnv("CELL_REGISTRY_URL", ""),
+		AdvertiseAddr:    getEnv("ADVERTISE_ADDR", ""),
 	}
 
 	if cfg.ServiceName == "unknown-service" {
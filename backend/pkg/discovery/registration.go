@@ -0,0 +1,115 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// Registration announces a service replica to the cell-router registry
+type Registration struct {
+	InstanceID string `json:"instance_id"`
+	CellID     int    `json:"cell_id"`
+	Service    string `json:"service"`
+	Address    string `json:"address"`
+}
+
+// ParseCellID converts a CELL_ID such as "cell-007" to its number
+func ParseCellID(cellID string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(cellID, "cell-"))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid cell ID %q", cellID)
+	}
+	return n, nil
+}
+
+// Registrar keeps a replica registered with the cell-router until it shuts
+// down. The router drops replicas that miss heartbeats for its lease TTL.
+type Registrar struct {
+	registryURL string
+	reg         Registration
+	interval    time.Duration
+	client      *http.Client
+	logger      *logger.Logger
+}
+
+// NewRegistrar creates a registrar. registryURL is the router's admin base
+// URL, e.g. http://cell-router-admin:8081.
+func NewRegistrar(registryURL string, reg Registration, interval time.Duration, log *logger.Logger) *Registrar {
+	return &Registrar{
+		registryURL: registryURL,
+		reg:         reg,
+		interval:    interval,
+		client:      &http.Client{Timeout: 5 * time.Second},
+		logger:      log,
+	}
+}
+
+// Run registers immediately, heartbeats every interval and deregisters when
+// ctx is cancelled
+func (r *Registrar) Run(ctx context.Context) {
+	if err := r.register(ctx); err != nil {
+		r.logger.Error(err, "Initial registration with cell-router failed, will retry")
+	} else {
+		r.logger.Infof("Registered %s (%s) with cell-router", r.reg.Service, r.reg.Address)
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.deregister()
+			return
+		case <-ticker.C:
+			if err := r.register(ctx); err != nil {
+				r.logger.Error(err, "Registry heartbeat failed")
+			}
+		}
+	}
+}
+
+func (r *Registrar) register(ctx context.Context) error {
+	body, err := json.Marshal(r.reg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, r.registryURL+"/registry/instances", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (r *Registrar) deregister() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, r.registryURL+"/registry/instances/"+r.reg.InstanceID, nil)
+	if err != nil {
+		return
+	}
+	if resp, err := r.client.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
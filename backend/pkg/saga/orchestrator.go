@@ -0,0 +1,226 @@
+package saga
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// Orchestrator runs executions of one workflow. An execution must be run by
+// one caller at a time; the store's version check turns a second concurrent
+// caller's saves into conflicts.
+type Orchestrator struct {
+	def   Definition
+	store Store
+	hooks Hooks
+}
+
+// New creates an orchestrator for a workflow
+func New(def Definition, store Store) (*Orchestrator, error) {
+	if def.Name == "" || len(def.Steps) == 0 {
+		return nil, errors.New(errors.ErrInvalidInput, "saga needs a name and at least one step")
+	}
+	seen := make(map[string]bool)
+	for _, step := range def.Steps {
+		if step.Name == "" || step.Action == nil {
+			return nil, errors.New(errors.ErrInvalidInput, "saga steps need a name and an action")
+		}
+		if seen[step.Name] {
+			return nil, errors.New(errors.ErrInvalidInput, fmt.Sprintf("duplicate saga step %s", step.Name))
+		}
+		seen[step.Name] = true
+	}
+	return &Orchestrator{def: def, store: store}, nil
+}
+
+// SetHooks sets the callbacks run as executions progress
+func (o *Orchestrator) SetHooks(hooks Hooks) {
+	o.hooks = hooks
+}
+
+// Load returns the execution with the given ID, or nil if it never started
+func (o *Orchestrator) Load(ctx context.Context, id string) (*Execution, error) {
+	return o.store.Load(ctx, id)
+}
+
+// Run starts the execution with the given ID, or resumes it, and drives it
+// until it completes or is compensated. It returns early with an error when
+// ctx is cancelled, a save or cancel check fails, a step past the pivot
+// fails or a compensation fails; running it again picks up from there.
+func (o *Orchestrator) Run(ctx context.Context, id string) (*Execution, error) {
+	exec, err := o.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	for !exec.Finished() {
+		if err := ctx.Err(); err != nil {
+			return exec, err
+		}
+		if err := o.advance(ctx, exec); err != nil {
+			return exec, err
+		}
+	}
+
+	if o.hooks.Finished != nil {
+		o.hooks.Finished(exec)
+	}
+	return exec, nil
+}
+
+// advance runs the next step or compensation and saves the outcome
+func (o *Orchestrator) advance(ctx context.Context, exec *Execution) error {
+	switch exec.Status {
+	case StatusRunning:
+		step := o.def.Steps[exec.Cursor]
+		if o.def.Cancelled != nil && !o.pastPivot(exec.Cursor) {
+			cancelled, err := o.def.Cancelled(ctx, exec)
+			if err != nil {
+				return err
+			}
+			if cancelled {
+				exec.Status = StatusCancelling
+				exec.Error = ErrCancelled.Error()
+				return o.save(ctx, exec)
+			}
+		}
+
+		stepErr := o.attempt(ctx, exec, step, PhaseAction, step.Action)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		switch {
+		case stepErr == nil:
+			exec.Cursor++
+			if exec.Cursor == len(o.def.Steps) {
+				exec.Status = StatusCompleted
+			}
+		case o.pastPivot(exec.Cursor):
+			// Too late to undo; keep the failed attempts and try again later
+			if err := o.save(ctx, exec); err != nil {
+				return err
+			}
+			return fmt.Errorf("saga %s step %s failed past its pivot: %w", o.def.Name, step.Name, stepErr)
+		case stderrors.Is(stepErr, ErrCancelled):
+			exec.Status = StatusCancelling
+			exec.FailedStep = step.Name
+			exec.Error = stepErr.Error()
+		default:
+			exec.Status = StatusCompensating
+			exec.FailedStep = step.Name
+			exec.Error = stepErr.Error()
+		}
+		// A failed step is assumed to have had no effect unless it is
+		// partial, in which case it is undone as well
+		if step.Partial && stepErr != nil {
+			exec.Cursor++
+		}
+		return o.save(ctx, exec)
+
+	case StatusCompensating, StatusCancelling:
+		if exec.Cursor == 0 {
+			if exec.Status == StatusCancelling {
+				exec.Status = StatusCancelled
+			} else {
+				exec.Status = StatusCompensated
+			}
+			return o.save(ctx, exec)
+		}
+
+		step := o.def.Steps[exec.Cursor-1]
+		if step.Compensate != nil {
+			stepErr := o.attempt(ctx, exec, step, PhaseCompensation, step.Compensate)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if stepErr != nil {
+				if err := o.save(ctx, exec); err != nil {
+					return err
+				}
+				return fmt.Errorf("saga %s failed to compensate step %s: %w", o.def.Name, step.Name, stepErr)
+			}
+		}
+		exec.Cursor--
+		return o.save(ctx, exec)
+	}
+	return fmt.Errorf("saga %s execution %s has unknown status %s", o.def.Name, exec.ID, exec.Status)
+}
+
+// attempt runs fn under the step's retry policy and timeout, recording every
+// attempt. An attempt cut short because ctx was cancelled is not recorded;
+// one that ran into the step timeout is.
+func (o *Orchestrator) attempt(ctx context.Context, exec *Execution, step Step, phase Phase, fn StepFunc) error {
+	for attempt := 1; ; attempt++ {
+		stepCtx, cancel := ctx, context.CancelFunc(func() {})
+		if step.Timeout > 0 {
+			stepCtx, cancel = context.WithTimeout(ctx, step.Timeout)
+		}
+		started := time.Now()
+		err := fn(stepCtx, exec)
+		cancel()
+		duration := time.Since(started)
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		record := Record{Step: step.Name, Phase: phase, Attempt: attempt, Duration: duration, At: started}
+		if err != nil {
+			record.Error = err.Error()
+		}
+		exec.History = append(exec.History, record)
+		if o.hooks.StepFinished != nil {
+			o.hooks.StepFinished(o.def.Name, step.Name, phase, attempt, duration, err)
+		}
+
+		if err == nil || !step.Retry.retries(attempt, err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(step.Retry.wait(attempt)):
+		}
+	}
+}
+
+// pastPivot reports whether a pivot step is among the first done steps
+func (o *Orchestrator) pastPivot(done int) bool {
+	for _, step := range o.def.Steps[:done] {
+		if step.Pivot {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *Orchestrator) load(ctx context.Context, id string) (*Execution, error) {
+	exec, err := o.store.Load(ctx, id)
+	if err != nil || exec != nil {
+		return exec, err
+	}
+
+	now := time.Now()
+	exec = &Execution{
+		ID:        id,
+		Workflow:  o.def.Name,
+		Status:    StatusRunning,
+		Version:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := o.store.Create(ctx, exec); err != nil {
+		return nil, err
+	}
+	return exec, nil
+}
+
+func (o *Orchestrator) save(ctx context.Context, exec *Execution) error {
+	exec.UpdatedAt = time.Now()
+	return o.store.Update(ctx, exec)
+}
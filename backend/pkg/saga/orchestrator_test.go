@@ -0,0 +1,229 @@
+package saga_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/titan-commerce/backend/pkg/saga"
+)
+
+// journal records the steps a test workflow ran
+type journal struct {
+	calls []string
+}
+
+func (j *journal) step(name string, err error) saga.StepFunc {
+	return func(ctx context.Context, exec *saga.Execution) error {
+		j.calls = append(j.calls, name)
+		return err
+	}
+}
+
+func TestOrchestrator_CompensatesNewestFirst(t *testing.T) {
+	j := &journal{}
+	orchestrator, err := saga.New(saga.Definition{
+		Name: "test",
+		Steps: []saga.Step{
+			{Name: "a", Action: j.step("do a", nil), Compensate: j.step("undo a", nil)},
+			{Name: "b", Action: j.step("do b", nil), Compensate: j.step("undo b", nil)},
+			{Name: "c", Action: j.step("do c", fmt.Errorf("boom")), Compensate: j.step("undo c", nil),
+				Retry: saga.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}},
+		},
+	}, saga.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exec, err := orchestrator.Run(context.Background(), "exec-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exec.Status != saga.StatusCompensated || exec.FailedStep != "c" || exec.Error != "boom" {
+		t.Fatalf("got status %s, error %q", exec.Status, exec.Error)
+	}
+	want := []string{"do a", "do b", "do c", "do c", "do c", "undo b", "undo a"}
+	if !reflect.DeepEqual(j.calls, want) {
+		t.Fatalf("got calls %v, want %v", j.calls, want)
+	}
+	if len(exec.History) != 7 || exec.History[4].Attempt != 3 || exec.History[4].Error != "boom" {
+		t.Fatalf("unexpected history %+v", exec.History)
+	}
+}
+
+func TestOrchestrator_PermanentErrorsAreNotRetried(t *testing.T) {
+	j := &journal{}
+	orchestrator, err := saga.New(saga.Definition{
+		Name: "test",
+		Steps: []saga.Step{
+			{Name: "pay", Action: j.step("pay", saga.Permanent(fmt.Errorf("card declined"))),
+				Retry: saga.RetryPolicy{MaxAttempts: 5}},
+		},
+	}, saga.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exec, err := orchestrator.Run(context.Background(), "exec-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exec.Status != saga.StatusCompensated || len(j.calls) != 1 {
+		t.Fatalf("got status %s after %d calls", exec.Status, len(j.calls))
+	}
+}
+
+func TestOrchestrator_CompensatesFailedPartialStep(t *testing.T) {
+	j := &journal{}
+	orchestrator, err := saga.New(saga.Definition{
+		Name: "test",
+		Steps: []saga.Step{
+			{Name: "a", Action: j.step("do a", nil), Compensate: j.step("undo a", nil)},
+			{Name: "b", Action: j.step("do b", fmt.Errorf("half done")), Compensate: j.step("undo b", nil), Partial: true},
+			{Name: "c", Action: j.step("do c", nil), Compensate: j.step("undo c", nil)},
+		},
+	}, saga.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exec, err := orchestrator.Run(context.Background(), "exec-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exec.Status != saga.StatusCompensated || exec.FailedStep != "b" {
+		t.Fatalf("got status %s, failed step %q", exec.Status, exec.FailedStep)
+	}
+	want := []string{"do a", "do b", "undo b", "undo a"}
+	if !reflect.DeepEqual(j.calls, want) {
+		t.Fatalf("got calls %v, want %v", j.calls, want)
+	}
+}
+
+func TestOrchestrator_ResumesPastPivot(t *testing.T) {
+	store := saga.NewMemoryStore()
+	j := &journal{}
+	failing := fmt.Errorf("unavailable")
+	finish := func(ctx context.Context, exec *saga.Execution) error {
+		j.calls = append(j.calls, "finish")
+		return failing
+	}
+
+	orchestrator, err := saga.New(saga.Definition{
+		Name: "test",
+		Steps: []saga.Step{
+			{Name: "order", Action: j.step("order", nil), Compensate: j.step("cancel", nil), Pivot: true},
+			{Name: "finish", Action: finish},
+		},
+	}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Past the pivot a failure leaves the execution running
+	exec, err := orchestrator.Run(context.Background(), "exec-1")
+	if err == nil || exec.Status != saga.StatusRunning || exec.Cursor != 1 {
+		t.Fatalf("got status %s at %d, error %v", exec.Status, exec.Cursor, err)
+	}
+
+	// A later run resumes at the failed step without repeating the pivot
+	failing = nil
+	exec, err = orchestrator.Run(context.Background(), "exec-1")
+	if err != nil || exec.Status != saga.StatusCompleted {
+		t.Fatalf("got status %s, error %v", exec.Status, err)
+	}
+	want := []string{"order", "finish", "finish"}
+	if !reflect.DeepEqual(j.calls, want) {
+		t.Fatalf("got calls %v, want %v", j.calls, want)
+	}
+}
+
+func TestOrchestrator_StepTimeout(t *testing.T) {
+	var finished []string
+	orchestrator, err := saga.New(saga.Definition{
+		Name: "test",
+		Steps: []saga.Step{{
+			Name:    "slow",
+			Timeout: 10 * time.Millisecond,
+			Action: func(ctx context.Context, exec *saga.Execution) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		}},
+	}, saga.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	orchestrator.SetHooks(saga.Hooks{
+		StepFinished: func(workflow, step string, phase saga.Phase, attempt int, duration time.Duration, err error) {
+			finished = append(finished, fmt.Sprintf("%s/%s/%s/%d/%v", workflow, step, phase, attempt, err))
+		},
+	})
+
+	exec, err := orchestrator.Run(context.Background(), "exec-1")
+	if err != nil || exec.Status != saga.StatusCompensated {
+		t.Fatalf("got status %s, error %v", exec.Status, err)
+	}
+	want := []string{"test/slow/ACTION/1/context deadline exceeded"}
+	if !reflect.DeepEqual(finished, want) {
+		t.Fatalf("got hooks %v, want %v", finished, want)
+	}
+}
+
+func TestOrchestrator_CancelBetweenSteps(t *testing.T) {
+	j := &journal{}
+	cancelled := false
+	orchestrator, err := saga.New(saga.Definition{
+		Name: "test",
+		Steps: []saga.Step{
+			{Name: "a", Action: func(ctx context.Context, exec *saga.Execution) error {
+				j.calls = append(j.calls, "do a")
+				cancelled = true
+				return nil
+			}, Compensate: j.step("undo a", nil)},
+			{Name: "b", Action: j.step("do b", nil), Compensate: j.step("undo b", nil)},
+		},
+		Cancelled: func(ctx context.Context, exec *saga.Execution) (bool, error) {
+			return cancelled, nil
+		},
+	}, saga.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exec, err := orchestrator.Run(context.Background(), "exec-1")
+	if err != nil || exec.Status != saga.StatusCancelled {
+		t.Fatalf("got status %s, error %v", exec.Status, err)
+	}
+	want := []string{"do a", "undo a"}
+	if !reflect.DeepEqual(j.calls, want) {
+		t.Fatalf("got calls %v, want %v", j.calls, want)
+	}
+}
+
+func TestOrchestrator_StepReportsCancel(t *testing.T) {
+	j := &journal{}
+	orchestrator, err := saga.New(saga.Definition{
+		Name: "test",
+		Steps: []saga.Step{
+			{Name: "a", Action: j.step("do a", nil), Compensate: j.step("undo a", nil)},
+			{Name: "confirm", Action: j.step("confirm", fmt.Errorf("too late: %w", saga.ErrCancelled)),
+				Retry: saga.RetryPolicy{MaxAttempts: 3}, Pivot: true},
+		},
+	}, saga.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exec, err := orchestrator.Run(context.Background(), "exec-1")
+	if err != nil || exec.Status != saga.StatusCancelled || exec.FailedStep != "confirm" {
+		t.Fatalf("got status %s at %s, error %v", exec.Status, exec.FailedStep, err)
+	}
+	want := []string{"do a", "confirm", "undo a"}
+	if !reflect.DeepEqual(j.calls, want) {
+		t.Fatalf("got calls %v, want %v", j.calls, want)
+	}
+}
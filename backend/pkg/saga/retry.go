@@ -0,0 +1,57 @@
+package saga
+
+import (
+	"errors"
+	"time"
+)
+
+// RetryPolicy says how often a failing step is attempted before the saga
+// gives up on it. The zero policy attempts once.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration // Wait before the second attempt
+	Multiplier  float64       // Growth of the wait per attempt; 0 keeps it constant
+	MaxBackoff  time.Duration // Cap on the wait; zero for none
+}
+
+// permanentError marks a failure that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, e.g. a declined card
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// retries reports whether another attempt should follow the given one
+func (p RetryPolicy) retries(attempt int, err error) bool {
+	return attempt < p.MaxAttempts && !IsPermanent(err) && !errors.Is(err, ErrCancelled)
+}
+
+// wait returns how long to wait after the given attempt
+func (p RetryPolicy) wait(attempt int) time.Duration {
+	wait := p.Backoff
+	for i := 1; i < attempt && p.Multiplier > 0; i++ {
+		wait = time.Duration(float64(wait) * p.Multiplier)
+		if p.MaxBackoff > 0 && wait >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return wait
+}
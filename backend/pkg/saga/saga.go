@@ -0,0 +1,111 @@
+// Package saga runs long-lived workflows as a sequence of steps, each with
+// an action and a compensation that undoes it. When a step fails, the steps
+// already done are compensated newest first. Progress is saved after every
+// attempt, so an execution interrupted by a restart resumes where it
+// stopped.
+//
+// Actions and compensations may run more than once, e.g. when a process
+// dies after a step succeeded but before that was saved. They must be
+// idempotent; the execution ID is a natural idempotency key.
+package saga
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Status is where an execution stands
+type Status string
+
+const (
+	StatusRunning      Status = "RUNNING"
+	StatusCompensating Status = "COMPENSATING"
+	StatusCancelling   Status = "CANCELLING"
+	StatusCompleted    Status = "COMPLETED"
+	StatusCompensated  Status = "COMPENSATED" // A step failed and every step before it was undone
+	StatusCancelled    Status = "CANCELLED"   // Cancelled before the pivot and every step done was undone
+)
+
+// ErrCancelled is returned by a step that finds its execution cancelled. It
+// is not retried, and compensation ends the execution CANCELLED instead of
+// COMPENSATED.
+var ErrCancelled = errors.New("saga cancelled")
+
+// Phase tells actions from compensations in the history
+type Phase string
+
+const (
+	PhaseAction       Phase = "ACTION"
+	PhaseCompensation Phase = "COMPENSATION"
+)
+
+// StepFunc runs an action or compensation for an execution
+type StepFunc func(ctx context.Context, exec *Execution) error
+
+// Step is one unit of a workflow
+type Step struct {
+	Name       string
+	Action     StepFunc
+	Compensate StepFunc      // Optional; nil when there is nothing to undo
+	Retry      RetryPolicy   // Applies to the action and the compensation
+	Timeout    time.Duration // Per attempt; zero for none
+	// Pivot marks the point of no return: once this step succeeds the
+	// workflow only moves forward, and later failures are retried by
+	// running the execution again rather than compensated
+	Pivot bool
+	// Partial marks an action that can fail with some of its effects in
+	// place, e.g. one holding several payments. Its compensation then also
+	// runs when the action fails, and must undo whatever part was done.
+	Partial bool
+}
+
+// Definition is a named workflow
+type Definition struct {
+	Name  string
+	Steps []Step
+	// Cancelled, when set, is asked before every step up to the pivot. If it
+	// reports true, the steps done so far are compensated and the execution
+	// ends CANCELLED.
+	Cancelled func(ctx context.Context, exec *Execution) (bool, error)
+}
+
+// Execution is one run of a workflow. It carries no business data: steps
+// keep their results in the owning service's records, keyed by the
+// execution ID.
+type Execution struct {
+	ID       string `json:"id"`
+	Workflow string `json:"workflow"`
+	Status   Status `json:"status"`
+	// Running: index of the next step to run. Compensating or cancelling:
+	// how many steps are left to undo.
+	Cursor     int       `json:"cursor"`
+	FailedStep string    `json:"failed_step,omitempty"` // The step whose failure or cancel started compensation
+	Error      string    `json:"error,omitempty"`
+	History    []Record  `json:"history"`
+	Version    int       `json:"version"` // Bumped by every save, for optimistic locking
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Record is one attempt at a step in an execution's history
+type Record struct {
+	Step     string        `json:"step"`
+	Phase    Phase         `json:"phase"`
+	Attempt  int           `json:"attempt"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+	At       time.Time     `json:"at"`
+}
+
+// Finished reports whether the execution has nothing left to run
+func (e *Execution) Finished() bool {
+	return e.Status == StatusCompleted || e.Status == StatusCompensated || e.Status == StatusCancelled
+}
+
+// Hooks are called as executions progress, e.g. to record metrics. Any of
+// them may be nil.
+type Hooks struct {
+	StepFinished func(workflow, step string, phase Phase, attempt int, duration time.Duration, err error)
+	Finished     func(exec *Execution)
+}
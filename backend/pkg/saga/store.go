@@ -0,0 +1,82 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// Store persists executions
+type Store interface {
+	Create(ctx context.Context, exec *Execution) error
+	// Load returns nil if there is no execution with the ID
+	Load(ctx context.Context, id string) (*Execution, error)
+	// Update saves the execution if nobody saved it since it was loaded, and
+	// bumps its version. It returns ErrConflict otherwise.
+	Update(ctx context.Context, exec *Execution) error
+}
+
+// MemoryStore keeps executions in memory, for tests and services that do
+// not need to resume after a restart
+type MemoryStore struct {
+	mu    sync.Mutex
+	execs map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{execs: make(map[string][]byte)}
+}
+
+// Create stores a new execution
+func (s *MemoryStore) Create(ctx context.Context, exec *Execution) error {
+	data, err := json.Marshal(exec)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to marshal saga execution", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.execs[exec.ID]; exists {
+		return errors.New(errors.ErrConflict, "saga execution already exists")
+	}
+	s.execs[exec.ID] = data
+	return nil
+}
+
+// Load returns a copy of the stored execution
+func (s *MemoryStore) Load(ctx context.Context, id string) (*Execution, error) {
+	s.mu.Lock()
+	data, ok := s.execs[id]
+	s.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+
+	var exec Execution
+	if err := json.Unmarshal(data, &exec); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to unmarshal saga execution", err)
+	}
+	return &exec, nil
+}
+
+// Update stores the execution if its version is current
+func (s *MemoryStore) Update(ctx context.Context, exec *Execution) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stored Execution
+	if err := json.Unmarshal(s.execs[exec.ID], &stored); err != nil || stored.Version != exec.Version {
+		return errors.New(errors.ErrConflict, "saga execution was modified concurrently")
+	}
+
+	exec.Version++
+	data, err := json.Marshal(exec)
+	if err != nil {
+		exec.Version--
+		return errors.Wrap(errors.ErrInternal, "failed to marshal saga execution", err)
+	}
+	s.execs[exec.ID] = data
+	return nil
+}
@@ -1,19 +1,26 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/titan-commerce/backend/inventory-service/internal/application"
-	"github.com/titan-commerce/backend/inventory-service/internal/infrastructure"
+	infrastructure "github.com/titan-commerce/backend/inventory-service/internal/infrastructure/redis"
+	"github.com/titan-commerce/backend/inventory-service/internal/interface/grpc"
+	pb "github.com/titan-commerce/backend/inventory-service/proto/inventory/v1"
 	"github.com/titan-commerce/backend/pkg/config"
 	"github.com/titan-commerce/backend/pkg/logger"
 	grpcLib "google.golang.org/grpc"
 )
 
+// expirySweepInterval is how often expired reservations are released
+const expirySweepInterval = 30 * time.Second
+
 func main() {
 	cfg, err := config.Load()
 	if err != nil {
@@ -46,8 +53,22 @@ func main() {
 	}
 
 	grpcServer := grpcLib.NewServer()
-	// TODO: Register gRPC handler when proto is generated
-	// pb.RegisterInventoryServiceServer(grpcServer, grpc.NewInventoryServiceServer(inventoryService, log))
+	pb.RegisterInventoryServiceServer(grpcServer, grpc.NewInventoryServiceServer(inventoryService, log))
+
+	// Return stock held by expired reservation groups
+	sweepCtx, stopSweep := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(expirySweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-sweepCtx.Done():
+				return
+			case <-ticker.C:
+				inventoryService.CleanExpiredReservations(sweepCtx)
+			}
+		}
+	}()
 
 	// Start server
 	go func() {
@@ -65,6 +86,7 @@ log.Info("Reserve → Commit/Rollback pattern active")
 	<-quit
 
 	log.Info("Shutting down Inventory Service")
+	stopSweep()
 	grpcServer.GracefulStop()
 	log.Info("Inventory Service stopped")
 }
@@ -2,11 +2,17 @@ package application
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/titan-commerce/backend/inventory-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
 	"github.com/titan-commerce/backend/pkg/logger"
 )
 
+// expiredGroupBatch is how many expired groups one sweep pass releases
+const expiredGroupBatch = 100
+
 type InventoryService struct {
 	repo   domain.StockRepository
 	logger *logger.Logger
@@ -90,6 +96,82 @@ func (s *InventoryService) RollbackReservation(ctx context.Context, reservationI
 	return nil
 }
 
+// ReserveStockGroup reserves every line or none under one group ID (Command)
+// Retrying with the same group ID returns the first attempt's group
+func (s *InventoryService) ReserveStockGroup(ctx context.Context, groupID string, lines []domain.ReservationLine, ttlMinutes int) (*domain.ReservationGroup, error) {
+	group, err := domain.NewReservationGroup(groupID, lines, ttlMinutes)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.repo.ReserveGroup(ctx, group)
+	if err != nil {
+		s.logger.Error(err, "failed to reserve stock group")
+		return nil, err
+	}
+
+	if result.ShortProductID != "" {
+		s.logger.Warnf("Insufficient stock: group=%s, product=%s", group.GroupID, result.ShortProductID)
+		return nil, errors.New(errors.ErrInsufficientStock,
+			fmt.Sprintf("insufficient stock for product %s", result.ShortProductID))
+	}
+	if !result.Reserved {
+		return nil, errors.New(errors.ErrConflict, "reservation was already released")
+	}
+
+	if result.Existing {
+		s.logger.Infof("Stock group already reserved: group=%s", group.GroupID)
+		return s.repo.GetGroup(ctx, group.GroupID)
+	}
+
+	s.logger.Infof("Stock group reserved: group=%s, lines=%d, units=%d",
+		group.GroupID, len(group.Lines), group.TotalQuantity())
+
+	return group, nil
+}
+
+// CommitReservationGroup commits every line of a group together (Command)
+// Committing a committed group is a no-op
+func (s *InventoryService) CommitReservationGroup(ctx context.Context, groupID string) error {
+	group, err := s.repo.GetGroup(ctx, groupID)
+	if err != nil {
+		return err
+	}
+
+	status, err := s.repo.CommitGroup(ctx, group)
+	if err != nil {
+		s.logger.Error(err, "failed to commit reservation group")
+		return err
+	}
+	if status != domain.ReservationCommitted {
+		return errors.New(errors.ErrConflict, fmt.Sprintf("reservation is %s", status))
+	}
+
+	s.logger.Infof("Reservation group committed: group=%s", groupID)
+	return nil
+}
+
+// RollbackReservationGroup returns every line of a group to available stock (Command)
+// Rolling back a released group is a no-op
+func (s *InventoryService) RollbackReservationGroup(ctx context.Context, groupID string) error {
+	group, err := s.repo.GetGroup(ctx, groupID)
+	if err != nil {
+		return err
+	}
+
+	status, err := s.repo.ReleaseGroup(ctx, group, domain.ReservationRolledBack, false)
+	if err != nil {
+		s.logger.Error(err, "failed to rollback reservation group")
+		return err
+	}
+	if status == domain.ReservationCommitted {
+		return errors.New(errors.ErrConflict, "cannot rollback committed reservation")
+	}
+
+	s.logger.Infof("Reservation group rolled back: group=%s", groupID)
+	return nil
+}
+
 // CheckStockAvailability checks if stock is available (Query)
 func (s *InventoryService) CheckStockAvailability(ctx context.Context, productID string, quantity int) (bool, error) {
 	return s.repo.CheckAvailability(ctx, productID, quantity)
@@ -131,17 +213,91 @@ func (s *InventoryService) AddStock(ctx context.Context, productID string, quant
 	return nil
 }
 
+// Restock puts units back on sale once per restock ID (Command)
+// A retried restock reports false and changes nothing
+func (s *InventoryService) Restock(ctx context.Context, restockID, productID string, quantity int) (bool, error) {
+	if restockID == "" {
+		return false, errors.New(errors.ErrInvalidInput, "restock ID is required")
+	}
+	if productID == "" {
+		return false, errors.New(errors.ErrInvalidInput, "product ID is required")
+	}
+	if quantity <= 0 {
+		return false, errors.New(errors.ErrInvalidInput, "quantity must be positive")
+	}
+
+	restocked, err := s.repo.Restock(ctx, restockID, productID, quantity)
+	if err != nil {
+		s.logger.Error(err, "failed to restock")
+		return false, err
+	}
+	if !restocked {
+		s.logger.Infof("Restock already applied: restock=%s", restockID)
+		return false, nil
+	}
+
+	s.logger.Infof("Stock restocked: product=%s, quantity=%d, restock=%s", productID, quantity, restockID)
+	return true, nil
+}
+
 // CleanExpiredReservations cleans up expired reservations (Command)
+// Single-product reservations expire with their key; expired groups have
+// their stock returned to the available pool here
 func (s *InventoryService) CleanExpiredReservations(ctx context.Context) error {
 	if err := s.repo.CleanExpiredReservations(ctx); err != nil {
 		s.logger.Error(err, "failed to clean expired reservations")
 		return err
 	}
 
-	s.logger.Info("Expired reservations cleaned")
+	released := 0
+	for {
+		groupIDs, err := s.repo.ExpiredGroups(ctx, time.Now(), expiredGroupBatch)
+		if err != nil {
+			s.logger.Error(err, "failed to list expired reservation groups")
+			return err
+		}
+
+		for _, groupID := range groupIDs {
+			if err := s.expireGroup(ctx, groupID); err != nil {
+				s.logger.Error(err, "failed to release expired reservation group")
+				return err
+			}
+		}
+		released += len(groupIDs)
+
+		if len(groupIDs) < expiredGroupBatch {
+			break
+		}
+	}
+
+	s.logger.Infof("Expired reservations cleaned: groups=%d", released)
 	return nil
 }
 
+// expireGroup releases one expired group. A group committed or rolled back
+// since it was listed is left as it is.
+func (s *InventoryService) expireGroup(ctx context.Context, groupID string) error {
+	group, err := s.repo.GetGroup(ctx, groupID)
+	if isNotFound(err) {
+		// Releasing a group that is gone only drops it from the expiry index
+		group, err = &domain.ReservationGroup{GroupID: groupID}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.repo.ReleaseGroup(ctx, group, domain.ReservationExpired, true)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func isNotFound(err error) bool {
+	appErr, ok := err.(*errors.AppError)
+	return ok && appErr.Code == errors.ErrNotFound
+}
+
 // CheckAndAlertLowStock checks for low stock and creates alerts (Command)
 func (s *InventoryService) CheckAndAlertLowStock(ctx context.Context, productID string, threshold int) error {
 	available, err := s.repo.GetAvailableStock(ctx, productID)
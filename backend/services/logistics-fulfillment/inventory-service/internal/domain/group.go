@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// ReservationLine is one product's quantity in a reservation group
+type ReservationLine struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+// ReservationGroup holds stock for several products at once. Its lines are
+// reserved, committed and released together: either every line is held or
+// none is.
+type ReservationGroup struct {
+	GroupID   string
+	Lines     []ReservationLine
+	Status    ReservationStatus
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// NewReservationGroup validates the lines and merges repeated products. An
+// empty groupID gets a generated one; callers that retry pass their own so
+// the retry finds the first attempt's group.
+func NewReservationGroup(groupID string, lines []ReservationLine, ttlMinutes int) (*ReservationGroup, error) {
+	if len(lines) == 0 {
+		return nil, errors.New(errors.ErrInvalidInput, "at least one item is required")
+	}
+	if ttlMinutes <= 0 {
+		return nil, errors.New(errors.ErrInvalidInput, "reservation TTL must be positive")
+	}
+	if groupID == "" {
+		groupID = uuid.New().String()
+	}
+
+	var merged []ReservationLine
+	index := make(map[string]int)
+	for _, line := range lines {
+		if line.ProductID == "" {
+			return nil, errors.New(errors.ErrInvalidInput, "product ID is required")
+		}
+		if line.Quantity <= 0 {
+			return nil, errors.New(errors.ErrInvalidInput, fmt.Sprintf("quantity for product %s must be positive", line.ProductID))
+		}
+		if i, ok := index[line.ProductID]; ok {
+			merged[i].Quantity += line.Quantity
+			continue
+		}
+		index[line.ProductID] = len(merged)
+		merged = append(merged, line)
+	}
+
+	now := time.Now()
+	return &ReservationGroup{
+		GroupID:   groupID,
+		Lines:     merged,
+		Status:    ReservationPending,
+		ExpiresAt: now.Add(time.Duration(ttlMinutes) * time.Minute),
+		CreatedAt: now,
+	}, nil
+}
+
+// TotalQuantity is the number of units the group holds
+func (g *ReservationGroup) TotalQuantity() int {
+	total := 0
+	for _, line := range g.Lines {
+		total += line.Quantity
+	}
+	return total
+}
@@ -1,6 +1,9 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type StockRepository interface {
 	// Atomic operations using Redis Lua scripts
@@ -17,6 +20,20 @@ type StockRepository interface {
 	AddStock(ctx context.Context, productID string, quantity int) error
 	RemoveStock(ctx context.Context, productID string, quantity int) error
 	SetStock(ctx context.Context, productID string, quantity int) error
+	// Restock adds to available stock once per restock ID, reporting false
+	// if the ID was applied before
+	Restock(ctx context.Context, restockID, productID string, quantity int) (bool, error)
+
+	// Reservation groups, each reserved, committed or released in one
+	// atomic step across all of its lines
+	ReserveGroup(ctx context.Context, group *ReservationGroup) (*ReserveGroupResult, error)
+	GetGroup(ctx context.Context, groupID string) (*ReservationGroup, error)
+	CommitGroup(ctx context.Context, group *ReservationGroup) (ReservationStatus, error)
+	// ReleaseGroup returns a pending group's stock and marks it status. With
+	// onlyExpired it leaves groups that have not expired alone.
+	ReleaseGroup(ctx context.Context, group *ReservationGroup, status ReservationStatus, onlyExpired bool) (ReservationStatus, error)
+	// ExpiredGroups lists pending groups past their expiry, oldest first
+	ExpiredGroups(ctx context.Context, now time.Time, limit int) ([]string, error)
 
 	// Reservations
 	GetReservation(ctx context.Context, reservationID string) (*Reservation, error)
@@ -28,3 +45,12 @@ type StockRepository interface {
 	GetAlerts(ctx context.Context, productID string) ([]*StockAlert, error)
 }
 
+// ReserveGroupResult is the outcome of reserving a group. When stock runs
+// short nothing is held and ShortProductID names the first line that could
+// not be met. Existing without Reserved means the group was reserved
+// earlier and has since been rolled back or expired.
+type ReserveGroupResult struct {
+	Reserved       bool
+	Existing       bool // The group was reserved earlier under the same ID
+	ShortProductID string
+}
@@ -1,85 +1,84 @@
 package domain
-}
-	return nil
-	r.Status = ReservationRolledBack
-	}
-		return errors.New(errors.ErrInvalidInput, "cannot rollback committed reservation")
-	if r.Status == ReservationCommitted {
-func (r *Reservation) Rollback() error {
 
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+type Stock struct {
+	ProductID         string
+	AvailableQuantity int
+	ReservedQuantity  int
+	TotalQuantity     int
+	WarehouseID       string
+	UpdatedAt         time.Time
 }
-	return nil
-	r.Status = ReservationCommitted
-	}
-		return errors.New(errors.ErrInvalidInput, "reservation already processed")
-	if r.Status != ReservationPending {
-	}
-		return errors.New(errors.ErrInvalidInput, "reservation has expired")
-	if r.IsExpired() {
-func (r *Reservation) Commit() error {
 
+type Reservation struct {
+	ReservationID string
+	ProductID     string
+	Quantity      int
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+	Status        ReservationStatus
 }
-	return time.Now().After(r.ExpiresAt)
-func (r *Reservation) IsExpired() bool {
 
+type ReservationStatus string
+
+const (
+	ReservationPending    ReservationStatus = "PENDING"
+	ReservationCommitted  ReservationStatus = "COMMITTED"
+	ReservationRolledBack ReservationStatus = "ROLLED_BACK"
+	ReservationExpired    ReservationStatus = "EXPIRED"
+)
+
+type StockAlert struct {
+	ProductID     string
+	CurrentStock  int
+	ThresholdType string // LOW_STOCK, OUT_OF_STOCK
+	CreatedAt     time.Time
 }
-	}, nil
-		Status:        ReservationPending,
-		CreatedAt:     now,
-		ExpiresAt:     now.Add(time.Duration(ttlMinutes) * time.Minute),
-		Quantity:      quantity,
-		ProductID:     productID,
-		ReservationID: uuid.New().String(),
-	return &Reservation{
-	now := time.Now()
 
+func NewReservation(productID string, quantity int, ttlMinutes int) (*Reservation, error) {
+	if productID == "" {
+		return nil, errors.New(errors.ErrInvalidInput, "product ID is required")
 	}
-		return nil, errors.New(errors.ErrInvalidInput, "quantity must be positive")
 	if quantity <= 0 {
+		return nil, errors.New(errors.ErrInvalidInput, "quantity must be positive")
 	}
-		return nil, errors.New(errors.ErrInvalidInput, "product ID is required")
-	if productID == "" {
-func NewReservation(productID string, quantity int, ttlMinutes int) (*Reservation, error) {
 
+	now := time.Now()
+	return &Reservation{
+		ReservationID: uuid.New().String(),
+		ProductID:     productID,
+		Quantity:      quantity,
+		ExpiresAt:     now.Add(time.Duration(ttlMinutes) * time.Minute),
+		CreatedAt:     now,
+		Status:        ReservationPending,
+	}, nil
 }
-	CreatedAt     time.Time
-	ThresholdType string // LOW_STOCK, OUT_OF_STOCK
-	CurrentStock  int
-	ProductID     string
-type StockAlert struct {
-
-)
-	ReservationExpired   ReservationStatus = "EXPIRED"
-	ReservationRolledBack ReservationStatus = "ROLLED_BACK"
-	ReservationCommitted ReservationStatus = "COMMITTED"
-	ReservationPending   ReservationStatus = "PENDING"
-const (
-
-type ReservationStatus string
 
+func (r *Reservation) IsExpired() bool {
+	return time.Now().After(r.ExpiresAt)
 }
-	Status        ReservationStatus
-	CreatedAt     time.Time
-	ExpiresAt     time.Time
-	Quantity      int
-	ProductID     string
-	ReservationID string
-type Reservation struct {
 
+func (r *Reservation) Commit() error {
+	if r.IsExpired() {
+		return errors.New(errors.ErrInvalidInput, "reservation has expired")
+	}
+	if r.Status != ReservationPending {
+		return errors.New(errors.ErrInvalidInput, "reservation already processed")
+	}
+	r.Status = ReservationCommitted
+	return nil
 }
-	UpdatedAt         time.Time
-	WarehouseID       string
-	TotalQuantity     int
-	ReservedQuantity  int
-	AvailableQuantity int
-	ProductID         string
-type Stock struct {
-
-)
-	"github.com/titan-commerce/backend/pkg/errors"
-	"github.com/google/uuid"
-
-	"time"
-import (
-
 
+func (r *Reservation) Rollback() error {
+	if r.Status == ReservationCommitted {
+		return errors.New(errors.ErrInvalidInput, "cannot rollback committed reservation")
+	}
+	r.Status = ReservationRolledBack
+	return nil
+}
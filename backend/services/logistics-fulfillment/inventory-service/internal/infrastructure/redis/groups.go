@@ -0,0 +1,237 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/titan-commerce/backend/inventory-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+const (
+	groupPrefix = "reservation_group:"
+	// Pending groups scored by expiry time, for the expiry sweep
+	groupExpiryKey = "reservation_groups:expiring"
+	// How long a finished group is kept, so a retried commit or rollback
+	// finds it
+	groupRetention = 24 * time.Hour
+)
+
+// Every script gets the group key and the expiry index first, then the
+// available and reserved keys of each line in turn. A group is a hash with
+// status, lines, created_at and expires_at fields.
+
+// reserveGroupScript holds every line or none. It returns {1, 0} when it
+// reserved, {1, 1} when the group was already held or committed, {0, i}
+// when line i was short and {0, 0} when the group was already released.
+var reserveGroupScript = redis.NewScript(`
+	local group_key = KEYS[1]
+	local expiry_key = KEYS[2]
+	local group_id = ARGV[1]
+	local lines = ARGV[2]
+	local created_at = ARGV[3]
+	local expires_at = tonumber(ARGV[4])
+	local retention = tonumber(ARGV[5])
+	local count = (#KEYS - 2) / 2
+
+	local status = redis.call('HGET', group_key, 'status')
+	if status == 'PENDING' or status == 'COMMITTED' then
+		return {1, 1}
+	elseif status then
+		return {0, 0}
+	end
+
+	-- Check every line before touching any, so a short line holds nothing
+	for i = 1, count do
+		local available = tonumber(redis.call('GET', KEYS[2 * i + 1]) or 0)
+		if available < tonumber(ARGV[5 + i]) then
+			return {0, i}
+		end
+	end
+
+	for i = 1, count do
+		local quantity = tonumber(ARGV[5 + i])
+		redis.call('DECRBY', KEYS[2 * i + 1], quantity)
+		redis.call('INCRBY', KEYS[2 * i + 2], quantity)
+	end
+	redis.call('HSET', group_key, 'status', 'PENDING', 'lines', lines, 'created_at', created_at, 'expires_at', expires_at)
+	redis.call('EXPIREAT', group_key, expires_at + retention)
+	redis.call('ZADD', expiry_key, expires_at, group_id)
+	return {1, 0}
+`)
+
+// commitGroupScript turns a pending group's reserved stock into sold stock.
+// A group can be committed until the expiry sweep releases it. It returns
+// the group's status afterwards, or MISSING.
+var commitGroupScript = redis.NewScript(`
+	local group_key = KEYS[1]
+	local expiry_key = KEYS[2]
+	local group_id = ARGV[1]
+	local retention = tonumber(ARGV[2])
+	local count = (#KEYS - 2) / 2
+
+	local status = redis.call('HGET', group_key, 'status')
+	if not status then
+		return 'MISSING'
+	end
+	if status ~= 'PENDING' then
+		return status
+	end
+
+	for i = 1, count do
+		redis.call('DECRBY', KEYS[2 * i + 2], tonumber(ARGV[2 + i]))
+	end
+	redis.call('HSET', group_key, 'status', 'COMMITTED')
+	redis.call('EXPIRE', group_key, retention)
+	redis.call('ZREM', expiry_key, group_id)
+	return 'COMMITTED'
+`)
+
+// releaseGroupScript returns a pending group's stock to the available pool
+// and marks it with the given status. With a non-zero now it only releases
+// a group that expired by then. It returns the group's status afterwards,
+// or MISSING.
+var releaseGroupScript = redis.NewScript(`
+	local group_key = KEYS[1]
+	local expiry_key = KEYS[2]
+	local group_id = ARGV[1]
+	local retention = tonumber(ARGV[2])
+	local new_status = ARGV[3]
+	local now = tonumber(ARGV[4])
+	local count = (#KEYS - 2) / 2
+
+	local status = redis.call('HGET', group_key, 'status')
+	if not status then
+		redis.call('ZREM', expiry_key, group_id)
+		return 'MISSING'
+	end
+	if status ~= 'PENDING' then
+		return status
+	end
+	if now > 0 and tonumber(redis.call('HGET', group_key, 'expires_at')) > now then
+		return status
+	end
+
+	for i = 1, count do
+		local quantity = tonumber(ARGV[4 + i])
+		redis.call('INCRBY', KEYS[2 * i + 1], quantity)
+		redis.call('DECRBY', KEYS[2 * i + 2], quantity)
+	end
+	redis.call('HSET', group_key, 'status', new_status)
+	redis.call('EXPIRE', group_key, retention)
+	redis.call('ZREM', expiry_key, group_id)
+	return new_status
+`)
+
+// ReserveGroup atomically reserves every line of the group, or none
+func (r *StockRepository) ReserveGroup(ctx context.Context, group *domain.ReservationGroup) (*domain.ReserveGroupResult, error) {
+	linesJSON, err := json.Marshal(group.Lines)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to marshal reservation lines", err)
+	}
+
+	args := []interface{}{
+		group.GroupID, string(linesJSON), group.CreatedAt.Unix(), group.ExpiresAt.Unix(), int64(groupRetention.Seconds()),
+	}
+	for _, line := range group.Lines {
+		args = append(args, line.Quantity)
+	}
+
+	result, err := reserveGroupScript.Run(ctx, r.client, groupKeys(group), args...).Int64Slice()
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to reserve stock", err)
+	}
+	if result[0] == 0 && result[1] == 0 {
+		return &domain.ReserveGroupResult{Existing: true}, nil
+	}
+	if result[0] == 0 {
+		return &domain.ReserveGroupResult{ShortProductID: group.Lines[result[1]-1].ProductID}, nil
+	}
+	return &domain.ReserveGroupResult{Reserved: true, Existing: result[1] == 1}, nil
+}
+
+// GetGroup retrieves a reservation group
+func (r *StockRepository) GetGroup(ctx context.Context, groupID string) (*domain.ReservationGroup, error) {
+	fields, err := r.client.HGetAll(ctx, groupPrefix+groupID).Result()
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to get reservation", err)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New(errors.ErrNotFound, "reservation not found")
+	}
+
+	group := &domain.ReservationGroup{GroupID: groupID, Status: domain.ReservationStatus(fields["status"])}
+	if err := json.Unmarshal([]byte(fields["lines"]), &group.Lines); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to unmarshal reservation lines", err)
+	}
+	createdAt, _ := strconv.ParseInt(fields["created_at"], 10, 64)
+	expiresAt, _ := strconv.ParseInt(fields["expires_at"], 10, 64)
+	group.CreatedAt = time.Unix(createdAt, 0)
+	group.ExpiresAt = time.Unix(expiresAt, 0)
+	return group, nil
+}
+
+// CommitGroup commits every line of a pending group
+func (r *StockRepository) CommitGroup(ctx context.Context, group *domain.ReservationGroup) (domain.ReservationStatus, error) {
+	args := []interface{}{group.GroupID, int64(groupRetention.Seconds())}
+	for _, line := range group.Lines {
+		args = append(args, line.Quantity)
+	}
+
+	status, err := commitGroupScript.Run(ctx, r.client, groupKeys(group), args...).Text()
+	if err != nil {
+		return "", errors.Wrap(errors.ErrInternal, "failed to commit reservation", err)
+	}
+	return groupStatus(status)
+}
+
+// ReleaseGroup returns every line of a pending group to available stock
+func (r *StockRepository) ReleaseGroup(ctx context.Context, group *domain.ReservationGroup, status domain.ReservationStatus, onlyExpired bool) (domain.ReservationStatus, error) {
+	var now int64
+	if onlyExpired {
+		now = time.Now().Unix()
+	}
+	args := []interface{}{group.GroupID, int64(groupRetention.Seconds()), string(status), now}
+	for _, line := range group.Lines {
+		args = append(args, line.Quantity)
+	}
+
+	result, err := releaseGroupScript.Run(ctx, r.client, groupKeys(group), args...).Text()
+	if err != nil {
+		return "", errors.Wrap(errors.ErrInternal, "failed to release reservation", err)
+	}
+	return groupStatus(result)
+}
+
+// ExpiredGroups lists pending groups whose expiry has passed
+func (r *StockRepository) ExpiredGroups(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	ids, err := r.client.ZRangeByScore(ctx, groupExpiryKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.Unix(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to list expired reservations", err)
+	}
+	return ids, nil
+}
+
+// groupKeys lists the keys a group script touches, in the order the
+// scripts expect
+func groupKeys(group *domain.ReservationGroup) []string {
+	keys := []string{groupPrefix + group.GroupID, groupExpiryKey}
+	for _, line := range group.Lines {
+		keys = append(keys, stockAvailablePrefix+line.ProductID, stockReservedPrefix+line.ProductID)
+	}
+	return keys
+}
+
+func groupStatus(status string) (domain.ReservationStatus, error) {
+	if status == "MISSING" {
+		return "", errors.New(errors.ErrNotFound, "reservation not found")
+	}
+	return domain.ReservationStatus(status), nil
+}
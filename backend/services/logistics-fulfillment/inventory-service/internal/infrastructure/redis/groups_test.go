@@ -0,0 +1,188 @@
+package redis_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/titan-commerce/backend/inventory-service/internal/domain"
+	inventoryredis "github.com/titan-commerce/backend/inventory-service/internal/infrastructure/redis"
+)
+
+// stockedGroup stocks two products and returns a pending group for them,
+// not yet reserved
+func stockedGroup(t *testing.T, repo *inventoryredis.StockRepository, stockA, stockB, wantA, wantB int) *domain.ReservationGroup {
+	ctx := context.Background()
+	productA, productB := testID("prod-a"), testID("prod-b")
+	require.NoError(t, repo.SetStock(ctx, productA, stockA))
+	require.NoError(t, repo.SetStock(ctx, productB, stockB))
+
+	group, err := domain.NewReservationGroup(testID("group"), []domain.ReservationLine{
+		{ProductID: productA, Quantity: wantA},
+		{ProductID: productB, Quantity: wantB},
+	}, 15)
+	require.NoError(t, err)
+	return group
+}
+
+// assertStock checks each line's available and reserved stock
+func assertStock(t *testing.T, repo *inventoryredis.StockRepository, group *domain.ReservationGroup, available, reserved []int) {
+	t.Helper()
+	ctx := context.Background()
+	for i, line := range group.Lines {
+		got, err := repo.GetAvailableStock(ctx, line.ProductID)
+		require.NoError(t, err)
+		assert.Equal(t, available[i], got, "available %s", line.ProductID)
+
+		got, err = repo.GetReservedStock(ctx, line.ProductID)
+		require.NoError(t, err)
+		assert.Equal(t, reserved[i], got, "reserved %s", line.ProductID)
+	}
+}
+
+func TestStockRepository_ReserveGroupAllOrNothing(t *testing.T) {
+	repo := newRepository(t)
+	group := stockedGroup(t, repo, 5, 1, 2, 3)
+
+	result, err := repo.ReserveGroup(context.Background(), group)
+	require.NoError(t, err)
+
+	// The second line is short, so the first holds nothing either
+	assert.False(t, result.Reserved)
+	assert.Equal(t, group.Lines[1].ProductID, result.ShortProductID)
+	assertStock(t, repo, group, []int{5, 1}, []int{0, 0})
+}
+
+func TestStockRepository_ReserveGroupRetryHoldsOnce(t *testing.T) {
+	repo := newRepository(t)
+	ctx := context.Background()
+	group := stockedGroup(t, repo, 5, 5, 2, 3)
+
+	result, err := repo.ReserveGroup(ctx, group)
+	require.NoError(t, err)
+	assert.True(t, result.Reserved)
+	assert.False(t, result.Existing)
+
+	result, err = repo.ReserveGroup(ctx, group)
+	require.NoError(t, err)
+	assert.True(t, result.Reserved)
+	assert.True(t, result.Existing)
+	assertStock(t, repo, group, []int{3, 2}, []int{2, 3})
+}
+
+func TestStockRepository_CommitGroupOnce(t *testing.T) {
+	repo := newRepository(t)
+	ctx := context.Background()
+	group := stockedGroup(t, repo, 5, 5, 2, 3)
+	_, err := repo.ReserveGroup(ctx, group)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		status, err := repo.CommitGroup(ctx, group)
+		require.NoError(t, err)
+		assert.Equal(t, domain.ReservationCommitted, status)
+	}
+	assertStock(t, repo, group, []int{3, 2}, []int{0, 0})
+
+	// A committed group is neither rolled back nor reserved again
+	status, err := repo.ReleaseGroup(ctx, group, domain.ReservationRolledBack, false)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ReservationCommitted, status)
+
+	result, err := repo.ReserveGroup(ctx, group)
+	require.NoError(t, err)
+	assert.True(t, result.Existing)
+	assertStock(t, repo, group, []int{3, 2}, []int{0, 0})
+}
+
+func TestStockRepository_RollbackGroupOnce(t *testing.T) {
+	repo := newRepository(t)
+	ctx := context.Background()
+	group := stockedGroup(t, repo, 5, 5, 2, 3)
+	_, err := repo.ReserveGroup(ctx, group)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		status, err := repo.ReleaseGroup(ctx, group, domain.ReservationRolledBack, false)
+		require.NoError(t, err)
+		assert.Equal(t, domain.ReservationRolledBack, status)
+	}
+	assertStock(t, repo, group, []int{5, 5}, []int{0, 0})
+
+	// A rolled back group cannot be committed or reserved again
+	status, err := repo.CommitGroup(ctx, group)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ReservationRolledBack, status)
+
+	result, err := repo.ReserveGroup(ctx, group)
+	require.NoError(t, err)
+	assert.False(t, result.Reserved)
+	assert.True(t, result.Existing)
+	assertStock(t, repo, group, []int{5, 5}, []int{0, 0})
+}
+
+func TestStockRepository_CommitAfterSweepExpiredGroup(t *testing.T) {
+	repo := newRepository(t)
+	ctx := context.Background()
+	group := stockedGroup(t, repo, 5, 5, 2, 3)
+	group.ExpiresAt = time.Now().Add(-time.Minute)
+	_, err := repo.ReserveGroup(ctx, group)
+	require.NoError(t, err)
+
+	status, err := repo.ReleaseGroup(ctx, group, domain.ReservationExpired, true)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ReservationExpired, status)
+
+	// The stock went back on sale, so the late commit takes none of it
+	status, err = repo.CommitGroup(ctx, group)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ReservationExpired, status)
+	assertStock(t, repo, group, []int{5, 5}, []int{0, 0})
+}
+
+func TestStockRepository_SweepReleasesOnce(t *testing.T) {
+	repo := newRepository(t)
+	ctx := context.Background()
+	group := stockedGroup(t, repo, 5, 5, 2, 3)
+	group.ExpiresAt = time.Now().Add(-time.Minute)
+	_, err := repo.ReserveGroup(ctx, group)
+	require.NoError(t, err)
+
+	expired, err := repo.ExpiredGroups(ctx, time.Now(), 1000)
+	require.NoError(t, err)
+	assert.Contains(t, expired, group.GroupID)
+
+	// Sweeps of several replicas race for the same group
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, err := repo.ReleaseGroup(ctx, group, domain.ReservationExpired, true)
+			assert.NoError(t, err)
+			assert.Equal(t, domain.ReservationExpired, status)
+		}()
+	}
+	wg.Wait()
+
+	assertStock(t, repo, group, []int{5, 5}, []int{0, 0})
+	expired, err = repo.ExpiredGroups(ctx, time.Now(), 1000)
+	require.NoError(t, err)
+	assert.NotContains(t, expired, group.GroupID)
+}
+
+func TestStockRepository_SweepLeavesUnexpiredGroup(t *testing.T) {
+	repo := newRepository(t)
+	ctx := context.Background()
+	group := stockedGroup(t, repo, 5, 5, 2, 3)
+	_, err := repo.ReserveGroup(ctx, group)
+	require.NoError(t, err)
+
+	status, err := repo.ReleaseGroup(ctx, group, domain.ReservationExpired, true)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ReservationPending, status)
+	assertStock(t, repo, group, []int{3, 2}, []int{2, 3})
+}
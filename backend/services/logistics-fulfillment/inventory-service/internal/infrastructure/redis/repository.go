@@ -16,7 +16,11 @@ const (
 	stockReservedPrefix   = "stock:reserved:"
 	reservationPrefix     = "reservation:"
 	alertPrefix           = "alert:"
+	restockPrefix         = "restock:"
 	defaultReservationTTL = 15 * time.Minute
+	// How long a restock ID is remembered, so a retried restock is not
+	// applied twice
+	restockRetention = 30 * 24 * time.Hour
 )
 
 type StockRepository struct {
@@ -27,6 +31,24 @@ func NewStockRepository(client *redis.Client) *StockRepository {
 	return &StockRepository{client: client}
 }
 
+func NewRedisInventoryRepository(addr, password string) (*StockRepository, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       0,
+	})
+
+	// Test connection
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to connect to Redis", err)
+	}
+
+	return NewStockRepository(client), nil
+}
+
 // ReserveStock atomically reserves stock using Lua script
 func (r *StockRepository) ReserveStock(ctx context.Context, productID string, quantity int, reservationID string, ttlMinutes int) (bool, error) {
 	availableKey := stockAvailablePrefix + productID
@@ -192,6 +214,31 @@ func (r *StockRepository) RemoveStock(ctx context.Context, productID string, qua
 	return r.client.DecrBy(ctx, key, int64(quantity)).Err()
 }
 
+// restockScript adds to available stock unless the restock ID was seen
+// before. Returns 1 if it added, 0 if not.
+var restockScript = redis.NewScript(`
+	local restock_key = KEYS[1]
+	local available_key = KEYS[2]
+	local quantity = tonumber(ARGV[1])
+	local retention_ms = ARGV[2]
+
+	if not redis.call('SET', restock_key, quantity, 'NX', 'PX', retention_ms) then
+		return 0
+	end
+	redis.call('INCRBY', available_key, quantity)
+	return 1
+`)
+
+// Restock adds to available stock once per restock ID
+func (r *StockRepository) Restock(ctx context.Context, restockID, productID string, quantity int) (bool, error) {
+	restocked, err := restockScript.Run(ctx, r.client, []string{restockPrefix + restockID, stockAvailablePrefix + productID},
+		quantity, restockRetention.Milliseconds()).Int()
+	if err != nil {
+		return false, errors.Wrap(errors.ErrInternal, "failed to restock", err)
+	}
+	return restocked == 1, nil
+}
+
 // SetStock sets stock level
 func (r *StockRepository) SetStock(ctx context.Context, productID string, quantity int) error {
 	key := stockAvailablePrefix + productID
@@ -0,0 +1,51 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	inventoryredis "github.com/titan-commerce/backend/inventory-service/internal/infrastructure/redis"
+)
+
+// These tests need a Redis to run against, e.g.
+// INVENTORY_TEST_REDIS_ADDR=localhost:6379 go test ./internal/infrastructure/redis/
+func newRepository(t *testing.T) *inventoryredis.StockRepository {
+	addr := os.Getenv("INVENTORY_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("INVENTORY_TEST_REDIS_ADDR not set")
+	}
+	repo, err := inventoryredis.NewRedisInventoryRepository(addr, os.Getenv("INVENTORY_TEST_REDIS_PASSWORD"))
+	require.NoError(t, err)
+	return repo
+}
+
+// testID makes keys unique to one test run
+func testID(name string) string {
+	return fmt.Sprintf("test-%s-%d", name, time.Now().UnixNano())
+}
+
+func TestStockRepository_RestockOncePerID(t *testing.T) {
+	repo := newRepository(t)
+	ctx := context.Background()
+	productID := testID("prod")
+	require.NoError(t, repo.SetStock(ctx, productID, 5))
+
+	restockID := testID("return") + ":" + productID
+	restocked, err := repo.Restock(ctx, restockID, productID, 2)
+	require.NoError(t, err)
+	assert.True(t, restocked)
+
+	// A retry after a lost reply changes nothing
+	restocked, err = repo.Restock(ctx, restockID, productID, 2)
+	require.NoError(t, err)
+	assert.False(t, restocked)
+
+	available, err := repo.GetAvailableStock(ctx, productID)
+	require.NoError(t, err)
+	assert.Equal(t, 7, available)
+}
@@ -0,0 +1,111 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/titan-commerce/backend/inventory-service/internal/application"
+	"github.com/titan-commerce/backend/inventory-service/internal/domain"
+	pb "github.com/titan-commerce/backend/inventory-service/proto/inventory/v1"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ReservationTTLMinutes is how long a reservation holds stock before the
+// expiry sweep returns it
+const ReservationTTLMinutes = 15
+
+type InventoryServiceServer struct {
+	pb.UnimplementedInventoryServiceServer
+	service *application.InventoryService
+	logger  *logger.Logger
+}
+
+func NewInventoryServiceServer(service *application.InventoryService, logger *logger.Logger) *InventoryServiceServer {
+	return &InventoryServiceServer{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// ReserveStock reserves all requested items under one reservation ID, or
+// none of them. Running short is reported in the response, not as an error.
+func (s *InventoryServiceServer) ReserveStock(ctx context.Context, req *pb.ReserveStockRequest) (*pb.ReserveStockResponse, error) {
+	group, err := s.service.ReserveStockGroup(ctx, req.ReservationId, itemsToLines(req.Items), ReservationTTLMinutes)
+	if appErr, ok := err.(*errors.AppError); ok && appErr.Code == errors.ErrInsufficientStock {
+		return &pb.ReserveStockResponse{Success: false, ErrorMessage: appErr.Message}, nil
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &pb.ReserveStockResponse{
+		Success:       true,
+		ReservationId: group.GroupID,
+	}, nil
+}
+
+func (s *InventoryServiceServer) CommitReservation(ctx context.Context, req *pb.CommitReservationRequest) (*pb.CommitReservationResponse, error) {
+	if err := s.service.CommitReservationGroup(ctx, req.ReservationId); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.CommitReservationResponse{Success: true}, nil
+}
+
+func (s *InventoryServiceServer) RollbackReservation(ctx context.Context, req *pb.RollbackReservationRequest) (*pb.RollbackReservationResponse, error) {
+	if err := s.service.RollbackReservationGroup(ctx, req.ReservationId); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.RollbackReservationResponse{Success: true}, nil
+}
+
+func (s *InventoryServiceServer) CheckStockAvailability(ctx context.Context, req *pb.CheckStockAvailabilityRequest) (*pb.CheckStockAvailabilityResponse, error) {
+	resp := &pb.CheckStockAvailabilityResponse{Available: true}
+	for _, item := range req.Items {
+		available, err := s.service.CheckStockAvailability(ctx, item.ProductId, int(item.Quantity))
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if !available {
+			resp.Available = false
+			resp.UnavailableItems = append(resp.UnavailableItems, item)
+		}
+	}
+	return resp, nil
+}
+
+func (s *InventoryServiceServer) GetStock(ctx context.Context, req *pb.GetStockRequest) (*pb.GetStockResponse, error) {
+	stock, err := s.service.GetStockInfo(ctx, req.ProductId)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &pb.GetStockResponse{
+		AvailableQuantity: int32(stock.AvailableQuantity),
+		ReservedQuantity:  int32(stock.ReservedQuantity),
+	}, nil
+}
+
+func (s *InventoryServiceServer) Restock(ctx context.Context, req *pb.RestockRequest) (*pb.RestockResponse, error) {
+	restocked, err := s.service.Restock(ctx, req.RestockId, req.ProductId, int(req.Quantity))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.RestockResponse{Restocked: restocked}, nil
+}
+
+func itemsToLines(items []*pb.StockItem) []domain.ReservationLine {
+	lines := make([]domain.ReservationLine, len(items))
+	for i, item := range items {
+		lines[i] = domain.ReservationLine{ProductID: item.ProductId, Quantity: int(item.Quantity)}
+	}
+	return lines
+}
+
+func toStatus(err error) error {
+	if appErr, ok := err.(*errors.AppError); ok {
+		return appErr.ToGRPCError()
+	}
+	return status.Error(codes.Internal, err.Error())
+}
@@ -1,11 +1,24 @@
-﻿package main
+package main
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"net"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	_ "github.com/lib/pq"
 	"github.com/titan-commerce/backend/pkg/config"
 	"github.com/titan-commerce/backend/pkg/logger"
+	"github.com/titan-commerce/backend/shipping-service/internal/application"
+	"github.com/titan-commerce/backend/shipping-service/internal/infrastructure/postgres"
+	infrastructure "github.com/titan-commerce/backend/shipping-service/internal/infrastructure/redis"
+	handler "github.com/titan-commerce/backend/shipping-service/internal/interface/grpc"
+	pb "github.com/titan-commerce/backend/shipping-service/proto/shipping/v1"
+	grpcLib "google.golang.org/grpc"
 )
 
 func main() {
@@ -22,7 +35,53 @@ func main() {
 		Pretty:      true,
 	})
 
-	log.Info("shipping-service starting...")
-	// TODO: Implement service
-	select {}
+	log.Info("Shipping Service starting...")
+
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		log.Fatal(err, "Failed to open database")
+	}
+	defer db.Close()
+
+	pingCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(pingCtx); err != nil {
+		log.Fatal(err, "Failed to connect to database")
+	}
+
+	// Shipments created and delivered are announced on a Redis stream
+	// order-service reads
+	publisher, err := infrastructure.NewRedisShipmentEventPublisher(cfg.RedisAddr, cfg.RedisPassword)
+	if err != nil {
+		log.Fatal(err, "Failed to initialize shipment event publisher")
+	}
+
+	// Initialize application service
+	shippingService := application.NewShippingService(postgres.NewShipmentRepository(db), publisher, log)
+
+	// Initialize gRPC server
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
+	if err != nil {
+		log.Fatal(err, "Failed to listen")
+	}
+
+	grpcServer := grpcLib.NewServer()
+	pb.RegisterShippingServiceServer(grpcServer, handler.NewShippingServiceServer(shippingService, log))
+
+	// Start server
+	go func() {
+		log.Infof("gRPC server listening on :%d", cfg.GRPCPort)
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Fatal(err, "Failed to serve")
+		}
+	}()
+
+	// Graceful shutdown
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Info("Shutting down Shipping Service")
+	grpcServer.GracefulStop()
+	log.Info("Shipping Service stopped")
 }
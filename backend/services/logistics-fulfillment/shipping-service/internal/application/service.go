@@ -2,8 +2,10 @@ package application
 
 import (
 	"context"
+	"time"
 
 	"github.com/titan-commerce/backend/shipping-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
 	"github.com/titan-commerce/backend/pkg/logger"
 )
 
@@ -11,38 +13,108 @@ type ShipmentRepository interface {
 	Save(ctx context.Context, shipment *domain.Shipment) error
 	FindByID(ctx context.Context, shipmentID string) (*domain.Shipment, error)
 	FindByOrderID(ctx context.Context, orderID string) (*domain.Shipment, error)
+	FindOutbound(ctx context.Context, orderID, subOrderID string) (*domain.Shipment, error)
+	FindByReturnID(ctx context.Context, returnID string) (*domain.Shipment, error)
 	Update(ctx context.Context, shipment *domain.Shipment) error
 }
 
+// ShipmentEventPublisher hands shipment events to the services that act on
+// them, e.g. order-service. They may see an event more than once.
+type ShipmentEventPublisher interface {
+	Publish(ctx context.Context, event *domain.ShipmentEvent) error
+}
+
+// DefaultReturnCarrier collects returns when the caller names no carrier
+const DefaultReturnCarrier = "UPS"
+
+// defaultDeliveryDays matches the estimated delivery of new shipments
+const defaultDeliveryDays = 3
+
 type ShippingService struct {
-	repo   ShipmentRepository
-	logger *logger.Logger
+	repo      ShipmentRepository
+	publisher ShipmentEventPublisher
+	logger    *logger.Logger
+	now       func() time.Time
 }
 
-func NewShippingService(repo ShipmentRepository, logger *logger.Logger) *ShippingService {
+func NewShippingService(repo ShipmentRepository, publisher ShipmentEventPublisher, logger *logger.Logger) *ShippingService {
 	return &ShippingService{
-		repo:   repo,
-		logger: logger,
+		repo:      repo,
+		publisher: publisher,
+		logger:    logger,
+		now:       time.Now,
 	}
 }
 
-// CreateShipment creates a new shipment (Command)
-func (s *ShippingService) CreateShipment(ctx context.Context, orderID, carrier, originAddr, destAddr string, weight float64) (*domain.Shipment, error) {
-	shipment, err := domain.NewShipment(orderID, carrier, originAddr, destAddr, weight)
-	if err != nil {
+// CreateShipment creates the outbound shipment of an order, or of one
+// seller's sub-order, and announces it as ShipmentCreated (Command). It gets
+// one shipment; creating it again returns the first one and announces it
+// again, so a call that failed to announce can be retried.
+func (s *ShippingService) CreateShipment(ctx context.Context, orderID, subOrderID, carrier, originAddr, destAddr string, weight float64) (*domain.Shipment, error) {
+	shipment, err := s.repo.FindOutbound(ctx, orderID, subOrderID)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+
+	if shipment == nil {
+		shipment, err = domain.NewShipment(orderID, subOrderID, carrier, originAddr, destAddr, weight)
+		if err != nil {
+			return nil, err
+		}
+
+		// Calculate shipping cost based on carrier and weight
+		cost := s.calculateShippingCost(carrier, weight)
+		shipment.SetShippingCost(cost)
+
+		if err := s.repo.Save(ctx, shipment); err != nil {
+			if !isConflict(err) {
+				s.logger.Error(err, "failed to save shipment")
+				return nil, err
+			}
+			// Booked by a concurrent retry
+			if shipment, err = s.repo.FindOutbound(ctx, orderID, subOrderID); err != nil {
+				return nil, err
+			}
+		} else {
+			s.logger.Infof("Shipment created: order=%s, sub_order=%s, carrier=%s, tracking=%s", orderID, subOrderID, carrier, shipment.TrackingNumber)
+		}
+	}
+
+	if err := s.publish(ctx, shipment, domain.ShipmentEventCreated); err != nil {
+		return nil, err
+	}
+	return shipment, nil
+}
+
+// CreateReturnShipment books the reverse shipment of a return (Command)
+// A return gets one shipment; booking it again returns the first one
+func (s *ShippingService) CreateReturnShipment(ctx context.Context, orderID, returnID, carrier, originAddr, destAddr string) (*domain.Shipment, error) {
+	if existing, err := s.repo.FindByReturnID(ctx, returnID); err == nil {
+		return existing, nil
+	} else if !isNotFound(err) {
 		return nil, err
 	}
 
-	// Calculate shipping cost based on carrier and weight
-	cost := s.calculateShippingCost(carrier, weight)
-	shipment.SetShippingCost(cost)
+	if carrier == "" {
+		carrier = DefaultReturnCarrier
+	}
+	shipment, err := domain.NewReturnShipment(orderID, returnID, carrier, originAddr, destAddr)
+	if err != nil {
+		return nil, err
+	}
+	// Billed at the base rate; the parcel is weighed at pickup
+	shipment.SetShippingCost(s.calculateShippingCost(carrier, 0))
 
 	if err := s.repo.Save(ctx, shipment); err != nil {
-		s.logger.Error(err, "failed to save shipment")
+		if isConflict(err) {
+			// Booked by a concurrent retry
+			return s.repo.FindByReturnID(ctx, returnID)
+		}
+		s.logger.Error(err, "failed to save return shipment")
 		return nil, err
 	}
 
-	s.logger.Infof("Shipment created: order=%s, carrier=%s, tracking=%s", orderID, carrier, shipment.TrackingNumber)
+	s.logger.Infof("Return shipment created: order=%s, return=%s, tracking=%s", orderID, returnID, shipment.TrackingNumber)
 	return shipment, nil
 }
 
@@ -51,23 +123,51 @@ func (s *ShippingService) GetShipment(ctx context.Context, shipmentID string) (*
 	return s.repo.FindByID(ctx, shipmentID)
 }
 
-// UpdateStatus updates shipment status (Command)
+// UpdateStatus updates shipment status (Command). An outbound shipment set
+// to DELIVERED is announced as ShipmentDelivered, again on every retry.
 func (s *ShippingService) UpdateStatus(ctx context.Context, shipmentID string, status domain.ShipmentStatus) (*domain.Shipment, error) {
 	shipment, err := s.repo.FindByID(ctx, shipmentID)
 	if err != nil {
 		return nil, err
 	}
 
-	shipment.UpdateStatus(status)
+	if shipment.Status != status {
+		shipment.UpdateStatus(status)
 
-	if err := s.repo.Update(ctx, shipment); err != nil {
-		return nil, err
+		if err := s.repo.Update(ctx, shipment); err != nil {
+			return nil, err
+		}
+
+		s.logger.Infof("Shipment status updated: shipment=%s, status=%s", shipmentID, status)
 	}
 
-	s.logger.Infof("Shipment status updated: shipment=%s, status=%s", shipmentID, status)
+	if status == domain.ShipmentStatusDelivered {
+		if err := s.publish(ctx, shipment, domain.ShipmentEventDelivered); err != nil {
+			return nil, err
+		}
+	}
 	return shipment, nil
 }
 
+// publish announces an outbound shipment's progress. It runs after the
+// shipment is saved, so a failure is returned for the caller to retry.
+// Reverse shipments are not announced; order-service tracks returns itself.
+func (s *ShippingService) publish(ctx context.Context, shipment *domain.Shipment, eventType domain.ShipmentEventType) error {
+	if shipment.IsReturn() {
+		return nil
+	}
+	if err := s.publisher.Publish(ctx, shipment.Event(eventType, s.now())); err != nil {
+		s.logger.Errorf(err, "Failed to publish %s: shipment=%s, order=%s", eventType, shipment.ID, shipment.OrderID)
+		return err
+	}
+	return nil
+}
+
+// CalculateShippingCost quotes a carrier's cost and delivery time (Query)
+func (s *ShippingService) CalculateShippingCost(carrier string, weight float64) (float64, int) {
+	return s.calculateShippingCost(carrier, weight), defaultDeliveryDays
+}
+
 // Simple cost calculation - in production, integrate with carrier APIs
 func (s *ShippingService) calculateShippingCost(carrier string, weight float64) float64 {
 	baseCost := 5.0
@@ -84,3 +184,13 @@ func (s *ShippingService) calculateShippingCost(carrier string, weight float64)
 		return baseCost + (weight * perKgCost)
 	}
 }
+
+func isNotFound(err error) bool {
+	appErr, ok := err.(*errors.AppError)
+	return ok && appErr.Code == errors.ErrNotFound
+}
+
+func isConflict(err error) bool {
+	appErr, ok := err.(*errors.AppError)
+	return ok && appErr.Code == errors.ErrConflict
+}
@@ -0,0 +1,35 @@
+package domain
+
+import "time"
+
+// ShipmentEventType names what a shipment event reports
+type ShipmentEventType string
+
+const (
+	ShipmentEventCreated   ShipmentEventType = "ShipmentCreated"
+	ShipmentEventDelivered ShipmentEventType = "ShipmentDelivered"
+)
+
+// ShipmentEvent tells other services about an outbound shipment, e.g.
+// order-service that an order shipped or was delivered
+type ShipmentEvent struct {
+	Type           ShipmentEventType `json:"type"`
+	ShipmentID     string            `json:"shipment_id"`
+	OrderID        string            `json:"order_id"`
+	SubOrderID     string            `json:"sub_order_id,omitempty"`
+	Carrier        string            `json:"carrier"`
+	TrackingNumber string            `json:"tracking_number"`
+	OccurredAt     time.Time         `json:"occurred_at"`
+}
+
+func (s *Shipment) Event(eventType ShipmentEventType, now time.Time) *ShipmentEvent {
+	return &ShipmentEvent{
+		Type:           eventType,
+		ShipmentID:     s.ID,
+		OrderID:        s.OrderID,
+		SubOrderID:     s.SubOrderID,
+		Carrier:        s.Carrier,
+		TrackingNumber: s.TrackingNumber,
+		OccurredAt:     now,
+	}
+}
@@ -21,6 +21,7 @@ const (
 type Shipment struct {
 	ID                 string
 	OrderID            string
+	SubOrderID         string // Set when one seller's sub-order ships on its own
 	Carrier            string // DHL, FedEx, UPS, etc.
 	TrackingNumber     string
 	Status             ShipmentStatus
@@ -28,12 +29,15 @@ type Shipment struct {
 	DestinationAddress string
 	Weight             float64
 	ShippingCost       float64
+	ReturnID           string // Set on reverse shipments, one per return
 	EstimatedDelivery  time.Time
 	CreatedAt          time.Time
 	UpdatedAt          time.Time
 }
 
-func NewShipment(orderID, carrier, originAddr, destAddr string, weight float64) (*Shipment, error) {
+// NewShipment books an order's outbound shipment, or that of one seller's
+// sub-order when subOrderID is set
+func NewShipment(orderID, subOrderID, carrier, originAddr, destAddr string, weight float64) (*Shipment, error) {
 	if orderID == "" {
 		return nil, errors.New(errors.ErrInvalidInput, "order ID is required")
 	}
@@ -45,6 +49,7 @@ func NewShipment(orderID, carrier, originAddr, destAddr string, weight float64)
 	return &Shipment{
 		ID:                 uuid.New().String(),
 		OrderID:            orderID,
+		SubOrderID:         subOrderID,
 		Carrier:            carrier,
 		TrackingNumber:     generateTrackingNumber(),
 		Status:             ShipmentStatusPending,
@@ -57,6 +62,38 @@ func NewShipment(orderID, carrier, originAddr, destAddr string, weight float64)
 	}, nil
 }
 
+// NewReturnShipment books the reverse shipment of an order return, from the
+// buyer back to the returns address. Its weight is unknown until the carrier
+// picks it up.
+func NewReturnShipment(orderID, returnID, carrier, originAddr, destAddr string) (*Shipment, error) {
+	if orderID == "" {
+		return nil, errors.New(errors.ErrInvalidInput, "order ID is required")
+	}
+	if returnID == "" {
+		return nil, errors.New(errors.ErrInvalidInput, "return ID is required")
+	}
+
+	now := time.Now()
+	return &Shipment{
+		ID:                 uuid.New().String(),
+		OrderID:            orderID,
+		Carrier:            carrier,
+		TrackingNumber:     generateTrackingNumber(),
+		Status:             ShipmentStatusPending,
+		OriginAddress:      originAddr,
+		DestinationAddress: destAddr,
+		ReturnID:           returnID,
+		EstimatedDelivery:  now.Add(72 * time.Hour),
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}, nil
+}
+
+// IsReturn reports whether this is the reverse shipment of a return
+func (s *Shipment) IsReturn() bool {
+	return s.ReturnID != ""
+}
+
 func (s *Shipment) UpdateStatus(status ShipmentStatus) {
 	s.Status = status
 	s.UpdatedAt = time.Now()
@@ -1,133 +1,146 @@
 package postgres
-}
-	return err
 
-	)
-		shipment.ID,
-		shipment.UpdatedAt,
-		shipment.EstimatedDelivery,
-		shipment.ShippingCost,
-		shipment.Status,
-	_, err := r.db.ExecContext(ctx, query,
+import (
+	"context"
+	"database/sql"
+	stderrors "errors"
 
-	`
-		WHERE shipment_id = $5
-		SET status = $1, shipping_cost = $2, estimated_delivery = $3, updated_at = $4
-		UPDATE shipments
-	query := `
-func (r *ShipmentRepository) Update(ctx context.Context, shipment *domain.Shipment) error {
+	"github.com/lib/pq"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/shipping-service/internal/domain"
+)
+
+const shipmentColumns = `
+	shipment_id, order_id, carrier, tracking_number, status,
+	origin_address, destination_address, weight, shipping_cost,
+	estimated_delivery, created_at, updated_at, return_id, sub_order_id
+`
 
+type ShipmentRepository struct {
+	db *sql.DB
 }
-	return &shipment, nil
 
+func NewShipmentRepository(db *sql.DB) *ShipmentRepository {
+	return &ShipmentRepository{db: db}
+}
+
+// Save records a new shipment. A second reverse shipment for the same
+// return, or outbound shipment for the same sub-order, fails with
+// ErrConflict.
+func (r *ShipmentRepository) Save(ctx context.Context, shipment *domain.Shipment) error {
+	query := `
+		INSERT INTO shipments (` + shipmentColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		shipment.ID,
+		shipment.OrderID,
+		shipment.Carrier,
+		shipment.TrackingNumber,
+		shipment.Status,
+		shipment.OriginAddress,
+		shipment.DestinationAddress,
+		shipment.Weight,
+		shipment.ShippingCost,
+		shipment.EstimatedDelivery,
+		shipment.CreatedAt,
+		shipment.UpdatedAt,
+		sql.NullString{String: shipment.ReturnID, Valid: shipment.ReturnID != ""},
+		sql.NullString{String: shipment.SubOrderID, Valid: shipment.SubOrderID != ""},
+	)
+	if isUniqueViolation(err) {
+		return errors.New(errors.ErrConflict, "a shipment is already booked for this return or sub-order")
 	}
-		return nil, err
 	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to save shipment", err)
 	}
-		return nil, errors.New(errors.ErrNotFound, "shipment not found")
-	if err == sql.ErrNoRows {
+	return nil
+}
 
-	)
-		&shipment.UpdatedAt,
-		&shipment.CreatedAt,
-		&shipment.EstimatedDelivery,
-		&shipment.ShippingCost,
-		&shipment.Weight,
-		&shipment.DestinationAddress,
-		&shipment.OriginAddress,
-		&shipment.Status,
-		&shipment.TrackingNumber,
-		&shipment.Carrier,
-		&shipment.OrderID,
-		&shipment.ID,
-	err := r.db.QueryRowContext(ctx, query, orderID).Scan(
-	var shipment domain.Shipment
+func (r *ShipmentRepository) FindByID(ctx context.Context, shipmentID string) (*domain.Shipment, error) {
+	return r.findOne(ctx, `WHERE shipment_id = $1`, shipmentID)
+}
 
-	`
-		WHERE order_id = $1
-		FROM shipments
-			estimated_delivery, created_at, updated_at
-			origin_address, destination_address, weight, shipping_cost,
-		SELECT shipment_id, order_id, carrier, tracking_number, status,
-	query := `
+// FindByOrderID returns the order's outbound shipment
 func (r *ShipmentRepository) FindByOrderID(ctx context.Context, orderID string) (*domain.Shipment, error) {
+	return r.findOne(ctx, `WHERE order_id = $1 AND return_id IS NULL ORDER BY created_at DESC LIMIT 1`, orderID)
+}
 
+// FindOutbound returns the outbound shipment of the order, or of one of its
+// sub-orders when subOrderID is set. Whole-order shipments have no
+// sub-order.
+func (r *ShipmentRepository) FindOutbound(ctx context.Context, orderID, subOrderID string) (*domain.Shipment, error) {
+	return r.findOne(ctx, `WHERE order_id = $1 AND COALESCE(sub_order_id, '') = $2 AND return_id IS NULL
+		ORDER BY created_at LIMIT 1`, orderID, subOrderID)
 }
-	return &shipment, nil
 
+// FindByReturnID returns the reverse shipment booked for a return
+func (r *ShipmentRepository) FindByReturnID(ctx context.Context, returnID string) (*domain.Shipment, error) {
+	return r.findOne(ctx, `WHERE return_id = $1`, returnID)
+}
+
+func (r *ShipmentRepository) findOne(ctx context.Context, where string, args ...interface{}) (*domain.Shipment, error) {
+	query := `SELECT ` + shipmentColumns + ` FROM shipments ` + where
+
+	var shipment domain.Shipment
+	var weight, cost sql.NullFloat64
+	var origin, destination, returnID, subOrderID sql.NullString
+	var estimated sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(
+		&shipment.ID,
+		&shipment.OrderID,
+		&shipment.Carrier,
+		&shipment.TrackingNumber,
+		&shipment.Status,
+		&origin,
+		&destination,
+		&weight,
+		&cost,
+		&estimated,
+		&shipment.CreatedAt,
+		&shipment.UpdatedAt,
+		&returnID,
+		&subOrderID,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errors.New(errors.ErrNotFound, "shipment not found")
 	}
-		return nil, err
 	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to find shipment", err)
 	}
-		return nil, errors.New(errors.ErrNotFound, "shipment not found")
-	if err == sql.ErrNoRows {
 
-	)
-		&shipment.UpdatedAt,
-		&shipment.CreatedAt,
-		&shipment.EstimatedDelivery,
-		&shipment.ShippingCost,
-		&shipment.Weight,
-		&shipment.DestinationAddress,
-		&shipment.OriginAddress,
-		&shipment.Status,
-		&shipment.TrackingNumber,
-		&shipment.Carrier,
-		&shipment.OrderID,
-		&shipment.ID,
-	err := r.db.QueryRowContext(ctx, query, shipmentID).Scan(
-	var shipment domain.Shipment
+	shipment.OriginAddress = origin.String
+	shipment.DestinationAddress = destination.String
+	shipment.Weight = weight.Float64
+	shipment.ShippingCost = cost.Float64
+	shipment.EstimatedDelivery = estimated.Time
+	shipment.ReturnID = returnID.String
+	shipment.SubOrderID = subOrderID.String
+	return &shipment, nil
+}
 
-	`
-		WHERE shipment_id = $1
-		FROM shipments
-			estimated_delivery, created_at, updated_at
-			origin_address, destination_address, weight, shipping_cost,
-		SELECT shipment_id, order_id, carrier, tracking_number, status,
+func (r *ShipmentRepository) Update(ctx context.Context, shipment *domain.Shipment) error {
 	query := `
-func (r *ShipmentRepository) FindByID(ctx context.Context, shipmentID string) (*domain.Shipment, error) {
-
-}
-	return err
+		UPDATE shipments
+		SET status = $1, shipping_cost = $2, estimated_delivery = $3, updated_at = $4
+		WHERE shipment_id = $5
+	`
 
-	)
-		shipment.UpdatedAt,
-		shipment.CreatedAt,
-		shipment.EstimatedDelivery,
-		shipment.ShippingCost,
-		shipment.Weight,
-		shipment.DestinationAddress,
-		shipment.OriginAddress,
+	_, err := r.db.ExecContext(ctx, query,
 		shipment.Status,
-		shipment.TrackingNumber,
-		shipment.Carrier,
-		shipment.OrderID,
+		shipment.ShippingCost,
+		shipment.EstimatedDelivery,
+		shipment.UpdatedAt,
 		shipment.ID,
-	_, err := r.db.ExecContext(ctx, query,
-
-	`
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
-			estimated_delivery, created_at, updated_at
-			origin_address, destination_address, weight, shipping_cost,
-			shipment_id, order_id, carrier, tracking_number, status,
-		INSERT INTO shipments (
-	query := `
-func (r *ShipmentRepository) Save(ctx context.Context, shipment *domain.Shipment) error {
-
+	)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to update shipment", err)
+	}
+	return nil
 }
-	return &ShipmentRepository{db: db}
-func NewShipmentRepository(db *sql.DB) *ShipmentRepository {
 
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return stderrors.As(err, &pqErr) && pqErr.Code == "23505"
 }
-	db *sql.DB
-type ShipmentRepository struct {
-
-)
-	"github.com/titan-commerce/backend/pkg/errors"
-	"github.com/titan-commerce/backend/shipping-service/internal/domain"
-
-	"database/sql"
-	"context"
-import (
-
-
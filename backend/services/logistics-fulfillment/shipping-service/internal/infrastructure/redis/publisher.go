@@ -0,0 +1,59 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/shipping-service/internal/domain"
+)
+
+const (
+	// ShipmentEventsStream is read by order-service with a consumer group
+	ShipmentEventsStream = "shipment_events"
+	shipmentEventsMaxLen = 100000
+)
+
+// RedisShipmentEventPublisher appends shipment events to a Redis stream
+type RedisShipmentEventPublisher struct {
+	client *redis.Client
+}
+
+func NewRedisShipmentEventPublisher(addr, password string) (*RedisShipmentEventPublisher, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to connect to Redis", err)
+	}
+
+	return &RedisShipmentEventPublisher{client: client}, nil
+}
+
+func (p *RedisShipmentEventPublisher) Publish(ctx context.Context, event *domain.ShipmentEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to marshal shipment event", err)
+	}
+
+	err = p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: ShipmentEventsStream,
+		MaxLen: shipmentEventsMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"type":     string(event.Type),
+			"order_id": event.OrderID,
+			"event":    data,
+		},
+	}).Err()
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to publish shipment event", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+	"github.com/titan-commerce/backend/shipping-service/internal/application"
+	"github.com/titan-commerce/backend/shipping-service/internal/domain"
+	pb "github.com/titan-commerce/backend/shipping-service/proto/shipping/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var statusToProto = map[domain.ShipmentStatus]pb.ShipmentStatus{
+	domain.ShipmentStatusPending:        pb.ShipmentStatus_SHIPMENT_STATUS_PENDING,
+	domain.ShipmentStatusPickedUp:       pb.ShipmentStatus_SHIPMENT_STATUS_PICKED_UP,
+	domain.ShipmentStatusInTransit:      pb.ShipmentStatus_SHIPMENT_STATUS_IN_TRANSIT,
+	domain.ShipmentStatusOutForDelivery: pb.ShipmentStatus_SHIPMENT_STATUS_OUT_FOR_DELIVERY,
+	domain.ShipmentStatusDelivered:      pb.ShipmentStatus_SHIPMENT_STATUS_DELIVERED,
+	domain.ShipmentStatusReturned:       pb.ShipmentStatus_SHIPMENT_STATUS_RETURNED,
+}
+
+type ShippingServiceServer struct {
+	pb.UnimplementedShippingServiceServer
+	service *application.ShippingService
+	logger  *logger.Logger
+}
+
+func NewShippingServiceServer(service *application.ShippingService, logger *logger.Logger) *ShippingServiceServer {
+	return &ShippingServiceServer{
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (s *ShippingServiceServer) CreateShipment(ctx context.Context, req *pb.CreateShipmentRequest) (*pb.CreateShipmentResponse, error) {
+	shipment, err := s.service.CreateShipment(ctx, req.OrderId, req.SubOrderId, req.Carrier, req.OriginAddress, req.DestinationAddress, req.Weight)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.CreateShipmentResponse{Shipment: domainToProto(shipment)}, nil
+}
+
+func (s *ShippingServiceServer) CreateReturnShipment(ctx context.Context, req *pb.CreateReturnShipmentRequest) (*pb.CreateReturnShipmentResponse, error) {
+	shipment, err := s.service.CreateReturnShipment(ctx, req.OrderId, req.ReturnId, req.Carrier, req.OriginAddress, req.DestinationAddress)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.CreateReturnShipmentResponse{Shipment: domainToProto(shipment)}, nil
+}
+
+func (s *ShippingServiceServer) GetShipment(ctx context.Context, req *pb.GetShipmentRequest) (*pb.GetShipmentResponse, error) {
+	shipment, err := s.service.GetShipment(ctx, req.ShipmentId)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.GetShipmentResponse{Shipment: domainToProto(shipment)}, nil
+}
+
+func (s *ShippingServiceServer) UpdateStatus(ctx context.Context, req *pb.UpdateStatusRequest) (*pb.UpdateStatusResponse, error) {
+	newStatus, ok := statusFromProto(req.Status)
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "unknown shipment status")
+	}
+
+	shipment, err := s.service.UpdateStatus(ctx, req.ShipmentId, newStatus)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.UpdateStatusResponse{Shipment: domainToProto(shipment)}, nil
+}
+
+func (s *ShippingServiceServer) CalculateShippingCost(ctx context.Context, req *pb.CalculateShippingCostRequest) (*pb.CalculateShippingCostResponse, error) {
+	cost, days := s.service.CalculateShippingCost(req.Carrier, req.Weight)
+	return &pb.CalculateShippingCostResponse{Cost: cost, EstimatedDays: int32(days)}, nil
+}
+
+func domainToProto(shipment *domain.Shipment) *pb.Shipment {
+	return &pb.Shipment{
+		ShipmentId:         shipment.ID,
+		OrderId:            shipment.OrderID,
+		Carrier:            shipment.Carrier,
+		TrackingNumber:     shipment.TrackingNumber,
+		Status:             statusToProto[shipment.Status],
+		OriginAddress:      shipment.OriginAddress,
+		DestinationAddress: shipment.DestinationAddress,
+		Weight:             shipment.Weight,
+		ShippingCost:       shipment.ShippingCost,
+		EstimatedDelivery:  timestamppb.New(shipment.EstimatedDelivery),
+		CreatedAt:          timestamppb.New(shipment.CreatedAt),
+		ReturnId:           shipment.ReturnID,
+		SubOrderId:         shipment.SubOrderID,
+	}
+}
+
+func statusFromProto(s pb.ShipmentStatus) (domain.ShipmentStatus, bool) {
+	for domainStatus, value := range statusToProto {
+		if value == s {
+			return domainStatus, true
+		}
+	}
+	return "", false
+}
+
+func toStatus(err error) error {
+	if appErr, ok := err.(*errors.AppError); ok {
+		return appErr.ToGRPCError()
+	}
+	return status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_shipments_return;
+ALTER TABLE shipments DROP COLUMN IF EXISTS return_id;
@@ -0,0 +1,5 @@
+-- Reverse shipments of order returns, one per return
+
+ALTER TABLE shipments ADD COLUMN IF NOT EXISTS return_id VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_shipments_return ON shipments(return_id) WHERE return_id IS NOT NULL;
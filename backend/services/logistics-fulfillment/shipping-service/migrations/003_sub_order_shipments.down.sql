@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_shipments_sub_order;
+ALTER TABLE shipments DROP COLUMN IF EXISTS sub_order_id;
@@ -0,0 +1,5 @@
+-- Outbound shipments of one seller's sub-order, one per sub-order
+
+ALTER TABLE shipments ADD COLUMN IF NOT EXISTS sub_order_id VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_shipments_sub_order ON shipments(sub_order_id) WHERE sub_order_id IS NOT NULL AND return_id IS NULL;
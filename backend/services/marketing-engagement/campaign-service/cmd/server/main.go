@@ -13,6 +13,7 @@ import (
 	"github.com/titan-commerce/backend/campaign-service/internal/domain"
 	"github.com/titan-commerce/backend/campaign-service/internal/infrastructure/postgres"
 	"github.com/titan-commerce/backend/pkg/config"
+	"github.com/titan-commerce/backend/pkg/errors"
 	"github.com/titan-commerce/backend/pkg/logger"
 )
 
@@ -76,6 +77,36 @@ func main() {
 		}
 	})
 
+	// Pricing rules of the running campaigns for some products, e.g. for
+	// checkout to price a cart: /api/v1/campaigns/pricing?product_id=a&product_id=b
+	http.HandleFunc("/api/v1/campaigns/pricing", func(w http.ResponseWriter, r *http.Request) {
+		campaigns, err := campaignService.GetPricingCampaigns(r.Context(), r.URL.Query()["product_id"])
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		rules := make([]map[string]interface{}, len(campaigns))
+		for i, c := range campaigns {
+			rules[i] = map[string]interface{}{
+				"campaign_id":      c.ID,
+				"name":             c.Name,
+				"type":             c.Type,
+				"products":         c.Products,
+				"discount_percent": c.Rules.DiscountPercent,
+				"min_purchase":     c.Rules.MinPurchase,
+				"max_discount":     c.Rules.MaxDiscount,
+				"bundle_products":  c.Rules.BundleProducts,
+				"bundle_price":     c.Rules.BundlePrice,
+				"buy_quantity":     c.Rules.BuyQuantity,
+				"get_quantity":     c.Rules.GetQuantity,
+				"get_product_id":   c.Rules.GetProductID,
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rules)
+	})
+
 	// Get campaign stats
 	http.HandleFunc("/api/v1/campaigns/stats", func(w http.ResponseWriter, r *http.Request) {
 		campaignID := r.URL.Query().Get("campaign_id")
@@ -115,3 +146,14 @@ func main() {
 
 	log.Info("Shutting down Campaign Service")
 }
+
+// writeError answers with the error's HTTP status, or 500 if it has none
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if appErr, ok := err.(*errors.AppError); ok {
+		status = appErr.HTTPStatus
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
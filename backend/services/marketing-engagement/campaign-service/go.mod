@@ -3,6 +3,7 @@ module github.com/titan-commerce/backend/campaign-service
 go 1.23
 
 require (
+	github.com/google/uuid v1.3.1
 	github.com/lib/pq v1.10.9
 	github.com/titan-commerce/backend/pkg v0.0.0
 )
@@ -164,6 +164,24 @@ func (s *CampaignService) GetActiveCampaigns(ctx context.Context) ([]*domain.Cam
 	return s.repo.FindActive(ctx)
 }
 
+// GetPricingCampaigns returns the running campaigns that may change the
+// price of any of the products: those featuring one of them, and those
+// featuring no product, which apply to every product
+func (s *CampaignService) GetPricingCampaigns(ctx context.Context, productIDs []string) ([]*domain.Campaign, error) {
+	campaigns, err := s.repo.FindActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*domain.Campaign
+	for _, campaign := range campaigns {
+		if campaign.IsActive() && campaign.Features(productIDs) {
+			result = append(result, campaign)
+		}
+	}
+	return result, nil
+}
+
 // GetCampaignsForProduct returns campaigns applicable to a product
 func (s *CampaignService) GetCampaignsForProduct(ctx context.Context, productID string) ([]*domain.Campaign, error) {
 	return s.repo.FindByProduct(ctx, productID)
@@ -113,6 +113,22 @@ func (c *Campaign) SetRules(rules CampaignRules) {
 	c.UpdatedAt = time.Now()
 }
 
+// Features tells whether the campaign applies to any of the products. A
+// campaign featuring no product applies to every product.
+func (c *Campaign) Features(productIDs []string) bool {
+	if len(c.Products) == 0 {
+		return true
+	}
+	for _, featured := range c.Products {
+		for _, productID := range productIDs {
+			if featured == productID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (c *Campaign) AddProducts(productIDs []string) {
 	c.Products = append(c.Products, productIDs...)
 	c.UpdatedAt = time.Now()
@@ -11,6 +11,7 @@ import (
 	"github.com/titan-commerce/backend/coupon-service/internal/application"
 	"github.com/titan-commerce/backend/coupon-service/internal/infrastructure/postgres"
 	"github.com/titan-commerce/backend/pkg/config"
+	"github.com/titan-commerce/backend/pkg/errors"
 	"github.com/titan-commerce/backend/pkg/logger"
 )
 
@@ -55,8 +56,7 @@ func main() {
 
 		coupon, discount, err := couponService.ValidateCoupon(r.Context(), req.Code, req.UserID, req.OrderValue, req.Categories, req.Products)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			writeError(w, err)
 			return
 		}
 
@@ -84,8 +84,7 @@ func main() {
 
 		discount, err := couponService.ApplyCoupon(r.Context(), req.Code, req.UserID, req.OrderID, req.OrderValue)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			writeError(w, err)
 			return
 		}
 
@@ -93,6 +92,49 @@ func main() {
 		json.NewEncoder(w).Encode(map[string]float64{"discount": discount})
 	})
 
+	// Look up a coupon's terms for a user, e.g. for checkout to price a cart
+	http.HandleFunc("/api/v1/coupons/lookup", func(w http.ResponseWriter, r *http.Request) {
+		coupon, err := couponService.LookupCoupon(r.Context(), r.URL.Query().Get("code"), r.URL.Query().Get("user_id"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"code":                  coupon.Code,
+			"type":                  coupon.Type,
+			"value":                 coupon.Value,
+			"min_order_value":       coupon.MinOrderValue,
+			"max_discount":          coupon.MaxDiscount,
+			"applicable_products":   coupon.ApplicableProducts,
+			"applicable_categories": coupon.ApplicableCategories,
+		})
+	})
+
+	// Release a coupon applied to an order that was not placed
+	http.HandleFunc("/api/v1/coupons/release", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			Code    string `json:"code"`
+			UserID  string `json:"user_id"`
+			OrderID string `json:"order_id"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		if err := couponService.ReleaseCoupon(r.Context(), req.Code, req.UserID, req.OrderID); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"success": true})
+	})
+
 	// List active coupons
 	http.HandleFunc("/api/v1/coupons", func(w http.ResponseWriter, r *http.Request) {
 		coupons, _ := couponService.GetActiveCoupons(r.Context())
@@ -114,3 +156,14 @@ func main() {
 
 	log.Info("Shutting down Coupon Service")
 }
+
+// writeError answers with the error's HTTP status, or 500 if it has none
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if appErr, ok := err.(*errors.AppError); ok {
+		status = appErr.HTTPStatus
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
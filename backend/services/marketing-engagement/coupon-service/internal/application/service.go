@@ -19,6 +19,9 @@ type CouponRepository interface {
 	FindActive(ctx context.Context) ([]*domain.Coupon, error)
 	SaveUsage(ctx context.Context, usage *domain.CouponUsage) error
 	GetUserUsage(ctx context.Context, couponID, userID string) (int, error)
+	// FindUsage returns the coupon's use by the order, or nil
+	FindUsage(ctx context.Context, couponID, orderID string) (*domain.CouponUsage, error)
+	DeleteUsage(ctx context.Context, usageID string) error
 }
 
 type CouponService struct {
@@ -64,18 +67,43 @@ func (s *CouponService) GetCouponByCode(ctx context.Context, code string) (*doma
 	return s.repo.FindByCode(ctx, code)
 }
 
-// ValidateCoupon validates a coupon for a user and order
-func (s *CouponService) ValidateCoupon(ctx context.Context, code, userID string, orderValue float64, categoryIDs, productIDs []string) (*domain.Coupon, float64, error) {
+// LookupCoupon returns a coupon the user can still use, whatever the order.
+// Checkout prices the order against its terms itself.
+func (s *CouponService) LookupCoupon(ctx context.Context, code, userID string) (*domain.Coupon, error) {
 	code = strings.ToUpper(strings.TrimSpace(code))
-	
+
 	coupon, err := s.repo.FindByCode(ctx, code)
 	if err != nil {
-		return nil, 0, errors.New(errors.ErrNotFound, "coupon not found")
+		return nil, err
+	}
+	if coupon == nil {
+		return nil, errors.New(errors.ErrNotFound, "coupon not found")
 	}
 
 	// Check validity
 	if !coupon.IsValid() {
-		return nil, 0, errors.New(errors.ErrInvalidInput, "coupon is not valid")
+		return nil, errors.New(errors.ErrInvalidInput, "coupon is not valid")
+	}
+
+	// Check user usage limit
+	usageCount, err := s.repo.GetUserUsage(ctx, coupon.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if usageCount >= coupon.MaxPerUser {
+		return nil, errors.New(errors.ErrInvalidInput, "coupon usage limit reached")
+	}
+
+	return coupon, nil
+}
+
+// ValidateCoupon validates a coupon for a user and order
+func (s *CouponService) ValidateCoupon(ctx context.Context, code, userID string, orderValue float64, categoryIDs, productIDs []string) (*domain.Coupon, float64, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	
+	coupon, err := s.LookupCoupon(ctx, code, userID)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	// Check minimum order
@@ -83,12 +111,6 @@ func (s *CouponService) ValidateCoupon(ctx context.Context, code, userID string,
 		return nil, 0, errors.New(errors.ErrInvalidInput, "order value below minimum")
 	}
 
-	// Check user usage limit
-	usageCount, _ := s.repo.GetUserUsage(ctx, coupon.ID, userID)
-	if usageCount >= coupon.MaxPerUser {
-		return nil, 0, errors.New(errors.ErrInvalidInput, "coupon usage limit reached")
-	}
-
 	// Check applicable categories
 	if len(coupon.ApplicableCategories) > 0 {
 		found := false
@@ -127,12 +149,33 @@ func (s *CouponService) ValidateCoupon(ctx context.Context, code, userID string,
 	return coupon, discount, nil
 }
 
-// ApplyCoupon applies a coupon to an order
+// ApplyCoupon applies a coupon to an order. Applying it to the same order
+// again returns the discount already given.
 func (s *CouponService) ApplyCoupon(ctx context.Context, code, userID, orderID string, orderValue float64) (float64, error) {
-	coupon, discount, err := s.ValidateCoupon(ctx, code, userID, orderValue, nil, nil)
+	coupon, err := s.repo.FindByCode(ctx, strings.ToUpper(strings.TrimSpace(code)))
+	if err != nil {
+		return 0, err
+	}
+	if coupon != nil {
+		usage, err := s.repo.FindUsage(ctx, coupon.ID, orderID)
+		if err != nil {
+			return 0, err
+		}
+		if usage != nil {
+			s.logger.Infof("Coupon %s already applied to order %s", code, orderID)
+			return usage.Discount, nil
+		}
+	}
+
+	// Checkout checked the products and categories when it priced the order
+	coupon, err = s.LookupCoupon(ctx, code, userID)
 	if err != nil {
 		return 0, err
 	}
+	if orderValue < coupon.MinOrderValue {
+		return 0, errors.New(errors.ErrInvalidInput, "order value below minimum")
+	}
+	discount := coupon.CalculateDiscount(orderValue)
 
 	// Mark coupon as used
 	coupon.Use()
@@ -140,7 +183,7 @@ func (s *CouponService) ApplyCoupon(ctx context.Context, code, userID, orderID s
 		return 0, err
 	}
 
-	// Record usage
+	// Record usage; it is what makes a retry find this application
 	usage := &domain.CouponUsage{
 		ID:       uuid.New().String(),
 		CouponID: coupon.ID,
@@ -151,6 +194,7 @@ func (s *CouponService) ApplyCoupon(ctx context.Context, code, userID, orderID s
 	}
 	if err := s.repo.SaveUsage(ctx, usage); err != nil {
 		s.logger.Error(err, "failed to save coupon usage")
+		return 0, err
 	}
 
 	s.logger.Infof("Coupon %s applied: user=%s, order=%s, discount=%.2f", 
@@ -158,6 +202,37 @@ func (s *CouponService) ApplyCoupon(ctx context.Context, code, userID, orderID s
 	return discount, nil
 }
 
+// ReleaseCoupon gives back the use of a coupon by an order that was not
+// placed. Releasing a coupon the order did not use does nothing.
+func (s *CouponService) ReleaseCoupon(ctx context.Context, code, userID, orderID string) error {
+	coupon, err := s.repo.FindByCode(ctx, strings.ToUpper(strings.TrimSpace(code)))
+	if err != nil {
+		return err
+	}
+	if coupon == nil {
+		return errors.New(errors.ErrNotFound, "coupon not found")
+	}
+
+	usage, err := s.repo.FindUsage(ctx, coupon.ID, orderID)
+	if err != nil {
+		return err
+	}
+	if usage == nil || usage.UserID != userID {
+		return nil
+	}
+
+	coupon.Release()
+	if err := s.repo.Update(ctx, coupon); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteUsage(ctx, usage.ID); err != nil {
+		return err
+	}
+
+	s.logger.Infof("Coupon %s released: user=%s, order=%s", code, userID, orderID)
+	return nil
+}
+
 // GetActiveCoupons returns all active coupons
 func (s *CouponService) GetActiveCoupons(ctx context.Context) ([]*domain.Coupon, error) {
 	return s.repo.FindActive(ctx)
@@ -104,6 +104,16 @@ func (c *Coupon) Use() {
 	}
 }
 
+// Release gives back one use, e.g. of a checkout that was given up
+func (c *Coupon) Release() {
+	if c.UsedQuantity > 0 {
+		c.UsedQuantity--
+	}
+	if c.Status == CouponStatusDepleted && c.UsedQuantity < c.TotalQuantity {
+		c.Status = CouponStatusActive
+	}
+}
+
 func (c *Coupon) CheckExpiry() {
 	if time.Now().After(c.ValidUntil) {
 		c.Status = CouponStatusExpired
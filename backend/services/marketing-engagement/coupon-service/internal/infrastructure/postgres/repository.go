@@ -39,3 +39,11 @@ func (r *CouponRepository) SaveUsage(ctx context.Context, usage *domain.CouponUs
 func (r *CouponRepository) GetUserUsage(ctx context.Context, couponID, userID string) (int, error) {
 	return 0, nil
 }
+
+func (r *CouponRepository) FindUsage(ctx context.Context, couponID, orderID string) (*domain.CouponUsage, error) {
+	return nil, nil
+}
+
+func (r *CouponRepository) DeleteUsage(ctx context.Context, usageID string) error {
+	return nil
+}
@@ -94,7 +94,7 @@ func main() {
 		}
 		json.NewDecoder(r.Body).Decode(&req)
 
-		wallet, err := gamificationService.EarnCoins(r.Context(), req.UserID, req.Amount, req.Source, req.Description)
+		wallet, err := gamificationService.EarnCoins(r.Context(), req.UserID, req.Amount, req.Source, req.Description, "")
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
@@ -15,6 +15,7 @@ type GamificationRepository interface {
 	GetWallet(ctx context.Context, userID string) (*domain.CoinWallet, error)
 	SaveWallet(ctx context.Context, wallet *domain.CoinWallet) error
 	SaveTransaction(ctx context.Context, txn *domain.CoinTransaction) error
+	ApplyTransaction(ctx context.Context, txn *domain.CoinTransaction) (*domain.CoinWallet, error)
 	GetTransactions(ctx context.Context, userID string, limit int) ([]*domain.CoinTransaction, error)
 	GetCheckIn(ctx context.Context, userID string) (*domain.DailyCheckIn, error)
 	SaveCheckIn(ctx context.Context, checkIn *domain.DailyCheckIn) error
@@ -52,43 +53,28 @@ func (s *GamificationService) GetBalance(ctx context.Context, userID string) (*d
 	return wallet, nil
 }
 
-// EarnCoins adds coins to user's wallet
-func (s *GamificationService) EarnCoins(ctx context.Context, userID string, amount int, source, description string) (*domain.CoinWallet, error) {
-	wallet, err := s.GetBalance(ctx, userID)
+// EarnCoins adds coins to user's wallet. A retry with the same non-empty
+// referenceID earns nothing more.
+func (s *GamificationService) EarnCoins(ctx context.Context, userID string, amount int, source, description, referenceID string) (*domain.CoinWallet, error) {
+	txn := domain.NewCoinTransaction(userID, amount, domain.CoinTxnEarn, source, description, referenceID)
+	wallet, err := s.repo.ApplyTransaction(ctx, txn)
 	if err != nil {
 		return nil, err
 	}
 
-	wallet.Earn(amount)
-	if err := s.repo.SaveWallet(ctx, wallet); err != nil {
-		return nil, err
-	}
-
-	txn := domain.NewCoinTransaction(userID, amount, domain.CoinTxnEarn, source, description)
-	s.repo.SaveTransaction(ctx, txn)
-
 	s.logger.Infof("User %s earned %d coins from %s", userID, amount, source)
 	return wallet, nil
 }
 
-// SpendCoins deducts coins from user's wallet
-func (s *GamificationService) SpendCoins(ctx context.Context, userID string, amount int, description string) (*domain.CoinWallet, error) {
-	wallet, err := s.GetBalance(ctx, userID)
+// SpendCoins deducts coins from user's wallet. A retry with the same
+// non-empty referenceID spends nothing more.
+func (s *GamificationService) SpendCoins(ctx context.Context, userID string, amount int, description, referenceID string) (*domain.CoinWallet, error) {
+	txn := domain.NewCoinTransaction(userID, amount, domain.CoinTxnSpend, "redeem", description, referenceID)
+	wallet, err := s.repo.ApplyTransaction(ctx, txn)
 	if err != nil {
 		return nil, err
 	}
 
-	if !wallet.Spend(amount) {
-		return nil, errors.New(errors.ErrInsufficientBalance, "not enough coins")
-	}
-
-	if err := s.repo.SaveWallet(ctx, wallet); err != nil {
-		return nil, err
-	}
-
-	txn := domain.NewCoinTransaction(userID, amount, domain.CoinTxnSpend, "redeem", description)
-	s.repo.SaveTransaction(ctx, txn)
-
 	s.logger.Infof("User %s spent %d coins", userID, amount)
 	return wallet, nil
 }
@@ -114,7 +100,7 @@ func (s *GamificationService) DailyCheckIn(ctx context.Context, userID string) (
 
 	// Award coins
 	if reward > 0 {
-		s.EarnCoins(ctx, userID, reward, "check_in", "Daily check-in reward")
+		s.EarnCoins(ctx, userID, reward, "check_in", "Daily check-in reward", "")
 	}
 
 	s.logger.Infof("User %s checked in, streak: %d, reward: %d coins", 
@@ -198,7 +184,7 @@ func (s *GamificationService) ClaimMissionReward(ctx context.Context, userID, mi
 	s.repo.SaveUserMission(ctx, um)
 
 	// Award coins
-	s.EarnCoins(ctx, userID, mission.Reward, "mission", "Mission reward: "+mission.Name)
+	s.EarnCoins(ctx, userID, mission.Reward, "mission", "Mission reward: "+mission.Name, "")
 
 	s.logger.Infof("User %s claimed mission %s reward: %d coins", userID, missionID, mission.Reward)
 	return mission.Reward, nil
@@ -208,7 +194,7 @@ func (s *GamificationService) ClaimMissionReward(ctx context.Context, userID, mi
 func (s *GamificationService) SpinLuckyDraw(ctx context.Context, userID string, spinCost int) (*domain.LuckyDrawResult, error) {
 	// Deduct spin cost
 	if spinCost > 0 {
-		_, err := s.SpendCoins(ctx, userID, spinCost, "Lucky draw spin")
+		_, err := s.SpendCoins(ctx, userID, spinCost, "Lucky draw spin", "")
 		if err != nil {
 			return nil, err
 		}
@@ -237,7 +223,7 @@ func (s *GamificationService) SpinLuckyDraw(ctx context.Context, userID string,
 
 	// Award prize
 	if prize.Type == "coins" && prize.Value > 0 {
-		s.EarnCoins(ctx, userID, prize.Value, "lucky_draw", "Lucky draw prize")
+		s.EarnCoins(ctx, userID, prize.Value, "lucky_draw", "Lucky draw prize", "")
 	}
 
 	s.logger.Infof("User %s won %s from lucky draw", userID, prize.Name)
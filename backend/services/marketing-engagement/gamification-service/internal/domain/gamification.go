@@ -29,6 +29,7 @@ type CoinTransaction struct {
 	Type        CoinTransactionType
 	Source      string // "check_in", "purchase", "game", "mission"
 	Description string
+	ReferenceID string // Caller's ID for the transaction, e.g. a checkout; applied once per type
 	CreatedAt   time.Time
 }
 
@@ -104,7 +105,7 @@ func (w *CoinWallet) Spend(amount int) bool {
 	return true
 }
 
-func NewCoinTransaction(userID string, amount int, txnType CoinTransactionType, source, desc string) *CoinTransaction {
+func NewCoinTransaction(userID string, amount int, txnType CoinTransactionType, source, desc, referenceID string) *CoinTransaction {
 	return &CoinTransaction{
 		ID:          uuid.New().String(),
 		UserID:      userID,
@@ -112,6 +113,7 @@ func NewCoinTransaction(userID string, amount int, txnType CoinTransactionType,
 		Type:        txnType,
 		Source:      source,
 		Description: desc,
+		ReferenceID: referenceID,
 		CreatedAt:   time.Now(),
 	}
 }
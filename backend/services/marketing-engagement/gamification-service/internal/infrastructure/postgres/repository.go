@@ -60,6 +60,8 @@ func (r *GamificationRepository) createTables(ctx context.Context) error {
 			created_at TIMESTAMP NOT NULL DEFAULT NOW()
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_coin_txn_user ON coin_transactions(user_id, created_at DESC)`,
+		`ALTER TABLE coin_transactions ADD COLUMN IF NOT EXISTS reference_id VARCHAR(128) NOT NULL DEFAULT ''`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_coin_txn_reference ON coin_transactions(type, reference_id) WHERE reference_id <> ''`,
 		`CREATE TABLE IF NOT EXISTS daily_checkins (
 			user_id VARCHAR(64) PRIMARY KEY,
 			last_checkin TIMESTAMP NOT NULL,
@@ -144,14 +146,74 @@ func (r *GamificationRepository) SaveWallet(ctx context.Context, wallet *domain.
 }
 
 func (r *GamificationRepository) SaveTransaction(ctx context.Context, txn *domain.CoinTransaction) error {
-	query := `INSERT INTO coin_transactions (id, user_id, amount, type, source, description, created_at)
-			  VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	query := `INSERT INTO coin_transactions (id, user_id, amount, type, source, description, reference_id, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
 
 	_, err := r.db.ExecContext(ctx, query,
-		txn.ID, txn.UserID, txn.Amount, txn.Type, txn.Source, txn.Description, txn.CreatedAt)
+		txn.ID, txn.UserID, txn.Amount, txn.Type, txn.Source, txn.Description, txn.ReferenceID, txn.CreatedAt)
 	return err
 }
 
+// ApplyTransaction records an earn or spend and moves the wallet balance by
+// it in one transaction, and returns the wallet. A transaction whose type
+// and reference were already recorded changes nothing; a spend over the
+// balance fails with ErrInsufficientBalance.
+func (r *GamificationRepository) ApplyTransaction(ctx context.Context, txn *domain.CoinTransaction) (*domain.CoinWallet, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO coin_wallets (user_id, balance, lifetime, updated_at)
+			  VALUES ($1, 0, 0, NOW()) ON CONFLICT (user_id) DO NOTHING`, txn.UserID); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to create wallet", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `INSERT INTO coin_transactions (id, user_id, amount, type, source, description, reference_id, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			  ON CONFLICT (type, reference_id) WHERE reference_id <> '' DO NOTHING`,
+		txn.ID, txn.UserID, txn.Amount, txn.Type, txn.Source, txn.Description, txn.ReferenceID, txn.CreatedAt)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to save transaction", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to get rows affected", err)
+	}
+
+	query := `UPDATE coin_wallets SET balance = balance + $2, lifetime = lifetime + $2, updated_at = NOW()
+			  WHERE user_id = $1`
+	args := []interface{}{txn.UserID, txn.Amount}
+	switch {
+	case inserted == 0:
+		r.logger.Infof("Coin transaction %s %s already applied", txn.Type, txn.ReferenceID)
+		query, args = `SELECT user_id, balance, lifetime, updated_at FROM coin_wallets WHERE user_id = $1`, args[:1]
+	case txn.Type == domain.CoinTxnSpend:
+		query = `UPDATE coin_wallets SET balance = balance - $2, updated_at = NOW()
+			  WHERE user_id = $1 AND balance >= $2`
+	}
+	if inserted > 0 {
+		query += ` RETURNING user_id, balance, lifetime, updated_at`
+	}
+
+	var wallet domain.CoinWallet
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
+		&wallet.UserID, &wallet.Balance, &wallet.Lifetime, &wallet.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errors.New(errors.ErrInsufficientBalance, "not enough coins")
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to update wallet", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to commit transaction", err)
+	}
+	return &wallet, nil
+}
+
 func (r *GamificationRepository) GetTransactions(ctx context.Context, userID string, limit int) ([]*domain.CoinTransaction, error) {
 	query := `SELECT id, user_id, amount, type, source, description, created_at
 			  FROM coin_transactions WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2`
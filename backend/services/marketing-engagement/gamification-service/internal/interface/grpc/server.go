@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/titan-commerce/backend/gamification-service/internal/application"
+	"github.com/titan-commerce/backend/pkg/errors"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -38,7 +39,7 @@ func (s *GamificationServer) GetBalance(ctx context.Context, req *GetBalanceRequ
 }
 
 func (s *GamificationServer) EarnCoins(ctx context.Context, req *EarnCoinsRequest) (*CoinWallet, error) {
-	wallet, err := s.service.EarnCoins(ctx, req.UserId, int(req.Amount), req.Source, req.Description)
+	wallet, err := s.service.EarnCoins(ctx, req.UserId, int(req.Amount), req.Source, req.Description, req.ReferenceId)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, err.Error())
 	}
@@ -52,9 +53,12 @@ func (s *GamificationServer) EarnCoins(ctx context.Context, req *EarnCoinsReques
 }
 
 func (s *GamificationServer) SpendCoins(ctx context.Context, req *SpendCoinsRequest) (*SpendCoinsResponse, error) {
-	wallet, err := s.service.SpendCoins(ctx, req.UserId, int(req.Amount), req.Purpose)
+	wallet, err := s.service.SpendCoins(ctx, req.UserId, int(req.Amount), req.Purpose, req.ReferenceId)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		if appErr, ok := err.(*errors.AppError); ok {
+			return nil, appErr.ToGRPCError()
+		}
+		return nil, status.Errorf(codes.Internal, err.Error())
 	}
 
 	return &SpendCoinsResponse{
@@ -212,9 +216,10 @@ type EarnCoinsRequest struct {
 	Description string
 }
 type SpendCoinsRequest struct {
-	UserId  string
-	Amount  int64
-	Purpose string
+	UserId      string
+	Amount      int64
+	Purpose     string
+	ReferenceId string
 }
 type SpendCoinsResponse struct {
 	Success    bool
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/titan-commerce/backend/cart-service/internal/application"
+	"github.com/titan-commerce/backend/cart-service/internal/domain"
+	"github.com/titan-commerce/backend/cart-service/internal/infrastructure/clients"
 	infrastructure "github.com/titan-commerce/backend/cart-service/internal/infrastructure/redis"
 	handler "github.com/titan-commerce/backend/cart-service/internal/interface/grpc"
 	pb "github.com/titan-commerce/backend/cart-service/proto/cart/v1"
@@ -16,6 +21,14 @@ import (
 	grpcLib "google.golang.org/grpc"
 )
 
+// listSignalInterval is how often listed products are checked for price
+// drops and restocks; abandonmentScanInterval how often idle carts are
+// looked for
+const (
+	listSignalInterval      = 5 * time.Minute
+	abandonmentScanInterval = 15 * time.Minute
+)
+
 func main() {
 	cfg, err := config.Load()
 	if err != nil {
@@ -38,8 +51,73 @@ func main() {
 		log.Fatal(err, "Failed to initialize Redis cart repository")
 	}
 
+	// Guest carts merge into the user's cart on login by these rules
+	strategy, err := domain.ParseMergeStrategy(os.Getenv("CART_MERGE_STRATEGY"))
+	if err != nil {
+		log.Fatal(err, "Invalid cart merge strategy")
+	}
+	mergeRules := domain.MergeRules{
+		Strategy:   strategy,
+		CapAtStock: os.Getenv("CART_MERGE_CAP_AT_STOCK") != "false",
+	}
+
+	// Carts idle this long and worth this much are followed up
+	abandonmentRules := domain.AbandonmentRules{
+		InactiveFor:    24 * time.Hour,
+		MinValue:       50.0,
+		RecoveryWindow: 7 * 24 * time.Hour,
+	}
+	if v := os.Getenv("CART_ABANDON_AFTER"); v != "" {
+		if abandonmentRules.InactiveFor, err = time.ParseDuration(v); err != nil {
+			log.Fatal(err, "Invalid CART_ABANDON_AFTER")
+		}
+	}
+	if v := os.Getenv("CART_ABANDON_MIN_VALUE"); v != "" {
+		if abandonmentRules.MinValue, err = strconv.ParseFloat(v, 64); err != nil {
+			log.Fatal(err, "Invalid CART_ABANDON_MIN_VALUE")
+		}
+	}
+
+	// Lines are priced by product-service and checked against
+	// inventory-service's stock
+	productAddr := os.Getenv("PRODUCT_SERVICE_ADDR")
+	if productAddr == "" {
+		productAddr = "product-service:9000"
+	}
+	pricing, err := clients.NewProductClient(productAddr)
+	if err != nil {
+		log.Fatal(err, "Failed to initialize product-service client")
+	}
+	defer pricing.Close()
+
+	inventoryAddr := os.Getenv("INVENTORY_SERVICE_ADDR")
+	if inventoryAddr == "" {
+		inventoryAddr = "inventory-service:9000"
+	}
+	inventory, err := clients.NewInventoryClient(inventoryAddr)
+	if err != nil {
+		log.Fatal(err, "Failed to initialize inventory-service client")
+	}
+	defer inventory.Close()
+
+	// Abandoned carts are only reported on the channels users take
+	// notifications on
+	userAddr := os.Getenv("USER_SERVICE_ADDR")
+	if userAddr == "" {
+		userAddr = "user-service:9000"
+	}
+	users, err := clients.NewUserClient(userAddr)
+	if err != nil {
+		log.Fatal(err, "Failed to initialize user-service client")
+	}
+	defer users.Close()
+
 	// Initialize application service
-	cartService := application.NewCartService(cartRepo, log)
+	cartService := application.NewCartService(cartRepo, pricing, inventory, mergeRules, log)
+	listService := application.NewListService(infrastructure.NewRedisListRepository(cartRepo), cartService,
+		pricing, inventory, infrastructure.NewRedisSignalPublisher(cartRepo), log)
+	abandonmentService := application.NewAbandonmentService(infrastructure.NewRedisAbandonmentRepository(cartRepo), cartService,
+		users, infrastructure.NewRedisCartEventPublisher(cartRepo), abandonmentRules, log)
 
 	// Initialize gRPC server
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
@@ -48,7 +126,41 @@ func main() {
 	}
 
 	grpcServer := grpcLib.NewServer()
-	pb.RegisterCartServiceServer(grpcServer, handler.NewCartServiceServer(cartService, log))
+	pb.RegisterCartServiceServer(grpcServer, handler.NewCartServiceServer(cartService, abandonmentService, log))
+	pb.RegisterListServiceServer(grpcServer, handler.NewListServiceServer(listService, log))
+
+	// Signal price drops and restocks of listed products
+	signalCtx, stopSignals := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(listSignalInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := listService.PublishSignals(signalCtx); err != nil {
+					log.Error(err, "List signal pass failed")
+				}
+			case <-signalCtx.Done():
+				return
+			}
+		}
+	}()
+
+	// Report carts left idle
+	go func() {
+		ticker := time.NewTicker(abandonmentScanInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := abandonmentService.ScanAbandoned(signalCtx); err != nil {
+					log.Error(err, "Abandoned cart scan failed")
+				}
+			case <-signalCtx.Done():
+				return
+			}
+		}
+	}()
 
 	// Start server
 	go func() {
@@ -65,6 +177,7 @@ func main() {
 	<-quit
 
 	log.Info("Shutting down Cart Service")
+	stopSignals()
 	grpcServer.GracefulStop()
 	log.Info("Cart Service stopped")
 }
@@ -0,0 +1,195 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"github.com/titan-commerce/backend/cart-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// abandonmentBatch is how many idle carts one scan looks at at once
+const abandonmentBatch = 100
+
+type AbandonmentRepository interface {
+	// InactiveCarts returns users whose cart was last updated before the
+	// given time, oldest first, skipping the first offset of them
+	InactiveCarts(ctx context.Context, before time.Time, offset, limit int) ([]string, error)
+	// ForgetInactive stops returning the user's cart from InactiveCarts
+	// until it is updated again
+	ForgetInactive(ctx context.Context, userID string, before time.Time) error
+	SaveAbandonment(ctx context.Context, abandonment *domain.Abandonment) error
+	FindAbandonment(ctx context.Context, userID string) (*domain.Abandonment, error)
+}
+
+// ContactPreferences returns the channels a user lets us send marketing
+// on; none means they opted out
+type ContactPreferences interface {
+	MarketingChannels(ctx context.Context, userID string) ([]string, error)
+}
+
+// CartEventPublisher hands cart events to notification and coupon services
+type CartEventPublisher interface {
+	Publish(ctx context.Context, event *domain.CartEvent) error
+}
+
+// AbandonmentService finds carts left idle and tracks whether their users
+// come back to check out
+type AbandonmentService struct {
+	repo   AbandonmentRepository
+	carts  *CartService
+	prefs  ContactPreferences
+	events CartEventPublisher
+	rules  domain.AbandonmentRules
+	logger *logger.Logger
+}
+
+func NewAbandonmentService(repo AbandonmentRepository, carts *CartService, prefs ContactPreferences, events CartEventPublisher, rules domain.AbandonmentRules, logger *logger.Logger) *AbandonmentService {
+	return &AbandonmentService{
+		repo:   repo,
+		carts:  carts,
+		prefs:  prefs,
+		events: events,
+		rules:  rules,
+		logger: logger,
+	}
+}
+
+// ScanAbandoned reports every cart idle for longer than the rules allow and
+// worth at least their minimum, unless its user opted out of marketing. It
+// returns how many were reported. Each idle cart is looked at once until it
+// is updated again. One that cannot be checked is logged and stays indexed
+// for the next scan; this one pages past it so it does not hold up the rest.
+func (s *AbandonmentService) ScanAbandoned(ctx context.Context) (int, error) {
+	now := time.Now()
+	before := now.Add(-s.rules.InactiveFor)
+
+	reported, kept := 0, 0
+	for {
+		userIDs, err := s.repo.InactiveCarts(ctx, before, kept, abandonmentBatch)
+		if err != nil {
+			return reported, err
+		}
+		for _, userID := range userIDs {
+			ok, err := s.check(ctx, userID, now)
+			if err != nil {
+				s.logger.Warnf("Abandoned cart check failed, kept for the next scan: user=%s, error=%v", userID, err)
+				kept++
+				continue
+			}
+			if ok {
+				reported++
+			}
+			if err := s.repo.ForgetInactive(ctx, userID, before); err != nil {
+				return reported, err
+			}
+		}
+		if len(userIDs) < abandonmentBatch {
+			break
+		}
+	}
+
+	if reported > 0 {
+		s.logger.Infof("Abandoned carts reported: %d", reported)
+	}
+	return reported, nil
+}
+
+// check reports the user's cart if it is abandoned and was not reported
+// already as it is
+func (s *AbandonmentService) check(ctx context.Context, userID string, now time.Time) (bool, error) {
+	cart, err := s.carts.repo.FindByUserID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	// Judged on current prices and stock, without saving: looking at the
+	// cart is not activity
+	prices, stock, err := s.carts.lookup(ctx, cart)
+	if err != nil {
+		return false, err
+	}
+	cart.Revalidate(prices, stock)
+	if !cart.Abandoned(s.rules, now) {
+		return false, nil
+	}
+
+	previous, err := s.findAbandonment(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if previous != nil && previous.Covers(cart) {
+		return false, nil
+	}
+
+	channels, err := s.prefs.MarketingChannels(ctx, userID)
+	if err != nil {
+		s.logger.Error(err, "failed to get contact preferences")
+		return false, err
+	}
+	if len(channels) == 0 {
+		s.logger.Debugf("Abandoned cart not reported, user opted out: user=%s", userID)
+		return false, nil
+	}
+
+	// Published before it is saved: a report that failed to go out is not
+	// taken for one already made
+	abandonment := domain.NewAbandonment(cart, channels, s.rules, now)
+	if err := s.events.Publish(ctx, abandonment.Event(domain.CartAbandoned, now)); err != nil {
+		s.logger.Error(err, "failed to publish cart abandoned event")
+		return false, err
+	}
+	if err := s.repo.SaveAbandonment(ctx, abandonment); err != nil {
+		s.logger.Error(err, "failed to save abandonment")
+		return false, err
+	}
+	return true, nil
+}
+
+// CheckedOut empties the user's cart once their order is placed, and
+// records the order as recovering the cart if it was reported abandoned
+// within the recovery window (Command)
+func (s *AbandonmentService) CheckedOut(ctx context.Context, userID, orderID string) error {
+	if err := s.carts.ClearCart(ctx, userID); err != nil {
+		return err
+	}
+
+	// The checkout already happened; a recovery left unrecorded is only
+	// missing from the marketing numbers
+	if err := s.recordRecovery(ctx, userID, orderID); err != nil {
+		s.logger.Warnf("Failed to record cart recovery: user=%s, order=%s, error=%v", userID, orderID, err)
+	}
+	return nil
+}
+
+func (s *AbandonmentService) recordRecovery(ctx context.Context, userID, orderID string) error {
+	abandonment, err := s.findAbandonment(ctx, userID)
+	if err != nil || abandonment == nil {
+		return err
+	}
+
+	now := time.Now()
+	if !abandonment.Recover(orderID, now) {
+		return nil
+	}
+	if err := s.events.Publish(ctx, abandonment.Event(domain.CartRecovered, now)); err != nil {
+		return err
+	}
+	if err := s.repo.SaveAbandonment(ctx, abandonment); err != nil {
+		return err
+	}
+
+	s.logger.Infof("Abandoned cart recovered: user=%s, order=%s", userID, orderID)
+	return nil
+}
+
+// findAbandonment returns the user's last abandonment still in its
+// recovery window, or nil
+func (s *AbandonmentService) findAbandonment(ctx context.Context, userID string) (*domain.Abandonment, error) {
+	abandonment, err := s.repo.FindAbandonment(ctx, userID)
+	if appErr, ok := err.(*errors.AppError); ok && appErr.Code == errors.ErrNotFound {
+		return nil, nil
+	}
+	return abandonment, err
+}
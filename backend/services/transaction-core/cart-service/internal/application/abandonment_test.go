@@ -0,0 +1,231 @@
+package application_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/titan-commerce/backend/cart-service/internal/application"
+	"github.com/titan-commerce/backend/cart-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// fakeAbandonments indexes carts by their last update like the Redis save
+// script does, and keeps abandonments in memory
+type fakeAbandonments struct {
+	activity     map[string]time.Time
+	abandonments map[string]*domain.Abandonment
+}
+
+func newFakeAbandonments() *fakeAbandonments {
+	return &fakeAbandonments{activity: map[string]time.Time{}, abandonments: map[string]*domain.Abandonment{}}
+}
+
+func (r *fakeAbandonments) InactiveCarts(ctx context.Context, before time.Time, offset, limit int) ([]string, error) {
+	var userIDs []string
+	for userID, at := range r.activity {
+		if at.Before(before) {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	sort.Slice(userIDs, func(i, j int) bool {
+		a, b := r.activity[userIDs[i]], r.activity[userIDs[j]]
+		return a.Before(b) || (a.Equal(b) && userIDs[i] < userIDs[j])
+	})
+	if offset > len(userIDs) {
+		offset = len(userIDs)
+	}
+	userIDs = userIDs[offset:]
+	if len(userIDs) > limit {
+		userIDs = userIDs[:limit]
+	}
+	return userIDs, nil
+}
+
+func (r *fakeAbandonments) ForgetInactive(ctx context.Context, userID string, before time.Time) error {
+	if at, ok := r.activity[userID]; ok && at.Before(before) {
+		delete(r.activity, userID)
+	}
+	return nil
+}
+
+func (r *fakeAbandonments) SaveAbandonment(ctx context.Context, abandonment *domain.Abandonment) error {
+	r.abandonments[abandonment.UserID] = abandonment
+	return nil
+}
+
+func (r *fakeAbandonments) FindAbandonment(ctx context.Context, userID string) (*domain.Abandonment, error) {
+	abandonment, ok := r.abandonments[userID]
+	if !ok {
+		return nil, errors.New(errors.ErrNotFound, "abandonment not found")
+	}
+	return abandonment, nil
+}
+
+type fakeEvents struct {
+	events []*domain.CartEvent
+	err    error // Fails every publish
+}
+
+func (p *fakeEvents) Publish(ctx context.Context, event *domain.CartEvent) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.events = append(p.events, event)
+	return nil
+}
+
+// fakePreferences lets everyone take email and SMS unless listed in
+// optedOut; users listed in failing cannot be looked up
+type fakePreferences struct {
+	optedOut map[string]bool
+	failing  map[string]bool
+}
+
+func (p *fakePreferences) MarketingChannels(ctx context.Context, userID string) ([]string, error) {
+	if p.failing[userID] {
+		return nil, errors.New(errors.ErrInternal, "user-service unavailable")
+	}
+	if p.optedOut[userID] {
+		return nil, nil
+	}
+	return []string{"EMAIL", "SMS"}, nil
+}
+
+func idleCart(userID string, idleFor time.Duration, productID string, quantity int) *domain.Cart {
+	cart := domain.NewCart(userID)
+	cart.AddItem(productID, "Test Product", quantity, 29.99)
+	cart.UpdatedAt = time.Now().Add(-idleFor)
+	return cart
+}
+
+func TestAbandonmentService_ScanAndRecover(t *testing.T) {
+	mockRepo := new(MockCartRepository)
+	repo := newFakeAbandonments()
+	events := &fakeEvents{}
+	prefs := &fakePreferences{optedOut: map[string]bool{"user-optout": true}}
+	rules := domain.AbandonmentRules{InactiveFor: 24 * time.Hour, MinValue: 50.0, RecoveryWindow: 7 * 24 * time.Hour}
+
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+	carts := application.NewCartService(mockRepo, newCatalog(), newCatalog(), domain.MergeRules{}, log)
+	service := application.NewAbandonmentService(repo, carts, prefs, events, rules, log)
+
+	ctx := context.Background()
+	abandoned := idleCart("user-idle", 48*time.Hour, "prod-123", 2) // 59.98
+	for _, cart := range []*domain.Cart{
+		abandoned,
+		idleCart("user-cheap", 48*time.Hour, "prod-123", 1), // Below the minimum value
+		idleCart("user-optout", 48*time.Hour, "prod-123", 5),
+		idleCart("user-active", time.Hour, "prod-123", 5),
+	} {
+		mockRepo.On("FindByUserID", ctx, cart.UserID).Return(cart, nil)
+		repo.activity[cart.UserID] = cart.UpdatedAt
+	}
+
+	reported, err := service.ScanAbandoned(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, reported)
+	require.Len(t, events.events, 1)
+	event := events.events[0]
+	assert.Equal(t, domain.CartAbandoned, event.Type)
+	assert.Equal(t, "user-idle", event.UserID)
+	assert.Len(t, event.Items, 1)
+	assert.InDelta(t, 59.98, event.Total, 0.001)
+	assert.Equal(t, []string{"EMAIL", "SMS"}, event.Channels)
+	assert.NotContains(t, repo.activity, "user-idle")
+	assert.Contains(t, repo.activity, "user-active")
+
+	// Indexed again without a change by the shopper, e.g. when repriced
+	repo.activity["user-idle"] = abandoned.UpdatedAt
+	reported, err = service.ScanAbandoned(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, reported)
+
+	mockRepo.On("Delete", ctx, "user-idle").Return(nil)
+	require.NoError(t, service.CheckedOut(ctx, "user-idle", "order-789"))
+
+	require.Len(t, events.events, 2)
+	recovered := events.events[1]
+	assert.Equal(t, domain.CartRecovered, recovered.Type)
+	assert.Equal(t, event.AbandonmentID, recovered.AbandonmentID)
+	assert.Equal(t, "order-789", recovered.OrderID)
+
+	// Only the first checkout after an abandonment recovers it
+	require.NoError(t, service.CheckedOut(ctx, "user-idle", "order-790"))
+	assert.Len(t, events.events, 2)
+}
+
+func TestAbandonmentService_ScanKeepsFailedChecks(t *testing.T) {
+	mockRepo := new(MockCartRepository)
+	repo := newFakeAbandonments()
+	events := &fakeEvents{}
+	prefs := &fakePreferences{failing: map[string]bool{}}
+	rules := domain.AbandonmentRules{InactiveFor: 24 * time.Hour, MinValue: 50.0, RecoveryWindow: 7 * 24 * time.Hour}
+
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+	carts := application.NewCartService(mockRepo, newCatalog(), newCatalog(), domain.MergeRules{}, log)
+	service := application.NewAbandonmentService(repo, carts, prefs, events, rules, log)
+
+	// A full batch of the oldest carts cannot be checked; the scan pages
+	// past them to the one behind
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		cart := idleCart(fmt.Sprintf("user-broken-%03d", i), 72*time.Hour, "prod-123", 2)
+		mockRepo.On("FindByUserID", ctx, cart.UserID).Return(cart, nil)
+		repo.activity[cart.UserID] = cart.UpdatedAt
+		prefs.failing[cart.UserID] = true
+	}
+	idle := idleCart("user-idle", 48*time.Hour, "prod-123", 2)
+	mockRepo.On("FindByUserID", ctx, idle.UserID).Return(idle, nil)
+	repo.activity[idle.UserID] = idle.UpdatedAt
+
+	reported, err := service.ScanAbandoned(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, reported)
+	require.Len(t, events.events, 1)
+	assert.Equal(t, "user-idle", events.events[0].UserID)
+	assert.Len(t, repo.activity, 100)
+	assert.NotContains(t, repo.activity, "user-idle")
+
+	// They are checked again by the next scan
+	prefs.failing = nil
+	reported, err = service.ScanAbandoned(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 100, reported)
+	assert.Empty(t, repo.activity)
+}
+
+func TestAbandonmentService_UnpublishedReportIsNotSaved(t *testing.T) {
+	mockRepo := new(MockCartRepository)
+	repo := newFakeAbandonments()
+	events := &fakeEvents{err: errors.New(errors.ErrInternal, "stream unavailable")}
+	rules := domain.AbandonmentRules{InactiveFor: 24 * time.Hour, MinValue: 50.0, RecoveryWindow: 7 * 24 * time.Hour}
+
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+	carts := application.NewCartService(mockRepo, newCatalog(), newCatalog(), domain.MergeRules{}, log)
+	service := application.NewAbandonmentService(repo, carts, &fakePreferences{}, events, rules, log)
+
+	ctx := context.Background()
+	cart := idleCart("user-idle", 48*time.Hour, "prod-123", 2)
+	mockRepo.On("FindByUserID", ctx, cart.UserID).Return(cart, nil)
+	repo.activity[cart.UserID] = cart.UpdatedAt
+
+	reported, err := service.ScanAbandoned(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, reported)
+	assert.Empty(t, repo.abandonments)
+
+	// Once the stream is back the cart is reported by the next scan
+	events.err = nil
+	reported, err = service.ScanAbandoned(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, reported)
+	assert.Len(t, events.events, 1)
+	assert.Contains(t, repo.abandonments, "user-idle")
+}
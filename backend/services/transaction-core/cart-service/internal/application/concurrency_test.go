@@ -0,0 +1,286 @@
+package application_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/titan-commerce/backend/cart-service/internal/application"
+	"github.com/titan-commerce/backend/cart-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// versionedCarts stores carts as JSON and saves them by compare-and-set on
+// their version, like the Redis repository's save script
+type versionedCarts struct {
+	mu    sync.Mutex
+	carts map[string][]byte
+}
+
+func newVersionedCarts() *versionedCarts {
+	return &versionedCarts{carts: map[string][]byte{}}
+}
+
+func (r *versionedCarts) key(cart *domain.Cart) string {
+	if cart.IsGuest() {
+		return "guest:" + cart.GuestToken
+	}
+	return cart.UserID
+}
+
+func (r *versionedCarts) load(key string, newCart func() *domain.Cart) (*domain.Cart, error) {
+	r.mu.Lock()
+	data, ok := r.carts[key]
+	r.mu.Unlock()
+	runtime.Gosched() // Let other writers in between load and save
+
+	if !ok {
+		return newCart(), nil
+	}
+	var cart domain.Cart
+	if err := json.Unmarshal(data, &cart); err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
+func (r *versionedCarts) Save(ctx context.Context, cart *domain.Cart) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.check(cart); err != nil {
+		return err
+	}
+	return r.store(cart)
+}
+
+func (r *versionedCarts) SaveMerge(ctx context.Context, cart, guest *domain.Cart) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.check(cart); err != nil {
+		return err
+	}
+	if err := r.check(guest); err != nil {
+		return err
+	}
+	if err := r.store(cart); err != nil {
+		return err
+	}
+	return r.store(guest)
+}
+
+// check fails unless the stored cart still has the version it was loaded at
+func (r *versionedCarts) check(cart *domain.Cart) error {
+	var version int64
+	if data, ok := r.carts[r.key(cart)]; ok {
+		var stored domain.Cart
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return err
+		}
+		version = stored.Version
+	}
+	if version != cart.Version {
+		return errors.New(errors.ErrConflict, "cart was modified concurrently (optimistic lock)")
+	}
+	return nil
+}
+
+func (r *versionedCarts) store(cart *domain.Cart) error {
+	cart.Version++
+	data, err := json.Marshal(cart)
+	if err != nil {
+		cart.Version--
+		return err
+	}
+	r.carts[r.key(cart)] = data
+	return nil
+}
+
+func (r *versionedCarts) FindByUserID(ctx context.Context, userID string) (*domain.Cart, error) {
+	return r.load(userID, func() *domain.Cart { return domain.NewCart(userID) })
+}
+
+func (r *versionedCarts) FindByGuestToken(ctx context.Context, guestToken string) (*domain.Cart, error) {
+	return r.load("guest:"+guestToken, func() *domain.Cart { return domain.NewGuestCart(guestToken) })
+}
+
+func (r *versionedCarts) Delete(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.carts, userID)
+	return nil
+}
+
+func (r *versionedCarts) DeleteGuest(ctx context.Context, guestToken string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.carts, "guest:"+guestToken)
+	return nil
+}
+
+// TestCartService_ConcurrentAddsLoseNothing hammers one cart with adds from
+// many goroutines, as from many tabs. Every add that succeeds must show in
+// the final cart, and any that fails must say it conflicted.
+func TestCartService_ConcurrentAddsLoseNothing(t *testing.T) {
+	const (
+		tabs        = 16
+		addsPerTab  = 25
+		sharedItem  = "prod-123"
+		userID      = "user-123"
+		unitPrice   = 29.99
+		ownItemBase = 1000
+	)
+
+	carts := newVersionedCarts()
+	catalog := newCatalog()
+	for tab := 0; tab < tabs; tab++ {
+		catalog.prices[fmt.Sprintf("prod-%d", ownItemBase+tab)] = unitPrice
+	}
+	log := logger.New(logger.Config{Level: "info", ServiceName: "test"})
+	service := application.NewCartService(carts, catalog, catalog, domain.MergeRules{}, log)
+
+	ctx := context.Background()
+	var sharedAdds, conflicts atomic.Int64
+	ownAdds := make([]int, tabs)
+
+	var wg sync.WaitGroup
+	for tab := 0; tab < tabs; tab++ {
+		wg.Add(1)
+		go func(tab int) {
+			defer wg.Done()
+			ownItem := fmt.Sprintf("prod-%d", ownItemBase+tab)
+			for i := 0; i < addsPerTab; i++ {
+				productID := sharedItem
+				if i%2 == 1 {
+					productID = ownItem
+				}
+
+				_, err := service.AddToCart(ctx, userID, productID, "Test Product", 1, nil)
+				if err != nil {
+					assert.Equal(t, errors.ErrConflict, err.(*errors.AppError).Code)
+					conflicts.Add(1)
+					continue
+				}
+				if productID == sharedItem {
+					sharedAdds.Add(1)
+				} else {
+					ownAdds[tab]++
+				}
+			}
+		}(tab)
+	}
+	wg.Wait()
+
+	cart, err := carts.FindByUserID(ctx, userID)
+	require.NoError(t, err)
+
+	assert.Equal(t, int(sharedAdds.Load()), cart.Quantity(sharedItem))
+	for tab := 0; tab < tabs; tab++ {
+		assert.Equal(t, ownAdds[tab], cart.Quantity(fmt.Sprintf("prod-%d", ownItemBase+tab)), "tab %d", tab)
+	}
+
+	saved := int(sharedAdds.Load())
+	for _, n := range ownAdds {
+		saved += n
+	}
+	assert.Equal(t, int64(saved), cart.Version, "one save per successful add")
+	assert.Equal(t, int64(tabs*addsPerTab), int64(saved)+conflicts.Load())
+	t.Logf("adds saved=%d, given up on conflict=%d", saved, conflicts.Load())
+}
+
+// TestCartService_MergeGuestCartOnce merges one guest cart from several
+// logins at once, as from retried requests. The lines are added once and
+// every merge reports the same changes.
+func TestCartService_MergeGuestCartOnce(t *testing.T) {
+	const (
+		logins     = 8
+		userID     = "user-123"
+		guestToken = "guest-abc"
+	)
+
+	carts := newVersionedCarts()
+	catalog := newCatalog()
+	log := logger.New(logger.Config{Level: "info", ServiceName: "test"})
+	service := application.NewCartService(carts, catalog, catalog, domain.MergeRules{Strategy: domain.MergeSumQuantities}, log)
+
+	ctx := context.Background()
+	_, err := service.AddToCart(ctx, userID, "prod-1", "Mug", 2, nil)
+	require.NoError(t, err)
+	_, err = service.AddToGuestCart(ctx, guestToken, "prod-1", "Mug", 3, nil)
+	require.NoError(t, err)
+
+	results := make([][]domain.ItemChange, logins)
+	var wg sync.WaitGroup
+	for login := 0; login < logins; login++ {
+		wg.Add(1)
+		go func(login int) {
+			defer wg.Done()
+			_, changes, err := service.MergeGuestCart(ctx, guestToken, userID)
+			if assert.NoError(t, err) {
+				results[login] = changes
+			}
+		}(login)
+	}
+	wg.Wait()
+
+	want := []domain.ItemChange{{ProductID: "prod-1", ProductName: "Mug", Reason: domain.ItemSummed, GuestQuantity: 3, PreviousQuantity: 2, Quantity: 5}}
+	for _, changes := range results {
+		assert.Equal(t, want, changes)
+	}
+
+	// Merging again later returns the result too
+	cart, changes, err := service.MergeGuestCart(ctx, guestToken, userID)
+	require.NoError(t, err)
+	assert.Equal(t, want, changes)
+	assert.Equal(t, 5, cart.Quantity("prod-1"))
+
+	guest, err := service.GetGuestCart(ctx, guestToken)
+	require.NoError(t, err)
+	assert.Empty(t, guest.Items)
+}
+
+// TestCartService_ExpectedVersion rejects a change made against a copy of
+// the cart the client no longer has
+func TestCartService_ExpectedVersion(t *testing.T) {
+	carts := newVersionedCarts()
+	catalog := newCatalog()
+	log := logger.New(logger.Config{Level: "info", ServiceName: "test"})
+	service := application.NewCartService(carts, catalog, catalog, domain.MergeRules{}, log)
+
+	ctx := context.Background()
+	userID := "user-123"
+	cart, err := service.AddToCart(ctx, userID, "prod-1", "Mug", 1, nil)
+	require.NoError(t, err)
+	seen := cart.Version
+
+	// Another tab changes the cart
+	_, err = service.AddToCart(ctx, userID, "prod-2", "Plate", 1, nil)
+	require.NoError(t, err)
+
+	_, err = service.UpdateQuantity(ctx, userID, "prod-1", 3, &seen)
+	require.Error(t, err)
+	assert.Equal(t, errors.ErrConflict, err.(*errors.AppError).Code)
+	_, err = service.RemoveFromCart(ctx, userID, "prod-2", &seen)
+	require.Error(t, err)
+	assert.Equal(t, errors.ErrConflict, err.(*errors.AppError).Code)
+
+	cart, err = service.GetCart(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, cart.Quantity("prod-1"))
+	assert.Equal(t, 1, cart.Quantity("prod-2"))
+
+	// The reloaded version applies
+	current := cart.Version
+	cart, err = service.UpdateQuantity(ctx, userID, "prod-1", 3, &current)
+	require.NoError(t, err)
+	assert.Equal(t, 3, cart.Quantity("prod-1"))
+	assert.Equal(t, current+1, cart.Version)
+}
@@ -0,0 +1,460 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/titan-commerce/backend/cart-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// signalBatch is how many watched products one signal pass prices at once
+const signalBatch = 100
+
+const saveForLaterName = "Saved for later"
+
+type ListRepository interface {
+	SaveList(ctx context.Context, list *domain.ShoppingList) error
+	FindList(ctx context.Context, listID string) (*domain.ShoppingList, error)
+	FindListsByUser(ctx context.Context, userID string) ([]*domain.ShoppingList, error)
+	FindListByShareToken(ctx context.Context, shareToken string) (*domain.ShoppingList, error)
+	DeleteList(ctx context.Context, list *domain.ShoppingList) error
+	ListsWithProduct(ctx context.Context, productID string) ([]*domain.ShoppingList, error)
+	WatchedProducts(ctx context.Context) ([]string, error)
+	ProductStates(ctx context.Context, productIDs []string) (map[string]domain.ProductState, error)
+	SaveProductStates(ctx context.Context, states map[string]domain.ProductState) error
+}
+
+// SignalPublisher hands list signals to notification-service
+type SignalPublisher interface {
+	Publish(ctx context.Context, signal *domain.ListSignal) error
+}
+
+// ListService manages wishlists, save-for-later and gift lists, and moves
+// items between them and the cart
+type ListService struct {
+	repo      ListRepository
+	carts     *CartService
+	prices    PriceResolver
+	stock     StockChecker
+	publisher SignalPublisher
+	logger    *logger.Logger
+}
+
+func NewListService(repo ListRepository, carts *CartService, prices PriceResolver, stock StockChecker, publisher SignalPublisher, logger *logger.Logger) *ListService {
+	return &ListService{
+		repo:      repo,
+		carts:     carts,
+		prices:    prices,
+		stock:     stock,
+		publisher: publisher,
+		logger:    logger,
+	}
+}
+
+// CreateList creates a named wishlist or gift list (Command)
+// Each user has one save-for-later list, created when first used.
+func (s *ListService) CreateList(ctx context.Context, userID, name string, kind domain.ListKind) (*domain.ShoppingList, error) {
+	if kind == domain.ListSaveForLater {
+		return s.saveForLaterList(ctx, userID)
+	}
+
+	list, err := domain.NewShoppingList(userID, name, kind)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SaveList(ctx, list); err != nil {
+		s.logger.Error(err, "failed to save list")
+		return nil, err
+	}
+
+	s.logger.Infof("List created: user=%s, list=%s, kind=%s", userID, list.ID, kind)
+	return list, nil
+}
+
+// GetLists retrieves all of a user's lists (Query)
+func (s *ListService) GetLists(ctx context.Context, userID string) ([]*domain.ShoppingList, error) {
+	return s.repo.FindListsByUser(ctx, userID)
+}
+
+// GetList retrieves one of the user's lists (Query)
+func (s *ListService) GetList(ctx context.Context, userID, listID string) (*domain.ShoppingList, error) {
+	list, err := s.repo.FindList(ctx, listID)
+	if err != nil {
+		return nil, err
+	}
+	if list.UserID != userID {
+		return nil, errors.New(errors.ErrForbidden, "list belongs to another user")
+	}
+	return list, nil
+}
+
+// DeleteList deletes one of the user's lists (Command)
+func (s *ListService) DeleteList(ctx context.Context, userID, listID string) error {
+	list, err := s.GetList(ctx, userID, listID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteList(ctx, list); err != nil {
+		s.logger.Error(err, "failed to delete list")
+		return err
+	}
+
+	s.logger.Infof("List deleted: user=%s, list=%s", userID, listID)
+	return nil
+}
+
+// AddToList puts a product on one of the user's lists at its current
+// price (Command)
+func (s *ListService) AddToList(ctx context.Context, userID, listID, productID, productName string, quantity int) (*domain.ShoppingList, error) {
+	if quantity <= 0 {
+		return nil, errors.New(errors.ErrInvalidInput, "quantity must be positive")
+	}
+
+	if _, err := s.GetList(ctx, userID, listID); err != nil {
+		return nil, err
+	}
+
+	prices, err := s.prices.CurrentPrices(ctx, []string{productID})
+	if err != nil {
+		s.logger.Error(err, "failed to resolve list item price")
+		return nil, err
+	}
+	price, listed := prices[productID]
+	if !listed {
+		return nil, errors.New(errors.ErrNotFound, fmt.Sprintf("product %s is no longer sold", productID))
+	}
+
+	list, err := s.mutate(ctx, s.userList(ctx, userID, listID), func(list *domain.ShoppingList) (bool, error) {
+		list.AddItem(productID, productName, quantity, price)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Infof("Added to list: user=%s, list=%s, product=%s", userID, listID, productID)
+	return list, nil
+}
+
+// RemoveFromList takes a product off one of the user's lists (Command)
+func (s *ListService) RemoveFromList(ctx context.Context, userID, listID, productID string) (*domain.ShoppingList, error) {
+	list, err := s.mutate(ctx, s.userList(ctx, userID, listID), func(list *domain.ShoppingList) (bool, error) {
+		_, ok := list.RemoveItem(productID)
+		return ok, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Infof("Removed from list: user=%s, list=%s, product=%s", userID, listID, productID)
+	return list, nil
+}
+
+// MoveToList moves a cart line onto one of the user's lists (Command)
+// The line is added to the list before it leaves the cart, so a failure
+// in between leaves it in both rather than in neither.
+func (s *ListService) MoveToList(ctx context.Context, userID, productID, listID string) (*domain.ShoppingList, *domain.Cart, error) {
+	return s.moveToList(ctx, userID, productID, s.userList(ctx, userID, listID))
+}
+
+// SaveForLater moves a cart line onto the user's save-for-later list (Command)
+func (s *ListService) SaveForLater(ctx context.Context, userID, productID string) (*domain.ShoppingList, *domain.Cart, error) {
+	return s.moveToList(ctx, userID, productID, func() (*domain.ShoppingList, error) {
+		return s.saveForLaterList(ctx, userID)
+	})
+}
+
+func (s *ListService) moveToList(ctx context.Context, userID, productID string, find func() (*domain.ShoppingList, error)) (*domain.ShoppingList, *domain.Cart, error) {
+	cart, err := s.carts.GetCart(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var line *domain.CartItem
+	for i := range cart.Items {
+		if cart.Items[i].ProductID == productID {
+			line = &cart.Items[i]
+			break
+		}
+	}
+	if line == nil {
+		return nil, nil, errors.New(errors.ErrNotFound, fmt.Sprintf("product %s is not in the cart", productID))
+	}
+
+	list, err := s.mutate(ctx, find, func(list *domain.ShoppingList) (bool, error) {
+		list.AddItem(line.ProductID, line.ProductName, line.Quantity, line.UnitPrice)
+		return true, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cart, err = s.carts.RemoveFromCart(ctx, userID, productID, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.logger.Infof("Moved to list: user=%s, list=%s, product=%s", userID, list.ID, productID)
+	return list, cart, nil
+}
+
+// MoveToCart moves a list item into the user's cart, repriced and checked
+// against stock like any item added to the cart (Command)
+// Like MoveToList, the item reaches the cart before it leaves the list.
+func (s *ListService) MoveToCart(ctx context.Context, userID, listID, productID string) (*domain.ShoppingList, *domain.Cart, error) {
+	list, err := s.GetList(ctx, userID, listID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var item *domain.ListItem
+	for i := range list.Items {
+		if list.Items[i].ProductID == productID {
+			item = &list.Items[i]
+			break
+		}
+	}
+	if item == nil {
+		return nil, nil, errors.New(errors.ErrNotFound, fmt.Sprintf("product %s is not on the list", productID))
+	}
+
+	cart, err := s.carts.AddToCart(ctx, userID, item.ProductID, item.ProductName, item.Quantity, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	list, err = s.mutate(ctx, s.userList(ctx, userID, listID), func(list *domain.ShoppingList) (bool, error) {
+		_, ok := list.RemoveItem(productID)
+		return ok, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.logger.Infof("Moved to cart: user=%s, list=%s, product=%s", userID, listID, productID)
+	return list, cart, nil
+}
+
+// ShareList makes one of the user's lists readable by link and returns its
+// share token (Command)
+func (s *ListService) ShareList(ctx context.Context, userID, listID string) (string, error) {
+	var token string
+	_, err := s.mutate(ctx, s.userList(ctx, userID, listID), func(list *domain.ShoppingList) (bool, error) {
+		if list.Kind == domain.ListSaveForLater {
+			return false, errors.New(errors.ErrInvalidInput, "save-for-later lists cannot be shared")
+		}
+		token = list.Share()
+		return true, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	s.logger.Infof("List shared: user=%s, list=%s", userID, listID)
+	return token, nil
+}
+
+// UnshareList makes one of the user's lists private again (Command)
+func (s *ListService) UnshareList(ctx context.Context, userID, listID string) error {
+	_, err := s.mutate(ctx, s.userList(ctx, userID, listID), func(list *domain.ShoppingList) (bool, error) {
+		list.Unshare()
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Infof("List unshared: user=%s, list=%s", userID, listID)
+	return nil
+}
+
+// GetSharedList retrieves a list by its share link (Query)
+func (s *ListService) GetSharedList(ctx context.Context, shareToken string) (*domain.ShoppingList, error) {
+	return s.repo.FindListByShareToken(ctx, shareToken)
+}
+
+// SubscribeToList makes a user follow a shared list's signals (Command)
+func (s *ListService) SubscribeToList(ctx context.Context, userID, shareToken string) (*domain.ShoppingList, error) {
+	list, err := s.mutate(ctx, func() (*domain.ShoppingList, error) {
+		return s.repo.FindListByShareToken(ctx, shareToken)
+	}, func(list *domain.ShoppingList) (bool, error) {
+		list.Subscribe(userID)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Infof("Subscribed to list: user=%s, list=%s", userID, list.ID)
+	return list, nil
+}
+
+// PublishSignals compares every listed product's price and stock with what
+// was last seen and signals drops and restocks to each list's owner and
+// subscribers (Command)
+// A product's first sighting only records its state.
+func (s *ListService) PublishSignals(ctx context.Context) error {
+	productIDs, err := s.repo.WatchedProducts(ctx)
+	if err != nil {
+		return err
+	}
+
+	published := 0
+	for start := 0; start < len(productIDs); start += signalBatch {
+		batch := productIDs[start:min(start+signalBatch, len(productIDs))]
+		n, err := s.publishBatch(ctx, batch)
+		published += n
+		if err != nil {
+			s.logger.Error(err, "failed to publish list signals")
+			return err
+		}
+	}
+
+	s.logger.Infof("List signals published: products=%d, signals=%d", len(productIDs), published)
+	return nil
+}
+
+func (s *ListService) publishBatch(ctx context.Context, productIDs []string) (int, error) {
+	prices, err := s.prices.CurrentPrices(ctx, productIDs)
+	if err != nil {
+		return 0, err
+	}
+	stock, err := s.stock.AvailableStock(ctx, productIDs)
+	if err != nil {
+		return 0, err
+	}
+	previous, err := s.repo.ProductStates(ctx, productIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	states := make(map[string]domain.ProductState, len(productIDs))
+	published := 0
+	for _, productID := range productIDs {
+		before, seen := previous[productID]
+		price, listed := prices[productID]
+		available, known := stock[productID]
+		state := domain.ProductState{Price: price, Listed: listed, InStock: listed && (!known || available > 0)}
+		if !listed {
+			state.Price = before.Price
+		}
+
+		if seen {
+			if signals := state.Signals(before); len(signals) > 0 {
+				n, err := s.signal(ctx, productID, before, state, signals)
+				published += n
+				if err != nil {
+					return published, err
+				}
+			}
+		}
+		states[productID] = state
+	}
+
+	// States are stored once every signal of the batch is out; a failed
+	// batch is compared again next time
+	return published, s.repo.SaveProductStates(ctx, states)
+}
+
+func (s *ListService) signal(ctx context.Context, productID string, before, after domain.ProductState, signals []domain.SignalType) (int, error) {
+	lists, err := s.repo.ListsWithProduct(ctx, productID)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	now := time.Now()
+	for _, list := range lists {
+		var productName string
+		for _, item := range list.Items {
+			if item.ProductID == productID {
+				productName = item.ProductName
+				break
+			}
+		}
+
+		for _, userID := range list.Audience() {
+			for _, signalType := range signals {
+				signal := &domain.ListSignal{
+					Type:        signalType,
+					UserID:      userID,
+					ListID:      list.ID,
+					ListName:    list.Name,
+					ProductID:   productID,
+					ProductName: productName,
+					OldPrice:    before.Price,
+					NewPrice:    after.Price,
+					OccurredAt:  now,
+				}
+				if err := s.publisher.Publish(ctx, signal); err != nil {
+					return published, err
+				}
+				published++
+			}
+		}
+	}
+	return published, nil
+}
+
+// saveForLaterList finds the user's save-for-later list, creating it on
+// first use. The list's ID is fixed per user, so of two requests creating
+// it at once one saves it and the other loads it.
+func (s *ListService) saveForLaterList(ctx context.Context, userID string) (*domain.ShoppingList, error) {
+	listID := domain.SaveForLaterListID(userID)
+	list, err := s.repo.FindList(ctx, listID)
+	if appErr, ok := err.(*errors.AppError); !ok || appErr.Code != errors.ErrNotFound {
+		return list, err
+	}
+
+	list, err = domain.NewShoppingList(userID, saveForLaterName, domain.ListSaveForLater)
+	if err != nil {
+		return nil, err
+	}
+	err = s.repo.SaveList(ctx, list)
+	if isConflict(err) {
+		return s.repo.FindList(ctx, listID)
+	}
+	if err != nil {
+		s.logger.Error(err, "failed to save list")
+		return nil, err
+	}
+	return list, nil
+}
+
+// userList returns a loader of one of the user's lists for mutate
+func (s *ListService) userList(ctx context.Context, userID, listID string) func() (*domain.ShoppingList, error) {
+	return func() (*domain.ShoppingList, error) {
+		return s.GetList(ctx, userID, listID)
+	}
+}
+
+// mutate loads a list with find, lets change modify it and saves it, as
+// long as nobody saved the list in between; otherwise it starts over on a
+// fresh copy like CartService.mutate. change reports whether there is
+// anything to save, and may run more than once.
+func (s *ListService) mutate(ctx context.Context, find func() (*domain.ShoppingList, error), change func(list *domain.ShoppingList) (bool, error)) (*domain.ShoppingList, error) {
+	for attempt := 1; ; attempt++ {
+		list, err := find()
+		if err != nil {
+			return nil, err
+		}
+
+		save, err := change(list)
+		if err != nil {
+			return nil, err
+		}
+		if !save {
+			return list, nil
+		}
+
+		err = s.repo.SaveList(ctx, list)
+		if err == nil {
+			return list, nil
+		}
+		if err := retrySave(ctx, s.logger, "list "+list.ID, attempt, err); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package application_test
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/titan-commerce/backend/cart-service/internal/application"
+	"github.com/titan-commerce/backend/cart-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// fakeLists keeps copies of lists and product states in memory and saves
+// lists by compare-and-set on their version, like the Redis repository
+type fakeLists struct {
+	mu     sync.Mutex
+	lists  map[string]*domain.ShoppingList
+	states map[string]domain.ProductState
+}
+
+func newFakeLists() *fakeLists {
+	return &fakeLists{lists: map[string]*domain.ShoppingList{}, states: map[string]domain.ProductState{}}
+}
+
+// copyList copies a list so that callers never share one
+func copyList(list *domain.ShoppingList) *domain.ShoppingList {
+	copied := *list
+	copied.Items = append([]domain.ListItem(nil), list.Items...)
+	copied.Subscribers = append([]string(nil), list.Subscribers...)
+	return &copied
+}
+
+func (r *fakeLists) SaveList(ctx context.Context, list *domain.ShoppingList) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var version int64
+	if stored, ok := r.lists[list.ID]; ok {
+		version = stored.Version
+	}
+	if version != list.Version {
+		return errors.New(errors.ErrConflict, "list was modified concurrently (optimistic lock)")
+	}
+	list.Version++
+	r.lists[list.ID] = copyList(list)
+	return nil
+}
+
+func (r *fakeLists) FindList(ctx context.Context, listID string) (*domain.ShoppingList, error) {
+	r.mu.Lock()
+	list, ok := r.lists[listID]
+	r.mu.Unlock()
+	runtime.Gosched() // Let other writers in between load and save
+
+	if !ok {
+		return nil, errors.New(errors.ErrNotFound, "list not found")
+	}
+	return copyList(list), nil
+}
+
+func (r *fakeLists) FindListsByUser(ctx context.Context, userID string) ([]*domain.ShoppingList, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var lists []*domain.ShoppingList
+	for _, list := range r.lists {
+		if list.UserID == userID {
+			lists = append(lists, copyList(list))
+		}
+	}
+	return lists, nil
+}
+
+func (r *fakeLists) FindListByShareToken(ctx context.Context, shareToken string) (*domain.ShoppingList, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, list := range r.lists {
+		if list.ShareToken != "" && list.ShareToken == shareToken {
+			return copyList(list), nil
+		}
+	}
+	return nil, errors.New(errors.ErrNotFound, "shared list not found")
+}
+
+func (r *fakeLists) DeleteList(ctx context.Context, list *domain.ShoppingList) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.lists, list.ID)
+	return nil
+}
+
+func (r *fakeLists) ListsWithProduct(ctx context.Context, productID string) ([]*domain.ShoppingList, error) {
+	var lists []*domain.ShoppingList
+	for _, list := range r.lists {
+		if list.Has(productID) {
+			lists = append(lists, list)
+		}
+	}
+	return lists, nil
+}
+
+func (r *fakeLists) WatchedProducts(ctx context.Context) ([]string, error) {
+	seen := map[string]bool{}
+	var productIDs []string
+	for _, list := range r.lists {
+		for _, item := range list.Items {
+			if !seen[item.ProductID] {
+				seen[item.ProductID] = true
+				productIDs = append(productIDs, item.ProductID)
+			}
+		}
+	}
+	return productIDs, nil
+}
+
+func (r *fakeLists) ProductStates(ctx context.Context, productIDs []string) (map[string]domain.ProductState, error) {
+	states := map[string]domain.ProductState{}
+	for _, productID := range productIDs {
+		if state, ok := r.states[productID]; ok {
+			states[productID] = state
+		}
+	}
+	return states, nil
+}
+
+func (r *fakeLists) SaveProductStates(ctx context.Context, states map[string]domain.ProductState) error {
+	for productID, state := range states {
+		r.states[productID] = state
+	}
+	return nil
+}
+
+type fakePublisher struct {
+	signals []*domain.ListSignal
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, signal *domain.ListSignal) error {
+	p.signals = append(p.signals, signal)
+	return nil
+}
+
+func newListService(mockRepo *MockCartRepository, catalog *fakeCatalog, lists *fakeLists, publisher *fakePublisher) *application.ListService {
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+	carts := application.NewCartService(mockRepo, catalog, catalog, domain.MergeRules{}, log)
+	return application.NewListService(lists, carts, catalog, catalog, publisher, log)
+}
+
+func TestListService_SaveForLaterAndMoveBack(t *testing.T) {
+	mockRepo := new(MockCartRepository)
+	catalog := newCatalog()
+	service := newListService(mockRepo, catalog, newFakeLists(), &fakePublisher{})
+
+	ctx := context.Background()
+	userID := "user-123"
+
+	existingCart := domain.NewCart(userID)
+	existingCart.AddItem("prod-1", "Mug", 2, 10.0)
+	existingCart.AddItem("prod-2", "Plate", 1, 5.0)
+
+	mockRepo.On("FindByUserID", ctx, userID).Return(existingCart, nil)
+	mockRepo.On("Save", ctx, mock.AnythingOfType("*domain.Cart")).Return(nil)
+
+	list, cart, err := service.SaveForLater(ctx, userID, "prod-1")
+
+	require.NoError(t, err)
+	assert.Equal(t, domain.ListSaveForLater, list.Kind)
+	assert.Len(t, list.Items, 1)
+	assert.Equal(t, 2, list.Items[0].Quantity)
+	assert.Len(t, cart.Items, 1)
+
+	// The same list is used again rather than a second one created
+	lists, err := service.GetLists(ctx, userID)
+	require.NoError(t, err)
+	assert.Len(t, lists, 1)
+
+	list, cart, err = service.MoveToCart(ctx, userID, list.ID, "prod-1")
+
+	require.NoError(t, err)
+	assert.Empty(t, list.Items)
+	assert.Len(t, cart.Items, 2)
+	assert.Equal(t, 2, cart.Quantity("prod-1"))
+}
+
+func TestListService_ShareAndSubscribe(t *testing.T) {
+	catalog := newCatalog()
+	service := newListService(new(MockCartRepository), catalog, newFakeLists(), &fakePublisher{})
+
+	ctx := context.Background()
+	owner := "user-123"
+
+	list, err := service.CreateList(ctx, owner, "Birthday", domain.ListGift)
+	require.NoError(t, err)
+	_, err = service.AddToList(ctx, owner, list.ID, "prod-3", "Bowl", 2)
+	require.NoError(t, err)
+
+	_, err = service.GetList(ctx, "user-456", list.ID)
+	assert.Equal(t, errors.ErrForbidden, err.(*errors.AppError).Code)
+
+	token, err := service.ShareList(ctx, owner, list.ID)
+	require.NoError(t, err)
+
+	shared, err := service.SubscribeToList(ctx, "user-456", token)
+	require.NoError(t, err)
+	assert.Equal(t, list.ID, shared.ID)
+	assert.Equal(t, []string{owner, "user-456"}, shared.Audience())
+
+	require.NoError(t, service.UnshareList(ctx, owner, list.ID))
+	_, err = service.GetSharedList(ctx, token)
+	assert.Equal(t, errors.ErrNotFound, err.(*errors.AppError).Code)
+}
+
+func TestListService_PublishSignals(t *testing.T) {
+	catalog := newCatalog()
+	publisher := &fakePublisher{}
+	service := newListService(new(MockCartRepository), catalog, newFakeLists(), publisher)
+
+	ctx := context.Background()
+	owner := "user-123"
+
+	list, err := service.CreateList(ctx, owner, "Wishes", domain.ListWishlist)
+	require.NoError(t, err)
+	_, err = service.AddToList(ctx, owner, list.ID, "prod-1", "Mug", 1)
+	require.NoError(t, err)
+	_, err = service.AddToList(ctx, owner, list.ID, "prod-2", "Plate", 1)
+	require.NoError(t, err)
+	token, err := service.ShareList(ctx, owner, list.ID)
+	require.NoError(t, err)
+	_, err = service.SubscribeToList(ctx, "user-456", token)
+	require.NoError(t, err)
+
+	// The first pass only records what it sees
+	catalog.stock = map[string]int{"prod-2": 0}
+	require.NoError(t, service.PublishSignals(ctx))
+	assert.Empty(t, publisher.signals)
+
+	catalog.prices["prod-1"] = 8.0
+	catalog.stock = map[string]int{"prod-2": 5}
+	require.NoError(t, service.PublishSignals(ctx))
+
+	assert.Len(t, publisher.signals, 4) // Two signals for the owner and the subscriber each
+	byType := map[domain.SignalType][]*domain.ListSignal{}
+	for _, signal := range publisher.signals {
+		byType[signal.Type] = append(byType[signal.Type], signal)
+	}
+	drop := byType[domain.SignalPriceDrop][0]
+	assert.Equal(t, "prod-1", drop.ProductID)
+	assert.Equal(t, 10.0, drop.OldPrice)
+	assert.Equal(t, 8.0, drop.NewPrice)
+	assert.Equal(t, "Wishes", drop.ListName)
+	assert.Len(t, byType[domain.SignalBackInStock], 2)
+	assert.Equal(t, "prod-2", byType[domain.SignalBackInStock][0].ProductID)
+
+	// Nothing changed since
+	require.NoError(t, service.PublishSignals(ctx))
+	assert.Len(t, publisher.signals, 4)
+}
+
+func TestListService_ConcurrentChangesLoseNothing(t *testing.T) {
+	const writers = 8
+	service := newListService(new(MockCartRepository), newCatalog(), newFakeLists(), &fakePublisher{})
+	ctx := context.Background()
+	owner := "user-123"
+
+	// Every request creating the save-for-later list gets the same one
+	created := make([]*domain.ShoppingList, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			list, err := service.CreateList(ctx, owner, "", domain.ListSaveForLater)
+			if assert.NoError(t, err) {
+				created[i] = list
+			}
+		}(i)
+	}
+	wg.Wait()
+	lists, err := service.GetLists(ctx, owner)
+	require.NoError(t, err)
+	require.Len(t, lists, 1)
+	for _, list := range created {
+		assert.Equal(t, lists[0].ID, list.ID)
+	}
+
+	// Adds racing on one list all land
+	listID := lists[0].ID
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := service.AddToList(ctx, owner, listID, "prod-1", "Mug", 1)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	list, err := service.GetList(ctx, owner, listID)
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+	assert.Equal(t, writers, list.Items[0].Quantity)
+}
@@ -2,92 +2,329 @@ package application
 
 import (
 	"context"
+	"fmt"
+	"math/rand"
+	"time"
 
 	"github.com/titan-commerce/backend/cart-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
 	"github.com/titan-commerce/backend/pkg/logger"
 )
 
+// maxSaveAttempts is how often a cart change is tried against copies saved
+// concurrently before giving up with a conflict; retries wait a random
+// time of up to retryBackoff per attempt so writers fall out of step
+const (
+	maxSaveAttempts = 8
+	retryBackoff    = 5 * time.Millisecond
+)
+
 type CartRepository interface {
 	Save(ctx context.Context, cart *domain.Cart) error
 	FindByUserID(ctx context.Context, userID string) (*domain.Cart, error)
+	FindByGuestToken(ctx context.Context, guestToken string) (*domain.Cart, error)
 	Delete(ctx context.Context, userID string) error
+	DeleteGuest(ctx context.Context, guestToken string) error
+	// SaveMerge saves the user's cart and the guest cart merged into it
+	// together, each only if nobody saved it since it was loaded
+	SaveMerge(ctx context.Context, cart, guest *domain.Cart) error
+}
+
+// PriceResolver returns the current price of each product that is still
+// sold; delisted products are left out
+type PriceResolver interface {
+	CurrentPrices(ctx context.Context, productIDs []string) (map[string]float64, error)
+}
+
+// StockChecker reports how many units of each product can still be sold
+type StockChecker interface {
+	AvailableStock(ctx context.Context, productIDs []string) (map[string]int, error)
 }
 
 type CartService struct {
 	repo   CartRepository
+	prices PriceResolver
+	stock  StockChecker
+	merge  domain.MergeRules
 	logger *logger.Logger
 }
 
-func NewCartService(repo CartRepository, logger *logger.Logger) *CartService {
+func NewCartService(repo CartRepository, prices PriceResolver, stock StockChecker, merge domain.MergeRules, logger *logger.Logger) *CartService {
 	return &CartService{
 		repo:   repo,
+		prices: prices,
+		stock:  stock,
+		merge:  merge,
 		logger: logger,
 	}
 }
 
-// AddToCart adds an item to user's cart (Command)
-func (s *CartService) AddToCart(ctx context.Context, userID, productID, productName string, quantity int, unitPrice float64) (*domain.Cart, error) {
-	cart, err := s.repo.FindByUserID(ctx, userID)
+// cartRef names a cart: a user's, or a guest's by its session token. A
+// change may expect the cart to be at a version the client last saw.
+type cartRef struct {
+	userID     string
+	guestToken string
+	expected   *int64
+}
+
+// String describes the cart for logs without leaking the session token
+func (r cartRef) String() string {
+	if r.guestToken != "" {
+		return "guest"
+	}
+	return "user=" + r.userID
+}
+
+func guestRef(guestToken string) (cartRef, error) {
+	if guestToken == "" {
+		return cartRef{}, errors.New(errors.ErrInvalidInput, "guest token is required")
+	}
+	return cartRef{guestToken: guestToken}, nil
+}
+
+// expecting returns the ref of a change that only applies to the cart at
+// expectedVersion, if that is set
+func (r cartRef) expecting(expectedVersion *int64) cartRef {
+	r.expected = expectedVersion
+	return r
+}
+
+func (s *CartService) find(ctx context.Context, ref cartRef) (*domain.Cart, error) {
+	if ref.guestToken != "" {
+		return s.repo.FindByGuestToken(ctx, ref.guestToken)
+	}
+	return s.repo.FindByUserID(ctx, ref.userID)
+}
+
+// AddToCart adds an item to user's cart at its current price (Command)
+// The cart changes, like every cart change, fail with ErrConflict if
+// expectedVersion is set and the cart is at another version.
+func (s *CartService) AddToCart(ctx context.Context, userID, productID, productName string, quantity int, expectedVersion *int64) (*domain.Cart, error) {
+	return s.addToCart(ctx, cartRef{userID: userID, expected: expectedVersion}, productID, productName, quantity)
+}
+
+// AddToGuestCart adds an item to an anonymous session's cart at its current price (Command)
+func (s *CartService) AddToGuestCart(ctx context.Context, guestToken, productID, productName string, quantity int, expectedVersion *int64) (*domain.Cart, error) {
+	ref, err := guestRef(guestToken)
 	if err != nil {
-		s.logger.Error(err, "failed to get cart")
 		return nil, err
 	}
+	return s.addToCart(ctx, ref.expecting(expectedVersion), productID, productName, quantity)
+}
 
-	cart.AddItem(productID, productName, quantity, unitPrice)
+func (s *CartService) addToCart(ctx context.Context, ref cartRef, productID, productName string, quantity int) (*domain.Cart, error) {
+	if quantity <= 0 {
+		return nil, errors.New(errors.ErrInvalidInput, "quantity must be positive")
+	}
+
+	cart, err := s.mutate(ctx, ref, func(cart *domain.Cart) (bool, error) {
+		prices, stock, err := s.lookup(ctx, cart, productID)
+		if err != nil {
+			return false, err
+		}
+
+		price, listed := prices[productID]
+		if !listed {
+			return false, errors.New(errors.ErrNotFound, fmt.Sprintf("product %s is no longer sold", productID))
+		}
+		wanted := quantity + cart.Quantity(productID)
+		if available, ok := stock[productID]; ok && available < wanted {
+			return false, errors.New(errors.ErrInsufficientStock,
+				fmt.Sprintf("only %d of product %s left in stock", max(available, 0), productID))
+		}
 
-	if err := s.repo.Save(ctx, cart); err != nil {
-		s.logger.Error(err, "failed to save cart")
+		cart.AddItem(productID, productName, quantity, price)
+		cart.Revalidate(prices, stock)
+		return true, nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	s.logger.Infof("Added to cart: user=%s, product=%s, qty=%d", userID, productID, quantity)
+	s.logger.Infof("Added to cart: %s, product=%s, qty=%d", ref, productID, quantity)
 	return cart, nil
 }
 
 // RemoveFromCart removes an item from cart (Command)
-func (s *CartService) RemoveFromCart(ctx context.Context, userID, productID string) (*domain.Cart, error) {
-	cart, err := s.repo.FindByUserID(ctx, userID)
+func (s *CartService) RemoveFromCart(ctx context.Context, userID, productID string, expectedVersion *int64) (*domain.Cart, error) {
+	return s.removeFromCart(ctx, cartRef{userID: userID, expected: expectedVersion}, productID)
+}
+
+// RemoveFromGuestCart removes an item from an anonymous session's cart (Command)
+func (s *CartService) RemoveFromGuestCart(ctx context.Context, guestToken, productID string, expectedVersion *int64) (*domain.Cart, error) {
+	ref, err := guestRef(guestToken)
 	if err != nil {
 		return nil, err
 	}
+	return s.removeFromCart(ctx, ref.expecting(expectedVersion), productID)
+}
 
-	cart.RemoveItem(productID)
-
-	if err := s.repo.Save(ctx, cart); err != nil {
+func (s *CartService) removeFromCart(ctx context.Context, ref cartRef, productID string) (*domain.Cart, error) {
+	cart, err := s.mutate(ctx, ref, func(cart *domain.Cart) (bool, error) {
+		cart.RemoveItem(productID)
+		return true, nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	s.logger.Infof("Removed from cart: user=%s, product=%s", userID, productID)
+	s.logger.Infof("Removed from cart: %s, product=%s", ref, productID)
 	return cart, nil
 }
 
 // UpdateQuantity updates item quantity in cart (Command)
-func (s *CartService) UpdateQuantity(ctx context.Context, userID, productID string, quantity int) (*domain.Cart, error) {
-	cart, err := s.repo.FindByUserID(ctx, userID)
+func (s *CartService) UpdateQuantity(ctx context.Context, userID, productID string, quantity int, expectedVersion *int64) (*domain.Cart, error) {
+	return s.updateQuantity(ctx, cartRef{userID: userID, expected: expectedVersion}, productID, quantity)
+}
+
+// UpdateGuestQuantity updates item quantity in an anonymous session's cart (Command)
+func (s *CartService) UpdateGuestQuantity(ctx context.Context, guestToken, productID string, quantity int, expectedVersion *int64) (*domain.Cart, error) {
+	ref, err := guestRef(guestToken)
 	if err != nil {
 		return nil, err
 	}
+	return s.updateQuantity(ctx, ref.expecting(expectedVersion), productID, quantity)
+}
 
-	cart.UpdateQuantity(productID, quantity)
+func (s *CartService) updateQuantity(ctx context.Context, ref cartRef, productID string, quantity int) (*domain.Cart, error) {
+	cart, err := s.mutate(ctx, ref, func(cart *domain.Cart) (bool, error) {
+		cart.UpdateQuantity(productID, quantity)
 
-	if err := s.repo.Save(ctx, cart); err != nil {
+		prices, stock, err := s.lookup(ctx, cart)
+		if err != nil {
+			return false, err
+		}
+		cart.Revalidate(prices, stock)
+		return true, nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	s.logger.Infof("Updated cart quantity: user=%s, product=%s, qty=%d", userID, productID, quantity)
+	s.logger.Infof("Updated cart quantity: %s, product=%s, qty=%d", ref, productID, quantity)
 	return cart, nil
 }
 
-// GetCart retrieves user's cart (Query)
+// GetCart retrieves user's cart, revalidated against current prices and
+// stock (Query)
 func (s *CartService) GetCart(ctx context.Context, userID string) (*domain.Cart, error) {
-	cart, err := s.repo.FindByUserID(ctx, userID)
+	return s.getCart(ctx, cartRef{userID: userID})
+}
+
+// GetGuestCart retrieves an anonymous session's cart, revalidated against
+// current prices and stock (Query)
+func (s *CartService) GetGuestCart(ctx context.Context, guestToken string) (*domain.Cart, error) {
+	ref, err := guestRef(guestToken)
+	if err != nil {
+		return nil, err
+	}
+	return s.getCart(ctx, ref)
+}
+
+// getCart stores the repriced lines so each change is warned about once;
+// stock flags are worked out again on every read
+func (s *CartService) getCart(ctx context.Context, ref cartRef) (*domain.Cart, error) {
+	repriced := false
+	cart, err := s.mutate(ctx, ref, func(cart *domain.Cart) (bool, error) {
+		prices, stock, err := s.lookup(ctx, cart)
+		if err != nil {
+			return false, err
+		}
+		repriced = cart.Revalidate(prices, stock)
+		return repriced, nil
+	})
 	if err != nil {
-		s.logger.Error(err, "failed to get cart")
 		return nil, err
 	}
+
+	if repriced {
+		s.logger.Infof("Cart revalidated: %s, warnings=%d", ref, len(cart.Warnings))
+	}
 	return cart, nil
 }
 
+// mutate loads the cart, lets change modify it and saves it, as long as
+// nobody saved the cart in between; otherwise it starts over on a fresh
+// copy. change reports whether there is anything to save, and may run more
+// than once. A ref expecting a version the cart is not at fails with
+// ErrConflict instead, so the client can reload what it shows.
+func (s *CartService) mutate(ctx context.Context, ref cartRef, change func(cart *domain.Cart) (bool, error)) (*domain.Cart, error) {
+	for attempt := 1; ; attempt++ {
+		cart, err := s.find(ctx, ref)
+		if err != nil {
+			s.logger.Error(err, "failed to get cart")
+			return nil, err
+		}
+		if ref.expected != nil && cart.Version != *ref.expected {
+			return nil, errors.New(errors.ErrConflict,
+				fmt.Sprintf("cart is at version %d, not %d", cart.Version, *ref.expected))
+		}
+
+		save, err := change(cart)
+		if err != nil {
+			return nil, err
+		}
+		if !save {
+			return cart, nil
+		}
+
+		err = s.repo.Save(ctx, cart)
+		if err == nil {
+			return cart, nil
+		}
+		if err := retrySave(ctx, s.logger, "cart "+ref.String(), attempt, err); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retrySave waits before another attempt at a save of what that failed with
+// err, or returns the error to give up with
+func retrySave(ctx context.Context, log *logger.Logger, what string, attempt int, err error) error {
+	if !isConflict(err) || attempt == maxSaveAttempts {
+		log.Error(err, "failed to save "+what)
+		return err
+	}
+	log.Debugf("Saved concurrently, retrying: %s, attempt=%d", what, attempt)
+
+	select {
+	case <-ctx.Done():
+		return errors.Wrap(errors.ErrConflict, what+" was modified concurrently", ctx.Err())
+	case <-time.After(time.Duration(rand.Int63n(int64(attempt) * int64(retryBackoff)))):
+		return nil
+	}
+}
+
+func isConflict(err error) bool {
+	appErr, ok := err.(*errors.AppError)
+	return ok && appErr.Code == errors.ErrConflict
+}
+
+// lookup fetches the current prices and stock of the cart's products and
+// of extra products about to join it
+func (s *CartService) lookup(ctx context.Context, cart *domain.Cart, extra ...string) (map[string]float64, map[string]int, error) {
+	productIDs := make([]string, 0, len(cart.Items)+len(extra))
+	for _, item := range cart.Items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+	productIDs = append(productIDs, extra...)
+	if len(productIDs) == 0 {
+		return nil, nil, nil
+	}
+
+	prices, err := s.prices.CurrentPrices(ctx, productIDs)
+	if err != nil {
+		s.logger.Error(err, "failed to resolve cart prices")
+		return nil, nil, err
+	}
+	stock, err := s.stock.AvailableStock(ctx, productIDs)
+	if err != nil {
+		s.logger.Error(err, "failed to check cart stock")
+		return nil, nil, err
+	}
+	return prices, stock, nil
+}
+
 // ClearCart empties user's cart (Command)
 func (s *CartService) ClearCart(ctx context.Context, userID string) error {
 	if err := s.repo.Delete(ctx, userID); err != nil {
@@ -98,3 +335,77 @@ func (s *CartService) ClearCart(ctx context.Context, userID string) error {
 	s.logger.Infof("Cart cleared: user=%s", userID)
 	return nil
 }
+
+// ClearGuestCart empties an anonymous session's cart (Command)
+func (s *CartService) ClearGuestCart(ctx context.Context, guestToken string) error {
+	if _, err := guestRef(guestToken); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteGuest(ctx, guestToken); err != nil {
+		s.logger.Error(err, "failed to clear guest cart")
+		return err
+	}
+
+	s.logger.Info("Guest cart cleared")
+	return nil
+}
+
+// MergeGuestCart moves an anonymous session's cart into the user's cart
+// when the shopper logs in, following the configured merge rules (Command)
+// The guest cart is emptied in the same save and remembers the result, so
+// merging it again, e.g. when the login is retried, returns the same
+// changes instead of adding the lines twice. The changes tell the frontend
+// what happened to each of its lines.
+func (s *CartService) MergeGuestCart(ctx context.Context, guestToken, userID string) (*domain.Cart, []domain.ItemChange, error) {
+	if userID == "" {
+		return nil, nil, errors.New(errors.ErrInvalidInput, "user ID is required")
+	}
+	ref, err := guestRef(guestToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		guest, err := s.find(ctx, ref)
+		if err != nil {
+			s.logger.Error(err, "failed to get guest cart")
+			return nil, nil, err
+		}
+		if guest.MergedWith(userID) {
+			cart, err := s.GetCart(ctx, userID)
+			return cart, guest.MergeChanges, err
+		}
+		if len(guest.Items) == 0 {
+			cart, err := s.GetCart(ctx, userID)
+			return cart, []domain.ItemChange{}, err
+		}
+
+		cart, err := s.find(ctx, cartRef{userID: userID})
+		if err != nil {
+			s.logger.Error(err, "failed to get cart")
+			return nil, nil, err
+		}
+		guestProductIDs := make([]string, len(guest.Items))
+		for i, item := range guest.Items {
+			guestProductIDs[i] = item.ProductID
+		}
+		prices, stock, err := s.lookup(ctx, cart, guestProductIDs...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		changes := cart.Merge(guest, s.merge, stock)
+		cart.Revalidate(prices, stock)
+		guest.MarkMerged(userID, changes)
+
+		err = s.repo.SaveMerge(ctx, cart, guest)
+		if err == nil {
+			s.logger.Infof("Guest cart merged: user=%s, lines=%d, strategy=%s", userID, len(changes), s.merge.Strategy)
+			return cart, changes, nil
+		}
+		if err := retrySave(ctx, s.logger, "cart "+cartRef{userID: userID}.String(), attempt, err); err != nil {
+			return nil, nil, err
+		}
+	}
+}
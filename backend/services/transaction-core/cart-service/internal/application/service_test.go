@@ -3,11 +3,13 @@ package application_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/titan-commerce/backend/cart-service/internal/application"
 	"github.com/titan-commerce/backend/cart-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
 	"github.com/titan-commerce/backend/pkg/logger"
 )
 
@@ -33,19 +35,72 @@ func (m *MockCartRepository) Delete(ctx context.Context, userID string) error {
 	return args.Error(0)
 }
 
+func (m *MockCartRepository) FindByGuestToken(ctx context.Context, guestToken string) (*domain.Cart, error) {
+	args := m.Called(ctx, guestToken)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Cart), args.Error(1)
+}
+
+func (m *MockCartRepository) DeleteGuest(ctx context.Context, guestToken string) error {
+	args := m.Called(ctx, guestToken)
+	return args.Error(0)
+}
+
+func (m *MockCartRepository) SaveMerge(ctx context.Context, cart, guest *domain.Cart) error {
+	args := m.Called(ctx, cart, guest)
+	return args.Error(0)
+}
+
+// fakeCatalog prices and stocks products like the pricing and inventory
+// services: unpriced products are delisted, unstocked ones always available
+type fakeCatalog struct {
+	prices map[string]float64
+	stock  map[string]int
+}
+
+func newCatalog() *fakeCatalog {
+	return &fakeCatalog{
+		prices: map[string]float64{"prod-123": 29.99, "prod-456": 19.99, "prod-1": 10.0, "prod-2": 5.0, "prod-3": 7.5},
+		stock:  map[string]int{},
+	}
+}
+
+func (c *fakeCatalog) CurrentPrices(ctx context.Context, productIDs []string) (map[string]float64, error) {
+	prices := make(map[string]float64)
+	for _, productID := range productIDs {
+		if price, ok := c.prices[productID]; ok {
+			prices[productID] = price
+		}
+	}
+	return prices, nil
+}
+
+func (c *fakeCatalog) AvailableStock(ctx context.Context, productIDs []string) (map[string]int, error) {
+	stock := make(map[string]int)
+	for _, productID := range productIDs {
+		if available, ok := c.stock[productID]; ok {
+			stock[productID] = available
+		}
+	}
+	return stock, nil
+}
+
 func TestCartService_AddToCart(t *testing.T) {
 	// Setup
 	mockRepo := new(MockCartRepository)
 	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
 	
-	service := application.NewCartService(mockRepo, log)
+	catalog := newCatalog()
+	service := application.NewCartService(mockRepo, catalog, catalog, domain.MergeRules{}, log)
 
 	ctx := context.Background()
 	userID := "user-123"
 	productID := "prod-123"
 	productName := "Test Product"
 	quantity := 2
-	unitPrice := 29.99
+	unitPrice := 29.99 // Per the pricing service
 
 	existingCart := domain.NewCart(userID)
 
@@ -54,7 +109,7 @@ func TestCartService_AddToCart(t *testing.T) {
 	mockRepo.On("Save", ctx, mock.AnythingOfType("*domain.Cart")).Return(nil)
 
 	// Execute
-	cart, err := service.AddToCart(ctx, userID, productID, productName, quantity, unitPrice)
+	cart, err := service.AddToCart(ctx, userID, productID, productName, quantity, nil)
 
 	// Assert
 	assert.NoError(t, err)
@@ -62,6 +117,7 @@ func TestCartService_AddToCart(t *testing.T) {
 	assert.Len(t, cart.Items, 1)
 	assert.Equal(t, productID, cart.Items[0].ProductID)
 	assert.Equal(t, quantity, cart.Items[0].Quantity)
+	assert.Equal(t, unitPrice, cart.Items[0].UnitPrice)
 	
 	mockRepo.AssertExpectations(t)
 }
@@ -71,7 +127,8 @@ func TestCartService_AddToCart_ExistingItem(t *testing.T) {
 	mockRepo := new(MockCartRepository)
 	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
 	
-	service := application.NewCartService(mockRepo, log)
+	catalog := newCatalog()
+	service := application.NewCartService(mockRepo, catalog, catalog, domain.MergeRules{}, log)
 
 	ctx := context.Background()
 	userID := "user-123"
@@ -87,7 +144,7 @@ func TestCartService_AddToCart_ExistingItem(t *testing.T) {
 	mockRepo.On("Save", ctx, mock.AnythingOfType("*domain.Cart")).Return(nil)
 
 	// Execute - add 2 more of the same product
-	cart, err := service.AddToCart(ctx, userID, productID, productName, 2, unitPrice)
+	cart, err := service.AddToCart(ctx, userID, productID, productName, 2, nil)
 
 	// Assert
 	assert.NoError(t, err)
@@ -102,7 +159,8 @@ func TestCartService_RemoveFromCart(t *testing.T) {
 	mockRepo := new(MockCartRepository)
 	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
 	
-	service := application.NewCartService(mockRepo, log)
+	catalog := newCatalog()
+	service := application.NewCartService(mockRepo, catalog, catalog, domain.MergeRules{}, log)
 
 	ctx := context.Background()
 	userID := "user-123"
@@ -117,7 +175,7 @@ func TestCartService_RemoveFromCart(t *testing.T) {
 	mockRepo.On("Save", ctx, mock.AnythingOfType("*domain.Cart")).Return(nil)
 
 	// Execute
-	cart, err := service.RemoveFromCart(ctx, userID, productID)
+	cart, err := service.RemoveFromCart(ctx, userID, productID, nil)
 
 	// Assert
 	assert.NoError(t, err)
@@ -132,7 +190,8 @@ func TestCartService_GetCart(t *testing.T) {
 	mockRepo := new(MockCartRepository)
 	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
 	
-	service := application.NewCartService(mockRepo, log)
+	catalog := newCatalog()
+	service := application.NewCartService(mockRepo, catalog, catalog, domain.MergeRules{}, log)
 
 	ctx := context.Background()
 	userID := "user-123"
@@ -158,7 +217,8 @@ func TestCartService_ClearCart(t *testing.T) {
 	mockRepo := new(MockCartRepository)
 	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
 	
-	service := application.NewCartService(mockRepo, log)
+	catalog := newCatalog()
+	service := application.NewCartService(mockRepo, catalog, catalog, domain.MergeRules{}, log)
 
 	ctx := context.Background()
 	userID := "user-123"
@@ -180,7 +240,8 @@ func TestCartService_UpdateQuantity(t *testing.T) {
 	mockRepo := new(MockCartRepository)
 	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
 	
-	service := application.NewCartService(mockRepo, log)
+	catalog := newCatalog()
+	service := application.NewCartService(mockRepo, catalog, catalog, domain.MergeRules{}, log)
 
 	ctx := context.Background()
 	userID := "user-123"
@@ -194,7 +255,7 @@ func TestCartService_UpdateQuantity(t *testing.T) {
 	mockRepo.On("Save", ctx, mock.AnythingOfType("*domain.Cart")).Return(nil)
 
 	// Execute - update quantity to 5
-	cart, err := service.UpdateQuantity(ctx, userID, productID, 5)
+	cart, err := service.UpdateQuantity(ctx, userID, productID, 5, nil)
 
 	// Assert
 	assert.NoError(t, err)
@@ -202,3 +263,214 @@ func TestCartService_UpdateQuantity(t *testing.T) {
 	
 	mockRepo.AssertExpectations(t)
 }
+
+func TestCartService_AddToGuestCart(t *testing.T) {
+	mockRepo := new(MockCartRepository)
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+
+	catalog := newCatalog()
+	service := application.NewCartService(mockRepo, catalog, catalog, domain.MergeRules{}, log)
+
+	ctx := context.Background()
+	guestToken := "guest-abc"
+
+	mockRepo.On("FindByGuestToken", ctx, guestToken).Return(domain.NewGuestCart(guestToken), nil)
+	mockRepo.On("Save", ctx, mock.AnythingOfType("*domain.Cart")).Return(nil)
+
+	cart, err := service.AddToGuestCart(ctx, guestToken, "prod-123", "Test Product", 2, nil)
+
+	assert.NoError(t, err)
+	assert.True(t, cart.IsGuest())
+	assert.Empty(t, cart.UserID)
+	assert.Len(t, cart.Items, 1)
+
+	_, err = service.AddToGuestCart(ctx, "", "prod-123", "Test Product", 2, nil)
+	assert.Error(t, err)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCartService_MergeGuestCart_SumQuantities(t *testing.T) {
+	mockRepo := new(MockCartRepository)
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+
+	rules := domain.MergeRules{Strategy: domain.MergeSumQuantities, CapAtStock: true}
+	catalog := newCatalog()
+	service := application.NewCartService(mockRepo, catalog, catalog, rules, log)
+
+	ctx := context.Background()
+	userID := "user-123"
+	guestToken := "guest-abc"
+
+	userCart := domain.NewCart(userID)
+	userCart.AddItem("prod-1", "Mug", 2, 10.0)
+	userCart.AddItem("prod-2", "Plate", 1, 5.0)
+
+	guestCart := domain.NewGuestCart(guestToken)
+	guestCart.AddItem("prod-1", "Mug", 3, 10.0)
+	guestCart.AddItem("prod-3", "Bowl", 4, 7.5)
+
+	mockRepo.On("FindByGuestToken", ctx, guestToken).Return(guestCart, nil)
+	mockRepo.On("FindByUserID", ctx, userID).Return(userCart, nil)
+	catalog.stock = map[string]int{"prod-1": 4, "prod-3": 10}
+	mockRepo.On("SaveMerge", ctx, mock.AnythingOfType("*domain.Cart"), guestCart).Return(nil)
+
+	cart, changes, err := service.MergeGuestCart(ctx, guestToken, userID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, userID, cart.UserID)
+	assert.Len(t, cart.Items, 3)
+	assert.Equal(t, 4, cart.Items[0].Quantity) // 2 + 3 capped at 4 in stock
+	assert.Equal(t, 1, cart.Items[1].Quantity) // Not in the guest cart
+	assert.Equal(t, 4, cart.Items[2].Quantity)
+	assert.Equal(t, 75.0, cart.Total)
+
+	assert.Equal(t, []domain.ItemChange{
+		{ProductID: "prod-1", ProductName: "Mug", Reason: domain.ItemSummed, GuestQuantity: 3, PreviousQuantity: 2, Quantity: 4, Capped: true},
+		{ProductID: "prod-3", ProductName: "Bowl", Reason: domain.ItemAdded, GuestQuantity: 4, Quantity: 4},
+	}, changes)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCartService_MergeGuestCart_KeepLatest(t *testing.T) {
+	mockRepo := new(MockCartRepository)
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+
+	rules := domain.MergeRules{Strategy: domain.MergeKeepLatest}
+	catalog := newCatalog()
+	service := application.NewCartService(mockRepo, catalog, catalog, rules, log)
+
+	ctx := context.Background()
+	userID := "user-123"
+	guestToken := "guest-abc"
+	now := time.Now()
+
+	userCart := domain.NewCart(userID)
+	userCart.Items = []domain.CartItem{
+		{ProductID: "prod-1", Quantity: 2, UnitPrice: 10.0, UpdatedAt: now.Add(-time.Hour)},
+		{ProductID: "prod-2", Quantity: 1, UnitPrice: 5.0, UpdatedAt: now},
+	}
+	guestCart := domain.NewGuestCart(guestToken)
+	guestCart.Items = []domain.CartItem{
+		{ProductID: "prod-1", Quantity: 5, UnitPrice: 10.0, UpdatedAt: now.Add(-time.Minute)},
+		{ProductID: "prod-2", Quantity: 3, UnitPrice: 5.0, UpdatedAt: now.Add(-time.Minute)},
+	}
+
+	mockRepo.On("FindByGuestToken", ctx, guestToken).Return(guestCart, nil)
+	mockRepo.On("FindByUserID", ctx, userID).Return(userCart, nil)
+	mockRepo.On("SaveMerge", ctx, mock.AnythingOfType("*domain.Cart"), guestCart).Return(nil)
+
+	cart, changes, err := service.MergeGuestCart(ctx, guestToken, userID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 5, cart.Items[0].Quantity) // The guest line is newer
+	assert.Equal(t, 1, cart.Items[1].Quantity) // The user's line is newer
+	assert.Equal(t, 55.0, cart.Total)
+	assert.Equal(t, domain.ItemReplaced, changes[0].Reason)
+	assert.Equal(t, domain.ItemKept, changes[1].Reason)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCartService_MergeGuestCart_RemovesOutOfStock(t *testing.T) {
+	mockRepo := new(MockCartRepository)
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+
+	rules := domain.MergeRules{Strategy: domain.MergeSumQuantities, CapAtStock: true}
+	catalog := newCatalog()
+	service := application.NewCartService(mockRepo, catalog, catalog, rules, log)
+
+	ctx := context.Background()
+	userID := "user-123"
+	guestToken := "guest-abc"
+
+	guestCart := domain.NewGuestCart(guestToken)
+	guestCart.AddItem("prod-1", "Mug", 1, 10.0)
+
+	mockRepo.On("FindByGuestToken", ctx, guestToken).Return(guestCart, nil)
+	mockRepo.On("FindByUserID", ctx, userID).Return(domain.NewCart(userID), nil)
+	catalog.stock = map[string]int{"prod-1": 0}
+	mockRepo.On("SaveMerge", ctx, mock.AnythingOfType("*domain.Cart"), guestCart).Return(nil)
+
+	cart, changes, err := service.MergeGuestCart(ctx, guestToken, userID)
+
+	assert.NoError(t, err)
+	assert.Empty(t, cart.Items)
+	assert.Len(t, changes, 1)
+	assert.True(t, changes[0].Capped)
+	assert.Equal(t, 0, changes[0].Quantity)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCartService_GetCart_Revalidates(t *testing.T) {
+	mockRepo := new(MockCartRepository)
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+
+	catalog := newCatalog()
+	service := application.NewCartService(mockRepo, catalog, catalog, domain.MergeRules{}, log)
+
+	ctx := context.Background()
+	userID := "user-123"
+
+	existingCart := domain.NewCart(userID)
+	existingCart.AddItem("prod-1", "Mug", 2, 8.0)     // Repriced to 10.00 since
+	existingCart.AddItem("prod-2", "Plate", 3, 5.0)   // Only 1 left
+	existingCart.AddItem("prod-3", "Bowl", 1, 7.5)    // Sold out
+	existingCart.AddItem("prod-9", "Teapot", 1, 30.0) // Delisted
+	catalog.stock = map[string]int{"prod-2": 1, "prod-3": 0}
+
+	mockRepo.On("FindByUserID", ctx, userID).Return(existingCart, nil)
+	mockRepo.On("Save", ctx, mock.AnythingOfType("*domain.Cart")).Return(nil).Once()
+
+	cart, err := service.GetCart(ctx, userID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 10.0, cart.Items[0].UnitPrice)
+	assert.Equal(t, []domain.ItemStatus{
+		domain.ItemAvailable, domain.ItemInsufficientStock, domain.ItemOutOfStock, domain.ItemDelisted,
+	}, []domain.ItemStatus{cart.Items[0].Status, cart.Items[1].Status, cart.Items[2].Status, cart.Items[3].Status})
+	assert.Equal(t, 20.0, cart.Total) // Only the mugs can be bought as they are
+
+	assert.Len(t, cart.Warnings, 4)
+	assert.Equal(t, domain.WarningPriceChanged, cart.Warnings[0].Type)
+	assert.Equal(t, 8.0, cart.Warnings[0].OldPrice)
+	assert.Equal(t, 10.0, cart.Warnings[0].NewPrice)
+	assert.Equal(t, domain.WarningInsufficientStock, cart.Warnings[1].Type)
+	assert.Equal(t, 1, cart.Warnings[1].Available)
+	assert.Equal(t, domain.WarningOutOfStock, cart.Warnings[2].Type)
+	assert.Equal(t, domain.WarningDelisted, cart.Warnings[3].Type)
+
+	// The new price was stored, so reading again only repeats the stock warnings
+	cart, err = service.GetCart(ctx, userID)
+
+	assert.NoError(t, err)
+	assert.Len(t, cart.Warnings, 3)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCartService_AddToCart_RejectsUnsellable(t *testing.T) {
+	mockRepo := new(MockCartRepository)
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+
+	catalog := newCatalog()
+	service := application.NewCartService(mockRepo, catalog, catalog, domain.MergeRules{}, log)
+
+	ctx := context.Background()
+	userID := "user-123"
+
+	existingCart := domain.NewCart(userID)
+	existingCart.AddItem("prod-1", "Mug", 2, 10.0)
+	catalog.stock = map[string]int{"prod-1": 3}
+
+	mockRepo.On("FindByUserID", ctx, userID).Return(existingCart, nil)
+
+	_, err := service.AddToCart(ctx, userID, "prod-9", "Teapot", 1, nil)
+	assert.Equal(t, errors.ErrNotFound, err.(*errors.AppError).Code)
+
+	_, err = service.AddToCart(ctx, userID, "prod-1", "Mug", 2, nil) // 2 + 2 > 3 in stock
+	assert.Equal(t, errors.ErrInsufficientStock, err.(*errors.AppError).Code)
+
+	mockRepo.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AbandonmentRules decide when a user's cart counts as abandoned
+type AbandonmentRules struct {
+	InactiveFor    time.Duration // Since the cart was last updated
+	MinValue       float64       // Of the lines that can still be bought
+	RecoveryWindow time.Duration // How long a checkout afterwards counts as a recovery
+}
+
+// Abandoned reports whether the cart, revalidated, has gone unchanged long
+// enough and is worth enough to follow up. Guest carts never are: there is
+// nobody to reach.
+func (c *Cart) Abandoned(rules AbandonmentRules, now time.Time) bool {
+	return !c.IsGuest() && len(c.Items) > 0 &&
+		now.Sub(c.UpdatedAt) >= rules.InactiveFor &&
+		cents(c.Total) >= cents(rules.MinValue)
+}
+
+// Abandonment records a cart found abandoned, and the checkout that
+// recovered it if one followed within the recovery window
+type Abandonment struct {
+	ID             string
+	UserID         string
+	Items          []CartItem
+	Total          float64
+	Channels       []string  // The user may be contacted on
+	LastActivityAt time.Time // The cart's UpdatedAt when found
+	DetectedAt     time.Time
+	ExpiresAt      time.Time // End of the recovery window
+	RecoveredAt    *time.Time
+	OrderID        string // Of the recovering checkout
+}
+
+func NewAbandonment(cart *Cart, channels []string, rules AbandonmentRules, now time.Time) *Abandonment {
+	items := make([]CartItem, len(cart.Items))
+	copy(items, cart.Items)
+	return &Abandonment{
+		ID:             uuid.New().String(),
+		UserID:         cart.UserID,
+		Items:          items,
+		Total:          cart.Total,
+		Channels:       channels,
+		LastActivityAt: cart.UpdatedAt,
+		DetectedAt:     now,
+		ExpiresAt:      now.Add(rules.RecoveryWindow),
+	}
+}
+
+// Covers reports whether the abandonment was found for the cart as it is,
+// so the same idle cart is not reported twice
+func (a *Abandonment) Covers(cart *Cart) bool {
+	return a.LastActivityAt.Equal(cart.UpdatedAt)
+}
+
+func (a *Abandonment) Recovered() bool {
+	return a.RecoveredAt != nil
+}
+
+// Recover credits the abandonment with the order that checked the user out.
+// It reports false if already recovered or past the recovery window.
+func (a *Abandonment) Recover(orderID string, now time.Time) bool {
+	if a.Recovered() || !now.Before(a.ExpiresAt) {
+		return false
+	}
+	a.RecoveredAt = &now
+	a.OrderID = orderID
+	return true
+}
+
+// CartEventType is what happened to an abandoned cart
+type CartEventType string
+
+const (
+	CartAbandoned CartEventType = "CART_ABANDONED"
+	CartRecovered CartEventType = "CART_RECOVERED"
+)
+
+// CartEvent tells notification and coupon services about an abandoned cart
+// and its recovery; both carry the cart's contents when it was abandoned
+type CartEvent struct {
+	Type           CartEventType
+	AbandonmentID  string
+	UserID         string
+	Items          []CartItem
+	Total          float64
+	Channels       []string
+	LastActivityAt time.Time
+	OrderID        string // Recoveries only
+	OccurredAt     time.Time
+}
+
+func (a *Abandonment) Event(eventType CartEventType, now time.Time) *CartEvent {
+	return &CartEvent{
+		Type:           eventType,
+		AbandonmentID:  a.ID,
+		UserID:         a.UserID,
+		Items:          a.Items,
+		Total:          a.Total,
+		Channels:       a.Channels,
+		LastActivityAt: a.LastActivityAt,
+		OrderID:        a.OrderID,
+		OccurredAt:     now,
+	}
+}
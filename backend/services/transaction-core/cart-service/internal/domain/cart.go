@@ -11,13 +11,25 @@ type CartItem struct {
 	UnitPrice   float64
 	Subtotal    float64
 	AddedAt     time.Time
+	UpdatedAt   time.Time
+	Status      ItemStatus // As of the last revalidation
 }
 
+// Cart belongs to a signed-in user, or to a guest by the token of their
+// anonymous session; a guest cart has no UserID
 type Cart struct {
-	UserID    string
-	Items     []CartItem
-	Total     float64
-	UpdatedAt time.Time
+	UserID     string
+	GuestToken string
+	Items      []CartItem
+	Total      float64 // Of the items that can be bought as they are
+	UpdatedAt  time.Time
+	Warnings   []CartWarning `json:"-"` // From the last revalidation; not stored
+	Version    int64         // Bumped by every save; 0 until first saved
+
+	// Of a guest cart merged on login: the user it went to and what became
+	// of its lines, so that merging it again returns the same result
+	MergedInto   string       `json:",omitempty"`
+	MergeChanges []ItemChange `json:",omitempty"`
 }
 
 func NewCart(userID string) *Cart {
@@ -29,12 +41,39 @@ func NewCart(userID string) *Cart {
 	}
 }
 
+// NewGuestCart creates an empty cart for an anonymous session
+func NewGuestCart(guestToken string) *Cart {
+	cart := NewCart("")
+	cart.GuestToken = guestToken
+	return cart
+}
+
+// IsGuest reports whether the cart belongs to an anonymous session
+func (c *Cart) IsGuest() bool {
+	return c.GuestToken != ""
+}
+
+// MarkMerged empties a guest cart whose lines went to the user's cart and
+// records the merge's result
+func (c *Cart) MarkMerged(userID string, changes []ItemChange) {
+	c.Clear()
+	c.MergedInto = userID
+	c.MergeChanges = changes
+}
+
+// MergedWith reports whether the guest cart was merged into the user's cart
+// and nothing was added to it since
+func (c *Cart) MergedWith(userID string) bool {
+	return c.MergedInto == userID && len(c.Items) == 0
+}
+
 func (c *Cart) AddItem(productID, productName string, quantity int, unitPrice float64) {
 	// Check if item already exists
 	for i, item := range c.Items {
 		if item.ProductID == productID {
 			c.Items[i].Quantity += quantity
 			c.Items[i].Subtotal = float64(c.Items[i].Quantity) * item.UnitPrice
+			c.Items[i].UpdatedAt = time.Now()
 			c.recalculateTotal()
 			c.UpdatedAt = time.Now()
 			return
@@ -43,13 +82,15 @@ func (c *Cart) AddItem(productID, productName string, quantity int, unitPrice fl
 
 	// Add new item
 	subtotal := float64(quantity) * unitPrice
+	now := time.Now()
 	c.Items = append(c.Items, CartItem{
 		ProductID:   productID,
 		ProductName: productName,
 		Quantity:    quantity,
 		UnitPrice:   unitPrice,
 		Subtotal:    subtotal,
-		AddedAt:     time.Now(),
+		AddedAt:     now,
+		UpdatedAt:   now,
 	})
 	c.recalculateTotal()
 	c.UpdatedAt = time.Now()
@@ -76,6 +117,7 @@ func (c *Cart) UpdateQuantity(productID string, quantity int) {
 		if item.ProductID == productID {
 			c.Items[i].Quantity = quantity
 			c.Items[i].Subtotal = float64(quantity) * item.UnitPrice
+			c.Items[i].UpdatedAt = time.Now()
 			break
 		}
 	}
@@ -83,6 +125,14 @@ func (c *Cart) UpdateQuantity(productID string, quantity int) {
 	c.UpdatedAt = time.Now()
 }
 
+// Quantity returns how many units of the product the cart holds
+func (c *Cart) Quantity(productID string) int {
+	if i := c.indexOf(productID); i >= 0 {
+		return c.Items[i].Quantity
+	}
+	return 0
+}
+
 func (c *Cart) Clear() {
 	c.Items = make([]CartItem, 0)
 	c.Total = 0.0
@@ -92,7 +142,9 @@ func (c *Cart) Clear() {
 func (c *Cart) recalculateTotal() {
 	total := 0.0
 	for _, item := range c.Items {
-		total += item.Subtotal
+		if item.Purchasable() {
+			total += item.Subtotal
+		}
 	}
 	c.Total = total
 }
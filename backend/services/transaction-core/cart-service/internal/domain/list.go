@@ -0,0 +1,159 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// ListKind is what a shopping list is kept for
+type ListKind string
+
+const (
+	ListWishlist     ListKind = "WISHLIST"
+	ListSaveForLater ListKind = "SAVE_FOR_LATER" // One per user, created on first use
+	ListGift         ListKind = "GIFT"
+)
+
+// ListItem is a product kept on a list, with the price it had when added
+type ListItem struct {
+	ProductID   string
+	ProductName string
+	Quantity    int
+	AddedPrice  float64
+	AddedAt     time.Time
+}
+
+// ShoppingList is a named list of products a user keeps outside their cart.
+// Anyone holding its share token can read it and subscribe to its signals.
+type ShoppingList struct {
+	ID          string
+	UserID      string
+	Name        string
+	Kind        ListKind
+	Items       []ListItem
+	ShareToken  string   // Empty while the list is private
+	Subscribers []string // Users other than the owner following the list
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Version     int64 // Bumped by every save; 0 until first saved
+}
+
+// SaveForLaterListID is the ID of the user's save-for-later list, so that
+// two requests creating it at once create the same list
+func SaveForLaterListID(userID string) string {
+	return "save-for-later:" + userID
+}
+
+// NewShoppingList creates an empty private list
+func NewShoppingList(userID, name string, kind ListKind) (*ShoppingList, error) {
+	switch kind {
+	case ListWishlist, ListSaveForLater, ListGift:
+	default:
+		return nil, errors.New(errors.ErrInvalidInput, fmt.Sprintf("unknown list kind %s", kind))
+	}
+	if userID == "" {
+		return nil, errors.New(errors.ErrInvalidInput, "user ID is required")
+	}
+	if name == "" {
+		return nil, errors.New(errors.ErrInvalidInput, "list name is required")
+	}
+
+	id := uuid.New().String()
+	if kind == ListSaveForLater {
+		id = SaveForLaterListID(userID)
+	}
+
+	now := time.Now()
+	return &ShoppingList{
+		ID:          id,
+		UserID:      userID,
+		Name:        name,
+		Kind:        kind,
+		Items:       make([]ListItem, 0),
+		Subscribers: make([]string, 0),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, nil
+}
+
+// AddItem puts a product on the list, adding to its quantity if it is
+// already there
+func (l *ShoppingList) AddItem(productID, productName string, quantity int, price float64) {
+	l.UpdatedAt = time.Now()
+	if i := l.indexOf(productID); i >= 0 {
+		l.Items[i].Quantity += quantity
+		return
+	}
+	l.Items = append(l.Items, ListItem{
+		ProductID:   productID,
+		ProductName: productName,
+		Quantity:    quantity,
+		AddedPrice:  price,
+		AddedAt:     l.UpdatedAt,
+	})
+}
+
+// RemoveItem takes a product off the list and returns it
+func (l *ShoppingList) RemoveItem(productID string) (ListItem, bool) {
+	i := l.indexOf(productID)
+	if i < 0 {
+		return ListItem{}, false
+	}
+	item := l.Items[i]
+	l.Items = append(l.Items[:i], l.Items[i+1:]...)
+	l.UpdatedAt = time.Now()
+	return item, true
+}
+
+// Has reports whether the product is on the list
+func (l *ShoppingList) Has(productID string) bool {
+	return l.indexOf(productID) >= 0
+}
+
+// Share gives the list a share token, keeping any it already has
+func (l *ShoppingList) Share() string {
+	if l.ShareToken == "" {
+		l.ShareToken = uuid.New().String() // Random, so unguessable
+		l.UpdatedAt = time.Now()
+	}
+	return l.ShareToken
+}
+
+// Unshare makes the list private again; old links stop working and its
+// subscribers are dropped
+func (l *ShoppingList) Unshare() {
+	l.ShareToken = ""
+	l.Subscribers = make([]string, 0)
+	l.UpdatedAt = time.Now()
+}
+
+// Subscribe makes a user follow the list's signals
+func (l *ShoppingList) Subscribe(userID string) {
+	if userID == l.UserID {
+		return
+	}
+	for _, subscriber := range l.Subscribers {
+		if subscriber == userID {
+			return
+		}
+	}
+	l.Subscribers = append(l.Subscribers, userID)
+	l.UpdatedAt = time.Now()
+}
+
+// Audience lists every user who receives the list's signals, owner first
+func (l *ShoppingList) Audience() []string {
+	return append([]string{l.UserID}, l.Subscribers...)
+}
+
+func (l *ShoppingList) indexOf(productID string) int {
+	for i, item := range l.Items {
+		if item.ProductID == productID {
+			return i
+		}
+	}
+	return -1
+}
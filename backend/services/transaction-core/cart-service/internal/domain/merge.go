@@ -0,0 +1,138 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// MergeStrategy decides the quantity of a product that is in both the
+// guest cart and the user's cart
+type MergeStrategy string
+
+const (
+	MergeSumQuantities MergeStrategy = "SUM_QUANTITIES" // Add both quantities up
+	MergeKeepLatest    MergeStrategy = "KEEP_LATEST"    // Keep whichever line changed last
+)
+
+// ParseMergeStrategy reads a strategy from configuration; empty means
+// summing quantities
+func ParseMergeStrategy(value string) (MergeStrategy, error) {
+	switch strategy := MergeStrategy(value); strategy {
+	case "":
+		return MergeSumQuantities, nil
+	case MergeSumQuantities, MergeKeepLatest:
+		return strategy, nil
+	default:
+		return "", errors.New(errors.ErrInvalidInput, fmt.Sprintf("unknown cart merge strategy %s", value))
+	}
+}
+
+// MergeRules configure how a guest cart merges into a user's cart on login
+type MergeRules struct {
+	Strategy   MergeStrategy
+	CapAtStock bool // Lower merged quantities to the stock available
+}
+
+// ItemChangeReason says what a merge did with a guest cart line
+type ItemChangeReason string
+
+const (
+	ItemAdded    ItemChangeReason = "ADDED"    // Only in the guest cart
+	ItemSummed   ItemChangeReason = "SUMMED"   // Quantities added up
+	ItemReplaced ItemChangeReason = "REPLACED" // The guest line was newer
+	ItemKept     ItemChangeReason = "KEPT"     // The user's line was newer
+)
+
+// ItemChange tells the shopper what became of a guest cart line
+type ItemChange struct {
+	ProductID        string
+	ProductName      string
+	Reason           ItemChangeReason
+	GuestQuantity    int  // In the guest cart
+	PreviousQuantity int  // In the user's cart before the merge
+	Quantity         int  // In the user's cart after the merge; 0 if removed
+	Capped           bool // Lowered to the stock available
+}
+
+// Merge moves the guest cart's lines into this cart and reports what
+// happened to each. stock holds the units available per product; products
+// missing from it are not capped.
+func (c *Cart) Merge(guest *Cart, rules MergeRules, stock map[string]int) []ItemChange {
+	now := time.Now()
+	changes := make([]ItemChange, 0, len(guest.Items))
+
+	for _, line := range guest.Items {
+		change := ItemChange{
+			ProductID:     line.ProductID,
+			ProductName:   line.ProductName,
+			GuestQuantity: line.Quantity,
+		}
+
+		i := c.indexOf(line.ProductID)
+		if i < 0 {
+			change.Reason = ItemAdded
+			c.Items = append(c.Items, line)
+			i = len(c.Items) - 1
+		} else {
+			item := &c.Items[i]
+			change.PreviousQuantity = item.Quantity
+
+			switch {
+			case rules.Strategy != MergeKeepLatest:
+				change.Reason = ItemSummed
+				item.Quantity += line.Quantity
+				item.UpdatedAt = now
+			case line.changedAt().After(item.changedAt()):
+				change.Reason = ItemReplaced
+				line.AddedAt = item.AddedAt
+				*item = line
+			default:
+				change.Reason = ItemKept
+			}
+		}
+
+		item := &c.Items[i]
+		if available, ok := stock[item.ProductID]; ok && rules.CapAtStock && item.Quantity > available {
+			item.Quantity = available
+			item.UpdatedAt = now
+			change.Capped = true
+		}
+		item.Subtotal = float64(item.Quantity) * item.UnitPrice
+		change.Quantity = item.Quantity
+
+		changes = append(changes, change)
+	}
+
+	// Lines capped to nothing leave the cart
+	items := c.Items[:0]
+	for _, item := range c.Items {
+		if item.Quantity > 0 {
+			items = append(items, item)
+		}
+	}
+	c.Items = items
+
+	c.recalculateTotal()
+	c.UpdatedAt = now
+	return changes
+}
+
+func (c *Cart) indexOf(productID string) int {
+	for i, item := range c.Items {
+		if item.ProductID == productID {
+			return i
+		}
+	}
+	return -1
+}
+
+// changedAt is when the line was last changed; lines saved before items
+// tracked updates only know when they were added
+func (i CartItem) changedAt() time.Time {
+	if i.UpdatedAt.IsZero() {
+		return i.AddedAt
+	}
+	return i.UpdatedAt
+}
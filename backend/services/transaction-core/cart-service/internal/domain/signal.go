@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"time"
+)
+
+// SignalType is what changed about a product someone keeps on a list
+type SignalType string
+
+const (
+	SignalPriceDrop   SignalType = "PRICE_DROP"
+	SignalBackInStock SignalType = "BACK_IN_STOCK"
+)
+
+// ProductState is what was last seen of a listed product's price and stock
+type ProductState struct {
+	Price   float64
+	Listed  bool // Still priced by the pricing service
+	InStock bool
+}
+
+// Signals compares a product's state against the one last seen
+func (s ProductState) Signals(previous ProductState) []SignalType {
+	var signals []SignalType
+	if s.Listed && previous.Listed && cents(s.Price) < cents(previous.Price) {
+		signals = append(signals, SignalPriceDrop)
+	}
+	if s.Listed && s.InStock && !(previous.Listed && previous.InStock) {
+		signals = append(signals, SignalBackInStock)
+	}
+	return signals
+}
+
+// ListSignal tells one user that a product on a list they own or follow
+// dropped in price or came back in stock
+type ListSignal struct {
+	Type        SignalType
+	UserID      string
+	ListID      string
+	ListName    string
+	ProductID   string
+	ProductName string
+	OldPrice    float64
+	NewPrice    float64
+	OccurredAt  time.Time
+}
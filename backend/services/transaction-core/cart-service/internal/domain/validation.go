@@ -0,0 +1,116 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// ItemStatus says whether a cart line can be bought as it is
+type ItemStatus string
+
+const (
+	ItemAvailable         ItemStatus = "AVAILABLE"
+	ItemInsufficientStock ItemStatus = "INSUFFICIENT_STOCK" // Fewer units in stock than wanted
+	ItemOutOfStock        ItemStatus = "OUT_OF_STOCK"
+	ItemDelisted          ItemStatus = "DELISTED" // No longer sold
+)
+
+// WarningType is what the shopper is warned about
+type WarningType string
+
+const (
+	WarningPriceChanged      WarningType = "PRICE_CHANGED"
+	WarningInsufficientStock WarningType = "INSUFFICIENT_STOCK"
+	WarningOutOfStock        WarningType = "OUT_OF_STOCK"
+	WarningDelisted          WarningType = "DELISTED"
+)
+
+// CartWarning tells the shopper that a line changed since they last saw it
+// or cannot be bought as it is
+type CartWarning struct {
+	ProductID   string
+	ProductName string
+	Type        WarningType
+	Message     string
+	OldPrice    float64 // Price changes only
+	NewPrice    float64 // Price changes only
+	Available   int     // Stock warnings only
+}
+
+// Purchasable reports whether the line can be bought as it is. Lines never
+// revalidated are assumed to be.
+func (i CartItem) Purchasable() bool {
+	return i.Status == "" || i.Status == ItemAvailable
+}
+
+// Revalidate reprices every line at its current price and flags lines that
+// are delisted or short of stock, replacing the cart's warnings. Products
+// missing from prices are no longer sold; products missing from stock are
+// assumed available. It reports whether any line was repriced.
+func (c *Cart) Revalidate(prices map[string]float64, stock map[string]int) bool {
+	repriced := false
+	warnings := make([]CartWarning, 0)
+
+	for i := range c.Items {
+		item := &c.Items[i]
+		status := ItemAvailable
+
+		price, listed := prices[item.ProductID]
+		if !listed {
+			status = ItemDelisted
+			warnings = append(warnings, item.warning(WarningDelisted,
+				fmt.Sprintf("%s is no longer sold", item.displayName())))
+		} else {
+			if cents(price) != cents(item.UnitPrice) {
+				warning := item.warning(WarningPriceChanged,
+					fmt.Sprintf("The price of %s changed from %.2f to %.2f", item.displayName(), item.UnitPrice, price))
+				warning.OldPrice, warning.NewPrice = item.UnitPrice, price
+				warnings = append(warnings, warning)
+
+				item.UnitPrice = price
+				item.Subtotal = float64(item.Quantity) * price
+				repriced = true
+			}
+
+			if available, ok := stock[item.ProductID]; ok && available < item.Quantity {
+				var warning CartWarning
+				if available <= 0 {
+					status = ItemOutOfStock
+					warning = item.warning(WarningOutOfStock,
+						fmt.Sprintf("%s is out of stock", item.displayName()))
+				} else {
+					status = ItemInsufficientStock
+					warning = item.warning(WarningInsufficientStock,
+						fmt.Sprintf("Only %d of %s left in stock", available, item.displayName()))
+				}
+				warning.Available = max(available, 0)
+				warnings = append(warnings, warning)
+			}
+		}
+
+		item.Status = status
+	}
+
+	c.Warnings = warnings
+	c.recalculateTotal()
+	if repriced {
+		c.UpdatedAt = time.Now()
+	}
+	return repriced
+}
+
+func (i CartItem) warning(warningType WarningType, message string) CartWarning {
+	return CartWarning{ProductID: i.ProductID, ProductName: i.ProductName, Type: warningType, Message: message}
+}
+
+func (i CartItem) displayName() string {
+	if i.ProductName == "" {
+		return i.ProductID
+	}
+	return i.ProductName
+}
+
+func cents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
@@ -0,0 +1,49 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+
+	inventorypb "github.com/titan-commerce/backend/inventory-service/proto/inventory/v1"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// InventoryClient checks stock with inventory-service
+type InventoryClient struct {
+	conn   *grpc.ClientConn
+	client inventorypb.InventoryServiceClient
+}
+
+// NewInventoryClient dials inventory-service at addr, e.g.
+// inventory-service:9000. The connection is made lazily, so an
+// inventory-service that is down fails the cart calls rather than startup.
+func NewInventoryClient(addr string) (*InventoryClient, error) {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to dial inventory-service", err)
+	}
+	return &InventoryClient{conn: conn, client: inventorypb.NewInventoryServiceClient(conn)}, nil
+}
+
+func (c *InventoryClient) Close() error {
+	return c.conn.Close()
+}
+
+// AvailableStock returns the unreserved units of each product; inventory-
+// service counts products it does not stock as having none
+func (c *InventoryClient) AvailableStock(ctx context.Context, productIDs []string) (map[string]int, error) {
+	stock := make(map[string]int, len(productIDs))
+	for _, productID := range productIDs {
+		if _, ok := stock[productID]; ok {
+			continue
+		}
+		resp, err := c.client.GetStock(ctx, &inventorypb.GetStockRequest{ProductId: productID})
+		if err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, fmt.Sprintf("failed to get stock of product %s", productID), err)
+		}
+		stock[productID] = int(resp.AvailableQuantity)
+	}
+	return stock, nil
+}
@@ -0,0 +1,54 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/titan-commerce/backend/pkg/errors"
+	productpb "github.com/titan-commerce/backend/product-service/proto/product/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// ProductClient prices cart lines with product-service
+type ProductClient struct {
+	conn   *grpc.ClientConn
+	client productpb.ProductServiceClient
+}
+
+// NewProductClient dials product-service at addr, e.g. product-service:9000.
+// The connection is made lazily, so a product-service that is down fails
+// the cart calls rather than startup.
+func NewProductClient(addr string) (*ProductClient, error) {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to dial product-service", err)
+	}
+	return &ProductClient{conn: conn, client: productpb.NewProductServiceClient(conn)}, nil
+}
+
+func (c *ProductClient) Close() error {
+	return c.conn.Close()
+}
+
+// CurrentPrices returns the listed price of each product; products
+// product-service no longer has are delisted and left out
+func (c *ProductClient) CurrentPrices(ctx context.Context, productIDs []string) (map[string]float64, error) {
+	prices := make(map[string]float64, len(productIDs))
+	for _, productID := range productIDs {
+		if _, ok := prices[productID]; ok {
+			continue
+		}
+		resp, err := c.client.GetProduct(ctx, &productpb.GetProductRequest{Id: productID})
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, fmt.Sprintf("failed to get price of product %s", productID), err)
+		}
+		prices[productID] = resp.Product.Price
+	}
+	return prices, nil
+}
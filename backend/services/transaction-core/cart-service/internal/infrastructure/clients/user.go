@@ -0,0 +1,61 @@
+package clients
+
+import (
+	"context"
+
+	"github.com/titan-commerce/backend/pkg/errors"
+	userpb "github.com/titan-commerce/backend/user-service/proto/user/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// Marketing channels as named in cart events
+const (
+	channelEmail = "EMAIL"
+	channelSMS   = "SMS"
+)
+
+// UserClient reads notification preferences from user-service
+type UserClient struct {
+	conn   *grpc.ClientConn
+	client userpb.UserServiceClient
+}
+
+// NewUserClient dials user-service at addr, e.g. user-service:9000. The
+// connection is made lazily, so a user-service that is down fails the
+// abandonment checks, which the next scan repeats, rather than startup.
+func NewUserClient(addr string) (*UserClient, error) {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to dial user-service", err)
+	}
+	return &UserClient{conn: conn, client: userpb.NewUserServiceClient(conn)}, nil
+}
+
+func (c *UserClient) Close() error {
+	return c.conn.Close()
+}
+
+// MarketingChannels returns the channels the user takes notifications on; a
+// user user-service does not know takes none
+func (c *UserClient) MarketingChannels(ctx context.Context, userID string) ([]string, error) {
+	resp, err := c.client.GetUser(ctx, &userpb.GetUserRequest{UserId: userID})
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to get notification preferences", err)
+	}
+
+	prefs := resp.User.GetPreferences()
+	var channels []string
+	if prefs.GetEmailNotifications() {
+		channels = append(channels, channelEmail)
+	}
+	if prefs.GetSmsNotifications() {
+		channels = append(channels, channelSMS)
+	}
+	return channels, nil
+}
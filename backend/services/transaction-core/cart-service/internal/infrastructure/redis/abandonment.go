@@ -0,0 +1,124 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/titan-commerce/backend/cart-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+const (
+	abandonmentKeyPrefix = "cart_abandonment:" // A user's last abandonment, kept for its recovery window
+	cartEventsStreamKey  = "cart_events"
+	cartEventsMaxLen     = 100000
+)
+
+// forgetInactiveScript drops a user from the activity index, unless their
+// cart was updated since the scan that looked at it
+var forgetInactiveScript = redis.NewScript(`
+	local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+	if score and tonumber(score) < tonumber(ARGV[2]) then
+		return redis.call('ZREM', KEYS[1], ARGV[1])
+	end
+	return 0
+`)
+
+type RedisAbandonmentRepository struct {
+	client *redis.Client
+}
+
+// NewRedisAbandonmentRepository shares the cart repository's Redis
+// connection, and the activity index its saves keep
+func NewRedisAbandonmentRepository(carts *RedisCartRepository) *RedisAbandonmentRepository {
+	return &RedisAbandonmentRepository{client: carts.client}
+}
+
+func (r *RedisAbandonmentRepository) InactiveCarts(ctx context.Context, before time.Time, offset, limit int) ([]string, error) {
+	userIDs, err := r.client.ZRangeByScore(ctx, cartActivityKey, &redis.ZRangeBy{
+		Min:    "-inf",
+		Max:    "(" + strconv.FormatInt(before.Unix(), 10),
+		Offset: int64(offset),
+		Count:  int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to get inactive carts from Redis", err)
+	}
+	return userIDs, nil
+}
+
+func (r *RedisAbandonmentRepository) ForgetInactive(ctx context.Context, userID string, before time.Time) error {
+	err := forgetInactiveScript.Run(ctx, r.client, []string{cartActivityKey}, userID, before.Unix()).Err()
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to unindex inactive cart in Redis", err)
+	}
+	return nil
+}
+
+// SaveAbandonment keeps the abandonment until its recovery window closes
+func (r *RedisAbandonmentRepository) SaveAbandonment(ctx context.Context, abandonment *domain.Abandonment) error {
+	ttl := time.Until(abandonment.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(abandonment)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to marshal abandonment", err)
+	}
+	if err := r.client.Set(ctx, abandonmentKeyPrefix+abandonment.UserID, data, ttl).Err(); err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to save abandonment to Redis", err)
+	}
+	return nil
+}
+
+func (r *RedisAbandonmentRepository) FindAbandonment(ctx context.Context, userID string) (*domain.Abandonment, error) {
+	data, err := r.client.Get(ctx, abandonmentKeyPrefix+userID).Result()
+	if err == redis.Nil {
+		return nil, errors.New(errors.ErrNotFound, "abandonment not found")
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to get abandonment from Redis", err)
+	}
+
+	var abandonment domain.Abandonment
+	if err := json.Unmarshal([]byte(data), &abandonment); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to unmarshal abandonment", err)
+	}
+	return &abandonment, nil
+}
+
+// RedisCartEventPublisher appends cart events to a Redis stream that
+// notification and coupon services can read with consumer groups
+type RedisCartEventPublisher struct {
+	client *redis.Client
+}
+
+func NewRedisCartEventPublisher(carts *RedisCartRepository) *RedisCartEventPublisher {
+	return &RedisCartEventPublisher{client: carts.client}
+}
+
+func (p *RedisCartEventPublisher) Publish(ctx context.Context, event *domain.CartEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to marshal cart event", err)
+	}
+
+	err = p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: cartEventsStreamKey,
+		MaxLen: cartEventsMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"type":    string(event.Type),
+			"user_id": event.UserID,
+			"event":   data,
+		},
+	}).Err()
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to publish cart event", err)
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/titan-commerce/backend/cart-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// Lists are kept without a TTL. The share and product indexes are only
+// ever added to; entries that no longer match their list are pruned when
+// read.
+const (
+	listKeyPrefix        = "list:"         // List JSON
+	userListsKeyPrefix   = "user_lists:"   // Set of a user's list IDs
+	listShareKeyPrefix   = "list_share:"   // Share token -> list ID
+	productListsPrefix   = "list_product:" // Set of IDs of lists holding a product
+	watchedProductsKey   = "list_products" // Set of products on any list
+	productStatesKey     = "list_product_state"
+	listSignalsStreamKey = "list_signals"
+	listSignalsMaxLen    = 100000
+)
+
+type RedisListRepository struct {
+	client *redis.Client
+}
+
+// NewRedisListRepository shares the cart repository's Redis connection
+func NewRedisListRepository(carts *RedisCartRepository) *RedisListRepository {
+	return &RedisListRepository{client: carts.client}
+}
+
+// SaveList stores the list, bumps its version and indexes it by owner,
+// share token and product. It fails with ErrConflict if the list was saved
+// by someone else since it was loaded; a list not stored yet counts as
+// version 0.
+func (r *RedisListRepository) SaveList(ctx context.Context, list *domain.ShoppingList) error {
+	key := listKeyPrefix + list.ID
+	expected := list.Version
+	list.Version++
+	data, err := json.Marshal(list)
+	if err != nil {
+		list.Version = expected
+		return errors.Wrap(errors.ErrInternal, "failed to marshal list", err)
+	}
+
+	err = r.client.Watch(ctx, func(tx *redis.Tx) error {
+		var version int64
+		stored, err := tx.Get(ctx, key).Bytes()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if err == nil {
+			var current domain.ShoppingList
+			if err := json.Unmarshal(stored, &current); err != nil {
+				return err
+			}
+			version = current.Version
+		}
+		if version != expected {
+			return redis.TxFailedErr
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, 0)
+			pipe.SAdd(ctx, userListsKeyPrefix+list.UserID, list.ID)
+			if list.ShareToken != "" {
+				pipe.Set(ctx, listShareKeyPrefix+list.ShareToken, list.ID, 0)
+			}
+			for _, item := range list.Items {
+				pipe.SAdd(ctx, productListsPrefix+item.ProductID, list.ID)
+				pipe.SAdd(ctx, watchedProductsKey, item.ProductID)
+			}
+			return nil
+		})
+		return err
+	}, key)
+	if err == redis.TxFailedErr {
+		list.Version = expected
+		return errors.New(errors.ErrConflict, "list was modified concurrently (optimistic lock)")
+	}
+	if err != nil {
+		list.Version = expected
+		return errors.Wrap(errors.ErrInternal, "failed to save list to Redis", err)
+	}
+	return nil
+}
+
+func (r *RedisListRepository) FindList(ctx context.Context, listID string) (*domain.ShoppingList, error) {
+	data, err := r.client.Get(ctx, listKeyPrefix+listID).Result()
+	if err == redis.Nil {
+		return nil, errors.New(errors.ErrNotFound, "list not found")
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to get list from Redis", err)
+	}
+
+	var list domain.ShoppingList
+	if err := json.Unmarshal([]byte(data), &list); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to unmarshal list", err)
+	}
+	return &list, nil
+}
+
+func (r *RedisListRepository) FindListsByUser(ctx context.Context, userID string) ([]*domain.ShoppingList, error) {
+	listIDs, err := r.client.SMembers(ctx, userListsKeyPrefix+userID).Result()
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to get user lists from Redis", err)
+	}
+	return r.findLists(ctx, listIDs, userListsKeyPrefix+userID)
+}
+
+// FindListByShareToken returns the list shared under the token, unless it
+// has been unshared since
+func (r *RedisListRepository) FindListByShareToken(ctx context.Context, shareToken string) (*domain.ShoppingList, error) {
+	listID, err := r.client.Get(ctx, listShareKeyPrefix+shareToken).Result()
+	if err == redis.Nil {
+		return nil, errors.New(errors.ErrNotFound, "shared list not found")
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to get shared list from Redis", err)
+	}
+
+	list, err := r.FindList(ctx, listID)
+	if err == nil && list.ShareToken == shareToken {
+		return list, nil
+	}
+	if appErr, ok := err.(*errors.AppError); ok && appErr.Code != errors.ErrNotFound {
+		return nil, err
+	}
+
+	r.client.Del(ctx, listShareKeyPrefix+shareToken)
+	return nil, errors.New(errors.ErrNotFound, "shared list not found")
+}
+
+func (r *RedisListRepository) DeleteList(ctx context.Context, list *domain.ShoppingList) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, listKeyPrefix+list.ID)
+		pipe.SRem(ctx, userListsKeyPrefix+list.UserID, list.ID)
+		if list.ShareToken != "" {
+			pipe.Del(ctx, listShareKeyPrefix+list.ShareToken)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to delete list from Redis", err)
+	}
+	return nil
+}
+
+// ListsWithProduct returns every list still holding the product. A product
+// no list holds any more stops being watched.
+func (r *RedisListRepository) ListsWithProduct(ctx context.Context, productID string) ([]*domain.ShoppingList, error) {
+	key := productListsPrefix + productID
+	listIDs, err := r.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to get product lists from Redis", err)
+	}
+
+	lists, err := r.findLists(ctx, listIDs, key)
+	if err != nil {
+		return nil, err
+	}
+
+	holding := lists[:0]
+	for _, list := range lists {
+		if list.Has(productID) {
+			holding = append(holding, list)
+		} else {
+			r.client.SRem(ctx, key, list.ID)
+		}
+	}
+
+	if len(holding) == 0 {
+		r.client.SRem(ctx, watchedProductsKey, productID)
+		r.client.HDel(ctx, productStatesKey, productID)
+	}
+	return holding, nil
+}
+
+func (r *RedisListRepository) WatchedProducts(ctx context.Context) ([]string, error) {
+	productIDs, err := r.client.SMembers(ctx, watchedProductsKey).Result()
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to get watched products from Redis", err)
+	}
+	return productIDs, nil
+}
+
+// ProductStates returns the last seen state of each product seen before
+func (r *RedisListRepository) ProductStates(ctx context.Context, productIDs []string) (map[string]domain.ProductState, error) {
+	states := make(map[string]domain.ProductState, len(productIDs))
+	if len(productIDs) == 0 {
+		return states, nil
+	}
+
+	values, err := r.client.HMGet(ctx, productStatesKey, productIDs...).Result()
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to get product states from Redis", err)
+	}
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var state domain.ProductState
+		if err := json.Unmarshal([]byte(data), &state); err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to unmarshal product state", err)
+		}
+		states[productIDs[i]] = state
+	}
+	return states, nil
+}
+
+func (r *RedisListRepository) SaveProductStates(ctx context.Context, states map[string]domain.ProductState) error {
+	if len(states) == 0 {
+		return nil
+	}
+
+	fields := make(map[string]interface{}, len(states))
+	for productID, state := range states {
+		data, err := json.Marshal(state)
+		if err != nil {
+			return errors.Wrap(errors.ErrInternal, "failed to marshal product state", err)
+		}
+		fields[productID] = data
+	}
+
+	if err := r.client.HSet(ctx, productStatesKey, fields).Err(); err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to save product states to Redis", err)
+	}
+	return nil
+}
+
+// findLists loads the lists by ID, dropping IDs of deleted lists from the
+// index set they were read from
+func (r *RedisListRepository) findLists(ctx context.Context, listIDs []string, indexKey string) ([]*domain.ShoppingList, error) {
+	lists := make([]*domain.ShoppingList, 0, len(listIDs))
+	for _, listID := range listIDs {
+		list, err := r.FindList(ctx, listID)
+		if appErr, ok := err.(*errors.AppError); ok && appErr.Code == errors.ErrNotFound {
+			r.client.SRem(ctx, indexKey, listID)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	return lists, nil
+}
+
+// RedisSignalPublisher appends list signals to a Redis stream that
+// notification-service can read with a consumer group
+type RedisSignalPublisher struct {
+	client *redis.Client
+}
+
+func NewRedisSignalPublisher(carts *RedisCartRepository) *RedisSignalPublisher {
+	return &RedisSignalPublisher{client: carts.client}
+}
+
+func (p *RedisSignalPublisher) Publish(ctx context.Context, signal *domain.ListSignal) error {
+	data, err := json.Marshal(signal)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to marshal list signal", err)
+	}
+
+	err = p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: listSignalsStreamKey,
+		MaxLen: listSignalsMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"type":    string(signal.Type),
+			"user_id": signal.UserID,
+			"signal":  data,
+		},
+	}).Err()
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to publish list signal", err)
+	}
+	return nil
+}
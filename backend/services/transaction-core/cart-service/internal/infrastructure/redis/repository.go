@@ -11,10 +11,75 @@ import (
 )
 
 const (
-	cartKeyPrefix = "cart:"
-	cartTTL       = 7 * 24 * time.Hour // 7 days
+	cartKeyPrefix      = "cart:"
+	cartTTL            = 7 * 24 * time.Hour // 7 days
+	guestCartKeyPrefix = "guest_cart:"
+	guestCartTTL       = 24 * time.Hour // Guest carts outlive few anonymous sessions
+	cartActivityKey    = "cart_activity" // User IDs scored by their cart's last update in Unix seconds
 )
 
+// saveCartScript stores a cart only if the stored copy still has the version
+// it was loaded at; a missing cart counts as version 0. A user's cart is
+// also indexed by when it was last updated. Returns 1 if saved, 0 if
+// someone else saved first.
+var saveCartScript = redis.NewScript(`
+	local cart_key = KEYS[1]
+	local activity_key = KEYS[2]
+	local expected = tonumber(ARGV[1])
+	local cart_json = ARGV[2]
+	local ttl_ms = ARGV[3]
+	local user_id = ARGV[4]
+	local updated_at = ARGV[5]
+
+	local version = 0
+	local stored = redis.call('GET', cart_key)
+	if stored then
+		version = tonumber(cjson.decode(stored)['Version']) or 0
+	end
+	if version ~= expected then
+		return 0
+	end
+
+	redis.call('SET', cart_key, cart_json, 'PX', ttl_ms)
+	if user_id ~= '' then
+		redis.call('ZADD', activity_key, updated_at, user_id)
+	end
+	return 1
+`)
+
+// saveMergeScript stores a user's cart and the guest cart merged into it,
+// each only if the stored copy still has the version it was loaded at, like
+// saveCartScript. Returns 1 if both were saved, 0 if neither was.
+var saveMergeScript = redis.NewScript(`
+	local cart_key = KEYS[1]
+	local activity_key = KEYS[2]
+	local guest_key = KEYS[3]
+	local expected = tonumber(ARGV[1])
+	local cart_json = ARGV[2]
+	local ttl_ms = ARGV[3]
+	local user_id = ARGV[4]
+	local updated_at = ARGV[5]
+	local guest_expected = tonumber(ARGV[6])
+	local guest_json = ARGV[7]
+	local guest_ttl_ms = ARGV[8]
+
+	local function version(key)
+		local stored = redis.call('GET', key)
+		if stored then
+			return tonumber(cjson.decode(stored)['Version']) or 0
+		end
+		return 0
+	end
+	if version(cart_key) ~= expected or version(guest_key) ~= guest_expected then
+		return 0
+	end
+
+	redis.call('SET', cart_key, cart_json, 'PX', ttl_ms)
+	redis.call('ZADD', activity_key, updated_at, user_id)
+	redis.call('SET', guest_key, guest_json, 'PX', guest_ttl_ms)
+	return 1
+`)
+
 type RedisCartRepository struct {
 	client *redis.Client
 }
@@ -37,28 +102,88 @@ func NewRedisCartRepository(addr, password string) (*RedisCartRepository, error)
 	return &RedisCartRepository{client: client}, nil
 }
 
+// Save stores a user's cart, or a guest's under its session token with a
+// shorter TTL, and bumps its version. It fails with ErrConflict if the cart
+// was saved by someone else since it was loaded.
 func (r *RedisCartRepository) Save(ctx context.Context, cart *domain.Cart) error {
-	key := cartKeyPrefix + cart.UserID
+	key, ttl := cartKeyPrefix+cart.UserID, cartTTL
+	if cart.IsGuest() {
+		key, ttl = guestCartKeyPrefix+cart.GuestToken, guestCartTTL
+	}
 	
+	expected := cart.Version
+	cart.Version++
 	data, err := json.Marshal(cart)
 	if err != nil {
+		cart.Version = expected
 		return errors.Wrap(errors.ErrInternal, "failed to marshal cart", err)
 	}
 
-	if err := r.client.Set(ctx, key, data, cartTTL).Err(); err != nil {
+	saved, err := saveCartScript.Run(ctx, r.client, []string{key, cartActivityKey},
+		expected, data, ttl.Milliseconds(), cart.UserID, cart.UpdatedAt.Unix()).Int()
+	if err != nil {
+		cart.Version = expected
 		return errors.Wrap(errors.ErrInternal, "failed to save cart to Redis", err)
 	}
+	if saved == 0 {
+		cart.Version = expected
+		return errors.New(errors.ErrConflict, "cart was modified concurrently (optimistic lock)")
+	}
+
+	return nil
+}
+
+// SaveMerge stores a user's cart and the guest cart merged into it in one
+// step, bumping both versions. It fails with ErrConflict, saving neither,
+// if either was saved by someone else since it was loaded.
+func (r *RedisCartRepository) SaveMerge(ctx context.Context, cart, guest *domain.Cart) error {
+	expected, guestExpected := cart.Version, guest.Version
+	restore := func() {
+		cart.Version, guest.Version = expected, guestExpected
+	}
+	cart.Version++
+	guest.Version++
+	data, err := json.Marshal(cart)
+	if err != nil {
+		restore()
+		return errors.Wrap(errors.ErrInternal, "failed to marshal cart", err)
+	}
+	guestData, err := json.Marshal(guest)
+	if err != nil {
+		restore()
+		return errors.Wrap(errors.ErrInternal, "failed to marshal guest cart", err)
+	}
+
+	saved, err := saveMergeScript.Run(ctx, r.client,
+		[]string{cartKeyPrefix + cart.UserID, cartActivityKey, guestCartKeyPrefix + guest.GuestToken},
+		expected, data, cartTTL.Milliseconds(), cart.UserID, cart.UpdatedAt.Unix(),
+		guestExpected, guestData, guestCartTTL.Milliseconds()).Int()
+	if err != nil {
+		restore()
+		return errors.Wrap(errors.ErrInternal, "failed to save merged carts to Redis", err)
+	}
+	if saved == 0 {
+		restore()
+		return errors.New(errors.ErrConflict, "cart was modified concurrently (optimistic lock)")
+	}
 
 	return nil
 }
 
 func (r *RedisCartRepository) FindByUserID(ctx context.Context, userID string) (*domain.Cart, error) {
-	key := cartKeyPrefix + userID
-	
+	return r.find(ctx, cartKeyPrefix+userID, func() *domain.Cart { return domain.NewCart(userID) })
+}
+
+// FindByGuestToken returns an anonymous session's cart, empty if it has none
+func (r *RedisCartRepository) FindByGuestToken(ctx context.Context, guestToken string) (*domain.Cart, error) {
+	return r.find(ctx, guestCartKeyPrefix+guestToken, func() *domain.Cart { return domain.NewGuestCart(guestToken) })
+}
+
+func (r *RedisCartRepository) find(ctx context.Context, key string, newCart func() *domain.Cart) (*domain.Cart, error) {
 	data, err := r.client.Get(ctx, key).Result()
 	if err == redis.Nil {
 		// Cart doesn't exist, return new empty cart
-		return domain.NewCart(userID), nil
+		return newCart(), nil
 	}
 	if err != nil {
 		return nil, errors.Wrap(errors.ErrInternal, "failed to get cart from Redis", err)
@@ -73,8 +198,22 @@ func (r *RedisCartRepository) FindByUserID(ctx context.Context, userID string) (
 }
 
 func (r *RedisCartRepository) Delete(ctx context.Context, userID string) error {
-	key := cartKeyPrefix + userID
-	
+	if err := r.delete(ctx, cartKeyPrefix+userID); err != nil {
+		return err
+	}
+	// Carts that expire instead are dropped from the index when next scanned
+	if err := r.client.ZRem(ctx, cartActivityKey, userID).Err(); err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to unindex cart in Redis", err)
+	}
+	return nil
+}
+
+// DeleteGuest drops an anonymous session's cart
+func (r *RedisCartRepository) DeleteGuest(ctx context.Context, guestToken string) error {
+	return r.delete(ctx, guestCartKeyPrefix+guestToken)
+}
+
+func (r *RedisCartRepository) delete(ctx context.Context, key string) error {
 	if err := r.client.Del(ctx, key).Err(); err != nil {
 		return errors.Wrap(errors.ErrInternal, "failed to delete cart from Redis", err)
 	}
@@ -0,0 +1,180 @@
+package infrastructure_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/titan-commerce/backend/cart-service/internal/domain"
+	infrastructure "github.com/titan-commerce/backend/cart-service/internal/infrastructure/redis"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// These tests need a Redis to run against, e.g.
+// CART_TEST_REDIS_ADDR=localhost:6379 go test ./internal/infrastructure/redis/
+func newRepository(t *testing.T) *infrastructure.RedisCartRepository {
+	addr := os.Getenv("CART_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("CART_TEST_REDIS_ADDR not set")
+	}
+	repo, err := infrastructure.NewRedisCartRepository(addr, os.Getenv("CART_TEST_REDIS_PASSWORD"))
+	require.NoError(t, err)
+	return repo
+}
+
+func TestRedisCartRepository_SaveRejectsStaleCopies(t *testing.T) {
+	repo := newRepository(t)
+	ctx := context.Background()
+	userID := fmt.Sprintf("test-user-%d", time.Now().UnixNano())
+	defer repo.Delete(ctx, userID)
+
+	first, err := repo.FindByUserID(ctx, userID)
+	require.NoError(t, err)
+	second, err := repo.FindByUserID(ctx, userID)
+	require.NoError(t, err)
+
+	first.AddItem("prod-1", "Mug", 1, 10.0)
+	require.NoError(t, repo.Save(ctx, first))
+	assert.Equal(t, int64(1), first.Version)
+
+	second.AddItem("prod-2", "Plate", 1, 5.0)
+	err = repo.Save(ctx, second)
+	require.Error(t, err)
+	assert.Equal(t, errors.ErrConflict, err.(*errors.AppError).Code)
+	assert.Equal(t, int64(0), second.Version)
+
+	stored, err := repo.FindByUserID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stored.Version)
+	assert.Equal(t, 1, stored.Quantity("prod-1"))
+	assert.Equal(t, 0, stored.Quantity("prod-2"))
+}
+
+// TestRedisCartRepository_ConcurrentAdds has writers retry load, add and
+// save until their save goes through; every add must be in the final cart
+func TestRedisCartRepository_ConcurrentAdds(t *testing.T) {
+	const writers, adds = 8, 50
+
+	repo := newRepository(t)
+	ctx := context.Background()
+	userID := fmt.Sprintf("test-user-%d", time.Now().UnixNano())
+	defer repo.Delete(ctx, userID)
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < adds; i++ {
+				for {
+					cart, err := repo.FindByUserID(ctx, userID)
+					if !assert.NoError(t, err) {
+						return
+					}
+					cart.AddItem("prod-1", "Mug", 1, 10.0)
+					err = repo.Save(ctx, cart)
+					if err == nil {
+						break
+					}
+					if !assert.Equal(t, errors.ErrConflict, err.(*errors.AppError).Code) {
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	cart, err := repo.FindByUserID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, writers*adds, cart.Quantity("prod-1"))
+	assert.Equal(t, int64(writers*adds), cart.Version)
+}
+
+func TestRedisCartRepository_GuestCartsAreVersionedToo(t *testing.T) {
+	repo := newRepository(t)
+	ctx := context.Background()
+	guestToken := fmt.Sprintf("test-guest-%d", time.Now().UnixNano())
+	defer repo.DeleteGuest(ctx, guestToken)
+
+	cart, err := repo.FindByGuestToken(ctx, guestToken)
+	require.NoError(t, err)
+	cart.AddItem("prod-1", "Mug", 1, 10.0)
+	require.NoError(t, repo.Save(ctx, cart))
+
+	stale := domain.NewGuestCart(guestToken)
+	err = repo.Save(ctx, stale)
+	require.Error(t, err)
+	assert.Equal(t, errors.ErrConflict, err.(*errors.AppError).Code)
+}
+
+func TestRedisCartRepository_SaveMergeSavesBothOrNeither(t *testing.T) {
+	repo := newRepository(t)
+	ctx := context.Background()
+	userID := fmt.Sprintf("test-user-%d", time.Now().UnixNano())
+	guestToken := fmt.Sprintf("test-guest-%d", time.Now().UnixNano())
+	defer repo.Delete(ctx, userID)
+	defer repo.DeleteGuest(ctx, guestToken)
+
+	guest, err := repo.FindByGuestToken(ctx, guestToken)
+	require.NoError(t, err)
+	guest.AddItem("prod-1", "Mug", 1, 10.0)
+	require.NoError(t, repo.Save(ctx, guest))
+
+	// A copy of the guest cart loaded before the save is stale
+	stale := domain.NewGuestCart(guestToken)
+	cart := domain.NewCart(userID)
+	cart.AddItem("prod-1", "Mug", 1, 10.0)
+	stale.MarkMerged(userID, nil)
+	err = repo.SaveMerge(ctx, cart, stale)
+	require.Error(t, err)
+	assert.Equal(t, errors.ErrConflict, err.(*errors.AppError).Code)
+	stored, err := repo.FindByUserID(ctx, userID)
+	require.NoError(t, err)
+	assert.Empty(t, stored.Items)
+
+	guest.MarkMerged(userID, []domain.ItemChange{{ProductID: "prod-1", Reason: domain.ItemAdded, GuestQuantity: 1, Quantity: 1}})
+	require.NoError(t, repo.SaveMerge(ctx, cart, guest))
+	stored, err = repo.FindByUserID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stored.Quantity("prod-1"))
+	merged, err := repo.FindByGuestToken(ctx, guestToken)
+	require.NoError(t, err)
+	assert.True(t, merged.MergedWith(userID))
+	assert.Len(t, merged.MergeChanges, 1)
+}
+
+func TestRedisListRepository_SaveListRejectsStaleCopies(t *testing.T) {
+	repo := infrastructure.NewRedisListRepository(newRepository(t))
+	ctx := context.Background()
+
+	list, err := domain.NewShoppingList(fmt.Sprintf("test-user-%d", time.Now().UnixNano()), "Wishes", domain.ListWishlist)
+	require.NoError(t, err)
+	defer repo.DeleteList(ctx, list)
+	require.NoError(t, repo.SaveList(ctx, list))
+
+	first, err := repo.FindList(ctx, list.ID)
+	require.NoError(t, err)
+	second, err := repo.FindList(ctx, list.ID)
+	require.NoError(t, err)
+
+	first.AddItem("prod-1", "Mug", 1, 10.0)
+	require.NoError(t, repo.SaveList(ctx, first))
+	assert.Equal(t, int64(2), first.Version)
+
+	second.AddItem("prod-2", "Plate", 1, 5.0)
+	err = repo.SaveList(ctx, second)
+	require.Error(t, err)
+	assert.Equal(t, errors.ErrConflict, err.(*errors.AppError).Code)
+	assert.Equal(t, int64(1), second.Version)
+
+	// A second list created under the same ID is stale too
+	err = repo.SaveList(ctx, &domain.ShoppingList{ID: list.ID, UserID: list.UserID, Kind: domain.ListWishlist})
+	require.Error(t, err)
+	assert.Equal(t, errors.ErrConflict, err.(*errors.AppError).Code)
+}
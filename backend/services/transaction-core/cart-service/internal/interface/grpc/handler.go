@@ -6,6 +6,7 @@ import (
 	"github.com/titan-commerce/backend/cart-service/internal/application"
 	"github.com/titan-commerce/backend/cart-service/internal/domain"
 	pb "github.com/titan-commerce/backend/cart-service/proto/cart/v1"
+	"github.com/titan-commerce/backend/pkg/errors"
 	"github.com/titan-commerce/backend/pkg/logger"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -13,22 +14,34 @@ import (
 
 type CartServiceServer struct {
 	pb.UnimplementedCartServiceServer
-	service *application.CartService
-	logger  *logger.Logger
+	service     *application.CartService
+	abandonment *application.AbandonmentService
+	logger      *logger.Logger
 }
 
-func NewCartServiceServer(service *application.CartService, logger *logger.Logger) *CartServiceServer {
+func NewCartServiceServer(service *application.CartService, abandonment *application.AbandonmentService, logger *logger.Logger) *CartServiceServer {
 	return &CartServiceServer{
-		service: service,
-		logger:  logger,
+		service:     service,
+		abandonment: abandonment,
+		logger:      logger,
 	}
 }
 
+// AddItem adds to the user's cart or, without a user ID, to the cart of the
+// anonymous session named by the guest token. The other cart RPCs pick
+// their cart the same way. Items are priced by the pricing service, not by
+// the client.
 func (s *CartServiceServer) AddItem(ctx context.Context, req *pb.AddItemRequest) (*pb.AddItemResponse, error) {
-	cart, err := s.service.AddToCart(ctx, req.UserId, req.ProductId, req.ProductName, int(req.Quantity), req.Price)
+	var cart *domain.Cart
+	var err error
+	if req.UserId == "" {
+		cart, err = s.service.AddToGuestCart(ctx, req.GuestToken, req.ProductId, req.ProductName, int(req.Quantity), req.ExpectedVersion)
+	} else {
+		cart, err = s.service.AddToCart(ctx, req.UserId, req.ProductId, req.ProductName, int(req.Quantity), req.ExpectedVersion)
+	}
 	if err != nil {
 		s.logger.Error(err, "failed to add item to cart")
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, toStatus(err)
 	}
 
 	return &pb.AddItemResponse{
@@ -37,10 +50,16 @@ func (s *CartServiceServer) AddItem(ctx context.Context, req *pb.AddItemRequest)
 }
 
 func (s *CartServiceServer) RemoveItem(ctx context.Context, req *pb.RemoveItemRequest) (*pb.RemoveItemResponse, error) {
-	cart, err := s.service.RemoveFromCart(ctx, req.UserId, req.ProductId)
+	var cart *domain.Cart
+	var err error
+	if req.UserId == "" {
+		cart, err = s.service.RemoveFromGuestCart(ctx, req.GuestToken, req.ProductId, req.ExpectedVersion)
+	} else {
+		cart, err = s.service.RemoveFromCart(ctx, req.UserId, req.ProductId, req.ExpectedVersion)
+	}
 	if err != nil {
 		s.logger.Error(err, "failed to remove item from cart")
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, toStatus(err)
 	}
 
 	return &pb.RemoveItemResponse{
@@ -48,8 +67,32 @@ func (s *CartServiceServer) RemoveItem(ctx context.Context, req *pb.RemoveItemRe
 	}, nil
 }
 
+func (s *CartServiceServer) UpdateItem(ctx context.Context, req *pb.UpdateItemRequest) (*pb.UpdateItemResponse, error) {
+	var cart *domain.Cart
+	var err error
+	if req.UserId == "" {
+		cart, err = s.service.UpdateGuestQuantity(ctx, req.GuestToken, req.ProductId, int(req.Quantity), req.ExpectedVersion)
+	} else {
+		cart, err = s.service.UpdateQuantity(ctx, req.UserId, req.ProductId, int(req.Quantity), req.ExpectedVersion)
+	}
+	if err != nil {
+		s.logger.Error(err, "failed to update cart item")
+		return nil, toStatus(err)
+	}
+
+	return &pb.UpdateItemResponse{
+		Cart: domainToProto(cart),
+	}, nil
+}
+
 func (s *CartServiceServer) GetCart(ctx context.Context, req *pb.GetCartRequest) (*pb.GetCartResponse, error) {
-	cart, err := s.service.GetCart(ctx, req.UserId)
+	var cart *domain.Cart
+	var err error
+	if req.UserId == "" {
+		cart, err = s.service.GetGuestCart(ctx, req.GuestToken)
+	} else {
+		cart, err = s.service.GetCart(ctx, req.UserId)
+	}
 	if err != nil {
 		s.logger.Error(err, "failed to get cart")
 		return nil, status.Error(codes.NotFound, err.Error())
@@ -60,8 +103,18 @@ func (s *CartServiceServer) GetCart(ctx context.Context, req *pb.GetCartRequest)
 	}, nil
 }
 
+// ClearCart empties the cart; checkout passes the order it placed so a
+// cart reported abandoned is counted as recovered
 func (s *CartServiceServer) ClearCart(ctx context.Context, req *pb.ClearCartRequest) (*pb.ClearCartResponse, error) {
-	if err := s.service.ClearCart(ctx, req.UserId); err != nil {
+	var err error
+	if req.UserId == "" {
+		err = s.service.ClearGuestCart(ctx, req.GuestToken)
+	} else if req.OrderId != "" {
+		err = s.abandonment.CheckedOut(ctx, req.UserId, req.OrderId)
+	} else {
+		err = s.service.ClearCart(ctx, req.UserId)
+	}
+	if err != nil {
 		s.logger.Error(err, "failed to clear cart")
 		return nil, status.Error(codes.Internal, err.Error())
 	}
@@ -69,6 +122,33 @@ func (s *CartServiceServer) ClearCart(ctx context.Context, req *pb.ClearCartRequ
 	return &pb.ClearCartResponse{Success: true}, nil
 }
 
+// MergeGuestCart moves the guest cart into the user's cart after login and
+// lists what happened to each guest line
+func (s *CartServiceServer) MergeGuestCart(ctx context.Context, req *pb.MergeGuestCartRequest) (*pb.MergeGuestCartResponse, error) {
+	cart, changes, err := s.service.MergeGuestCart(ctx, req.GuestToken, req.UserId)
+	if err != nil {
+		s.logger.Error(err, "failed to merge guest cart")
+		return nil, toStatus(err)
+	}
+
+	resp := &pb.MergeGuestCartResponse{
+		Cart:    domainToProto(cart),
+		Changes: make([]*pb.CartItemChange, len(changes)),
+	}
+	for i, change := range changes {
+		resp.Changes[i] = &pb.CartItemChange{
+			ProductId:        change.ProductID,
+			ProductName:      change.ProductName,
+			Reason:           string(change.Reason),
+			GuestQuantity:    int32(change.GuestQuantity),
+			PreviousQuantity: int32(change.PreviousQuantity),
+			Quantity:         int32(change.Quantity),
+			Capped:           change.Capped,
+		}
+	}
+	return resp, nil
+}
+
 func domainToProto(cart *domain.Cart) *pb.Cart {
 	items := make([]*pb.CartItem, len(cart.Items))
 	for i, item := range cart.Items {
@@ -77,12 +157,36 @@ func domainToProto(cart *domain.Cart) *pb.Cart {
 			ProductName: item.ProductName,
 			Price:       item.UnitPrice,
 			Quantity:    int32(item.Quantity),
+			Status:      string(item.Status),
+		}
+	}
+
+	warnings := make([]*pb.CartWarning, len(cart.Warnings))
+	for i, warning := range cart.Warnings {
+		warnings[i] = &pb.CartWarning{
+			ProductId:   warning.ProductID,
+			ProductName: warning.ProductName,
+			Type:        string(warning.Type),
+			Message:     warning.Message,
+			OldPrice:    warning.OldPrice,
+			NewPrice:    warning.NewPrice,
+			Available:   int32(warning.Available),
 		}
 	}
 
 	return &pb.Cart{
 		UserId:      cart.UserID,
+		GuestToken:  cart.GuestToken,
 		Items:       items,
 		TotalAmount: cart.Total,
+		Warnings:    warnings,
+		Version:     cart.Version,
+	}
+}
+
+func toStatus(err error) error {
+	if appErr, ok := err.(*errors.AppError); ok {
+		return appErr.ToGRPCError()
 	}
+	return status.Error(codes.Internal, err.Error())
 }
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/titan-commerce/backend/cart-service/internal/application"
+	"github.com/titan-commerce/backend/cart-service/internal/domain"
+	pb "github.com/titan-commerce/backend/cart-service/proto/cart/v1"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+type ListServiceServer struct {
+	pb.UnimplementedListServiceServer
+	service *application.ListService
+	logger  *logger.Logger
+}
+
+func NewListServiceServer(service *application.ListService, logger *logger.Logger) *ListServiceServer {
+	return &ListServiceServer{
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (s *ListServiceServer) CreateList(ctx context.Context, req *pb.CreateListRequest) (*pb.ShoppingList, error) {
+	list, err := s.service.CreateList(ctx, req.UserId, req.Name, domain.ListKind(req.Kind))
+	if err != nil {
+		s.logger.Error(err, "failed to create list")
+		return nil, toStatus(err)
+	}
+	return listToProto(list, true), nil
+}
+
+func (s *ListServiceServer) GetLists(ctx context.Context, req *pb.GetListsRequest) (*pb.GetListsResponse, error) {
+	lists, err := s.service.GetLists(ctx, req.UserId)
+	if err != nil {
+		s.logger.Error(err, "failed to get lists")
+		return nil, toStatus(err)
+	}
+
+	resp := &pb.GetListsResponse{Lists: make([]*pb.ShoppingList, len(lists))}
+	for i, list := range lists {
+		resp.Lists[i] = listToProto(list, true)
+	}
+	return resp, nil
+}
+
+func (s *ListServiceServer) GetList(ctx context.Context, req *pb.ListRequest) (*pb.ShoppingList, error) {
+	list, err := s.service.GetList(ctx, req.UserId, req.ListId)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return listToProto(list, true), nil
+}
+
+func (s *ListServiceServer) DeleteList(ctx context.Context, req *pb.ListRequest) (*pb.DeleteListResponse, error) {
+	if err := s.service.DeleteList(ctx, req.UserId, req.ListId); err != nil {
+		s.logger.Error(err, "failed to delete list")
+		return nil, toStatus(err)
+	}
+	return &pb.DeleteListResponse{Success: true}, nil
+}
+
+func (s *ListServiceServer) AddToList(ctx context.Context, req *pb.ListItemRequest) (*pb.ShoppingList, error) {
+	list, err := s.service.AddToList(ctx, req.UserId, req.ListId, req.ProductId, req.ProductName, int(req.Quantity))
+	if err != nil {
+		s.logger.Error(err, "failed to add item to list")
+		return nil, toStatus(err)
+	}
+	return listToProto(list, true), nil
+}
+
+func (s *ListServiceServer) RemoveFromList(ctx context.Context, req *pb.ListItemRequest) (*pb.ShoppingList, error) {
+	list, err := s.service.RemoveFromList(ctx, req.UserId, req.ListId, req.ProductId)
+	if err != nil {
+		s.logger.Error(err, "failed to remove item from list")
+		return nil, toStatus(err)
+	}
+	return listToProto(list, true), nil
+}
+
+func (s *ListServiceServer) MoveToList(ctx context.Context, req *pb.ListItemRequest) (*pb.MoveResponse, error) {
+	var list *domain.ShoppingList
+	var cart *domain.Cart
+	var err error
+	if req.ListId == "" {
+		list, cart, err = s.service.SaveForLater(ctx, req.UserId, req.ProductId)
+	} else {
+		list, cart, err = s.service.MoveToList(ctx, req.UserId, req.ProductId, req.ListId)
+	}
+	if err != nil {
+		s.logger.Error(err, "failed to move item to list")
+		return nil, toStatus(err)
+	}
+	return &pb.MoveResponse{List: listToProto(list, true), Cart: domainToProto(cart)}, nil
+}
+
+func (s *ListServiceServer) MoveToCart(ctx context.Context, req *pb.ListItemRequest) (*pb.MoveResponse, error) {
+	list, cart, err := s.service.MoveToCart(ctx, req.UserId, req.ListId, req.ProductId)
+	if err != nil {
+		s.logger.Error(err, "failed to move item to cart")
+		return nil, toStatus(err)
+	}
+	return &pb.MoveResponse{List: listToProto(list, true), Cart: domainToProto(cart)}, nil
+}
+
+func (s *ListServiceServer) ShareList(ctx context.Context, req *pb.ShareListRequest) (*pb.ShareListResponse, error) {
+	if !req.Shared {
+		if err := s.service.UnshareList(ctx, req.UserId, req.ListId); err != nil {
+			s.logger.Error(err, "failed to unshare list")
+			return nil, toStatus(err)
+		}
+		return &pb.ShareListResponse{}, nil
+	}
+
+	token, err := s.service.ShareList(ctx, req.UserId, req.ListId)
+	if err != nil {
+		s.logger.Error(err, "failed to share list")
+		return nil, toStatus(err)
+	}
+	return &pb.ShareListResponse{ShareToken: token}, nil
+}
+
+func (s *ListServiceServer) GetSharedList(ctx context.Context, req *pb.SharedListRequest) (*pb.ShoppingList, error) {
+	list, err := s.service.GetSharedList(ctx, req.ShareToken)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return listToProto(list, false), nil
+}
+
+func (s *ListServiceServer) SubscribeToList(ctx context.Context, req *pb.SharedListRequest) (*pb.ShoppingList, error) {
+	list, err := s.service.SubscribeToList(ctx, req.UserId, req.ShareToken)
+	if err != nil {
+		s.logger.Error(err, "failed to subscribe to list")
+		return nil, toStatus(err)
+	}
+	return listToProto(list, false), nil
+}
+
+// listToProto leaves the share token out for anyone but the owner
+func listToProto(list *domain.ShoppingList, owner bool) *pb.ShoppingList {
+	items := make([]*pb.ListItem, len(list.Items))
+	for i, item := range list.Items {
+		items[i] = &pb.ListItem{
+			ProductId:   item.ProductID,
+			ProductName: item.ProductName,
+			Quantity:    int32(item.Quantity),
+			AddedPrice:  item.AddedPrice,
+		}
+	}
+
+	resp := &pb.ShoppingList{
+		ListId: list.ID,
+		UserId: list.UserID,
+		Name:   list.Name,
+		Kind:   string(list.Kind),
+		Items:  items,
+	}
+	if owner {
+		resp.ShareToken = list.ShareToken
+	}
+	return resp
+}
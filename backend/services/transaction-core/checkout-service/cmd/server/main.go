@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 
 	"github.com/titan-commerce/backend/checkout-service/internal/application"
+	"github.com/titan-commerce/backend/checkout-service/internal/domain"
+	"github.com/titan-commerce/backend/checkout-service/internal/infrastructure/clients"
 	"github.com/titan-commerce/backend/checkout-service/internal/infrastructure/mock"
+	"github.com/titan-commerce/backend/checkout-service/internal/infrastructure/postgres"
 	"github.com/titan-commerce/backend/checkout-service/internal/interface/grpc"
 	pb "github.com/titan-commerce/backend/checkout-service/proto/checkout/v1"
 	"github.com/titan-commerce/backend/pkg/config"
@@ -32,14 +37,128 @@ func main() {
 
 	log.Info("Checkout Service starting - Saga Coordinator ready")
 
-	// Initialize Clients (Mock for now, replace with real gRPC clients in production)
-	invClient := &mock.MockInventoryClient{}
-	payClient := &mock.MockPaymentClient{}
+	// Initialize Clients (orders and cards are mocked for now)
+
+	// Stock is reserved with inventory-service, under the session ID
+	inventoryAddr := os.Getenv("INVENTORY_SERVICE_ADDR")
+	if inventoryAddr == "" {
+		inventoryAddr = "inventory-service:9000"
+	}
+	invClient, err := clients.NewInventoryClient(inventoryAddr)
+	if err != nil {
+		log.Fatal(err, "Failed to initialize inventory-service client")
+	}
+	defer invClient.Close()
+
+	// WALLET tenders are held in wallet-service escrow
+	walletAddr := os.Getenv("WALLET_SERVICE_ADDR")
+	if walletAddr == "" {
+		walletAddr = "wallet-service:9000"
+	}
+	walletClient, err := clients.NewWalletClient(walletAddr)
+	if err != nil {
+		log.Fatal(err, "Failed to initialize wallet-service client")
+	}
+	defer walletClient.Close()
+
+	// COINS tenders are spent from the gamification-service coin wallet
+	coinsAddr := os.Getenv("GAMIFICATION_SERVICE_ADDR")
+	if coinsAddr == "" {
+		coinsAddr = "gamification-service:9000"
+	}
+	coinsClient, err := clients.NewCoinsClient(coinsAddr)
+	if err != nil {
+		log.Fatal(err, "Failed to initialize gamification-service client")
+	}
+	defer coinsClient.Close()
+
+	tenderClients := map[domain.TenderType]application.TenderClient{
+		domain.TenderWallet: walletClient,
+		domain.TenderCoins:  coinsClient,
+		// payment-service charges in one step and has no authorization to
+		// capture later, so cards are not held through it yet
+		domain.TenderCard: &mock.MockTenderClient{Prefix: "auth_"},
+	}
 	ordClient := &mock.MockOrderClient{}
-	crtClient := &mock.MockCartClient{}
+
+	// Carts come from cart-service, their lines' categories from product-service
+	cartAddr := os.Getenv("CART_SERVICE_ADDR")
+	if cartAddr == "" {
+		cartAddr = "cart-service:9000"
+	}
+	productAddr := os.Getenv("PRODUCT_SERVICE_ADDR")
+	if productAddr == "" {
+		productAddr = "product-service:9000"
+	}
+	crtClient, err := clients.NewCartClient(cartAddr, productAddr)
+	if err != nil {
+		log.Fatal(err, "Failed to initialize cart-service client")
+	}
+	defer crtClient.Close()
+
+	// Saga state survives restarts in Postgres
+	sessionRepo, err := postgres.NewSessionRepository(cfg.DatabaseURL, postgres.DefaultLeaseTTL, log)
+	if err != nil {
+		log.Fatal(err, "Failed to connect to session store")
+	}
+	sagaStore, err := postgres.NewSagaStore(cfg.DatabaseURL, log)
+	if err != nil {
+		log.Fatal(err, "Failed to connect to saga store")
+	}
+
+	quoteRepo, err := postgres.NewQuoteRepository(cfg.DatabaseURL, log)
+	if err != nil {
+		log.Fatal(err, "Failed to connect to quote store")
+	}
+
+	// Quotes are priced by campaign-, coupon-, voucher- and shipping-service.
+	// A quote fails rather than leave out a component that is unavailable.
+	campaignURL := os.Getenv("CAMPAIGN_SERVICE_URL")
+	if campaignURL == "" {
+		campaignURL = "http://campaign-service:8080"
+	}
+	couponURL := os.Getenv("COUPON_SERVICE_URL")
+	if couponURL == "" {
+		couponURL = "http://coupon-service:8080"
+	}
+	voucherURL := os.Getenv("VOUCHER_SERVICE_URL")
+	if voucherURL == "" {
+		voucherURL = "http://voucher-service:8080"
+	}
+
+	shippingAddr := os.Getenv("SHIPPING_SERVICE_ADDR")
+	if shippingAddr == "" {
+		shippingAddr = "shipping-service:9000"
+	}
+	shippingClient, err := clients.NewShippingClient(shippingAddr)
+	if err != nil {
+		log.Fatal(err, "Failed to initialize shipping-service client")
+	}
+	defer shippingClient.Close()
+
+	// There is no tax service, so tax is one configured rate. It has no
+	// default: checkouts are not priced without tax by mistake.
+	taxRate, err := strconv.ParseFloat(os.Getenv("TAX_RATE"), 64)
+	if err != nil {
+		log.Fatal(err, "TAX_RATE must be set, e.g. 0.08 for 8%")
+	}
+	taxClient, err := clients.NewRateTaxClient(taxRate)
+	if err != nil {
+		log.Fatal(err, "Invalid TAX_RATE")
+	}
+
+	pricing := application.NewPricingEngine(clients.NewCampaignClient(campaignURL), clients.NewCouponClient(couponURL),
+		clients.NewVoucherClient(voucherURL), shippingClient, taxClient, application.DefaultQuoteTTL)
 
 	// Initialize Application Service (Saga Orchestrator)
-	checkoutService := application.NewCheckoutService(invClient, payClient, ordClient, crtClient, log)
+	checkoutService, err := application.NewCheckoutService(sessionRepo, sagaStore, quoteRepo, pricing, invClient, tenderClients, ordClient, crtClient, log)
+	if err != nil {
+		log.Fatal(err, "Failed to initialize checkout service")
+	}
+
+	// Resume checkouts left incomplete by this or another replica
+	recoveryCtx, stopRecovery := context.WithCancel(context.Background())
+	go checkoutService.RunRecovery(recoveryCtx, application.DefaultRecoveryInterval)
 
 	// Initialize gRPC server
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
@@ -66,6 +185,7 @@ func main() {
 
 	log.Info("Shutting down Checkout Service")
 	grpcServer.GracefulStop()
+	stopRecovery()
+	checkoutService.Close()
 	log.Info("Checkout Service stopped")
 }
-
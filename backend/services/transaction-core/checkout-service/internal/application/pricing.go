@@ -0,0 +1,333 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/titan-commerce/backend/checkout-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// DefaultQuoteTTL is how long a quote's price stays locked
+const DefaultQuoteTTL = 10 * time.Minute
+
+// Campaign and coupon kinds the pricing engine understands
+const (
+	CampaignDiscount = "DISCOUNT"
+	CampaignBuyXGetY = "BUY_X_GET_Y"
+	CampaignBundle   = "BUNDLE_DEAL"
+
+	CouponPercentage   = "PERCENTAGE"
+	CouponFixed        = "FIXED"
+	CouponFreeShipping = "FREE_SHIPPING"
+
+	VoucherDiscount     = "DISCOUNT"
+	VoucherFreeShipping = "FREE_SHIPPING"
+	VoucherGiftCard     = "GIFT_CARD"
+)
+
+// CampaignRule is an active campaign's pricing rule, as campaign-service
+// defines it. Products empty means every product.
+type CampaignRule struct {
+	CampaignID      string
+	Name            string
+	Type            string
+	Products        []string
+	DiscountPercent int
+	MinPurchase     float64
+	MaxDiscount     float64
+	BundleProducts  []string
+	BundlePrice     float64
+	BuyQuantity     int
+	GetQuantity     int
+	GetProductID    string // Empty for the product bought
+}
+
+// CouponTerms are a coupon's terms, as coupon-service defines them. The
+// applicable lists empty mean every product.
+type CouponTerms struct {
+	Code                 string
+	Type                 string
+	Value                float64
+	MinOrderValue        float64
+	MaxDiscount          float64
+	ApplicableProducts   []string
+	ApplicableCategories []string
+}
+
+// VoucherTerms are a voucher's terms, as voucher-service defines them
+type VoucherTerms struct {
+	Code  string
+	Type  string
+	Value float64
+}
+
+// Pricing components. Coupon and voucher lookups return an error when the
+// code cannot be used by the user, e.g. it expired or was used up.
+type CampaignClient interface {
+	ActiveCampaigns(ctx context.Context, productIDs []string) ([]CampaignRule, error)
+}
+
+// CouponClient looks coupons up for quotes and uses them up at checkout.
+// ApplyCoupon and ReleaseCoupon act once per key; releasing a coupon never
+// applied under the key does nothing.
+type CouponClient interface {
+	GetCoupon(ctx context.Context, code, userID string) (*CouponTerms, error)
+	ApplyCoupon(ctx context.Context, key, code, userID string, orderTotal float64) error
+	ReleaseCoupon(ctx context.Context, key, code, userID string) error
+}
+
+// VoucherClient looks vouchers up for quotes and redeems them at checkout,
+// once per key like CouponClient
+type VoucherClient interface {
+	GetVoucher(ctx context.Context, code, userID string) (*VoucherTerms, error)
+	RedeemVoucher(ctx context.Context, key, code, userID string) error
+	ReleaseVoucher(ctx context.Context, key, code, userID string) error
+}
+
+type ShippingRateClient interface {
+	ShippingRate(ctx context.Context, shippingAddress string, lines []domain.CartLine) (float64, error)
+}
+
+type TaxClient interface {
+	// CalculateTax returns the tax on each line's discounted amount, in line
+	// order, and on the shipping cost after discounts
+	CalculateTax(ctx context.Context, shippingAddress string, lines []domain.QuoteLine, shipping float64) ([]float64, float64, error)
+}
+
+// QuoteRequest says what to price
+type QuoteRequest struct {
+	UserID          string
+	ShippingAddress string
+	CouponCode      string
+	VoucherCode     string
+	Lines           []domain.CartLine
+}
+
+// PricingEngine prices carts. Campaigns apply first, then the coupon and the
+// voucher on what is left; tax is charged on the discounted amounts, and
+// gift cards pay for the taxed total.
+type PricingEngine struct {
+	campaigns CampaignClient
+	coupons   CouponClient
+	vouchers  VoucherClient
+	shipping  ShippingRateClient
+	tax       TaxClient
+	ttl       time.Duration
+}
+
+func NewPricingEngine(campaigns CampaignClient, coupons CouponClient, vouchers VoucherClient, shipping ShippingRateClient, tax TaxClient, ttl time.Duration) *PricingEngine {
+	if ttl <= 0 {
+		ttl = DefaultQuoteTTL
+	}
+	return &PricingEngine{
+		campaigns: campaigns,
+		coupons:   coupons,
+		vouchers:  vouchers,
+		shipping:  shipping,
+		tax:       tax,
+		ttl:       ttl,
+	}
+}
+
+// Quote prices the request. The quote is not saved.
+func (e *PricingEngine) Quote(ctx context.Context, req QuoteRequest) (*domain.Quote, error) {
+	quote, err := domain.NewQuote(req.UserID, req.ShippingAddress, req.Lines, e.ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := e.campaigns.ActiveCampaigns(ctx, quote.ProductIDs())
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to load campaigns", err)
+	}
+	for _, rule := range rules {
+		applyCampaign(quote, rule)
+	}
+
+	shipping, err := e.shipping.ShippingRate(ctx, req.ShippingAddress, req.Lines)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to get shipping rate", err)
+	}
+	quote.SetShippingCost(shipping)
+
+	var voucher *VoucherTerms
+	if req.CouponCode != "" {
+		coupon, err := e.coupons.GetCoupon(ctx, req.CouponCode, req.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if err := applyCoupon(quote, coupon); err != nil {
+			return nil, err
+		}
+		quote.CouponCode = coupon.Code
+	}
+	if req.VoucherCode != "" {
+		voucher, err = e.vouchers.GetVoucher(ctx, req.VoucherCode, req.UserID)
+		if err != nil {
+			return nil, err
+		}
+		applyVoucher(quote, voucher)
+		quote.VoucherCode = voucher.Code
+	}
+
+	lineTax, shippingTax, err := e.tax.CalculateTax(ctx, req.ShippingAddress, quote.Lines, quote.ShippingCost-quote.ShippingDiscount)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to calculate tax", err)
+	}
+	if err := quote.SetTax(lineTax, shippingTax); err != nil {
+		return nil, err
+	}
+
+	if voucher != nil && voucher.Type == VoucherGiftCard {
+		quote.ApplyCredit(domain.Adjustment{
+			Source: domain.AdjustmentVoucher, Reference: voucher.Code,
+			Reason: fmt.Sprintf("Gift card %s", voucher.Code), Amount: voucher.Value,
+		})
+	}
+	return quote, nil
+}
+
+// Redeem uses up the quote's coupon and voucher under key, so that no other
+// checkout can use them too
+func (e *PricingEngine) Redeem(ctx context.Context, key string, quote *domain.Quote) error {
+	if quote.CouponCode != "" {
+		if err := e.coupons.ApplyCoupon(ctx, key, quote.CouponCode, quote.UserID, quote.Subtotal); err != nil {
+			return fmt.Errorf("coupon %s: %w", quote.CouponCode, err)
+		}
+	}
+	if quote.VoucherCode != "" {
+		if err := e.vouchers.RedeemVoucher(ctx, key, quote.VoucherCode, quote.UserID); err != nil {
+			return fmt.Errorf("voucher %s: %w", quote.VoucherCode, err)
+		}
+	}
+	return nil
+}
+
+// Release gives back what Redeem used up under key, newest first
+func (e *PricingEngine) Release(ctx context.Context, key string, quote *domain.Quote) error {
+	if quote.VoucherCode != "" {
+		if err := e.vouchers.ReleaseVoucher(ctx, key, quote.VoucherCode, quote.UserID); err != nil {
+			return fmt.Errorf("voucher %s: %w", quote.VoucherCode, err)
+		}
+	}
+	if quote.CouponCode != "" {
+		if err := e.coupons.ReleaseCoupon(ctx, key, quote.CouponCode, quote.UserID); err != nil {
+			return fmt.Errorf("coupon %s: %w", quote.CouponCode, err)
+		}
+	}
+	return nil
+}
+
+// applyCampaign applies one campaign rule. Rules the cart does not qualify
+// for are skipped silently; campaigns apply automatically.
+func applyCampaign(quote *domain.Quote, rule CampaignRule) {
+	adj := domain.Adjustment{Source: domain.AdjustmentCampaign, Reference: rule.CampaignID}
+
+	switch rule.Type {
+	case CampaignDiscount:
+		lines := quote.Matching(rule.Products, nil)
+		remaining := quote.Remaining(lines)
+		if rule.DiscountPercent <= 0 || remaining == 0 || remaining < rule.MinPurchase {
+			return
+		}
+		adj.Amount = remaining * float64(rule.DiscountPercent) / 100
+		if rule.MaxDiscount > 0 {
+			adj.Amount = math.Min(adj.Amount, rule.MaxDiscount)
+		}
+		adj.Reason = fmt.Sprintf("%s: %d%% off", rule.Name, rule.DiscountPercent)
+		quote.ApplyDiscount(adj, lines)
+
+	case CampaignBuyXGetY:
+		if rule.BuyQuantity <= 0 || rule.GetQuantity <= 0 {
+			return
+		}
+		adj.Reason = fmt.Sprintf("%s: buy %d get %d free", rule.Name, rule.BuyQuantity, rule.GetQuantity)
+		for _, i := range quote.Matching(rule.Products, nil) {
+			line := quote.Lines[i]
+			// The free units come from the product bought unless the rule
+			// names another one
+			if rule.GetProductID == "" || rule.GetProductID == line.ProductID {
+				free := line.Quantity / (rule.BuyQuantity + rule.GetQuantity) * rule.GetQuantity
+				adj.Amount = float64(free) * line.UnitPrice
+				quote.ApplyDiscount(adj, []int{i})
+				continue
+			}
+			for _, j := range quote.Matching([]string{rule.GetProductID}, nil) {
+				free := min(line.Quantity/rule.BuyQuantity*rule.GetQuantity, quote.Lines[j].Quantity)
+				adj.Amount = float64(free) * quote.Lines[j].UnitPrice
+				quote.ApplyDiscount(adj, []int{j})
+			}
+		}
+
+	case CampaignBundle:
+		lines := quote.Matching(rule.BundleProducts, nil)
+		if len(rule.BundleProducts) == 0 || len(lines) < len(rule.BundleProducts) {
+			return
+		}
+		bundles := math.MaxInt
+		var listPrice float64
+		for _, i := range lines {
+			bundles = min(bundles, quote.Lines[i].Quantity)
+			listPrice += quote.Lines[i].UnitPrice
+		}
+		if listPrice <= rule.BundlePrice {
+			return
+		}
+		adj.Amount = float64(bundles) * (listPrice - rule.BundlePrice)
+		adj.Reason = fmt.Sprintf("%s: bundle of %d for %.2f", rule.Name, len(lines), rule.BundlePrice)
+		quote.ApplyDiscount(adj, lines)
+	}
+}
+
+// applyCoupon applies a coupon, which unlike a campaign was asked for, so a
+// cart that does not qualify is an error
+func applyCoupon(quote *domain.Quote, coupon *CouponTerms) error {
+	adj := domain.Adjustment{Source: domain.AdjustmentCoupon, Reference: coupon.Code}
+	lines := quote.Matching(coupon.ApplicableProducts, coupon.ApplicableCategories)
+	remaining := quote.Remaining(lines)
+	if remaining == 0 {
+		return errors.New(errors.ErrInvalidInput, fmt.Sprintf("coupon %s does not apply to any item in the cart", coupon.Code))
+	}
+	if remaining < coupon.MinOrderValue {
+		return errors.New(errors.ErrInvalidInput,
+			fmt.Sprintf("coupon %s requires a minimum order of %.2f", coupon.Code, coupon.MinOrderValue))
+	}
+
+	switch coupon.Type {
+	case CouponPercentage:
+		adj.Amount = remaining * coupon.Value / 100
+		if coupon.MaxDiscount > 0 {
+			adj.Amount = math.Min(adj.Amount, coupon.MaxDiscount)
+		}
+		adj.Reason = fmt.Sprintf("Coupon %s: %g%% off", coupon.Code, coupon.Value)
+		quote.ApplyDiscount(adj, lines)
+	case CouponFixed:
+		adj.Amount = coupon.Value
+		adj.Reason = fmt.Sprintf("Coupon %s: %.2f off", coupon.Code, coupon.Value)
+		quote.ApplyDiscount(adj, lines)
+	case CouponFreeShipping:
+		adj.Amount = coupon.Value
+		adj.Reason = fmt.Sprintf("Coupon %s: free shipping", coupon.Code)
+		quote.ApplyShippingDiscount(adj)
+	default:
+		return errors.New(errors.ErrInvalidInput, fmt.Sprintf("unsupported coupon type %s", coupon.Type))
+	}
+	return nil
+}
+
+// applyVoucher applies a voucher's discount. Gift cards are applied after
+// tax by the caller.
+func applyVoucher(quote *domain.Quote, voucher *VoucherTerms) {
+	adj := domain.Adjustment{Source: domain.AdjustmentVoucher, Reference: voucher.Code, Amount: voucher.Value}
+	switch voucher.Type {
+	case VoucherDiscount:
+		adj.Reason = fmt.Sprintf("Voucher %s: %.2f off", voucher.Code, voucher.Value)
+		quote.ApplyDiscount(adj, quote.Matching(nil, nil))
+	case VoucherFreeShipping:
+		adj.Reason = fmt.Sprintf("Voucher %s: free shipping", voucher.Code)
+		quote.ApplyShippingDiscount(adj)
+	}
+}
@@ -0,0 +1,160 @@
+package application_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/titan-commerce/backend/checkout-service/internal/application"
+	"github.com/titan-commerce/backend/checkout-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// fakePricing serves fixed campaigns and codes, a flat shipping rate and a
+// flat tax rate
+type fakePricing struct {
+	campaigns []application.CampaignRule
+	coupons   map[string]*application.CouponTerms
+	vouchers  map[string]*application.VoucherTerms
+	shipping  float64
+	taxRate   float64
+	record    func(call string) // Logs redemptions, if set
+	redeemErr error             // Fails voucher redemptions
+}
+
+func (p *fakePricing) ActiveCampaigns(ctx context.Context, productIDs []string) ([]application.CampaignRule, error) {
+	return p.campaigns, nil
+}
+
+func (p *fakePricing) GetCoupon(ctx context.Context, code, userID string) (*application.CouponTerms, error) {
+	if coupon, ok := p.coupons[code]; ok {
+		return coupon, nil
+	}
+	return nil, errors.New(errors.ErrNotFound, "coupon not found")
+}
+
+func (p *fakePricing) GetVoucher(ctx context.Context, code, userID string) (*application.VoucherTerms, error) {
+	if voucher, ok := p.vouchers[code]; ok {
+		return voucher, nil
+	}
+	return nil, errors.New(errors.ErrNotFound, "voucher not found")
+}
+
+func (p *fakePricing) ApplyCoupon(ctx context.Context, key, code, userID string, orderTotal float64) error {
+	p.log("apply coupon " + code)
+	return nil
+}
+
+func (p *fakePricing) ReleaseCoupon(ctx context.Context, key, code, userID string) error {
+	p.log("release coupon " + code)
+	return nil
+}
+
+func (p *fakePricing) RedeemVoucher(ctx context.Context, key, code, userID string) error {
+	p.log("redeem voucher " + code)
+	return p.redeemErr
+}
+
+func (p *fakePricing) ReleaseVoucher(ctx context.Context, key, code, userID string) error {
+	p.log("release voucher " + code)
+	return nil
+}
+
+func (p *fakePricing) log(call string) {
+	if p.record != nil {
+		p.record(call)
+	}
+}
+
+func (p *fakePricing) ShippingRate(ctx context.Context, shippingAddress string, lines []domain.CartLine) (float64, error) {
+	return p.shipping, nil
+}
+
+func (p *fakePricing) CalculateTax(ctx context.Context, shippingAddress string, lines []domain.QuoteLine, shipping float64) ([]float64, float64, error) {
+	tax := make([]float64, len(lines))
+	for i, line := range lines {
+		tax[i] = line.Remaining() * p.taxRate
+	}
+	return tax, shipping * p.taxRate, nil
+}
+
+func newTestPricingEngine(p *fakePricing) *application.PricingEngine {
+	return application.NewPricingEngine(p, p, p, p, p, 0)
+}
+
+func TestPricingEngine_ItemizesDiscounts(t *testing.T) {
+	engine := newTestPricingEngine(&fakePricing{
+		campaigns: []application.CampaignRule{{
+			CampaignID: "camp-1", Name: "Spring", Type: application.CampaignBuyXGetY,
+			Products: []string{"prod-a"}, BuyQuantity: 2, GetQuantity: 1,
+		}},
+		coupons: map[string]*application.CouponTerms{"SAVE10": {
+			Code: "SAVE10", Type: application.CouponPercentage, Value: 10, MinOrderValue: 40,
+			ApplicableCategories: []string{"cat-2"},
+		}},
+		vouchers: map[string]*application.VoucherTerms{"SHIPFREE": {
+			Code: "SHIPFREE", Type: application.VoucherFreeShipping, Value: 100,
+		}},
+		shipping: 7.5,
+		taxRate:  0.1,
+	})
+
+	quote, err := engine.Quote(context.Background(), application.QuoteRequest{
+		UserID:      "user-1",
+		CouponCode:  "SAVE10",
+		VoucherCode: "SHIPFREE",
+		Lines: []domain.CartLine{
+			{ProductID: "prod-a", CategoryID: "cat-1", Quantity: 3, UnitPrice: 10},
+			{ProductID: "prod-b", CategoryID: "cat-2", Quantity: 1, UnitPrice: 50},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []domain.Adjustment{{
+		Source: domain.AdjustmentCampaign, Reference: "camp-1", Reason: "Spring: buy 2 get 1 free", Amount: 10,
+	}}, quote.Lines[0].Discounts)
+	assert.Equal(t, []domain.Adjustment{{
+		Source: domain.AdjustmentCoupon, Reference: "SAVE10", Reason: "Coupon SAVE10: 10% off", Amount: 5,
+	}}, quote.Lines[1].Discounts)
+	assert.Equal(t, 7.5, quote.ShippingDiscount)
+	assert.Equal(t, 2.0, quote.Lines[0].Tax)
+	assert.Equal(t, 4.5, quote.Lines[1].Tax)
+
+	// 80 - 15 discounts + 7.50 shipping - 7.50 free shipping + 6.50 tax
+	assert.Equal(t, 71.5, quote.Total)
+}
+
+func TestPricingEngine_BundleAndGiftCard(t *testing.T) {
+	engine := newTestPricingEngine(&fakePricing{
+		campaigns: []application.CampaignRule{{
+			CampaignID: "camp-2", Name: "Combo", Type: application.CampaignBundle,
+			BundleProducts: []string{"prod-x", "prod-y"}, BundlePrice: 40,
+		}},
+		coupons: map[string]*application.CouponTerms{"BIG": {
+			Code: "BIG", Type: application.CouponFixed, Value: 5, MinOrderValue: 100,
+		}},
+		vouchers: map[string]*application.VoucherTerms{"GIFT": {
+			Code: "GIFT", Type: application.VoucherGiftCard, Value: 25,
+		}},
+		shipping: 4,
+	})
+	lines := []domain.CartLine{
+		{ProductID: "prod-x", Quantity: 1, UnitPrice: 30},
+		{ProductID: "prod-y", Quantity: 1, UnitPrice: 20},
+	}
+
+	// The bundle brings the cart under the coupon's minimum
+	_, err := engine.Quote(context.Background(), application.QuoteRequest{UserID: "user-1", CouponCode: "BIG", Lines: lines})
+	require.Error(t, err)
+	assert.Equal(t, errors.ErrInvalidInput, err.(*errors.AppError).Code)
+
+	quote, err := engine.Quote(context.Background(), application.QuoteRequest{UserID: "user-1", VoucherCode: "GIFT", Lines: lines})
+	require.NoError(t, err)
+
+	// The bundle's 10 off is split by list price
+	assert.Equal(t, 6.0, quote.Lines[0].Discount)
+	assert.Equal(t, 4.0, quote.Lines[1].Discount)
+	assert.Equal(t, 25.0, quote.Credit)
+	assert.Equal(t, 19.0, quote.Total)
+}
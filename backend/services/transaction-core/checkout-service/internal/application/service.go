@@ -3,164 +3,743 @@ package application
 import (
 	"context"
 	"fmt"
+	"os"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/titan-commerce/backend/checkout-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
 	"github.com/titan-commerce/backend/pkg/logger"
+	"github.com/titan-commerce/backend/pkg/saga"
 )
 
-// Service Interfaces for external dependencies
+// Service Interfaces for external dependencies. Every call that changes
+// something takes an idempotency key: the saga passes its session ID, with
+// the tender's position for tender holds, so a step retried after a restart
+// returns the first attempt's result.
 type InventoryClient interface {
-	ReserveStock(ctx context.Context, productIDs []string) (string, error)
+	// ReserveStock holds every item or none, under one reservation that is
+	// committed or rolled back as a whole
+	ReserveStock(ctx context.Context, key string, items []domain.CheckoutItem) (string, error)
 	CommitReservation(ctx context.Context, reservationID string) error
 	RollbackReservation(ctx context.Context, reservationID string) error
 }
 
-type PaymentClient interface {
-	ProcessPayment(ctx context.Context, userID string, amount float64, paymentMethodID string) (string, error)
-	RefundPayment(ctx context.Context, paymentID string) error
+// TenderClient holds funds of one tender type: wallet balance through the
+// wallet's HoldFunds, coins through the coin wallet, cards through the
+// payment gateway. Held funds are either captured or released, never both;
+// holds that are neither expire with the provider. Captured funds are given
+// back with Refund, once per key.
+type TenderClient interface {
+	Hold(ctx context.Context, key, userID string, tender domain.Tender) (string, error)
+	Capture(ctx context.Context, holdID string) error
+	Release(ctx context.Context, holdID string) error
+	Refund(ctx context.Context, key, holdID string, amount float64) error
 }
 
 type OrderClient interface {
-	CreateOrder(ctx context.Context, userID string, productIDs []string, shippingAddress string) (string, error)
+	CreateOrder(ctx context.Context, key, userID string, productIDs []string, shippingAddress string) (string, error)
 	CancelOrder(ctx context.Context, orderID string) error
 }
 
 type CartClient interface {
-	GetCart(ctx context.Context, userID string) (float64, []string, error)
-	ClearCart(ctx context.Context, userID string) error
+	GetCart(ctx context.Context, userID string) ([]domain.CartLine, error)
+	// ClearCart empties the cart once orderID is placed from it
+	ClearCart(ctx context.Context, userID, orderID string) error
 }
 
+// Defaults for recovering sagas whose driver stopped
+const (
+	DefaultRecoveryInterval = 15 * time.Second
+	RecoveryBatchSize       = 100
+)
+
+// Saga step settings. A step's attempts must fit well within the session
+// lease, which is renewed every LeaseRenewInterval.
+const (
+	StepAttempts       = 3
+	StepBackoff        = 200 * time.Millisecond
+	StepTimeout        = 10 * time.Second
+	LeaseRenewInterval = 10 * time.Second
+)
+
+// A capture that keeps failing is retried on every recovery until
+// DefaultCaptureWindow has passed since its first failure, and for at least
+// CaptureRuns runs of StepAttempts. Then the checkout is given up on: its
+// order is cancelled, the tenders still held are released, those captured
+// are refunded and the stock goes back.
+const (
+	CaptureRuns          = 3
+	DefaultCaptureWindow = 6 * time.Hour
+)
+
+// maxUpdateAttempts bounds how often a session change is re-applied when the
+// session was saved concurrently, e.g. by a cancellation
+const maxUpdateAttempts = 3
+
 type CheckoutService struct {
 	inventory InventoryClient
-	payment   PaymentClient
+	tenders   map[domain.TenderType]TenderClient
 	order     OrderClient
 	cart      CartClient
-	sessions  map[string]*domain.CheckoutSession // In-memory storage for simplicity, replace with Redis/DB
-	logger    *logger.Logger
+	sessions  domain.SessionRepository
+	quotes    domain.QuoteRepository
+	pricing   *PricingEngine
+	saga      *saga.Orchestrator
+	owner     string   // Lease owner name of this replica
+	driving   sync.Map // Session IDs this replica is driving
+
+	captureWindow time.Duration
+
+	// Sagas run for the life of the service, not of the request that
+	// started them
+	ctx  context.Context
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+
+	logger *logger.Logger
 }
 
-func NewCheckoutService(inv InventoryClient, pay PaymentClient, ord OrderClient, crt CartClient, logger *logger.Logger) *CheckoutService {
-	return &CheckoutService{
+func NewCheckoutService(sessions domain.SessionRepository, executions saga.Store, quotes domain.QuoteRepository, pricing *PricingEngine, inv InventoryClient, tenders map[domain.TenderType]TenderClient, ord OrderClient, crt CartClient, logger *logger.Logger) (*CheckoutService, error) {
+	ctx, stop := context.WithCancel(context.Background())
+	hostname, _ := os.Hostname()
+	s := &CheckoutService{
 		inventory: inv,
-		payment:   pay,
+		tenders:   tenders,
 		order:     ord,
 		cart:      crt,
-		sessions:  make(map[string]*domain.CheckoutSession),
-		logger:    logger,
+		sessions:  sessions,
+		quotes:    quotes,
+		pricing:   pricing,
+		owner:     fmt.Sprintf("%s-%s", hostname, uuid.New().String()[:8]),
+
+		captureWindow: DefaultCaptureWindow,
+
+		ctx:    ctx,
+		stop:   stop,
+		logger: logger,
+	}
+
+	orchestrator, err := saga.New(s.checkoutSaga(), executions)
+	if err != nil {
+		stop()
+		return nil, err
 	}
+	orchestrator.SetHooks(saga.Hooks{StepFinished: s.logStep})
+	s.saga = orchestrator
+	return s, nil
+}
+
+// SetCaptureWindow changes how long a failing capture is retried before the
+// checkout is given up on, e.g. in tests
+func (s *CheckoutService) SetCaptureWindow(window time.Duration) {
+	s.captureWindow = window
 }
 
-func (s *CheckoutService) InitiateCheckout(ctx context.Context, userID, shippingAddress, paymentMethodID string) (*domain.CheckoutSession, error) {
-	// 1. Get Cart
-	totalAmount, productIDs, err := s.cart.GetCart(ctx, userID)
+// CreateQuote prices the user's cart for the given address and codes, and
+// locks the price for DefaultQuoteTTL
+func (s *CheckoutService) CreateQuote(ctx context.Context, userID, shippingAddress, couponCode, voucherCode string) (*domain.Quote, error) {
+	lines, err := s.cart.GetCart(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get cart: %w", err)
 	}
 
-	if len(productIDs) == 0 {
-		return nil, fmt.Errorf("cart is empty")
+	quote, err := s.pricing.Quote(ctx, QuoteRequest{
+		UserID:          userID,
+		ShippingAddress: shippingAddress,
+		CouponCode:      couponCode,
+		VoucherCode:     voucherCode,
+		Lines:           lines,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.quotes.Save(ctx, quote); err != nil {
+		return nil, err
 	}
+	return quote, nil
+}
 
-	// 2. Create Session
-	session := domain.NewCheckoutSession(userID, shippingAddress, paymentMethodID, productIDs, totalAmount)
-	s.sessions[session.SessionID] = session
+// InitiateCheckout starts a checkout that charges the quote's total for the
+// quoted items, shipped to the quoted address. The tenders pay the total in
+// order; the last one may leave its amount zero to pay the rest.
+func (s *CheckoutService) InitiateCheckout(ctx context.Context, userID, quoteID string, tenders []domain.Tender) (*domain.CheckoutSession, error) {
+	quote, err := s.quotes.FindByID(ctx, quoteID)
+	if err != nil {
+		return nil, err
+	}
 
-	// 3. Start Saga (Async)
-	go s.runSaga(session)
+	tenders, err = domain.NewTenders(tenders, quote.Total)
+	if err != nil {
+		return nil, err
+	}
+	for _, tender := range tenders {
+		if _, ok := s.tenders[tender.Type]; !ok {
+			return nil, errors.New(errors.ErrInvalidInput, fmt.Sprintf("tender type %s is not accepted", tender.Type))
+		}
+	}
+
+	session := domain.NewCheckoutSession(userID, quote.ShippingAddress, quote.Items(), tenders, quote.Total)
+	session.QuoteID = quote.QuoteID
+	if err := quote.CheckUsable(userID, session.SessionID, time.Now()); err != nil {
+		return nil, err
+	}
 
+	// Claimed before the session exists, so a quote is never charged twice
+	// and a failed claim leaves nothing for recovery to pick up
+	if err := s.quotes.Claim(ctx, quote.QuoteID, session.SessionID); err != nil {
+		return nil, err
+	}
+	if err := s.sessions.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	s.start(session.SessionID)
 	return session, nil
 }
 
 func (s *CheckoutService) GetCheckoutStatus(ctx context.Context, sessionID string) (*domain.CheckoutSession, error) {
-	session, ok := s.sessions[sessionID]
-	if !ok {
-		return nil, fmt.Errorf("session not found")
+	return s.sessions.FindByID(ctx, sessionID)
+}
+
+// CancelCheckout asks the saga to undo its steps and reports whether the
+// cancel won the race against the saga. The saga picks an accepted cancel up
+// before its next step and ends CANCELLED; a checkout whose order is already
+// confirmed, or that failed meanwhile, is left alone.
+func (s *CheckoutService) CancelCheckout(ctx context.Context, sessionID string) (*domain.CheckoutSession, bool, error) {
+	session, err := s.update(ctx, sessionID, func(session *domain.CheckoutSession) bool {
+		if !session.Cancellable() {
+			return false
+		}
+		session.MarkCancelling()
+		return true
+	})
+	if err != nil {
+		return nil, false, err
 	}
-	return session, nil
+
+	cancelled := session.Status == domain.CheckoutStatusCancelling || session.Status == domain.CheckoutStatusCancelled
+	if cancelled {
+		s.logger.Infof("Checkout %s cancelled", sessionID)
+	}
+	return session, cancelled, nil
 }
 
-func (s *CheckoutService) CancelCheckout(ctx context.Context, sessionID string) error {
-	session, ok := s.sessions[sessionID]
-	if !ok {
-		return fmt.Errorf("session not found")
+// RecoverSagas starts driving every incomplete saga nobody holds a lease
+// on: those whose replica crashed, shut down or gave up after an error. It
+// returns how many it picked up.
+func (s *CheckoutService) RecoverSagas(ctx context.Context) (int, error) {
+	sessions, err := s.sessions.FindResumable(ctx, RecoveryBatchSize)
+	if err != nil {
+		s.logger.Error(err, "failed to find incomplete checkouts")
+		return 0, err
 	}
 
-	// Trigger compensation if in progress
-	if session.Status != domain.CheckoutStatusCompleted && session.Status != domain.CheckoutStatusFailed {
-		session.MarkCompensating()
-		// In a real system, this would signal the running saga or trigger a compensation workflow
-		// For this simple implementation, we'll just mark it. The running saga would need to check this status.
+	started := 0
+	for _, session := range sessions {
+		if s.start(session.SessionID) {
+			started++
+		}
+	}
+	if started > 0 {
+		s.logger.Infof("Recovering %d incomplete checkouts", started)
 	}
+	return started, nil
+}
 
-	return nil
+// RunRecovery recovers incomplete sagas at once, then every interval until
+// ctx is cancelled
+func (s *CheckoutService) RunRecovery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// Failures are logged and retried on the next tick
+		_, _ = s.RecoverSagas(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
 
-func (s *CheckoutService) runSaga(session *domain.CheckoutSession) {
-	ctx := context.Background()
-	s.logger.Infof("Starting Saga for session %s", session.SessionID)
+// Close stops driving sagas and waits for the running steps to return. The
+// leases are released, so another replica resumes the sagas right away.
+func (s *CheckoutService) Close() {
+	s.stop()
+	s.wg.Wait()
+}
+
+// start drives a saga in the background unless this replica already is
+func (s *CheckoutService) start(sessionID string) bool {
+	if _, driving := s.driving.LoadOrStore(sessionID, struct{}{}); driving {
+		return false
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.driving.Delete(sessionID)
+		s.runSaga(s.ctx, sessionID)
+	}()
+	return true
+}
+
+// runSaga drives the session's saga until it completes or is compensated,
+// holding its lease throughout. It gives up, leaving the saga to recovery,
+// when the lease is lost, a step past the order fails, or the service shuts
+// down.
+func (s *CheckoutService) runSaga(ctx context.Context, sessionID string) {
+	held, err := s.sessions.AcquireLease(ctx, sessionID, s.owner)
+	if err != nil || !held {
+		return
+	}
+	defer func() {
+		if err := s.sessions.ReleaseLease(context.WithoutCancel(ctx), sessionID, s.owner); err != nil {
+			s.logger.Errorf(err, "failed to release lease on checkout %s", sessionID)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.keepLease(ctx, cancel, sessionID)
 
-	// Step 1: Reserve Inventory
-	session.MarkReservingInventory()
-	reservationID, err := s.inventory.ReserveStock(ctx, session.ProductIDs)
+	session, err := s.sessions.FindByID(ctx, sessionID)
 	if err != nil {
-		s.failSaga(session, "Inventory reservation failed: "+err.Error())
+		s.logger.Errorf(err, "failed to load checkout %s", sessionID)
+		return
+	}
+	if session.Terminal() {
 		return
 	}
-	session.ReservationID = reservationID
+	if session.Status == domain.CheckoutStatusInitiated {
+		if err := s.advance(ctx, sessionID, (*domain.CheckoutSession).MarkReservingInventory); err != nil {
+			s.logger.Errorf(err, "failed to start checkout %s", sessionID)
+			return
+		}
+	}
 
-	// Step 2: Process Payment
-	session.MarkProcessingPayment(reservationID)
-	paymentID, err := s.payment.ProcessPayment(ctx, session.UserID, session.TotalAmount, session.PaymentMethodID)
+	s.logger.Infof("Starting Saga for session %s", sessionID)
+	exec, err := s.saga.Run(ctx, sessionID)
 	if err != nil {
-		s.compensateInventory(ctx, session)
-		s.failSaga(session, "Payment failed: "+err.Error())
+		if ctx.Err() == nil {
+			s.logger.Errorf(err, "checkout %s stopped", sessionID)
+		}
 		return
 	}
-	session.PaymentID = paymentID
 
-	// Step 3: Create Order
-	session.MarkCreatingOrder(paymentID)
-	orderID, err := s.order.CreateOrder(ctx, session.UserID, session.ProductIDs, session.ShippingAddress)
+	if exec.Status == saga.StatusCompleted {
+		s.logger.Infof("Saga completed successfully for session %s", sessionID)
+		return
+	}
+
+	// Every step is undone. A cancel accepted while a failure was being
+	// compensated still ends the checkout CANCELLED, as its caller was told.
+	ended, err := s.update(ctx, sessionID, func(session *domain.CheckoutSession) bool {
+		switch {
+		case session.Terminal():
+			return false
+		case exec.Status == saga.StatusCancelled || session.Status == domain.CheckoutStatusCancelling:
+			session.MarkCancelled()
+		case session.Status == domain.CheckoutStatusCompensating:
+			session.MarkFailed(session.ErrorMessage)
+		default:
+			session.MarkFailed(exec.Error)
+		}
+		return true
+	})
 	if err != nil {
-		s.compensatePayment(ctx, session)
-		s.compensateInventory(ctx, session)
-		s.failSaga(session, "Order creation failed: "+err.Error())
+		s.logger.Errorf(err, "failed to end checkout %s", sessionID)
 		return
 	}
+	if ended.Status == domain.CheckoutStatusCancelled {
+		s.logger.Infof("Saga cancelled for session %s", sessionID)
+		return
+	}
+	s.logger.Error(nil, "Saga failed for session "+sessionID+": "+ended.ErrorMessage)
+}
+
+// keepLease renews the session's lease until ctx is done, and cancels the
+// saga if the lease is lost so it is never driven twice
+func (s *CheckoutService) keepLease(ctx context.Context, cancel context.CancelFunc, sessionID string) {
+	ticker := time.NewTicker(LeaseRenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if held, err := s.sessions.AcquireLease(ctx, sessionID, s.owner); ctx.Err() == nil && (err != nil || !held) {
+			s.logger.Infof("Lost lease on checkout %s", sessionID)
+			cancel()
+			return
+		}
+	}
+}
+
+// checkoutSaga declares the checkout steps. Each action first checks whether
+// the session already records its result, so a step re-run after a restart
+// neither calls the service again nor logs the step twice. A cancel is
+// checked before every step up to confirm-order.
+func (s *CheckoutService) checkoutSaga() saga.Definition {
+	retry := saga.RetryPolicy{MaxAttempts: StepAttempts, Backoff: StepBackoff, Multiplier: 2}
+	return saga.Definition{
+		Name: "checkout",
+		Steps: []saga.Step{
+			{Name: "reserve-inventory", Action: s.reserveInventory, Compensate: s.releaseInventory, Retry: retry, Timeout: StepTimeout},
+			// Codes are used up before money is held; the coupon can be
+			// applied when the voucher fails
+			{Name: "redeem-codes", Action: s.redeemCodes, Compensate: s.releaseCodes, Retry: retry, Timeout: StepTimeout, Partial: true},
+			// Tenders are held one by one, so a failure can leave some held
+			{Name: "process-payment", Action: s.holdPayment, Compensate: s.releasePayment, Retry: retry, Timeout: StepTimeout, Partial: true},
+			{Name: "create-order", Action: s.createOrder, Compensate: s.cancelOrder, Retry: retry, Timeout: StepTimeout},
+			// The confirmed order is the point of no return
+			{Name: "confirm-order", Action: s.confirmOrder, Retry: retry, Timeout: StepTimeout, Pivot: true},
+			{Name: "capture-payment", Action: s.capturePayment, Retry: retry, Timeout: StepTimeout},
+			{Name: "finalize", Action: s.finalize, Retry: retry, Timeout: StepTimeout},
+		},
+		Cancelled: s.cancelRequested,
+	}
+}
 
-	// Step 4: Commit Inventory & Clear Cart
-	if err := s.inventory.CommitReservation(ctx, reservationID); err != nil {
-		s.logger.Error(err, "Failed to commit reservation (critical)")
-		// Manual intervention might be needed here
+func (s *CheckoutService) reserveInventory(ctx context.Context, exec *saga.Execution) error {
+	session, err := s.sessions.FindByID(ctx, exec.ID)
+	if err != nil || session.ReservationID != "" {
+		return err
 	}
-	
-	if err := s.cart.ClearCart(ctx, session.UserID); err != nil {
+	reservationID, err := s.inventory.ReserveStock(ctx, exec.ID, session.Items)
+	if err != nil {
+		return fmt.Errorf("Inventory reservation failed: %w", err)
+	}
+	return s.advance(ctx, exec.ID, func(session *domain.CheckoutSession) {
+		session.MarkProcessingPayment(reservationID)
+	})
+}
+
+// redeemCodes uses up the coupon and voucher the quote was priced with. The
+// session ID keys the redemptions, so a re-run redeems nothing twice.
+func (s *CheckoutService) redeemCodes(ctx context.Context, exec *saga.Execution) error {
+	session, err := s.sessions.FindByID(ctx, exec.ID)
+	if err != nil {
+		return err
+	}
+	quote, err := s.sessionQuote(ctx, session)
+	if err != nil || quote == nil {
+		return err
+	}
+	if err := s.pricing.Redeem(ctx, exec.ID, quote); err != nil {
+		return fmt.Errorf("Code redemption failed: %w", err)
+	}
+	return nil
+}
+
+func (s *CheckoutService) releaseCodes(ctx context.Context, exec *saga.Execution) error {
+	session, err := s.compensating(ctx, exec)
+	if err != nil {
+		return err
+	}
+	quote, err := s.sessionQuote(ctx, session)
+	if err != nil || quote == nil {
+		return err
+	}
+	s.logger.Infof("Compensating: Releasing codes for session %s", exec.ID)
+	if err := s.pricing.Release(ctx, exec.ID, quote); err != nil {
+		return fmt.Errorf("failed to release codes: %w", err)
+	}
+	return nil
+}
+
+// sessionQuote returns the quote the session charges, or nil if it has no
+// quote or the quote uses no codes
+func (s *CheckoutService) sessionQuote(ctx context.Context, session *domain.CheckoutSession) (*domain.Quote, error) {
+	if session.QuoteID == "" {
+		return nil, nil
+	}
+	quote, err := s.quotes.FindByID(ctx, session.QuoteID)
+	if err != nil {
+		return nil, err
+	}
+	if quote.CouponCode == "" && quote.VoucherCode == "" {
+		return nil, nil
+	}
+	return quote, nil
+}
+
+// holdPayment holds the tenders in order, recording each hold. A retry
+// picks up at the first tender not held; if the step fails for good,
+// releasePayment releases the holds it placed.
+func (s *CheckoutService) holdPayment(ctx context.Context, exec *saga.Execution) error {
+	session, err := s.sessions.FindByID(ctx, exec.ID)
+	if err != nil || session.Status != domain.CheckoutStatusProcessingPayment {
+		return err
+	}
+	for i, tender := range session.Tenders {
+		if tender.Status == domain.TenderHeld {
+			continue
+		}
+		holdID, err := s.tenders[tender.Type].Hold(ctx, fmt.Sprintf("%s:%d", exec.ID, i), session.UserID, tender)
+		if err != nil {
+			return fmt.Errorf("Payment failed: %s tender of %.2f: %w", tender.Type, tender.Amount, err)
+		}
+		if err := s.advance(ctx, exec.ID, func(session *domain.CheckoutSession) {
+			session.MarkTenderHeld(i, holdID)
+		}); err != nil {
+			return err
+		}
+	}
+	return s.advance(ctx, exec.ID, (*domain.CheckoutSession).MarkCreatingOrder)
+}
+
+// capturePayment captures every held tender. It runs past the pivot, so a
+// failed capture is retried, by recovery once a run's attempts are spent,
+// until all of them are taken or the capture window has passed.
+func (s *CheckoutService) capturePayment(ctx context.Context, exec *saga.Execution) error {
+	session, err := s.sessions.FindByID(ctx, exec.ID)
+	if err != nil || session.Terminal() {
+		return err
+	}
+	failed, since := failedAttempts(exec, "capture-payment")
+	if failed >= CaptureRuns*StepAttempts && time.Since(since) >= s.captureWindow {
+		return s.abandonCapture(ctx, exec, session, failed)
+	}
+	for i, tender := range session.Tenders {
+		if tender.Status != domain.TenderHeld {
+			continue
+		}
+		if err := s.tenders[tender.Type].Capture(ctx, tender.HoldID); err != nil {
+			return fmt.Errorf("failed to capture %s tender: %w", tender.Type, err)
+		}
+		if err := s.advance(ctx, exec.ID, func(session *domain.CheckoutSession) {
+			session.MarkTenderCaptured(i)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *CheckoutService) createOrder(ctx context.Context, exec *saga.Execution) error {
+	session, err := s.sessions.FindByID(ctx, exec.ID)
+	if err != nil || session.OrderID != "" {
+		return err
+	}
+	orderID, err := s.order.CreateOrder(ctx, exec.ID, session.UserID, session.ProductIDs, session.ShippingAddress)
+	if err != nil {
+		return fmt.Errorf("Order creation failed: %w", err)
+	}
+	return s.advance(ctx, exec.ID, func(session *domain.CheckoutSession) {
+		session.MarkOrderPlaced(orderID)
+	})
+}
+
+// confirmOrder decides the race with CancelCheckout: whichever saves the
+// session first wins
+func (s *CheckoutService) confirmOrder(ctx context.Context, exec *saga.Execution) error {
+	session, err := s.update(ctx, exec.ID, func(session *domain.CheckoutSession) bool {
+		if session.Status != domain.CheckoutStatusCreatingOrder {
+			return false
+		}
+		session.MarkFinalizing()
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if session.Status == domain.CheckoutStatusCancelling {
+		return saga.ErrCancelled
+	}
+	return nil
+}
+
+// abandonCapture undoes a checkout whose payment could not be captured:
+// the order is cancelled, the tenders are given back, newest first, and the
+// reservation is rolled back. Tenders still held are released and those
+// already captured are refunded, keyed by the session ID and the tender's
+// position. A retry picks up at the first tender not given back.
+func (s *CheckoutService) abandonCapture(ctx context.Context, exec *saga.Execution, session *domain.CheckoutSession, failed int) error {
+	s.logger.Warnf("Giving up capturing payment for session %s after %d attempts", exec.ID, failed)
+	if err := s.order.CancelOrder(ctx, session.OrderID); err != nil {
+		return fmt.Errorf("failed to cancel order: %w", err)
+	}
+	for i := len(session.Tenders) - 1; i >= 0; i-- {
+		tender := session.Tenders[i]
+		switch tender.Status {
+		case domain.TenderHeld:
+			if err := s.tenders[tender.Type].Release(ctx, tender.HoldID); err != nil {
+				return fmt.Errorf("failed to release %s tender: %w", tender.Type, err)
+			}
+			if err := s.advance(ctx, exec.ID, func(session *domain.CheckoutSession) {
+				session.MarkTenderReleased(i)
+			}); err != nil {
+				return err
+			}
+		case domain.TenderCaptured:
+			key := fmt.Sprintf("%s:%d", exec.ID, i)
+			if err := s.tenders[tender.Type].Refund(ctx, key, tender.HoldID, tender.Amount); err != nil {
+				return fmt.Errorf("failed to refund %s tender: %w", tender.Type, err)
+			}
+			s.logger.Infof("Refunded %s tender of %.2f for given up checkout %s", tender.Type, tender.Amount, exec.ID)
+			if err := s.advance(ctx, exec.ID, func(session *domain.CheckoutSession) {
+				session.MarkTenderRefunded(i)
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.inventory.RollbackReservation(ctx, session.ReservationID); err != nil {
+		return fmt.Errorf("failed to rollback inventory: %w", err)
+	}
+	return s.advance(ctx, exec.ID, func(session *domain.CheckoutSession) {
+		session.MarkFailed(fmt.Sprintf("Payment capture failed after %d attempts", failed))
+	})
+}
+
+// failedAttempts counts the failed attempts of a step's action over every
+// run of the execution, and returns when the first of them failed
+func failedAttempts(exec *saga.Execution, step string) (int, time.Time) {
+	failed := 0
+	var first time.Time
+	for _, record := range exec.History {
+		if record.Step == step && record.Phase == saga.PhaseAction && record.Error != "" {
+			if failed == 0 {
+				first = record.At
+			}
+			failed++
+		}
+	}
+	return failed, first
+}
+
+// finalize commits the reservation and clears the cart, unless the checkout
+// was given up on
+func (s *CheckoutService) finalize(ctx context.Context, exec *saga.Execution) error {
+	session, err := s.sessions.FindByID(ctx, exec.ID)
+	if err != nil || session.Terminal() {
+		return err
+	}
+	if err := s.inventory.CommitReservation(ctx, session.ReservationID); err != nil {
+		return fmt.Errorf("failed to commit reservation: %w", err)
+	}
+	if err := s.cart.ClearCart(ctx, session.UserID, session.OrderID); err != nil {
 		s.logger.Error(err, "Failed to clear cart")
 	}
+	return s.advance(ctx, exec.ID, func(session *domain.CheckoutSession) {
+		session.MarkCompleted(session.OrderID)
+	})
+}
+
+func (s *CheckoutService) cancelOrder(ctx context.Context, exec *saga.Execution) error {
+	session, err := s.compensating(ctx, exec)
+	if err != nil || session.OrderID == "" {
+		return err
+	}
+	s.logger.Infof("Compensating: Cancelling order for session %s", exec.ID)
+	if err := s.order.CancelOrder(ctx, session.OrderID); err != nil {
+		return fmt.Errorf("failed to cancel order: %w", err)
+	}
+	return nil
+}
+
+func (s *CheckoutService) releaseInventory(ctx context.Context, exec *saga.Execution) error {
+	session, err := s.compensating(ctx, exec)
+	if err != nil {
+		return err
+	}
+	// A reservation made but never recorded expires in inventory-service
+	if session.ReservationID == "" {
+		return nil
+	}
+	s.logger.Infof("Compensating: Rolling back inventory for session %s", exec.ID)
+	if err := s.inventory.RollbackReservation(ctx, session.ReservationID); err != nil {
+		return fmt.Errorf("failed to rollback inventory: %w", err)
+	}
+	return nil
+}
 
-	session.MarkCompleted(orderID)
-	s.logger.Infof("Saga completed successfully for session %s", session.SessionID)
+// releasePayment releases the held tenders, newest first. A hold placed but
+// never recorded expires with its provider.
+func (s *CheckoutService) releasePayment(ctx context.Context, exec *saga.Execution) error {
+	session, err := s.compensating(ctx, exec)
+	if err != nil {
+		return err
+	}
+	for i := len(session.Tenders) - 1; i >= 0; i-- {
+		tender := session.Tenders[i]
+		if tender.Status != domain.TenderHeld {
+			continue
+		}
+		s.logger.Infof("Compensating: Releasing %s tender for session %s", tender.Type, exec.ID)
+		if err := s.tenders[tender.Type].Release(ctx, tender.HoldID); err != nil {
+			return fmt.Errorf("failed to release %s tender: %w", tender.Type, err)
+		}
+		if err := s.advance(ctx, exec.ID, func(session *domain.CheckoutSession) {
+			session.MarkTenderReleased(i)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (s *CheckoutService) failSaga(session *domain.CheckoutSession, reason string) {
-	session.MarkFailed(reason)
-	s.logger.Error(nil, "Saga failed for session "+session.SessionID+": "+reason)
+// cancelRequested reports whether the checkout was cancelled
+func (s *CheckoutService) cancelRequested(ctx context.Context, exec *saga.Execution) (bool, error) {
+	session, err := s.sessions.FindByID(ctx, exec.ID)
+	if err != nil {
+		return false, err
+	}
+	return session.Status == domain.CheckoutStatusCancelling, nil
 }
 
-func (s *CheckoutService) compensateInventory(ctx context.Context, session *domain.CheckoutSession) {
-	if session.ReservationID != "" {
-		s.logger.Infof("Compensating: Rolling back inventory for session %s", session.SessionID)
-		if err := s.inventory.RollbackReservation(ctx, session.ReservationID); err != nil {
-			s.logger.Error(err, "Failed to rollback inventory")
+// compensating moves the session to compensation, unless a failed step or a
+// cancel already has, and returns it
+func (s *CheckoutService) compensating(ctx context.Context, exec *saga.Execution) (*domain.CheckoutSession, error) {
+	return s.update(ctx, exec.ID, func(session *domain.CheckoutSession) bool {
+		if session.Status == domain.CheckoutStatusCompensating || session.Status == domain.CheckoutStatusCancelling {
+			return false
 		}
+		session.MarkCompensating(exec.Error)
+		return true
+	})
+}
+
+// logStep logs failed saga attempts
+func (s *CheckoutService) logStep(workflow, step string, phase saga.Phase, attempt int, duration time.Duration, err error) {
+	if err != nil {
+		s.logger.Errorf(err, "%s step %s (%s) attempt %d failed after %s", workflow, step, phase, attempt, duration)
 	}
 }
 
-func (s *CheckoutService) compensatePayment(ctx context.Context, session *domain.CheckoutSession) {
-	if session.PaymentID != "" {
-		s.logger.Infof("Compensating: Refunding payment for session %s", session.SessionID)
-		if err := s.payment.RefundPayment(ctx, session.PaymentID); err != nil {
-			s.logger.Error(err, "Failed to refund payment")
+// advance records a forward step's result
+func (s *CheckoutService) advance(ctx context.Context, sessionID string, mark func(*domain.CheckoutSession)) error {
+	_, err := s.update(ctx, sessionID, func(session *domain.CheckoutSession) bool {
+		mark(session)
+		return true
+	})
+	return err
+}
+
+// update applies change to the stored session and saves it. If the session
+// was saved in between, change is applied again to the new state; it
+// returns false to leave the session alone.
+func (s *CheckoutService) update(ctx context.Context, sessionID string, change func(*domain.CheckoutSession) bool) (*domain.CheckoutSession, error) {
+	for attempt := 1; ; attempt++ {
+		session, err := s.sessions.FindByID(ctx, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		if !change(session) {
+			return session, nil
+		}
+
+		err = s.sessions.Update(ctx, session)
+		if err == nil {
+			return session, nil
+		}
+		if appErr, ok := err.(*errors.AppError); !ok || appErr.Code != errors.ErrConflict || attempt == maxUpdateAttempts {
+			return nil, err
 		}
 	}
 }
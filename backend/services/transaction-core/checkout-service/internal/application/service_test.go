@@ -0,0 +1,602 @@
+package application_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/titan-commerce/backend/checkout-service/internal/application"
+	"github.com/titan-commerce/backend/checkout-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+	"github.com/titan-commerce/backend/pkg/saga"
+)
+
+// fakeSessionRepository keeps sessions in memory with the same versioning and
+// lease rules as the Postgres repository
+type fakeSessionRepository struct {
+	mu       sync.Mutex
+	sessions map[string]domain.CheckoutSession
+	leases   map[string]string
+}
+
+func newFakeSessionRepository() *fakeSessionRepository {
+	return &fakeSessionRepository{sessions: make(map[string]domain.CheckoutSession), leases: make(map[string]string)}
+}
+
+func (r *fakeSessionRepository) Create(ctx context.Context, session *domain.CheckoutSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions[session.SessionID] = copySession(session)
+	return nil
+}
+
+func (r *fakeSessionRepository) Update(ctx context.Context, session *domain.CheckoutSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sessions[session.SessionID].Version != session.Version {
+		return errors.New(errors.ErrConflict, "checkout session was modified")
+	}
+	session.Version++
+	r.sessions[session.SessionID] = copySession(session)
+	return nil
+}
+
+func (r *fakeSessionRepository) FindByID(ctx context.Context, sessionID string) (*domain.CheckoutSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[sessionID]
+	if !ok {
+		return nil, errors.New(errors.ErrNotFound, "checkout session not found")
+	}
+	found := copySession(&session)
+	return &found, nil
+}
+
+func (r *fakeSessionRepository) FindResumable(ctx context.Context, limit int) ([]*domain.CheckoutSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*domain.CheckoutSession
+	for id, session := range r.sessions {
+		if !session.Terminal() && r.leases[id] == "" {
+			s := copySession(&session)
+			found = append(found, &s)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].CreatedAt.Before(found[j].CreatedAt) })
+	return found, nil
+}
+
+func (r *fakeSessionRepository) AcquireLease(ctx context.Context, sessionID, owner string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if holder := r.leases[sessionID]; holder != "" && holder != owner {
+		return false, nil
+	}
+	r.leases[sessionID] = owner
+	return true, nil
+}
+
+func (r *fakeSessionRepository) ReleaseLease(ctx context.Context, sessionID, owner string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.leases[sessionID] == owner {
+		delete(r.leases, sessionID)
+	}
+	return nil
+}
+
+func copySession(session *domain.CheckoutSession) domain.CheckoutSession {
+	c := *session
+	c.ProductIDs = append([]string(nil), session.ProductIDs...)
+	c.Items = append([]domain.CheckoutItem(nil), session.Items...)
+	c.Tenders = append([]domain.Tender(nil), session.Tenders...)
+	c.Steps = append([]domain.CheckoutStep(nil), session.Steps...)
+	return c
+}
+
+// fakeQuoteRepository keeps quotes in memory
+type fakeQuoteRepository struct {
+	mu     sync.Mutex
+	quotes map[string]domain.Quote
+}
+
+func (r *fakeQuoteRepository) Save(ctx context.Context, quote *domain.Quote) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.quotes[quote.QuoteID] = *quote
+	return nil
+}
+
+func (r *fakeQuoteRepository) FindByID(ctx context.Context, quoteID string) (*domain.Quote, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	quote, ok := r.quotes[quoteID]
+	if !ok {
+		return nil, errors.New(errors.ErrNotFound, "quote not found")
+	}
+	return &quote, nil
+}
+
+func (r *fakeQuoteRepository) Claim(ctx context.Context, quoteID, sessionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	quote := r.quotes[quoteID]
+	if quote.UsedBy != "" && quote.UsedBy != sessionID {
+		return errors.New(errors.ErrConflict, "quote was already used by another checkout")
+	}
+	quote.UsedBy = sessionID
+	r.quotes[quoteID] = quote
+	return nil
+}
+
+// fakeClients records what the saga asked of each service
+type fakeClients struct {
+	mu         sync.Mutex
+	calls      []string
+	holdErr    map[domain.TenderType]error
+	captureErr map[string]error // By hold ID
+	onOrder    func()           // Runs while the order is being created
+	pricing    *fakePricing     // Serves and redeems the codes
+	unitPrice  float64
+	charged    float64 // Total held
+	reserved   []domain.CheckoutItem
+}
+
+func (c *fakeClients) record(call string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, call)
+}
+
+func (c *fakeClients) Calls() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.calls...)
+}
+
+func (c *fakeClients) ReserveStock(ctx context.Context, key string, items []domain.CheckoutItem) (string, error) {
+	c.record("reserve")
+	c.mu.Lock()
+	c.reserved = items
+	c.mu.Unlock()
+	return "res-" + key, nil
+}
+
+func (c *fakeClients) CommitReservation(ctx context.Context, reservationID string) error {
+	c.record("commit " + reservationID)
+	return nil
+}
+
+func (c *fakeClients) RollbackReservation(ctx context.Context, reservationID string) error {
+	c.record("rollback " + reservationID)
+	return nil
+}
+
+// Hold, Capture, Release and Refund serve every tender type
+func (c *fakeClients) Hold(ctx context.Context, key, userID string, tender domain.Tender) (string, error) {
+	c.record("hold " + string(tender.Type))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.holdErr[tender.Type]; err != nil {
+		return "", err
+	}
+	c.charged += tender.Amount
+	return "hold-" + key, nil
+}
+
+func (c *fakeClients) Capture(ctx context.Context, holdID string) error {
+	c.record("capture " + holdID)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.captureErr[holdID]
+}
+
+func (c *fakeClients) Release(ctx context.Context, holdID string) error {
+	c.record("release " + holdID)
+	return nil
+}
+
+func (c *fakeClients) Refund(ctx context.Context, key, holdID string, amount float64) error {
+	c.record(fmt.Sprintf("refund %s %.2f", holdID, amount))
+	return nil
+}
+
+func (c *fakeClients) CreateOrder(ctx context.Context, key, userID string, productIDs []string, shippingAddress string) (string, error) {
+	c.record("order")
+	if c.onOrder != nil {
+		c.onOrder()
+	}
+	return "ord-" + key, nil
+}
+
+func (c *fakeClients) CancelOrder(ctx context.Context, orderID string) error {
+	c.record("cancel " + orderID)
+	return nil
+}
+
+func (c *fakeClients) GetCart(ctx context.Context, userID string) ([]domain.CartLine, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return []domain.CartLine{{ProductID: "prod-1", Quantity: 2, UnitPrice: c.unitPrice}}, nil
+}
+
+func (c *fakeClients) ClearCart(ctx context.Context, userID, orderID string) error {
+	c.record("clear cart")
+	return nil
+}
+
+func newTestCheckoutService(t *testing.T) (*application.CheckoutService, *fakeSessionRepository, *fakeClients) {
+	repo := newFakeSessionRepository()
+	quotes := &fakeQuoteRepository{quotes: make(map[string]domain.Quote)}
+	clients := &fakeClients{unitPrice: 20}
+	clients.pricing = &fakePricing{
+		shipping: 2,
+		coupons:  map[string]*application.CouponTerms{"SAVE5": {Code: "SAVE5", Type: application.CouponFixed, Value: 5}},
+		vouchers: map[string]*application.VoucherTerms{"GIFT10": {Code: "GIFT10", Type: application.VoucherGiftCard, Value: 10}},
+		record:   clients.record,
+	}
+	pricing := newTestPricingEngine(clients.pricing)
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+	tenders := map[domain.TenderType]application.TenderClient{
+		domain.TenderWallet: clients, domain.TenderCoins: clients, domain.TenderCard: clients,
+	}
+	service, err := application.NewCheckoutService(repo, saga.NewMemoryStore(), quotes, pricing, clients, tenders, clients, clients, log)
+	require.NoError(t, err)
+	t.Cleanup(service.Close)
+	return service, repo, clients
+}
+
+// card pays the rest of a checkout
+var card = domain.Tender{Type: domain.TenderCard, PaymentMethodID: "pm-1"}
+
+// newSession is a card checkout of one item, as InitiateCheckout creates it
+func newSession() *domain.CheckoutSession {
+	tenders := []domain.Tender{{Type: domain.TenderCard, Amount: 42, PaymentMethodID: "pm-1", Status: domain.TenderPending}}
+	return domain.NewCheckoutSession("user-1", "1 Main St", []domain.CheckoutItem{{ProductID: "prod-1", Quantity: 1}}, tenders, 42)
+}
+
+// checkout quotes the cart and checks the quote out with the tenders, or
+// by card if there are none
+func checkout(t *testing.T, service *application.CheckoutService, tenders ...domain.Tender) *domain.CheckoutSession {
+	if len(tenders) == 0 {
+		tenders = []domain.Tender{card}
+	}
+	quote, err := service.CreateQuote(context.Background(), "user-1", "1 Main St", "", "")
+	require.NoError(t, err)
+	session, err := service.InitiateCheckout(context.Background(), "user-1", quote.QuoteID, tenders)
+	require.NoError(t, err)
+	return session
+}
+
+func waitForStatus(t *testing.T, repo *fakeSessionRepository, sessionID string, status domain.CheckoutStatus) *domain.CheckoutSession {
+	var session *domain.CheckoutSession
+	require.Eventually(t, func() bool {
+		session, _ = repo.FindByID(context.Background(), sessionID)
+		return session != nil && session.Status == status
+	}, 2*time.Second, 5*time.Millisecond)
+	return session
+}
+
+func TestCheckoutService_ResumesInterruptedSaga(t *testing.T) {
+	service, repo, clients := newTestCheckoutService(t)
+	ctx := context.Background()
+
+	// A replica reserved stock and crashed before paying
+	session := newSession()
+	session.MarkReservingInventory()
+	session.MarkProcessingPayment("res-" + session.SessionID)
+	require.NoError(t, repo.Create(ctx, session))
+
+	started, err := service.RecoverSagas(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, started)
+
+	done := waitForStatus(t, repo, session.SessionID, domain.CheckoutStatusCompleted)
+	assert.Equal(t, "ord-"+session.SessionID, done.OrderID)
+	assert.Equal(t, []string{
+		"hold CARD", "order", "capture hold-" + session.SessionID + ":0", "commit res-" + session.SessionID, "clear cart",
+	}, clients.Calls())
+
+	var logged []domain.CheckoutStatus
+	for _, step := range done.Steps {
+		logged = append(logged, step.Status)
+	}
+	assert.Equal(t, []domain.CheckoutStatus{
+		domain.CheckoutStatusInitiated, domain.CheckoutStatusReservingInventory, domain.CheckoutStatusProcessingPayment,
+		domain.CheckoutStatusCreatingOrder, domain.CheckoutStatusCreatingOrder, domain.CheckoutStatusFinalizing,
+		domain.CheckoutStatusCompleted,
+	}, logged)
+
+	// Finished sagas are not recovered again
+	started, err = service.RecoverSagas(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, started)
+}
+
+func TestCheckoutService_CompensatesFailedPayment(t *testing.T) {
+	service, repo, clients := newTestCheckoutService(t)
+	clients.holdErr = map[domain.TenderType]error{domain.TenderCard: fmt.Errorf("card declined")}
+
+	session := checkout(t, service)
+
+	failed := waitForStatus(t, repo, session.SessionID, domain.CheckoutStatusFailed)
+	assert.Equal(t, "Payment failed: CARD tender of 42.00: card declined", failed.ErrorMessage)
+	assert.Equal(t, []string{"reserve", "hold CARD", "hold CARD", "hold CARD", "rollback res-" + session.SessionID}, clients.Calls())
+}
+
+func TestCheckoutService_SplitTender(t *testing.T) {
+	service, repo, clients := newTestCheckoutService(t)
+
+	session := checkout(t, service,
+		domain.Tender{Type: domain.TenderWallet, Amount: 30},
+		domain.Tender{Type: domain.TenderCoins, Amount: 2.5},
+		card)
+	assert.Equal(t, 9.5, session.Tenders[2].Amount)
+
+	done := waitForStatus(t, repo, session.SessionID, domain.CheckoutStatusCompleted)
+	hold := "hold-" + session.SessionID
+	assert.Equal(t, []string{
+		"reserve", "hold WALLET", "hold COINS", "hold CARD", "order",
+		"capture " + hold + ":0", "capture " + hold + ":1", "capture " + hold + ":2",
+		"commit res-" + session.SessionID, "clear cart",
+	}, clients.Calls())
+	for _, tender := range done.Tenders {
+		assert.Equal(t, domain.TenderCaptured, tender.Status)
+	}
+	clients.mu.Lock()
+	assert.Equal(t, 42.0, clients.charged)
+	clients.mu.Unlock()
+}
+
+func TestCheckoutService_SplitTenderReleasesHeldTenders(t *testing.T) {
+	service, repo, clients := newTestCheckoutService(t)
+	clients.holdErr = map[domain.TenderType]error{domain.TenderCard: fmt.Errorf("card declined")}
+
+	session := checkout(t, service,
+		domain.Tender{Type: domain.TenderWallet, Amount: 30},
+		domain.Tender{Type: domain.TenderCoins, Amount: 2.5},
+		card)
+
+	failed := waitForStatus(t, repo, session.SessionID, domain.CheckoutStatusFailed)
+	hold := "hold-" + session.SessionID
+	assert.Equal(t, []string{
+		"reserve", "hold WALLET", "hold COINS", "hold CARD", "hold CARD", "hold CARD",
+		"release " + hold + ":1", "release " + hold + ":0", "rollback res-" + session.SessionID,
+	}, clients.Calls())
+	assert.Equal(t, domain.TenderReleased, failed.Tenders[0].Status)
+	assert.Equal(t, domain.TenderReleased, failed.Tenders[1].Status)
+	assert.Equal(t, domain.TenderPending, failed.Tenders[2].Status)
+
+	// Tenders must add up to the total
+	quote, err := service.CreateQuote(context.Background(), "user-1", "1 Main St", "", "")
+	require.NoError(t, err)
+	_, err = service.InitiateCheckout(context.Background(), "user-1", quote.QuoteID,
+		[]domain.Tender{{Type: domain.TenderWallet, Amount: 30}, {Type: domain.TenderCoins, Amount: 2.5}})
+	require.Error(t, err)
+	assert.Equal(t, errors.ErrInvalidInput, err.(*errors.AppError).Code)
+}
+
+// failingCapture stores a confirmed checkout whose wallet tender is
+// captured and whose card keeps failing to capture, and returns it with its
+// hold ID prefix
+func failingCapture(t *testing.T, repo *fakeSessionRepository, clients *fakeClients) (*domain.CheckoutSession, string) {
+	session := newSession()
+	session.Tenders = []domain.Tender{
+		{Type: domain.TenderWallet, Amount: 30, Status: domain.TenderPending},
+		{Type: domain.TenderCard, Amount: 12, PaymentMethodID: "pm-1", Status: domain.TenderPending},
+	}
+	hold := "hold-" + session.SessionID
+	session.MarkReservingInventory()
+	session.MarkProcessingPayment("res-" + session.SessionID)
+	session.MarkTenderHeld(0, hold+":0")
+	session.MarkTenderHeld(1, hold+":1")
+	session.MarkCreatingOrder()
+	session.MarkOrderPlaced("ord-" + session.SessionID)
+	session.MarkFinalizing()
+	session.MarkTenderCaptured(0)
+	require.NoError(t, repo.Create(context.Background(), session))
+	clients.captureErr = map[string]error{hold + ":1": fmt.Errorf("card processor unavailable")}
+	return session, hold
+}
+
+func TestCheckoutService_GivesUpOnCapture(t *testing.T) {
+	service, repo, clients := newTestCheckoutService(t)
+	service.SetCaptureWindow(0)
+	ctx := context.Background()
+	session, hold := failingCapture(t, repo, clients)
+
+	// Each recovery runs the saga from confirm-order until it gives up
+	var failed *domain.CheckoutSession
+	require.Eventually(t, func() bool {
+		_, _ = service.RecoverSagas(ctx)
+		failed, _ = repo.FindByID(ctx, session.SessionID)
+		return failed.Status == domain.CheckoutStatusFailed
+	}, 10*time.Second, 20*time.Millisecond)
+
+	assert.Equal(t, "Payment capture failed after 9 attempts", failed.ErrorMessage)
+	assert.Equal(t, domain.TenderRefunded, failed.Tenders[0].Status)
+	assert.Equal(t, domain.TenderReleased, failed.Tenders[1].Status)
+
+	calls := clients.Calls()
+	captures := 0
+	for _, call := range calls {
+		if call == "capture "+hold+":1" {
+			captures++
+		}
+	}
+	assert.Equal(t, application.CaptureRuns*application.StepAttempts, captures)
+	assert.Equal(t, []string{
+		"cancel ord-" + session.SessionID, "release " + hold + ":1", "refund " + hold + ":0 30.00", "rollback res-" + session.SessionID,
+	}, calls[len(calls)-4:])
+	assert.NotContains(t, calls, "commit res-"+session.SessionID)
+
+	// Given up checkouts are not recovered again
+	require.Eventually(t, func() bool {
+		started, err := service.RecoverSagas(ctx)
+		return err == nil && started == 0
+	}, 2*time.Second, 20*time.Millisecond)
+}
+
+func TestCheckoutService_RetriesCaptureWithinWindow(t *testing.T) {
+	service, repo, clients := newTestCheckoutService(t)
+	ctx := context.Background()
+	session, hold := failingCapture(t, repo, clients)
+
+	// Well past CaptureRuns runs, but within the capture window
+	require.Eventually(t, func() bool {
+		_, _ = service.RecoverSagas(ctx)
+		captures := 0
+		for _, call := range clients.Calls() {
+			if call == "capture "+hold+":1" {
+				captures++
+			}
+		}
+		return captures >= 2*application.CaptureRuns*application.StepAttempts
+	}, 10*time.Second, 20*time.Millisecond)
+	service.Close()
+
+	stored, err := repo.FindByID(ctx, session.SessionID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.CheckoutStatusFinalizing, stored.Status)
+	assert.Equal(t, domain.TenderCaptured, stored.Tenders[0].Status)
+	assert.NotContains(t, clients.Calls(), "cancel ord-"+session.SessionID)
+}
+
+func TestCheckoutService_LeaseHeldElsewhere(t *testing.T) {
+	service, repo, clients := newTestCheckoutService(t)
+	ctx := context.Background()
+
+	session := newSession()
+	require.NoError(t, repo.Create(ctx, session))
+	held, err := repo.AcquireLease(ctx, session.SessionID, "other-replica")
+	require.NoError(t, err)
+	require.True(t, held)
+
+	started, err := service.RecoverSagas(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, started)
+	assert.Empty(t, clients.Calls())
+}
+
+func TestCheckoutService_CancelWhileOrderIsPlaced(t *testing.T) {
+	service, repo, clients := newTestCheckoutService(t)
+	ctx := context.Background()
+
+	var cancelled bool
+	var sessionID string
+	created := make(chan struct{})
+	clients.onOrder = func() {
+		<-created
+		_, cancelled, _ = service.CancelCheckout(ctx, sessionID)
+	}
+
+	session := checkout(t, service)
+	sessionID = session.SessionID
+	close(created)
+
+	// The order was placed before the saga saw the cancel, so it is undone too
+	done := waitForStatus(t, repo, sessionID, domain.CheckoutStatusCancelled)
+	assert.True(t, cancelled)
+	assert.Equal(t, domain.CancelledMessage, done.ErrorMessage)
+	assert.Equal(t, []string{
+		"reserve", "hold CARD", "order", "cancel ord-" + sessionID, "release hold-" + sessionID + ":0", "rollback res-" + sessionID,
+	}, clients.Calls())
+}
+
+func TestCheckoutService_CancelAfterConfirmLoses(t *testing.T) {
+	service, repo, clients := newTestCheckoutService(t)
+	ctx := context.Background()
+
+	session := checkout(t, service)
+	waitForStatus(t, repo, session.SessionID, domain.CheckoutStatusCompleted)
+
+	current, cancelled, err := service.CancelCheckout(ctx, session.SessionID)
+	require.NoError(t, err)
+	assert.False(t, cancelled)
+	assert.Equal(t, domain.CheckoutStatusCompleted, current.Status)
+	assert.NotContains(t, clients.Calls(), "release hold-"+session.SessionID+":0")
+}
+
+func TestCheckoutService_ChargesLockedQuote(t *testing.T) {
+	service, repo, clients := newTestCheckoutService(t)
+	ctx := context.Background()
+
+	quote, err := service.CreateQuote(ctx, "user-1", "1 Main St", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, 42.0, quote.Total)
+
+	// A price change after quoting does not change what is charged
+	clients.mu.Lock()
+	clients.unitPrice = 25
+	clients.mu.Unlock()
+
+	session, err := service.InitiateCheckout(ctx, "user-1", quote.QuoteID, []domain.Tender{card})
+	require.NoError(t, err)
+	waitForStatus(t, repo, session.SessionID, domain.CheckoutStatusCompleted)
+	clients.mu.Lock()
+	assert.Equal(t, 42.0, clients.charged)
+	// Stock is held for the quoted quantities, not one unit per product
+	assert.Equal(t, []domain.CheckoutItem{{ProductID: "prod-1", Quantity: 2}}, clients.reserved)
+	clients.mu.Unlock()
+
+	// A quote is charged once
+	_, err = service.InitiateCheckout(ctx, "user-1", quote.QuoteID, []domain.Tender{card})
+	require.Error(t, err)
+	assert.Equal(t, errors.ErrConflict, err.(*errors.AppError).Code)
+}
+
+func TestCheckoutService_RedeemsCodes(t *testing.T) {
+	service, repo, clients := newTestCheckoutService(t)
+	ctx := context.Background()
+
+	quote, err := service.CreateQuote(ctx, "user-1", "1 Main St", "SAVE5", "GIFT10")
+	require.NoError(t, err)
+	session, err := service.InitiateCheckout(ctx, "user-1", quote.QuoteID, []domain.Tender{card})
+	require.NoError(t, err)
+
+	waitForStatus(t, repo, session.SessionID, domain.CheckoutStatusCompleted)
+	assert.Equal(t, []string{
+		"reserve", "apply coupon SAVE5", "redeem voucher GIFT10", "hold CARD", "order",
+		"capture hold-" + session.SessionID + ":0", "commit res-" + session.SessionID, "clear cart",
+	}, clients.Calls())
+}
+
+func TestCheckoutService_ReleasesCodesOnFailure(t *testing.T) {
+	service, repo, clients := newTestCheckoutService(t)
+	clients.holdErr = map[domain.TenderType]error{domain.TenderCard: fmt.Errorf("card declined")}
+	ctx := context.Background()
+
+	quote, err := service.CreateQuote(ctx, "user-1", "1 Main St", "SAVE5", "GIFT10")
+	require.NoError(t, err)
+	session, err := service.InitiateCheckout(ctx, "user-1", quote.QuoteID, []domain.Tender{card})
+	require.NoError(t, err)
+
+	waitForStatus(t, repo, session.SessionID, domain.CheckoutStatusFailed)
+	assert.Equal(t, []string{
+		"reserve", "apply coupon SAVE5", "redeem voucher GIFT10", "hold CARD", "hold CARD", "hold CARD",
+		"release voucher GIFT10", "release coupon SAVE5", "rollback res-" + session.SessionID,
+	}, clients.Calls())
+}
+
+func TestCheckoutService_ReleasesCouponWhenVoucherFails(t *testing.T) {
+	service, repo, clients := newTestCheckoutService(t)
+	clients.pricing.redeemErr = errors.New(errors.ErrConflict, "voucher already redeemed")
+	ctx := context.Background()
+
+	quote, err := service.CreateQuote(ctx, "user-1", "1 Main St", "SAVE5", "GIFT10")
+	require.NoError(t, err)
+	session, err := service.InitiateCheckout(ctx, "user-1", quote.QuoteID, []domain.Tender{card})
+	require.NoError(t, err)
+
+	failed := waitForStatus(t, repo, session.SessionID, domain.CheckoutStatusFailed)
+	assert.Contains(t, failed.ErrorMessage, "Code redemption failed: voucher GIFT10")
+	calls := clients.Calls()
+	assert.NotContains(t, calls, "hold CARD")
+	assert.Equal(t, []string{"release voucher GIFT10", "release coupon SAVE5", "rollback res-" + session.SessionID}, calls[len(calls)-3:])
+}
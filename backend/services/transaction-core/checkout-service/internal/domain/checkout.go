@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,73 +14,182 @@ const (
 	CheckoutStatusReservingInventory CheckoutStatus = "RESERVING_INVENTORY"
 	CheckoutStatusProcessingPayment  CheckoutStatus = "PROCESSING_PAYMENT"
 	CheckoutStatusCreatingOrder      CheckoutStatus = "CREATING_ORDER"
+	CheckoutStatusFinalizing         CheckoutStatus = "FINALIZING" // Order placed; capturing payment, committing stock and clearing the cart
 	CheckoutStatusCompleted          CheckoutStatus = "COMPLETED"
 	CheckoutStatusFailed             CheckoutStatus = "FAILED"
 	CheckoutStatusCompensating       CheckoutStatus = "COMPENSATING"
+	CheckoutStatusCancelling         CheckoutStatus = "CANCELLING" // Cancel accepted; undoing the steps taken
+	CheckoutStatusCancelled          CheckoutStatus = "CANCELLED"
 )
 
-// CheckoutSession represents a Saga instance
+// CancelledMessage is the error message of a cancelled checkout
+const CancelledMessage = "Checkout cancelled"
+
+// CheckoutStep is one entry of a session's step log
+type CheckoutStep struct {
+	Status CheckoutStatus `json:"status"`
+	Detail string         `json:"detail,omitempty"`
+	At     time.Time      `json:"at"`
+}
+
+// CheckoutItem is a product and how many units of it are checked out
+type CheckoutItem struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+// CheckoutSession represents a Saga instance. Its status says which step
+// runs next, so a saga interrupted at any point resumes from its session.
 type CheckoutSession struct {
 	SessionID       string
 	UserID          string
 	ProductIDs      []string
+	Items           []CheckoutItem // What inventory holds for the checkout
 	TotalAmount     float64
 	ShippingAddress string
-	PaymentMethodID string
+	Tenders         []Tender // How the total is paid, in the order the tenders are held
 	Status          CheckoutStatus
 	ErrorMessage    string
 	OrderID         string
-	PaymentID       string
 	ReservationID   string
+	QuoteID         string         // The quote whose total is charged
+	Steps           []CheckoutStep // Every status the session has been in, oldest first
+	Version         int            // Bumped by every save, for optimistic locking
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
 }
 
-func NewCheckoutSession(userID, shippingAddress, paymentMethodID string, productIDs []string, totalAmount float64) *CheckoutSession {
-	now := time.Now()
-	return &CheckoutSession{
+func NewCheckoutSession(userID, shippingAddress string, items []CheckoutItem, tenders []Tender, totalAmount float64) *CheckoutSession {
+	productIDs := make([]string, len(items))
+	for i, item := range items {
+		productIDs[i] = item.ProductID
+	}
+
+	session := &CheckoutSession{
 		SessionID:       uuid.New().String(),
 		UserID:          userID,
 		ProductIDs:      productIDs,
+		Items:           items,
 		TotalAmount:     totalAmount,
 		ShippingAddress: shippingAddress,
-		PaymentMethodID: paymentMethodID,
-		Status:          CheckoutStatusInitiated,
-		CreatedAt:       now,
-		UpdatedAt:       now,
+		Tenders:         tenders,
+		Version:         1,
+		CreatedAt:       time.Now(),
+	}
+	session.moveTo(CheckoutStatusInitiated, "")
+	return session
+}
+
+// Terminal reports whether the saga has finished, either way
+func (s *CheckoutSession) Terminal() bool {
+	return s.Status == CheckoutStatusCompleted || s.Status == CheckoutStatusFailed || s.Status == CheckoutStatusCancelled
+}
+
+// Cancellable reports whether cancelling can still undo the checkout. Once
+// the order is confirmed the checkout runs to completion.
+func (s *CheckoutSession) Cancellable() bool {
+	switch s.Status {
+	case CheckoutStatusFinalizing, CheckoutStatusCompleted, CheckoutStatusFailed, CheckoutStatusCompensating,
+		CheckoutStatusCancelling, CheckoutStatusCancelled:
+		return false
+	default:
+		return true
 	}
 }
 
 func (s *CheckoutSession) MarkReservingInventory() {
-	s.Status = CheckoutStatusReservingInventory
-	s.UpdatedAt = time.Now()
+	s.advance(CheckoutStatusReservingInventory, "")
 }
 
 func (s *CheckoutSession) MarkProcessingPayment(reservationID string) {
-	s.Status = CheckoutStatusProcessingPayment
 	s.ReservationID = reservationID
+	s.advance(CheckoutStatusProcessingPayment, "reservation "+reservationID)
+}
+
+// MarkTenderHeld records the hold on tender i
+func (s *CheckoutSession) MarkTenderHeld(i int, holdID string) {
+	s.Tenders[i].HoldID = holdID
+	s.Tenders[i].Status = TenderHeld
+	s.UpdatedAt = time.Now()
+}
+
+// MarkTenderReleased records that tender i's hold was released
+func (s *CheckoutSession) MarkTenderReleased(i int) {
+	s.Tenders[i].Status = TenderReleased
+	s.UpdatedAt = time.Now()
+}
+
+// MarkTenderCaptured records that tender i's held funds were taken
+func (s *CheckoutSession) MarkTenderCaptured(i int) {
+	s.Tenders[i].Status = TenderCaptured
 	s.UpdatedAt = time.Now()
 }
 
-func (s *CheckoutSession) MarkCreatingOrder(paymentID string) {
-	s.Status = CheckoutStatusCreatingOrder
-	s.PaymentID = paymentID
+// MarkTenderRefunded records that tender i's captured funds were given back
+func (s *CheckoutSession) MarkTenderRefunded(i int) {
+	s.Tenders[i].Status = TenderRefunded
 	s.UpdatedAt = time.Now()
 }
 
+// MarkCreatingOrder records that every tender is held
+func (s *CheckoutSession) MarkCreatingOrder() {
+	s.advance(CheckoutStatusCreatingOrder, fmt.Sprintf("payment held in %d tenders", len(s.Tenders)))
+}
+
+// MarkOrderPlaced records the placed order. It stays cancellable until
+// MarkFinalizing confirms it.
+func (s *CheckoutSession) MarkOrderPlaced(orderID string) {
+	s.OrderID = orderID
+	s.advance(CheckoutStatusCreatingOrder, "order "+orderID)
+}
+
+// MarkFinalizing confirms the placed order; the checkout completes from here
+// on
+func (s *CheckoutSession) MarkFinalizing() {
+	s.moveTo(CheckoutStatusFinalizing, "")
+}
+
 func (s *CheckoutSession) MarkCompleted(orderID string) {
-	s.Status = CheckoutStatusCompleted
 	s.OrderID = orderID
-	s.UpdatedAt = time.Now()
+	s.moveTo(CheckoutStatusCompleted, "")
 }
 
 func (s *CheckoutSession) MarkFailed(errorMessage string) {
-	s.Status = CheckoutStatusFailed
 	s.ErrorMessage = errorMessage
-	s.UpdatedAt = time.Now()
+	s.moveTo(CheckoutStatusFailed, errorMessage)
 }
 
-func (s *CheckoutSession) MarkCompensating() {
-	s.Status = CheckoutStatusCompensating
-	s.UpdatedAt = time.Now()
+// MarkCompensating starts undoing the steps taken so far
+func (s *CheckoutSession) MarkCompensating(reason string) {
+	s.ErrorMessage = reason
+	s.moveTo(CheckoutStatusCompensating, reason)
+}
+
+// MarkCancelling accepts a cancel request; the saga undoes its steps next
+func (s *CheckoutSession) MarkCancelling() {
+	s.ErrorMessage = CancelledMessage
+	s.moveTo(CheckoutStatusCancelling, "")
+}
+
+func (s *CheckoutSession) MarkCancelled() {
+	s.moveTo(CheckoutStatusCancelled, "")
+}
+
+// advance moves to the next forward step. A session being compensated or
+// cancelled keeps its status: the step's result is only recorded, so it is
+// undone too.
+func (s *CheckoutSession) advance(status CheckoutStatus, detail string) {
+	if s.Status == CheckoutStatusCompensating || s.Status == CheckoutStatusCancelling {
+		s.Steps = append(s.Steps, CheckoutStep{Status: s.Status, Detail: detail, At: time.Now()})
+		s.UpdatedAt = time.Now()
+		return
+	}
+	s.moveTo(status, detail)
+}
+
+func (s *CheckoutSession) moveTo(status CheckoutStatus, detail string) {
+	now := time.Now()
+	s.Status = status
+	s.Steps = append(s.Steps, CheckoutStep{Status: status, Detail: detail, At: now})
+	s.UpdatedAt = now
 }
@@ -0,0 +1,280 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// AdjustmentSource is the pricing component behind an adjustment
+type AdjustmentSource string
+
+const (
+	AdjustmentCampaign AdjustmentSource = "CAMPAIGN"
+	AdjustmentCoupon   AdjustmentSource = "COUPON"
+	AdjustmentVoucher  AdjustmentSource = "VOUCHER"
+)
+
+// Adjustment is an amount taken off a line, the shipping cost or the total,
+// with the reason shown to the buyer
+type Adjustment struct {
+	Source    AdjustmentSource `json:"source"`
+	Reference string           `json:"reference"` // Campaign ID, coupon or voucher code
+	Reason    string           `json:"reason"`
+	Amount    float64          `json:"amount"`
+}
+
+// CartLine is a cart item as the pricing engine sees it
+type CartLine struct {
+	ProductID  string
+	CategoryID string
+	Quantity   int
+	UnitPrice  float64
+}
+
+// QuoteLine is a priced cart line
+type QuoteLine struct {
+	ProductID  string       `json:"product_id"`
+	CategoryID string       `json:"category_id"`
+	Quantity   int          `json:"quantity"`
+	UnitPrice  float64      `json:"unit_price"`
+	Subtotal   float64      `json:"subtotal"` // Quantity × UnitPrice
+	Discounts  []Adjustment `json:"discounts"`
+	Discount   float64      `json:"discount"`
+	Tax        float64      `json:"tax"`
+	Total      float64      `json:"total"` // Subtotal - Discount + Tax
+}
+
+// Remaining is what the line costs after its discounts, before tax
+func (l *QuoteLine) Remaining() float64 {
+	return RoundCents(l.Subtotal - l.Discount)
+}
+
+// Quote is an itemized price for a cart, locked until it expires. A checkout
+// charges exactly the quote's total, so the price shown is the price paid.
+type Quote struct {
+	QuoteID           string       `json:"quote_id"`
+	UserID            string       `json:"user_id"`
+	ShippingAddress   string       `json:"shipping_address"`
+	CouponCode        string       `json:"coupon_code,omitempty"`
+	VoucherCode       string       `json:"voucher_code,omitempty"`
+	Lines             []QuoteLine  `json:"lines"`
+	Subtotal          float64      `json:"subtotal"`
+	Discount          float64      `json:"discount"` // Sum of the line discounts
+	ShippingCost      float64      `json:"shipping_cost"`
+	ShippingDiscounts []Adjustment `json:"shipping_discounts"`
+	ShippingDiscount  float64      `json:"shipping_discount"`
+	ShippingTax       float64      `json:"shipping_tax"`
+	Tax               float64      `json:"tax"`     // Line and shipping tax
+	Credits           []Adjustment `json:"credits"` // Gift cards, applied after tax
+	Credit            float64      `json:"credit"`
+	Total             float64      `json:"total"`
+	UsedBy            string       `json:"used_by,omitempty"` // Session that charged the quote
+	ExpiresAt         time.Time    `json:"expires_at"`
+	CreatedAt         time.Time    `json:"created_at"`
+}
+
+// NewQuote starts a quote for the given cart lines at their list prices
+func NewQuote(userID, shippingAddress string, lines []CartLine, ttl time.Duration) (*Quote, error) {
+	if len(lines) == 0 {
+		return nil, errors.New(errors.ErrInvalidInput, "cart is empty")
+	}
+
+	now := time.Now()
+	quote := &Quote{
+		QuoteID:         uuid.New().String(),
+		UserID:          userID,
+		ShippingAddress: shippingAddress,
+		ExpiresAt:       now.Add(ttl),
+		CreatedAt:       now,
+	}
+	for _, line := range lines {
+		if line.Quantity <= 0 || line.UnitPrice < 0 {
+			return nil, errors.New(errors.ErrInvalidInput, fmt.Sprintf("invalid cart line for product %s", line.ProductID))
+		}
+		quote.Lines = append(quote.Lines, QuoteLine{
+			ProductID:  line.ProductID,
+			CategoryID: line.CategoryID,
+			Quantity:   line.Quantity,
+			UnitPrice:  line.UnitPrice,
+			Subtotal:   RoundCents(float64(line.Quantity) * line.UnitPrice),
+		})
+	}
+	quote.recalculate()
+	return quote, nil
+}
+
+// ProductIDs lists the quoted products
+func (q *Quote) ProductIDs() []string {
+	ids := make([]string, len(q.Lines))
+	for i, line := range q.Lines {
+		ids[i] = line.ProductID
+	}
+	return ids
+}
+
+// Items lists the quoted products with their quantities
+func (q *Quote) Items() []CheckoutItem {
+	items := make([]CheckoutItem, len(q.Lines))
+	for i, line := range q.Lines {
+		items[i] = CheckoutItem{ProductID: line.ProductID, Quantity: line.Quantity}
+	}
+	return items
+}
+
+// Matching lists the lines whose product or category is among the given
+// ones; all lines when both lists are empty
+func (q *Quote) Matching(productIDs, categoryIDs []string) []int {
+	var lines []int
+	for i, line := range q.Lines {
+		if (len(productIDs) == 0 && len(categoryIDs) == 0) ||
+			contains(productIDs, line.ProductID) || contains(categoryIDs, line.CategoryID) {
+			lines = append(lines, i)
+		}
+	}
+	return lines
+}
+
+// Remaining is what the given lines cost after their discounts
+func (q *Quote) Remaining(lines []int) float64 {
+	var remaining float64
+	for _, i := range lines {
+		remaining += q.Lines[i].Remaining()
+	}
+	return RoundCents(remaining)
+}
+
+// ApplyDiscount spreads adj.Amount over the given lines in proportion to
+// what is left of each, never taking a line below zero. The last line takes
+// the rounding remainder. It returns the amount actually applied.
+func (q *Quote) ApplyDiscount(adj Adjustment, lines []int) float64 {
+	var eligible []int
+	for _, i := range lines {
+		if q.Lines[i].Remaining() > 0 {
+			eligible = append(eligible, i)
+		}
+	}
+	remaining := q.Remaining(eligible)
+	amount := RoundCents(math.Min(adj.Amount, remaining))
+	if amount <= 0 {
+		return 0
+	}
+
+	left := amount
+	for n, i := range eligible {
+		share := left
+		if n < len(eligible)-1 {
+			share = math.Min(RoundCents(amount*q.Lines[i].Remaining()/remaining), left)
+		}
+		if share <= 0 {
+			continue
+		}
+		line := &q.Lines[i]
+		line.Discounts = append(line.Discounts, Adjustment{
+			Source: adj.Source, Reference: adj.Reference, Reason: adj.Reason, Amount: share,
+		})
+		line.Discount = RoundCents(line.Discount + share)
+		left = RoundCents(left - share)
+	}
+	q.recalculate()
+	return amount
+}
+
+// SetShippingCost sets the shipping cost before discounts
+func (q *Quote) SetShippingCost(cost float64) {
+	q.ShippingCost = RoundCents(cost)
+	q.recalculate()
+}
+
+// ApplyShippingDiscount takes up to adj.Amount off the shipping cost and
+// returns the amount applied
+func (q *Quote) ApplyShippingDiscount(adj Adjustment) float64 {
+	amount := RoundCents(math.Min(adj.Amount, q.ShippingCost-q.ShippingDiscount))
+	if amount <= 0 {
+		return 0
+	}
+	adj.Amount = amount
+	q.ShippingDiscounts = append(q.ShippingDiscounts, adj)
+	q.ShippingDiscount = RoundCents(q.ShippingDiscount + amount)
+	q.recalculate()
+	return amount
+}
+
+// SetTax records the tax on each line, in line order, and on shipping
+func (q *Quote) SetTax(lineTax []float64, shippingTax float64) error {
+	if len(lineTax) != len(q.Lines) {
+		return errors.New(errors.ErrInternal, "tax was calculated for a different number of lines")
+	}
+	for i := range q.Lines {
+		q.Lines[i].Tax = RoundCents(lineTax[i])
+	}
+	q.ShippingTax = RoundCents(shippingTax)
+	q.recalculate()
+	return nil
+}
+
+// ApplyCredit pays up to adj.Amount of the total, e.g. from a gift card, and
+// returns the amount applied
+func (q *Quote) ApplyCredit(adj Adjustment) float64 {
+	amount := RoundCents(math.Min(adj.Amount, q.Total))
+	if amount <= 0 {
+		return 0
+	}
+	adj.Amount = amount
+	q.Credits = append(q.Credits, adj)
+	q.Credit = RoundCents(q.Credit + amount)
+	q.recalculate()
+	return amount
+}
+
+// Expired reports whether the quote's price lock has lapsed
+func (q *Quote) Expired(now time.Time) bool {
+	return !now.Before(q.ExpiresAt)
+}
+
+// CheckUsable verifies the quote can still be charged by the user's
+// checkout session
+func (q *Quote) CheckUsable(userID, sessionID string, now time.Time) error {
+	if q.UserID != userID {
+		return errors.New(errors.ErrNotFound, "quote not found")
+	}
+	if q.UsedBy != "" && q.UsedBy != sessionID {
+		return errors.New(errors.ErrConflict, "quote was already used by another checkout")
+	}
+	if q.Expired(now) {
+		return errors.New(errors.ErrInvalidInput, "quote has expired; request a new one")
+	}
+	return nil
+}
+
+func (q *Quote) recalculate() {
+	var subtotal, discount, tax float64
+	for i := range q.Lines {
+		line := &q.Lines[i]
+		line.Total = RoundCents(line.Subtotal - line.Discount + line.Tax)
+		subtotal += line.Subtotal
+		discount += line.Discount
+		tax += line.Tax
+	}
+	q.Subtotal = RoundCents(subtotal)
+	q.Discount = RoundCents(discount)
+	q.Tax = RoundCents(tax + q.ShippingTax)
+	q.Total = RoundCents(q.Subtotal - q.Discount + q.ShippingCost - q.ShippingDiscount + q.Tax - q.Credit)
+}
+
+// RoundCents rounds an amount to whole cents
+func RoundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package domain
+
+import "context"
+
+// SessionRepository stores checkout sessions and the leases that decide
+// which replica drives each one
+type SessionRepository interface {
+	Create(ctx context.Context, session *CheckoutSession) error
+	// Update saves the session if nobody saved it since it was loaded, and
+	// returns ErrConflict otherwise
+	Update(ctx context.Context, session *CheckoutSession) error
+	FindByID(ctx context.Context, sessionID string) (*CheckoutSession, error)
+	// FindResumable lists incomplete sessions nobody holds a lease on,
+	// oldest first
+	FindResumable(ctx context.Context, limit int) ([]*CheckoutSession, error)
+	// AcquireLease claims the session if it is free or its lease expired, or
+	// renews the lease if owner already holds it
+	AcquireLease(ctx context.Context, sessionID, owner string) (bool, error)
+	ReleaseLease(ctx context.Context, sessionID, owner string) error
+}
+
+// QuoteRepository stores price quotes
+type QuoteRepository interface {
+	Save(ctx context.Context, quote *Quote) error
+	// FindByID returns ErrNotFound if there is no such quote
+	FindByID(ctx context.Context, quoteID string) (*Quote, error)
+	// Claim marks the quote used by the session unless another session
+	// already did, and returns ErrConflict in that case
+	Claim(ctx context.Context, quoteID, sessionID string) error
+}
@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"fmt"
+
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// TenderType is a way of paying for part of a checkout
+type TenderType string
+
+const (
+	TenderWallet TenderType = "WALLET" // Wallet balance
+	TenderCoins  TenderType = "COINS"  // Gamification coins
+	TenderCard   TenderType = "CARD"   // Card through the payment gateway
+)
+
+// TenderStatus is where a tender's funds stand
+type TenderStatus string
+
+const (
+	TenderPending  TenderStatus = "PENDING"
+	TenderHeld     TenderStatus = "HELD"
+	TenderCaptured TenderStatus = "CAPTURED"
+	TenderReleased TenderStatus = "RELEASED"
+	TenderRefunded TenderStatus = "REFUNDED" // Captured, then given back
+)
+
+// Tender pays part of a checkout. Its funds are held first and captured
+// once every tender of the checkout is held; if any cannot be held, those
+// already held are released.
+type Tender struct {
+	Type            TenderType   `json:"type"`
+	Amount          float64      `json:"amount"`
+	PaymentMethodID string       `json:"payment_method_id,omitempty"` // Cards only
+	Status          TenderStatus `json:"status"`
+	HoldID          string       `json:"hold_id,omitempty"`
+}
+
+// NewTenders validates the tenders paying total, in the order they are
+// held. The last tender may leave its amount zero to pay whatever the
+// others leave.
+func NewTenders(tenders []Tender, total float64) ([]Tender, error) {
+	if len(tenders) == 0 {
+		return nil, errors.New(errors.ErrInvalidInput, "at least one tender is required")
+	}
+
+	result := make([]Tender, len(tenders))
+	remaining := total
+	for i, tender := range tenders {
+		switch tender.Type {
+		case TenderWallet, TenderCoins:
+		case TenderCard:
+			if tender.PaymentMethodID == "" {
+				return nil, errors.New(errors.ErrInvalidInput, "card tenders need a payment method")
+			}
+		default:
+			return nil, errors.New(errors.ErrInvalidInput, fmt.Sprintf("unsupported tender type %s", tender.Type))
+		}
+
+		if tender.Amount == 0 && i == len(tenders)-1 {
+			tender.Amount = remaining
+		}
+		tender.Amount = RoundCents(tender.Amount)
+		if tender.Amount <= 0 {
+			return nil, errors.New(errors.ErrInvalidInput, fmt.Sprintf("tender %d must pay a positive amount", i+1))
+		}
+		remaining = RoundCents(remaining - tender.Amount)
+
+		result[i] = Tender{Type: tender.Type, Amount: tender.Amount, PaymentMethodID: tender.PaymentMethodID, Status: TenderPending}
+	}
+
+	if remaining != 0 {
+		return nil, errors.New(errors.ErrInvalidInput,
+			fmt.Sprintf("tenders pay %.2f of a %.2f total", RoundCents(total-remaining), total))
+	}
+	return result, nil
+}
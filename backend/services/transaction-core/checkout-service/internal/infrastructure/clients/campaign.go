@@ -0,0 +1,59 @@
+package clients
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/titan-commerce/backend/checkout-service/internal/application"
+)
+
+// CampaignClient loads the running campaigns' pricing rules from
+// campaign-service
+type CampaignClient struct {
+	http *httpClient
+}
+
+// NewCampaignClient calls campaign-service at baseURL, e.g.
+// http://campaign-service:8080
+func NewCampaignClient(baseURL string) *CampaignClient {
+	return &CampaignClient{http: newHTTPClient("campaign-service", baseURL)}
+}
+
+func (c *CampaignClient) ActiveCampaigns(ctx context.Context, productIDs []string) ([]application.CampaignRule, error) {
+	var resp []struct {
+		CampaignID      string   `json:"campaign_id"`
+		Name            string   `json:"name"`
+		Type            string   `json:"type"`
+		Products        []string `json:"products"`
+		DiscountPercent int      `json:"discount_percent"`
+		MinPurchase     float64  `json:"min_purchase"`
+		MaxDiscount     float64  `json:"max_discount"`
+		BundleProducts  []string `json:"bundle_products"`
+		BundlePrice     float64  `json:"bundle_price"`
+		BuyQuantity     int      `json:"buy_quantity"`
+		GetQuantity     int      `json:"get_quantity"`
+		GetProductID    string   `json:"get_product_id"`
+	}
+	if err := c.http.get(ctx, "/api/v1/campaigns/pricing", url.Values{"product_id": productIDs}, &resp); err != nil {
+		return nil, err
+	}
+
+	rules := make([]application.CampaignRule, len(resp))
+	for i, r := range resp {
+		rules[i] = application.CampaignRule{
+			CampaignID:      r.CampaignID,
+			Name:            r.Name,
+			Type:            r.Type,
+			Products:        r.Products,
+			DiscountPercent: r.DiscountPercent,
+			MinPurchase:     r.MinPurchase,
+			MaxDiscount:     r.MaxDiscount,
+			BundleProducts:  r.BundleProducts,
+			BundlePrice:     r.BundlePrice,
+			BuyQuantity:     r.BuyQuantity,
+			GetQuantity:     r.GetQuantity,
+			GetProductID:    r.GetProductID,
+		}
+	}
+	return rules, nil
+}
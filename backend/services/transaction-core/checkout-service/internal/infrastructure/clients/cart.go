@@ -0,0 +1,86 @@
+package clients
+
+import (
+	"context"
+
+	cartpb "github.com/titan-commerce/backend/cart-service/proto/cart/v1"
+	"github.com/titan-commerce/backend/checkout-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	productpb "github.com/titan-commerce/backend/product-service/proto/product/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// CartClient reads the cart being checked out from cart-service, and the
+// category of each line, which campaigns and coupons may target, from
+// product-service
+type CartClient struct {
+	cartConn    *grpc.ClientConn
+	productConn *grpc.ClientConn
+	cart        cartpb.CartServiceClient
+	products    productpb.ProductServiceClient
+}
+
+// NewCartClient dials cart-service at cartAddr and product-service at
+// productAddr, e.g. cart-service:9000 and product-service:9000. The
+// connections are made lazily, so a service that is down fails the calls
+// rather than startup.
+func NewCartClient(cartAddr, productAddr string) (*CartClient, error) {
+	cartConn, err := grpc.Dial(cartAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to dial cart-service", err)
+	}
+	productConn, err := grpc.Dial(productAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		cartConn.Close()
+		return nil, errors.Wrap(errors.ErrInternal, "failed to dial product-service", err)
+	}
+	return &CartClient{
+		cartConn:    cartConn,
+		productConn: productConn,
+		cart:        cartpb.NewCartServiceClient(cartConn),
+		products:    productpb.NewProductServiceClient(productConn),
+	}, nil
+}
+
+func (c *CartClient) Close() error {
+	c.productConn.Close()
+	return c.cartConn.Close()
+}
+
+// GetCart returns the user's cart lines at the prices cart-service gives
+// them. It fails with ErrInvalidInput if a line cannot be bought as it is,
+// e.g. it is out of stock, so the shopper sees the cart's warnings first.
+func (c *CartClient) GetCart(ctx context.Context, userID string) ([]domain.CartLine, error) {
+	resp, err := c.cart.GetCart(ctx, &cartpb.GetCartRequest{UserId: userID})
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to get cart from cart-service", err)
+	}
+
+	lines := make([]domain.CartLine, 0, len(resp.Cart.Items))
+	for _, item := range resp.Cart.Items {
+		if item.Status != "" && item.Status != "AVAILABLE" {
+			return nil, errors.New(errors.ErrInvalidInput, "cart line "+item.ProductId+" cannot be bought as it is: "+item.Status)
+		}
+		product, err := c.products.GetProduct(ctx, &productpb.GetProductRequest{Id: item.ProductId})
+		if err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to get product "+item.ProductId+" from product-service", err)
+		}
+		lines = append(lines, domain.CartLine{
+			ProductID:  item.ProductId,
+			CategoryID: product.Product.CategoryId,
+			Quantity:   int(item.Quantity),
+			UnitPrice:  item.Price,
+		})
+	}
+	return lines, nil
+}
+
+// ClearCart empties the cart once orderID is placed from it; cart-service
+// counts an abandoned cart as recovered by the order
+func (c *CartClient) ClearCart(ctx context.Context, userID, orderID string) error {
+	if _, err := c.cart.ClearCart(ctx, &cartpb.ClearCartRequest{UserId: userID, OrderId: orderID}); err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to clear cart in cart-service", err)
+	}
+	return nil
+}
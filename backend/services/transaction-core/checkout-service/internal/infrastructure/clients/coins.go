@@ -0,0 +1,93 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/titan-commerce/backend/checkout-service/internal/domain"
+	gamificationpb "github.com/titan-commerce/backend/gamification-service/api/proto"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// CoinValue is what one coin pays of a checkout
+const CoinValue = 0.01
+
+// CoinsClient pays COINS tenders from the gamification-service coin wallet.
+// It has no escrow, so Hold spends the coins and Release earns them back.
+// Both are keyed by reference, so retries move no coins twice.
+type CoinsClient struct {
+	conn   *grpc.ClientConn
+	client gamificationpb.GamificationServiceClient
+}
+
+// NewCoinsClient dials gamification-service at addr, e.g.
+// gamification-service:9000. The connection is made lazily, so a
+// gamification-service that is down fails the calls rather than startup.
+func NewCoinsClient(addr string) (*CoinsClient, error) {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to dial gamification-service", err)
+	}
+	return &CoinsClient{conn: conn, client: gamificationpb.NewGamificationServiceClient(conn)}, nil
+}
+
+func (c *CoinsClient) Close() error {
+	return c.conn.Close()
+}
+
+// Hold spends the coins paying the tender's amount. The hold ID carries
+// what giving them back needs: the key, the user and the coins.
+func (c *CoinsClient) Hold(ctx context.Context, key, userID string, tender domain.Tender) (string, error) {
+	coins := int64(math.Round(tender.Amount / CoinValue))
+	if _, err := c.client.SpendCoins(ctx, &gamificationpb.SpendCoinsRequest{
+		UserId:      userID,
+		Amount:      coins,
+		Purpose:     "checkout",
+		ReferenceId: key,
+	}); err != nil {
+		return "", errors.Wrap(errors.ErrPaymentFailed, "gamification-service spend failed", err)
+	}
+	return fmt.Sprintf("%s/%s/%d", key, userID, coins), nil
+}
+
+// Capture does nothing: the coins were spent when held
+func (c *CoinsClient) Capture(ctx context.Context, holdID string) error {
+	return nil
+}
+
+func (c *CoinsClient) Release(ctx context.Context, holdID string) error {
+	return c.earnBack(ctx, holdID, ":release", "Released checkout coins")
+}
+
+// Refund earns back the coins of a captured tender; they are earned back
+// once per hold, so the key is not needed
+func (c *CoinsClient) Refund(ctx context.Context, key, holdID string, amount float64) error {
+	return c.earnBack(ctx, holdID, ":refund", "Refunded checkout coins")
+}
+
+func (c *CoinsClient) earnBack(ctx context.Context, holdID, suffix, description string) error {
+	parts := strings.Split(holdID, "/")
+	if len(parts) != 3 {
+		return errors.New(errors.ErrInvalidInput, "malformed coins hold ID "+holdID)
+	}
+	coins, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return errors.Wrap(errors.ErrInvalidInput, "malformed coins hold ID "+holdID, err)
+	}
+
+	if _, err := c.client.EarnCoins(ctx, &gamificationpb.EarnCoinsRequest{
+		UserId:      parts[1],
+		Amount:      coins,
+		Source:      "checkout",
+		ReferenceId: parts[0] + suffix,
+		Description: description,
+	}); err != nil {
+		return errors.Wrap(errors.ErrPaymentFailed, "gamification-service earn failed", err)
+	}
+	return nil
+}
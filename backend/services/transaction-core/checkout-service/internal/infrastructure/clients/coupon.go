@@ -0,0 +1,64 @@
+package clients
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/titan-commerce/backend/checkout-service/internal/application"
+)
+
+// CouponClient looks coupons up and applies them with coupon-service
+type CouponClient struct {
+	http *httpClient
+}
+
+// NewCouponClient calls coupon-service at baseURL, e.g.
+// http://coupon-service:8080
+func NewCouponClient(baseURL string) *CouponClient {
+	return &CouponClient{http: newHTTPClient("coupon-service", baseURL)}
+}
+
+func (c *CouponClient) GetCoupon(ctx context.Context, code, userID string) (*application.CouponTerms, error) {
+	var resp struct {
+		Code                 string   `json:"code"`
+		Type                 string   `json:"type"`
+		Value                float64  `json:"value"`
+		MinOrderValue        float64  `json:"min_order_value"`
+		MaxDiscount          float64  `json:"max_discount"`
+		ApplicableProducts   []string `json:"applicable_products"`
+		ApplicableCategories []string `json:"applicable_categories"`
+	}
+	query := url.Values{"code": {code}, "user_id": {userID}}
+	if err := c.http.get(ctx, "/api/v1/coupons/lookup", query, &resp); err != nil {
+		return nil, err
+	}
+
+	return &application.CouponTerms{
+		Code:                 resp.Code,
+		Type:                 resp.Type,
+		Value:                resp.Value,
+		MinOrderValue:        resp.MinOrderValue,
+		MaxDiscount:          resp.MaxDiscount,
+		ApplicableProducts:   resp.ApplicableProducts,
+		ApplicableCategories: resp.ApplicableCategories,
+	}, nil
+}
+
+// ApplyCoupon uses the coupon up for the key, the checkout session ID,
+// which coupon-service records as the order ID
+func (c *CouponClient) ApplyCoupon(ctx context.Context, key, code, userID string, orderTotal float64) error {
+	return c.http.post(ctx, "/api/v1/coupons/apply", map[string]interface{}{
+		"code":        code,
+		"user_id":     userID,
+		"order_id":    key,
+		"order_value": orderTotal,
+	}, nil)
+}
+
+func (c *CouponClient) ReleaseCoupon(ctx context.Context, key, code, userID string) error {
+	return c.http.post(ctx, "/api/v1/coupons/release", map[string]string{
+		"code":     code,
+		"user_id":  userID,
+		"order_id": key,
+	}, nil)
+}
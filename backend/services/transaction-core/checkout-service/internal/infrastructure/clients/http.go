@@ -0,0 +1,88 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// DefaultHTTPTimeout bounds each call to a service's HTTP API
+const DefaultHTTPTimeout = 5 * time.Second
+
+// httpClient calls the JSON HTTP API of a service that has no gRPC one,
+// e.g. coupon-service. A service that cannot be reached or fails answers
+// ErrInternal, so a quote is not priced without it.
+type httpClient struct {
+	service string
+	baseURL string
+	client  *http.Client
+}
+
+func newHTTPClient(service, baseURL string) *httpClient {
+	return &httpClient{
+		service: service,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: DefaultHTTPTimeout},
+	}
+}
+
+func (c *httpClient) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	return c.do(ctx, http.MethodGet, path+"?"+query.Encode(), nil, out)
+}
+
+func (c *httpClient) post(ctx context.Context, path string, body, out interface{}) error {
+	return c.do(ctx, http.MethodPost, path, body, out)
+}
+
+func (c *httpClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return errors.Wrap(errors.ErrInternal, "failed to encode "+c.service+" request", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, &reqBody)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to build "+c.service+" request", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, c.service+" unavailable", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var answer struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&answer)
+		message := fmt.Sprintf("%s: %s", c.service, answer.Error)
+
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			return errors.New(errors.ErrNotFound, message)
+		case http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity:
+			return errors.New(errors.ErrInvalidInput, message)
+		default:
+			return errors.New(errors.ErrInternal, fmt.Sprintf("%s answered %d: %s", c.service, resp.StatusCode, answer.Error))
+		}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to decode "+c.service+" response", err)
+	}
+	return nil
+}
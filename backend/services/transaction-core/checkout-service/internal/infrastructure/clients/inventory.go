@@ -0,0 +1,67 @@
+package clients
+
+import (
+	"context"
+
+	"github.com/titan-commerce/backend/checkout-service/internal/domain"
+	inventorypb "github.com/titan-commerce/backend/inventory-service/proto/inventory/v1"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// InventoryClient reserves a checkout's items with inventory-service
+type InventoryClient struct {
+	conn   *grpc.ClientConn
+	client inventorypb.InventoryServiceClient
+}
+
+// NewInventoryClient dials inventory-service at addr, e.g.
+// inventory-service:9000. The connection is made lazily, so an
+// inventory-service that is down fails the calls rather than startup.
+func NewInventoryClient(addr string) (*InventoryClient, error) {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to dial inventory-service", err)
+	}
+	return &InventoryClient{conn: conn, client: inventorypb.NewInventoryServiceClient(conn)}, nil
+}
+
+func (c *InventoryClient) Close() error {
+	return c.conn.Close()
+}
+
+// ReserveStock reserves every item or none. The key, the checkout session
+// ID, is the reservation ID, so a retry returns the reservation already made.
+func (c *InventoryClient) ReserveStock(ctx context.Context, key string, items []domain.CheckoutItem) (string, error) {
+	req := &inventorypb.ReserveStockRequest{
+		Items:         make([]*inventorypb.StockItem, len(items)),
+		ReservationId: key,
+	}
+	for i, item := range items {
+		req.Items[i] = &inventorypb.StockItem{ProductId: item.ProductID, Quantity: int32(item.Quantity)}
+	}
+
+	resp, err := c.client.ReserveStock(ctx, req)
+	if err != nil {
+		return "", errors.Wrap(errors.ErrInternal, "inventory-service reservation failed", err)
+	}
+	if !resp.Success {
+		return "", errors.New(errors.ErrInsufficientStock, resp.ErrorMessage)
+	}
+	return resp.ReservationId, nil
+}
+
+func (c *InventoryClient) CommitReservation(ctx context.Context, reservationID string) error {
+	if _, err := c.client.CommitReservation(ctx, &inventorypb.CommitReservationRequest{ReservationId: reservationID}); err != nil {
+		return errors.Wrap(errors.ErrInternal, "inventory-service commit failed", err)
+	}
+	return nil
+}
+
+func (c *InventoryClient) RollbackReservation(ctx context.Context, reservationID string) error {
+	if _, err := c.client.RollbackReservation(ctx, &inventorypb.RollbackReservationRequest{ReservationId: reservationID}); err != nil {
+		return errors.Wrap(errors.ErrInternal, "inventory-service rollback failed", err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package clients
+
+import (
+	"context"
+
+	"github.com/titan-commerce/backend/checkout-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	shippingpb "github.com/titan-commerce/backend/shipping-service/proto/shipping/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// UnitWeightKg is the weight assumed for each unit in a cart. Products
+// have no weight yet, so the shipping rate is for an estimated parcel.
+const UnitWeightKg = 0.5
+
+// ShippingClient gets shipping rates from shipping-service
+type ShippingClient struct {
+	conn   *grpc.ClientConn
+	client shippingpb.ShippingServiceClient
+}
+
+// NewShippingClient dials shipping-service at addr, e.g.
+// shipping-service:9000. The connection is made lazily, so a
+// shipping-service that is down fails the calls rather than startup.
+func NewShippingClient(addr string) (*ShippingClient, error) {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to dial shipping-service", err)
+	}
+	return &ShippingClient{conn: conn, client: shippingpb.NewShippingServiceClient(conn)}, nil
+}
+
+func (c *ShippingClient) Close() error {
+	return c.conn.Close()
+}
+
+// ShippingRate prices one parcel of the lines to the address, with the
+// default carrier
+func (c *ShippingClient) ShippingRate(ctx context.Context, shippingAddress string, lines []domain.CartLine) (float64, error) {
+	var weight float64
+	for _, line := range lines {
+		weight += float64(line.Quantity) * UnitWeightKg
+	}
+
+	resp, err := c.client.CalculateShippingCost(ctx, &shippingpb.CalculateShippingCostRequest{
+		DestinationAddress: shippingAddress,
+		Weight:             weight,
+	})
+	if err != nil {
+		return 0, errors.Wrap(errors.ErrInternal, "shipping-service rate failed", err)
+	}
+	return domain.RoundCents(resp.Cost), nil
+}
@@ -0,0 +1,30 @@
+package clients
+
+import (
+	"context"
+
+	"github.com/titan-commerce/backend/checkout-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// RateTaxClient taxes every line and the shipping at one configured rate.
+// There is no tax service yet to tax by address.
+type RateTaxClient struct {
+	rate float64
+}
+
+// NewRateTaxClient taxes at rate, e.g. 0.08 for 8%
+func NewRateTaxClient(rate float64) (*RateTaxClient, error) {
+	if rate < 0 || rate >= 1 {
+		return nil, errors.New(errors.ErrInvalidInput, "tax rate must be at least 0 and below 1")
+	}
+	return &RateTaxClient{rate: rate}, nil
+}
+
+func (c *RateTaxClient) CalculateTax(ctx context.Context, shippingAddress string, lines []domain.QuoteLine, shipping float64) ([]float64, float64, error) {
+	lineTax := make([]float64, len(lines))
+	for i := range lines {
+		lineTax[i] = domain.RoundCents(lines[i].Remaining() * c.rate)
+	}
+	return lineTax, domain.RoundCents(shipping * c.rate), nil
+}
@@ -0,0 +1,47 @@
+package clients
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/titan-commerce/backend/checkout-service/internal/application"
+)
+
+// VoucherClient looks vouchers up and redeems them with voucher-service
+type VoucherClient struct {
+	http *httpClient
+}
+
+// NewVoucherClient calls voucher-service at baseURL, e.g.
+// http://voucher-service:8080
+func NewVoucherClient(baseURL string) *VoucherClient {
+	return &VoucherClient{http: newHTTPClient("voucher-service", baseURL)}
+}
+
+func (c *VoucherClient) GetVoucher(ctx context.Context, code, userID string) (*application.VoucherTerms, error) {
+	var resp struct {
+		Code  string  `json:"code"`
+		Type  string  `json:"type"`
+		Value float64 `json:"value"`
+	}
+	query := url.Values{"code": {code}, "user_id": {userID}}
+	if err := c.http.get(ctx, "/api/v1/vouchers/lookup", query, &resp); err != nil {
+		return nil, err
+	}
+	return &application.VoucherTerms{Code: resp.Code, Type: resp.Type, Value: resp.Value}, nil
+}
+
+func (c *VoucherClient) RedeemVoucher(ctx context.Context, key, code, userID string) error {
+	return c.http.post(ctx, "/api/v1/vouchers/redeem", map[string]string{
+		"key":     key,
+		"code":    code,
+		"user_id": userID,
+	}, nil)
+}
+
+func (c *VoucherClient) ReleaseVoucher(ctx context.Context, key, code, userID string) error {
+	return c.http.post(ctx, "/api/v1/vouchers/release", map[string]string{
+		"key":  key,
+		"code": code,
+	}, nil)
+}
@@ -0,0 +1,69 @@
+package clients
+
+import (
+	"context"
+
+	"github.com/titan-commerce/backend/checkout-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	walletpb "github.com/titan-commerce/backend/wallet-service/proto/wallet/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// WalletClient holds WALLET tenders in wallet-service escrow
+type WalletClient struct {
+	conn   *grpc.ClientConn
+	client walletpb.WalletServiceClient
+}
+
+// NewWalletClient dials wallet-service at addr, e.g. wallet-service:9000.
+// The connection is made lazily, so a wallet-service that is down fails
+// the calls rather than startup.
+func NewWalletClient(addr string) (*WalletClient, error) {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to dial wallet-service", err)
+	}
+	return &WalletClient{conn: conn, client: walletpb.NewWalletServiceClient(conn)}, nil
+}
+
+func (c *WalletClient) Close() error {
+	return c.conn.Close()
+}
+
+// Hold holds the tender's amount of the user's wallet. The key is the
+// hold's reference, so a retry returns the hold already placed.
+func (c *WalletClient) Hold(ctx context.Context, key, userID string, tender domain.Tender) (string, error) {
+	resp, err := c.client.HoldFunds(ctx, &walletpb.HoldFundsRequest{
+		UserId:  userID,
+		Amount:  tender.Amount,
+		OrderId: key,
+	})
+	if err != nil {
+		return "", errors.Wrap(errors.ErrPaymentFailed, "wallet-service hold failed", err)
+	}
+	return resp.HoldId, nil
+}
+
+func (c *WalletClient) Capture(ctx context.Context, holdID string) error {
+	if _, err := c.client.ReleaseFunds(ctx, &walletpb.ReleaseFundsRequest{HoldId: holdID, ReleaseToUser: false}); err != nil {
+		return errors.Wrap(errors.ErrPaymentFailed, "wallet-service capture failed", err)
+	}
+	return nil
+}
+
+func (c *WalletClient) Release(ctx context.Context, holdID string) error {
+	if _, err := c.client.ReleaseFunds(ctx, &walletpb.ReleaseFundsRequest{HoldId: holdID, ReleaseToUser: true}); err != nil {
+		return errors.Wrap(errors.ErrPaymentFailed, "wallet-service release failed", err)
+	}
+	return nil
+}
+
+// Refund gives a captured hold back; wallet-service refunds a hold once,
+// so the key is not needed
+func (c *WalletClient) Refund(ctx context.Context, key, holdID string, amount float64) error {
+	if _, err := c.client.RefundHold(ctx, &walletpb.RefundHoldRequest{HoldId: holdID}); err != nil {
+		return errors.Wrap(errors.ErrPaymentFailed, "wallet-service refund failed", err)
+	}
+	return nil
+}
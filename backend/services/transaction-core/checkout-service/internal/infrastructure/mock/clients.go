@@ -2,32 +2,27 @@ package mock
 
 import (
 	"context"
-	"github.com/google/uuid"
+
+	"github.com/titan-commerce/backend/checkout-service/internal/domain"
 )
 
-// Mock Clients for Checkout Service
+// Mock Clients for Checkout Service. Results are derived from the idempotency
+// key, so retried calls return the same IDs as real services would.
 
-type MockInventoryClient struct{}
-func (m *MockInventoryClient) ReserveStock(ctx context.Context, productIDs []string) (string, error) {
-	return "res_" + uuid.New().String(), nil
+// MockTenderClient stands in for the wallet, the coin wallet or the card
+// gateway; Prefix tells their hold IDs apart
+type MockTenderClient struct{ Prefix string }
+func (m *MockTenderClient) Hold(ctx context.Context, key, userID string, tender domain.Tender) (string, error) {
+	return m.Prefix + key, nil
 }
-func (m *MockInventoryClient) CommitReservation(ctx context.Context, reservationID string) error { return nil }
-func (m *MockInventoryClient) RollbackReservation(ctx context.Context, reservationID string) error { return nil }
-
-type MockPaymentClient struct{}
-func (m *MockPaymentClient) ProcessPayment(ctx context.Context, userID string, amount float64, paymentMethodID string) (string, error) {
-	return "pay_" + uuid.New().String(), nil
+func (m *MockTenderClient) Capture(ctx context.Context, holdID string) error { return nil }
+func (m *MockTenderClient) Release(ctx context.Context, holdID string) error { return nil }
+func (m *MockTenderClient) Refund(ctx context.Context, key, holdID string, amount float64) error {
+	return nil
 }
-func (m *MockPaymentClient) RefundPayment(ctx context.Context, paymentID string) error { return nil }
 
 type MockOrderClient struct{}
-func (m *MockOrderClient) CreateOrder(ctx context.Context, userID string, productIDs []string, shippingAddress string) (string, error) {
-	return "ord_" + uuid.New().String(), nil
+func (m *MockOrderClient) CreateOrder(ctx context.Context, key, userID string, productIDs []string, shippingAddress string) (string, error) {
+	return "ord_" + key, nil
 }
 func (m *MockOrderClient) CancelOrder(ctx context.Context, orderID string) error { return nil }
-
-type MockCartClient struct{}
-func (m *MockCartClient) GetCart(ctx context.Context, userID string) (float64, []string, error) {
-	return 100.0, []string{"prod_1", "prod_2"}, nil
-}
-func (m *MockCartClient) ClearCart(ctx context.Context, userID string) error { return nil }
@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/titan-commerce/backend/checkout-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// QuoteRepository stores price quotes. The itemized quote is kept as JSONB;
+// the columns beside it are what lookups and claims need.
+type QuoteRepository struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
+
+func NewQuoteRepository(databaseURL string, logger *logger.Logger) (*QuoteRepository, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to connect to database", err)
+	}
+
+	logger.Info("Checkout quote repository initialized")
+	return &QuoteRepository{db: db, logger: logger}, nil
+}
+
+// Save inserts a new quote
+func (r *QuoteRepository) Save(ctx context.Context, quote *domain.Quote) error {
+	quoteJSON, err := json.Marshal(quote)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to marshal quote", err)
+	}
+
+	query := `
+		INSERT INTO checkout_quotes (quote_id, user_id, quote, total, used_by, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err = r.db.ExecContext(ctx, query,
+		quote.QuoteID, quote.UserID, string(quoteJSON), quote.Total, quote.UsedBy, quote.ExpiresAt, quote.CreatedAt)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to save quote", err)
+	}
+	return nil
+}
+
+// FindByID retrieves a quote
+func (r *QuoteRepository) FindByID(ctx context.Context, quoteID string) (*domain.Quote, error) {
+	var quoteJSON []byte
+	var usedBy string
+	err := r.db.QueryRowContext(ctx,
+		`SELECT quote, used_by FROM checkout_quotes WHERE quote_id = $1`, quoteID).Scan(&quoteJSON, &usedBy)
+	if err == sql.ErrNoRows {
+		return nil, errors.New(errors.ErrNotFound, "quote not found")
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to find quote", err)
+	}
+
+	var quote domain.Quote
+	if err := json.Unmarshal(quoteJSON, &quote); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to unmarshal quote", err)
+	}
+	quote.UsedBy = usedBy
+	return &quote, nil
+}
+
+// Claim marks the quote used by the session in one conditional update, so
+// two checkouts can never charge the same quote
+func (r *QuoteRepository) Claim(ctx context.Context, quoteID, sessionID string) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE checkout_quotes SET used_by = $2
+		WHERE quote_id = $1 AND (used_by = '' OR used_by = $2)
+	`, quoteID, sessionID)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to claim quote", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to get rows affected", err)
+	}
+	if rows == 0 {
+		return errors.New(errors.ErrConflict, "quote was already used by another checkout")
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+	"github.com/titan-commerce/backend/pkg/saga"
+)
+
+const executionColumns = `execution_id, workflow, status, step_cursor, failed_step, error, history, version, created_at, updated_at`
+
+// SagaStore persists saga executions and their history
+type SagaStore struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
+
+func NewSagaStore(databaseURL string, logger *logger.Logger) (*SagaStore, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to connect to database", err)
+	}
+
+	logger.Info("Saga execution store initialized")
+	return &SagaStore{db: db, logger: logger}, nil
+}
+
+// Create inserts a new execution
+func (s *SagaStore) Create(ctx context.Context, exec *saga.Execution) error {
+	historyJSON, err := json.Marshal(exec.History)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to marshal saga history", err)
+	}
+
+	query := `INSERT INTO saga_executions (` + executionColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	_, err = s.db.ExecContext(ctx, query,
+		exec.ID, exec.Workflow, exec.Status, exec.Cursor, exec.FailedStep, exec.Error, string(historyJSON),
+		exec.Version, exec.CreatedAt, exec.UpdatedAt)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to save saga execution", err)
+	}
+	return nil
+}
+
+// Load retrieves an execution, or nil if there is none with the ID
+func (s *SagaStore) Load(ctx context.Context, id string) (*saga.Execution, error) {
+	var exec saga.Execution
+	var historyJSON []byte
+	err := s.db.QueryRowContext(ctx,
+		`SELECT `+executionColumns+` FROM saga_executions WHERE execution_id = $1`, id).Scan(
+		&exec.ID, &exec.Workflow, &exec.Status, &exec.Cursor, &exec.FailedStep, &exec.Error, &historyJSON,
+		&exec.Version, &exec.CreatedAt, &exec.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to load saga execution", err)
+	}
+	if err := json.Unmarshal(historyJSON, &exec.History); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to unmarshal saga history", err)
+	}
+	return &exec, nil
+}
+
+// Update stores a changed execution if nobody else saved it since it was
+// loaded, and bumps its version
+func (s *SagaStore) Update(ctx context.Context, exec *saga.Execution) error {
+	historyJSON, err := json.Marshal(exec.History)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to marshal saga history", err)
+	}
+
+	query := `
+		UPDATE saga_executions
+		SET status = $2, step_cursor = $3, failed_step = $4, error = $5, history = $6, updated_at = $7,
+			version = version + 1
+		WHERE execution_id = $1 AND version = $8
+	`
+	result, err := s.db.ExecContext(ctx, query,
+		exec.ID, exec.Status, exec.Cursor, exec.FailedStep, exec.Error, string(historyJSON), exec.UpdatedAt, exec.Version)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to update saga execution", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to get rows affected", err)
+	}
+	if rows == 0 {
+		return errors.New(errors.ErrConflict, "saga execution was modified by another transaction (optimistic lock)")
+	}
+	exec.Version++
+	return nil
+}
@@ -0,0 +1,222 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/titan-commerce/backend/checkout-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// DefaultLeaseTTL is how long a replica keeps a session without renewing.
+// It must comfortably exceed the longest single saga step.
+const DefaultLeaseTTL = 30 * time.Second
+
+const sessionColumns = `session_id, user_id, product_ids, total_amount, shipping_address, tenders,
+	status, error_message, order_id, reservation_id, steps, version, created_at, updated_at, quote_id, items`
+
+// SessionRepository stores checkout sessions. Each row holds the saga's
+// current state, its step log and the lease of the replica driving it.
+type SessionRepository struct {
+	db       *sql.DB
+	leaseTTL time.Duration
+	logger   *logger.Logger
+}
+
+func NewSessionRepository(databaseURL string, leaseTTL time.Duration, logger *logger.Logger) (*SessionRepository, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to connect to database", err)
+	}
+	if leaseTTL <= 0 {
+		leaseTTL = DefaultLeaseTTL
+	}
+
+	logger.Info("Checkout session repository initialized")
+	return &SessionRepository{db: db, leaseTTL: leaseTTL, logger: logger}, nil
+}
+
+// Create inserts a new session
+func (r *SessionRepository) Create(ctx context.Context, session *domain.CheckoutSession) error {
+	doc, err := marshalSession(session)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO checkout_sessions (` + sessionColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+	`
+	_, err = r.db.ExecContext(ctx, query,
+		session.SessionID, session.UserID, doc.products, session.TotalAmount, session.ShippingAddress, doc.tenders,
+		session.Status, session.ErrorMessage, session.OrderID, session.ReservationID, doc.steps,
+		session.Version, session.CreatedAt, session.UpdatedAt, session.QuoteID, doc.items)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to save checkout session", err)
+	}
+	return nil
+}
+
+// Update stores a changed session if nobody else saved it since it was
+// loaded, and bumps its version
+func (r *SessionRepository) Update(ctx context.Context, session *domain.CheckoutSession) error {
+	doc, err := marshalSession(session)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE checkout_sessions
+		SET product_ids = $2, status = $3, error_message = $4, order_id = $5, tenders = $6,
+			reservation_id = $7, steps = $8, updated_at = $9, version = version + 1, items = $11
+		WHERE session_id = $1 AND version = $10
+	`
+	result, err := r.db.ExecContext(ctx, query,
+		session.SessionID, doc.products, session.Status, session.ErrorMessage, session.OrderID, doc.tenders,
+		session.ReservationID, doc.steps, session.UpdatedAt, session.Version, doc.items)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to update checkout session", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to get rows affected", err)
+	}
+	if rows == 0 {
+		return errors.New(errors.ErrConflict, "checkout session was modified by another transaction (optimistic lock)")
+	}
+	session.Version++
+	return nil
+}
+
+// FindByID retrieves a single session
+func (r *SessionRepository) FindByID(ctx context.Context, sessionID string) (*domain.CheckoutSession, error) {
+	query := `SELECT ` + sessionColumns + ` FROM checkout_sessions WHERE session_id = $1`
+
+	sessions, err := r.query(ctx, query, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, errors.New(errors.ErrNotFound, "checkout session not found")
+	}
+	return sessions[0], nil
+}
+
+// FindResumable lists incomplete sessions whose lease is free or expired,
+// oldest first
+func (r *SessionRepository) FindResumable(ctx context.Context, limit int) ([]*domain.CheckoutSession, error) {
+	query := `
+		SELECT ` + sessionColumns + ` FROM checkout_sessions
+		WHERE status NOT IN ('COMPLETED', 'FAILED', 'CANCELLED')
+			AND (lease_until IS NULL OR lease_until < NOW())
+		ORDER BY created_at
+		LIMIT $1
+	`
+	return r.query(ctx, query, limit)
+}
+
+// AcquireLease claims the session if it is free or its lease expired, or
+// renews the lease if owner already holds it
+func (r *SessionRepository) AcquireLease(ctx context.Context, sessionID, owner string) (bool, error) {
+	query := `
+		UPDATE checkout_sessions
+		SET lease_owner = $2, lease_until = NOW() + make_interval(secs => $3)
+		WHERE session_id = $1
+			AND (lease_owner IS NULL OR lease_owner = $2 OR lease_until < NOW())
+	`
+
+	result, err := r.db.ExecContext(ctx, query, sessionID, owner, r.leaseTTL.Seconds())
+	if err != nil {
+		return false, errors.Wrap(errors.ErrInternal, "failed to acquire checkout lease", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(errors.ErrInternal, "failed to get rows affected", err)
+	}
+	return rows == 1, nil
+}
+
+// ReleaseLease lets another replica take the session immediately
+func (r *SessionRepository) ReleaseLease(ctx context.Context, sessionID, owner string) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE checkout_sessions SET lease_owner = NULL, lease_until = NULL WHERE session_id = $1 AND lease_owner = $2",
+		sessionID, owner)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to release checkout lease", err)
+	}
+	return nil
+}
+
+func (r *SessionRepository) query(ctx context.Context, query string, args ...interface{}) ([]*domain.CheckoutSession, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to query checkout sessions", err)
+	}
+	defer rows.Close()
+
+	var sessions []*domain.CheckoutSession
+	for rows.Next() {
+		var session domain.CheckoutSession
+		var productsJSON, tendersJSON, itemsJSON, stepsJSON []byte
+		if err := rows.Scan(
+			&session.SessionID, &session.UserID, &productsJSON, &session.TotalAmount, &session.ShippingAddress,
+			&tendersJSON, &session.Status, &session.ErrorMessage, &session.OrderID,
+			&session.ReservationID, &stepsJSON, &session.Version, &session.CreatedAt, &session.UpdatedAt, &session.QuoteID,
+			&itemsJSON,
+		); err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to scan checkout session", err)
+		}
+		if err := json.Unmarshal(productsJSON, &session.ProductIDs); err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to unmarshal checkout products", err)
+		}
+		if err := json.Unmarshal(tendersJSON, &session.Tenders); err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to unmarshal checkout tenders", err)
+		}
+		if err := json.Unmarshal(itemsJSON, &session.Items); err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to unmarshal checkout items", err)
+		}
+		if err := json.Unmarshal(stepsJSON, &session.Steps); err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to unmarshal checkout steps", err)
+		}
+		sessions = append(sessions, &session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to read checkout sessions", err)
+	}
+	return sessions, nil
+}
+
+// sessionJSON holds a session's JSONB columns; lib/pq sends them as strings
+type sessionJSON struct {
+	products, tenders, items, steps string
+}
+
+func marshalSession(session *domain.CheckoutSession) (*sessionJSON, error) {
+	productsJSON, err := json.Marshal(session.ProductIDs)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to marshal checkout products", err)
+	}
+	tendersJSON, err := json.Marshal(session.Tenders)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to marshal checkout tenders", err)
+	}
+	itemsJSON, err := json.Marshal(session.Items)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to marshal checkout items", err)
+	}
+	stepsJSON, err := json.Marshal(session.Steps)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to marshal checkout steps", err)
+	}
+	return &sessionJSON{
+		products: string(productsJSON),
+		tenders:  string(tendersJSON),
+		items:    string(itemsJSON),
+		steps:    string(stepsJSON),
+	}, nil
+}
@@ -6,9 +6,11 @@ import (
 	"github.com/titan-commerce/backend/checkout-service/internal/application"
 	"github.com/titan-commerce/backend/checkout-service/internal/domain"
 	pb "github.com/titan-commerce/backend/checkout-service/proto/checkout/v1"
+	"github.com/titan-commerce/backend/pkg/errors"
 	"github.com/titan-commerce/backend/pkg/logger"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type CheckoutServiceServer struct {
@@ -24,11 +26,31 @@ func NewCheckoutServiceServer(service *application.CheckoutService, logger *logg
 	}
 }
 
+func (s *CheckoutServiceServer) CreateQuote(ctx context.Context, req *pb.CreateQuoteRequest) (*pb.CreateQuoteResponse, error) {
+	quote, err := s.service.CreateQuote(ctx, req.UserId, req.ShippingAddress, req.CouponCode, req.VoucherCode)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.CreateQuoteResponse{Quote: quoteToProto(quote)}, nil
+}
+
 func (s *CheckoutServiceServer) InitiateCheckout(ctx context.Context, req *pb.InitiateCheckoutRequest) (*pb.InitiateCheckoutResponse, error) {
-	session, err := s.service.InitiateCheckout(ctx, req.UserId, req.ShippingAddress, req.PaymentMethodId)
+	tenders := make([]domain.Tender, len(req.Tenders))
+	for i, tender := range req.Tenders {
+		tenders[i] = domain.Tender{
+			Type:            domain.TenderType(tender.Type),
+			Amount:          tender.Amount,
+			PaymentMethodID: tender.PaymentMethodId,
+		}
+	}
+	if len(tenders) == 0 && req.PaymentMethodId != "" {
+		tenders = []domain.Tender{{Type: domain.TenderCard, PaymentMethodID: req.PaymentMethodId}}
+	}
+
+	session, err := s.service.InitiateCheckout(ctx, req.UserId, req.QuoteId, tenders)
 	if err != nil {
 		s.logger.Error(err, "failed to initiate checkout")
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, toStatus(err)
 	}
 
 	return &pb.InitiateCheckoutResponse{
@@ -48,10 +70,15 @@ func (s *CheckoutServiceServer) GetCheckoutStatus(ctx context.Context, req *pb.G
 }
 
 func (s *CheckoutServiceServer) CancelCheckout(ctx context.Context, req *pb.CancelCheckoutRequest) (*pb.CancelCheckoutResponse, error) {
-	if err := s.service.CancelCheckout(ctx, req.SessionId); err != nil {
+	session, cancelled, err := s.service.CancelCheckout(ctx, req.SessionId)
+	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
-	return &pb.CancelCheckoutResponse{Success: true}, nil
+	return &pb.CancelCheckoutResponse{
+		Success:   true,
+		Cancelled: cancelled,
+		Session:   domainToProto(session),
+	}, nil
 }
 
 func domainToProto(session *domain.CheckoutSession) *pb.CheckoutSession {
@@ -66,16 +93,41 @@ func domainToProto(session *domain.CheckoutSession) *pb.CheckoutSession {
 		status = pb.CheckoutStatus_CHECKOUT_STATUS_PROCESSING_PAYMENT
 	case domain.CheckoutStatusCreatingOrder:
 		status = pb.CheckoutStatus_CHECKOUT_STATUS_CREATING_ORDER
+	case domain.CheckoutStatusFinalizing:
+		status = pb.CheckoutStatus_CHECKOUT_STATUS_FINALIZING
 	case domain.CheckoutStatusCompleted:
 		status = pb.CheckoutStatus_CHECKOUT_STATUS_COMPLETED
 	case domain.CheckoutStatusFailed:
 		status = pb.CheckoutStatus_CHECKOUT_STATUS_FAILED
 	case domain.CheckoutStatusCompensating:
 		status = pb.CheckoutStatus_CHECKOUT_STATUS_COMPENSATING
+	case domain.CheckoutStatusCancelling:
+		status = pb.CheckoutStatus_CHECKOUT_STATUS_CANCELLING
+	case domain.CheckoutStatusCancelled:
+		status = pb.CheckoutStatus_CHECKOUT_STATUS_CANCELLED
 	default:
 		status = pb.CheckoutStatus_CHECKOUT_STATUS_UNSPECIFIED
 	}
 
+	steps := make([]*pb.CheckoutStep, len(session.Steps))
+	for i, step := range session.Steps {
+		steps[i] = &pb.CheckoutStep{
+			Status: pb.CheckoutStatus(pb.CheckoutStatus_value["CHECKOUT_STATUS_"+string(step.Status)]),
+			Detail: step.Detail,
+			At:     timestamppb.New(step.At),
+		}
+	}
+
+	tenders := make([]*pb.Tender, len(session.Tenders))
+	for i, tender := range session.Tenders {
+		tenders[i] = &pb.Tender{
+			Type:            string(tender.Type),
+			Amount:          tender.Amount,
+			PaymentMethodId: tender.PaymentMethodID,
+			Status:          string(tender.Status),
+		}
+	}
+
 	return &pb.CheckoutSession{
 		SessionId:    session.SessionID,
 		UserId:       session.UserID,
@@ -84,7 +136,60 @@ func domainToProto(session *domain.CheckoutSession) *pb.CheckoutSession {
 		Status:       status,
 		ErrorMessage: session.ErrorMessage,
 		OrderId:      session.OrderID,
-		PaymentId:    session.PaymentID,
+		Steps:        steps,
+		Tenders:      tenders,
 		// Timestamps omitted for brevity
 	}
 }
+
+func quoteToProto(quote *domain.Quote) *pb.Quote {
+	lines := make([]*pb.QuoteLine, len(quote.Lines))
+	for i, line := range quote.Lines {
+		lines[i] = &pb.QuoteLine{
+			ProductId: line.ProductID,
+			Quantity:  int32(line.Quantity),
+			UnitPrice: line.UnitPrice,
+			Subtotal:  line.Subtotal,
+			Discounts: adjustmentsToProto(line.Discounts),
+			Discount:  line.Discount,
+			Tax:       line.Tax,
+			Total:     line.Total,
+		}
+	}
+
+	return &pb.Quote{
+		QuoteId:           quote.QuoteID,
+		Lines:             lines,
+		Subtotal:          quote.Subtotal,
+		Discount:          quote.Discount,
+		ShippingCost:      quote.ShippingCost,
+		ShippingDiscounts: adjustmentsToProto(quote.ShippingDiscounts),
+		ShippingDiscount:  quote.ShippingDiscount,
+		Tax:               quote.Tax,
+		Credits:           adjustmentsToProto(quote.Credits),
+		Credit:            quote.Credit,
+		Total:             quote.Total,
+		ExpiresAt:         timestamppb.New(quote.ExpiresAt),
+	}
+}
+
+func adjustmentsToProto(adjustments []domain.Adjustment) []*pb.PriceAdjustment {
+	result := make([]*pb.PriceAdjustment, len(adjustments))
+	for i, adj := range adjustments {
+		result[i] = &pb.PriceAdjustment{
+			Source:    string(adj.Source),
+			Reference: adj.Reference,
+			Reason:    adj.Reason,
+			Amount:    adj.Amount,
+		}
+	}
+	return result
+}
+
+// toStatus maps application errors to their gRPC codes
+func toStatus(err error) error {
+	if appErr, ok := err.(*errors.AppError); ok {
+		return appErr.ToGRPCError()
+	}
+	return status.Error(codes.Internal, err.Error())
+}
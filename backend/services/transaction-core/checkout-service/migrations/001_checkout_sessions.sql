@@ -0,0 +1,35 @@
+-- Checkout Service Database Schema
+--
+-- One row per checkout saga. The status says which step runs next, so a saga
+-- interrupted by a restart is resumed from its row. The replica driving a
+-- saga holds a lease on it; sessions whose lease lapsed are recovered by any
+-- replica.
+
+CREATE DATABASE checkout;
+\c checkout;
+
+CREATE TABLE checkout_sessions (
+    session_id UUID PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    product_ids JSONB NOT NULL,
+    total_amount DECIMAL(12,2) NOT NULL,
+    shipping_address TEXT NOT NULL,
+    payment_method_id VARCHAR(255) NOT NULL,
+    status VARCHAR(32) NOT NULL,
+    error_message TEXT NOT NULL DEFAULT '',
+    order_id VARCHAR(255) NOT NULL DEFAULT '',
+    payment_id VARCHAR(255) NOT NULL DEFAULT '',
+    reservation_id VARCHAR(255) NOT NULL DEFAULT '',
+    steps JSONB NOT NULL DEFAULT '[]', -- Step log, oldest first
+    version INT NOT NULL,
+    lease_owner VARCHAR(255),
+    lease_until TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_checkout_sessions_user_id ON checkout_sessions(user_id);
+
+-- Recovery scans only the sagas still running
+CREATE INDEX idx_checkout_sessions_incomplete ON checkout_sessions(created_at)
+    WHERE status NOT IN ('COMPLETED', 'FAILED');
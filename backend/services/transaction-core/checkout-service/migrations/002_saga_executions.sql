@@ -0,0 +1,22 @@
+-- Saga Executions
+--
+-- One row per run of a pkg/saga workflow, keyed by the checkout session ID.
+-- The cursor says which step runs or is undone next; history holds every
+-- attempt at every step, oldest first.
+
+\c checkout;
+
+CREATE TABLE saga_executions (
+    execution_id VARCHAR(255) PRIMARY KEY,
+    workflow VARCHAR(64) NOT NULL,
+    status VARCHAR(32) NOT NULL,
+    step_cursor INT NOT NULL,
+    failed_step VARCHAR(64) NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    history JSONB NOT NULL DEFAULT '[]',
+    version INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_saga_executions_workflow_status ON saga_executions(workflow, status);
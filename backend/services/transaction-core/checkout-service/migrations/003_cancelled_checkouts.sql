@@ -0,0 +1,11 @@
+-- Cancelled Checkouts
+--
+-- Cancelled checkouts end in their own CANCELLED status, so recovery no
+-- longer needs to scan them.
+
+\c checkout;
+
+DROP INDEX idx_checkout_sessions_incomplete;
+
+CREATE INDEX idx_checkout_sessions_incomplete ON checkout_sessions(created_at)
+    WHERE status NOT IN ('COMPLETED', 'FAILED', 'CANCELLED');
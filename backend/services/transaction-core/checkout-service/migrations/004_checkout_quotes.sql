@@ -0,0 +1,20 @@
+-- Checkout Quotes
+--
+-- An itemized price for a cart, locked until expires_at. A checkout session
+-- claims its quote through used_by and charges exactly its total.
+
+\c checkout;
+
+CREATE TABLE checkout_quotes (
+    quote_id UUID PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    quote JSONB NOT NULL, -- Lines with their discounts and reasons, shipping, tax and credits
+    total DECIMAL(12,2) NOT NULL,
+    used_by VARCHAR(255) NOT NULL DEFAULT '', -- Session that charged the quote
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_checkout_quotes_user_id ON checkout_quotes(user_id);
+
+ALTER TABLE checkout_sessions ADD COLUMN quote_id VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,14 @@
+-- Checkout Items
+--
+-- Inventory holds each product's quantity, not one unit per product.
+-- Sessions started before this migration held one unit of each product.
+
+\c checkout;
+
+ALTER TABLE checkout_sessions ADD COLUMN items JSONB NOT NULL DEFAULT '[]';
+
+UPDATE checkout_sessions
+SET items = (
+    SELECT COALESCE(jsonb_agg(jsonb_build_object('product_id', product_id, 'quantity', 1)), '[]')
+    FROM jsonb_array_elements_text(product_ids) AS product_id
+);
@@ -0,0 +1,22 @@
+-- Checkout Tenders
+--
+-- A checkout can be paid by several tenders: wallet balance, coins and a
+-- card. Each is held in turn and all are captured once the order is
+-- confirmed. Existing sessions become a single card tender; a payment
+-- already taken counts as held, so it is released or captured like any
+-- other hold.
+
+\c checkout;
+
+ALTER TABLE checkout_sessions ADD COLUMN tenders JSONB NOT NULL DEFAULT '[]';
+
+UPDATE checkout_sessions
+SET tenders = jsonb_build_array(jsonb_strip_nulls(jsonb_build_object(
+    'type', 'CARD',
+    'amount', total_amount,
+    'payment_method_id', payment_method_id,
+    'status', CASE WHEN payment_id = '' THEN 'PENDING' ELSE 'HELD' END,
+    'hold_id', NULLIF(payment_id, '')
+)));
+
+ALTER TABLE checkout_sessions DROP COLUMN payment_method_id, DROP COLUMN payment_id;
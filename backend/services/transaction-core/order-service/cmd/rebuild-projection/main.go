@@ -0,0 +1,62 @@
+// Command rebuild-projection drops orders_read_model and rebuilds it by
+// replaying every event in the order event store.
+//
+// Stop order-service replicas (or accept a briefly incomplete read model)
+// while it runs; events written during the rebuild are projected idempotently
+// either way.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/titan-commerce/backend/order-service/internal/application"
+	"github.com/titan-commerce/backend/order-service/internal/infrastructure/postgres"
+	"github.com/titan-commerce/backend/pkg/config"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	log := logger.New(logger.Config{
+		Level:       cfg.LogLevel,
+		ServiceName: cfg.ServiceName,
+		CellID:      cfg.CellID,
+		Pretty:      true,
+	})
+
+	eventStore, err := postgres.NewEventStoreRepository(cfg.DatabaseURL, log)
+	if err != nil {
+		log.Fatal(err, "Failed to connect to event store")
+	}
+
+	orderRepo, err := postgres.NewOrderReadModelRepository(cfg.DatabaseURL, log)
+	if err != nil {
+		log.Fatal(err, "Failed to connect to read model")
+	}
+
+	projector, err := postgres.NewOrderProjector(cfg.DatabaseURL, log)
+	if err != nil {
+		log.Fatal(err, "Failed to connect to read model")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	orderService := application.NewOrderService(orderRepo, eventStore, projector, log)
+
+	log.Info("Rebuilding orders_read_model from the event store")
+	replayed, err := orderService.RebuildProjection(ctx)
+	if err != nil {
+		log.Fatal(err, "Projection rebuild failed")
+	}
+	log.Infof("Projection rebuilt from %d events", replayed)
+}
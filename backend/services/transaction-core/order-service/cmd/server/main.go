@@ -1,16 +1,25 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/titan-commerce/backend/order-service/internal/application"
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/order-service/internal/infrastructure/clients"
 	"github.com/titan-commerce/backend/order-service/internal/infrastructure/postgres"
+	infrastructure "github.com/titan-commerce/backend/order-service/internal/infrastructure/redis"
+	"github.com/titan-commerce/backend/order-service/internal/infrastructure/render"
+	"github.com/titan-commerce/backend/order-service/internal/infrastructure/taxrules"
 	handler "github.com/titan-commerce/backend/order-service/internal/interfaces/grpc"
 	"github.com/titan-commerce/backend/pkg/config"
+	"github.com/titan-commerce/backend/pkg/discovery"
 	"github.com/titan-commerce/backend/pkg/logger"
 	grpcLib "google.golang.org/grpc"
 )
@@ -38,14 +47,178 @@ func main() {
 	if err != nil {
 		log.Fatal(err, "Failed to connect to event store")
 	}
+	if every := os.Getenv("ORDER_SNAPSHOT_EVERY"); every != "" {
+		n, err := strconv.Atoi(every)
+		if err != nil {
+			log.Fatal(err, "Invalid ORDER_SNAPSHOT_EVERY")
+		}
+		eventStore.SetSnapshotEvery(n)
+	}
 
 	orderRepo, err := postgres.NewOrderReadModelRepository(cfg.DatabaseURL, log)
 	if err != nil {
 		log.Fatal(err, "Failed to connect to read model")
 	}
 
-	// Initialize application service
-	orderService := application.NewOrderService(orderRepo, eventStore, log)
+	projector, err := postgres.NewOrderProjector(cfg.DatabaseURL, log)
+	if err != nil {
+		log.Fatal(err, "Failed to connect to read model")
+	}
+
+	checkpoints, err := postgres.NewCheckpointRepository(cfg.DatabaseURL, postgres.DefaultLeaseTTL, log)
+	if err != nil {
+		log.Fatal(err, "Failed to connect to checkpoint store")
+	}
+
+	returnRepo, err := postgres.NewReturnRepository(cfg.DatabaseURL, log)
+	if err != nil {
+		log.Fatal(err, "Failed to connect to return store")
+	}
+
+	invoiceRepo, err := postgres.NewInvoiceRepository(cfg.DatabaseURL, log)
+	if err != nil {
+		log.Fatal(err, "Failed to connect to invoice store")
+	}
+
+	deferredRepo, err := postgres.NewDeferredEventRepository(cfg.DatabaseURL, log)
+	if err != nil {
+		log.Fatal(err, "Failed to connect to deferred event store")
+	}
+
+	// Initialize application services
+	orderService := application.NewOrderService(orderRepo, eventStore, projector, log)
+	orderService.SetDeferredEvents(deferredRepo)
+	if path := os.Getenv("TAX_RULES_FILE"); path != "" {
+		taxes, err := taxrules.Load(path)
+		if err != nil {
+			log.Fatal(err, "Invalid TAX_RULES_FILE")
+		}
+		orderService.SetTaxEngine(taxes)
+	}
+
+	invoiceIssuer := os.Getenv("INVOICE_ISSUER_NAME")
+	if invoiceIssuer == "" {
+		invoiceIssuer = "Titan Commerce"
+	}
+	invoiceService := application.NewInvoiceService(invoiceRepo, eventStore, render.NewInvoiceRenderer(invoiceIssuer), log)
+
+	returnsAddress := os.Getenv("RETURNS_ADDRESS")
+	if returnsAddress == "" {
+		returnsAddress = application.DefaultReturnsAddress
+	}
+	refundAddr := os.Getenv("REFUND_SERVICE_ADDR")
+	if refundAddr == "" {
+		refundAddr = "refund-service:9000"
+	}
+	refunds, err := clients.NewRefundClient(refundAddr)
+	if err != nil {
+		log.Fatal(err, "Failed to initialize refund-service client")
+	}
+	defer refunds.Close()
+	orderService.SetPaymentRefunder(refunds)
+	shippingAddr := os.Getenv("SHIPPING_SERVICE_ADDR")
+	if shippingAddr == "" {
+		shippingAddr = "shipping-service:9000"
+	}
+	shipping, err := clients.NewShippingClient(shippingAddr)
+	if err != nil {
+		log.Fatal(err, "Failed to initialize shipping-service client")
+	}
+	defer shipping.Close()
+	inventoryAddr := os.Getenv("INVENTORY_SERVICE_ADDR")
+	if inventoryAddr == "" {
+		inventoryAddr = "inventory-service:9000"
+	}
+	inventory, err := clients.NewInventoryClient(inventoryAddr)
+	if err != nil {
+		log.Fatal(err, "Failed to initialize inventory-service client")
+	}
+	defer inventory.Close()
+	returnService := application.NewReturnService(returnRepo, eventStore, shipping, inventory, refunds, returnsAddress, log)
+	returnService.SetCreditNoteIssuer(invoiceService)
+
+	// Commands project inline; this subscription catches the read model up on
+	// anything an inline projection missed
+	subscriptionCtx, stopSubscriptions := context.WithCancel(context.Background())
+	readModelSubscription := application.NewSubscription(application.SubscriptionConfig{
+		Name:      "orders-read-model",
+		StartFrom: domain.StartFromBeginning,
+	}, eventStore, checkpoints, func(ctx context.Context, event domain.RecordedEvent) error {
+		return projector.Project(ctx, []domain.RecordedEvent{event})
+	}, log)
+	go readModelSubscription.Run(subscriptionCtx)
+
+	// Orders paid before invoicing was deployed are invoiced on demand
+	invoiceSubscription := application.NewSubscription(application.SubscriptionConfig{
+		Name:      "order-invoices",
+		StartFrom: domain.StartFromNow,
+	}, eventStore, checkpoints, invoiceService.HandleEvent, log)
+	go invoiceSubscription.Run(subscriptionCtx)
+
+	// Payment and shipping events the order could not take yet are retried
+	// by every replica; applying one twice is a duplicate
+	go orderService.RunDeferredEvents(subscriptionCtx, application.DefaultDeferredRetryInterval)
+
+	// Completed payments arrive on payment-service's event stream; each is
+	// handled by one replica and redelivered until it is
+	consumerName, _ := os.Hostname()
+	paymentEvents, err := infrastructure.NewRedisPaymentEventConsumer(cfg.RedisAddr, cfg.RedisPassword, consumerName,
+		func(ctx context.Context, event infrastructure.PaymentEvent) error {
+			if event.Type != infrastructure.PaymentEventCompleted {
+				return nil
+			}
+			// A payment the order rejects is refunded with refund-service
+			_, err := orderService.HandlePaymentCompleted(ctx, application.PaymentCompleted{
+				OrderID:   event.OrderID,
+				PaymentID: event.PaymentID,
+				Amount:    event.Amount,
+			})
+			return err
+		}, log)
+	if err != nil {
+		log.Fatal(err, "Failed to connect to payment event stream")
+	}
+	go paymentEvents.Run(subscriptionCtx)
+
+	// Shipments created and delivered arrive on shipping-service's event
+	// stream, handled the same way
+	shipmentEvents, err := infrastructure.NewRedisShipmentEventConsumer(cfg.RedisAddr, cfg.RedisPassword, consumerName,
+		func(ctx context.Context, event infrastructure.ShipmentEvent) error {
+			shipment := application.ShipmentEvent{
+				OrderID:        event.OrderID,
+				SubOrderID:     event.SubOrderID,
+				TrackingNumber: event.TrackingNumber,
+			}
+			var outcome application.EventOutcome
+			var err error
+			switch event.Type {
+			case infrastructure.ShipmentEventCreated:
+				outcome, err = orderService.HandleShipmentCreated(ctx, shipment)
+			case infrastructure.ShipmentEventDelivered:
+				outcome, err = orderService.HandleShipmentDelivered(ctx, shipment)
+			default:
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if outcome == application.EventRejected {
+				log.Warnf("%s of shipment %s rejected by order %s; the order is cancelled", event.Type, event.ShipmentID, event.OrderID)
+			}
+			return nil
+		}, log)
+	if err != nil {
+		log.Fatal(err, "Failed to connect to shipment event stream")
+	}
+	go shipmentEvents.Run(subscriptionCtx)
+
+	// Every replica sweeps; the optimistic lock on each order keeps a
+	// cancellation from being applied twice. Off unless configured.
+	paymentTimeout := durationEnv(log, "ORDER_PAYMENT_TIMEOUT", application.DefaultPaymentTimeout)
+	if paymentTimeout > 0 {
+		sweepInterval := durationEnv(log, "ORDER_PAYMENT_SWEEP_INTERVAL", application.DefaultPaymentSweepInterval)
+		go orderService.RunPaymentTimeouts(subscriptionCtx, paymentTimeout, sweepInterval)
+	}
 
 	// Initialize gRPC server
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
@@ -54,7 +227,7 @@ func main() {
 	}
 
 	grpcServer := grpcLib.NewServer()
-	handler.NewOrderServiceServer(grpcServer, orderService, log)
+	handler.NewOrderServiceServer(grpcServer, orderService, returnService, invoiceService, log)
 
 	// Start server in goroutine
 	go func() {
@@ -64,12 +237,48 @@ func main() {
 		}
 	}()
 
+	// Register with the cell-router so it can route to this replica
+	registryCtx, stopRegistry := context.WithCancel(context.Background())
+	if cfg.RegistryURL != "" {
+		cellID, err := discovery.ParseCellID(cfg.CellID)
+		if err != nil {
+			log.Fatal(err, "Invalid CELL_ID")
+		}
+		hostname, _ := os.Hostname()
+		advertise := cfg.AdvertiseAddr
+		if advertise == "" {
+			advertise = fmt.Sprintf("%s:%d", hostname, cfg.GRPCPort)
+		}
+		registrar := discovery.NewRegistrar(cfg.RegistryURL, discovery.Registration{
+			InstanceID: hostname,
+			CellID:     cellID,
+			Service:    "order-service",
+			Address:    advertise,
+		}, 10*time.Second, log)
+		go registrar.Run(registryCtx)
+	}
+
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
 	log.Info("Shutting down Order Service")
+	stopRegistry()
+	stopSubscriptions()
 	grpcServer.GracefulStop()
 	log.Info("Order Service stopped")
 }
+
+// durationEnv reads a duration such as "30m" from the environment
+func durationEnv(log *logger.Logger, name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Fatal(fmt.Errorf("invalid duration %q", value), "Invalid "+name)
+	}
+	return d
+}
@@ -0,0 +1,64 @@
+// Command snapshot-order snapshots the given orders on demand, for example
+// after a burst of activity or once a new snapshot schema is deployed.
+//
+//	snapshot-order <order-id> [<order-id>...]
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/titan-commerce/backend/order-service/internal/application"
+	"github.com/titan-commerce/backend/order-service/internal/infrastructure/postgres"
+	"github.com/titan-commerce/backend/pkg/config"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println("usage: snapshot-order <order-id> [<order-id>...]")
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	log := logger.New(logger.Config{
+		Level:       cfg.LogLevel,
+		ServiceName: cfg.ServiceName,
+		CellID:      cfg.CellID,
+		Pretty:      true,
+	})
+
+	eventStore, err := postgres.NewEventStoreRepository(cfg.DatabaseURL, log)
+	if err != nil {
+		log.Fatal(err, "Failed to connect to event store")
+	}
+
+	orderRepo, err := postgres.NewOrderReadModelRepository(cfg.DatabaseURL, log)
+	if err != nil {
+		log.Fatal(err, "Failed to connect to read model")
+	}
+
+	projector, err := postgres.NewOrderProjector(cfg.DatabaseURL, log)
+	if err != nil {
+		log.Fatal(err, "Failed to connect to read model")
+	}
+
+	orderService := application.NewOrderService(orderRepo, eventStore, projector, log)
+
+	failed := false
+	for _, orderID := range os.Args[1:] {
+		if err := orderService.SnapshotOrder(context.Background(), orderID); err != nil {
+			log.Errorf(err, "Failed to snapshot order %s", orderID)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
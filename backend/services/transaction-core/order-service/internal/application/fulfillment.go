@@ -0,0 +1,437 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// Defaults for cancelling orders that are never paid. The timeout is off
+// unless configured: an order is only ever paid through PaymentCompleted, so
+// it must not be enabled where payment-service does not report payments.
+const (
+	DefaultPaymentTimeout       time.Duration = 0
+	DefaultPaymentSweepInterval               = time.Minute
+)
+
+// DefaultDeferredRetryInterval is how often deferred events are looked at
+const DefaultDeferredRetryInterval = time.Minute
+
+// Deferred events are retried after deferredBaseDelay, doubling with each
+// attempt up to deferredMaxDelay
+const (
+	deferredBaseDelay = 30 * time.Second
+	deferredMaxDelay  = time.Hour
+	deferredBatchSize = 100
+)
+
+// Kinds of deferred events
+const (
+	kindPaymentCompleted  = "PaymentCompleted"
+	kindShipmentCreated   = "ShipmentCreated"
+	kindShipmentDelivered = "ShipmentDelivered"
+)
+
+// PaymentTimeoutReason is the cancellation reason of orders never paid
+const PaymentTimeoutReason = "payment timeout"
+
+// maxEventAttempts bounds how often an event is re-applied when the order
+// changes underneath it
+const maxEventAttempts = 3
+
+// EventOutcome says what a payment or shipping event did to an order
+type EventOutcome string
+
+const (
+	EventApplied   EventOutcome = "APPLIED"   // The order moved
+	EventDuplicate EventOutcome = "DUPLICATE" // The order had already moved that far
+	EventRejected  EventOutcome = "REJECTED"  // The order can't take it, e.g. it was cancelled; the sender must compensate
+	EventDeferred  EventOutcome = "DEFERRED"  // An earlier event hasn't arrived yet; redeliver later
+)
+
+// PaymentCompleted is payment-service reporting an order paid
+type PaymentCompleted struct {
+	OrderID   string
+	PaymentID string
+	Amount    float64
+}
+
+// PaymentRefunder refunds a payment with refund-service. Refunds are made
+// once per idempotency key, so a retry returns the refund already made.
+type PaymentRefunder interface {
+	RefundPayment(ctx context.Context, idempotencyKey, paymentID, orderID string, amount float64, reason string) (string, error)
+}
+
+// ShipmentEvent is shipping-service reporting a shipment created or
+// delivered. SubOrderID is set when the shipment carries one seller's
+// sub-order rather than the whole order.
+type ShipmentEvent struct {
+	OrderID        string
+	SubOrderID     string
+	TrackingNumber string
+}
+
+// fulfillmentRank orders the statuses an order passes through once paid.
+// Cancelled orders are never ranked.
+var fulfillmentRank = map[domain.OrderStatus]int{
+	domain.OrderStatusPending:    0,
+	domain.OrderStatusConfirmed:  1,
+	domain.OrderStatusProcessing: 2,
+	domain.OrderStatusShipped:    3,
+	domain.OrderStatusDelivered:  4,
+	domain.OrderStatusRefunded:   5,
+}
+
+// HandlePaymentCompleted confirms the paid order (Command). A payment for an
+// order paid or confirmed already is a duplicate; one for a cancelled order,
+// or for an order paid by a different payment, is rejected and the payment
+// refunded. A refund that fails is returned as an error, so the event is
+// redelivered and the refund retried.
+func (s *OrderService) HandlePaymentCompleted(ctx context.Context, event PaymentCompleted) (EventOutcome, error) {
+	outcome, err := s.applyPaymentCompleted(ctx, event)
+	outcome, err = s.deferUnapplied(ctx, kindPaymentCompleted, event.OrderID, event, outcome, err)
+	if err == nil && outcome == EventRejected {
+		if err := s.refundRejected(ctx, event); err != nil {
+			return "", err
+		}
+	}
+	return outcome, err
+}
+
+// HandleShipmentCreated moves the order, or the shipped sub-order, to SHIPPED
+// (Command). Shipments of unpaid orders are deferred until the payment
+// arrives.
+func (s *OrderService) HandleShipmentCreated(ctx context.Context, event ShipmentEvent) (EventOutcome, error) {
+	outcome, err := s.advance(ctx, event, domain.OrderStatusShipped)
+	return s.deferUnapplied(ctx, kindShipmentCreated, event.OrderID, event, outcome, err)
+}
+
+// HandleShipmentDelivered moves the order, or the delivered sub-order, to
+// DELIVERED (Command). A delivery that arrives before its shipment walks the
+// order through SHIPPED first.
+func (s *OrderService) HandleShipmentDelivered(ctx context.Context, event ShipmentEvent) (EventOutcome, error) {
+	outcome, err := s.advance(ctx, event, domain.OrderStatusDelivered)
+	return s.deferUnapplied(ctx, kindShipmentDelivered, event.OrderID, event, outcome, err)
+}
+
+func (s *OrderService) applyPaymentCompleted(ctx context.Context, event PaymentCompleted) (EventOutcome, error) {
+	return s.react(ctx, event.OrderID, func(order *domain.Order) (EventOutcome, error) {
+		switch {
+		case order.Status == domain.OrderStatusCancelled:
+			return EventRejected, nil
+		case order.Status != domain.OrderStatusPending:
+			if order.PaymentID != "" && order.PaymentID != event.PaymentID {
+				return EventRejected, nil
+			}
+			return EventDuplicate, nil
+		}
+		if err := order.Pay(event.PaymentID, event.Amount); err != nil {
+			return "", err
+		}
+		return EventApplied, nil
+	})
+}
+
+// advance walks the order or sub-order through every step up to target. Each
+// step goes through the aggregate's own transitions, so skipped steps are
+// recorded as if their events had arrived in order.
+func (s *OrderService) advance(ctx context.Context, event ShipmentEvent, target domain.OrderStatus) (EventOutcome, error) {
+	return s.react(ctx, event.OrderID, func(order *domain.Order) (EventOutcome, error) {
+		current := order.Status
+		if event.SubOrderID != "" {
+			sub, ok := order.FindSubOrder(event.SubOrderID)
+			if !ok {
+				return "", errors.New(errors.ErrNotFound, "sub-order not found")
+			}
+			current = sub.Status
+		}
+
+		switch {
+		case current == domain.OrderStatusCancelled:
+			return EventRejected, nil
+		case current == domain.OrderStatusPending:
+			return EventDeferred, nil
+		case fulfillmentRank[current] >= fulfillmentRank[target]:
+			return EventDuplicate, nil
+		}
+
+		for _, step := range []domain.OrderStatus{domain.OrderStatusProcessing, domain.OrderStatusShipped, domain.OrderStatusDelivered} {
+			if fulfillmentRank[step] <= fulfillmentRank[current] || fulfillmentRank[step] > fulfillmentRank[target] {
+				continue
+			}
+			var err error
+			switch {
+			case event.SubOrderID != "":
+				err = order.UpdateSubOrderStatus(event.SubOrderID, step)
+			case step == domain.OrderStatusShipped:
+				err = order.Ship(event.TrackingNumber)
+			default:
+				err = order.UpdateStatus(step)
+			}
+			if err != nil {
+				return "", err
+			}
+		}
+		return EventApplied, nil
+	})
+}
+
+// CancelUnpaidOrders cancels orders still unpaid timeout after they were
+// placed (Command). It returns how many were cancelled. A payment racing the
+// cancellation wins or loses on the order's version; if it loses, the
+// payment is rejected and refunded.
+func (s *OrderService) CancelUnpaidOrders(ctx context.Context, timeout time.Duration) (int, error) {
+	cutoff := time.Now().Add(-timeout)
+	q := domain.OrderSearch{
+		Statuses:  []domain.OrderStatus{domain.OrderStatusPending},
+		CreatedTo: cutoff,
+		SortBy:    domain.SortByCreatedAt,
+		Limit:     domain.MaxSearchLimit,
+	}
+	if err := q.Validate(); err != nil {
+		return 0, err
+	}
+
+	// The read model may lag; each order is checked again on its stream
+	found, err := s.repo.Search(ctx, q)
+	if err != nil {
+		s.logger.Error(err, "failed to find unpaid orders")
+		return 0, err
+	}
+
+	cancelled := 0
+	for _, candidate := range found {
+		outcome, err := s.react(ctx, candidate.ID, func(order *domain.Order) (EventOutcome, error) {
+			if order.Status != domain.OrderStatusPending || !order.CreatedAt.Before(cutoff) {
+				return EventDuplicate, nil
+			}
+			if err := order.Cancel(PaymentTimeoutReason); err != nil {
+				return "", err
+			}
+			return EventApplied, nil
+		})
+		if err != nil {
+			s.logger.Errorf(err, "failed to cancel unpaid order %s", candidate.ID)
+			continue
+		}
+		if outcome == EventApplied {
+			cancelled++
+		}
+	}
+
+	if cancelled > 0 {
+		s.logger.Infof("Cancelled %d orders unpaid after %s", cancelled, timeout)
+	}
+	return cancelled, nil
+}
+
+// RunPaymentTimeouts cancels unpaid orders every interval until ctx is
+// cancelled
+func (s *OrderService) RunPaymentTimeouts(ctx context.Context, timeout, interval time.Duration) {
+	s.logger.Infof("Cancelling orders unpaid after %s, checking every %s", timeout, interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Failures are logged and retried on the next tick
+			_, _ = s.CancelUnpaidOrders(ctx, timeout)
+		}
+	}
+}
+
+// deferUnapplied keeps an event the order could not take yet, because it
+// came too early or kept conflicting with other changes, for
+// RetryDeferredEvents to apply later. The sender is told DEFERRED and need
+// not redeliver. Without a deferred event store the outcome is returned as is.
+func (s *OrderService) deferUnapplied(ctx context.Context, kind, orderID string, event interface{}, outcome EventOutcome, err error) (EventOutcome, error) {
+	if s.deferred == nil || (outcome != EventDeferred && !hasCode(err, errors.ErrConflict)) {
+		return outcome, err
+	}
+
+	payload, merr := json.Marshal(event)
+	if merr != nil {
+		return "", errors.Wrap(errors.ErrInternal, "failed to marshal deferred event", merr)
+	}
+	now := time.Now()
+	deferred := &domain.DeferredEvent{
+		ID:            uuid.New().String(),
+		Kind:          kind,
+		OrderID:       orderID,
+		Payload:       payload,
+		CreatedAt:     now,
+		NextAttemptAt: now.Add(deferredBaseDelay),
+	}
+	if err != nil {
+		deferred.LastError = err.Error()
+	}
+	if err := s.deferred.Save(ctx, deferred); err != nil {
+		s.logger.Errorf(err, "failed to defer %s for order %s", kind, orderID)
+		return "", err
+	}
+
+	s.logger.Infof("Order %s: %s deferred for retry", orderID, kind)
+	return EventDeferred, nil
+}
+
+// RetryDeferredEvents applies the deferred events that are due (Command). It
+// returns how many were settled. Events the order still cannot take are
+// tried again later with a growing delay; the rest are dropped whatever
+// their outcome, which is logged.
+func (s *OrderService) RetryDeferredEvents(ctx context.Context) (int, error) {
+	if s.deferred == nil {
+		return 0, nil
+	}
+
+	due, err := s.deferred.FindDue(ctx, time.Now(), deferredBatchSize)
+	if err != nil {
+		s.logger.Error(err, "failed to find deferred events")
+		return 0, err
+	}
+
+	settled := 0
+	for _, deferred := range due {
+		outcome, err := s.applyDeferred(ctx, deferred)
+		if outcome == EventDeferred || hasCode(err, errors.ErrConflict) || hasCode(err, errors.ErrInternal) {
+			deferred.Attempts++
+			deferred.NextAttemptAt = time.Now().Add(deferredDelay(deferred.Attempts))
+			deferred.LastError = ""
+			if err != nil {
+				deferred.LastError = err.Error()
+			}
+			if err := s.deferred.Update(ctx, deferred); err != nil {
+				s.logger.Errorf(err, "failed to reschedule deferred event %s", deferred.ID)
+			}
+			continue
+		}
+
+		switch {
+		case err != nil:
+			s.logger.Errorf(err, "Dropping deferred %s for order %s", deferred.Kind, deferred.OrderID)
+		case outcome == EventRejected && deferred.Kind != kindPaymentCompleted:
+			s.logger.Warnf("Deferred %s for order %s rejected; it needs compensating", deferred.Kind, deferred.OrderID)
+		}
+		if err := s.deferred.Delete(ctx, deferred.ID); err != nil {
+			s.logger.Errorf(err, "failed to delete deferred event %s", deferred.ID)
+			continue
+		}
+		settled++
+	}
+	return settled, nil
+}
+
+// RunDeferredEvents retries deferred events every interval until ctx is
+// cancelled
+func (s *OrderService) RunDeferredEvents(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Failures are logged and retried on the next tick
+			_, _ = s.RetryDeferredEvents(ctx)
+		}
+	}
+}
+
+func (s *OrderService) applyDeferred(ctx context.Context, deferred *domain.DeferredEvent) (EventOutcome, error) {
+	switch deferred.Kind {
+	case kindPaymentCompleted:
+		var event PaymentCompleted
+		if err := json.Unmarshal(deferred.Payload, &event); err != nil {
+			return "", errors.Wrap(errors.ErrInvalidInput, "malformed deferred event", err)
+		}
+		outcome, err := s.applyPaymentCompleted(ctx, event)
+		if err == nil && outcome == EventRejected {
+			err = s.refundRejected(ctx, event)
+		}
+		return outcome, err
+	case kindShipmentCreated, kindShipmentDelivered:
+		var event ShipmentEvent
+		if err := json.Unmarshal(deferred.Payload, &event); err != nil {
+			return "", errors.Wrap(errors.ErrInvalidInput, "malformed deferred event", err)
+		}
+		target := domain.OrderStatusShipped
+		if deferred.Kind == kindShipmentDelivered {
+			target = domain.OrderStatusDelivered
+		}
+		return s.advance(ctx, event, target)
+	default:
+		return "", errors.New(errors.ErrInvalidInput, "unknown deferred event kind "+deferred.Kind)
+	}
+}
+
+// refundRejected refunds a payment the order rejected. The key is the
+// payment's, so redelivering the event refunds it only once. Failures are
+// internal errors, which keep a deferred event to retry.
+func (s *OrderService) refundRejected(ctx context.Context, event PaymentCompleted) error {
+	if s.refunds == nil {
+		s.logger.Warnf("Payment %s rejected by order %s; it must be refunded", event.PaymentID, event.OrderID)
+		return nil
+	}
+
+	refundID, err := s.refunds.RefundPayment(ctx, "rejected-payment:"+event.PaymentID, event.PaymentID, event.OrderID, event.Amount, "payment rejected by order")
+	if err != nil {
+		s.logger.Errorf(err, "failed to refund payment %s rejected by order %s", event.PaymentID, event.OrderID)
+		return errors.Wrap(errors.ErrInternal, "failed to refund rejected payment", err)
+	}
+
+	s.logger.Infof("Payment %s rejected by order %s refunded: %s", event.PaymentID, event.OrderID, refundID)
+	return nil
+}
+
+// deferredDelay is how long to wait before an event's next attempt
+func deferredDelay(attempts int) time.Duration {
+	delay := deferredBaseDelay
+	for i := 1; i < attempts && delay < deferredMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > deferredMaxDelay {
+		delay = deferredMaxDelay
+	}
+	return delay
+}
+
+// react applies an event to an order and saves whatever it changed. If the
+// order moved on between load and save, the event is applied again to the
+// new state, which may now make it a duplicate or a rejection.
+func (s *OrderService) react(ctx context.Context, orderID string, apply func(*domain.Order) (EventOutcome, error)) (EventOutcome, error) {
+	for attempt := 1; ; attempt++ {
+		order, err := s.load(ctx, orderID)
+		if err != nil {
+			return "", err
+		}
+
+		outcome, err := apply(order)
+		if err != nil || outcome != EventApplied {
+			if err == nil {
+				s.logger.Infof("Order %s: event %s (status %s)", orderID, outcome, order.Status)
+			}
+			return outcome, err
+		}
+
+		err = s.save(ctx, order)
+		if err == nil {
+			s.logger.Infof("Order %s: event applied, status now %s", orderID, order.Status)
+			return outcome, nil
+		}
+		if !hasCode(err, errors.ErrConflict) || attempt == maxEventAttempts {
+			return "", err
+		}
+	}
+}
+
+// hasCode reports whether err is an application error with the given code
+func hasCode(err error, code errors.ErrorCode) bool {
+	appErr, ok := err.(*errors.AppError)
+	return ok && appErr.Code == code
+}
@@ -0,0 +1,273 @@
+package application_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/titan-commerce/backend/order-service/internal/application"
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+func TestOrderService_PaymentAndShippingEvents(t *testing.T) {
+	service, _, mockEvents, mockProjector := newTestService()
+	ctx := context.Background()
+	order := existingOrder(t, "order-123")
+
+	mockEvents.On("LoadOrder", ctx, "order-123").Return(order, nil)
+	mockEvents.On("SaveOrder", ctx, order).Return(nil)
+	mockProjector.On("Project", ctx, mock.Anything).Return(nil)
+
+	outcome, err := service.HandlePaymentCompleted(ctx, application.PaymentCompleted{OrderID: "order-123", PaymentID: "pay-1", Amount: 10})
+	require.NoError(t, err)
+	assert.Equal(t, application.EventApplied, outcome)
+	assert.Equal(t, domain.OrderStatusConfirmed, order.Status)
+	assert.Equal(t, "pay-1", order.PaymentID)
+
+	// Delivered overtakes the shipment; the order is walked through it
+	outcome, err = service.HandleShipmentDelivered(ctx, application.ShipmentEvent{OrderID: "order-123", TrackingNumber: "TRK-1"})
+	require.NoError(t, err)
+	assert.Equal(t, application.EventApplied, outcome)
+	assert.Equal(t, domain.OrderStatusDelivered, order.Status)
+	assert.Equal(t, 5, order.Version)
+	assert.False(t, order.DeliveredAt.IsZero())
+
+	// Late and repeated events change nothing
+	outcome, err = service.HandleShipmentCreated(ctx, application.ShipmentEvent{OrderID: "order-123", TrackingNumber: "TRK-1"})
+	require.NoError(t, err)
+	assert.Equal(t, application.EventDuplicate, outcome)
+
+	outcome, err = service.HandlePaymentCompleted(ctx, application.PaymentCompleted{OrderID: "order-123", PaymentID: "pay-1", Amount: 10})
+	require.NoError(t, err)
+	assert.Equal(t, application.EventDuplicate, outcome)
+
+	// A second, different payment must be refunded
+	outcome, err = service.HandlePaymentCompleted(ctx, application.PaymentCompleted{OrderID: "order-123", PaymentID: "pay-2", Amount: 10})
+	require.NoError(t, err)
+	assert.Equal(t, application.EventRejected, outcome)
+
+	assert.Equal(t, 5, order.Version)
+	mockEvents.AssertNumberOfCalls(t, "SaveOrder", 2)
+}
+
+func TestOrderService_ShipmentBeforePayment(t *testing.T) {
+	service, _, mockEvents, _ := newTestService()
+	ctx := context.Background()
+
+	mockEvents.On("LoadOrder", ctx, "order-123").Return(existingOrder(t, "order-123"), nil)
+
+	outcome, err := service.HandleShipmentCreated(ctx, application.ShipmentEvent{OrderID: "order-123", TrackingNumber: "TRK-1"})
+	require.NoError(t, err)
+	assert.Equal(t, application.EventDeferred, outcome)
+	mockEvents.AssertNotCalled(t, "SaveOrder", mock.Anything, mock.Anything)
+
+	// A payment for the wrong amount is an error, not a state change
+	_, err = service.HandlePaymentCompleted(ctx, application.PaymentCompleted{OrderID: "order-123", PaymentID: "pay-1", Amount: 9.99})
+	assert.Error(t, err)
+}
+
+func TestOrderService_PaymentRacesTimeout(t *testing.T) {
+	service, _, mockEvents, _ := newTestService()
+	ctx := context.Background()
+
+	// The first save loses to the timeout sweep; on reload the order is
+	// cancelled and the payment is rejected
+	cancelled := existingOrder(t, "order-123")
+	require.NoError(t, cancelled.Cancel(application.PaymentTimeoutReason))
+	cancelled.MarkCommitted()
+
+	mockEvents.On("LoadOrder", ctx, "order-123").Return(existingOrder(t, "order-123"), nil).Once()
+	mockEvents.On("LoadOrder", ctx, "order-123").Return(cancelled, nil).Once()
+	mockEvents.On("SaveOrder", ctx, mock.Anything).Return(errors.New(errors.ErrConflict, "concurrent modification detected")).Once()
+
+	outcome, err := service.HandlePaymentCompleted(ctx, application.PaymentCompleted{OrderID: "order-123", PaymentID: "pay-1", Amount: 10})
+	require.NoError(t, err)
+	assert.Equal(t, application.EventRejected, outcome)
+	mockEvents.AssertExpectations(t)
+}
+
+// fakeRefunder is refund-service, refunding once per idempotency key
+type fakeRefunder struct {
+	byKey    map[string]string
+	refunded []float64
+	err      error
+}
+
+func (f *fakeRefunder) RefundPayment(ctx context.Context, idempotencyKey, paymentID, orderID string, amount float64, reason string) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	refundID, ok := f.byKey[idempotencyKey]
+	if !ok {
+		refundID = "refund-" + paymentID
+		f.byKey[idempotencyKey] = refundID
+		f.refunded = append(f.refunded, amount)
+	}
+	return refundID, nil
+}
+
+func TestOrderService_RejectedPaymentIsRefunded(t *testing.T) {
+	service, _, mockEvents, _ := newTestService()
+	refunds := &fakeRefunder{byKey: map[string]string{}}
+	service.SetPaymentRefunder(refunds)
+	ctx := context.Background()
+
+	cancelled := existingOrder(t, "order-123")
+	require.NoError(t, cancelled.Cancel(application.PaymentTimeoutReason))
+	cancelled.MarkCommitted()
+	mockEvents.On("LoadOrder", ctx, "order-123").Return(cancelled, nil)
+	event := application.PaymentCompleted{OrderID: "order-123", PaymentID: "pay-1", Amount: 10}
+
+	// A refund that fails fails the event, so it is redelivered
+	refunds.err = errors.New(errors.ErrPaymentFailed, "refund-service unavailable")
+	_, err := service.HandlePaymentCompleted(ctx, event)
+	require.Error(t, err)
+	assert.Empty(t, refunds.refunded)
+
+	refunds.err = nil
+	for i := 0; i < 2; i++ {
+		outcome, err := service.HandlePaymentCompleted(ctx, event)
+		require.NoError(t, err)
+		assert.Equal(t, application.EventRejected, outcome)
+	}
+
+	assert.Equal(t, map[string]string{"rejected-payment:pay-1": "refund-pay-1"}, refunds.byKey)
+	assert.Equal(t, []float64{10}, refunds.refunded)
+	mockEvents.AssertNotCalled(t, "SaveOrder", mock.Anything, mock.Anything)
+}
+
+func TestOrderService_CancelUnpaidOrders(t *testing.T) {
+	service, mockRepo, mockEvents, mockProjector := newTestService()
+	ctx := context.Background()
+
+	placed := func(orderID string) *domain.Order {
+		event := createdEvent(orderID)
+		event.CreatedAt = time.Now().Add(-time.Hour)
+		order, err := domain.RehydrateOrder([]domain.DomainEvent{event})
+		require.NoError(t, err)
+		return order
+	}
+	unpaid := placed("order-1")
+	// The read model still shows order-2 pending, but it has been paid since
+	paid := placed("order-2")
+	require.NoError(t, paid.Pay("pay-2", 10))
+	paid.MarkCommitted()
+
+	mockRepo.On("Search", ctx, mock.MatchedBy(func(q domain.OrderSearch) bool {
+		return len(q.Statuses) == 1 && q.Statuses[0] == domain.OrderStatusPending && !q.CreatedTo.IsZero()
+	})).Return([]*domain.Order{{ID: "order-1"}, {ID: "order-2"}}, nil)
+	mockEvents.On("LoadOrder", ctx, "order-1").Return(unpaid, nil)
+	mockEvents.On("LoadOrder", ctx, "order-2").Return(paid, nil)
+	mockEvents.On("SaveOrder", ctx, unpaid).Return(nil)
+	mockProjector.On("Project", ctx, mock.Anything).Return(nil)
+
+	cancelled, err := service.CancelUnpaidOrders(ctx, 30*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, cancelled)
+	assert.Equal(t, domain.OrderStatusCancelled, unpaid.Status)
+	assert.Equal(t, domain.OrderStatusConfirmed, paid.Status)
+	mockEvents.AssertExpectations(t)
+}
+
+// memoryDeferred is an in-memory DeferredEventRepository
+type memoryDeferred struct {
+	events map[string]*domain.DeferredEvent
+}
+
+func (m *memoryDeferred) Save(ctx context.Context, event *domain.DeferredEvent) error {
+	m.events[event.ID] = event
+	return nil
+}
+
+func (m *memoryDeferred) FindDue(ctx context.Context, now time.Time, limit int) ([]*domain.DeferredEvent, error) {
+	var due []*domain.DeferredEvent
+	for _, event := range m.events {
+		if !event.NextAttemptAt.After(now) {
+			due = append(due, event)
+		}
+	}
+	return due, nil
+}
+
+func (m *memoryDeferred) Update(ctx context.Context, event *domain.DeferredEvent) error {
+	m.events[event.ID] = event
+	return nil
+}
+
+func (m *memoryDeferred) Delete(ctx context.Context, eventID string) error {
+	delete(m.events, eventID)
+	return nil
+}
+
+// makeDue moves every deferred event's next attempt into the past
+func (m *memoryDeferred) makeDue() {
+	for _, event := range m.events {
+		event.NextAttemptAt = time.Now().Add(-time.Second)
+	}
+}
+
+func TestOrderService_DeferredShipmentIsAppliedOncePaid(t *testing.T) {
+	service, _, mockEvents, mockProjector := newTestService()
+	deferred := &memoryDeferred{events: map[string]*domain.DeferredEvent{}}
+	service.SetDeferredEvents(deferred)
+	ctx := context.Background()
+	order := existingOrder(t, "order-123")
+
+	mockEvents.On("LoadOrder", ctx, "order-123").Return(order, nil)
+	mockEvents.On("SaveOrder", ctx, order).Return(nil)
+	mockProjector.On("Project", ctx, mock.Anything).Return(nil)
+
+	// Shipped before paid: kept instead of handed back to the sender
+	outcome, err := service.HandleShipmentCreated(ctx, application.ShipmentEvent{OrderID: "order-123", TrackingNumber: "TRK-1"})
+	require.NoError(t, err)
+	assert.Equal(t, application.EventDeferred, outcome)
+	require.Len(t, deferred.events, 1)
+
+	// Not due yet, and still unpaid once due: rescheduled
+	settled, err := service.RetryDeferredEvents(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, settled)
+	deferred.makeDue()
+	settled, err = service.RetryDeferredEvents(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, settled)
+	for _, event := range deferred.events {
+		assert.Equal(t, 1, event.Attempts)
+		assert.True(t, event.NextAttemptAt.After(time.Now()))
+	}
+
+	_, err = service.HandlePaymentCompleted(ctx, application.PaymentCompleted{OrderID: "order-123", PaymentID: "pay-1", Amount: 10})
+	require.NoError(t, err)
+
+	deferred.makeDue()
+	settled, err = service.RetryDeferredEvents(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, settled)
+	assert.Empty(t, deferred.events)
+	assert.Equal(t, domain.OrderStatusShipped, order.Status)
+}
+
+func TestOrderService_PaymentLosingEveryRaceIsDeferred(t *testing.T) {
+	service, _, mockEvents, _ := newTestService()
+	deferred := &memoryDeferred{events: map[string]*domain.DeferredEvent{}}
+	service.SetDeferredEvents(deferred)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		mockEvents.On("LoadOrder", ctx, "order-123").Return(existingOrder(t, "order-123"), nil).Once()
+	}
+	mockEvents.On("SaveOrder", ctx, mock.Anything).Return(errors.New(errors.ErrConflict, "concurrent modification detected"))
+
+	outcome, err := service.HandlePaymentCompleted(ctx, application.PaymentCompleted{OrderID: "order-123", PaymentID: "pay-1", Amount: 10})
+	require.NoError(t, err)
+	assert.Equal(t, application.EventDeferred, outcome)
+	require.Len(t, deferred.events, 1)
+	for _, event := range deferred.events {
+		assert.Equal(t, "PaymentCompleted", event.Kind)
+		assert.NotEmpty(t, event.LastError)
+	}
+}
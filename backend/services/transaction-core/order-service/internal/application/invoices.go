@@ -0,0 +1,230 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// Invoice render formats
+const (
+	InvoiceFormatHTML = "html"
+	InvoiceFormatPDF  = "pdf"
+)
+
+// InvoiceRenderer turns invoices and credit notes into documents
+type InvoiceRenderer interface {
+	HTML(inv *domain.Invoice) ([]byte, error)
+	PDF(inv *domain.Invoice) ([]byte, error)
+}
+
+// InvoiceService is the application service for invoices and credit notes
+type InvoiceService struct {
+	invoices domain.InvoiceRepository
+	events   domain.EventStore
+	renderer InvoiceRenderer
+	logger   *logger.Logger
+}
+
+// NewInvoiceService creates a new invoice service
+func NewInvoiceService(invoices domain.InvoiceRepository, events domain.EventStore, renderer InvoiceRenderer, logger *logger.Logger) *InvoiceService {
+	return &InvoiceService{
+		invoices: invoices,
+		events:   events,
+		renderer: renderer,
+		logger:   logger,
+	}
+}
+
+// IssueInvoice invoices a paid order, or returns its invoice if it already
+// has one (Command)
+func (s *InvoiceService) IssueInvoice(ctx context.Context, orderID string) (*domain.Invoice, error) {
+	existing, err := s.invoices.FindByReference(ctx, domain.InvoiceReference(orderID))
+	if err != nil || existing != nil {
+		return existing, err
+	}
+
+	order, err := s.events.LoadOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	inv, err := domain.NewInvoice(order, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return s.save(ctx, inv)
+}
+
+// GetInvoice retrieves an invoice or credit note (Query)
+func (s *InvoiceService) GetInvoice(ctx context.Context, invoiceID string) (*domain.Invoice, error) {
+	return s.invoices.FindByID(ctx, invoiceID)
+}
+
+// ListOrderInvoices lists an order's invoice and credit notes (Query)
+func (s *InvoiceService) ListOrderInvoices(ctx context.Context, orderID string) ([]*domain.Invoice, error) {
+	return s.invoices.FindByOrderID(ctx, orderID)
+}
+
+// RenderInvoice renders an invoice or credit note as HTML or PDF, returning
+// the document and its content type (Query)
+func (s *InvoiceService) RenderInvoice(ctx context.Context, invoiceID, format string) ([]byte, string, error) {
+	inv, err := s.invoices.FindByID(ctx, invoiceID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch format {
+	case InvoiceFormatHTML:
+		doc, err := s.renderer.HTML(inv)
+		return doc, "text/html; charset=utf-8", err
+	case InvoiceFormatPDF:
+		doc, err := s.renderer.PDF(inv)
+		return doc, "application/pdf", err
+	default:
+		return nil, "", errors.New(errors.ErrInvalidInput, "unsupported invoice format")
+	}
+}
+
+// IssueReturnCreditNote credits the units accepted back from a return
+// (Command). It is idempotent per return.
+func (s *InvoiceService) IssueReturnCreditNote(ctx context.Context, ret *domain.ReturnRequest) (*domain.Invoice, error) {
+	var picks []domain.CreditPick
+	for _, line := range ret.Lines {
+		if line.AcceptedQuantity > 0 {
+			picks = append(picks, domain.CreditPick{ProductID: line.ProductID, SellerID: line.SellerID, Quantity: line.AcceptedQuantity})
+		}
+	}
+	if len(picks) == 0 {
+		return nil, nil
+	}
+
+	// Delivered orders are always invoiced, but the subscription may lag
+	invoice, err := s.IssueInvoice(ctx, ret.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	return s.credit(ctx, invoice, picks, "return:"+ret.ID, "Return "+ret.ID)
+}
+
+// HandleEvent issues invoices and credit notes as orders move along. An order
+// is invoiced once it is paid; cancelled sub-orders, cancelled orders and
+// refunded orders are credited. It is safe to deliver an event twice.
+func (s *InvoiceService) HandleEvent(ctx context.Context, event domain.RecordedEvent) error {
+	switch e := event.Event.(type) {
+	case *domain.SubOrderCancelledEvent:
+		return s.creditRemaining(ctx, e.OrderID, e.SellerID, "suborder-cancel:"+e.SubOrderID, e.Reason)
+	case *domain.OrderCancelledEvent:
+		return s.creditRemaining(ctx, e.OrderID, "", "order-cancel:"+e.OrderID, e.Reason)
+	}
+
+	status, ok := domain.StatusAfter(event.Event)
+	if !ok {
+		return nil
+	}
+	switch status {
+	case domain.OrderStatusConfirmed:
+		// The order is invoiced as it is now; sub-orders cancelled since are
+		// left off rather than credited
+		order, err := s.events.LoadOrder(ctx, event.AggregateID)
+		if err != nil {
+			return err
+		}
+		if !order.Invoiceable() {
+			return nil
+		}
+		_, err = s.IssueInvoice(ctx, event.AggregateID)
+		return err
+	case domain.OrderStatusRefunded:
+		return s.creditRemaining(ctx, event.AggregateID, "", "refund:"+event.AggregateID, "Order refunded")
+	}
+	return nil
+}
+
+// creditRemaining credits whatever is left on an order's invoice, limited to
+// one seller's lines if sellerID is set. Orders never invoiced, or with
+// nothing left to credit, are skipped.
+func (s *InvoiceService) creditRemaining(ctx context.Context, orderID, sellerID, reference, reason string) error {
+	invoice, err := s.invoices.FindByReference(ctx, domain.InvoiceReference(orderID))
+	if err != nil || invoice == nil {
+		return err
+	}
+
+	notes, err := s.creditNotes(ctx, invoice)
+	if err != nil {
+		return err
+	}
+	if !invoice.Outstanding(notes, sellerID) {
+		return nil
+	}
+
+	var picks []domain.CreditPick
+	if sellerID != "" {
+		seen := make(map[string]bool)
+		for _, line := range invoice.Lines {
+			if line.SellerID == sellerID && !seen[line.ProductID] {
+				seen[line.ProductID] = true
+				picks = append(picks, domain.CreditPick{ProductID: line.ProductID, SellerID: sellerID})
+			}
+		}
+	}
+
+	_, err = s.credit(ctx, invoice, picks, reference, reason)
+	return err
+}
+
+// credit issues a credit note against an invoice, or returns the one already
+// issued under the reference
+func (s *InvoiceService) credit(ctx context.Context, invoice *domain.Invoice, picks []domain.CreditPick, reference, reason string) (*domain.Invoice, error) {
+	existing, err := s.invoices.FindByReference(ctx, reference)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+
+	notes, err := s.creditNotes(ctx, invoice)
+	if err != nil {
+		return nil, err
+	}
+
+	note, err := domain.NewCreditNote(invoice, notes, picks, reference, reason, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return s.save(ctx, note)
+}
+
+// creditNotes lists the credit notes issued against an invoice
+func (s *InvoiceService) creditNotes(ctx context.Context, invoice *domain.Invoice) ([]*domain.Invoice, error) {
+	documents, err := s.invoices.FindByOrderID(ctx, invoice.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	var notes []*domain.Invoice
+	for _, doc := range documents {
+		if doc.Kind == domain.InvoiceKindCreditNote && doc.InvoiceID == invoice.ID {
+			notes = append(notes, doc)
+		}
+	}
+	return notes, nil
+}
+
+// save stores a new document. Losing a race to issue the same reference
+// returns the winner's document.
+func (s *InvoiceService) save(ctx context.Context, inv *domain.Invoice) (*domain.Invoice, error) {
+	if err := s.invoices.Save(ctx, inv); err != nil {
+		if hasCode(err, errors.ErrConflict) {
+			if existing, findErr := s.invoices.FindByReference(ctx, inv.Reference); findErr == nil && existing != nil {
+				return existing, nil
+			}
+		}
+		s.logger.Error(err, "failed to save invoice")
+		return nil, err
+	}
+
+	s.logger.Infof("Issued %s %s for order %s: %.2f", inv.Kind, inv.Number, inv.OrderID, inv.Gross)
+	return inv, nil
+}
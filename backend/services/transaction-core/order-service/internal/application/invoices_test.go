@@ -0,0 +1,279 @@
+package application_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/titan-commerce/backend/order-service/internal/application"
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// fakeInvoiceRepository keeps invoices in memory and numbers them per series
+// like the postgres repository
+type fakeInvoiceRepository struct {
+	invoices []*domain.Invoice
+	series   map[string]int64
+}
+
+func (f *fakeInvoiceRepository) Save(ctx context.Context, inv *domain.Invoice) error {
+	if existing, _ := f.FindByReference(ctx, inv.Reference); existing != nil {
+		return errors.New(errors.ErrConflict, "a document with this reference was already issued")
+	}
+	f.series[inv.Series()]++
+	inv.AssignNumber(f.series[inv.Series()])
+	f.invoices = append(f.invoices, inv)
+	return nil
+}
+
+func (f *fakeInvoiceRepository) FindByID(ctx context.Context, invoiceID string) (*domain.Invoice, error) {
+	for _, inv := range f.invoices {
+		if inv.ID == invoiceID {
+			return inv, nil
+		}
+	}
+	return nil, errors.New(errors.ErrNotFound, "invoice not found")
+}
+
+func (f *fakeInvoiceRepository) FindByOrderID(ctx context.Context, orderID string) ([]*domain.Invoice, error) {
+	var invoices []*domain.Invoice
+	for _, inv := range f.invoices {
+		if inv.OrderID == orderID {
+			invoices = append(invoices, inv)
+		}
+	}
+	return invoices, nil
+}
+
+func (f *fakeInvoiceRepository) FindByReference(ctx context.Context, reference string) (*domain.Invoice, error) {
+	for _, inv := range f.invoices {
+		if inv.Reference == reference {
+			return inv, nil
+		}
+	}
+	return nil, nil
+}
+
+type stubRenderer struct{}
+
+func (stubRenderer) HTML(inv *domain.Invoice) ([]byte, error) { return []byte(inv.Number), nil }
+func (stubRenderer) PDF(inv *domain.Invoice) ([]byte, error)  { return []byte(inv.Number), nil }
+
+// testTaxEngine taxes everything at 12.5%, a rate exact in binary, so rounding
+// differences come from the regime alone. AA rounds per line, BB per invoice
+// and CC prices tax in.
+func testTaxEngine(t *testing.T) *domain.TaxEngine {
+	engine, err := domain.NewTaxEngine([]domain.TaxRule{
+		{Country: "AA", Rate: 0.125, Name: "AA standard"},
+		{Country: "BB", Rate: 0.125, Name: "BB standard"},
+		{Country: "CC", Rate: 0.25, Name: "CC standard"},
+		{Country: "CC", Category: "food", Rate: 0, Name: "CC food"},
+		{Country: "CC", Region: "NORTH", Rate: 0.1, Name: "CC north"},
+	}, []domain.TaxRegime{
+		{Country: "AA", Pricing: domain.PricingTaxExclusive, Rounding: domain.RoundPerLine},
+		{Country: "BB", Pricing: domain.PricingTaxExclusive, Rounding: domain.RoundPerInvoice},
+		{Country: "cc", Pricing: domain.PricingTaxInclusive, Rounding: domain.RoundPerLine},
+	})
+	assert.NoError(t, err)
+	return engine
+}
+
+func newTestInvoiceService() (*application.InvoiceService, *fakeInvoiceRepository, *MockEventStore) {
+	repo := &fakeInvoiceRepository{series: make(map[string]int64)}
+	mockEvents := new(MockEventStore)
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+
+	return application.NewInvoiceService(repo, mockEvents, stubRenderer{}, log), repo, mockEvents
+}
+
+// deliverEvents commits the order's pending events and hands them to the
+// invoice subscription handler
+func deliverEvents(t *testing.T, ctx context.Context, service *application.InvoiceService, order *domain.Order) {
+	records := domain.NewRecordedEvents(order.ID, order.UncommittedEvents(), order.ExpectedVersion())
+	order.MarkCommitted()
+	for _, record := range records {
+		assert.NoError(t, service.HandleEvent(ctx, record))
+	}
+}
+
+func TestOrderService_CreateOrder_Tax(t *testing.T) {
+	service, _, mockEvents, mockProjector := newTestService()
+	service.SetTaxEngine(testTaxEngine(t))
+	ctx := context.Background()
+
+	mockEvents.On("SaveOrder", ctx, mock.AnythingOfType("*domain.Order")).Return(nil)
+	mockProjector.On("Project", ctx, mock.Anything).Return(nil)
+
+	items := func() []domain.OrderItem {
+		return []domain.OrderItem{
+			{ProductID: "prod-1", SellerID: "shop-a", Quantity: 1, UnitPrice: 1},
+			{ProductID: "prod-2", SellerID: "shop-a", Quantity: 1, UnitPrice: 1},
+			{ProductID: "prod-3", SellerID: "shop-b", Quantity: 1, UnitPrice: 1},
+		}
+	}
+
+	// Rounding each line's 0.125 up gives 0.39 of tax
+	perLine, err := service.CreateOrder(ctx, "user-123", items(), "1 Main St, Springfield, AA", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.39, perLine.Tax.Tax)
+	assert.Equal(t, 3.39, perLine.TotalAmount)
+	assert.Equal(t, 0.26, perLine.SubOrders[0].TaxAmount)
+	assert.Equal(t, 2.26, perLine.SubOrders[0].Total)
+	assert.Equal(t, 0.13, perLine.SubOrders[1].TaxAmount)
+
+	// Rounding the 0.375 total once gives 0.38, split without losing a cent
+	perInvoice, err := service.CreateOrder(ctx, "user-123", items(), "1 Main St, Springfield, BB", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.38, perInvoice.Tax.Tax)
+	assert.Equal(t, 3.38, perInvoice.TotalAmount)
+	assert.Equal(t, 0.25, perInvoice.SubOrders[0].TaxAmount)
+	assert.Equal(t, 0.13, perInvoice.SubOrders[1].TaxAmount)
+
+	// Inclusive prices already contain the tax, and food is zero rated
+	inclusive, err := service.CreateOrder(ctx, "user-123", []domain.OrderItem{
+		{ProductID: "prod-1", SellerID: "shop-a", Quantity: 2, UnitPrice: 12.5},
+		{ProductID: "prod-2", SellerID: "shop-a", TaxCategory: "food", Quantity: 1, UnitPrice: 10},
+	}, "1 Main St, Southtown, CC", map[string]float64{"shop-a": 5})
+	assert.NoError(t, err)
+	assert.Equal(t, 5.0, inclusive.Tax.Tax)
+	assert.Equal(t, 30.0, inclusive.Tax.Net)
+	assert.Equal(t, 40.0, inclusive.TotalAmount)
+	assert.Equal(t, 5.0, inclusive.SubOrders[0].TaxAmount)
+
+	// A region rule outranks a category rule
+	rule, ok := testTaxEngine(t).Rule("cc", "north", "food")
+	assert.True(t, ok)
+	assert.Equal(t, "CC north", rule.Name)
+
+	// Without a tax engine orders stay untaxed
+	untaxed, err := domain.NewOrder("user-123", items(), "1 Main St, Springfield, AA", nil, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, untaxed.Tax)
+	assert.Equal(t, 3.0, untaxed.TotalAmount)
+}
+
+func TestInvoiceService_IssueInvoice_Numbering(t *testing.T) {
+	service, _, mockEvents := newTestInvoiceService()
+	ctx := context.Background()
+	engine := testTaxEngine(t)
+
+	var orders []*domain.Order
+	for i := 0; i < 2; i++ {
+		order, err := domain.NewOrder("user-123", []domain.OrderItem{
+			{ProductID: "prod-1", ProductName: "Mug", SellerID: "shop-a", Quantity: 3, UnitPrice: 1},
+		}, "1 Main St, Springfield, BB", map[string]float64{"shop-a": 2}, engine)
+		assert.NoError(t, err)
+		assert.NoError(t, order.Confirm())
+		order.MarkCommitted()
+		mockEvents.On("LoadOrder", ctx, order.ID).Return(order, nil)
+		orders = append(orders, order)
+	}
+
+	// Execute: the first order is invoiced twice
+	first, err := service.IssueInvoice(ctx, orders[0].ID)
+	assert.NoError(t, err)
+	again, err := service.IssueInvoice(ctx, orders[0].ID)
+	assert.NoError(t, err)
+	second, err := service.IssueInvoice(ctx, orders[1].ID)
+	assert.NoError(t, err)
+
+	// Assert: one invoice per order, numbered without gaps
+	year := time.Now().UTC().Year()
+	assert.Equal(t, fmt.Sprintf("INV-%d-000001", year), first.Number)
+	assert.Equal(t, first.ID, again.ID)
+	assert.Equal(t, fmt.Sprintf("INV-%d-000002", year), second.Number)
+
+	// Lines add up to what was charged, shipping included
+	assert.Len(t, first.Lines, 2)
+	assert.Equal(t, 0.38, first.Lines[0].Tax)
+	assert.Equal(t, 3.38, first.Lines[0].Gross)
+	assert.Equal(t, domain.ShippingLineID, first.Lines[1].ProductID)
+	assert.Equal(t, orders[0].TotalAmount, first.Gross)
+
+	doc, contentType, err := service.RenderInvoice(ctx, first.ID, application.InvoiceFormatPDF)
+	assert.NoError(t, err)
+	assert.Equal(t, "application/pdf", contentType)
+	assert.Equal(t, first.Number, string(doc))
+
+	// Unpaid orders can't be invoiced
+	pending := existingOrder(t, "order-pending")
+	mockEvents.On("LoadOrder", ctx, "order-pending").Return(pending, nil)
+	_, err = service.IssueInvoice(ctx, "order-pending")
+	assert.Error(t, err)
+}
+
+func TestInvoiceService_CreditNotes(t *testing.T) {
+	service, repo, mockEvents := newTestInvoiceService()
+	ctx := context.Background()
+
+	order, err := domain.NewOrder("user-123", []domain.OrderItem{
+		{ProductID: "prod-1", ProductName: "Mug", SellerID: "shop-a", Quantity: 3, UnitPrice: 1},
+		{ProductID: "prod-2", ProductName: "Lamp", SellerID: "shop-b", Quantity: 1, UnitPrice: 8},
+	}, "1 Main St, Springfield, AA", map[string]float64{"shop-a": 2, "shop-b": 3}, testTaxEngine(t))
+	assert.NoError(t, err)
+	order.MarkCommitted()
+	mockEvents.On("LoadOrder", ctx, order.ID).Return(order, nil)
+
+	// Paying the order invoices it
+	assert.NoError(t, order.Confirm())
+	deliverEvents(t, ctx, service, order)
+	invoices, _ := repo.FindByOrderID(ctx, order.ID)
+	assert.Len(t, invoices, 1)
+	invoice := invoices[0]
+	assert.Equal(t, 17.38, invoice.Gross)
+
+	// Shop B's cancelled sub-order is credited in full, once
+	assert.NoError(t, order.CancelSubOrder(order.SubOrders[1].ID, "out of stock"))
+	cancelled := domain.NewRecordedEvents(order.ID, order.UncommittedEvents(), order.ExpectedVersion())
+	deliverEvents(t, ctx, service, order)
+	assert.NoError(t, service.HandleEvent(ctx, cancelled[0]))
+
+	invoices, _ = repo.FindByOrderID(ctx, order.ID)
+	assert.Len(t, invoices, 2)
+	assert.Equal(t, domain.InvoiceKindCreditNote, invoices[1].Kind)
+	assert.Equal(t, invoice.ID, invoices[1].InvoiceID)
+	assert.Equal(t, 12.0, invoices[1].Gross)
+	assert.Equal(t, 1.0, invoices[1].Tax)
+
+	// One mug comes back; the credit matches the refund for it
+	for _, status := range []domain.OrderStatus{domain.OrderStatusProcessing, domain.OrderStatusShipped, domain.OrderStatusDelivered} {
+		assert.NoError(t, order.UpdateStatus(status))
+	}
+	deliverEvents(t, ctx, service, order)
+
+	ret := &domain.ReturnRequest{ID: "ret-1", OrderID: order.ID, Lines: []domain.ReturnLine{
+		{ProductID: "prod-1", SellerID: "shop-a", Quantity: 1, AcceptedQuantity: 1, UnitPrice: order.PaidUnitPrice("prod-1")},
+	}}
+	note, err := service.IssueReturnCreditNote(ctx, ret)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.13, note.Gross)
+	assert.Equal(t, domain.RoundCents(ret.Lines[0].UnitPrice), note.Gross)
+	again, err := service.IssueReturnCreditNote(ctx, ret)
+	assert.NoError(t, err)
+	assert.Equal(t, note.ID, again.ID)
+
+	// Refunding the order credits what is left, so the credits net the
+	// invoice to zero
+	assert.NoError(t, order.UpdateStatus(domain.OrderStatusRefunded))
+	deliverEvents(t, ctx, service, order)
+
+	invoices, _ = repo.FindByOrderID(ctx, order.ID)
+	assert.Len(t, invoices, 4)
+	assert.Equal(t, 4.25, invoices[3].Gross)
+
+	var credited float64
+	for _, doc := range invoices[1:] {
+		credited += doc.Gross
+	}
+	assert.Equal(t, invoice.Gross, domain.RoundCents(credited))
+	assert.Equal(t, fmt.Sprintf("CN-%d-000003", time.Now().UTC().Year()), invoices[3].Number)
+
+	// Nothing is left to credit
+	_, err = domain.NewCreditNote(invoice, invoices[1:], nil, "again", "", time.Now())
+	assert.Error(t, err)
+}
@@ -0,0 +1,247 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// DefaultReturnsAddress is where reverse shipments go when none is configured
+const DefaultReturnsAddress = "Titan Commerce Returns Center"
+
+// ReturnShipment is the reverse shipment created for a return
+type ReturnShipment struct {
+	ShipmentID     string
+	Carrier        string
+	TrackingNumber string
+}
+
+// ShippingClient books reverse shipments with shipping-service
+type ShippingClient interface {
+	CreateReturnShipment(ctx context.Context, orderID, returnID, fromAddress, toAddress string) (ReturnShipment, error)
+}
+
+// InventoryClient puts returned units back in stock with inventory-service.
+// Restocks are idempotent per restock ID.
+type InventoryClient interface {
+	Restock(ctx context.Context, restockID, productID string, quantity int) error
+}
+
+// RefundClient refunds returned lines with refund-service. Refunds are
+// idempotent per return ID.
+type RefundClient interface {
+	RefundReturn(ctx context.Context, orderID, returnID string, lines []domain.ReturnRefundLine) (string, error)
+}
+
+// CreditNoteIssuer credits refunded return lines on the order's invoice.
+// Credit notes are idempotent per return.
+type CreditNoteIssuer interface {
+	IssueReturnCreditNote(ctx context.Context, ret *domain.ReturnRequest) (*domain.Invoice, error)
+}
+
+// ReturnService is the application service for item returns
+type ReturnService struct {
+	returns        domain.ReturnRepository
+	events         domain.EventStore
+	shipping       ShippingClient
+	inventory      InventoryClient
+	refunds        RefundClient
+	creditNotes    CreditNoteIssuer
+	returnsAddress string // Where reverse shipments are sent
+	logger         *logger.Logger
+}
+
+// NewReturnService creates a new return service
+func NewReturnService(returns domain.ReturnRepository, events domain.EventStore, shipping ShippingClient, inventory InventoryClient, refunds RefundClient, returnsAddress string, logger *logger.Logger) *ReturnService {
+	return &ReturnService{
+		returns:        returns,
+		events:         events,
+		shipping:       shipping,
+		inventory:      inventory,
+		refunds:        refunds,
+		returnsAddress: returnsAddress,
+		logger:         logger,
+	}
+}
+
+// SetCreditNoteIssuer sets where credit notes for refunded returns are
+// issued. Returns are refunded without credit notes until one is set.
+func (s *ReturnService) SetCreditNoteIssuer(creditNotes CreditNoteIssuer) {
+	s.creditNotes = creditNotes
+}
+
+// RequestReturn opens a return for items of a delivered order (Command)
+func (s *ReturnService) RequestReturn(ctx context.Context, orderID, userID string, lines []domain.ReturnLineRequest) (*domain.ReturnRequest, error) {
+	// The event store, not the read model, has the delivery times the return
+	// window is checked against
+	order, err := s.events.LoadOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.returns.FindByOrderID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err := domain.NewReturnRequest(order, userID, lines, domain.ReturnedQuantities(existing), time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.returns.Save(ctx, ret, len(existing)); err != nil {
+		s.logger.Error(err, "failed to save return")
+		return nil, err
+	}
+
+	s.logger.Infof("Return requested: %s for order: %s with %d lines", ret.ID, orderID, len(ret.Lines))
+	return ret, nil
+}
+
+// GetReturn retrieves a return (Query)
+func (s *ReturnService) GetReturn(ctx context.Context, returnID string) (*domain.ReturnRequest, error) {
+	return s.returns.FindByID(ctx, returnID)
+}
+
+// ListOrderReturns lists the returns opened for an order (Query)
+func (s *ReturnService) ListOrderReturns(ctx context.Context, orderID string) ([]*domain.ReturnRequest, error) {
+	return s.returns.FindByOrderID(ctx, orderID)
+}
+
+// ApproveReturn approves a return and books the reverse shipment (Command).
+// If booking fails the return stays APPROVED and approving again retries it.
+func (s *ReturnService) ApproveReturn(ctx context.Context, returnID string) (*domain.ReturnRequest, error) {
+	ret, err := s.returns.FindByID(ctx, returnID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ret.Status == domain.ReturnStatusRequested {
+		if err := ret.Approve(); err != nil {
+			return nil, err
+		}
+		if err := s.returns.Update(ctx, ret); err != nil {
+			return nil, err
+		}
+	}
+
+	order, err := s.events.LoadOrder(ctx, ret.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	shipment, err := s.shipping.CreateReturnShipment(ctx, ret.OrderID, ret.ID, order.ShippingAddress, s.returnsAddress)
+	if err != nil {
+		s.logger.Error(err, "failed to create return shipment")
+		return nil, err
+	}
+	if err := ret.IssueLabel(shipment.ShipmentID, shipment.Carrier, shipment.TrackingNumber); err != nil {
+		return nil, err
+	}
+	if err := s.returns.Update(ctx, ret); err != nil {
+		return nil, err
+	}
+
+	s.logger.Infof("Return approved: %s, tracking: %s", returnID, shipment.TrackingNumber)
+	return ret, nil
+}
+
+// RejectReturn turns a return request down (Command)
+func (s *ReturnService) RejectReturn(ctx context.Context, returnID, reason string) (*domain.ReturnRequest, error) {
+	return s.change(ctx, returnID, func(ret *domain.ReturnRequest) error {
+		return ret.Reject(reason)
+	})
+}
+
+// ReceiveReturn records that the reverse shipment arrived (Command)
+func (s *ReturnService) ReceiveReturn(ctx context.Context, returnID string) (*domain.ReturnRequest, error) {
+	return s.change(ctx, returnID, func(ret *domain.ReturnRequest) error {
+		return ret.Receive()
+	})
+}
+
+// InspectReturn records the inspection, restocks the accepted units that can
+// be sold again and refunds the accepted lines (Command)
+func (s *ReturnService) InspectReturn(ctx context.Context, returnID string, inspections []domain.ReturnInspection) (*domain.ReturnRequest, error) {
+	ret, err := s.change(ctx, returnID, func(ret *domain.ReturnRequest) error {
+		return ret.Inspect(inspections)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.settle(ctx, ret)
+}
+
+// SettleReturn retries the restock and refund of an inspected return whose
+// settlement failed part way (Command)
+func (s *ReturnService) SettleReturn(ctx context.Context, returnID string) (*domain.ReturnRequest, error) {
+	ret, err := s.returns.FindByID(ctx, returnID)
+	if err != nil {
+		return nil, err
+	}
+	return s.settle(ctx, ret)
+}
+
+// settle restocks and refunds an inspected return. Each restocked line is
+// saved as it completes so a retry doesn't restock it twice; the refund and
+// credit note are idempotent per return.
+func (s *ReturnService) settle(ctx context.Context, ret *domain.ReturnRequest) (*domain.ReturnRequest, error) {
+	for _, line := range ret.PendingRestock() {
+		// Keyed by return and line, so a restock whose reply was lost is not
+		// applied again on retry
+		restockID := ret.ID + ":" + line.ProductID
+		if err := s.inventory.Restock(ctx, restockID, line.ProductID, line.AcceptedQuantity); err != nil {
+			s.logger.Errorf(err, "failed to restock %s for return %s", line.ProductID, ret.ID)
+			return ret, err
+		}
+		if err := ret.MarkRestocked(line.ProductID); err != nil {
+			return ret, err
+		}
+		if err := s.returns.Update(ctx, ret); err != nil {
+			return ret, err
+		}
+	}
+
+	var refundID string
+	if ret.RefundAmount > 0 {
+		var err error
+		refundID, err = s.refunds.RefundReturn(ctx, ret.OrderID, ret.ID, ret.RefundLines())
+		if err != nil {
+			s.logger.Errorf(err, "failed to refund return %s", ret.ID)
+			return ret, err
+		}
+	}
+
+	if s.creditNotes != nil {
+		if _, err := s.creditNotes.IssueReturnCreditNote(ctx, ret); err != nil {
+			s.logger.Errorf(err, "failed to issue credit note for return %s", ret.ID)
+			return ret, err
+		}
+	}
+
+	if err := ret.MarkRefunded(refundID); err != nil {
+		return ret, err
+	}
+	if err := s.returns.Update(ctx, ret); err != nil {
+		return ret, err
+	}
+
+	s.logger.Infof("Return refunded: %s, amount: %.2f", ret.ID, ret.RefundAmount)
+	return ret, nil
+}
+
+func (s *ReturnService) change(ctx context.Context, returnID string, fn func(*domain.ReturnRequest) error) (*domain.ReturnRequest, error) {
+	ret, err := s.returns.FindByID(ctx, returnID)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(ret); err != nil {
+		return nil, err
+	}
+	if err := s.returns.Update(ctx, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,254 @@
+package application_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/titan-commerce/backend/order-service/internal/application"
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// fakeReturnRepository keeps returns in memory, enforcing versions like the
+// postgres repository
+type fakeReturnRepository struct {
+	returns map[string]domain.ReturnRequest
+}
+
+func (f *fakeReturnRepository) Save(ctx context.Context, ret *domain.ReturnRequest, knownReturns int) error {
+	existing, _ := f.FindByOrderID(ctx, ret.OrderID)
+	if len(existing) != knownReturns {
+		return errors.New(errors.ErrConflict, "order returns were modified concurrently")
+	}
+	f.returns[ret.ID] = copyReturn(ret)
+	return nil
+}
+
+func (f *fakeReturnRepository) Update(ctx context.Context, ret *domain.ReturnRequest) error {
+	stored, ok := f.returns[ret.ID]
+	if !ok || stored.Version != ret.Version-1 {
+		return errors.New(errors.ErrConflict, "return was modified by another transaction (optimistic lock)")
+	}
+	f.returns[ret.ID] = copyReturn(ret)
+	return nil
+}
+
+func (f *fakeReturnRepository) FindByID(ctx context.Context, returnID string) (*domain.ReturnRequest, error) {
+	stored, ok := f.returns[returnID]
+	if !ok {
+		return nil, errors.New(errors.ErrNotFound, "return not found")
+	}
+	ret := copyReturn(&stored)
+	return &ret, nil
+}
+
+func (f *fakeReturnRepository) FindByOrderID(ctx context.Context, orderID string) ([]*domain.ReturnRequest, error) {
+	var returns []*domain.ReturnRequest
+	for _, stored := range f.returns {
+		if stored.OrderID == orderID {
+			ret := copyReturn(&stored)
+			returns = append(returns, &ret)
+		}
+	}
+	return returns, nil
+}
+
+func copyReturn(ret *domain.ReturnRequest) domain.ReturnRequest {
+	c := *ret
+	c.Lines = append([]domain.ReturnLine(nil), ret.Lines...)
+	return c
+}
+
+type MockShippingClient struct {
+	mock.Mock
+}
+
+func (m *MockShippingClient) CreateReturnShipment(ctx context.Context, orderID, returnID, fromAddress, toAddress string) (application.ReturnShipment, error) {
+	args := m.Called(ctx, orderID, returnID, fromAddress, toAddress)
+	return args.Get(0).(application.ReturnShipment), args.Error(1)
+}
+
+type MockInventoryClient struct {
+	mock.Mock
+}
+
+func (m *MockInventoryClient) Restock(ctx context.Context, restockID, productID string, quantity int) error {
+	args := m.Called(ctx, restockID, productID, quantity)
+	return args.Error(0)
+}
+
+type MockRefundClient struct {
+	mock.Mock
+}
+
+func (m *MockRefundClient) RefundReturn(ctx context.Context, orderID, returnID string, lines []domain.ReturnRefundLine) (string, error) {
+	args := m.Called(ctx, orderID, returnID, lines)
+	return args.String(0), args.Error(1)
+}
+
+// deliveredOrder is an order of two products, delivered at deliveredAt
+func deliveredOrder(t *testing.T, orderID string, deliveredAt time.Time) *domain.Order {
+	created := createdEvent(orderID)
+	created.Items = []domain.OrderItem{
+		{ProductID: "prod-1", ProductName: "Mug", Quantity: 3, UnitPrice: 10, Subtotal: 30},
+		{ProductID: "prod-2", ProductName: "Lamp", Quantity: 1, UnitPrice: 40, Subtotal: 40},
+	}
+	created.Total = 70
+
+	order, err := domain.RehydrateOrder([]domain.DomainEvent{
+		created,
+		&domain.OrderStatusChangedEvent{OrderID: orderID, From: domain.OrderStatusPending, To: domain.OrderStatusConfirmed, ChangedAt: deliveredAt},
+		&domain.OrderStatusChangedEvent{OrderID: orderID, From: domain.OrderStatusConfirmed, To: domain.OrderStatusProcessing, ChangedAt: deliveredAt},
+		&domain.OrderStatusChangedEvent{OrderID: orderID, From: domain.OrderStatusProcessing, To: domain.OrderStatusShipped, ChangedAt: deliveredAt},
+		&domain.OrderStatusChangedEvent{OrderID: orderID, From: domain.OrderStatusShipped, To: domain.OrderStatusDelivered, ChangedAt: deliveredAt},
+	})
+	assert.NoError(t, err)
+	return order
+}
+
+func newTestReturnService() (*application.ReturnService, *fakeReturnRepository, *MockEventStore, *MockShippingClient, *MockInventoryClient, *MockRefundClient) {
+	repo := &fakeReturnRepository{returns: make(map[string]domain.ReturnRequest)}
+	mockEvents := new(MockEventStore)
+	shipping := new(MockShippingClient)
+	inventory := new(MockInventoryClient)
+	refunds := new(MockRefundClient)
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+
+	service := application.NewReturnService(repo, mockEvents, shipping, inventory, refunds, "Returns Center", log)
+	return service, repo, mockEvents, shipping, inventory, refunds
+}
+
+func TestReturnService_FullReturn(t *testing.T) {
+	// Setup
+	service, _, mockEvents, shipping, inventory, refunds := newTestReturnService()
+	ctx := context.Background()
+	order := deliveredOrder(t, "order-123", time.Now().Add(-24*time.Hour))
+
+	mockEvents.On("LoadOrder", ctx, "order-123").Return(order, nil)
+	shipping.On("CreateReturnShipment", ctx, "order-123", mock.Anything, "123 Test Street", "Returns Center").
+		Return(application.ReturnShipment{ShipmentID: "shp-1", Carrier: "UPS", TrackingNumber: "TRK123"}, nil)
+	refunds.On("RefundReturn", ctx, "order-123", mock.Anything, []domain.ReturnRefundLine{
+		{ProductID: "prod-1", Quantity: 1, Amount: 10},
+		{ProductID: "prod-2", Quantity: 1, Amount: 40},
+	}).Return("refund-1", nil)
+
+	// Execute: return two mugs and the lamp; one mug comes back unsellable
+	// and the other is not accepted
+	ret, err := service.RequestReturn(ctx, "order-123", "user-123", []domain.ReturnLineRequest{
+		{ProductID: "prod-1", Quantity: 2, Reason: "Too many"},
+		{ProductID: "prod-2", Quantity: 1, Reason: "Damaged"},
+	})
+	assert.NoError(t, err)
+	inventory.On("Restock", ctx, ret.ID+":prod-1", "prod-1", 1).Return(nil)
+
+	ret, err = service.ApproveReturn(ctx, ret.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.ReturnStatusLabelIssued, ret.Status)
+	assert.Equal(t, "TRK123", ret.TrackingNumber)
+
+	_, err = service.ReceiveReturn(ctx, ret.ID)
+	assert.NoError(t, err)
+
+	ret, err = service.InspectReturn(ctx, ret.ID, []domain.ReturnInspection{
+		{ProductID: "prod-1", AcceptedQuantity: 1, Restock: true},
+		{ProductID: "prod-2", AcceptedQuantity: 1, Restock: false},
+	})
+
+	// Assert: only the accepted, sellable units are restocked and each line
+	// is refunded for what was accepted
+	assert.NoError(t, err)
+	assert.Equal(t, domain.ReturnStatusRefunded, ret.Status)
+	assert.Equal(t, "refund-1", ret.RefundID)
+	assert.Equal(t, 50.0, ret.RefundAmount)
+
+	stored, err := service.GetReturn(ctx, ret.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.ReturnStatusRefunded, stored.Status)
+	assert.True(t, stored.Lines[0].Restocked)
+
+	inventory.AssertExpectations(t)
+	refunds.AssertExpectations(t)
+}
+
+func TestReturnService_SettleRetriesWithoutRestockingTwice(t *testing.T) {
+	// Setup
+	service, _, mockEvents, shipping, inventory, refunds := newTestReturnService()
+	ctx := context.Background()
+	order := deliveredOrder(t, "order-123", time.Now().Add(-24*time.Hour))
+
+	mockEvents.On("LoadOrder", ctx, "order-123").Return(order, nil)
+	shipping.On("CreateReturnShipment", ctx, "order-123", mock.Anything, mock.Anything, mock.Anything).
+		Return(application.ReturnShipment{ShipmentID: "shp-1", Carrier: "UPS", TrackingNumber: "TRK123"}, nil)
+	inventory.On("Restock", ctx, mock.Anything, "prod-1", 2).Return(nil).Once()
+	refunds.On("RefundReturn", ctx, "order-123", mock.Anything, mock.Anything).
+		Return("", errors.New(errors.ErrInternal, "refund-service unavailable")).Once()
+	refunds.On("RefundReturn", ctx, "order-123", mock.Anything, mock.Anything).Return("refund-1", nil).Once()
+
+	ret, err := service.RequestReturn(ctx, "order-123", "user-123", []domain.ReturnLineRequest{
+		{ProductID: "prod-1", Quantity: 2},
+	})
+	assert.NoError(t, err)
+	_, err = service.ApproveReturn(ctx, ret.ID)
+	assert.NoError(t, err)
+	_, err = service.ReceiveReturn(ctx, ret.ID)
+	assert.NoError(t, err)
+
+	// Execute: the refund fails after restocking, then settlement is retried
+	_, err = service.InspectReturn(ctx, ret.ID, []domain.ReturnInspection{
+		{ProductID: "prod-1", AcceptedQuantity: 2, Restock: true},
+	})
+	assert.Error(t, err)
+
+	ret, err = service.SettleReturn(ctx, ret.ID)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, domain.ReturnStatusRefunded, ret.Status)
+	inventory.AssertNumberOfCalls(t, "Restock", 1)
+	refunds.AssertNumberOfCalls(t, "RefundReturn", 2)
+}
+
+func TestReturnService_RequestReturn_Validation(t *testing.T) {
+	service, _, mockEvents, _, _, _ := newTestReturnService()
+	ctx := context.Background()
+
+	recent := deliveredOrder(t, "order-recent", time.Now().Add(-24*time.Hour))
+	stale := deliveredOrder(t, "order-stale", time.Now().Add(-domain.ReturnWindow-time.Hour))
+	undelivered := existingOrder(t, "order-open")
+	mockEvents.On("LoadOrder", ctx, "order-recent").Return(recent, nil)
+	mockEvents.On("LoadOrder", ctx, "order-stale").Return(stale, nil)
+	mockEvents.On("LoadOrder", ctx, "order-open").Return(undelivered, nil)
+
+	one := func(productID string, quantity int) []domain.ReturnLineRequest {
+		return []domain.ReturnLineRequest{{ProductID: productID, Quantity: quantity}}
+	}
+
+	// Outside the return window
+	_, err := service.RequestReturn(ctx, "order-stale", "user-123", one("prod-1", 1))
+	assert.Error(t, err)
+
+	// Not delivered yet
+	_, err = service.RequestReturn(ctx, "order-open", "user-123", one("prod-1", 1))
+	assert.Error(t, err)
+
+	// Someone else's order
+	_, err = service.RequestReturn(ctx, "order-recent", "user-456", one("prod-1", 1))
+	assert.Error(t, err)
+
+	// More than was bought, counting earlier returns
+	_, err = service.RequestReturn(ctx, "order-recent", "user-123", one("prod-1", 4))
+	assert.Error(t, err)
+
+	_, err = service.RequestReturn(ctx, "order-recent", "user-123", one("prod-1", 2))
+	assert.NoError(t, err)
+
+	_, err = service.RequestReturn(ctx, "order-recent", "user-123", one("prod-1", 2))
+	assert.Error(t, err)
+
+	_, err = service.RequestReturn(ctx, "order-recent", "user-123", one("prod-1", 1))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,126 @@
+package application
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+)
+
+// ExportFlushEvery is how many CSV rows are buffered before they are written out
+const ExportFlushEvery = 200
+
+// exportHeader lists the CSV columns written by ExportOrders
+var exportHeader = []string{
+	"order_id", "user_id", "status", "total_amount", "shipping_country", "shipping_address",
+	"item_count", "sellers", "products", "created_at", "updated_at",
+}
+
+// SearchOrders returns one page of orders matching an admin search (Query)
+func (s *OrderService) SearchOrders(ctx context.Context, q domain.OrderSearch) ([]*domain.Order, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	orders, err := s.repo.Search(ctx, q)
+	if err != nil {
+		s.logger.Error(err, "failed to search orders")
+		return nil, err
+	}
+	return orders, nil
+}
+
+// ExportOrders writes every order matching a search to w as CSV (Query). Rows
+// are streamed from the read model and flushed in small batches, so any
+// number of orders can be exported.
+func (s *OrderService) ExportOrders(ctx context.Context, q domain.OrderSearch, w io.Writer) (int, error) {
+	if err := q.Validate(); err != nil {
+		return 0, err
+	}
+
+	out := csv.NewWriter(w)
+	if err := out.Write(exportHeader); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err := s.repo.SearchEach(ctx, q, func(order *domain.Order) error {
+		if err := out.Write(exportRow(order)); err != nil {
+			return err
+		}
+		count++
+		if count%ExportFlushEvery == 0 {
+			out.Flush()
+			return out.Error()
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Error(err, "failed to export orders")
+		return count, err
+	}
+
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return count, err
+	}
+
+	s.logger.Infof("Exported %d orders", count)
+	return count, nil
+}
+
+func exportRow(order *domain.Order) []string {
+	sellers := make(map[string]bool)
+	products := make(map[string]bool)
+	quantity := 0
+	for _, item := range order.Items {
+		if item.SellerID != "" {
+			sellers[item.SellerID] = true
+		}
+		products[item.ProductID] = true
+		quantity += item.Quantity
+	}
+
+	row := []string{
+		order.ID,
+		order.UserID,
+		string(order.Status),
+		strconv.FormatFloat(order.TotalAmount, 'f', 2, 64),
+		domain.ShippingCountry(order.ShippingAddress),
+		order.ShippingAddress,
+		strconv.Itoa(quantity),
+		joinKeys(sellers),
+		joinKeys(products),
+		order.CreatedAt.UTC().Format(time.RFC3339),
+		order.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+	for i, cell := range row {
+		row[i] = escapeFormula(cell)
+	}
+	return row
+}
+
+// escapeFormula keeps spreadsheets from evaluating a cell as a formula when
+// customer-supplied text such as an address starts with a formula trigger,
+// by prefixing it with a quote
+func escapeFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// joinKeys joins a set's members in sorted order so exports are reproducible
+func joinKeys(set map[string]bool) string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ";")
+}
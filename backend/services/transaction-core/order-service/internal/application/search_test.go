@@ -0,0 +1,138 @@
+package application_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+)
+
+func TestOrderService_SearchOrders(t *testing.T) {
+	// Setup
+	service, mockRepo, _, _ := newTestService()
+	ctx := context.Background()
+	minTotal := 50.0
+
+	expected := domain.OrderSearch{
+		Statuses:        []domain.OrderStatus{domain.OrderStatusShipped},
+		MinTotal:        &minTotal,
+		ShippingCountry: "DE",
+		SortBy:          domain.SortByCreatedAt,
+		Limit:           domain.MaxSearchLimit,
+	}
+	mockRepo.On("Search", ctx, expected).Return([]*domain.Order{existingOrder(t, "order-123")}, nil)
+
+	// Execute: defaults are filled in and the country is normalized
+	orders, err := service.SearchOrders(ctx, domain.OrderSearch{
+		Statuses:        []domain.OrderStatus{domain.OrderStatusShipped},
+		MinTotal:        &minTotal,
+		ShippingCountry: " de ",
+		Limit:           10000,
+	})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Len(t, orders, 1)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestOrderService_SearchOrders_SortBySellerAndProduct(t *testing.T) {
+	service, mockRepo, _, _ := newTestService()
+	ctx := context.Background()
+
+	for _, sortBy := range []domain.OrderSortField{domain.SortBySellerID, domain.SortByProductID} {
+		expected := domain.OrderSearch{SortBy: sortBy, Descending: true, Limit: 20}
+		mockRepo.On("Search", ctx, expected).Return([]*domain.Order{existingOrder(t, "order-123")}, nil).Once()
+
+		orders, err := service.SearchOrders(ctx, domain.OrderSearch{SortBy: sortBy, Descending: true, Limit: 20})
+
+		assert.NoError(t, err)
+		assert.Len(t, orders, 1)
+	}
+	mockRepo.AssertExpectations(t)
+
+	// An order sorts under its first seller and product by ID
+	items := []domain.OrderItem{
+		{ProductID: "prod-2", SellerID: "seller-b"},
+		{ProductID: "prod-3", SellerID: "seller-a"},
+		{ProductID: "prod-1", SellerID: "seller-c"},
+	}
+	assert.Equal(t, "seller-a", domain.SortSellerID(items))
+	assert.Equal(t, "prod-1", domain.SortProductID(items))
+	assert.Empty(t, domain.SortSellerID(nil))
+}
+
+func TestOrderService_SearchOrders_Invalid(t *testing.T) {
+	service, mockRepo, _, _ := newTestService()
+	ctx := context.Background()
+	now := time.Now()
+	low, high := 10.0, 5.0
+
+	for _, q := range []domain.OrderSearch{
+		{SortBy: "user_id; DROP TABLE orders_read_model"},
+		{CreatedFrom: now, CreatedTo: now.Add(-time.Hour)},
+		{MinTotal: &low, MaxTotal: &high},
+		{Offset: -1},
+	} {
+		_, err := service.SearchOrders(ctx, q)
+		assert.Error(t, err)
+	}
+	mockRepo.AssertNotCalled(t, "Search", mock.Anything, mock.Anything)
+}
+
+func TestOrderService_ExportOrders(t *testing.T) {
+	// Setup
+	service, mockRepo, _, _ := newTestService()
+	ctx := context.Background()
+
+	order := existingOrder(t, "order-123")
+	order.ShippingAddress = "1 Main St, Berlin, de"
+	order.Items = []domain.OrderItem{
+		{ProductID: "prod-2", SellerID: "seller-b", Quantity: 2},
+		{ProductID: "prod-1", SellerID: "seller-a", Quantity: 1},
+	}
+	mockRepo.On("SearchEach", ctx, mock.Anything, mock.Anything).Return([]*domain.Order{order, order}, nil)
+
+	// Execute
+	var buf bytes.Buffer
+	count, err := service.ExportOrders(ctx, domain.OrderSearch{SellerID: "seller-a"}, &buf)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, "order_id", records[0][0])
+	assert.Equal(t, []string{"order-123", "user-123", "PENDING", "10.00", "DE", "1 Main St, Berlin, de", "3", "seller-a;seller-b", "prod-1;prod-2"}, records[1][:9])
+}
+
+func TestOrderService_ExportOrders_EscapesFormulas(t *testing.T) {
+	// Setup
+	service, mockRepo, _, _ := newTestService()
+	ctx := context.Background()
+
+	order := existingOrder(t, "order-123")
+	order.Items = []domain.OrderItem{{ProductID: "@SUM(A1:A9)", SellerID: "+seller", Quantity: 1}}
+	order.ShippingAddress = "=HYPERLINK(\"http://evil\"), de"
+	mockRepo.On("SearchEach", ctx, mock.Anything, mock.Anything).Return([]*domain.Order{order}, nil)
+
+	// Execute
+	var buf bytes.Buffer
+	_, err := service.ExportOrders(ctx, domain.OrderSearch{}, &buf)
+
+	// Assert
+	assert.NoError(t, err)
+	records, err := csv.NewReader(&buf).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, "'=HYPERLINK(\"http://evil\"), de", records[1][5])
+	assert.Equal(t, "'+seller", records[1][7])
+	assert.Equal(t, "'@SUM(A1:A9)", records[1][8])
+	assert.Equal(t, "order-123", records[1][0])
+}
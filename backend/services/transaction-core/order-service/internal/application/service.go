@@ -7,45 +7,66 @@ import (
 	"github.com/titan-commerce/backend/pkg/logger"
 )
 
+// RebuildBatchSize is how many events are replayed per read when rebuilding
+// the read model
+const RebuildBatchSize = 500
+
 // OrderService is the application service for orders
 type OrderService struct {
-	repo   domain.Repository
-	events domain.EventStore
-	logger *logger.Logger
+	repo      domain.Repository
+	events    domain.EventStore
+	projector domain.Projector
+	taxes     *domain.TaxEngine
+	deferred  domain.DeferredEventRepository
+	refunds   PaymentRefunder
+	logger    *logger.Logger
 }
 
 // NewOrderService creates a new order service
-func NewOrderService(repo domain.Repository, events domain.EventStore, logger *logger.Logger) *OrderService {
+func NewOrderService(repo domain.Repository, events domain.EventStore, projector domain.Projector, logger *logger.Logger) *OrderService {
 	return &OrderService{
-		repo:   repo,
-		events: events,
-		logger: logger,
+		repo:      repo,
+		events:    events,
+		projector: projector,
+		logger:    logger,
 	}
 }
 
-// CreateOrder creates a new order (Command)
-func (s *OrderService) CreateOrder(ctx context.Context, userID string, items []domain.OrderItem, shippingAddress string) (*domain.Order, error) {
+// SetTaxEngine sets the engine new orders are taxed with. Orders are created
+// untaxed until one is set.
+func (s *OrderService) SetTaxEngine(taxes *domain.TaxEngine) {
+	s.taxes = taxes
+}
+
+// SetDeferredEvents sets where payment and shipping events the order cannot
+// take yet are kept for a retry. Until one is set they are returned to the
+// sender as DEFERRED, or as conflicts, to redeliver.
+func (s *OrderService) SetDeferredEvents(deferred domain.DeferredEventRepository) {
+	s.deferred = deferred
+}
+
+// SetPaymentRefunder sets what refunds payments an order rejects. Until one
+// is set they are only logged.
+func (s *OrderService) SetPaymentRefunder(refunds PaymentRefunder) {
+	s.refunds = refunds
+}
+
+// CreateOrder creates a new order split into one sub-order per seller
+// (Command). shippingFees maps seller ID to that seller's shipping charge.
+func (s *OrderService) CreateOrder(ctx context.Context, userID string, items []domain.OrderItem, shippingAddress string, shippingFees map[string]float64) (*domain.Order, error) {
 	// Create order aggregate
-	order, err := domain.NewOrder(userID, items, shippingAddress)
+	order, err := domain.NewOrder(userID, items, shippingAddress, shippingFees, s.taxes)
 	if err != nil {
 		s.logger.Error(err, "failed to create order")
 		return nil, err
 	}
 
-	// Save order
-	if err := s.repo.Save(ctx, order); err != nil {
+	if err := s.save(ctx, order); err != nil {
 		s.logger.Error(err, "failed to save order")
 		return nil, err
 	}
 
-	// Publish domain event
-	event := domain.NewOrderCreatedEvent(order)
-	if err := s.events.SaveEvent(ctx, event); err != nil {
-		s.logger.Error(err, "failed to publish order created event")
-		// Don't fail the operation, event will be eventually published
-	}
-
-	s.logger.Infof("Order created: %s for user: %s", order.ID, userID)
+	s.logger.Infof("Order created: %s for user: %s with %d sub-orders", order.ID, userID, len(order.SubOrders))
 	return order, nil
 }
 
@@ -71,7 +92,7 @@ func (s *OrderService) ListOrders(ctx context.Context, userID string, limit, off
 
 // CancelOrder cancels an order (Command)
 func (s *OrderService) CancelOrder(ctx context.Context, orderID string, reason string) (*domain.Order, error) {
-	order, err := s.repo.FindByID(ctx, orderID)
+	order, err := s.load(ctx, orderID)
 	if err != nil {
 		return nil, err
 	}
@@ -80,10 +101,143 @@ func (s *OrderService) CancelOrder(ctx context.Context, orderID string, reason s
 		return nil, err
 	}
 
-	if err := s.repo.Update(ctx, order); err != nil {
+	if err := s.save(ctx, order); err != nil {
 		return nil, err
 	}
 
 	s.logger.Infof("Order cancelled: %s, reason: %s", orderID, reason)
 	return order, nil
 }
+
+// UpdateOrderStatus moves an order to a new status (Command)
+func (s *OrderService) UpdateOrderStatus(ctx context.Context, orderID string, newStatus domain.OrderStatus) (*domain.Order, error) {
+	order, err := s.load(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := order.UpdateStatus(newStatus); err != nil {
+		return nil, err
+	}
+
+	if err := s.save(ctx, order); err != nil {
+		return nil, err
+	}
+
+	s.logger.Infof("Order %s status updated to %s", orderID, newStatus)
+	return order, nil
+}
+
+// ListSellerOrders lists the sub-orders a seller has to fulfil (Query)
+func (s *OrderService) ListSellerOrders(ctx context.Context, sellerID string, limit, offset int) ([]*domain.SubOrder, error) {
+	subs, err := s.repo.FindSubOrdersBySeller(ctx, sellerID, limit, offset)
+	if err != nil {
+		s.logger.Error(err, "failed to list seller orders")
+		return nil, err
+	}
+	return subs, nil
+}
+
+// UpdateSubOrderStatus moves one seller's sub-order to a new status (Command)
+func (s *OrderService) UpdateSubOrderStatus(ctx context.Context, subOrderID string, newStatus domain.OrderStatus) (*domain.SubOrder, error) {
+	return s.changeSubOrder(ctx, subOrderID, func(order *domain.Order) error {
+		return order.UpdateSubOrderStatus(subOrderID, newStatus)
+	})
+}
+
+// CancelSubOrder cancels one seller's sub-order, leaving the rest of the
+// order in place (Command)
+func (s *OrderService) CancelSubOrder(ctx context.Context, subOrderID, reason string) (*domain.SubOrder, error) {
+	return s.changeSubOrder(ctx, subOrderID, func(order *domain.Order) error {
+		return order.CancelSubOrder(subOrderID, reason)
+	})
+}
+
+// changeSubOrder runs a command against the order that owns a sub-order
+func (s *OrderService) changeSubOrder(ctx context.Context, subOrderID string, command func(*domain.Order) error) (*domain.SubOrder, error) {
+	// The read model only locates the parent; the command runs on its stream
+	located, err := s.repo.FindSubOrder(ctx, subOrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := s.load(ctx, located.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := command(order); err != nil {
+		return nil, err
+	}
+
+	if err := s.save(ctx, order); err != nil {
+		return nil, err
+	}
+
+	sub, _ := order.FindSubOrder(subOrderID)
+	s.logger.Infof("Sub-order %s of order %s is now %s (order %s)", subOrderID, order.ID, sub.Status, order.Status)
+	return &sub, nil
+}
+
+// RebuildProjection empties the read model and replays the full event stream
+// into it. It returns the number of events replayed.
+func (s *OrderService) RebuildProjection(ctx context.Context) (int64, error) {
+	if err := s.projector.Reset(ctx); err != nil {
+		return 0, err
+	}
+
+	var sequence, replayed int64
+	for {
+		batch, err := s.events.ReadAll(ctx, sequence, RebuildBatchSize)
+		if err != nil {
+			return replayed, err
+		}
+		if len(batch) == 0 {
+			return replayed, nil
+		}
+
+		if err := s.projector.Project(ctx, batch); err != nil {
+			return replayed, err
+		}
+
+		sequence = batch[len(batch)-1].Sequence
+		replayed += int64(len(batch))
+		s.logger.Infof("Replayed %d events (sequence %d)", replayed, sequence)
+	}
+}
+
+// SnapshotOrder snapshots an order now rather than waiting for the next
+// automatic snapshot
+func (s *OrderService) SnapshotOrder(ctx context.Context, orderID string) error {
+	order, err := s.events.LoadOrder(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if err := s.events.SaveSnapshot(ctx, order); err != nil {
+		return err
+	}
+
+	s.logger.Infof("Order %s snapshotted at version %d", orderID, order.Version)
+	return nil
+}
+
+// load rebuilds the aggregate from the event store
+func (s *OrderService) load(ctx context.Context, orderID string) (*domain.Order, error) {
+	return s.events.LoadOrder(ctx, orderID)
+}
+
+// save appends the aggregate's new events and projects them. The event store
+// is the source of truth, so a projection failure only leaves the read model
+// stale until the next rebuild and does not fail the command.
+func (s *OrderService) save(ctx context.Context, order *domain.Order) error {
+	records := domain.NewRecordedEvents(order.ID, order.UncommittedEvents(), order.ExpectedVersion())
+
+	if err := s.events.SaveOrder(ctx, order); err != nil {
+		return err
+	}
+
+	if err := s.projector.Project(ctx, records); err != nil {
+		s.logger.Errorf(err, "failed to project events for order %s", order.ID)
+	}
+	return nil
+}
@@ -3,24 +3,21 @@ package application_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/titan-commerce/backend/order-service/internal/application"
 	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
 	"github.com/titan-commerce/backend/pkg/logger"
 )
 
-// MockRepository is a mock implementation of the order repository
+// MockRepository is a mock implementation of the order read model
 type MockRepository struct {
 	mock.Mock
 }
 
-func (m *MockRepository) Save(ctx context.Context, order *domain.Order) error {
-	args := m.Called(ctx, order)
-	return args.Error(0)
-}
-
 func (m *MockRepository) FindByID(ctx context.Context, orderID string) (*domain.Order, error) {
 	args := m.Called(ctx, orderID)
 	if args.Get(0) == nil {
@@ -34,9 +31,32 @@ func (m *MockRepository) FindByUserID(ctx context.Context, userID string, limit,
 	return args.Get(0).([]*domain.Order), args.Error(1)
 }
 
-func (m *MockRepository) Update(ctx context.Context, order *domain.Order) error {
-	args := m.Called(ctx, order)
-	return args.Error(0)
+func (m *MockRepository) FindSubOrder(ctx context.Context, subOrderID string) (*domain.SubOrder, error) {
+	args := m.Called(ctx, subOrderID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.SubOrder), args.Error(1)
+}
+
+func (m *MockRepository) FindSubOrdersBySeller(ctx context.Context, sellerID string, limit, offset int) ([]*domain.SubOrder, error) {
+	args := m.Called(ctx, sellerID, limit, offset)
+	return args.Get(0).([]*domain.SubOrder), args.Error(1)
+}
+
+func (m *MockRepository) Search(ctx context.Context, q domain.OrderSearch) ([]*domain.Order, error) {
+	args := m.Called(ctx, q)
+	return args.Get(0).([]*domain.Order), args.Error(1)
+}
+
+func (m *MockRepository) SearchEach(ctx context.Context, q domain.OrderSearch, fn func(*domain.Order) error) error {
+	args := m.Called(ctx, q, fn)
+	for _, order := range args.Get(0).([]*domain.Order) {
+		if err := fn(order); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
 }
 
 // MockEventStore is a mock implementation of the event store
@@ -44,18 +64,92 @@ type MockEventStore struct {
 	mock.Mock
 }
 
-func (m *MockEventStore) SaveEvent(ctx context.Context, event interface{}) error {
-	args := m.Called(ctx, event)
+func (m *MockEventStore) SaveEvents(ctx context.Context, aggregateID string, events []domain.DomainEvent, expectedVersion int) error {
+	args := m.Called(ctx, aggregateID, events, expectedVersion)
 	return args.Error(0)
 }
 
-func TestOrderService_CreateOrder(t *testing.T) {
-	// Setup
+func (m *MockEventStore) GetEvents(ctx context.Context, aggregateID string) ([]domain.DomainEvent, error) {
+	args := m.Called(ctx, aggregateID)
+	return args.Get(0).([]domain.DomainEvent), args.Error(1)
+}
+
+func (m *MockEventStore) ReadAll(ctx context.Context, afterSequence int64, limit int) ([]domain.RecordedEvent, error) {
+	args := m.Called(ctx, afterSequence, limit)
+	return args.Get(0).([]domain.RecordedEvent), args.Error(1)
+}
+
+func (m *MockEventStore) HeadSequence(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockEventStore) LoadOrder(ctx context.Context, orderID string) (*domain.Order, error) {
+	args := m.Called(ctx, orderID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Order), args.Error(1)
+}
+
+func (m *MockEventStore) SaveOrder(ctx context.Context, order *domain.Order) error {
+	args := m.Called(ctx, order)
+	if args.Error(0) == nil {
+		order.MarkCommitted()
+	}
+	return args.Error(0)
+}
+
+func (m *MockEventStore) SaveSnapshot(ctx context.Context, order *domain.Order) error {
+	args := m.Called(ctx, order)
+	return args.Error(0)
+}
+
+// MockProjector is a mock implementation of the read model projector
+type MockProjector struct {
+	mock.Mock
+}
+
+func (m *MockProjector) Project(ctx context.Context, events []domain.RecordedEvent) error {
+	args := m.Called(ctx, events)
+	return args.Error(0)
+}
+
+func (m *MockProjector) Reset(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func newTestService() (*application.OrderService, *MockRepository, *MockEventStore, *MockProjector) {
 	mockRepo := new(MockRepository)
 	mockEvents := new(MockEventStore)
+	mockProjector := new(MockProjector)
 	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
-	
-	service := application.NewOrderService(mockRepo, mockEvents, log)
+
+	service := application.NewOrderService(mockRepo, mockEvents, mockProjector, log)
+	return service, mockRepo, mockEvents, mockProjector
+}
+
+func createdEvent(orderID string) *domain.OrderCreatedEvent {
+	return &domain.OrderCreatedEvent{
+		OrderID:         orderID,
+		UserID:          "user-123",
+		Items:           []domain.OrderItem{{ProductID: "prod-1", Quantity: 1, UnitPrice: 10, Subtotal: 10}},
+		Total:           10,
+		ShippingAddress: "123 Test Street",
+		CreatedAt:       time.Now(),
+	}
+}
+
+func existingOrder(t *testing.T, orderID string) *domain.Order {
+	order, err := domain.RehydrateOrder([]domain.DomainEvent{createdEvent(orderID)})
+	assert.NoError(t, err)
+	return order
+}
+
+func TestOrderService_CreateOrder(t *testing.T) {
+	// Setup
+	service, _, mockEvents, mockProjector := newTestService()
 
 	ctx := context.Background()
 	userID := "user-123"
@@ -65,11 +159,15 @@ func TestOrderService_CreateOrder(t *testing.T) {
 	shippingAddress := "123 Test Street"
 
 	// Expectations
-	mockRepo.On("Save", ctx, mock.AnythingOfType("*domain.Order")).Return(nil)
-	mockEvents.On("SaveEvent", ctx, mock.Anything).Return(nil)
+	mockEvents.On("SaveOrder", ctx, mock.MatchedBy(func(order *domain.Order) bool {
+		return order.ExpectedVersion() == 0 && len(order.UncommittedEvents()) == 1
+	})).Return(nil)
+	mockProjector.On("Project", ctx, mock.MatchedBy(func(records []domain.RecordedEvent) bool {
+		return len(records) == 1 && records[0].Version == 1
+	})).Return(nil)
 
 	// Execute
-	order, err := service.CreateOrder(ctx, userID, items, shippingAddress)
+	order, err := service.CreateOrder(ctx, userID, items, shippingAddress, nil)
 
 	// Assert
 	assert.NoError(t, err)
@@ -78,18 +176,16 @@ func TestOrderService_CreateOrder(t *testing.T) {
 	assert.Equal(t, shippingAddress, order.ShippingAddress)
 	assert.Len(t, order.Items, 1)
 	assert.Equal(t, domain.OrderStatusPending, order.Status)
-	
-	mockRepo.AssertExpectations(t)
+	assert.Equal(t, 1, order.Version)
+	assert.Empty(t, order.UncommittedEvents())
+
 	mockEvents.AssertExpectations(t)
+	mockProjector.AssertExpectations(t)
 }
 
 func TestOrderService_GetOrder(t *testing.T) {
 	// Setup
-	mockRepo := new(MockRepository)
-	mockEvents := new(MockEventStore)
-	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
-	
-	service := application.NewOrderService(mockRepo, mockEvents, log)
+	service, mockRepo, _, _ := newTestService()
 
 	ctx := context.Background()
 	orderID := "order-123"
@@ -108,31 +204,25 @@ func TestOrderService_GetOrder(t *testing.T) {
 	// Assert
 	assert.NoError(t, err)
 	assert.Equal(t, expectedOrder, order)
-	
+
 	mockRepo.AssertExpectations(t)
 }
 
 func TestOrderService_CancelOrder(t *testing.T) {
 	// Setup
-	mockRepo := new(MockRepository)
-	mockEvents := new(MockEventStore)
-	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
-	
-	service := application.NewOrderService(mockRepo, mockEvents, log)
+	service, _, mockEvents, mockProjector := newTestService()
 
 	ctx := context.Background()
 	orderID := "order-123"
 	reason := "Customer requested cancellation"
-	
-	existingOrder := &domain.Order{
-		ID:     orderID,
-		UserID: "user-123",
-		Status: domain.OrderStatusPending,
-	}
 
-	// Expectations
-	mockRepo.On("FindByID", ctx, orderID).Return(existingOrder, nil)
-	mockRepo.On("Update", ctx, mock.AnythingOfType("*domain.Order")).Return(nil)
+	// Expectations: the order is rebuilt from the store and the cancel is
+	// appended after version 1
+	mockEvents.On("LoadOrder", ctx, orderID).Return(existingOrder(t, orderID), nil)
+	mockEvents.On("SaveOrder", ctx, mock.MatchedBy(func(order *domain.Order) bool {
+		return order.ExpectedVersion() == 1
+	})).Return(nil)
+	mockProjector.On("Project", ctx, mock.Anything).Return(nil)
 
 	// Execute
 	order, err := service.CancelOrder(ctx, orderID, reason)
@@ -141,17 +231,34 @@ func TestOrderService_CancelOrder(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, order)
 	assert.Equal(t, domain.OrderStatusCancelled, order.Status)
-	
-	mockRepo.AssertExpectations(t)
+	assert.Equal(t, 2, order.Version)
+
+	mockEvents.AssertExpectations(t)
+}
+
+func TestOrderService_CancelOrder_Conflict(t *testing.T) {
+	// Setup
+	service, _, mockEvents, mockProjector := newTestService()
+
+	ctx := context.Background()
+	orderID := "order-123"
+
+	mockEvents.On("LoadOrder", ctx, orderID).Return(existingOrder(t, orderID), nil)
+	mockEvents.On("SaveOrder", ctx, mock.AnythingOfType("*domain.Order")).
+		Return(errors.New(errors.ErrConflict, "concurrent modification detected"))
+
+	// Execute
+	order, err := service.CancelOrder(ctx, orderID, "too slow")
+
+	// Assert
+	assert.Error(t, err)
+	assert.Nil(t, order)
+	mockProjector.AssertNotCalled(t, "Project", mock.Anything, mock.Anything)
 }
 
 func TestOrderService_CreateOrder_EmptyItems(t *testing.T) {
 	// Setup
-	mockRepo := new(MockRepository)
-	mockEvents := new(MockEventStore)
-	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
-	
-	service := application.NewOrderService(mockRepo, mockEvents, log)
+	service, _, _, _ := newTestService()
 
 	ctx := context.Background()
 	userID := "user-123"
@@ -159,9 +266,132 @@ func TestOrderService_CreateOrder_EmptyItems(t *testing.T) {
 	shippingAddress := "123 Test Street"
 
 	// Execute
-	order, err := service.CreateOrder(ctx, userID, items, shippingAddress)
+	order, err := service.CreateOrder(ctx, userID, items, shippingAddress, nil)
 
 	// Assert
 	assert.Error(t, err)
 	assert.Nil(t, order)
 }
+
+func TestOrderService_RebuildProjection(t *testing.T) {
+	// Setup
+	service, _, mockEvents, mockProjector := newTestService()
+
+	ctx := context.Background()
+	batch := []domain.RecordedEvent{
+		{Sequence: 1, AggregateID: "order-1", Version: 1, Event: createdEvent("order-1")},
+		{Sequence: 2, AggregateID: "order-2", Version: 1, Event: createdEvent("order-2")},
+	}
+
+	// Expectations
+	mockProjector.On("Reset", ctx).Return(nil)
+	mockEvents.On("ReadAll", ctx, int64(0), application.RebuildBatchSize).Return(batch, nil)
+	mockEvents.On("ReadAll", ctx, int64(2), application.RebuildBatchSize).Return([]domain.RecordedEvent(nil), nil)
+	mockProjector.On("Project", ctx, batch).Return(nil)
+
+	// Execute
+	replayed, err := service.RebuildProjection(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), replayed)
+
+	mockEvents.AssertExpectations(t)
+	mockProjector.AssertExpectations(t)
+}
+
+func TestOrderService_SnapshotOrder(t *testing.T) {
+	// Setup
+	service, _, mockEvents, _ := newTestService()
+
+	ctx := context.Background()
+	orderID := "order-123"
+	order := existingOrder(t, orderID)
+	assert.NoError(t, order.Cancel("changed my mind"))
+	order.MarkCommitted()
+
+	var snapshot *domain.Snapshot
+	mockEvents.On("LoadOrder", ctx, orderID).Return(order, nil)
+	mockEvents.On("SaveSnapshot", ctx, order).Run(func(args mock.Arguments) {
+		var err error
+		snapshot, err = args.Get(1).(*domain.Order).Snapshot()
+		assert.NoError(t, err)
+	}).Return(nil)
+
+	// Execute
+	err := service.SnapshotOrder(ctx, orderID)
+
+	// Assert: restoring the snapshot yields the same state at the same version
+	assert.NoError(t, err)
+	assert.Equal(t, domain.OrderSnapshotSchema, snapshot.Schema)
+	restored, err := domain.RestoreOrder(snapshot, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, restored.Version)
+	assert.Equal(t, domain.OrderStatusCancelled, restored.Status)
+	assert.Equal(t, order.Items, restored.Items)
+
+	mockEvents.AssertExpectations(t)
+}
+
+func TestOrderService_MultiSellerOrder(t *testing.T) {
+	// Setup
+	service, mockRepo, mockEvents, mockProjector := newTestService()
+
+	ctx := context.Background()
+	items := []domain.OrderItem{
+		{ProductID: "prod-1", SellerID: "shop-a", Quantity: 2, UnitPrice: 10},
+		{ProductID: "prod-2", SellerID: "shop-b", Quantity: 1, UnitPrice: 25},
+		{ProductID: "prod-3", SellerID: "shop-a", Quantity: 1, UnitPrice: 5},
+	}
+	fees := map[string]float64{"shop-a": 3, "shop-b": 4}
+
+	mockEvents.On("SaveOrder", ctx, mock.AnythingOfType("*domain.Order")).Return(nil)
+	mockProjector.On("Project", ctx, mock.Anything).Return(nil)
+
+	// Execute: one parent, one sub-order per seller, paid once on the parent
+	order, err := service.CreateOrder(ctx, "user-123", items, "123 Test Street", fees)
+	assert.NoError(t, err)
+	assert.NoError(t, order.Confirm())
+	order.MarkCommitted()
+
+	// Assert
+	assert.Len(t, order.SubOrders, 2)
+	shopA, shopB := order.SubOrders[0], order.SubOrders[1]
+	assert.Equal(t, "shop-a", shopA.SellerID)
+	assert.Len(t, shopA.Items, 2)
+	assert.Equal(t, 28.0, shopA.Total)
+	assert.Equal(t, 29.0, shopB.Total)
+	assert.Equal(t, 57.0, order.TotalAmount)
+	assert.Equal(t, domain.OrderStatusConfirmed, shopB.Status)
+
+	mockRepo.On("FindSubOrder", ctx, mock.AnythingOfType("string")).Return(&domain.SubOrder{OrderID: order.ID}, nil)
+	mockEvents.On("LoadOrder", ctx, order.ID).Return(order, nil)
+
+	// Shop A ships; shop B cancels, so the order follows the shipped part
+	_, err = service.UpdateSubOrderStatus(ctx, shopA.ID, domain.OrderStatusProcessing)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.OrderStatusProcessing, order.Status)
+
+	sub, err := service.CancelSubOrder(ctx, shopB.ID, "out of stock")
+	assert.NoError(t, err)
+	assert.Equal(t, domain.OrderStatusCancelled, sub.Status)
+	assert.Equal(t, 29.0, order.CancelledAmount)
+
+	_, err = service.UpdateSubOrderStatus(ctx, shopA.ID, domain.OrderStatusShipped)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.OrderStatusShipped, order.Status)
+
+	// A shipped sub-order can't be cancelled, and neither can the order
+	_, err = service.CancelSubOrder(ctx, shopA.ID, "too late")
+	assert.Error(t, err)
+	_, err = service.CancelOrder(ctx, order.ID, "too late")
+	assert.Error(t, err)
+
+	// Sub-orders survive a snapshot round trip
+	snapshot, err := order.Snapshot()
+	assert.NoError(t, err)
+	restored, err := domain.RestoreOrder(snapshot, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, order.SubOrders, restored.SubOrders)
+	assert.Equal(t, order.Status, restored.Status)
+}
@@ -0,0 +1,233 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+const (
+	DefaultSubscriptionBatchSize    = 100
+	DefaultSubscriptionPollInterval = time.Second
+	DefaultSubscriptionMaxAttempts  = 5
+	DefaultSubscriptionRetryBackoff = 200 * time.Millisecond
+	DefaultSubscriptionLeaseRenewal = 10 * time.Second
+)
+
+// EventHandler handles one event for a subscription. It may be called more
+// than once for the same event and must tolerate that.
+type EventHandler func(ctx context.Context, event domain.RecordedEvent) error
+
+// SubscriptionConfig configures a catch-up subscription
+type SubscriptionConfig struct {
+	Name         string // Durable consumer name; the checkpoint is kept under it
+	StartFrom    domain.StartPosition
+	BatchSize    int
+	PollInterval time.Duration
+	MaxAttempts  int           // Deliveries before an event is parked
+	RetryBackoff time.Duration // Doubled after each failed delivery
+	LeaseRenewal time.Duration // How often a batch in progress renews the lease; well under its TTL
+}
+
+// Subscription delivers the global order event stream to a handler in
+// sequence order, at least once. The checkpoint is stored after each batch
+// and whenever an event is parked, so a restart resumes where it left off and
+// redelivers at most one batch.
+type Subscription struct {
+	cfg         SubscriptionConfig
+	owner       string
+	events      domain.EventStore
+	checkpoints domain.CheckpointStore
+	handler     EventHandler
+	logger      *logger.Logger
+	renewedAt   time.Time // When the lease was last acquired or renewed
+}
+
+// NewSubscription creates a subscription, filling in defaults for unset options
+func NewSubscription(cfg SubscriptionConfig, events domain.EventStore, checkpoints domain.CheckpointStore, handler EventHandler, logger *logger.Logger) *Subscription {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultSubscriptionBatchSize
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultSubscriptionPollInterval
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultSubscriptionMaxAttempts
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DefaultSubscriptionRetryBackoff
+	}
+	if cfg.LeaseRenewal <= 0 {
+		cfg.LeaseRenewal = DefaultSubscriptionLeaseRenewal
+	}
+
+	hostname, _ := os.Hostname()
+	return &Subscription{
+		cfg:         cfg,
+		owner:       fmt.Sprintf("%s-%s", hostname, uuid.New().String()[:8]),
+		events:      events,
+		checkpoints: checkpoints,
+		handler:     handler,
+		logger:      logger,
+	}
+}
+
+// Run delivers events until ctx is cancelled. Only the replica holding the
+// consumer's lease delivers; the others wait to take over.
+func (s *Subscription) Run(ctx context.Context) error {
+	s.logger.Infof("Subscription %s started as %s", s.cfg.Name, s.owner)
+
+	var position int64
+	leased := false
+	defer func() {
+		if leased {
+			if err := s.checkpoints.ReleaseLease(context.WithoutCancel(ctx), s.cfg.Name, s.owner); err != nil {
+				s.logger.Errorf(err, "Subscription %s failed to release lease", s.cfg.Name)
+			}
+		}
+	}()
+
+	for {
+		held, err := s.checkpoints.AcquireLease(ctx, s.cfg.Name, s.owner)
+		if err != nil {
+			s.logger.Errorf(err, "Subscription %s failed to acquire lease", s.cfg.Name)
+		}
+		if err != nil || !held {
+			leased = false
+			if !s.sleep(ctx, s.cfg.PollInterval) {
+				return nil
+			}
+			continue
+		}
+		s.renewedAt = time.Now()
+
+		// Whoever held the lease before may have moved the checkpoint
+		if !leased {
+			if position, err = s.startPosition(ctx); err != nil {
+				s.logger.Errorf(err, "Subscription %s failed to load checkpoint", s.cfg.Name)
+				if !s.sleep(ctx, s.cfg.PollInterval) {
+					return nil
+				}
+				continue
+			}
+			leased = true
+			s.logger.Infof("Subscription %s reading after sequence %d", s.cfg.Name, position)
+		}
+
+		delivered, err := s.deliverBatch(ctx, &position)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			s.logger.Errorf(err, "Subscription %s stopped at sequence %d", s.cfg.Name, position)
+			leased = false
+		}
+		if err != nil || delivered == 0 {
+			if !s.sleep(ctx, s.cfg.PollInterval) {
+				return nil
+			}
+		}
+	}
+}
+
+// startPosition returns the stored checkpoint, creating one at the configured
+// start position for a new consumer
+func (s *Subscription) startPosition(ctx context.Context) (int64, error) {
+	position, found, err := s.checkpoints.LoadCheckpoint(ctx, s.cfg.Name)
+	if err != nil || found {
+		return position, err
+	}
+
+	if s.cfg.StartFrom == domain.StartFromNow {
+		if position, err = s.events.HeadSequence(ctx); err != nil {
+			return 0, err
+		}
+	}
+	return position, s.checkpoints.SaveCheckpoint(ctx, s.cfg.Name, s.owner, position)
+}
+
+// deliverBatch hands the next batch to the handler and checkpoints it. A
+// slow batch could outlive the lease and overlap with a new owner, so the
+// lease is renewed between events and the batch abandoned once it is lost.
+func (s *Subscription) deliverBatch(ctx context.Context, position *int64) (int, error) {
+	batch, err := s.events.ReadAll(ctx, *position, s.cfg.BatchSize)
+	if err != nil || len(batch) == 0 {
+		return 0, err
+	}
+
+	for _, event := range batch {
+		if err := s.renewLease(ctx, *position); err != nil {
+			return 0, err
+		}
+		if err := s.deliver(ctx, event); err != nil {
+			return 0, err
+		}
+		*position = event.Sequence
+	}
+
+	return len(batch), s.checkpoints.SaveCheckpoint(ctx, s.cfg.Name, s.owner, *position)
+}
+
+// renewLease checkpoints the progress made so far once the lease is due for
+// renewal; saving the checkpoint renews the lease, or fails if another owner
+// has taken the consumer over
+func (s *Subscription) renewLease(ctx context.Context, position int64) error {
+	if time.Since(s.renewedAt) < s.cfg.LeaseRenewal {
+		return nil
+	}
+	if err := s.checkpoints.SaveCheckpoint(ctx, s.cfg.Name, s.owner, position); err != nil {
+		return fmt.Errorf("lease renewal failed, abandoning batch: %w", err)
+	}
+	s.renewedAt = time.Now()
+	return nil
+}
+
+// deliver retries the handler with exponential backoff and parks the event
+// once it has failed MaxAttempts times
+func (s *Subscription) deliver(ctx context.Context, event domain.RecordedEvent) error {
+	backoff := s.cfg.RetryBackoff
+
+	var err error
+	for attempt := 1; attempt <= s.cfg.MaxAttempts; attempt++ {
+		if err = s.handler(ctx, event); err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		s.logger.Warnf("Subscription %s failed on sequence %d (attempt %d/%d): %v",
+			s.cfg.Name, event.Sequence, attempt, s.cfg.MaxAttempts, err)
+		if attempt < s.cfg.MaxAttempts {
+			if !s.sleep(ctx, backoff) {
+				return ctx.Err()
+			}
+			backoff *= 2
+		}
+	}
+
+	if err := s.checkpoints.ParkEvent(ctx, s.cfg.Name, event, s.cfg.MaxAttempts, err.Error()); err != nil {
+		return err
+	}
+	s.logger.Warnf("Subscription %s parked %s at sequence %d", s.cfg.Name, event.Event.EventType(), event.Sequence)
+
+	// Checkpoint past the parked event so a restart doesn't park it again
+	return s.checkpoints.SaveCheckpoint(ctx, s.cfg.Name, s.owner, event.Sequence)
+}
+
+// sleep waits for d, returning false if ctx is cancelled first
+func (s *Subscription) sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
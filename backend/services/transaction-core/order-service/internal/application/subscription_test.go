@@ -0,0 +1,238 @@
+package application_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/titan-commerce/backend/order-service/internal/application"
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// streamStore serves a fixed global stream; other EventStore methods are unused
+type streamStore struct {
+	domain.EventStore
+	stream []domain.RecordedEvent
+}
+
+func (s *streamStore) ReadAll(ctx context.Context, afterSequence int64, limit int) ([]domain.RecordedEvent, error) {
+	var batch []domain.RecordedEvent
+	for _, event := range s.stream {
+		if event.Sequence > afterSequence && len(batch) < limit {
+			batch = append(batch, event)
+		}
+	}
+	return batch, nil
+}
+
+func (s *streamStore) HeadSequence(ctx context.Context) (int64, error) {
+	return s.stream[len(s.stream)-1].Sequence, nil
+}
+
+// memoryCheckpoints is an in-memory CheckpointStore
+type memoryCheckpoints struct {
+	mu        sync.Mutex
+	positions map[string]int64
+	parked    []int64
+	stolen    bool // Another owner took the lease over
+}
+
+func (m *memoryCheckpoints) AcquireLease(ctx context.Context, consumer, owner string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !m.stolen, nil
+}
+
+func (m *memoryCheckpoints) ReleaseLease(ctx context.Context, consumer, owner string) error {
+	return nil
+}
+
+func (m *memoryCheckpoints) LoadCheckpoint(ctx context.Context, consumer string) (int64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	position, ok := m.positions[consumer]
+	return position, ok, nil
+}
+
+func (m *memoryCheckpoints) SaveCheckpoint(ctx context.Context, consumer, owner string, sequence int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stolen {
+		return errors.New(errors.ErrConflict, "subscription lease lost")
+	}
+	m.positions[consumer] = sequence
+	return nil
+}
+
+func (m *memoryCheckpoints) ParkEvent(ctx context.Context, consumer string, event domain.RecordedEvent, attempts int, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.parked = append(m.parked, event.Sequence)
+	return nil
+}
+
+func (m *memoryCheckpoints) position(consumer string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.positions[consumer]
+}
+
+func testStream(n int) *streamStore {
+	store := &streamStore{}
+	for i := 1; i <= n; i++ {
+		orderID := fmt.Sprintf("order-%d", i)
+		store.stream = append(store.stream, domain.RecordedEvent{
+			Sequence: int64(i * 10), AggregateID: orderID, Version: 1, Event: createdEvent(orderID),
+		})
+	}
+	return store
+}
+
+// runUntil runs the subscription until the consumer's checkpoint reaches target
+func runUntil(t *testing.T, sub *application.Subscription, checkpoints *memoryCheckpoints, consumer string, target int64) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sub.Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return checkpoints.position(consumer) >= target }, 2*time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+}
+
+func TestSubscription_RetriesAndParksPoisonEvents(t *testing.T) {
+	// Setup
+	store := testStream(3)
+	checkpoints := &memoryCheckpoints{positions: map[string]int64{}}
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+
+	var mu sync.Mutex
+	var delivered []int64
+	attempts := map[int64]int{}
+	handler := func(ctx context.Context, event domain.RecordedEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[event.Sequence]++
+		if event.Sequence == 20 {
+			return fmt.Errorf("poison")
+		}
+		if event.Sequence == 30 && attempts[30] == 1 {
+			return fmt.Errorf("transient")
+		}
+		delivered = append(delivered, event.Sequence)
+		return nil
+	}
+
+	sub := application.NewSubscription(application.SubscriptionConfig{
+		Name:         "test",
+		MaxAttempts:  3,
+		RetryBackoff: time.Millisecond,
+		PollInterval: 5 * time.Millisecond,
+	}, store, checkpoints, handler, log)
+
+	// Execute
+	runUntil(t, sub, checkpoints, "test", 30)
+
+	// Assert: in order, the poison event parked after 3 attempts, the
+	// transient failure retried
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []int64{10, 30}, delivered)
+	assert.Equal(t, 3, attempts[20])
+	assert.Equal(t, 2, attempts[30])
+	assert.Equal(t, []int64{20}, checkpoints.parked)
+}
+
+func TestSubscription_StartPositions(t *testing.T) {
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+
+	tests := []struct {
+		name      string
+		startFrom domain.StartPosition
+		stored    map[string]int64
+		want      []int64
+	}{
+		{name: "from beginning", startFrom: domain.StartFromBeginning, stored: map[string]int64{}, want: []int64{10, 20, 30, 40}},
+		{name: "resumes from checkpoint", startFrom: domain.StartFromBeginning, stored: map[string]int64{"test": 20}, want: []int64{30, 40}},
+		{name: "from now", startFrom: domain.StartFromNow, stored: map[string]int64{}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := testStream(4)
+			checkpoints := &memoryCheckpoints{positions: tt.stored}
+
+			var mu sync.Mutex
+			var delivered []int64
+			sub := application.NewSubscription(application.SubscriptionConfig{
+				Name:         "test",
+				StartFrom:    tt.startFrom,
+				PollInterval: 5 * time.Millisecond,
+			}, store, checkpoints, func(ctx context.Context, event domain.RecordedEvent) error {
+				mu.Lock()
+				defer mu.Unlock()
+				delivered = append(delivered, event.Sequence)
+				return nil
+			}, log)
+
+			runUntil(t, sub, checkpoints, "test", 40)
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, tt.want, delivered)
+		})
+	}
+}
+
+func TestSubscription_AbandonsBatchWhenLeaseIsLost(t *testing.T) {
+	// Setup
+	store := testStream(4)
+	checkpoints := &memoryCheckpoints{positions: map[string]int64{}}
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+
+	var mu sync.Mutex
+	var delivered []int64
+	handler := func(ctx context.Context, event domain.RecordedEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		delivered = append(delivered, event.Sequence)
+		if event.Sequence == 20 {
+			// Slow enough for the lease to expire and move to another replica
+			checkpoints.mu.Lock()
+			checkpoints.stolen = true
+			checkpoints.mu.Unlock()
+		}
+		return nil
+	}
+
+	sub := application.NewSubscription(application.SubscriptionConfig{
+		Name:         "test",
+		PollInterval: 5 * time.Millisecond,
+		LeaseRenewal: time.Nanosecond,
+	}, store, checkpoints, handler, log)
+
+	// Execute
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sub.Run(ctx)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	// Assert: nothing delivered after the lease was lost; progress up to the
+	// last renewal was kept
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []int64{10, 20}, delivered)
+	assert.Equal(t, int64(10), checkpoints.position("test"))
+}
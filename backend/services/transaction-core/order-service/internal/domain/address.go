@@ -0,0 +1,27 @@
+package domain
+
+import "strings"
+
+// Shipping addresses are free text of comma-separated parts, most specific
+// first, e.g. "1 Main St, Austin, TX, US".
+
+// ShippingCountry extracts the country from a free-text shipping address,
+// taken as its last comma-separated part. Addresses without a comma have no
+// recognisable country.
+func ShippingCountry(address string) string {
+	i := strings.LastIndex(address, ",")
+	if i < 0 {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimSpace(address[i+1:]))
+}
+
+// ShippingRegion extracts the region from a free-text shipping address, taken
+// as the part before the country when there are at least three parts
+func ShippingRegion(address string) string {
+	parts := strings.Split(address, ",")
+	if len(parts) < 3 {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimSpace(parts[len(parts)-2]))
+}
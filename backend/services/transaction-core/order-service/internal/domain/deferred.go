@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+// DeferredEvent is a payment or shipping event an order could not take yet:
+// a shipment reported before the payment, or an event that kept losing the
+// race with other changes to the order. It is kept and applied again later
+// rather than dropped.
+type DeferredEvent struct {
+	ID            string
+	Kind          string // PaymentCompleted, ShipmentCreated or ShipmentDelivered
+	OrderID       string
+	Payload       []byte // The event as JSON
+	Attempts      int    // Retries so far
+	LastError     string
+	CreatedAt     time.Time
+	NextAttemptAt time.Time
+}
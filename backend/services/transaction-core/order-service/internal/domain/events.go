@@ -1,6 +1,8 @@
 package domain
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -8,10 +10,16 @@ import (
 type EventType string
 
 const (
-	EventTypeOrderCreated       EventType = "order.created"
-	EventTypeOrderConfirmed     EventType = "order.confirmed"
-	EventTypeOrderCancelled     EventType = "order.cancelled"
-	EventTypeOrderStatusUpdated EventType = "order.status.updated"
+	EventTypeOrderCreated       EventType = "OrderCreated"
+	EventTypeOrderConfirmed     EventType = "OrderConfirmed"
+	EventTypeOrderPaid          EventType = "OrderPaid"
+	EventTypeOrderShipped       EventType = "OrderShipped"
+	EventTypeOrderCompleted     EventType = "OrderCompleted"
+	EventTypeOrderCancelled     EventType = "OrderCancelled"
+	EventTypeOrderStatusChanged EventType = "OrderStatusChanged"
+
+	EventTypeSubOrderStatusChanged EventType = "SubOrderStatusChanged"
+	EventTypeSubOrderCancelled     EventType = "SubOrderCancelled"
 )
 
 // DomainEvent interface for all domain events
@@ -20,45 +28,84 @@ type DomainEvent interface {
 	OccurredAt() time.Time
 }
 
-// OrderEvent represents a domain event
-type OrderEvent struct {
-	ID          string
-	AggregateID string // Order ID
-	Type        EventType
-	Data        map[string]interface{}
-	UserID      string
-	Timestamp   time.Time
-	Version     int
+// RecordedEvent is a domain event as stored in the event stream
+type RecordedEvent struct {
+	Sequence    int64 // Global position in the event store
+	AggregateID string
+	Version     int // Position within the aggregate's stream
+	Event       DomainEvent
 }
 
-// NewOrderCreatedEvent creates an order created event
-func NewOrderCreatedEvent(order *Order) *OrderEvent {
-	return &OrderEvent{
-		AggregateID: order.ID,
-		Type:        EventTypeOrderCreated,
-		Data: map[string]interface{}{
-			"user_id":          order.UserID,
-			"total_amount":     order.TotalAmount,
-			"shipping_address": order.ShippingAddress,
-			"items_count":      len(order.Items),
-		},
-		UserID:    order.UserID,
-		Timestamp: order.CreatedAt,
-		Version:   order.Version,
+// NewRecordedEvents wraps events appended to an aggregate at expectedVersion
+func NewRecordedEvents(aggregateID string, events []DomainEvent, expectedVersion int) []RecordedEvent {
+	records := make([]RecordedEvent, len(events))
+	for i, event := range events {
+		records[i] = RecordedEvent{
+			AggregateID: aggregateID,
+			Version:     expectedVersion + i + 1,
+			Event:       event,
+		}
 	}
+	return records
 }
 
-// OrderCreatedEvent for eventstore deserialization
+// DecodeEvent deserializes a stored event by its type name. Every event the
+// aggregate raises must be listed here so it can be replayed.
+func DecodeEvent(eventType string, data []byte) (DomainEvent, error) {
+	var event DomainEvent
+	switch EventType(eventType) {
+	case EventTypeOrderCreated:
+		event = &OrderCreatedEvent{}
+	case EventTypeOrderConfirmed:
+		event = &OrderConfirmedEvent{}
+	case EventTypeOrderPaid:
+		event = &OrderPaidEvent{}
+	case EventTypeOrderShipped:
+		event = &OrderShippedEvent{}
+	case EventTypeOrderCompleted:
+		event = &OrderCompletedEvent{}
+	case EventTypeOrderCancelled:
+		event = &OrderCancelledEvent{}
+	case EventTypeOrderStatusChanged:
+		event = &OrderStatusChangedEvent{}
+	case EventTypeSubOrderStatusChanged:
+		event = &SubOrderStatusChangedEvent{}
+	case EventTypeSubOrderCancelled:
+		event = &SubOrderCancelledEvent{}
+	default:
+		return nil, fmt.Errorf("unknown event type: %s", eventType)
+	}
+
+	if err := json.Unmarshal(data, event); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", eventType, err)
+	}
+	return event, nil
+}
+
+// OrderCreatedEvent carries everything needed to rebuild a new order
 type OrderCreatedEvent struct {
-	OrderID   string    `json:"order_id"`
-	UserID    string    `json:"user_id"`
-	Total     float64   `json:"total"`
-	CreatedAt time.Time `json:"created_at"`
+	OrderID         string      `json:"order_id"`
+	UserID          string      `json:"user_id"`
+	Items           []OrderItem `json:"items"`
+	SubOrders       []SubOrder  `json:"sub_orders,omitempty"`
+	Tax             *TaxSummary `json:"tax,omitempty"`
+	Total           float64     `json:"total"`
+	ShippingAddress string      `json:"shipping_address"`
+	CreatedAt       time.Time   `json:"created_at"`
 }
 
-func (e *OrderCreatedEvent) EventType() string    { return "OrderCreated" }
+func (e *OrderCreatedEvent) EventType() string     { return string(EventTypeOrderCreated) }
 func (e *OrderCreatedEvent) OccurredAt() time.Time { return e.CreatedAt }
 
+// OrderConfirmedEvent
+type OrderConfirmedEvent struct {
+	OrderID     string    `json:"order_id"`
+	ConfirmedAt time.Time `json:"confirmed_at"`
+}
+
+func (e *OrderConfirmedEvent) EventType() string     { return string(EventTypeOrderConfirmed) }
+func (e *OrderConfirmedEvent) OccurredAt() time.Time { return e.ConfirmedAt }
+
 // OrderPaidEvent
 type OrderPaidEvent struct {
 	OrderID   string    `json:"order_id"`
@@ -67,7 +114,7 @@ type OrderPaidEvent struct {
 	PaidAt    time.Time `json:"paid_at"`
 }
 
-func (e *OrderPaidEvent) EventType() string    { return "OrderPaid" }
+func (e *OrderPaidEvent) EventType() string     { return string(EventTypeOrderPaid) }
 func (e *OrderPaidEvent) OccurredAt() time.Time { return e.PaidAt }
 
 // OrderShippedEvent
@@ -77,7 +124,7 @@ type OrderShippedEvent struct {
 	ShippedAt  time.Time `json:"shipped_at"`
 }
 
-func (e *OrderShippedEvent) EventType() string    { return "OrderShipped" }
+func (e *OrderShippedEvent) EventType() string     { return string(EventTypeOrderShipped) }
 func (e *OrderShippedEvent) OccurredAt() time.Time { return e.ShippedAt }
 
 // OrderCompletedEvent
@@ -86,7 +133,7 @@ type OrderCompletedEvent struct {
 	CompletedAt time.Time `json:"completed_at"`
 }
 
-func (e *OrderCompletedEvent) EventType() string    { return "OrderCompleted" }
+func (e *OrderCompletedEvent) EventType() string     { return string(EventTypeOrderCompleted) }
 func (e *OrderCompletedEvent) OccurredAt() time.Time { return e.CompletedAt }
 
 // OrderCancelledEvent
@@ -96,5 +143,47 @@ type OrderCancelledEvent struct {
 	CancelledAt time.Time `json:"cancelled_at"`
 }
 
-func (e *OrderCancelledEvent) EventType() string    { return "OrderCancelled" }
+func (e *OrderCancelledEvent) EventType() string     { return string(EventTypeOrderCancelled) }
 func (e *OrderCancelledEvent) OccurredAt() time.Time { return e.CancelledAt }
+
+// OrderStatusChangedEvent records a status transition made through UpdateStatus
+type OrderStatusChangedEvent struct {
+	OrderID   string      `json:"order_id"`
+	From      OrderStatus `json:"from"`
+	To        OrderStatus `json:"to"`
+	ChangedAt time.Time   `json:"changed_at"`
+}
+
+func (e *OrderStatusChangedEvent) EventType() string     { return string(EventTypeOrderStatusChanged) }
+func (e *OrderStatusChangedEvent) OccurredAt() time.Time { return e.ChangedAt }
+
+// SubOrderStatusChangedEvent records one seller's sub-order moving along its
+// lifecycle. OrderStatus is the parent's status after the change.
+type SubOrderStatusChangedEvent struct {
+	OrderID     string      `json:"order_id"`
+	SubOrderID  string      `json:"sub_order_id"`
+	From        OrderStatus `json:"from"`
+	To          OrderStatus `json:"to"`
+	OrderStatus OrderStatus `json:"order_status"`
+	ChangedAt   time.Time   `json:"changed_at"`
+}
+
+func (e *SubOrderStatusChangedEvent) EventType() string {
+	return string(EventTypeSubOrderStatusChanged)
+}
+func (e *SubOrderStatusChangedEvent) OccurredAt() time.Time { return e.ChangedAt }
+
+// SubOrderCancelledEvent records one seller's sub-order being cancelled.
+// Amount is what the buyer is owed back from the parent's payment.
+type SubOrderCancelledEvent struct {
+	OrderID     string      `json:"order_id"`
+	SubOrderID  string      `json:"sub_order_id"`
+	SellerID    string      `json:"seller_id"`
+	Reason      string      `json:"reason"`
+	Amount      float64     `json:"amount"`
+	OrderStatus OrderStatus `json:"order_status"`
+	CancelledAt time.Time   `json:"cancelled_at"`
+}
+
+func (e *SubOrderCancelledEvent) EventType() string     { return string(EventTypeSubOrderCancelled) }
+func (e *SubOrderCancelledEvent) OccurredAt() time.Time { return e.CancelledAt }
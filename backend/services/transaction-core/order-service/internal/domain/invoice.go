@@ -0,0 +1,320 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// InvoiceKind tells invoices from the credit notes that reverse them
+type InvoiceKind string
+
+const (
+	InvoiceKindInvoice    InvoiceKind = "INVOICE"
+	InvoiceKindCreditNote InvoiceKind = "CREDIT_NOTE"
+)
+
+// ShippingLineID is the product ID of the line carrying a seller's shipping fee
+const ShippingLineID = "shipping"
+
+// InvoiceLine is one billed product, or a seller's shipping fee. Amounts are
+// in cents and Net + Tax = Gross.
+type InvoiceLine struct {
+	ProductID   string  `json:"product_id"`
+	SellerID    string  `json:"seller_id"`
+	Description string  `json:"description"`
+	Quantity    int     `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"` // Listed price
+	TaxRate     float64 `json:"tax_rate"`
+	Net         float64 `json:"net"`
+	Tax         float64 `json:"tax"`
+	Gross       float64 `json:"gross"`
+	InvoiceLine int     `json:"invoice_line,omitempty"` // Credit notes: index of the credited invoice line
+}
+
+// Invoice is the billing document for an order, or a credit note reversing
+// part of one. Amounts on credit notes are positive; the kind says they are
+// credited. Number is assigned from a gapless series when it is saved.
+type Invoice struct {
+	ID             string
+	Number         string
+	Kind           InvoiceKind
+	OrderID        string
+	UserID         string
+	InvoiceID      string // Credit notes: the invoice being credited
+	Reference      string // Unique per document, so issuing is idempotent
+	Reason         string
+	BillingAddress string
+	Country        string
+	Region         string
+	Pricing        PricingMode
+	Lines          []InvoiceLine
+	Net            float64
+	Tax            float64
+	Gross          float64
+	IssuedAt       time.Time
+}
+
+// CreditPick selects units of an invoiced product to credit. Quantity 0
+// credits everything not credited yet.
+type CreditPick struct {
+	ProductID string
+	SellerID  string
+	Quantity  int
+}
+
+// InvoiceReference is the reference of an order's invoice; an order has one
+func InvoiceReference(orderID string) string {
+	return "invoice:" + orderID
+}
+
+// Invoiceable reports whether the order has been paid for and not cancelled
+func (o *Order) Invoiceable() bool {
+	return o.Status != OrderStatusPending && o.Status != OrderStatusCancelled
+}
+
+// NewInvoice bills a paid order. Cancelled sub-orders are left off, and the
+// tax on each line is rounded so the lines add up to the tax charged.
+func NewInvoice(order *Order, now time.Time) (*Invoice, error) {
+	if !order.Invoiceable() {
+		return nil, errors.New(errors.ErrInvalidInput, "only paid orders that are not cancelled can be invoiced")
+	}
+
+	cancelled := make(map[string]bool)
+	for _, sub := range order.SubOrders {
+		if sub.Status == OrderStatusCancelled {
+			cancelled[sub.SellerID] = true
+		}
+	}
+
+	inv := &Invoice{
+		ID:             uuid.New().String(),
+		Kind:           InvoiceKindInvoice,
+		OrderID:        order.ID,
+		UserID:         order.UserID,
+		Reference:      InvoiceReference(order.ID),
+		BillingAddress: order.ShippingAddress,
+		Country:        ShippingCountry(order.ShippingAddress),
+		Region:         ShippingRegion(order.ShippingAddress),
+		Pricing:        PricingTaxExclusive,
+		IssuedAt:       now,
+	}
+	if order.Tax != nil {
+		inv.Country, inv.Region, inv.Pricing = order.Tax.Country, order.Tax.Region, order.Tax.Pricing
+	}
+
+	// Tax lines were calculated item by item, so they line up with Items
+	var rawTax []float64
+	var taxTotal float64
+	for i, item := range order.Items {
+		if cancelled[item.SellerID] {
+			continue
+		}
+		line := InvoiceLine{
+			ProductID:   item.ProductID,
+			SellerID:    item.SellerID,
+			Description: item.ProductName,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+		}
+		var tax float64
+		if order.Tax != nil && i < len(order.Tax.Lines) {
+			line.TaxRate = order.Tax.Lines[i].Rate
+			tax = order.Tax.Lines[i].Tax
+		}
+		inv.Lines = append(inv.Lines, line)
+		rawTax = append(rawTax, tax)
+	}
+	if len(inv.Lines) == 0 {
+		return nil, errors.New(errors.ErrInvalidInput, "order has nothing left to invoice")
+	}
+
+	for _, sub := range order.SubOrders {
+		if !cancelled[sub.SellerID] {
+			taxTotal += sub.TaxAmount
+		}
+	}
+	for i, tax := range allocateCents(rawTax, taxTotal) {
+		line := &inv.Lines[i]
+		amount := RoundCents(float64(line.Quantity) * line.UnitPrice)
+		line.Tax = tax
+		if inv.Pricing == PricingTaxInclusive {
+			line.Gross, line.Net = amount, RoundCents(amount-tax)
+		} else {
+			line.Net, line.Gross = amount, RoundCents(amount+tax)
+		}
+	}
+
+	// Shipping is billed per seller and is not taxed
+	for _, sub := range order.SubOrders {
+		if cancelled[sub.SellerID] || sub.ShippingFee == 0 {
+			continue
+		}
+		inv.Lines = append(inv.Lines, InvoiceLine{
+			ProductID:   ShippingLineID,
+			SellerID:    sub.SellerID,
+			Description: "Shipping",
+			Quantity:    1,
+			UnitPrice:   sub.ShippingFee,
+			Net:         sub.ShippingFee,
+			Gross:       sub.ShippingFee,
+		})
+	}
+
+	inv.total()
+	return inv, nil
+}
+
+// NewCreditNote credits units of an invoice. notes are the credit notes
+// already issued against it, which bound what is left to credit. Partially
+// credited lines are credited pro rata; the last units of a line take
+// whatever remains, so a fully credited line always nets to zero. No picks
+// credits everything left.
+func NewCreditNote(invoice *Invoice, notes []*Invoice, picks []CreditPick, reference, reason string, now time.Time) (*Invoice, error) {
+	if invoice.Kind != InvoiceKindInvoice {
+		return nil, errors.New(errors.ErrInvalidInput, "only invoices can be credited")
+	}
+
+	credited := creditedLines(notes)
+	if len(picks) == 0 {
+		for _, line := range invoice.Lines {
+			picks = append(picks, CreditPick{ProductID: line.ProductID, SellerID: line.SellerID})
+		}
+	}
+
+	note := &Invoice{
+		ID:             uuid.New().String(),
+		Kind:           InvoiceKindCreditNote,
+		OrderID:        invoice.OrderID,
+		UserID:         invoice.UserID,
+		InvoiceID:      invoice.ID,
+		Reference:      reference,
+		Reason:         reason,
+		BillingAddress: invoice.BillingAddress,
+		Country:        invoice.Country,
+		Region:         invoice.Region,
+		Pricing:        invoice.Pricing,
+		IssuedAt:       now,
+	}
+
+	for _, pick := range picks {
+		if pick.Quantity < 0 {
+			return nil, errors.New(errors.ErrInvalidInput, "credited quantity cannot be negative")
+		}
+
+		want := pick.Quantity
+		for i, line := range invoice.Lines {
+			if line.ProductID != pick.ProductID || line.SellerID != pick.SellerID {
+				continue
+			}
+			done := credited[i]
+			left := line.Quantity - done.Quantity
+			take := left
+			if pick.Quantity > 0 && want < take {
+				take = want
+			}
+			if take <= 0 {
+				continue
+			}
+
+			creditLine := InvoiceLine{
+				ProductID:   line.ProductID,
+				SellerID:    line.SellerID,
+				Description: line.Description,
+				Quantity:    take,
+				UnitPrice:   line.UnitPrice,
+				TaxRate:     line.TaxRate,
+				InvoiceLine: i,
+			}
+			if take == left {
+				creditLine.Net = RoundCents(line.Net - done.Net)
+				creditLine.Tax = RoundCents(line.Tax - done.Tax)
+			} else {
+				share := float64(take) / float64(line.Quantity)
+				creditLine.Net = RoundCents(line.Net * share)
+				creditLine.Tax = RoundCents(line.Tax * share)
+			}
+			creditLine.Gross = RoundCents(creditLine.Net + creditLine.Tax)
+			note.Lines = append(note.Lines, creditLine)
+
+			done.Quantity += take
+			done.Net += creditLine.Net
+			done.Tax += creditLine.Tax
+			credited[i] = done
+			want -= take
+		}
+		if pick.Quantity > 0 && want > 0 {
+			return nil, errors.New(errors.ErrInvalidInput,
+				fmt.Sprintf("cannot credit more of %s than was invoiced", pick.ProductID))
+		}
+	}
+
+	if len(note.Lines) == 0 {
+		return nil, errors.New(errors.ErrInvalidInput, "nothing left to credit on invoice")
+	}
+	note.total()
+	return note, nil
+}
+
+// Outstanding reports whether notes leave any line of the invoice not fully
+// credited, counting only one seller's lines if sellerID is set
+func (inv *Invoice) Outstanding(notes []*Invoice, sellerID string) bool {
+	credited := creditedLines(notes)
+	for i, line := range inv.Lines {
+		if sellerID != "" && line.SellerID != sellerID {
+			continue
+		}
+		if credited[i].Quantity < line.Quantity {
+			return true
+		}
+	}
+	return false
+}
+
+// Series is the numbering series of the document, restarted every year
+func (inv *Invoice) Series() string {
+	prefix := "INV"
+	if inv.Kind == InvoiceKindCreditNote {
+		prefix = "CN"
+	}
+	return fmt.Sprintf("%s-%d", prefix, inv.IssuedAt.UTC().Year())
+}
+
+// AssignNumber numbers the document as the nth of its series
+func (inv *Invoice) AssignNumber(n int64) {
+	inv.Number = fmt.Sprintf("%s-%06d", inv.Series(), n)
+}
+
+func (inv *Invoice) total() {
+	var net, tax float64
+	for _, line := range inv.Lines {
+		net += line.Net
+		tax += line.Tax
+	}
+	inv.Net = RoundCents(net)
+	inv.Tax = RoundCents(tax)
+	inv.Gross = RoundCents(net + tax)
+}
+
+type creditedLine struct {
+	Quantity int
+	Net      float64
+	Tax      float64
+}
+
+// creditedLines sums what notes have credited per invoice line
+func creditedLines(notes []*Invoice) map[int]creditedLine {
+	credited := make(map[int]creditedLine)
+	for _, note := range notes {
+		for _, line := range note.Lines {
+			done := credited[line.InvoiceLine]
+			done.Quantity += line.Quantity
+			done.Net += line.Net
+			done.Tax += line.Tax
+			credited[line.InvoiceLine] = done
+		}
+	}
+	return credited
+}
@@ -24,12 +24,15 @@ const (
 type OrderItem struct {
 	ProductID   string
 	ProductName string
+	SellerID    string
+	TaxCategory string // Selects the tax rule, e.g. "food" or "books"; empty for the standard rate
 	Quantity    int
 	UnitPrice   float64
 	Subtotal    float64
 }
 
-// Order is the aggregate root for order domain
+// Order is the aggregate root for order domain. Its state is derived only by
+// applying events; commands validate, then raise the event that records the change.
 type Order struct {
 	ID              string
 	UserID          string
@@ -37,13 +40,22 @@ type Order struct {
 	TotalAmount     float64
 	Status          OrderStatus
 	ShippingAddress string
+	SubOrders       []SubOrder  // One per seller; payment stays on the parent
+	CancelledAmount float64     // Total of cancelled sub-orders, owed back to the buyer if paid
+	Tax             *TaxSummary // Tax on the items; nil for orders placed without a tax engine
+	PaymentID       string      // Payment that paid the order; empty if it was confirmed without one
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
-	Version         int // For optimistic locking
+	DeliveredAt     time.Time // When the whole order was delivered; zero until then
+	Version         int       // Number of events applied, used for optimistic locking
+
+	changes []DomainEvent
 }
 
-// NewOrder creates a new order (Factory method)
-func NewOrder(userID string, items []OrderItem, shippingAddress string) (*Order, error) {
+// NewOrder creates a new order (Factory method). Items are split into one
+// sub-order per seller; shippingFees holds each seller's shipping charge.
+// Tax is calculated for the shipping address when taxes is set.
+func NewOrder(userID string, items []OrderItem, shippingAddress string, shippingFees map[string]float64, taxes *TaxEngine) (*Order, error) {
 	if userID == "" {
 		return nil, errors.New(errors.ErrInvalidInput, "user ID is required")
 	}
@@ -64,21 +76,51 @@ func NewOrder(userID string, items []OrderItem, shippingAddress string) (*Order,
 			return nil, errors.New(errors.ErrInvalidInput, "item unit price must be positive")
 		}
 		items[i].Subtotal = float64(item.Quantity) * item.UnitPrice
-		total += items[i].Subtotal
 	}
 
-	now := time.Now()
-	return &Order{
-		ID:              uuid.New().String(),
+	var tax *TaxSummary
+	if taxes != nil {
+		tax = taxes.Calculate(ShippingCountry(shippingAddress), ShippingRegion(shippingAddress), items)
+	}
+
+	orderID := uuid.New().String()
+	subOrders, err := splitBySeller(orderID, items, shippingFees, tax)
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range subOrders {
+		total += sub.Total
+	}
+	total = RoundCents(total)
+
+	order := &Order{}
+	order.raise(&OrderCreatedEvent{
+		OrderID:         orderID,
 		UserID:          userID,
 		Items:           items,
-		TotalAmount:     total,
-		Status:          OrderStatusPending,
+		SubOrders:       subOrders,
+		Tax:             tax,
+		Total:           total,
 		ShippingAddress: shippingAddress,
-		CreatedAt:       now,
-		UpdatedAt:       now,
-		Version:         1,
-	}, nil
+		CreatedAt:       time.Now(),
+	})
+	return order, nil
+}
+
+// RehydrateOrder rebuilds an order by replaying its event stream
+func RehydrateOrder(events []DomainEvent) (*Order, error) {
+	if len(events) == 0 {
+		return nil, errors.New(errors.ErrNotFound, "order not found")
+	}
+	if _, ok := events[0].(*OrderCreatedEvent); !ok {
+		return nil, errors.New(errors.ErrInternal, "order stream must start with OrderCreated")
+	}
+
+	order := &Order{}
+	for _, event := range events {
+		order.apply(event)
+	}
+	return order, nil
 }
 
 // Confirm transitions order to confirmed status
@@ -86,53 +128,182 @@ func (o *Order) Confirm() error {
 	if o.Status != OrderStatusPending {
 		return errors.New(errors.ErrInvalidInput, "only pending orders can be confirmed")
 	}
-	o.Status = OrderStatusConfirmed
-	o.UpdatedAt = time.Now()
-	o.Version++
+	o.raise(&OrderConfirmedEvent{OrderID: o.ID, ConfirmedAt: time.Now()})
+	return nil
+}
+
+// Pay records the payment for the order, confirming it. The amount must
+// match what is owed for the sub-orders that are still open.
+func (o *Order) Pay(paymentID string, amount float64) error {
+	if paymentID == "" {
+		return errors.New(errors.ErrInvalidInput, "payment ID is required")
+	}
+	if err := checkTransition(o.Status, OrderStatusConfirmed); err != nil {
+		return err
+	}
+	if RoundCents(amount) != RoundCents(o.TotalAmount-o.CancelledAmount) {
+		return errors.New(errors.ErrInvalidInput, "payment amount does not match order total")
+	}
+	o.raise(&OrderPaidEvent{OrderID: o.ID, PaymentID: paymentID, Amount: amount, PaidAt: time.Now()})
+	return nil
+}
+
+// Ship records that the whole order has been handed to the carrier
+func (o *Order) Ship(trackingNo string) error {
+	if err := checkTransition(o.Status, OrderStatusShipped); err != nil {
+		return err
+	}
+	o.raise(&OrderShippedEvent{OrderID: o.ID, TrackingNo: trackingNo, ShippedAt: time.Now()})
 	return nil
 }
 
-// Cancel cancels the order
+// Cancel cancels the order and every sub-order still open
 func (o *Order) Cancel(reason string) error {
 	if o.Status == OrderStatusDelivered || o.Status == OrderStatusCancelled {
 		return errors.New(errors.ErrOrderNotCancellable, "order cannot be cancelled")
 	}
-	o.Status = OrderStatusCancelled
-	o.UpdatedAt = time.Now()
-	o.Version++
+	for _, sub := range o.SubOrders {
+		if sub.Status == OrderStatusShipped || sub.Status == OrderStatusDelivered {
+			return errors.New(errors.ErrOrderNotCancellable, "order has shipped sub-orders; cancel the others individually")
+		}
+	}
+	o.raise(&OrderCancelledEvent{OrderID: o.ID, Reason: reason, CancelledAt: time.Now()})
 	return nil
 }
 
-// UpdateStatus updates the order status
-func (o *Order) UpdateStatus(newStatus OrderStatus) error {
-	// Validate status transitions
-	validTransitions := map[OrderStatus][]OrderStatus{
-		OrderStatusPending:    {OrderStatusConfirmed, OrderStatusCancelled},
-		OrderStatusConfirmed:  {OrderStatusProcessing, OrderStatusCancelled},
-		OrderStatusProcessing: {OrderStatusShipped, OrderStatusCancelled},
-		OrderStatusShipped:    {OrderStatusDelivered},
-		OrderStatusDelivered:  {OrderStatusRefunded},
-	}
+// validTransitions lists the status changes allowed for orders and sub-orders
+var validTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:    {OrderStatusConfirmed, OrderStatusCancelled},
+	OrderStatusConfirmed:  {OrderStatusProcessing, OrderStatusCancelled},
+	OrderStatusProcessing: {OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusShipped:    {OrderStatusDelivered},
+	OrderStatusDelivered:  {OrderStatusRefunded},
+}
 
-	allowedStatuses, ok := validTransitions[o.Status]
+// checkTransition validates a status change against validTransitions
+func checkTransition(from, to OrderStatus) error {
+	allowedStatuses, ok := validTransitions[from]
 	if !ok {
 		return errors.New(errors.ErrInvalidInput, "no valid transitions from current status")
 	}
 
-	isValid := false
 	for _, allowed := range allowedStatuses {
-		if newStatus == allowed {
-			isValid = true
-			break
+		if to == allowed {
+			return nil
 		}
 	}
+	return errors.New(errors.ErrInvalidInput, "invalid status transition")
+}
 
-	if !isValid {
-		return errors.New(errors.ErrInvalidInput, "invalid status transition")
+// UpdateStatus updates the order status. Open sub-orders move with it.
+func (o *Order) UpdateStatus(newStatus OrderStatus) error {
+	if err := checkTransition(o.Status, newStatus); err != nil {
+		return err
 	}
 
-	o.Status = newStatus
-	o.UpdatedAt = time.Now()
-	o.Version++
+	o.raise(&OrderStatusChangedEvent{OrderID: o.ID, From: o.Status, To: newStatus, ChangedAt: time.Now()})
 	return nil
 }
+
+// UncommittedEvents returns the events raised since the order was loaded
+func (o *Order) UncommittedEvents() []DomainEvent {
+	return o.changes
+}
+
+// ExpectedVersion is the stream version the uncommitted events must be
+// appended after
+func (o *Order) ExpectedVersion() int {
+	return o.Version - len(o.changes)
+}
+
+// MarkCommitted clears the uncommitted events once they are stored
+func (o *Order) MarkCommitted() {
+	o.changes = nil
+}
+
+func (o *Order) raise(event DomainEvent) {
+	o.apply(event)
+	o.changes = append(o.changes, event)
+}
+
+// apply mutates state from an event. It must never fail or validate, since
+// it also runs when replaying events that were accepted in the past.
+func (o *Order) apply(event DomainEvent) {
+	switch e := event.(type) {
+	case *OrderCreatedEvent:
+		o.ID = e.OrderID
+		o.UserID = e.UserID
+		o.Items = e.Items
+		o.SubOrders = append([]SubOrder(nil), e.SubOrders...)
+		o.Tax = e.Tax
+		o.TotalAmount = e.Total
+		o.ShippingAddress = e.ShippingAddress
+		o.CreatedAt = e.CreatedAt
+	case *SubOrderStatusChangedEvent:
+		sub := o.subOrder(e.SubOrderID)
+		sub.Status = e.To
+		if e.To == OrderStatusDelivered {
+			sub.DeliveredAt = e.ChangedAt
+		}
+	case *SubOrderCancelledEvent:
+		o.subOrder(e.SubOrderID).Status = OrderStatusCancelled
+		o.CancelledAmount += e.Amount
+	case *OrderPaidEvent:
+		o.PaymentID = e.PaymentID
+	}
+
+	if status, ok := StatusAfter(event); ok {
+		o.Status = status
+		if CascadesToSubOrders(event) {
+			for i := range o.SubOrders {
+				if o.SubOrders[i].Status != OrderStatusCancelled {
+					o.SubOrders[i].Status = status
+					if status == OrderStatusDelivered && o.SubOrders[i].DeliveredAt.IsZero() {
+						o.SubOrders[i].DeliveredAt = event.OccurredAt()
+					}
+				}
+			}
+		}
+		if status == OrderStatusDelivered && o.DeliveredAt.IsZero() {
+			o.DeliveredAt = event.OccurredAt()
+		}
+	}
+	o.UpdatedAt = event.OccurredAt()
+	o.Version++
+}
+
+// StatusAfter returns the order status an event leaves the order in. The
+// aggregate and the read model projection both derive status from it.
+func StatusAfter(event DomainEvent) (OrderStatus, bool) {
+	switch e := event.(type) {
+	case *OrderCreatedEvent:
+		return OrderStatusPending, true
+	case *OrderConfirmedEvent, *OrderPaidEvent:
+		return OrderStatusConfirmed, true
+	case *OrderShippedEvent:
+		return OrderStatusShipped, true
+	case *OrderCompletedEvent:
+		return OrderStatusDelivered, true
+	case *OrderCancelledEvent:
+		return OrderStatusCancelled, true
+	case *OrderStatusChangedEvent:
+		return e.To, true
+	case *SubOrderStatusChangedEvent:
+		return e.OrderStatus, true
+	case *SubOrderCancelledEvent:
+		return e.OrderStatus, true
+	default:
+		return "", false
+	}
+}
+
+// CascadesToSubOrders reports whether an order-level event also moves every
+// sub-order that isn't cancelled to the order's new status
+func CascadesToSubOrders(event DomainEvent) bool {
+	switch event.(type) {
+	case *OrderCreatedEvent, *SubOrderStatusChangedEvent, *SubOrderCancelledEvent:
+		return false
+	default:
+		return true
+	}
+}
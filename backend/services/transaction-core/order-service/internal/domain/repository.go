@@ -1,16 +1,86 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
-// Repository defines the interface for order persistence
+// Repository defines the queries served by the order read model
 type Repository interface {
-	Save(ctx context.Context, order *Order) error
 	FindByID(ctx context.Context, orderID string) (*Order, error)
 	FindByUserID(ctx context.Context, userID string, limit, offset int) ([]*Order, error)
-	Update(ctx context.Context, order *Order) error
+	FindSubOrder(ctx context.Context, subOrderID string) (*SubOrder, error)
+	FindSubOrdersBySeller(ctx context.Context, sellerID string, limit, offset int) ([]*SubOrder, error)
+	// Search returns one page of orders matching a validated search
+	Search(ctx context.Context, q OrderSearch) ([]*Order, error)
+	// SearchEach streams every order matching a validated search to fn, in
+	// order and without sub-orders, stopping at the first error fn returns
+	SearchEach(ctx context.Context, q OrderSearch, fn func(*Order) error) error
+}
+
+// ReturnRepository persists return requests
+type ReturnRepository interface {
+	// Save stores a new return, failing with ErrConflict unless the order
+	// still has exactly knownReturns other returns, so two concurrent requests
+	// can't both claim the same units
+	Save(ctx context.Context, ret *ReturnRequest, knownReturns int) error
+	// Update fails with ErrConflict if the return changed since it was loaded
+	Update(ctx context.Context, ret *ReturnRequest) error
+	FindByID(ctx context.Context, returnID string) (*ReturnRequest, error)
+	FindByOrderID(ctx context.Context, orderID string) ([]*ReturnRequest, error)
+}
+
+// InvoiceRepository persists invoices and credit notes. Issued documents are
+// never changed.
+type InvoiceRepository interface {
+	// Save numbers a new document from its series and stores it in one
+	// transaction, so numbers have no gaps. It fails with ErrConflict if the
+	// reference was already used.
+	Save(ctx context.Context, inv *Invoice) error
+	FindByID(ctx context.Context, invoiceID string) (*Invoice, error)
+	// FindByOrderID returns an order's invoice and credit notes, oldest first
+	FindByOrderID(ctx context.Context, orderID string) ([]*Invoice, error)
+	// FindByReference returns nil if no document has the reference
+	FindByReference(ctx context.Context, reference string) (*Invoice, error)
+}
+
+// DeferredEventRepository keeps payment and shipping events until their
+// order can take them
+type DeferredEventRepository interface {
+	Save(ctx context.Context, event *DeferredEvent) error
+	// FindDue returns up to limit events whose next attempt is due, oldest
+	// first
+	FindDue(ctx context.Context, now time.Time, limit int) ([]*DeferredEvent, error)
+	Update(ctx context.Context, event *DeferredEvent) error
+	Delete(ctx context.Context, eventID string) error
 }
 
 // EventStore defines the interface for event sourcing
 type EventStore interface {
-	SaveEvent(ctx context.Context, event *OrderEvent) error
+	// SaveEvents appends events to an aggregate's stream, failing with
+	// ErrConflict if the stream has moved past expectedVersion
+	SaveEvents(ctx context.Context, aggregateID string, events []DomainEvent, expectedVersion int) error
+	GetEvents(ctx context.Context, aggregateID string) ([]DomainEvent, error)
+	// ReadAll returns up to limit events from every stream in the order they
+	// were stored, starting after the given global sequence
+	ReadAll(ctx context.Context, afterSequence int64, limit int) ([]RecordedEvent, error)
+	// HeadSequence returns the global sequence of the newest stored event
+	HeadSequence(ctx context.Context) (int64, error)
+
+	// LoadOrder rebuilds an order from its latest snapshot plus the events
+	// after it
+	LoadOrder(ctx context.Context, orderID string) (*Order, error)
+	// SaveOrder appends the order's uncommitted events, snapshotting it
+	// periodically
+	SaveOrder(ctx context.Context, order *Order) error
+	// SaveSnapshot snapshots an order on demand
+	SaveSnapshot(ctx context.Context, order *Order) error
+}
+
+// Projector keeps a read model up to date from the event stream. Projecting
+// the same event twice must be harmless.
+type Projector interface {
+	Project(ctx context.Context, events []RecordedEvent) error
+	// Reset drops everything the projector has built so it can be replayed
+	Reset(ctx context.Context) error
 }
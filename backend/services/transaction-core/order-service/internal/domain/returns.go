@@ -0,0 +1,312 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// ReturnWindow is how long after delivery a buyer can ask to return an item
+const ReturnWindow = 30 * 24 * time.Hour
+
+// ReturnStatus represents the status of a return request
+type ReturnStatus string
+
+const (
+	ReturnStatusRequested   ReturnStatus = "REQUESTED"
+	ReturnStatusApproved    ReturnStatus = "APPROVED"
+	ReturnStatusRejected    ReturnStatus = "REJECTED"
+	ReturnStatusLabelIssued ReturnStatus = "LABEL_ISSUED"
+	ReturnStatusReceived    ReturnStatus = "RECEIVED"
+	ReturnStatusInspected   ReturnStatus = "INSPECTED"
+	ReturnStatusRefunded    ReturnStatus = "REFUNDED"
+)
+
+// ReturnLine is one order item being sent back. AcceptedQuantity, Restock and
+// RefundAmount are filled in at inspection.
+type ReturnLine struct {
+	ProductID        string  `json:"product_id"`
+	ProductName      string  `json:"product_name"`
+	SellerID         string  `json:"seller_id"`
+	Quantity         int     `json:"quantity"`
+	UnitPrice        float64 `json:"unit_price"` // Paid per unit, including added tax
+	Reason           string  `json:"reason"`
+	AcceptedQuantity int     `json:"accepted_quantity"`
+	Restock          bool    `json:"restock"`
+	Restocked        bool    `json:"restocked"`
+	RefundAmount     float64 `json:"refund_amount"`
+}
+
+// ReturnLineRequest is what the buyer asks to return of one order item
+type ReturnLineRequest struct {
+	ProductID string
+	Quantity  int
+	Reason    string
+}
+
+// ReturnInspection is the warehouse's verdict on one returned line
+type ReturnInspection struct {
+	ProductID        string
+	AcceptedQuantity int
+	Restock          bool // Whether the accepted units can be sold again
+}
+
+// ReturnRefundLine is the amount refunded for one returned line
+type ReturnRefundLine struct {
+	ProductID string
+	Quantity  int
+	Amount    float64
+}
+
+// ReturnRequest is the aggregate root for returning items of a delivered
+// order. It moves REQUESTED → APPROVED → LABEL_ISSUED → RECEIVED → INSPECTED
+// → REFUNDED, or ends REJECTED.
+type ReturnRequest struct {
+	ID              string
+	OrderID         string
+	UserID          string
+	Lines           []ReturnLine
+	Status          ReturnStatus
+	RejectionReason string
+	ShipmentID      string // Reverse shipment carrying the items back
+	Carrier         string
+	TrackingNumber  string
+	RefundID        string
+	RefundAmount    float64 // Sum of the lines' refund amounts
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Version         int
+}
+
+// NewReturnRequest opens a return for items of a delivered order (Factory
+// method). returned holds the quantity of each product already claimed by
+// the order's other returns.
+func NewReturnRequest(order *Order, userID string, lines []ReturnLineRequest, returned map[string]int, now time.Time) (*ReturnRequest, error) {
+	if order.UserID != userID {
+		return nil, errors.New(errors.ErrForbidden, "order belongs to another user")
+	}
+	if order.Status == OrderStatusRefunded {
+		return nil, errors.New(errors.ErrInvalidInput, "order has already been refunded")
+	}
+	if len(lines) == 0 {
+		return nil, errors.New(errors.ErrInvalidInput, "return must have at least one item")
+	}
+
+	ret := &ReturnRequest{
+		ID:        uuid.New().String(),
+		OrderID:   order.ID,
+		UserID:    userID,
+		Status:    ReturnStatusRequested,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Version:   1,
+	}
+
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		if seen[line.ProductID] {
+			return nil, errors.New(errors.ErrInvalidInput, "each product may appear only once in a return")
+		}
+		seen[line.ProductID] = true
+
+		item, purchased, ok := orderedItem(order, line.ProductID)
+		if !ok {
+			return nil, errors.New(errors.ErrInvalidInput, "product is not part of the order")
+		}
+		if line.Quantity <= 0 {
+			return nil, errors.New(errors.ErrInvalidInput, "return quantity must be positive")
+		}
+		if line.Quantity > purchased-returned[line.ProductID] {
+			return nil, errors.New(errors.ErrInvalidInput, "return quantity exceeds what is left to return")
+		}
+
+		deliveredAt := order.DeliveredAtFor(item.SellerID)
+		if deliveredAt.IsZero() {
+			return nil, errors.New(errors.ErrInvalidInput, "item has not been delivered")
+		}
+		if now.After(deliveredAt.Add(ReturnWindow)) {
+			return nil, errors.New(errors.ErrInvalidInput, "return window has closed")
+		}
+
+		ret.Lines = append(ret.Lines, ReturnLine{
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			SellerID:    item.SellerID,
+			Quantity:    line.Quantity,
+			UnitPrice:   order.PaidUnitPrice(item.ProductID),
+			Reason:      line.Reason,
+		})
+	}
+	return ret, nil
+}
+
+// orderedItem finds a product on the order and the total quantity bought
+func orderedItem(order *Order, productID string) (OrderItem, int, bool) {
+	var found OrderItem
+	quantity := 0
+	for _, item := range order.Items {
+		if item.ProductID == productID {
+			if quantity == 0 {
+				found = item
+			}
+			quantity += item.Quantity
+		}
+	}
+	return found, quantity, quantity > 0
+}
+
+// ReturnedQuantities sums, per product, what the given returns claim. Rejected
+// returns claim nothing.
+func ReturnedQuantities(returns []*ReturnRequest) map[string]int {
+	returned := make(map[string]int)
+	for _, ret := range returns {
+		if ret.Status == ReturnStatusRejected {
+			continue
+		}
+		for _, line := range ret.Lines {
+			returned[line.ProductID] += line.Quantity
+		}
+	}
+	return returned
+}
+
+// Approve accepts the return request
+func (r *ReturnRequest) Approve() error {
+	return r.transition(ReturnStatusRequested, ReturnStatusApproved)
+}
+
+// Reject turns the return request down
+func (r *ReturnRequest) Reject(reason string) error {
+	if err := r.transition(ReturnStatusRequested, ReturnStatusRejected); err != nil {
+		return err
+	}
+	r.RejectionReason = reason
+	return nil
+}
+
+// IssueLabel records the reverse shipment the buyer sends the items back with
+func (r *ReturnRequest) IssueLabel(shipmentID, carrier, trackingNumber string) error {
+	if shipmentID == "" || trackingNumber == "" {
+		return errors.New(errors.ErrInvalidInput, "shipment and tracking number are required")
+	}
+	if err := r.transition(ReturnStatusApproved, ReturnStatusLabelIssued); err != nil {
+		return err
+	}
+	r.ShipmentID = shipmentID
+	r.Carrier = carrier
+	r.TrackingNumber = trackingNumber
+	return nil
+}
+
+// Receive records that the items arrived back at the warehouse
+func (r *ReturnRequest) Receive() error {
+	return r.transition(ReturnStatusLabelIssued, ReturnStatusReceived)
+}
+
+// Inspect records how many units of each line were accepted and prices the
+// refund. Lines without an inspection are not accepted.
+func (r *ReturnRequest) Inspect(inspections []ReturnInspection) error {
+	if r.Status != ReturnStatusReceived {
+		return errors.New(errors.ErrInvalidInput, "only received returns can be inspected")
+	}
+
+	byProduct := make(map[string]ReturnInspection, len(inspections))
+	for _, inspection := range inspections {
+		byProduct[inspection.ProductID] = inspection
+	}
+
+	var total float64
+	lines := make([]ReturnLine, len(r.Lines))
+	for i, line := range r.Lines {
+		inspection, ok := byProduct[line.ProductID]
+		delete(byProduct, line.ProductID)
+		if ok && (inspection.AcceptedQuantity < 0 || inspection.AcceptedQuantity > line.Quantity) {
+			return errors.New(errors.ErrInvalidInput, "accepted quantity must be between zero and the returned quantity")
+		}
+
+		line.AcceptedQuantity = inspection.AcceptedQuantity
+		line.Restock = inspection.Restock && inspection.AcceptedQuantity > 0
+		line.RefundAmount = RoundCents(float64(line.AcceptedQuantity) * line.UnitPrice)
+		total += line.RefundAmount
+		lines[i] = line
+	}
+	if len(byProduct) > 0 {
+		return errors.New(errors.ErrInvalidInput, "inspection names a product that is not in the return")
+	}
+
+	r.Lines = lines
+	r.RefundAmount = total
+	return r.transition(ReturnStatusReceived, ReturnStatusInspected)
+}
+
+// PendingRestock returns the inspected lines still to be put back in stock
+func (r *ReturnRequest) PendingRestock() []ReturnLine {
+	var pending []ReturnLine
+	for _, line := range r.Lines {
+		if line.Restock && !line.Restocked {
+			pending = append(pending, line)
+		}
+	}
+	return pending
+}
+
+// MarkRestocked records that a line's accepted units are back in stock
+func (r *ReturnRequest) MarkRestocked(productID string) error {
+	if r.Status != ReturnStatusInspected {
+		return errors.New(errors.ErrInvalidInput, "only inspected returns can be restocked")
+	}
+	for i := range r.Lines {
+		if r.Lines[i].ProductID == productID && r.Lines[i].Restock {
+			r.Lines[i].Restocked = true
+			r.touch()
+			return nil
+		}
+	}
+	return errors.New(errors.ErrInvalidInput, "line is not marked for restock")
+}
+
+// RefundLines returns the per-line amounts to refund
+func (r *ReturnRequest) RefundLines() []ReturnRefundLine {
+	var lines []ReturnRefundLine
+	for _, line := range r.Lines {
+		if line.AcceptedQuantity > 0 {
+			lines = append(lines, ReturnRefundLine{
+				ProductID: line.ProductID,
+				Quantity:  line.AcceptedQuantity,
+				Amount:    line.RefundAmount,
+			})
+		}
+	}
+	return lines
+}
+
+// MarkRefunded closes the return once its refund is issued. A return with
+// nothing accepted closes with no refund.
+func (r *ReturnRequest) MarkRefunded(refundID string) error {
+	if len(r.PendingRestock()) > 0 {
+		return errors.New(errors.ErrInvalidInput, "return has lines still to be restocked")
+	}
+	if refundID == "" && r.RefundAmount > 0 {
+		return errors.New(errors.ErrInvalidInput, "refund ID is required")
+	}
+	if err := r.transition(ReturnStatusInspected, ReturnStatusRefunded); err != nil {
+		return err
+	}
+	r.RefundID = refundID
+	return nil
+}
+
+func (r *ReturnRequest) transition(from, to ReturnStatus) error {
+	if r.Status != from {
+		return errors.New(errors.ErrInvalidInput, "return must be "+string(from)+" to become "+string(to))
+	}
+	r.Status = to
+	r.touch()
+	return nil
+}
+
+func (r *ReturnRequest) touch() {
+	r.UpdatedAt = time.Now()
+	r.Version++
+}
@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"strings"
+	"time"
+
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// MaxSearchLimit caps a page of search results; larger sets are exported
+const MaxSearchLimit = 500
+
+// OrderSortField is a read model column search results can be sorted on
+type OrderSortField string
+
+const (
+	SortByCreatedAt       OrderSortField = "created_at"
+	SortByUpdatedAt       OrderSortField = "updated_at"
+	SortByTotalAmount     OrderSortField = "total_amount"
+	SortByStatus          OrderSortField = "status"
+	SortByShippingCountry OrderSortField = "shipping_country"
+	SortBySellerID        OrderSortField = "seller_id"  // By SortSellerID
+	SortByProductID       OrderSortField = "product_id" // By SortProductID
+)
+
+// OrderSearch filters and sorts orders in the read model. Zero values leave a
+// filter off.
+type OrderSearch struct {
+	Statuses        []OrderStatus
+	CreatedFrom     time.Time // Inclusive
+	CreatedTo       time.Time // Exclusive
+	MinTotal        *float64
+	MaxTotal        *float64
+	SellerID        string
+	ProductID       string
+	ShippingCountry string
+
+	SortBy     OrderSortField // Defaults to created_at
+	Descending bool
+	Limit      int // Ignored by exports, which return every match
+	Offset     int
+}
+
+// Validate checks the search and fills in defaults
+func (q *OrderSearch) Validate() error {
+	switch q.SortBy {
+	case "":
+		q.SortBy = SortByCreatedAt
+	case SortByCreatedAt, SortByUpdatedAt, SortByTotalAmount, SortByStatus, SortByShippingCountry,
+		SortBySellerID, SortByProductID:
+	default:
+		return errors.New(errors.ErrInvalidInput, "unsupported sort field")
+	}
+
+	if !q.CreatedFrom.IsZero() && !q.CreatedTo.IsZero() && !q.CreatedFrom.Before(q.CreatedTo) {
+		return errors.New(errors.ErrInvalidInput, "created_from must be before created_to")
+	}
+	if q.MinTotal != nil && q.MaxTotal != nil && *q.MinTotal > *q.MaxTotal {
+		return errors.New(errors.ErrInvalidInput, "min_total cannot exceed max_total")
+	}
+	if q.Limit < 0 || q.Offset < 0 {
+		return errors.New(errors.ErrInvalidInput, "limit and offset cannot be negative")
+	}
+	if q.Limit == 0 || q.Limit > MaxSearchLimit {
+		q.Limit = MaxSearchLimit
+	}
+
+	q.ShippingCountry = strings.ToUpper(strings.TrimSpace(q.ShippingCountry))
+	return nil
+}
+
+// SortSellerID is the seller an order is sorted under when searches sort by
+// seller. An order split between sellers sorts under the first of them by
+// ID.
+func SortSellerID(items []OrderItem) string {
+	return firstOf(items, func(item OrderItem) string { return item.SellerID })
+}
+
+// SortProductID is the product an order is sorted under when searches sort
+// by product: the first of its products by ID
+func SortProductID(items []OrderItem) string {
+	return firstOf(items, func(item OrderItem) string { return item.ProductID })
+}
+
+func firstOf(items []OrderItem, field func(OrderItem) string) string {
+	first := ""
+	for i, item := range items {
+		if value := field(item); i == 0 || value < first {
+			first = value
+		}
+	}
+	return first
+}
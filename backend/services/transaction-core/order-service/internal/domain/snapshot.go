@@ -0,0 +1,471 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// OrderSnapshotSchema is the schema version written by Order.Snapshot. Bump
+// it when the snapshot layout changes and teach decodeOrderSnapshot to read
+// the old layout; snapshots are a cache over the event stream, so history is
+// never rewritten and unreadable snapshots are simply replayed around.
+const OrderSnapshotSchema = 5
+
+// Snapshot is the serialized state of an aggregate at a stream version
+type Snapshot struct {
+	AggregateID string
+	Version     int // Last event included in the snapshot
+	Schema      int
+	Data        []byte
+	CreatedAt   time.Time
+}
+
+// orderSnapshotV1 is the frozen layout of schema 1. It does not reuse Order
+// or OrderItem so that changes to the aggregate can't silently change it.
+type orderSnapshotV1 struct {
+	ID              string        `json:"id"`
+	UserID          string        `json:"user_id"`
+	Items           []orderItemV1 `json:"items"`
+	TotalAmount     float64       `json:"total_amount"`
+	Status          string        `json:"status"`
+	ShippingAddress string        `json:"shipping_address"`
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+}
+
+type orderItemV1 struct {
+	ProductID   string  `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	Quantity    int     `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+	Subtotal    float64 `json:"subtotal"`
+}
+
+// orderSnapshotV2 adds sellers and sub-orders to schema 1
+type orderSnapshotV2 struct {
+	ID              string        `json:"id"`
+	UserID          string        `json:"user_id"`
+	Items           []orderItemV2 `json:"items"`
+	SubOrders       []subOrderV2  `json:"sub_orders"`
+	TotalAmount     float64       `json:"total_amount"`
+	CancelledAmount float64       `json:"cancelled_amount"`
+	Status          string        `json:"status"`
+	ShippingAddress string        `json:"shipping_address"`
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+}
+
+type orderItemV2 struct {
+	ProductID   string  `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	SellerID    string  `json:"seller_id"`
+	Quantity    int     `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+	Subtotal    float64 `json:"subtotal"`
+}
+
+type subOrderV2 struct {
+	ID          string        `json:"id"`
+	SellerID    string        `json:"seller_id"`
+	Items       []orderItemV2 `json:"items"`
+	ItemsTotal  float64       `json:"items_total"`
+	ShippingFee float64       `json:"shipping_fee"`
+	Total       float64       `json:"total"`
+	Status      string        `json:"status"`
+}
+
+// orderSnapshotV3 adds delivery times to schema 2, which the return window is
+// measured from
+type orderSnapshotV3 struct {
+	ID              string        `json:"id"`
+	UserID          string        `json:"user_id"`
+	Items           []orderItemV2 `json:"items"`
+	SubOrders       []subOrderV3  `json:"sub_orders"`
+	TotalAmount     float64       `json:"total_amount"`
+	CancelledAmount float64       `json:"cancelled_amount"`
+	Status          string        `json:"status"`
+	ShippingAddress string        `json:"shipping_address"`
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+	DeliveredAt     time.Time     `json:"delivered_at"`
+}
+
+type subOrderV3 struct {
+	ID          string        `json:"id"`
+	SellerID    string        `json:"seller_id"`
+	Items       []orderItemV2 `json:"items"`
+	ItemsTotal  float64       `json:"items_total"`
+	ShippingFee float64       `json:"shipping_fee"`
+	Total       float64       `json:"total"`
+	Status      string        `json:"status"`
+	DeliveredAt time.Time     `json:"delivered_at"`
+}
+
+// orderSnapshotV4 adds tax categories, per-seller tax and the order's tax
+// summary to schema 3
+type orderSnapshotV4 struct {
+	ID              string        `json:"id"`
+	UserID          string        `json:"user_id"`
+	Items           []orderItemV4 `json:"items"`
+	SubOrders       []subOrderV4  `json:"sub_orders"`
+	Tax             *taxSummaryV4 `json:"tax,omitempty"`
+	TotalAmount     float64       `json:"total_amount"`
+	CancelledAmount float64       `json:"cancelled_amount"`
+	Status          string        `json:"status"`
+	ShippingAddress string        `json:"shipping_address"`
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+	DeliveredAt     time.Time     `json:"delivered_at"`
+}
+
+type orderItemV4 struct {
+	ProductID   string  `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	SellerID    string  `json:"seller_id"`
+	TaxCategory string  `json:"tax_category"`
+	Quantity    int     `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+	Subtotal    float64 `json:"subtotal"`
+}
+
+type subOrderV4 struct {
+	ID          string        `json:"id"`
+	SellerID    string        `json:"seller_id"`
+	Items       []orderItemV4 `json:"items"`
+	ItemsTotal  float64       `json:"items_total"`
+	ShippingFee float64       `json:"shipping_fee"`
+	TaxAmount   float64       `json:"tax_amount"`
+	Total       float64       `json:"total"`
+	Status      string        `json:"status"`
+	DeliveredAt time.Time     `json:"delivered_at"`
+}
+
+type taxSummaryV4 struct {
+	Country  string      `json:"country"`
+	Region   string      `json:"region"`
+	Pricing  string      `json:"pricing"`
+	Rounding string      `json:"rounding"`
+	Lines    []taxLineV4 `json:"lines"`
+	Net      float64     `json:"net"`
+	Tax      float64     `json:"tax"`
+	Gross    float64     `json:"gross"`
+}
+
+type taxLineV4 struct {
+	ProductID string  `json:"product_id"`
+	SellerID  string  `json:"seller_id"`
+	Category  string  `json:"category"`
+	Rule      string  `json:"rule"`
+	Rate      float64 `json:"rate"`
+	Net       float64 `json:"net"`
+	Tax       float64 `json:"tax"`
+	Gross     float64 `json:"gross"`
+}
+
+// orderSnapshotV5 adds the payment ID to schema 4
+type orderSnapshotV5 struct {
+	orderSnapshotV4
+	PaymentID string `json:"payment_id"`
+}
+
+// Snapshot captures the order's committed state
+func (o *Order) Snapshot() (*Snapshot, error) {
+	if len(o.changes) > 0 {
+		return nil, errors.New(errors.ErrInternal, "cannot snapshot an order with uncommitted events")
+	}
+
+	state := orderSnapshotV5{PaymentID: o.PaymentID}
+	state.orderSnapshotV4 = orderSnapshotV4{
+		ID:              o.ID,
+		UserID:          o.UserID,
+		Items:           itemsToV4(o.Items),
+		SubOrders:       make([]subOrderV4, len(o.SubOrders)),
+		Tax:             taxToV4(o.Tax),
+		TotalAmount:     o.TotalAmount,
+		CancelledAmount: o.CancelledAmount,
+		Status:          string(o.Status),
+		ShippingAddress: o.ShippingAddress,
+		CreatedAt:       o.CreatedAt,
+		UpdatedAt:       o.UpdatedAt,
+		DeliveredAt:     o.DeliveredAt,
+	}
+	for i, sub := range o.SubOrders {
+		state.SubOrders[i] = subOrderV4{
+			ID:          sub.ID,
+			SellerID:    sub.SellerID,
+			Items:       itemsToV4(sub.Items),
+			ItemsTotal:  sub.ItemsTotal,
+			ShippingFee: sub.ShippingFee,
+			TaxAmount:   sub.TaxAmount,
+			Total:       sub.Total,
+			Status:      string(sub.Status),
+			DeliveredAt: sub.DeliveredAt,
+		}
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to marshal snapshot", err)
+	}
+
+	return &Snapshot{
+		AggregateID: o.ID,
+		Version:     o.Version,
+		Schema:      OrderSnapshotSchema,
+		Data:        data,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// RestoreOrder rebuilds an order from a snapshot and the events stored after it
+func RestoreOrder(snapshot *Snapshot, events []DomainEvent) (*Order, error) {
+	order, err := decodeOrderSnapshot(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	order.Version = snapshot.Version
+
+	for _, event := range events {
+		order.apply(event)
+	}
+	return order, nil
+}
+
+// decodeOrderSnapshot reads any snapshot schema this build understands,
+// upgrading older layouts in memory. Schemas 1 and 2 did not record delivery
+// times, so their delivered orders can only be rebuilt by a full replay.
+// Orders snapshotted before schema 4 were never taxed, and before schema 5
+// never paid through Pay.
+func decodeOrderSnapshot(snapshot *Snapshot) (*Order, error) {
+	switch snapshot.Schema {
+	case 1:
+		var state orderSnapshotV1
+		if err := json.Unmarshal(snapshot.Data, &state); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal order snapshot v1: %w", err)
+		}
+		if wasDelivered(state.Status) {
+			return nil, fmt.Errorf("order snapshot v1 of a delivered order has no delivery time")
+		}
+
+		// Schema 1 predates sellers: its orders have no sub-orders
+		order := &Order{
+			ID:              state.ID,
+			UserID:          state.UserID,
+			Items:           make([]OrderItem, len(state.Items)),
+			TotalAmount:     state.TotalAmount,
+			Status:          OrderStatus(state.Status),
+			ShippingAddress: state.ShippingAddress,
+			CreatedAt:       state.CreatedAt,
+			UpdatedAt:       state.UpdatedAt,
+		}
+		for i, item := range state.Items {
+			order.Items[i] = OrderItem{
+				ProductID:   item.ProductID,
+				ProductName: item.ProductName,
+				Quantity:    item.Quantity,
+				UnitPrice:   item.UnitPrice,
+				Subtotal:    item.Subtotal,
+			}
+		}
+		return order, nil
+	case 2:
+		var state orderSnapshotV2
+		if err := json.Unmarshal(snapshot.Data, &state); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal order snapshot v2: %w", err)
+		}
+		delivered := wasDelivered(state.Status)
+		for _, sub := range state.SubOrders {
+			delivered = delivered || wasDelivered(sub.Status)
+		}
+		if delivered {
+			return nil, fmt.Errorf("order snapshot v2 of a delivered order has no delivery time")
+		}
+
+		order := &Order{
+			ID:              state.ID,
+			UserID:          state.UserID,
+			Items:           itemsFromV2(state.Items),
+			SubOrders:       make([]SubOrder, len(state.SubOrders)),
+			TotalAmount:     state.TotalAmount,
+			CancelledAmount: state.CancelledAmount,
+			Status:          OrderStatus(state.Status),
+			ShippingAddress: state.ShippingAddress,
+			CreatedAt:       state.CreatedAt,
+			UpdatedAt:       state.UpdatedAt,
+		}
+		for i, sub := range state.SubOrders {
+			order.SubOrders[i] = SubOrder{
+				ID:          sub.ID,
+				OrderID:     state.ID,
+				SellerID:    sub.SellerID,
+				Items:       itemsFromV2(sub.Items),
+				ItemsTotal:  sub.ItemsTotal,
+				ShippingFee: sub.ShippingFee,
+				Total:       sub.Total,
+				Status:      OrderStatus(sub.Status),
+			}
+		}
+		return order, nil
+	case 3:
+		var state orderSnapshotV3
+		if err := json.Unmarshal(snapshot.Data, &state); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal order snapshot v3: %w", err)
+		}
+
+		order := &Order{
+			ID:              state.ID,
+			UserID:          state.UserID,
+			Items:           itemsFromV2(state.Items),
+			SubOrders:       make([]SubOrder, len(state.SubOrders)),
+			TotalAmount:     state.TotalAmount,
+			CancelledAmount: state.CancelledAmount,
+			Status:          OrderStatus(state.Status),
+			ShippingAddress: state.ShippingAddress,
+			CreatedAt:       state.CreatedAt,
+			UpdatedAt:       state.UpdatedAt,
+			DeliveredAt:     state.DeliveredAt,
+		}
+		for i, sub := range state.SubOrders {
+			order.SubOrders[i] = SubOrder{
+				ID:          sub.ID,
+				OrderID:     state.ID,
+				SellerID:    sub.SellerID,
+				Items:       itemsFromV2(sub.Items),
+				ItemsTotal:  sub.ItemsTotal,
+				ShippingFee: sub.ShippingFee,
+				Total:       sub.Total,
+				Status:      OrderStatus(sub.Status),
+				DeliveredAt: sub.DeliveredAt,
+			}
+		}
+		return order, nil
+	case 4:
+		var state orderSnapshotV4
+		if err := json.Unmarshal(snapshot.Data, &state); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal order snapshot v4: %w", err)
+		}
+		return orderFromV4(state), nil
+	case 5:
+		var state orderSnapshotV5
+		if err := json.Unmarshal(snapshot.Data, &state); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal order snapshot v5: %w", err)
+		}
+		order := orderFromV4(state.orderSnapshotV4)
+		order.PaymentID = state.PaymentID
+		return order, nil
+	default:
+		return nil, fmt.Errorf("unsupported order snapshot schema %d", snapshot.Schema)
+	}
+}
+
+// orderFromV4 builds the order a schema 4 snapshot describes
+func orderFromV4(state orderSnapshotV4) *Order {
+	order := &Order{
+		ID:              state.ID,
+		UserID:          state.UserID,
+		Items:           itemsFromV4(state.Items),
+		SubOrders:       make([]SubOrder, len(state.SubOrders)),
+		Tax:             taxFromV4(state.Tax),
+		TotalAmount:     state.TotalAmount,
+		CancelledAmount: state.CancelledAmount,
+		Status:          OrderStatus(state.Status),
+		ShippingAddress: state.ShippingAddress,
+		CreatedAt:       state.CreatedAt,
+		UpdatedAt:       state.UpdatedAt,
+		DeliveredAt:     state.DeliveredAt,
+	}
+	for i, sub := range state.SubOrders {
+		order.SubOrders[i] = SubOrder{
+			ID:          sub.ID,
+			OrderID:     state.ID,
+			SellerID:    sub.SellerID,
+			Items:       itemsFromV4(sub.Items),
+			ItemsTotal:  sub.ItemsTotal,
+			ShippingFee: sub.ShippingFee,
+			TaxAmount:   sub.TaxAmount,
+			Total:       sub.Total,
+			Status:      OrderStatus(sub.Status),
+			DeliveredAt: sub.DeliveredAt,
+		}
+	}
+	return order
+}
+
+// wasDelivered reports whether a snapshotted status comes after delivery
+func wasDelivered(status string) bool {
+	return OrderStatus(status) == OrderStatusDelivered || OrderStatus(status) == OrderStatusRefunded
+}
+
+func itemsFromV2(items []orderItemV2) []OrderItem {
+	out := make([]OrderItem, len(items))
+	for i, item := range items {
+		out[i] = OrderItem{
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			SellerID:    item.SellerID,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			Subtotal:    item.Subtotal,
+		}
+	}
+	return out
+}
+
+func itemsToV4(items []OrderItem) []orderItemV4 {
+	out := make([]orderItemV4, len(items))
+	for i, item := range items {
+		out[i] = orderItemV4(item)
+	}
+	return out
+}
+
+func itemsFromV4(items []orderItemV4) []OrderItem {
+	out := make([]OrderItem, len(items))
+	for i, item := range items {
+		out[i] = OrderItem(item)
+	}
+	return out
+}
+
+func taxToV4(tax *TaxSummary) *taxSummaryV4 {
+	if tax == nil {
+		return nil
+	}
+	out := &taxSummaryV4{
+		Country:  tax.Country,
+		Region:   tax.Region,
+		Pricing:  string(tax.Pricing),
+		Rounding: string(tax.Rounding),
+		Lines:    make([]taxLineV4, len(tax.Lines)),
+		Net:      tax.Net,
+		Tax:      tax.Tax,
+		Gross:    tax.Gross,
+	}
+	for i, line := range tax.Lines {
+		out.Lines[i] = taxLineV4(line)
+	}
+	return out
+}
+
+func taxFromV4(tax *taxSummaryV4) *TaxSummary {
+	if tax == nil {
+		return nil
+	}
+	out := &TaxSummary{
+		Country:  tax.Country,
+		Region:   tax.Region,
+		Pricing:  PricingMode(tax.Pricing),
+		Rounding: TaxRounding(tax.Rounding),
+		Lines:    make([]TaxLine, len(tax.Lines)),
+		Net:      tax.Net,
+		Tax:      tax.Tax,
+		Gross:    tax.Gross,
+	}
+	for i, line := range tax.Lines {
+		out.Lines[i] = TaxLine(line)
+	}
+	return out
+}
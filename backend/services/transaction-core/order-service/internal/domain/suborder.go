@@ -0,0 +1,194 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// SubOrder is the part of an order one seller fulfils. It has its own
+// shipping charge and status lifecycle; the parent order's status follows
+// from its sub-orders.
+type SubOrder struct {
+	ID          string      `json:"id"`
+	OrderID     string      `json:"order_id"`
+	SellerID    string      `json:"seller_id"`
+	Items       []OrderItem `json:"items"`
+	ItemsTotal  float64     `json:"items_total"`
+	ShippingFee float64     `json:"shipping_fee"`
+	TaxAmount   float64     `json:"tax_amount,omitempty"` // Tax contained in Total
+	Total       float64     `json:"total"`
+	Status      OrderStatus `json:"status"`
+	DeliveredAt time.Time   `json:"-"` // Derived from events, never carried in them
+}
+
+// splitBySeller groups items into one pending sub-order per seller, in the
+// order sellers first appear. Each sub-order carries its seller's share of
+// the tax.
+func splitBySeller(orderID string, items []OrderItem, shippingFees map[string]float64, tax *TaxSummary) ([]SubOrder, error) {
+	var subOrders []SubOrder
+	index := make(map[string]int)
+
+	for _, item := range items {
+		i, ok := index[item.SellerID]
+		if !ok {
+			i = len(subOrders)
+			index[item.SellerID] = i
+			subOrders = append(subOrders, SubOrder{
+				ID:       uuid.New().String(),
+				OrderID:  orderID,
+				SellerID: item.SellerID,
+				Status:   OrderStatusPending,
+			})
+		}
+		subOrders[i].Items = append(subOrders[i].Items, item)
+		subOrders[i].ItemsTotal += item.Subtotal
+	}
+
+	for sellerID, fee := range shippingFees {
+		i, ok := index[sellerID]
+		if !ok {
+			return nil, errors.New(errors.ErrInvalidInput, "shipping fee given for a seller with no items")
+		}
+		if fee < 0 {
+			return nil, errors.New(errors.ErrInvalidInput, "shipping fee cannot be negative")
+		}
+		subOrders[i].ShippingFee = fee
+	}
+
+	var sellerTax map[string]float64
+	if tax != nil {
+		sellerTax = tax.TaxBySeller()
+	}
+	for i := range subOrders {
+		sub := &subOrders[i]
+		sub.TaxAmount = sellerTax[sub.SellerID]
+		sub.Total = RoundCents(sub.ItemsTotal + sub.ShippingFee + tax.AddedTax(sub.TaxAmount))
+	}
+	return subOrders, nil
+}
+
+// DeliveredAtFor returns when a seller's items reached the buyer, or the zero
+// time if they haven't. Orders without sub-orders are delivered as a whole.
+func (o *Order) DeliveredAtFor(sellerID string) time.Time {
+	if len(o.SubOrders) == 0 {
+		return o.DeliveredAt
+	}
+	for _, sub := range o.SubOrders {
+		if sub.SellerID == sellerID {
+			return sub.DeliveredAt
+		}
+	}
+	return time.Time{}
+}
+
+// FindSubOrder returns a copy of the sub-order with the given ID
+func (o *Order) FindSubOrder(subOrderID string) (SubOrder, bool) {
+	if sub := o.subOrder(subOrderID); sub != nil {
+		return *sub, true
+	}
+	return SubOrder{}, false
+}
+
+// UpdateSubOrderStatus moves one seller's sub-order along its lifecycle.
+// Sub-orders are confirmed together with the parent once it is paid, and are
+// cancelled with CancelSubOrder.
+func (o *Order) UpdateSubOrderStatus(subOrderID string, newStatus OrderStatus) error {
+	sub := o.subOrder(subOrderID)
+	if sub == nil {
+		return errors.New(errors.ErrNotFound, "sub-order not found")
+	}
+	if newStatus == OrderStatusConfirmed || newStatus == OrderStatusCancelled {
+		return errors.New(errors.ErrInvalidInput, "sub-orders are confirmed with the order and cancelled with CancelSubOrder")
+	}
+	if err := checkTransition(sub.Status, newStatus); err != nil {
+		return err
+	}
+
+	o.raise(&SubOrderStatusChangedEvent{
+		OrderID:     o.ID,
+		SubOrderID:  subOrderID,
+		From:        sub.Status,
+		To:          newStatus,
+		OrderStatus: o.statusWith(subOrderID, newStatus),
+		ChangedAt:   time.Now(),
+	})
+	return nil
+}
+
+// CancelSubOrder cancels one seller's part of the order. Its total is owed
+// back to the buyer from the parent's payment.
+func (o *Order) CancelSubOrder(subOrderID, reason string) error {
+	sub := o.subOrder(subOrderID)
+	if sub == nil {
+		return errors.New(errors.ErrNotFound, "sub-order not found")
+	}
+	switch sub.Status {
+	case OrderStatusShipped, OrderStatusDelivered, OrderStatusCancelled, OrderStatusRefunded:
+		return errors.New(errors.ErrOrderNotCancellable, "sub-order cannot be cancelled")
+	}
+
+	o.raise(&SubOrderCancelledEvent{
+		OrderID:     o.ID,
+		SubOrderID:  subOrderID,
+		SellerID:    sub.SellerID,
+		Reason:      reason,
+		Amount:      sub.Total,
+		OrderStatus: o.statusWith(subOrderID, OrderStatusCancelled),
+		CancelledAt: time.Now(),
+	})
+	return nil
+}
+
+func (o *Order) subOrder(subOrderID string) *SubOrder {
+	for i := range o.SubOrders {
+		if o.SubOrders[i].ID == subOrderID {
+			return &o.SubOrders[i]
+		}
+	}
+	return nil
+}
+
+// statusWith derives the parent status as if the given sub-order were in
+// status. The parent is cancelled once every sub-order is, and otherwise
+// advances as far as all of its open sub-orders have.
+func (o *Order) statusWith(subOrderID string, status OrderStatus) OrderStatus {
+	var open []OrderStatus
+	for _, sub := range o.SubOrders {
+		if sub.ID == subOrderID {
+			sub.Status = status
+		}
+		if sub.Status != OrderStatusCancelled {
+			open = append(open, sub.Status)
+		}
+	}
+
+	if len(open) == 0 {
+		return OrderStatusCancelled
+	}
+
+	all := func(statuses ...OrderStatus) bool {
+		for _, s := range open {
+			found := false
+			for _, want := range statuses {
+				found = found || s == want
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch {
+	case all(OrderStatusDelivered):
+		return OrderStatusDelivered
+	case all(OrderStatusShipped, OrderStatusDelivered):
+		return OrderStatusShipped
+	case !all(OrderStatusPending, OrderStatusConfirmed):
+		return OrderStatusProcessing
+	default:
+		return o.Status
+	}
+}
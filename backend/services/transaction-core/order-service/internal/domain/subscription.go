@@ -0,0 +1,32 @@
+package domain
+
+import "context"
+
+// StartPosition says where a consumer with no checkpoint begins reading
+type StartPosition int
+
+const (
+	// StartFromBeginning delivers the whole event history
+	StartFromBeginning StartPosition = iota
+	// StartFromNow delivers only events stored after the consumer first runs
+	StartFromNow
+)
+
+// CheckpointStore persists each named consumer's position in the global
+// event stream. A consumer is processed by one owner at a time, which holds
+// a renewable lease on it.
+type CheckpointStore interface {
+	// AcquireLease claims or renews the consumer for owner, returning false
+	// while another owner holds an unexpired lease
+	AcquireLease(ctx context.Context, consumer, owner string) (bool, error)
+	ReleaseLease(ctx context.Context, consumer, owner string) error
+	// LoadCheckpoint returns the last handled sequence, or false if the
+	// consumer has never stored one
+	LoadCheckpoint(ctx context.Context, consumer string) (int64, bool, error)
+	// SaveCheckpoint stores the last handled sequence and renews the lease,
+	// failing with ErrConflict if owner no longer holds it
+	SaveCheckpoint(ctx context.Context, consumer, owner string, sequence int64) error
+	// ParkEvent sets aside an event the consumer failed to handle so the
+	// stream can move on
+	ParkEvent(ctx context.Context, consumer string, event RecordedEvent, attempts int, reason string) error
+}
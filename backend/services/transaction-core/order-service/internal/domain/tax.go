@@ -0,0 +1,312 @@
+package domain
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// PricingMode says whether listed prices already contain tax
+type PricingMode string
+
+const (
+	PricingTaxInclusive PricingMode = "INCLUSIVE" // Tax is extracted from the price
+	PricingTaxExclusive PricingMode = "EXCLUSIVE" // Tax is added on top of the price
+)
+
+// TaxRounding says where tax is rounded to cents
+type TaxRounding string
+
+const (
+	RoundPerLine    TaxRounding = "PER_LINE"    // Each line's tax is rounded, then summed
+	RoundPerInvoice TaxRounding = "PER_INVOICE" // Tax is summed unrounded and rounded once
+)
+
+// TaxRule is the rate for a country, optionally narrowed to a region and a
+// product tax category. The most specific matching rule wins.
+type TaxRule struct {
+	Country  string  `json:"country"`
+	Region   string  `json:"region,omitempty"`
+	Category string  `json:"category,omitempty"`
+	Rate     float64 `json:"rate"` // 0.19 for 19%
+	Name     string  `json:"name"`
+}
+
+// TaxRegime is how a country prices and rounds tax
+type TaxRegime struct {
+	Country  string      `json:"country"`
+	Pricing  PricingMode `json:"pricing"`
+	Rounding TaxRounding `json:"rounding"`
+}
+
+// TaxLine is the tax on one order item
+type TaxLine struct {
+	ProductID string  `json:"product_id"`
+	SellerID  string  `json:"seller_id"`
+	Category  string  `json:"category"`
+	Rule      string  `json:"rule"`
+	Rate      float64 `json:"rate"`
+	Net       float64 `json:"net"`
+	Tax       float64 `json:"tax"` // Unrounded when rounding per invoice
+	Gross     float64 `json:"gross"`
+}
+
+// TaxSummary is the tax calculated for an order's items. Shipping is not
+// taxed.
+type TaxSummary struct {
+	Country  string      `json:"country"`
+	Region   string      `json:"region"`
+	Pricing  PricingMode `json:"pricing"`
+	Rounding TaxRounding `json:"rounding"`
+	Lines    []TaxLine   `json:"lines"`
+	Net      float64     `json:"net"`
+	Tax      float64     `json:"tax"`
+	Gross    float64     `json:"gross"`
+}
+
+// TaxEngine looks up tax rules and calculates tax for order items
+type TaxEngine struct {
+	rules   []TaxRule
+	regimes map[string]TaxRegime
+}
+
+// DefaultTaxRegime applies to countries without a configured regime
+var DefaultTaxRegime = TaxRegime{Pricing: PricingTaxExclusive, Rounding: RoundPerLine}
+
+// NewTaxEngine validates rules and regimes. Countries and regions are matched
+// case-insensitively.
+func NewTaxEngine(rules []TaxRule, regimes []TaxRegime) (*TaxEngine, error) {
+	engine := &TaxEngine{regimes: make(map[string]TaxRegime)}
+
+	for _, rule := range rules {
+		if rule.Country == "" {
+			return nil, errors.New(errors.ErrInvalidInput, "tax rule needs a country")
+		}
+		if rule.Rate < 0 || rule.Rate >= 1 {
+			return nil, errors.New(errors.ErrInvalidInput, "tax rate must be between 0 and 1")
+		}
+		rule.Country = strings.ToUpper(strings.TrimSpace(rule.Country))
+		rule.Region = strings.ToUpper(strings.TrimSpace(rule.Region))
+		rule.Category = strings.ToLower(strings.TrimSpace(rule.Category))
+		engine.rules = append(engine.rules, rule)
+	}
+
+	for _, regime := range regimes {
+		switch regime.Pricing {
+		case PricingTaxInclusive, PricingTaxExclusive:
+		default:
+			return nil, errors.New(errors.ErrInvalidInput, "unknown pricing mode for "+regime.Country)
+		}
+		switch regime.Rounding {
+		case RoundPerLine, RoundPerInvoice:
+		default:
+			return nil, errors.New(errors.ErrInvalidInput, "unknown tax rounding for "+regime.Country)
+		}
+		regime.Country = strings.ToUpper(strings.TrimSpace(regime.Country))
+		engine.regimes[regime.Country] = regime
+	}
+	return engine, nil
+}
+
+// Rule finds the most specific rule for a product category shipped to a
+// region of a country. A region match outranks a category match.
+func (e *TaxEngine) Rule(country, region, category string) (TaxRule, bool) {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	region = strings.ToUpper(strings.TrimSpace(region))
+	category = strings.ToLower(strings.TrimSpace(category))
+
+	best, bestScore := TaxRule{}, -1
+	for _, rule := range e.rules {
+		if rule.Country != country {
+			continue
+		}
+		if rule.Region != "" && rule.Region != region {
+			continue
+		}
+		if rule.Category != "" && rule.Category != category {
+			continue
+		}
+
+		score := 0
+		if rule.Region != "" {
+			score += 2
+		}
+		if rule.Category != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = rule, score
+		}
+	}
+	return best, bestScore >= 0
+}
+
+// Regime returns how a country prices and rounds tax
+func (e *TaxEngine) Regime(country string) TaxRegime {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if regime, ok := e.regimes[country]; ok {
+		return regime
+	}
+	regime := DefaultTaxRegime
+	regime.Country = country
+	return regime
+}
+
+// Calculate taxes items shipped to a region of a country. Item subtotals
+// must already be set. Items with no matching rule are untaxed.
+func (e *TaxEngine) Calculate(country, region string, items []OrderItem) *TaxSummary {
+	regime := e.Regime(country)
+	summary := &TaxSummary{
+		Country:  regime.Country,
+		Region:   strings.ToUpper(strings.TrimSpace(region)),
+		Pricing:  regime.Pricing,
+		Rounding: regime.Rounding,
+	}
+
+	var amount, rawTax, lineTax float64
+	for _, item := range items {
+		rule, _ := e.Rule(country, region, item.TaxCategory)
+
+		line := TaxLine{
+			ProductID: item.ProductID,
+			SellerID:  item.SellerID,
+			Category:  item.TaxCategory,
+			Rule:      rule.Name,
+			Rate:      rule.Rate,
+		}
+
+		var tax float64
+		if regime.Pricing == PricingTaxInclusive {
+			tax = item.Subtotal * rule.Rate / (1 + rule.Rate)
+		} else {
+			tax = item.Subtotal * rule.Rate
+		}
+		rawTax += tax
+		if regime.Rounding == RoundPerLine {
+			tax = RoundCents(tax)
+		}
+		lineTax += tax
+
+		line.Tax = tax
+		if regime.Pricing == PricingTaxInclusive {
+			line.Gross = item.Subtotal
+			line.Net = item.Subtotal - tax
+		} else {
+			line.Net = item.Subtotal
+			line.Gross = item.Subtotal + tax
+		}
+		amount += item.Subtotal
+		summary.Lines = append(summary.Lines, line)
+	}
+
+	if regime.Rounding == RoundPerLine {
+		summary.Tax = RoundCents(lineTax)
+	} else {
+		summary.Tax = RoundCents(rawTax)
+	}
+	if regime.Pricing == PricingTaxInclusive {
+		summary.Gross = RoundCents(amount)
+		summary.Net = RoundCents(amount - summary.Tax)
+	} else {
+		summary.Net = RoundCents(amount)
+		summary.Gross = RoundCents(amount + summary.Tax)
+	}
+	return summary
+}
+
+// AddedTax is the tax charged on top of listed prices: all of it for
+// exclusive pricing, none for inclusive
+func (s *TaxSummary) AddedTax(tax float64) float64 {
+	if s == nil || s.Pricing == PricingTaxInclusive {
+		return 0
+	}
+	return tax
+}
+
+// TaxBySeller splits the summary's tax between sellers, in cents that always
+// add up to the summary's tax
+func (s *TaxSummary) TaxBySeller() map[string]float64 {
+	raw := make(map[string]float64)
+	var sellers []string
+	for _, line := range s.Lines {
+		if _, ok := raw[line.SellerID]; !ok {
+			sellers = append(sellers, line.SellerID)
+		}
+		raw[line.SellerID] += line.Tax
+	}
+
+	amounts := make([]float64, len(sellers))
+	for i, seller := range sellers {
+		amounts[i] = raw[seller]
+	}
+
+	split := make(map[string]float64, len(sellers))
+	for i, amount := range allocateCents(amounts, s.Tax) {
+		split[sellers[i]] = amount
+	}
+	return split
+}
+
+// allocateCents rounds amounts to cents so they add up to total. Rounding per
+// invoice leaves fractions of a cent on each amount, so every amount is
+// rounded down and the missing cents are handed out by largest remainder.
+// Ties go to the earlier amount so the split is deterministic.
+func allocateCents(amounts []float64, total float64) []float64 {
+	totalCents := int64(math.Round(total * 100))
+	cents := make([]int64, len(amounts))
+	remainders := make([]float64, len(amounts))
+	var allocated int64
+	for i, amount := range amounts {
+		exact := amount * 100
+		cents[i] = int64(math.Floor(exact + 1e-9))
+		remainders[i] = exact - float64(cents[i])
+		allocated += cents[i]
+	}
+
+	order := make([]int, len(amounts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for i := 0; allocated < totalCents && len(order) > 0; i = (i + 1) % len(order) {
+		cents[order[i]]++
+		allocated++
+	}
+
+	out := make([]float64, len(amounts))
+	for i, c := range cents {
+		out[i] = float64(c) / 100
+	}
+	return out
+}
+
+// PaidUnitPrice is what the buyer paid for one unit of a product, including
+// any tax added on top of the listed price
+func (o *Order) PaidUnitPrice(productID string) float64 {
+	var quantity int
+	var paid float64
+	for _, item := range o.Items {
+		if item.ProductID == productID {
+			quantity += item.Quantity
+			paid += item.Subtotal
+		}
+	}
+	if quantity == 0 {
+		return 0
+	}
+	if o.Tax != nil {
+		for _, line := range o.Tax.Lines {
+			if line.ProductID == productID {
+				paid += o.Tax.AddedTax(line.Tax)
+			}
+		}
+	}
+	return paid / float64(quantity)
+}
+
+// RoundCents rounds an amount to the nearest cent, halves away from zero
+func RoundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,46 @@
+package clients
+
+import (
+	"context"
+
+	inventorypb "github.com/titan-commerce/backend/inventory-service/proto/inventory/v1"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// InventoryClient puts returned units back in stock with inventory-service
+type InventoryClient struct {
+	conn   *grpc.ClientConn
+	client inventorypb.InventoryServiceClient
+}
+
+// NewInventoryClient dials inventory-service at addr, e.g.
+// inventory-service:9000. The connection is made lazily, so an
+// inventory-service that is down fails the restocks, which SettleReturn
+// retries, rather than startup.
+func NewInventoryClient(addr string) (*InventoryClient, error) {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to dial inventory-service", err)
+	}
+	return &InventoryClient{conn: conn, client: inventorypb.NewInventoryServiceClient(conn)}, nil
+}
+
+func (c *InventoryClient) Close() error {
+	return c.conn.Close()
+}
+
+// Restock puts units back on sale. inventory-service applies a restock ID
+// once, so a retry after a lost reply does not restock twice.
+func (c *InventoryClient) Restock(ctx context.Context, restockID, productID string, quantity int) error {
+	_, err := c.client.Restock(ctx, &inventorypb.RestockRequest{
+		RestockId: restockID,
+		ProductId: productID,
+		Quantity:  int32(quantity),
+	})
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to restock", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package clients
+
+import (
+	"context"
+
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	refundpb "github.com/titan-commerce/backend/refund-service/proto/refund/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// RefundClient refunds returned lines and rejected payments with
+// refund-service
+type RefundClient struct {
+	conn   *grpc.ClientConn
+	client refundpb.RefundServiceClient
+}
+
+// NewRefundClient dials refund-service at addr, e.g. refund-service:9000.
+// The connection is made lazily, so a refund-service that is down fails
+// the refunds, which SettleReturn retries, rather than startup.
+func NewRefundClient(addr string) (*RefundClient, error) {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to dial refund-service", err)
+	}
+	return &RefundClient{conn: conn, client: refundpb.NewRefundServiceClient(conn)}, nil
+}
+
+func (c *RefundClient) Close() error {
+	return c.conn.Close()
+}
+
+// RefundReturn refunds the lines against the order's payment. refund-service
+// refunds a return once, so a retry returns the refund already made.
+func (c *RefundClient) RefundReturn(ctx context.Context, orderID, returnID string, lines []domain.ReturnRefundLine) (string, error) {
+	req := &refundpb.ProcessReturnRefundRequest{
+		OrderId:  orderID,
+		ReturnId: returnID,
+		Reason:   "item return",
+		Lines:    make([]*refundpb.RefundLine, len(lines)),
+	}
+	for i, line := range lines {
+		req.Lines[i] = &refundpb.RefundLine{
+			ProductId: line.ProductID,
+			Quantity:  int32(line.Quantity),
+			Amount:    line.Amount,
+		}
+	}
+
+	resp, err := c.client.ProcessReturnRefund(ctx, req)
+	if err != nil {
+		return "", errors.Wrap(errors.ErrPaymentFailed, "refund-service refund failed", err)
+	}
+	return resp.Refund.RefundId, nil
+}
+
+// RefundPayment refunds amount of the payment. refund-service refunds once
+// per idempotency key, so a retry returns the refund already made.
+func (c *RefundClient) RefundPayment(ctx context.Context, idempotencyKey, paymentID, orderID string, amount float64, reason string) (string, error) {
+	resp, err := c.client.ProcessRefund(ctx, &refundpb.ProcessRefundRequest{
+		PaymentId:      paymentID,
+		OrderId:        orderID,
+		Amount:         amount,
+		Reason:         reason,
+		IdempotencyKey: idempotencyKey,
+	})
+	if err != nil {
+		return "", errors.Wrap(errors.ErrPaymentFailed, "refund-service refund failed", err)
+	}
+	return resp.Refund.RefundId, nil
+}
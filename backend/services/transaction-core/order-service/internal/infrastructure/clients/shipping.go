@@ -0,0 +1,53 @@
+package clients
+
+import (
+	"context"
+
+	"github.com/titan-commerce/backend/order-service/internal/application"
+	"github.com/titan-commerce/backend/pkg/errors"
+	shippingpb "github.com/titan-commerce/backend/shipping-service/proto/shipping/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// ShippingClient books reverse shipments with shipping-service
+type ShippingClient struct {
+	conn   *grpc.ClientConn
+	client shippingpb.ShippingServiceClient
+}
+
+// NewShippingClient dials shipping-service at addr, e.g.
+// shipping-service:9000. The connection is made lazily, so a
+// shipping-service that is down fails the return approvals, which can be
+// retried, rather than startup.
+func NewShippingClient(addr string) (*ShippingClient, error) {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to dial shipping-service", err)
+	}
+	return &ShippingClient{conn: conn, client: shippingpb.NewShippingServiceClient(conn)}, nil
+}
+
+func (c *ShippingClient) Close() error {
+	return c.conn.Close()
+}
+
+// CreateReturnShipment books the return's reverse shipment. shipping-service
+// books one per return, so a retry returns the shipment already booked.
+func (c *ShippingClient) CreateReturnShipment(ctx context.Context, orderID, returnID, fromAddress, toAddress string) (application.ReturnShipment, error) {
+	resp, err := c.client.CreateReturnShipment(ctx, &shippingpb.CreateReturnShipmentRequest{
+		OrderId:            orderID,
+		ReturnId:           returnID,
+		OriginAddress:      fromAddress,
+		DestinationAddress: toAddress,
+	})
+	if err != nil {
+		return application.ReturnShipment{}, errors.Wrap(errors.ErrInternal, "failed to book return shipment", err)
+	}
+
+	return application.ReturnShipment{
+		ShipmentID:     resp.Shipment.ShipmentId,
+		Carrier:        resp.Shipment.Carrier,
+		TrackingNumber: resp.Shipment.TrackingNumber,
+	}, nil
+}
@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// DefaultLeaseTTL is how long a subscription owner keeps its consumer
+// without renewing. It must comfortably exceed the time to handle a batch.
+const DefaultLeaseTTL = 30 * time.Second
+
+// CheckpointRepository stores subscription checkpoints, leases and parked
+// events
+type CheckpointRepository struct {
+	db       *sql.DB
+	leaseTTL time.Duration
+	logger   *logger.Logger
+}
+
+func NewCheckpointRepository(databaseURL string, leaseTTL time.Duration, logger *logger.Logger) (*CheckpointRepository, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to connect to database", err)
+	}
+	if leaseTTL <= 0 {
+		leaseTTL = DefaultLeaseTTL
+	}
+
+	logger.Info("Event subscription checkpoint repository initialized")
+	return &CheckpointRepository{db: db, leaseTTL: leaseTTL, logger: logger}, nil
+}
+
+// AcquireLease claims the consumer if it is free or expired, or renews it
+// if owner already holds it
+func (r *CheckpointRepository) AcquireLease(ctx context.Context, consumer, owner string) (bool, error) {
+	query := `
+		INSERT INTO event_subscriptions (consumer, owner, lease_until, updated_at)
+		VALUES ($1, $2, NOW() + make_interval(secs => $3), NOW())
+		ON CONFLICT (consumer) DO UPDATE SET
+			owner = EXCLUDED.owner,
+			lease_until = EXCLUDED.lease_until
+		WHERE event_subscriptions.owner = EXCLUDED.owner
+			OR event_subscriptions.lease_until < NOW()
+		RETURNING owner
+	`
+
+	var holder string
+	err := r.db.QueryRowContext(ctx, query, consumer, owner, r.leaseTTL.Seconds()).Scan(&holder)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(errors.ErrInternal, "failed to acquire subscription lease", err)
+	}
+	return true, nil
+}
+
+// ReleaseLease lets another owner take the consumer immediately
+func (r *CheckpointRepository) ReleaseLease(ctx context.Context, consumer, owner string) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE event_subscriptions SET lease_until = NOW() WHERE consumer = $1 AND owner = $2",
+		consumer, owner)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to release subscription lease", err)
+	}
+	return nil
+}
+
+// LoadCheckpoint returns the consumer's last handled sequence
+func (r *CheckpointRepository) LoadCheckpoint(ctx context.Context, consumer string) (int64, bool, error) {
+	var position sql.NullInt64
+	err := r.db.QueryRowContext(ctx,
+		"SELECT position FROM event_subscriptions WHERE consumer = $1", consumer).Scan(&position)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, errors.Wrap(errors.ErrInternal, "failed to load checkpoint", err)
+	}
+	return position.Int64, position.Valid, nil
+}
+
+// SaveCheckpoint stores the consumer's position if owner still holds it
+func (r *CheckpointRepository) SaveCheckpoint(ctx context.Context, consumer, owner string, sequence int64) error {
+	query := `
+		UPDATE event_subscriptions
+		SET position = $3, lease_until = NOW() + make_interval(secs => $4), updated_at = NOW()
+		WHERE consumer = $1 AND owner = $2
+	`
+
+	result, err := r.db.ExecContext(ctx, query, consumer, owner, sequence, r.leaseTTL.Seconds())
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to save checkpoint", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.New(errors.ErrConflict, "subscription lease lost")
+	}
+	return nil
+}
+
+// ParkEvent records a poison event for the consumer. Parking the same event
+// again only updates the failure details.
+func (r *CheckpointRepository) ParkEvent(ctx context.Context, consumer string, event domain.RecordedEvent, attempts int, reason string) error {
+	query := `
+		INSERT INTO parked_events (consumer, sequence, aggregate_id, version, event_type, attempts, reason, parked_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		ON CONFLICT (consumer, sequence) DO UPDATE SET
+			attempts = parked_events.attempts + EXCLUDED.attempts,
+			reason = EXCLUDED.reason,
+			parked_at = EXCLUDED.parked_at
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		consumer, event.Sequence, event.AggregateID, event.Version, event.Event.EventType(), attempts, reason)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to park event", err)
+	}
+	return nil
+}
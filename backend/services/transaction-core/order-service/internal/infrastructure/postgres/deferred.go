@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// DeferredEventRepository keeps payment and shipping events until their
+// order can take them
+type DeferredEventRepository struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
+
+func NewDeferredEventRepository(databaseURL string, logger *logger.Logger) (*DeferredEventRepository, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to connect to database", err)
+	}
+
+	logger.Info("Deferred event repository initialized")
+	return &DeferredEventRepository{db: db, logger: logger}, nil
+}
+
+func (r *DeferredEventRepository) Save(ctx context.Context, event *domain.DeferredEvent) error {
+	query := `
+		INSERT INTO deferred_events (event_id, kind, order_id, payload, attempts, last_error, created_at, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		event.ID, event.Kind, event.OrderID, string(event.Payload), event.Attempts, event.LastError,
+		event.CreatedAt, event.NextAttemptAt)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to save deferred event", err)
+	}
+	return nil
+}
+
+// FindDue returns up to limit events whose next attempt is due, oldest first
+func (r *DeferredEventRepository) FindDue(ctx context.Context, now time.Time, limit int) ([]*domain.DeferredEvent, error) {
+	query := `
+		SELECT event_id, kind, order_id, payload, attempts, last_error, created_at, next_attempt_at
+		FROM deferred_events
+		WHERE next_attempt_at <= $1
+		ORDER BY created_at
+		LIMIT $2
+	`
+	rows, err := r.db.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to query deferred events", err)
+	}
+	defer rows.Close()
+
+	var events []*domain.DeferredEvent
+	for rows.Next() {
+		var event domain.DeferredEvent
+		if err := rows.Scan(
+			&event.ID, &event.Kind, &event.OrderID, &event.Payload, &event.Attempts, &event.LastError,
+			&event.CreatedAt, &event.NextAttemptAt,
+		); err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to scan deferred event", err)
+		}
+		events = append(events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to read deferred events", err)
+	}
+	return events, nil
+}
+
+func (r *DeferredEventRepository) Update(ctx context.Context, event *domain.DeferredEvent) error {
+	query := `
+		UPDATE deferred_events
+		SET attempts = $2, last_error = $3, next_attempt_at = $4
+		WHERE event_id = $1
+	`
+	if _, err := r.db.ExecContext(ctx, query, event.ID, event.Attempts, event.LastError, event.NextAttemptAt); err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to update deferred event", err)
+	}
+	return nil
+}
+
+func (r *DeferredEventRepository) Delete(ctx context.Context, eventID string) error {
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM deferred_events WHERE event_id = $1", eventID); err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to delete deferred event", err)
+	}
+	return nil
+}
@@ -4,17 +4,24 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	stderrors "errors"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/titan-commerce/backend/order-service/internal/domain"
 	"github.com/titan-commerce/backend/pkg/errors"
 	"github.com/titan-commerce/backend/pkg/logger"
-	_ "github.com/lib/pq"
 )
 
+// appendLockKey is the advisory lock that serializes appends. Holding it until
+// commit means events become visible in global sequence order, so a reader
+// that has seen sequence N will never later find a smaller one appear.
+const appendLockKey = 7_100_001
+
 type EventStoreRepository struct {
-	db     *sql.DB
-	logger *logger.Logger
+	db            *sql.DB
+	logger        *logger.Logger
+	snapshotEvery int
 }
 
 func NewEventStoreRepository(databaseURL string, logger *logger.Logger) (*EventStoreRepository, error) {
@@ -25,34 +32,13 @@ func NewEventStoreRepository(databaseURL string, logger *logger.Logger) (*EventS
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	
+
 	if err := db.PingContext(ctx); err != nil {
 		return nil, errors.Wrap(errors.ErrInternal, "failed to ping database", err)
 	}
 
 	logger.Info("Order EventStore repository initialized")
-	return &EventStoreRepository{db: db, logger: logger}, nil
-}
-
-// SaveEvent saves a single event
-func (r *EventStoreRepository) SaveEvent(ctx context.Context, event *domain.OrderEvent) error {
-	eventData, err := json.Marshal(event)
-	if err != nil {
-		return errors.Wrap(errors.ErrInternal, "failed to marshal event", err)
-	}
-
-	query := `
-		INSERT INTO events (aggregate_id, aggregate_type, event_type, event_data, version, occurred_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`
-
-	_, err = r.db.ExecContext(ctx, query,
-		event.AggregateID, "Order", event.Type, eventData, event.Version, event.Timestamp)
-	if err != nil {
-		return errors.Wrap(errors.ErrInternal, "failed to save event", err)
-	}
-
-	return nil
+	return &EventStoreRepository{db: db, logger: logger, snapshotEvery: DefaultSnapshotEvery}, nil
 }
 
 // SaveEvents appends events to the event stream
@@ -63,9 +49,13 @@ func (r *EventStoreRepository) SaveEvents(ctx context.Context, aggregateID strin
 	}
 	defer tx.Rollback()
 
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", appendLockKey); err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to lock event stream", err)
+	}
+
 	// Check current version (optimistic concurrency)
 	var currentVersion int
-	err = tx.QueryRowContext(ctx, 
+	err = tx.QueryRowContext(ctx,
 		"SELECT COALESCE(MAX(version), 0) FROM events WHERE aggregate_id = $1", aggregateID).Scan(&currentVersion)
 	if err != nil {
 		return errors.Wrap(errors.ErrInternal, "failed to get current version", err)
@@ -89,8 +79,13 @@ func (r *EventStoreRepository) SaveEvents(ctx context.Context, aggregateID strin
 
 		version := expectedVersion + i + 1
 		_, err = tx.ExecContext(ctx, query,
-			aggregateID, "Order", event.EventType(), eventData, version, event.OccurredAt())
+			aggregateID, "Order", event.EventType(), string(eventData), version, event.OccurredAt())
 		if err != nil {
+			// A writer that passed the version check at the same time wins
+			// the unique (aggregate_id, version) constraint
+			if isUniqueViolation(err) {
+				return errors.New(errors.ErrConflict, "concurrent modification detected")
+			}
 			return errors.Wrap(errors.ErrInternal, "failed to save event", err)
 		}
 	}
@@ -104,14 +99,19 @@ func (r *EventStoreRepository) SaveEvents(ctx context.Context, aggregateID strin
 
 // GetEvents retrieves all events for an aggregate
 func (r *EventStoreRepository) GetEvents(ctx context.Context, aggregateID string) ([]domain.DomainEvent, error) {
+	return r.getEventsAfter(ctx, aggregateID, 0)
+}
+
+// getEventsAfter retrieves an aggregate's events with a version above afterVersion
+func (r *EventStoreRepository) getEventsAfter(ctx context.Context, aggregateID string, afterVersion int) ([]domain.DomainEvent, error) {
 	query := `
-		SELECT event_type, event_data, occurred_at
+		SELECT event_type, event_data
 		FROM events
-		WHERE aggregate_id = $1
+		WHERE aggregate_id = $1 AND version > $2
 		ORDER BY version ASC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, aggregateID)
+	rows, err := r.db.QueryContext(ctx, query, aggregateID, afterVersion)
 	if err != nil {
 		return nil, errors.Wrap(errors.ErrInternal, "failed to query events", err)
 	}
@@ -121,96 +121,101 @@ func (r *EventStoreRepository) GetEvents(ctx context.Context, aggregateID string
 	for rows.Next() {
 		var eventType string
 		var eventData []byte
-		var occurredAt time.Time
 
-		if err := rows.Scan(&eventType, &eventData, &occurredAt); err != nil {
+		if err := rows.Scan(&eventType, &eventData); err != nil {
 			return nil, errors.Wrap(errors.ErrInternal, "failed to scan event", err)
 		}
 
-		// Deserialize based on event type
-		var event domain.DomainEvent
-		switch eventType {
-		case "OrderCreated":
-			event = &domain.OrderCreatedEvent{}
-		case "OrderPaid":
-			event = &domain.OrderPaidEvent{}
-		case "OrderShipped":
-			event = &domain.OrderShippedEvent{}
-		case "OrderCompleted":
-			event = &domain.OrderCompletedEvent{}
-		case "OrderCancelled":
-			event = &domain.OrderCancelledEvent{}
-		default:
-			r.logger.Warnf("Unknown event type: %s", eventType)
-			continue
-		}
-
-		if err := json.Unmarshal(eventData, event); err != nil {
-			return nil, errors.Wrap(errors.ErrInternal, "failed to unmarshal event", err)
+		event, err := domain.DecodeEvent(eventType, eventData)
+		if err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to decode event", err)
 		}
 
 		events = append(events, event)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to read events", err)
+	}
+
 	return events, nil
 }
 
-// Read model repository
-type OrderReadModelRepository struct {
-	db     *sql.DB
-	logger *logger.Logger
-}
+// ReadAll reads the global event stream in sequence order
+func (r *EventStoreRepository) ReadAll(ctx context.Context, afterSequence int64, limit int) ([]domain.RecordedEvent, error) {
+	query := `
+		SELECT id, aggregate_id, version, event_type, event_data
+		FROM events
+		WHERE id > $1
+		ORDER BY id ASC
+		LIMIT $2
+	`
 
-func NewOrderReadModelRepository(databaseURL string, logger *logger.Logger) (*OrderReadModelRepository, error) {
-	db, err := sql.Open("postgres", databaseURL)
+	rows, err := r.db.QueryContext(ctx, query, afterSequence, limit)
 	if err != nil {
-		return nil, errors.Wrap(errors.ErrInternal, "failed to connect to database", err)
+		return nil, errors.Wrap(errors.ErrInternal, "failed to query events", err)
 	}
+	defer rows.Close()
 
-	logger.Info("Order read model repository initialized")
-	return &OrderReadModelRepository{db: db, logger: logger}, nil
-}
+	var records []domain.RecordedEvent
+	for rows.Next() {
+		var record domain.RecordedEvent
+		var eventType string
+		var eventData []byte
 
-// Save saves an order to the read model
-func (r *OrderReadModelRepository) Save(ctx context.Context, order *domain.Order) error {
-	return r.SaveReadModel(ctx, order)
-}
+		if err := rows.Scan(&record.Sequence, &record.AggregateID, &record.Version, &eventType, &eventData); err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to scan event", err)
+		}
 
-// Update updates an order in the read model
-func (r *OrderReadModelRepository) Update(ctx context.Context, order *domain.Order) error {
-	return r.SaveReadModel(ctx, order)
+		record.Event, err = domain.DecodeEvent(eventType, eventData)
+		if err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to decode event", err)
+		}
+
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to read events", err)
+	}
+
+	return records, nil
 }
 
-// SaveReadModel updates denormalized read model
-func (r *OrderReadModelRepository) SaveReadModel(ctx context.Context, order *domain.Order) error {
-	itemsJSON, err := json.Marshal(order.Items)
-	if err != nil {
-		return errors.Wrap(errors.ErrInternal, "failed to marshal items", err)
+// HeadSequence returns the global sequence of the newest stored event
+func (r *EventStoreRepository) HeadSequence(ctx context.Context) (int64, error) {
+	var sequence int64
+	if err := r.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM events").Scan(&sequence); err != nil {
+		return 0, errors.Wrap(errors.ErrInternal, "failed to read head sequence", err)
 	}
+	return sequence, nil
+}
 
-	query := `
-		INSERT INTO orders_read_model (order_id, user_id, status, total_amount, items, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		ON CONFLICT (order_id) DO UPDATE SET
-			status = EXCLUDED.status,
-			updated_at = EXCLUDED.updated_at
-	`
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return stderrors.As(err, &pqErr) && pqErr.Code == "23505"
+}
 
-	_, err = r.db.ExecContext(ctx, query,
-		order.ID, order.UserID, order.Status, order.TotalAmount, itemsJSON,
-		order.CreatedAt, order.UpdatedAt)
+// Read model repository
+type OrderReadModelRepository struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
 
+func NewOrderReadModelRepository(databaseURL string, logger *logger.Logger) (*OrderReadModelRepository, error) {
+	db, err := sql.Open("postgres", databaseURL)
 	if err != nil {
-		return errors.Wrap(errors.ErrInternal, "failed to save read model", err)
+		return nil, errors.Wrap(errors.ErrInternal, "failed to connect to database", err)
 	}
 
-	return nil
+	logger.Info("Order read model repository initialized")
+	return &OrderReadModelRepository{db: db, logger: logger}, nil
 }
 
 // FindByID retrieves order from read model
 func (r *OrderReadModelRepository) FindByID(ctx context.Context, orderID string) (*domain.Order, error) {
 	query := `
-		SELECT order_id, user_id, status, total_amount, items, created_at, updated_at
+		SELECT order_id, user_id, status, total_amount, items, shipping_address, created_at, updated_at, version
 		FROM orders_read_model
 		WHERE order_id = $1
 	`
@@ -220,7 +225,7 @@ func (r *OrderReadModelRepository) FindByID(ctx context.Context, orderID string)
 
 	err := r.db.QueryRowContext(ctx, query, orderID).Scan(
 		&order.ID, &order.UserID, &order.Status, &order.TotalAmount,
-		&itemsJSON, &order.CreatedAt, &order.UpdatedAt)
+		&itemsJSON, &order.ShippingAddress, &order.CreatedAt, &order.UpdatedAt, &order.Version)
 
 	if err == sql.ErrNoRows {
 		return nil, errors.New(errors.ErrNotFound, "order not found")
@@ -233,13 +238,17 @@ func (r *OrderReadModelRepository) FindByID(ctx context.Context, orderID string)
 		return nil, errors.Wrap(errors.ErrInternal, "failed to unmarshal items", err)
 	}
 
+	if err := r.attachSubOrders(ctx, &order); err != nil {
+		return nil, err
+	}
+
 	return &order, nil
 }
 
 // FindByUserID retrieves orders for a user
 func (r *OrderReadModelRepository) FindByUserID(ctx context.Context, userID string, limit, offset int) ([]*domain.Order, error) {
 	query := `
-		SELECT order_id, user_id, status, total_amount, items, created_at, updated_at
+		SELECT order_id, user_id, status, total_amount, items, shipping_address, created_at, updated_at, version
 		FROM orders_read_model
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -258,7 +267,7 @@ func (r *OrderReadModelRepository) FindByUserID(ctx context.Context, userID stri
 		var itemsJSON []byte
 
 		if err := rows.Scan(&order.ID, &order.UserID, &order.Status, &order.TotalAmount,
-			&itemsJSON, &order.CreatedAt, &order.UpdatedAt); err != nil {
+			&itemsJSON, &order.ShippingAddress, &order.CreatedAt, &order.UpdatedAt, &order.Version); err != nil {
 			return nil, errors.Wrap(errors.ErrInternal, "failed to scan order", err)
 		}
 
@@ -269,5 +278,9 @@ func (r *OrderReadModelRepository) FindByUserID(ctx context.Context, userID stri
 		orders = append(orders, &order)
 	}
 
+	if err := r.attachSubOrders(ctx, orders...); err != nil {
+		return nil, err
+	}
+
 	return orders, nil
 }
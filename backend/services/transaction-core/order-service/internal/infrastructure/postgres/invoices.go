@@ -0,0 +1,138 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+const invoiceColumns = `invoice_id, number, kind, order_id, user_id, credited_invoice_id, reference, reason,
+	billing_address, country, region, pricing, lines, net, tax, gross, issued_at`
+
+// InvoiceRepository stores invoices and credit notes. Numbers come from a
+// counter row per series that is bumped in the same transaction as the
+// insert, so a failed insert gives its number back.
+type InvoiceRepository struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
+
+func NewInvoiceRepository(databaseURL string, logger *logger.Logger) (*InvoiceRepository, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to connect to database", err)
+	}
+
+	logger.Info("Invoice repository initialized")
+	return &InvoiceRepository{db: db, logger: logger}, nil
+}
+
+// Save numbers and inserts a new invoice or credit note
+func (r *InvoiceRepository) Save(ctx context.Context, inv *domain.Invoice) error {
+	linesJSON, err := json.Marshal(inv.Lines)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to marshal invoice lines", err)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	// The row lock taken by the upsert serializes numbering within a series
+	var n int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO invoice_series (series, last_number) VALUES ($1, 1)
+		ON CONFLICT (series) DO UPDATE SET last_number = invoice_series.last_number + 1
+		RETURNING last_number
+	`, inv.Series()).Scan(&n)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to allocate invoice number", err)
+	}
+	inv.AssignNumber(n)
+
+	query := `
+		INSERT INTO invoices (` + invoiceColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+	`
+	_, err = tx.ExecContext(ctx, query,
+		inv.ID, inv.Number, inv.Kind, inv.OrderID, inv.UserID, inv.InvoiceID, inv.Reference, inv.Reason,
+		inv.BillingAddress, inv.Country, inv.Region, inv.Pricing, string(linesJSON), inv.Net, inv.Tax, inv.Gross, inv.IssuedAt)
+	if err != nil {
+		inv.Number = ""
+		if isUniqueViolation(err) {
+			return errors.New(errors.ErrConflict, "a document with this reference was already issued")
+		}
+		return errors.Wrap(errors.ErrInternal, "failed to save invoice", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		inv.Number = ""
+		return errors.Wrap(errors.ErrInternal, "failed to commit invoice", err)
+	}
+	return nil
+}
+
+// FindByID retrieves a single invoice or credit note
+func (r *InvoiceRepository) FindByID(ctx context.Context, invoiceID string) (*domain.Invoice, error) {
+	query := `SELECT ` + invoiceColumns + ` FROM invoices WHERE invoice_id = $1`
+
+	invoices, err := r.query(ctx, query, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(invoices) == 0 {
+		return nil, errors.New(errors.ErrNotFound, "invoice not found")
+	}
+	return invoices[0], nil
+}
+
+// FindByOrderID lists an order's invoice and credit notes, oldest first
+func (r *InvoiceRepository) FindByOrderID(ctx context.Context, orderID string) ([]*domain.Invoice, error) {
+	query := `SELECT ` + invoiceColumns + ` FROM invoices WHERE order_id = $1 ORDER BY issued_at, number`
+	return r.query(ctx, query, orderID)
+}
+
+// FindByReference returns the document issued under a reference, or nil
+func (r *InvoiceRepository) FindByReference(ctx context.Context, reference string) (*domain.Invoice, error) {
+	query := `SELECT ` + invoiceColumns + ` FROM invoices WHERE reference = $1`
+
+	invoices, err := r.query(ctx, query, reference)
+	if err != nil || len(invoices) == 0 {
+		return nil, err
+	}
+	return invoices[0], nil
+}
+
+func (r *InvoiceRepository) query(ctx context.Context, query string, args ...interface{}) ([]*domain.Invoice, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to query invoices", err)
+	}
+	defer rows.Close()
+
+	var invoices []*domain.Invoice
+	for rows.Next() {
+		var inv domain.Invoice
+		var linesJSON []byte
+		if err := rows.Scan(
+			&inv.ID, &inv.Number, &inv.Kind, &inv.OrderID, &inv.UserID, &inv.InvoiceID, &inv.Reference, &inv.Reason,
+			&inv.BillingAddress, &inv.Country, &inv.Region, &inv.Pricing, &linesJSON, &inv.Net, &inv.Tax, &inv.Gross, &inv.IssuedAt,
+		); err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to scan invoice", err)
+		}
+		if err := json.Unmarshal(linesJSON, &inv.Lines); err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to unmarshal invoice lines", err)
+		}
+		invoices = append(invoices, &inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to read invoices", err)
+	}
+	return invoices, nil
+}
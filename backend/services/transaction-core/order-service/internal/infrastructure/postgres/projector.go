@@ -0,0 +1,150 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// OrderProjector builds orders_read_model from order events. Each row keeps
+// the version of the last event applied to it, so events that are projected
+// twice or out of order are skipped.
+type OrderProjector struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
+
+func NewOrderProjector(databaseURL string, logger *logger.Logger) (*OrderProjector, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to connect to database", err)
+	}
+
+	logger.Info("Order read model projector initialized")
+	return &OrderProjector{db: db, logger: logger}, nil
+}
+
+// Project applies events to the read model in a single transaction
+func (p *OrderProjector) Project(ctx context.Context, events []domain.RecordedEvent) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	for _, record := range events {
+		if err := p.apply(ctx, tx, record); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to commit projection", err)
+	}
+	return nil
+}
+
+func (p *OrderProjector) apply(ctx context.Context, tx *sql.Tx, record domain.RecordedEvent) error {
+	if created, ok := record.Event.(*domain.OrderCreatedEvent); ok {
+		return p.applyCreated(ctx, tx, record.Version, created)
+	}
+
+	status, ok := domain.StatusAfter(record.Event)
+	if !ok {
+		return nil
+	}
+
+	query := `
+		UPDATE orders_read_model
+		SET status = $2, updated_at = $3, version = $4
+		WHERE order_id = $1 AND version < $4
+	`
+	_, err := tx.ExecContext(ctx, query,
+		record.AggregateID, status, record.Event.OccurredAt(), record.Version)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to project order status", err)
+	}
+
+	// Sub-order rows carry the version of the last event that touched them
+	subQuery := `
+		UPDATE sub_orders_read_model
+		SET status = $3, updated_at = $4, version = $5
+		WHERE order_id = $1 AND sub_order_id = $2 AND version < $5
+	`
+	switch e := record.Event.(type) {
+	case *domain.SubOrderStatusChangedEvent:
+		_, err = tx.ExecContext(ctx, subQuery,
+			record.AggregateID, e.SubOrderID, e.To, e.ChangedAt, record.Version)
+	case *domain.SubOrderCancelledEvent:
+		_, err = tx.ExecContext(ctx, subQuery,
+			record.AggregateID, e.SubOrderID, domain.OrderStatusCancelled, e.CancelledAt, record.Version)
+	default:
+		if domain.CascadesToSubOrders(record.Event) {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE sub_orders_read_model
+				SET status = $2, updated_at = $3, version = $4
+				WHERE order_id = $1 AND status <> $5 AND version < $4
+			`, record.AggregateID, status, record.Event.OccurredAt(), record.Version, domain.OrderStatusCancelled)
+		}
+	}
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to project sub-order status", err)
+	}
+	return nil
+}
+
+func (p *OrderProjector) applyCreated(ctx context.Context, tx *sql.Tx, version int, created *domain.OrderCreatedEvent) error {
+	itemsJSON, err := json.Marshal(created.Items)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to marshal items", err)
+	}
+
+	query := `
+		INSERT INTO orders_read_model
+			(order_id, user_id, status, total_amount, items, shipping_address, shipping_country,
+			 sort_seller_id, sort_product_id, created_at, updated_at, version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10, $11)
+		ON CONFLICT (order_id) DO NOTHING
+	`
+	_, err = tx.ExecContext(ctx, query,
+		created.OrderID, created.UserID, domain.OrderStatusPending, created.Total,
+		string(itemsJSON), created.ShippingAddress, domain.ShippingCountry(created.ShippingAddress),
+		domain.SortSellerID(created.Items), domain.SortProductID(created.Items),
+		created.CreatedAt, version)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to project order created", err)
+	}
+
+	subQuery := `
+		INSERT INTO sub_orders_read_model
+			(sub_order_id, order_id, seller_id, status, items, items_total, shipping_fee, tax_amount, total, created_at, updated_at, version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10, $11)
+		ON CONFLICT (sub_order_id) DO NOTHING
+	`
+	for _, sub := range created.SubOrders {
+		subItemsJSON, err := json.Marshal(sub.Items)
+		if err != nil {
+			return errors.Wrap(errors.ErrInternal, "failed to marshal items", err)
+		}
+
+		_, err = tx.ExecContext(ctx, subQuery,
+			sub.ID, created.OrderID, sub.SellerID, sub.Status, string(subItemsJSON),
+			sub.ItemsTotal, sub.ShippingFee, sub.TaxAmount, sub.Total, created.CreatedAt, version)
+		if err != nil {
+			return errors.Wrap(errors.ErrInternal, "failed to project sub-order created", err)
+		}
+	}
+	return nil
+}
+
+// Reset empties the read model before a full replay
+func (p *OrderProjector) Reset(ctx context.Context) error {
+	if _, err := p.db.ExecContext(ctx, "TRUNCATE TABLE orders_read_model, sub_orders_read_model"); err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to truncate read model", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+const returnColumns = `return_id, order_id, user_id, status, lines, rejection_reason, shipment_id,
+	carrier, tracking_number, refund_id, refund_amount, created_at, updated_at, version`
+
+// ReturnRepository stores return requests. Unlike orders they are not event
+// sourced; each row holds the current state and a version for optimistic locking.
+type ReturnRepository struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
+
+func NewReturnRepository(databaseURL string, logger *logger.Logger) (*ReturnRepository, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to connect to database", err)
+	}
+
+	logger.Info("Order return repository initialized")
+	return &ReturnRepository{db: db, logger: logger}, nil
+}
+
+// Save inserts a new return. A per-order advisory lock serializes requests for
+// the same order while the count of its returns is checked.
+func (r *ReturnRepository) Save(ctx context.Context, ret *domain.ReturnRequest, knownReturns int) error {
+	linesJSON, err := json.Marshal(ret.Lines)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to marshal return lines", err)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", ret.OrderID); err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to lock order returns", err)
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM order_returns WHERE order_id = $1", ret.OrderID).Scan(&count); err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to count order returns", err)
+	}
+	if count != knownReturns {
+		return errors.New(errors.ErrConflict, "order returns were modified concurrently")
+	}
+
+	query := `
+		INSERT INTO order_returns (` + returnColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	`
+	_, err = tx.ExecContext(ctx, query,
+		ret.ID, ret.OrderID, ret.UserID, ret.Status, string(linesJSON), ret.RejectionReason, ret.ShipmentID,
+		ret.Carrier, ret.TrackingNumber, ret.RefundID, ret.RefundAmount, ret.CreatedAt, ret.UpdatedAt, ret.Version)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to save return", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to commit return", err)
+	}
+	return nil
+}
+
+// Update stores a changed return if nobody else changed it since it was loaded
+func (r *ReturnRepository) Update(ctx context.Context, ret *domain.ReturnRequest) error {
+	linesJSON, err := json.Marshal(ret.Lines)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to marshal return lines", err)
+	}
+
+	query := `
+		UPDATE order_returns
+		SET status = $2, lines = $3, rejection_reason = $4, shipment_id = $5, carrier = $6,
+			tracking_number = $7, refund_id = $8, refund_amount = $9, updated_at = $10, version = $11
+		WHERE return_id = $1 AND version = $12
+	`
+	result, err := r.db.ExecContext(ctx, query,
+		ret.ID, ret.Status, string(linesJSON), ret.RejectionReason, ret.ShipmentID, ret.Carrier,
+		ret.TrackingNumber, ret.RefundID, ret.RefundAmount, ret.UpdatedAt, ret.Version, ret.Version-1)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to update return", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to get rows affected", err)
+	}
+	if rows == 0 {
+		return errors.New(errors.ErrConflict, "return was modified by another transaction (optimistic lock)")
+	}
+	return nil
+}
+
+// FindByID retrieves a single return
+func (r *ReturnRepository) FindByID(ctx context.Context, returnID string) (*domain.ReturnRequest, error) {
+	query := `SELECT ` + returnColumns + ` FROM order_returns WHERE return_id = $1`
+
+	returns, err := r.query(ctx, query, returnID)
+	if err != nil {
+		return nil, err
+	}
+	if len(returns) == 0 {
+		return nil, errors.New(errors.ErrNotFound, "return not found")
+	}
+	return returns[0], nil
+}
+
+// FindByOrderID lists an order's returns, oldest first
+func (r *ReturnRepository) FindByOrderID(ctx context.Context, orderID string) ([]*domain.ReturnRequest, error) {
+	query := `SELECT ` + returnColumns + ` FROM order_returns WHERE order_id = $1 ORDER BY created_at`
+	return r.query(ctx, query, orderID)
+}
+
+func (r *ReturnRepository) query(ctx context.Context, query string, args ...interface{}) ([]*domain.ReturnRequest, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to query returns", err)
+	}
+	defer rows.Close()
+
+	var returns []*domain.ReturnRequest
+	for rows.Next() {
+		var ret domain.ReturnRequest
+		var linesJSON []byte
+		if err := rows.Scan(
+			&ret.ID, &ret.OrderID, &ret.UserID, &ret.Status, &linesJSON, &ret.RejectionReason, &ret.ShipmentID,
+			&ret.Carrier, &ret.TrackingNumber, &ret.RefundID, &ret.RefundAmount, &ret.CreatedAt, &ret.UpdatedAt, &ret.Version,
+		); err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to scan return", err)
+		}
+		if err := json.Unmarshal(linesJSON, &ret.Lines); err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to unmarshal return lines", err)
+		}
+		returns = append(returns, &ret)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to read returns", err)
+	}
+	return returns, nil
+}
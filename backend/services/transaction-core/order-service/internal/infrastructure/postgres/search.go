@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+const orderColumns = `order_id, user_id, status, total_amount, items, shipping_address, created_at, updated_at, version`
+
+// sortColumns maps the sort fields that are not read model columns of the
+// same name to the columns projected for them
+var sortColumns = map[domain.OrderSortField]string{
+	domain.SortBySellerID:  "sort_seller_id",
+	domain.SortByProductID: "sort_product_id",
+}
+
+// Search returns one page of orders matching the search
+func (r *OrderReadModelRepository) Search(ctx context.Context, q domain.OrderSearch) ([]*domain.Order, error) {
+	query, args := searchQuery(q)
+	args = append(args, q.Limit, q.Offset)
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	var orders []*domain.Order
+	err := r.scanOrders(ctx, query, args, func(order *domain.Order) error {
+		orders = append(orders, order)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.attachSubOrders(ctx, orders...); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// SearchEach streams every matching order to fn as rows arrive, so exports
+// never hold the whole result set in memory
+func (r *OrderReadModelRepository) SearchEach(ctx context.Context, q domain.OrderSearch, fn func(*domain.Order) error) error {
+	query, args := searchQuery(q)
+	return r.scanOrders(ctx, query, args, fn)
+}
+
+// searchQuery builds the filtered, sorted SELECT for a search. Sort fields
+// come from a fixed set validated by OrderSearch, never from raw input.
+func searchQuery(q domain.OrderSearch) (string, []interface{}) {
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if len(q.Statuses) > 0 {
+		statuses := make([]string, len(q.Statuses))
+		for i, status := range q.Statuses {
+			statuses[i] = string(status)
+		}
+		where = append(where, "status = ANY("+arg(pq.Array(statuses))+")")
+	}
+	if !q.CreatedFrom.IsZero() {
+		where = append(where, "created_at >= "+arg(q.CreatedFrom))
+	}
+	if !q.CreatedTo.IsZero() {
+		where = append(where, "created_at < "+arg(q.CreatedTo))
+	}
+	if q.MinTotal != nil {
+		where = append(where, "total_amount >= "+arg(*q.MinTotal))
+	}
+	if q.MaxTotal != nil {
+		where = append(where, "total_amount <= "+arg(*q.MaxTotal))
+	}
+	// Seller and product match inside items, using its GIN index
+	if q.SellerID != "" {
+		where = append(where, "items @> "+arg(itemContains("SellerID", q.SellerID))+"::jsonb")
+	}
+	if q.ProductID != "" {
+		where = append(where, "items @> "+arg(itemContains("ProductID", q.ProductID))+"::jsonb")
+	}
+	if q.ShippingCountry != "" {
+		where = append(where, "shipping_country = "+arg(q.ShippingCountry))
+	}
+
+	query := `SELECT ` + orderColumns + ` FROM orders_read_model`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	direction := "ASC"
+	if q.Descending {
+		direction = "DESC"
+	}
+	column, ok := sortColumns[q.SortBy]
+	if !ok {
+		column = string(q.SortBy)
+	}
+	// order_id breaks ties so pages are stable
+	query += fmt.Sprintf(" ORDER BY %s %s, order_id %s", column, direction, direction)
+	return query, args
+}
+
+// itemContains is a JSONB containment pattern matching any item with the field
+func itemContains(field, value string) string {
+	pattern, _ := json.Marshal([]map[string]string{{field: value}})
+	return string(pattern)
+}
+
+func (r *OrderReadModelRepository) scanOrders(ctx context.Context, query string, args []interface{}, fn func(*domain.Order) error) error {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to search orders", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var order domain.Order
+		var itemsJSON []byte
+
+		if err := rows.Scan(&order.ID, &order.UserID, &order.Status, &order.TotalAmount,
+			&itemsJSON, &order.ShippingAddress, &order.CreatedAt, &order.UpdatedAt, &order.Version); err != nil {
+			return errors.Wrap(errors.ErrInternal, "failed to scan order", err)
+		}
+
+		if err := json.Unmarshal(itemsJSON, &order.Items); err != nil {
+			return errors.Wrap(errors.ErrInternal, "failed to unmarshal items", err)
+		}
+
+		if err := fn(&order); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to read orders", err)
+	}
+	return nil
+}
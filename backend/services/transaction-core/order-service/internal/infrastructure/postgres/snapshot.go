@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// DefaultSnapshotEvery is how many events an order accumulates between
+// automatic snapshots
+const DefaultSnapshotEvery = 50
+
+// SetSnapshotEvery changes the automatic snapshot interval; zero disables
+// automatic snapshots
+func (r *EventStoreRepository) SetSnapshotEvery(n int) {
+	r.snapshotEvery = n
+}
+
+// LoadOrder rebuilds an order from its latest snapshot and the events stored
+// after it. A snapshot this build can't read is ignored and the full stream
+// is replayed instead.
+func (r *EventStoreRepository) LoadOrder(ctx context.Context, orderID string) (*domain.Order, error) {
+	snapshot, err := r.latestSnapshot(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if snapshot != nil {
+		events, err := r.getEventsAfter(ctx, orderID, snapshot.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		order, err := domain.RestoreOrder(snapshot, events)
+		if err == nil {
+			return order, nil
+		}
+		r.logger.Warnf("Ignoring snapshot of order %s at version %d: %v", orderID, snapshot.Version, err)
+	}
+
+	events, err := r.GetEvents(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return domain.RehydrateOrder(events)
+}
+
+// SaveOrder appends the order's uncommitted events and takes a snapshot when
+// the order crosses a multiple of the snapshot interval
+func (r *EventStoreRepository) SaveOrder(ctx context.Context, order *domain.Order) error {
+	expectedVersion := order.ExpectedVersion()
+	if err := r.SaveEvents(ctx, order.ID, order.UncommittedEvents(), expectedVersion); err != nil {
+		return err
+	}
+	order.MarkCommitted()
+
+	if r.snapshotEvery > 0 && expectedVersion/r.snapshotEvery != order.Version/r.snapshotEvery {
+		// The events are stored; a missing snapshot only costs a longer replay
+		if err := r.SaveSnapshot(ctx, order); err != nil {
+			r.logger.Errorf(err, "Failed to snapshot order %s", order.ID)
+		}
+	}
+	return nil
+}
+
+// SaveSnapshot stores a snapshot of the order's committed state and drops
+// older snapshots of it
+func (r *EventStoreRepository) SaveSnapshot(ctx context.Context, order *domain.Order) error {
+	snapshot, err := order.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO order_snapshots (aggregate_id, version, schema_version, data, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (aggregate_id, version) DO UPDATE SET
+			schema_version = EXCLUDED.schema_version,
+			data = EXCLUDED.data,
+			created_at = EXCLUDED.created_at
+	`, snapshot.AggregateID, snapshot.Version, snapshot.Schema, string(snapshot.Data), snapshot.CreatedAt)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to save snapshot", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM order_snapshots WHERE aggregate_id = $1 AND version < $2",
+		snapshot.AggregateID, snapshot.Version)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to prune snapshots", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to commit snapshot", err)
+	}
+	return nil
+}
+
+// latestSnapshot returns the newest snapshot of an aggregate, or nil if it
+// has none
+func (r *EventStoreRepository) latestSnapshot(ctx context.Context, aggregateID string) (*domain.Snapshot, error) {
+	query := `
+		SELECT aggregate_id, version, schema_version, data, created_at
+		FROM order_snapshots
+		WHERE aggregate_id = $1
+		ORDER BY version DESC
+		LIMIT 1
+	`
+
+	var snapshot domain.Snapshot
+	err := r.db.QueryRowContext(ctx, query, aggregateID).Scan(
+		&snapshot.AggregateID, &snapshot.Version, &snapshot.Schema, &snapshot.Data, &snapshot.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to load snapshot", err)
+	}
+	return &snapshot, nil
+}
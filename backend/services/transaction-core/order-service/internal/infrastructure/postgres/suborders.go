@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/lib/pq"
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+const subOrderColumns = `sub_order_id, order_id, seller_id, status, items, items_total, shipping_fee, tax_amount, total`
+
+// FindSubOrder retrieves a single sub-order from the read model
+func (r *OrderReadModelRepository) FindSubOrder(ctx context.Context, subOrderID string) (*domain.SubOrder, error) {
+	query := `SELECT ` + subOrderColumns + ` FROM sub_orders_read_model WHERE sub_order_id = $1`
+
+	subs, err := r.querySubOrders(ctx, query, subOrderID)
+	if err != nil {
+		return nil, err
+	}
+	if len(subs) == 0 {
+		return nil, errors.New(errors.ErrNotFound, "sub-order not found")
+	}
+	return subs[0], nil
+}
+
+// FindSubOrdersBySeller lists the sub-orders a seller has to fulfil, newest first
+func (r *OrderReadModelRepository) FindSubOrdersBySeller(ctx context.Context, sellerID string, limit, offset int) ([]*domain.SubOrder, error) {
+	query := `
+		SELECT ` + subOrderColumns + `
+		FROM sub_orders_read_model
+		WHERE seller_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+	return r.querySubOrders(ctx, query, sellerID, limit, offset)
+}
+
+// attachSubOrders loads the sub-orders of the given orders in one query
+func (r *OrderReadModelRepository) attachSubOrders(ctx context.Context, orders ...*domain.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]*domain.Order, len(orders))
+	ids := make([]string, len(orders))
+	for i, order := range orders {
+		byID[order.ID] = order
+		ids[i] = order.ID
+	}
+
+	query := `
+		SELECT ` + subOrderColumns + `
+		FROM sub_orders_read_model
+		WHERE order_id = ANY($1)
+		ORDER BY created_at, sub_order_id
+	`
+	subs, err := r.querySubOrders(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		order := byID[sub.OrderID]
+		order.SubOrders = append(order.SubOrders, *sub)
+	}
+	return nil
+}
+
+func (r *OrderReadModelRepository) querySubOrders(ctx context.Context, query string, args ...interface{}) ([]*domain.SubOrder, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to query sub-orders", err)
+	}
+	defer rows.Close()
+
+	var subs []*domain.SubOrder
+	for rows.Next() {
+		var sub domain.SubOrder
+		var itemsJSON []byte
+
+		if err := rows.Scan(&sub.ID, &sub.OrderID, &sub.SellerID, &sub.Status, &itemsJSON,
+			&sub.ItemsTotal, &sub.ShippingFee, &sub.TaxAmount, &sub.Total); err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to scan sub-order", err)
+		}
+
+		if err := json.Unmarshal(itemsJSON, &sub.Items); err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to unmarshal items", err)
+		}
+
+		subs = append(subs, &sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to read sub-orders", err)
+	}
+	return subs, nil
+}
@@ -0,0 +1,54 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+const (
+	// PaymentEventsStream is where payment-service announces payments
+	PaymentEventsStream = "payment_events"
+
+	PaymentEventCompleted = "PaymentCompleted"
+)
+
+// PaymentEvent is what payment-service publishes about a payment
+type PaymentEvent struct {
+	Type       string    `json:"type"`
+	PaymentID  string    `json:"payment_id"`
+	OrderID    string    `json:"order_id"`
+	UserID     string    `json:"user_id"`
+	Amount     float64   `json:"amount"`
+	Currency   string    `json:"currency"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// PaymentEventHandler acts on a payment event. An event is acknowledged
+// once its handler returns nil and delivered again otherwise, so handlers
+// must be idempotent.
+type PaymentEventHandler func(ctx context.Context, event PaymentEvent) error
+
+// RedisPaymentEventConsumer reads payment-service's event stream as a
+// member of the order-service consumer group
+type RedisPaymentEventConsumer struct {
+	*streamConsumer
+}
+
+// NewRedisPaymentEventConsumer connects to Redis; consumer names this
+// replica within the group, e.g. its hostname
+func NewRedisPaymentEventConsumer(addr, password, consumer string, handler PaymentEventHandler, logger *logger.Logger) (*RedisPaymentEventConsumer, error) {
+	stream, err := newStreamConsumer(addr, password, PaymentEventsStream, consumer, func(ctx context.Context, data []byte) error {
+		var event PaymentEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return malformedEvent{err}
+		}
+		return handler(ctx, event)
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisPaymentEventConsumer{stream}, nil
+}
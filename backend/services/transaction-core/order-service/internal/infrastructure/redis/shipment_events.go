@@ -0,0 +1,54 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+const (
+	// ShipmentEventsStream is where shipping-service announces outbound
+	// shipments
+	ShipmentEventsStream = "shipment_events"
+
+	ShipmentEventCreated   = "ShipmentCreated"
+	ShipmentEventDelivered = "ShipmentDelivered"
+)
+
+// ShipmentEvent is what shipping-service publishes about a shipment
+type ShipmentEvent struct {
+	Type           string    `json:"type"`
+	ShipmentID     string    `json:"shipment_id"`
+	OrderID        string    `json:"order_id"`
+	SubOrderID     string    `json:"sub_order_id"` // Empty if the whole order shipped
+	Carrier        string    `json:"carrier"`
+	TrackingNumber string    `json:"tracking_number"`
+	OccurredAt     time.Time `json:"occurred_at"`
+}
+
+// ShipmentEventHandler acts on a shipment event, like PaymentEventHandler
+type ShipmentEventHandler func(ctx context.Context, event ShipmentEvent) error
+
+// RedisShipmentEventConsumer reads shipping-service's event stream as a
+// member of the order-service consumer group
+type RedisShipmentEventConsumer struct {
+	*streamConsumer
+}
+
+// NewRedisShipmentEventConsumer connects to Redis; consumer names this
+// replica within the group, e.g. its hostname
+func NewRedisShipmentEventConsumer(addr, password, consumer string, handler ShipmentEventHandler, logger *logger.Logger) (*RedisShipmentEventConsumer, error) {
+	stream, err := newStreamConsumer(addr, password, ShipmentEventsStream, consumer, func(ctx context.Context, data []byte) error {
+		var event ShipmentEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return malformedEvent{err}
+		}
+		return handler(ctx, event)
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisShipmentEventConsumer{stream}, nil
+}
@@ -0,0 +1,150 @@
+package infrastructure
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+const (
+	// EventsGroup is the consumer group every order-service replica joins on
+	// each stream it reads, so each event is handled by one of them
+	EventsGroup = "order-service"
+
+	eventsBatch = 100
+	eventsBlock = 5 * time.Second
+	// An event a replica read but never acknowledged, e.g. because handling
+	// failed or the replica died, is claimed again after this long
+	eventsClaimIdle = time.Minute
+)
+
+// malformedEvent marks an event that cannot be decoded; it would fail the
+// same way every time, so it is dropped rather than redelivered
+type malformedEvent struct{ err error }
+
+func (e malformedEvent) Error() string { return e.err.Error() }
+
+// streamConsumer reads a Redis stream as a member of EventsGroup. An event
+// is acknowledged once handle returns nil and delivered again otherwise.
+type streamConsumer struct {
+	client   *redis.Client
+	stream   string
+	consumer string
+	handle   func(ctx context.Context, data []byte) error
+	logger   *logger.Logger
+}
+
+func newStreamConsumer(addr, password, stream, consumer string, handle func(ctx context.Context, data []byte) error, logger *logger.Logger) (*streamConsumer, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       0,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to connect to Redis", err)
+	}
+
+	return &streamConsumer{
+		client:   client,
+		stream:   stream,
+		consumer: consumer,
+		handle:   handle,
+		logger:   logger,
+	}, nil
+}
+
+// Run handles events until ctx is cancelled. Events published before the
+// group was first created are handled too.
+func (c *streamConsumer) Run(ctx context.Context) {
+	defer c.client.Close()
+
+	for ctx.Err() == nil {
+		if err := c.client.XGroupCreateMkStream(ctx, c.stream, EventsGroup, "0").Err(); err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			c.logger.Errorf(err, "Failed to create %s consumer group", c.stream)
+			sleep(ctx, eventsBlock)
+			continue
+		}
+		break
+	}
+
+	for ctx.Err() == nil {
+		if err := c.poll(ctx); err != nil && ctx.Err() == nil {
+			c.logger.Errorf(err, "Failed to read %s", c.stream)
+			sleep(ctx, eventsBlock)
+		}
+	}
+}
+
+func (c *streamConsumer) poll(ctx context.Context) error {
+	// Take over what went unacknowledged for too long, ours included
+	claimed, _, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   c.stream,
+		Group:    EventsGroup,
+		Consumer: c.consumer,
+		MinIdle:  eventsClaimIdle,
+		Start:    "0-0",
+		Count:    eventsBatch,
+	}).Result()
+	if err != nil {
+		return err
+	}
+	for _, msg := range claimed {
+		c.deliver(ctx, msg)
+	}
+
+	streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    EventsGroup,
+		Consumer: c.consumer,
+		Streams:  []string{c.stream, ">"},
+		Count:    eventsBatch,
+		Block:    eventsBlock,
+	}).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			c.deliver(ctx, msg)
+		}
+	}
+	return nil
+}
+
+func (c *streamConsumer) deliver(ctx context.Context, msg redis.XMessage) {
+	data, _ := msg.Values["event"].(string)
+	err := c.handle(ctx, []byte(data))
+	if malformed, ok := err.(malformedEvent); ok {
+		c.logger.Errorf(malformed.err, "Dropping malformed event %s from %s", msg.ID, c.stream)
+		c.ack(ctx, msg.ID)
+		return
+	}
+	if err != nil {
+		c.logger.Errorf(err, "Failed to handle event %s from %s: type=%v, order=%v", msg.ID, c.stream, msg.Values["type"], msg.Values["order_id"])
+		return
+	}
+	c.ack(ctx, msg.ID)
+}
+
+func (c *streamConsumer) ack(ctx context.Context, id string) {
+	if err := c.client.XAck(ctx, c.stream, EventsGroup, id).Err(); err != nil {
+		// Handled again once claimed; handlers are idempotent
+		c.logger.Errorf(err, "Failed to acknowledge event %s from %s", id, c.stream)
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,126 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// InvoiceRenderer renders invoices and credit notes as HTML pages and PDF
+// documents
+type InvoiceRenderer struct {
+	Issuer string // Legal name printed in the document header
+	html   *template.Template
+}
+
+func NewInvoiceRenderer(issuer string) *InvoiceRenderer {
+	return &InvoiceRenderer{
+		Issuer: issuer,
+		html: template.Must(template.New("invoice").Funcs(template.FuncMap{
+			"money":   func(v float64) string { return fmt.Sprintf("%.2f", v) },
+			"percent": func(v float64) string { return fmt.Sprintf("%g%%", v*100) },
+			"title":   title,
+			"date":    func(inv *domain.Invoice) string { return inv.IssuedAt.UTC().Format("2006-01-02") },
+		}).Parse(invoiceHTML)),
+	}
+}
+
+// HTML renders the document as a standalone HTML page
+func (r *InvoiceRenderer) HTML(inv *domain.Invoice) ([]byte, error) {
+	var buf bytes.Buffer
+	err := r.html.Execute(&buf, struct {
+		Issuer  string
+		Invoice *domain.Invoice
+	}{r.Issuer, inv})
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to render invoice", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// PDF renders the document as a plain text PDF
+func (r *InvoiceRenderer) PDF(inv *domain.Invoice) ([]byte, error) {
+	text := []string{
+		r.Issuer,
+		"",
+		fmt.Sprintf("%s %s", title(inv), inv.Number),
+		"Issued: " + inv.IssuedAt.UTC().Format("2006-01-02"),
+		"Order: " + inv.OrderID,
+	}
+	if inv.Kind == domain.InvoiceKindCreditNote {
+		text = append(text, "Credits invoice: "+inv.InvoiceID)
+		if inv.Reason != "" {
+			text = append(text, "Reason: "+inv.Reason)
+		}
+	}
+	text = append(text, "Bill to: "+inv.BillingAddress, "Prices: tax "+strings.ToLower(string(inv.Pricing)), "")
+
+	text = append(text, fmt.Sprintf("%-36s %5s %10s %7s %10s %9s %10s", "Item", "Qty", "Unit", "Tax %", "Net", "Tax", "Gross"))
+	for _, line := range inv.Lines {
+		text = append(text, fmt.Sprintf("%-36.36s %5d %10.2f %7s %10.2f %9.2f %10.2f",
+			line.Description, line.Quantity, line.UnitPrice, fmt.Sprintf("%g", line.TaxRate*100), line.Net, line.Tax, line.Gross))
+	}
+	text = append(text, "",
+		fmt.Sprintf("%71s %10.2f", "Net", inv.Net),
+		fmt.Sprintf("%71s %10.2f", "Tax", inv.Tax),
+		fmt.Sprintf("%71s %10.2f", "Total", inv.Gross),
+	)
+	return writePDF(text), nil
+}
+
+func title(inv *domain.Invoice) string {
+	if inv.Kind == domain.InvoiceKindCreditNote {
+		return "Credit note"
+	}
+	return "Invoice"
+}
+
+const invoiceHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{title .Invoice}} {{.Invoice.Number}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; margin: 40px; }
+table { border-collapse: collapse; width: 100%; }
+th, td { padding: 4px 8px; border-bottom: 1px solid #ddd; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+tfoot td { border: none; font-weight: bold; }
+</style>
+</head>
+<body>
+<h2>{{.Issuer}}</h2>
+<h1>{{title .Invoice}} {{.Invoice.Number}}</h1>
+<p>
+Issued: {{date .Invoice}}<br>
+Order: {{.Invoice.OrderID}}<br>
+{{- if .Invoice.InvoiceID}}
+Credits invoice: {{.Invoice.InvoiceID}}<br>
+{{- end}}
+{{- if .Invoice.Reason}}
+Reason: {{.Invoice.Reason}}<br>
+{{- end}}
+Bill to: {{.Invoice.BillingAddress}}
+</p>
+<table>
+<thead>
+<tr><th>Item</th><th>Qty</th><th>Unit price</th><th>Tax rate</th><th>Net</th><th>Tax</th><th>Gross</th></tr>
+</thead>
+<tbody>
+{{- range .Invoice.Lines}}
+<tr><td>{{.Description}}</td><td>{{.Quantity}}</td><td>{{money .UnitPrice}}</td><td>{{percent .TaxRate}}</td><td>{{money .Net}}</td><td>{{money .Tax}}</td><td>{{money .Gross}}</td></tr>
+{{- end}}
+</tbody>
+<tfoot>
+<tr><td colspan="6">Net</td><td>{{money .Invoice.Net}}</td></tr>
+<tr><td colspan="6">Tax</td><td>{{money .Invoice.Tax}}</td></tr>
+<tr><td colspan="6">Total</td><td>{{money .Invoice.Gross}}</td></tr>
+</tfoot>
+</table>
+</body>
+</html>
+`
@@ -0,0 +1,29 @@
+package taxrules
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/titan-commerce/backend/order-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// File is the layout of a tax rules file; see config/tax-rules.example.json
+type File struct {
+	Regimes []domain.TaxRegime `json:"regimes"`
+	Rules   []domain.TaxRule   `json:"rules"`
+}
+
+// Load reads a tax rules file and builds the engine from it
+func Load(path string) (*domain.TaxEngine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to read tax rules", err)
+	}
+
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidInput, "failed to parse tax rules", err)
+	}
+	return domain.NewTaxEngine(file.Rules, file.Regimes)
+}
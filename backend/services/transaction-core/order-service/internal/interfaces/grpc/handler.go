@@ -2,6 +2,7 @@ package grpc
 
 import (
 	"context"
+	"strings"
 
 	"github.com/titan-commerce/backend/order-service/internal/application"
 	"github.com/titan-commerce/backend/order-service/internal/domain"
@@ -10,18 +11,23 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type OrderServiceServer struct {
 	pb.UnimplementedOrderServiceServer
-	service *application.OrderService
-	logger  *logger.Logger
+	service  *application.OrderService
+	returns  *application.ReturnService
+	invoices *application.InvoiceService
+	logger   *logger.Logger
 }
 
-func NewOrderServiceServer(server *grpc.Server, service *application.OrderService, logger *logger.Logger) *OrderServiceServer {
+func NewOrderServiceServer(server *grpc.Server, service *application.OrderService, returns *application.ReturnService, invoices *application.InvoiceService, logger *logger.Logger) *OrderServiceServer {
 	handler := &OrderServiceServer{
-		service: service,
-		logger:  logger,
+		service:  service,
+		returns:  returns,
+		invoices: invoices,
+		logger:   logger,
 	}
 	pb.RegisterOrderServiceServer(server, handler)
 	return handler
@@ -33,12 +39,14 @@ func (s *OrderServiceServer) CreateOrder(ctx context.Context, req *pb.CreateOrde
 		items[i] = domain.OrderItem{
 			ProductID:   item.ProductId,
 			ProductName: item.ProductName,
+			SellerID:    item.SellerId,
+			TaxCategory: item.TaxCategory,
 			Quantity:    int(item.Quantity),
-			UnitPrice:   item.Price,
+			UnitPrice:   item.UnitPrice,
 		}
 	}
 
-	order, err := s.service.CreateOrder(ctx, req.UserId, items, req.ShippingAddress)
+	order, err := s.service.CreateOrder(ctx, req.UserId, items, req.ShippingAddress, req.ShippingFees)
 	if err != nil {
 		s.logger.Error(err, "failed to create order")
 		return nil, status.Error(codes.Internal, err.Error())
@@ -73,27 +81,412 @@ func (s *OrderServiceServer) CancelOrder(ctx context.Context, req *pb.CancelOrde
 }
 
 func (s *OrderServiceServer) UpdateOrderStatus(ctx context.Context, req *pb.UpdateOrderStatusRequest) (*pb.UpdateOrderStatusResponse, error) {
-	return &pb.UpdateOrderStatusResponse{}, nil
+	if req.NewStatus == pb.OrderStatus_ORDER_STATUS_UNSPECIFIED {
+		return nil, status.Error(codes.InvalidArgument, "new_status is required")
+	}
+
+	order, err := s.service.UpdateOrderStatus(ctx, req.OrderId, statusFromProto(req.NewStatus))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &pb.UpdateOrderStatusResponse{
+		Order: domainToProto(order),
+	}, nil
 }
 
-func domainToProto(order *domain.Order) *pb.Order {
-	items := make([]*pb.OrderItem, len(order.Items))
-	for i, item := range order.Items {
+func (s *OrderServiceServer) ListSellerOrders(ctx context.Context, req *pb.ListSellerOrdersRequest) (*pb.ListSellerOrdersResponse, error) {
+	limit := int(req.PageSize)
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	subs, err := s.service.ListSellerOrders(ctx, req.SellerId, limit, int(req.Offset))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &pb.ListSellerOrdersResponse{}
+	for _, sub := range subs {
+		resp.SubOrders = append(resp.SubOrders, subOrderToProto(*sub))
+	}
+	return resp, nil
+}
+
+func (s *OrderServiceServer) UpdateSubOrderStatus(ctx context.Context, req *pb.UpdateSubOrderStatusRequest) (*pb.UpdateSubOrderStatusResponse, error) {
+	if req.NewStatus == pb.OrderStatus_ORDER_STATUS_UNSPECIFIED {
+		return nil, status.Error(codes.InvalidArgument, "new_status is required")
+	}
+
+	sub, err := s.service.UpdateSubOrderStatus(ctx, req.SubOrderId, statusFromProto(req.NewStatus))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.UpdateSubOrderStatusResponse{SubOrder: subOrderToProto(*sub)}, nil
+}
+
+func (s *OrderServiceServer) CancelSubOrder(ctx context.Context, req *pb.CancelSubOrderRequest) (*pb.CancelSubOrderResponse, error) {
+	sub, err := s.service.CancelSubOrder(ctx, req.SubOrderId, req.Reason)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.CancelSubOrderResponse{SubOrder: subOrderToProto(*sub)}, nil
+}
+
+func (s *OrderServiceServer) RequestReturn(ctx context.Context, req *pb.RequestReturnRequest) (*pb.RequestReturnResponse, error) {
+	lines := make([]domain.ReturnLineRequest, len(req.Lines))
+	for i, line := range req.Lines {
+		lines[i] = domain.ReturnLineRequest{
+			ProductID: line.ProductId,
+			Quantity:  int(line.Quantity),
+			Reason:    line.Reason,
+		}
+	}
+
+	ret, err := s.returns.RequestReturn(ctx, req.OrderId, req.UserId, lines)
+	if err != nil {
+		s.logger.Error(err, "failed to request return")
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.RequestReturnResponse{Return: returnToProto(ret)}, nil
+}
+
+func (s *OrderServiceServer) GetReturn(ctx context.Context, req *pb.GetReturnRequest) (*pb.GetReturnResponse, error) {
+	ret, err := s.returns.GetReturn(ctx, req.ReturnId)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &pb.GetReturnResponse{Return: returnToProto(ret)}, nil
+}
+
+func (s *OrderServiceServer) ListOrderReturns(ctx context.Context, req *pb.ListOrderReturnsRequest) (*pb.ListOrderReturnsResponse, error) {
+	returns, err := s.returns.ListOrderReturns(ctx, req.OrderId)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &pb.ListOrderReturnsResponse{}
+	for _, ret := range returns {
+		resp.Returns = append(resp.Returns, returnToProto(ret))
+	}
+	return resp, nil
+}
+
+func (s *OrderServiceServer) ApproveReturn(ctx context.Context, req *pb.ApproveReturnRequest) (*pb.ApproveReturnResponse, error) {
+	ret, err := s.returns.ApproveReturn(ctx, req.ReturnId)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.ApproveReturnResponse{Return: returnToProto(ret)}, nil
+}
+
+func (s *OrderServiceServer) RejectReturn(ctx context.Context, req *pb.RejectReturnRequest) (*pb.RejectReturnResponse, error) {
+	ret, err := s.returns.RejectReturn(ctx, req.ReturnId, req.Reason)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.RejectReturnResponse{Return: returnToProto(ret)}, nil
+}
+
+func (s *OrderServiceServer) ReceiveReturn(ctx context.Context, req *pb.ReceiveReturnRequest) (*pb.ReceiveReturnResponse, error) {
+	ret, err := s.returns.ReceiveReturn(ctx, req.ReturnId)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.ReceiveReturnResponse{Return: returnToProto(ret)}, nil
+}
+
+func (s *OrderServiceServer) InspectReturn(ctx context.Context, req *pb.InspectReturnRequest) (*pb.InspectReturnResponse, error) {
+	inspections := make([]domain.ReturnInspection, len(req.Inspections))
+	for i, inspection := range req.Inspections {
+		inspections[i] = domain.ReturnInspection{
+			ProductID:        inspection.ProductId,
+			AcceptedQuantity: int(inspection.AcceptedQuantity),
+			Restock:          inspection.Restock,
+		}
+	}
+
+	ret, err := s.returns.InspectReturn(ctx, req.ReturnId, inspections)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.InspectReturnResponse{Return: returnToProto(ret)}, nil
+}
+
+func (s *OrderServiceServer) SearchOrders(ctx context.Context, req *pb.SearchOrdersRequest) (*pb.SearchOrdersResponse, error) {
+	q := searchFromProto(req.Filter)
+	q.Limit = int(req.PageSize)
+	q.Offset = int(req.Offset)
+
+	orders, err := s.service.SearchOrders(ctx, q)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	resp := &pb.SearchOrdersResponse{}
+	for _, order := range orders {
+		resp.Orders = append(resp.Orders, domainToProto(order))
+	}
+	return resp, nil
+}
+
+func (s *OrderServiceServer) ExportOrders(req *pb.ExportOrdersRequest, stream pb.OrderService_ExportOrdersServer) error {
+	_, err := s.service.ExportOrders(stream.Context(), searchFromProto(req.Filter), &chunkWriter{stream: stream})
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+// chunkWriter sends everything written to it as export chunks
+type chunkWriter struct {
+	stream pb.OrderService_ExportOrdersServer
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	// The stream may hold on to the message, and the CSV writer reuses p
+	data := append([]byte(nil), p...)
+	if err := w.stream.Send(&pb.ExportOrdersChunk{Data: data}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func searchFromProto(filter *pb.OrderSearchFilter) domain.OrderSearch {
+	var q domain.OrderSearch
+	if filter == nil {
+		return q
+	}
+
+	for _, st := range filter.Statuses {
+		q.Statuses = append(q.Statuses, statusFromProto(st))
+	}
+	if filter.CreatedFrom != nil {
+		q.CreatedFrom = filter.CreatedFrom.AsTime()
+	}
+	if filter.CreatedTo != nil {
+		q.CreatedTo = filter.CreatedTo.AsTime()
+	}
+	q.MinTotal = filter.MinTotal
+	q.MaxTotal = filter.MaxTotal
+	q.SellerID = filter.SellerId
+	q.ProductID = filter.ProductId
+	q.ShippingCountry = filter.ShippingCountry
+	if filter.SortBy != pb.OrderSortField_ORDER_SORT_FIELD_UNSPECIFIED {
+		q.SortBy = domain.OrderSortField(strings.ToLower(strings.TrimPrefix(filter.SortBy.String(), "ORDER_SORT_FIELD_")))
+	}
+	q.Descending = filter.Descending
+	return q
+}
+
+// statusFromProto maps ORDER_STATUS_SHIPPED to SHIPPED
+func (s *OrderServiceServer) IssueInvoice(ctx context.Context, req *pb.IssueInvoiceRequest) (*pb.IssueInvoiceResponse, error) {
+	inv, err := s.invoices.IssueInvoice(ctx, req.OrderId)
+	if err != nil {
+		s.logger.Error(err, "failed to issue invoice")
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.IssueInvoiceResponse{Invoice: invoiceToProto(inv)}, nil
+}
+
+func (s *OrderServiceServer) GetInvoice(ctx context.Context, req *pb.GetInvoiceRequest) (*pb.GetInvoiceResponse, error) {
+	inv, err := s.invoices.GetInvoice(ctx, req.InvoiceId)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &pb.GetInvoiceResponse{Invoice: invoiceToProto(inv)}, nil
+}
+
+func (s *OrderServiceServer) ListOrderInvoices(ctx context.Context, req *pb.ListOrderInvoicesRequest) (*pb.ListOrderInvoicesResponse, error) {
+	invoices, err := s.invoices.ListOrderInvoices(ctx, req.OrderId)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &pb.ListOrderInvoicesResponse{}
+	for _, inv := range invoices {
+		resp.Invoices = append(resp.Invoices, invoiceToProto(inv))
+	}
+	return resp, nil
+}
+
+func (s *OrderServiceServer) RenderInvoice(ctx context.Context, req *pb.RenderInvoiceRequest) (*pb.RenderInvoiceResponse, error) {
+	format := application.InvoiceFormatPDF
+	if req.Format == pb.InvoiceFormat_INVOICE_FORMAT_HTML {
+		format = application.InvoiceFormatHTML
+	}
+
+	doc, contentType, err := s.invoices.RenderInvoice(ctx, req.InvoiceId, format)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.RenderInvoiceResponse{Document: doc, ContentType: contentType}, nil
+}
+
+func (s *OrderServiceServer) PaymentCompleted(ctx context.Context, req *pb.PaymentCompletedRequest) (*pb.EventOutcomeResponse, error) {
+	outcome, err := s.service.HandlePaymentCompleted(ctx, application.PaymentCompleted{
+		OrderID:   req.OrderId,
+		PaymentID: req.PaymentId,
+		Amount:    req.Amount,
+	})
+	return outcomeToProto(outcome, err)
+}
+
+func (s *OrderServiceServer) ShipmentCreated(ctx context.Context, req *pb.ShipmentEventRequest) (*pb.EventOutcomeResponse, error) {
+	outcome, err := s.service.HandleShipmentCreated(ctx, shipmentFromProto(req))
+	return outcomeToProto(outcome, err)
+}
+
+func (s *OrderServiceServer) ShipmentDelivered(ctx context.Context, req *pb.ShipmentEventRequest) (*pb.EventOutcomeResponse, error) {
+	outcome, err := s.service.HandleShipmentDelivered(ctx, shipmentFromProto(req))
+	return outcomeToProto(outcome, err)
+}
+
+func shipmentFromProto(req *pb.ShipmentEventRequest) application.ShipmentEvent {
+	return application.ShipmentEvent{
+		OrderID:        req.OrderId,
+		SubOrderID:     req.SubOrderId,
+		TrackingNumber: req.TrackingNumber,
+	}
+}
+
+func outcomeToProto(outcome application.EventOutcome, err error) (*pb.EventOutcomeResponse, error) {
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.EventOutcomeResponse{
+		Outcome: pb.EventOutcome(pb.EventOutcome_value["EVENT_OUTCOME_"+string(outcome)]),
+	}, nil
+}
+
+func statusFromProto(s pb.OrderStatus) domain.OrderStatus {
+	return domain.OrderStatus(strings.TrimPrefix(s.String(), "ORDER_STATUS_"))
+}
+
+func statusToProto(s domain.OrderStatus) pb.OrderStatus {
+	return pb.OrderStatus(pb.OrderStatus_value["ORDER_STATUS_"+string(s)])
+}
+
+func itemsToProto(orderItems []domain.OrderItem) []*pb.OrderItem {
+	items := make([]*pb.OrderItem, len(orderItems))
+	for i, item := range orderItems {
 		items[i] = &pb.OrderItem{
 			ProductId:   item.ProductID,
 			ProductName: item.ProductName,
+			SellerId:    item.SellerID,
+			TaxCategory: item.TaxCategory,
 			Quantity:    int32(item.Quantity),
-			Price:       item.UnitPrice,
+			UnitPrice:   item.UnitPrice,
 		}
 	}
+	return items
+}
+
+func subOrderToProto(sub domain.SubOrder) *pb.SubOrder {
+	return &pb.SubOrder{
+		SubOrderId:  sub.ID,
+		OrderId:     sub.OrderID,
+		SellerId:    sub.SellerID,
+		Items:       itemsToProto(sub.Items),
+		ItemsTotal:  sub.ItemsTotal,
+		ShippingFee: sub.ShippingFee,
+		TaxAmount:   sub.TaxAmount,
+		Total:       sub.Total,
+		Status:      statusToProto(sub.Status),
+	}
+}
+
+func domainToProto(order *domain.Order) *pb.Order {
+	items := itemsToProto(order.Items)
+
+	// The read model keeps tax per sub-order only
+	var taxAmount float64
+	subOrders := make([]*pb.SubOrder, len(order.SubOrders))
+	for i, sub := range order.SubOrders {
+		subOrders[i] = subOrderToProto(sub)
+		taxAmount += sub.TaxAmount
+	}
+	if order.Tax != nil {
+		taxAmount = order.Tax.Tax
+	}
 
 	return &pb.Order{
 		OrderId:         order.ID,
 		UserId:          order.UserID,
 		Items:           items,
 		TotalAmount:     order.TotalAmount,
-		Status:          string(order.Status),
+		Status:          statusToProto(order.Status),
 		ShippingAddress: order.ShippingAddress,
+		SubOrders:       subOrders,
+		TaxAmount:       domain.RoundCents(taxAmount),
 		CreatedAt:       nil,
 	}
 }
+
+func returnToProto(ret *domain.ReturnRequest) *pb.Return {
+	lines := make([]*pb.ReturnLine, len(ret.Lines))
+	for i, line := range ret.Lines {
+		lines[i] = &pb.ReturnLine{
+			ProductId:        line.ProductID,
+			ProductName:      line.ProductName,
+			SellerId:         line.SellerID,
+			Quantity:         int32(line.Quantity),
+			UnitPrice:        line.UnitPrice,
+			Reason:           line.Reason,
+			AcceptedQuantity: int32(line.AcceptedQuantity),
+			Restock:          line.Restock,
+			RefundAmount:     line.RefundAmount,
+		}
+	}
+
+	return &pb.Return{
+		ReturnId:        ret.ID,
+		OrderId:         ret.OrderID,
+		UserId:          ret.UserID,
+		Lines:           lines,
+		Status:          pb.ReturnStatus(pb.ReturnStatus_value["RETURN_STATUS_"+string(ret.Status)]),
+		RejectionReason: ret.RejectionReason,
+		ShipmentId:      ret.ShipmentID,
+		Carrier:         ret.Carrier,
+		TrackingNumber:  ret.TrackingNumber,
+		RefundId:        ret.RefundID,
+		RefundAmount:    ret.RefundAmount,
+		CreatedAt:       timestamppb.New(ret.CreatedAt),
+	}
+}
+
+func invoiceToProto(inv *domain.Invoice) *pb.Invoice {
+	lines := make([]*pb.InvoiceLine, len(inv.Lines))
+	for i, line := range inv.Lines {
+		lines[i] = &pb.InvoiceLine{
+			ProductId:   line.ProductID,
+			SellerId:    line.SellerID,
+			Description: line.Description,
+			Quantity:    int32(line.Quantity),
+			UnitPrice:   line.UnitPrice,
+			TaxRate:     line.TaxRate,
+			Net:         line.Net,
+			Tax:         line.Tax,
+			Gross:       line.Gross,
+		}
+	}
+
+	return &pb.Invoice{
+		InvoiceId:         inv.ID,
+		Number:            inv.Number,
+		Kind:              pb.InvoiceKind(pb.InvoiceKind_value["INVOICE_KIND_"+string(inv.Kind)]),
+		OrderId:           inv.OrderID,
+		UserId:            inv.UserID,
+		CreditedInvoiceId: inv.InvoiceID,
+		Reason:            inv.Reason,
+		BillingAddress:    inv.BillingAddress,
+		Country:           inv.Country,
+		Region:            inv.Region,
+		TaxInclusive:      inv.Pricing == domain.PricingTaxInclusive,
+		Lines:             lines,
+		Net:               inv.Net,
+		Tax:               inv.Tax,
+		Gross:             inv.Gross,
+		IssuedAt:          timestamppb.New(inv.IssuedAt),
+	}
+}
@@ -0,0 +1,33 @@
+-- Event-sourced order storage
+--
+-- events is the source of truth. Its id is the global sequence used to
+-- replay the stream in order; (aggregate_id, version) guards concurrent
+-- appends to the same order. orders_read_model is a projection that can be
+-- dropped and rebuilt from events at any time (see cmd/rebuild-projection).
+
+\c orders;
+
+CREATE TABLE IF NOT EXISTS events (
+    id BIGSERIAL PRIMARY KEY,
+    aggregate_id VARCHAR(255) NOT NULL,
+    aggregate_type VARCHAR(100) NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    event_data JSONB NOT NULL,
+    version INT NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    CONSTRAINT unique_event_aggregate_version UNIQUE (aggregate_id, version)
+);
+
+CREATE TABLE IF NOT EXISTS orders_read_model (
+    order_id VARCHAR(255) PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    total_amount DECIMAL(12,2) NOT NULL,
+    items JSONB NOT NULL,
+    shipping_address TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    version INT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_read_model_user_id ON orders_read_model(user_id, created_at DESC);
@@ -0,0 +1,17 @@
+-- Order aggregate snapshots
+--
+-- A snapshot caches an order's state at a stream version so loading only
+-- replays the events after it. schema_version identifies the layout of data;
+-- the service upgrades old layouts when reading and ignores ones it doesn't
+-- know, so this table can be truncated at any time without losing anything.
+
+\c orders;
+
+CREATE TABLE IF NOT EXISTS order_snapshots (
+    aggregate_id VARCHAR(255) NOT NULL,
+    version INT NOT NULL,
+    schema_version INT NOT NULL,
+    data JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (aggregate_id, version)
+);
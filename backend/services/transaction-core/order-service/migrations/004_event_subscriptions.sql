@@ -0,0 +1,31 @@
+-- Catch-up event subscriptions
+--
+-- Each named consumer reads events in global sequence (events.id) order and
+-- stores the last sequence it handled. One replica at a time holds a
+-- consumer's lease. Events a consumer repeatedly fails on are parked so the
+-- stream can move on; the row points back at the event, which is never removed.
+
+\c orders;
+
+CREATE TABLE IF NOT EXISTS event_subscriptions (
+    consumer VARCHAR(255) PRIMARY KEY,
+    position BIGINT,
+    owner VARCHAR(255) NOT NULL,
+    lease_until TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS parked_events (
+    id BIGSERIAL PRIMARY KEY,
+    consumer VARCHAR(255) NOT NULL,
+    sequence BIGINT NOT NULL,
+    aggregate_id VARCHAR(255) NOT NULL,
+    version INT NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    attempts INT NOT NULL,
+    reason TEXT NOT NULL,
+    parked_at TIMESTAMPTZ NOT NULL,
+    CONSTRAINT unique_parked_consumer_sequence UNIQUE (consumer, sequence)
+);
+
+CREATE INDEX IF NOT EXISTS idx_parked_events_consumer ON parked_events(consumer, parked_at DESC);
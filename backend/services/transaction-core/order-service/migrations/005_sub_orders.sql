@@ -0,0 +1,23 @@
+-- Per-seller sub-orders
+--
+-- Sub-orders live inside the parent order's event stream; this is their read
+-- model, so sellers can list and work the orders they have to fulfil.
+
+\c orders;
+
+CREATE TABLE IF NOT EXISTS sub_orders_read_model (
+    sub_order_id VARCHAR(255) PRIMARY KEY,
+    order_id VARCHAR(255) NOT NULL,
+    seller_id VARCHAR(255) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    items JSONB NOT NULL,
+    items_total DECIMAL(12,2) NOT NULL,
+    shipping_fee DECIMAL(12,2) NOT NULL,
+    total DECIMAL(12,2) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    version INT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_sub_orders_read_model_order_id ON sub_orders_read_model(order_id);
+CREATE INDEX IF NOT EXISTS idx_sub_orders_read_model_seller_id ON sub_orders_read_model(seller_id, created_at DESC);
@@ -0,0 +1,27 @@
+-- Item returns (RMA)
+--
+-- A return covers some units of some lines of a delivered order and moves
+-- REQUESTED → APPROVED → LABEL_ISSUED → RECEIVED → INSPECTED → REFUNDED, or
+-- ends REJECTED. Lines, with their inspection results, are kept as JSONB.
+
+\c orders;
+
+CREATE TABLE IF NOT EXISTS order_returns (
+    return_id VARCHAR(255) PRIMARY KEY,
+    order_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    lines JSONB NOT NULL,
+    rejection_reason TEXT NOT NULL DEFAULT '',
+    shipment_id VARCHAR(255) NOT NULL DEFAULT '',
+    carrier VARCHAR(50) NOT NULL DEFAULT '',
+    tracking_number VARCHAR(100) NOT NULL DEFAULT '',
+    refund_id VARCHAR(255) NOT NULL DEFAULT '',
+    refund_amount DECIMAL(12,2) NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    version INT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_returns_order_id ON order_returns(order_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_order_returns_status ON order_returns(status);
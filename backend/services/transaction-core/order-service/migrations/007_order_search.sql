@@ -0,0 +1,21 @@
+-- Admin order search over the read model
+--
+-- shipping_country is the last comma-separated part of the shipping address
+-- (see domain.ShippingCountry). Seller and product filters match inside
+-- items through the GIN index; the rest are b-tree indexes, each ending in
+-- order_id to match the search's tie-breaking sort.
+
+\c orders;
+
+ALTER TABLE orders_read_model ADD COLUMN IF NOT EXISTS shipping_country VARCHAR(100) NOT NULL DEFAULT '';
+
+UPDATE orders_read_model
+SET shipping_country = UPPER(TRIM(REGEXP_REPLACE(shipping_address, '^.*,', '')))
+WHERE shipping_address LIKE '%,%' AND shipping_country = '';
+
+CREATE INDEX IF NOT EXISTS idx_orders_read_model_created_at ON orders_read_model(created_at, order_id);
+CREATE INDEX IF NOT EXISTS idx_orders_read_model_updated_at ON orders_read_model(updated_at, order_id);
+CREATE INDEX IF NOT EXISTS idx_orders_read_model_status ON orders_read_model(status, created_at, order_id);
+CREATE INDEX IF NOT EXISTS idx_orders_read_model_total_amount ON orders_read_model(total_amount, order_id);
+CREATE INDEX IF NOT EXISTS idx_orders_read_model_shipping_country ON orders_read_model(shipping_country, created_at, order_id);
+CREATE INDEX IF NOT EXISTS idx_orders_read_model_items ON orders_read_model USING GIN (items jsonb_path_ops);
@@ -0,0 +1,38 @@
+-- Tax and invoices
+--
+-- Every paid order gets one invoice; cancellations, refunds and returns are
+-- reversed with credit notes against it. Documents are immutable once issued.
+-- Numbers run without gaps per series (INV-<year>, CN-<year>): the counter in
+-- invoice_series is bumped in the same transaction as the insert.
+
+\c orders;
+
+-- The tax each seller's sub-order carries; zero for orders placed untaxed
+ALTER TABLE sub_orders_read_model ADD COLUMN IF NOT EXISTS tax_amount DECIMAL(12,2) NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS invoice_series (
+    series VARCHAR(50) PRIMARY KEY,
+    last_number BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS invoices (
+    invoice_id VARCHAR(255) PRIMARY KEY,
+    number VARCHAR(50) NOT NULL UNIQUE,
+    kind VARCHAR(20) NOT NULL,
+    order_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    credited_invoice_id VARCHAR(255) NOT NULL DEFAULT '',
+    reference VARCHAR(255) NOT NULL UNIQUE,
+    reason TEXT NOT NULL DEFAULT '',
+    billing_address TEXT NOT NULL,
+    country VARCHAR(10) NOT NULL DEFAULT '',
+    region VARCHAR(100) NOT NULL DEFAULT '',
+    pricing VARCHAR(20) NOT NULL,
+    lines JSONB NOT NULL,
+    net DECIMAL(12,2) NOT NULL,
+    tax DECIMAL(12,2) NOT NULL,
+    gross DECIMAL(12,2) NOT NULL,
+    issued_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_invoices_order_id ON invoices(order_id, issued_at);
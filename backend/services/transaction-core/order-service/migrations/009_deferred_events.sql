@@ -0,0 +1,20 @@
+-- Deferred payment and shipping events
+--
+-- Events an order could not take yet, e.g. a shipment reported before the
+-- payment, are kept here and applied again once due, rather than left to
+-- the sender to redeliver.
+
+\c orders;
+
+CREATE TABLE IF NOT EXISTS deferred_events (
+    event_id VARCHAR(255) PRIMARY KEY,
+    kind VARCHAR(50) NOT NULL,
+    order_id VARCHAR(255) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    next_attempt_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_deferred_events_due ON deferred_events(next_attempt_at);
@@ -0,0 +1,18 @@
+-- Sorting order search by seller and product
+--
+-- An order is sorted under its first seller and first product by ID (see
+-- domain.SortSellerID and domain.SortProductID). Both are compared byte by
+-- byte, as in Go, hence the C collation.
+
+\c orders;
+
+ALTER TABLE orders_read_model ADD COLUMN IF NOT EXISTS sort_seller_id VARCHAR(255) COLLATE "C" NOT NULL DEFAULT '';
+ALTER TABLE orders_read_model ADD COLUMN IF NOT EXISTS sort_product_id VARCHAR(255) COLLATE "C" NOT NULL DEFAULT '';
+
+UPDATE orders_read_model
+SET sort_seller_id = COALESCE((SELECT MIN(item->>'SellerID' COLLATE "C") FROM jsonb_array_elements(items) item), ''),
+    sort_product_id = COALESCE((SELECT MIN(item->>'ProductID' COLLATE "C") FROM jsonb_array_elements(items) item), '')
+WHERE sort_seller_id = '' AND sort_product_id = '';
+
+CREATE INDEX IF NOT EXISTS idx_orders_read_model_sort_seller_id ON orders_read_model(sort_seller_id, order_id);
+CREATE INDEX IF NOT EXISTS idx_orders_read_model_sort_product_id ON orders_read_model(sort_product_id, order_id);
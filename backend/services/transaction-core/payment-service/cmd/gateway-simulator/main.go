@@ -0,0 +1,57 @@
+// Command gateway-simulator serves a local stand-in for the Stripe, PayPal
+// and Adyen APIs for the payment service's gateway adapters to target.
+//
+//	gateway-simulator [-addr :8099] [-script rules.json]
+//
+// The script is a JSON array of rules scripting declines, outages,
+// timeouts and slow responses; see package simulator.
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway/simulator"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+func main() {
+	addr := flag.String("addr", ":8099", "address to listen on")
+	script := flag.String("script", "", "JSON file of rules scripting payment outcomes")
+	slow := flag.Duration("slow", 2*time.Second, "delay of slow responses without one of their own")
+	timeout := flag.Duration("timeout", 60*time.Second, "how long timed out responses are held without a delay of their own")
+	flag.Parse()
+
+	log := logger.New(logger.Config{Level: "info", ServiceName: "gateway-simulator", Pretty: true})
+
+	var rules []simulator.Rule
+	if *script != "" {
+		var err error
+		if rules, err = simulator.LoadScript(*script); err != nil {
+			log.Fatal(err, "Failed to load script")
+		}
+	}
+
+	// Credentials callers must present; unset ones are not checked
+	sim := simulator.New(simulator.Config{
+		StripeSecretKey:    os.Getenv("STRIPE_SECRET_KEY"),
+		PayPalClientID:     os.Getenv("PAYPAL_CLIENT_ID"),
+		PayPalClientSecret: os.Getenv("PAYPAL_CLIENT_SECRET"),
+		AdyenAPIKey:        os.Getenv("ADYEN_API_KEY"),
+		SlowDelay:          *slow,
+		TimeoutDelay:       *timeout,
+	}, rules)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sim.ServeHTTP(w, r)
+		log.Infof("%s %s (%s)", r.Method, r.URL.Path, time.Since(start).Round(time.Millisecond))
+	})
+
+	log.Infof("Gateway simulator listening on %s, rules=%d", *addr, len(rules))
+	if err := http.ListenAndServe(*addr, handler); err != nil {
+		log.Fatal(err, "Failed to serve")
+	}
+}
@@ -1,17 +1,27 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/titan-commerce/backend/payment-service/internal/application"
 	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway/adyen"
 	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway/mock"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway/paypal"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway/stripe"
 	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/postgres"
+	infrastructure "github.com/titan-commerce/backend/payment-service/internal/infrastructure/redis"
 	handler "github.com/titan-commerce/backend/payment-service/internal/interface/grpc"
+	"github.com/titan-commerce/backend/payment-service/internal/interface/webhook"
 	pb "github.com/titan-commerce/backend/payment-service/proto/payment/v1"
 	"github.com/titan-commerce/backend/pkg/config"
 	"github.com/titan-commerce/backend/pkg/logger"
@@ -40,17 +50,101 @@ func main() {
 		log.Fatal(err, "Failed to initialize payment repository")
 	}
 
-	// Initialize payment gateways
-	mockGateway := mock.NewMockPaymentGateway(log)
-	gateways := map[domain.PaymentGateway]domain.PaymentGatewayProvider{
-		domain.PaymentGatewayStripe: mockGateway,
-		domain.PaymentGatewayPayPal: mockGateway,
-		domain.PaymentGatewayAdyen:  mockGateway,
+	// Initialize payment gateways. Each needs its credentials; only with
+	// PAYMENT_GATEWAY_MOCK=true, e.g. in development, do those without them
+	// use the mock, which approves every payment
+	gatewayOptions := gateway.Options{Timeout: 30 * time.Second, MaxAttempts: 3, Backoff: 500 * time.Millisecond}
+	if v := os.Getenv("PAYMENT_GATEWAY_TIMEOUT"); v != "" {
+		if gatewayOptions.Timeout, err = time.ParseDuration(v); err != nil {
+			log.Fatal(err, "Invalid PAYMENT_GATEWAY_TIMEOUT")
+		}
+	}
+
+	gateways := map[domain.PaymentGateway]domain.PaymentGatewayProvider{}
+	var missing []string
+	if key := os.Getenv("STRIPE_SECRET_KEY"); key != "" {
+		gateways[domain.PaymentGatewayStripe] = stripe.New(stripe.Config{
+			Options:   gatewayOptions,
+			BaseURL:   os.Getenv("STRIPE_API_URL"),
+			SecretKey: key,
+		}, log)
+	} else {
+		missing = append(missing, "STRIPE_SECRET_KEY")
+	}
+	paypalConfig := paypal.Config{
+		Options:      gatewayOptions,
+		BaseURL:      os.Getenv("PAYPAL_API_URL"),
+		ClientID:     os.Getenv("PAYPAL_CLIENT_ID"),
+		ClientSecret: os.Getenv("PAYPAL_CLIENT_SECRET"),
+	}
+	if paypalConfig.ClientID != "" && paypalConfig.ClientSecret != "" {
+		gateways[domain.PaymentGatewayPayPal] = paypal.New(paypalConfig, log)
+	} else {
+		missing = append(missing, "PAYPAL_CLIENT_ID/PAYPAL_CLIENT_SECRET")
+	}
+	adyenConfig := adyen.Config{
+		Options:         gatewayOptions,
+		BaseURL:         os.Getenv("ADYEN_API_URL"),
+		APIKey:          os.Getenv("ADYEN_API_KEY"),
+		MerchantAccount: os.Getenv("ADYEN_MERCHANT_ACCOUNT"),
+	}
+	if adyenConfig.APIKey != "" && adyenConfig.MerchantAccount != "" {
+		gateways[domain.PaymentGatewayAdyen] = adyen.New(adyenConfig, log)
+	} else {
+		missing = append(missing, "ADYEN_API_KEY/ADYEN_MERCHANT_ACCOUNT")
+	}
+	if len(missing) > 0 {
+		if os.Getenv("PAYMENT_GATEWAY_MOCK") != "true" {
+			log.Fatal(fmt.Errorf("missing %s", strings.Join(missing, ", ")),
+				"Payment gateway credentials are required; set PAYMENT_GATEWAY_MOCK=true to use the mock gateway instead")
+		}
+		mockGateway := mock.NewMockPaymentGateway(log)
+		for _, name := range []domain.PaymentGateway{domain.PaymentGatewayStripe, domain.PaymentGatewayPayPal, domain.PaymentGatewayAdyen} {
+			if _, ok := gateways[name]; !ok {
+				log.Warnf("PAYMENT_GATEWAY_MOCK is set: %s payments go to the mock gateway and are always approved", name)
+				gateways[name] = mockGateway
+			}
+		}
 	}
 
 	// Initialize application service
 	paymentService := application.NewPaymentService(paymentRepo, gateways, log)
 
+	// Initialize webhook ingestion; gateways without a webhook secret get
+	// their webhooks turned away
+	webhookRepo, err := postgres.NewWebhookEventRepository(cfg.DatabaseURL, log)
+	if err != nil {
+		log.Fatal(err, "Failed to initialize webhook event repository")
+	}
+	verifiers := map[domain.PaymentGateway]application.WebhookVerifier{}
+	if secret := os.Getenv("STRIPE_WEBHOOK_SECRET"); secret != "" {
+		verifiers[domain.PaymentGatewayStripe] = stripe.NewWebhookVerifier(secret, 0)
+	}
+	if id := os.Getenv("PAYPAL_WEBHOOK_ID"); id != "" && paypalConfig.ClientID != "" {
+		verifiers[domain.PaymentGatewayPayPal] = paypal.NewWebhookVerifier(paypalConfig, id, 0, log)
+	}
+	if key := os.Getenv("ADYEN_HMAC_KEY"); key != "" {
+		verifier, err := adyen.NewWebhookVerifier(key)
+		if err != nil {
+			log.Fatal(err, "Invalid ADYEN_HMAC_KEY")
+		}
+		verifiers[domain.PaymentGatewayAdyen] = verifier
+	}
+	// Completed payments are announced on a Redis stream order-service reads
+	publisher, err := infrastructure.NewRedisPaymentEventPublisher(cfg.RedisAddr, cfg.RedisPassword)
+	if err != nil {
+		log.Fatal(err, "Failed to initialize payment event publisher")
+	}
+	webhookService := application.NewWebhookService(paymentRepo, webhookRepo, verifiers, publisher, log)
+
+	mux := http.NewServeMux()
+	mux.Handle("/webhooks/", webhook.NewWebhookHandler(webhookService, log))
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+	httpServer := &http.Server{Addr: fmt.Sprintf(":%d", cfg.HTTPPort), Handler: mux}
+
 	// Initialize gRPC server
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
 	if err != nil {
@@ -70,6 +164,13 @@ func main() {
 		}
 	}()
 
+	go func() {
+		log.Infof("Webhook endpoint listening on :%d/webhooks/{stripe,paypal,adyen}", cfg.HTTPPort)
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err, "Failed to serve HTTP")
+		}
+	}()
+
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -77,6 +178,9 @@ func main() {
 
 	log.Info("Shutting down Payment Service")
 	grpcServer.GracefulStop()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	httpServer.Shutdown(ctx)
 	log.Info("Payment Service stopped")
 }
 
@@ -25,23 +25,16 @@ func NewPaymentService(repo domain.Repository, gateways map[domain.PaymentGatewa
 // ProcessPayment processes a payment (Command)
 func (s *PaymentService) ProcessPayment(ctx context.Context, orderID, userID string, amount float64, currency string, gatewayType domain.PaymentGateway, paymentMethodID, idempotencyKey string) (*domain.Payment, string, error) {
 	// Check idempotency - prevent duplicate payments
-	existing, err := s.repo.FindByIdempotencyKey(ctx, idempotencyKey)
-	if err == nil && existing != nil {
+	payment, err := s.repo.FindByIdempotencyKey(ctx, idempotencyKey)
+	replay := err == nil && payment != nil
+	if replay {
 		s.logger.Infof("Idempotent request detected: %s", idempotencyKey)
-		return existing, "", nil
-	}
-
-	// Create payment aggregate
-	payment, err := domain.NewPayment(orderID, userID, amount, currency, gatewayType, idempotencyKey)
-	if err != nil {
-		s.logger.Error(err, "failed to create payment")
-		return nil, "", err
-	}
-
-	// Save payment (pending state)
-	if err := s.repo.Save(ctx, payment); err != nil {
-		s.logger.Error(err, "failed to save payment")
-		return nil, "", err
+		// A payment left pending by an unreachable gateway is tried again;
+		// the gateway sees the same idempotency key and cannot charge twice
+		if payment.Status != domain.PaymentStatusPending {
+			return payment, "", nil
+		}
+		gatewayType = payment.Gateway
 	}
 
 	// Get payment gateway
@@ -50,9 +43,30 @@ func (s *PaymentService) ProcessPayment(ctx context.Context, orderID, userID str
 		return nil, "", errors.New(errors.ErrInvalidInput, "unsupported payment gateway")
 	}
 
+	if !replay {
+		// Create payment aggregate
+		payment, err = domain.NewPayment(orderID, userID, amount, currency, gatewayType, idempotencyKey)
+		if err != nil {
+			s.logger.Error(err, "failed to create payment")
+			return nil, "", err
+		}
+
+		// Save payment (pending state)
+		if err := s.repo.Save(ctx, payment); err != nil {
+			s.logger.Error(err, "failed to save payment")
+			return nil, "", err
+		}
+	}
+
 	// Process payment through gateway
 	gatewayTxnID, clientSecret, err := gateway.ProcessPayment(ctx, payment, paymentMethodID)
 	if err != nil {
+		if domain.GatewayErrorKindOf(err) == domain.GatewayRetryable {
+			// The gateway may have taken the payment; keep it pending for
+			// a retry to settle
+			s.logger.Warnf("Payment gateway unavailable, payment %s left pending: %v", payment.ID, err)
+			return nil, "", errors.Wrap(errors.ErrInternal, "payment gateway unavailable, retry with the same idempotency key", err)
+		}
 		payment.MarkFailed(err.Error())
 		s.repo.Update(ctx, payment)
 		s.logger.Error(err, "gateway payment failed")
@@ -69,7 +83,7 @@ func (s *PaymentService) ProcessPayment(ctx context.Context, orderID, userID str
 		return nil, "", err
 	}
 
-	s.logger.Infof("Payment processed: %s for order: %s, gateway txn: %s", payment.ID, orderID, gatewayTxnID)
+	s.logger.Infof("Payment processed: %s for order: %s, gateway txn: %s", payment.ID, payment.OrderID, gatewayTxnID)
 	return payment, clientSecret, nil
 }
 
@@ -83,35 +97,51 @@ func (s *PaymentService) GetPayment(ctx context.Context, paymentID string) (*dom
 	return payment, nil
 }
 
-// RefundPayment issues a refund (Command)
-func (s *PaymentService) RefundPayment(ctx context.Context, paymentID string, amount float64, reason string) (string, error) {
+// GetPaymentByOrder retrieves the payment of an order (Query)
+func (s *PaymentService) GetPaymentByOrder(ctx context.Context, orderID string) (*domain.Payment, error) {
+	return s.repo.FindByOrderID(ctx, orderID)
+}
+
+// RefundPayment issues a refund (Command). idempotencyKey names the refund:
+// a retry with a key already used returns the refund made under it.
+func (s *PaymentService) RefundPayment(ctx context.Context, paymentID string, amount float64, reason, idempotencyKey string) (string, error) {
 	payment, err := s.repo.FindByID(ctx, paymentID)
 	if err != nil {
 		return "", err
 	}
 
+	if refundID, ok := payment.RefundID(idempotencyKey); ok {
+		s.logger.Infof("Refund %s of payment %s already made: refund ID %s", idempotencyKey, paymentID, refundID)
+		return refundID, nil
+	}
+	key := idempotencyKey
+	if key == "" {
+		key = payment.RefundKey()
+	}
+
 	// Get gateway
 	gateway, ok := s.gateways[payment.Gateway]
 	if !ok {
 		return "", errors.New(errors.ErrInternal, "gateway not found")
 	}
 
-	// Process refund through gateway
-	refundID, err := gateway.RefundPayment(ctx, payment.GatewayTransactionID, amount)
-	if err != nil {
-		s.logger.Error(err, "refund failed")
+	// Check the amount before anything reaches the gateway
+	if err := payment.Refund(key, amount); err != nil {
 		return "", err
 	}
 
-	// Mark payment as refunded
-	if err := payment.Refund(); err != nil {
+	// Process refund through gateway; it makes one refund per key
+	refundID, err := gateway.RefundPayment(ctx, payment, key, amount)
+	if err != nil {
+		s.logger.Error(err, "refund failed")
 		return "", err
 	}
+	payment.RecordRefundID(key, refundID)
 
 	if err := s.repo.Update(ctx, payment); err != nil {
 		return "", err
 	}
 
-	s.logger.Infof("Payment refunded: %s, refund ID: %s", paymentID, refundID)
+	s.logger.Infof("Payment refunded: %s, amount=%.2f, status=%s, refund ID: %s", paymentID, amount, payment.Status, refundID)
 	return refundID, nil
 }
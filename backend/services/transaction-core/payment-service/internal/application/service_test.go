@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/titan-commerce/backend/payment-service/internal/application"
 	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
 	"github.com/titan-commerce/backend/pkg/logger"
 )
 
@@ -28,6 +29,22 @@ func (m *MockPaymentRepository) FindByID(ctx context.Context, paymentID string)
 	return args.Get(0).(*domain.Payment), args.Error(1)
 }
 
+func (m *MockPaymentRepository) FindByOrderID(ctx context.Context, orderID string) (*domain.Payment, error) {
+	args := m.Called(ctx, orderID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Payment), args.Error(1)
+}
+
+func (m *MockPaymentRepository) FindByGatewayTransactionID(ctx context.Context, gateway domain.PaymentGateway, gatewayTransactionID string) (*domain.Payment, error) {
+	args := m.Called(ctx, gateway, gatewayTransactionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Payment), args.Error(1)
+}
+
 func (m *MockPaymentRepository) FindByIdempotencyKey(ctx context.Context, key string) (*domain.Payment, error) {
 	args := m.Called(ctx, key)
 	if args.Get(0) == nil {
@@ -50,11 +67,16 @@ func (m *MockPaymentGateway) ProcessPayment(ctx context.Context, payment *domain
 	return args.String(0), args.String(1), args.Error(2)
 }
 
-func (m *MockPaymentGateway) RefundPayment(ctx context.Context, transactionID string, amount float64) (string, error) {
-	args := m.Called(ctx, transactionID, amount)
+func (m *MockPaymentGateway) RefundPayment(ctx context.Context, payment *domain.Payment, refundKey string, amount float64) (string, error) {
+	args := m.Called(ctx, payment.GatewayTransactionID, refundKey, amount)
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockPaymentGateway) VerifyPayment(ctx context.Context, gatewayTransactionID string) (bool, error) {
+	args := m.Called(ctx, gatewayTransactionID)
+	return args.Bool(0), args.Error(1)
+}
+
 func TestPaymentService_ProcessPayment(t *testing.T) {
 	// Setup
 	mockRepo := new(MockPaymentRepository)
@@ -62,7 +84,7 @@ func TestPaymentService_ProcessPayment(t *testing.T) {
 	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
 
 	gateways := map[domain.PaymentGateway]domain.PaymentGatewayProvider{
-		domain.GatewayStripe: mockGateway,
+		domain.PaymentGatewayStripe: mockGateway,
 	}
 	
 	service := application.NewPaymentService(mockRepo, gateways, log)
@@ -72,7 +94,7 @@ func TestPaymentService_ProcessPayment(t *testing.T) {
 	userID := "user-123"
 	amount := 99.99
 	currency := "USD"
-	gatewayType := domain.GatewayStripe
+	gatewayType := domain.PaymentGatewayStripe
 	paymentMethodID := "pm_123"
 	idempotencyKey := "idem-123"
 
@@ -118,7 +140,7 @@ func TestPaymentService_IdempotencyCheck(t *testing.T) {
 	mockRepo.On("FindByIdempotencyKey", ctx, idempotencyKey).Return(existingPayment, nil)
 
 	// Execute
-	payment, _, err := service.ProcessPayment(ctx, "order-123", "user-123", 99.99, "USD", domain.GatewayStripe, "pm_123", idempotencyKey)
+	payment, _, err := service.ProcessPayment(ctx, "order-123", "user-123", 99.99, "USD", domain.PaymentGatewayStripe, "pm_123", idempotencyKey)
 
 	// Assert - should return existing payment
 	assert.NoError(t, err)
@@ -134,7 +156,7 @@ func TestPaymentService_RefundPayment(t *testing.T) {
 	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
 
 	gateways := map[domain.PaymentGateway]domain.PaymentGatewayProvider{
-		domain.GatewayStripe: mockGateway,
+		domain.PaymentGatewayStripe: mockGateway,
 	}
 	
 	service := application.NewPaymentService(mockRepo, gateways, log)
@@ -148,17 +170,17 @@ func TestPaymentService_RefundPayment(t *testing.T) {
 		ID:                   paymentID,
 		Amount:               100.00,
 		Status:               domain.PaymentStatusCompleted,
-		Gateway:              domain.GatewayStripe,
+		Gateway:              domain.PaymentGatewayStripe,
 		GatewayTransactionID: "txn-123",
 	}
 
 	// Expectations
 	mockRepo.On("FindByID", ctx, paymentID).Return(existingPayment, nil)
-	mockGateway.On("RefundPayment", ctx, "txn-123", refundAmount).Return("refund-123", nil)
+	mockGateway.On("RefundPayment", ctx, "txn-123", "rf-1", refundAmount).Return("refund-123", nil)
 	mockRepo.On("Update", ctx, mock.AnythingOfType("*domain.Payment")).Return(nil)
 
 	// Execute
-	refundID, err := service.RefundPayment(ctx, paymentID, refundAmount, reason)
+	refundID, err := service.RefundPayment(ctx, paymentID, refundAmount, reason, "rf-1")
 
 	// Assert
 	assert.NoError(t, err)
@@ -167,3 +189,106 @@ func TestPaymentService_RefundPayment(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 	mockGateway.AssertExpectations(t)
 }
+
+func TestPaymentService_RefundPayment_RetryReturnsRecordedRefund(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockGateway := new(MockPaymentGateway)
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+	service := application.NewPaymentService(mockRepo, map[domain.PaymentGateway]domain.PaymentGatewayProvider{
+		domain.PaymentGatewayStripe: mockGateway,
+	}, log)
+	ctx := context.Background()
+
+	// Refunded under rf-1 before; the caller never saw the reply
+	refunded := &domain.Payment{
+		ID:                   "pay-123",
+		Amount:               100.00,
+		RefundedAmount:       50.00,
+		Status:               domain.PaymentStatusPartiallyRefunded,
+		Gateway:              domain.PaymentGatewayStripe,
+		GatewayTransactionID: "txn-123",
+		Refunds:              []string{"rf-1"},
+		RefundIDs:            map[string]string{"rf-1": "refund-123"},
+		Version:              3,
+	}
+	mockRepo.On("FindByID", ctx, "pay-123").Return(refunded, nil)
+
+	refundID, err := service.RefundPayment(ctx, "pay-123", 50.00, "", "rf-1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "refund-123", refundID)
+	assert.Equal(t, 50.00, refunded.RefundedAmount)
+	mockGateway.AssertNotCalled(t, "RefundPayment", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+}
+
+func TestPaymentService_ProcessPayment_GatewayUnavailable(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockGateway := new(MockPaymentGateway)
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+	service := application.NewPaymentService(mockRepo, map[domain.PaymentGateway]domain.PaymentGatewayProvider{
+		domain.PaymentGatewayStripe: mockGateway,
+	}, log)
+	ctx := context.Background()
+
+	unavailable := &domain.GatewayError{Gateway: domain.PaymentGatewayStripe, Kind: domain.GatewayRetryable, StatusCode: 503}
+	mockRepo.On("FindByIdempotencyKey", ctx, "idem-123").Return(nil, assert.AnError)
+	mockRepo.On("Save", ctx, mock.AnythingOfType("*domain.Payment")).Return(nil)
+	mockGateway.On("ProcessPayment", ctx, mock.AnythingOfType("*domain.Payment"), "pm_123").Return("", "", unavailable)
+
+	payment, _, err := service.ProcessPayment(ctx, "order-123", "user-123", 99.99, "USD", domain.PaymentGatewayStripe, "pm_123", "idem-123")
+
+	assert.Error(t, err)
+	assert.Nil(t, payment)
+	assert.Equal(t, errors.ErrInternal, err.(*errors.AppError).Code)
+	// Left pending, not failed: the gateway may have taken the payment
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+	saved := mockRepo.Calls[1].Arguments.Get(1).(*domain.Payment)
+	assert.Equal(t, domain.PaymentStatusPending, saved.Status)
+}
+
+func TestPaymentService_ProcessPayment_Declined(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockGateway := new(MockPaymentGateway)
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+	service := application.NewPaymentService(mockRepo, map[domain.PaymentGateway]domain.PaymentGatewayProvider{
+		domain.PaymentGatewayStripe: mockGateway,
+	}, log)
+	ctx := context.Background()
+
+	declined := &domain.GatewayError{Gateway: domain.PaymentGatewayStripe, Kind: domain.GatewayDeclined, Code: "insufficient_funds"}
+	mockRepo.On("FindByIdempotencyKey", ctx, "idem-123").Return(nil, assert.AnError)
+	mockRepo.On("Save", ctx, mock.AnythingOfType("*domain.Payment")).Return(nil)
+	mockGateway.On("ProcessPayment", ctx, mock.AnythingOfType("*domain.Payment"), "pm_123").Return("", "", declined)
+	mockRepo.On("Update", ctx, mock.MatchedBy(func(p *domain.Payment) bool {
+		return p.Status == domain.PaymentStatusFailed
+	})).Return(nil)
+
+	_, _, err := service.ProcessPayment(ctx, "order-123", "user-123", 99.99, "USD", domain.PaymentGatewayStripe, "pm_123", "idem-123")
+
+	assert.Equal(t, errors.ErrPaymentFailed, err.(*errors.AppError).Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestPaymentService_ProcessPayment_RetriesPendingPayment(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockGateway := new(MockPaymentGateway)
+	log := logger.New(logger.Config{Level: "debug", ServiceName: "test"})
+	service := application.NewPaymentService(mockRepo, map[domain.PaymentGateway]domain.PaymentGatewayProvider{
+		domain.PaymentGatewayStripe: mockGateway,
+	}, log)
+	ctx := context.Background()
+
+	pending, _ := domain.NewPayment("order-123", "user-123", 99.99, "USD", domain.PaymentGatewayStripe, "idem-123")
+	mockRepo.On("FindByIdempotencyKey", ctx, "idem-123").Return(pending, nil)
+	mockGateway.On("ProcessPayment", ctx, pending, "pm_123").Return("txn-123", "cs_123", nil)
+	mockRepo.On("Update", ctx, pending).Return(nil)
+
+	payment, _, err := service.ProcessPayment(ctx, "order-123", "user-123", 99.99, "USD", domain.PaymentGatewayStripe, "pm_123", "idem-123")
+
+	assert.NoError(t, err)
+	assert.Equal(t, pending.ID, payment.ID)
+	assert.Equal(t, "txn-123", payment.GatewayTransactionID)
+	mockRepo.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,153 @@
+package application
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// WebhookVerifier authenticates a gateway's webhook request and reads the
+// events in it. Requests it cannot trust, forged or replayed outside the
+// gateway's tolerance, fail with ErrUnauthorized.
+type WebhookVerifier interface {
+	VerifyWebhook(ctx context.Context, header http.Header, payload []byte) ([]*domain.WebhookEvent, error)
+}
+
+// PaymentEventPublisher hands payment events to the services that act on
+// them, e.g. order-service confirming paid orders. Consumers must tolerate
+// an event delivered more than once.
+type PaymentEventPublisher interface {
+	Publish(ctx context.Context, event *domain.PaymentEvent) error
+}
+
+// WebhookService lands the events gateways push, e.g. the confirmation of
+// a payment left processing, and moves their payments along
+type WebhookService struct {
+	repo      domain.Repository
+	events    domain.WebhookEventRepository
+	verifiers map[domain.PaymentGateway]WebhookVerifier
+	publisher PaymentEventPublisher
+	logger    *logger.Logger
+	now       func() time.Time
+}
+
+func NewWebhookService(repo domain.Repository, events domain.WebhookEventRepository, verifiers map[domain.PaymentGateway]WebhookVerifier, publisher PaymentEventPublisher, logger *logger.Logger) *WebhookService {
+	return &WebhookService{
+		repo:      repo,
+		events:    events,
+		verifiers: verifiers,
+		publisher: publisher,
+		logger:    logger,
+		now:       time.Now,
+	}
+}
+
+// HandleWebhook verifies a webhook request and applies its events. An
+// error means the gateway should deliver it again; events it already
+// delivered are not applied twice.
+func (s *WebhookService) HandleWebhook(ctx context.Context, gateway domain.PaymentGateway, header http.Header, payload []byte) error {
+	verifier, ok := s.verifiers[gateway]
+	if !ok {
+		return errors.New(errors.ErrNotFound, "no webhooks configured for gateway")
+	}
+
+	events, err := verifier.VerifyWebhook(ctx, header, payload)
+	if err != nil {
+		s.logger.Warnf("Webhook rejected: gateway=%s, error=%v", gateway, err)
+		return err
+	}
+
+	for _, event := range events {
+		if err := s.ingest(ctx, event); err != nil {
+			s.logger.Error(err, "failed to apply webhook event")
+			return err
+		}
+	}
+	return nil
+}
+
+// ingest archives an event and applies it, unless it was applied before
+func (s *WebhookService) ingest(ctx context.Context, event *domain.WebhookEvent) error {
+	event.ID = uuid.New().String()
+	event.Status = domain.WebhookEventReceived
+	event.ReceivedAt = s.now()
+
+	fresh, err := s.events.Archive(ctx, event)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		archived, err := s.events.FindByEventID(ctx, event.Gateway, event.EventID)
+		if err != nil {
+			return err
+		}
+		if archived.Status != domain.WebhookEventReceived {
+			s.logger.Infof("Duplicate webhook event: gateway=%s, event=%s", event.Gateway, event.EventID)
+			return nil
+		}
+		// An earlier delivery failed to apply it; try again
+		event.ID = archived.ID
+	}
+
+	if event.Type == "" {
+		return s.processed(ctx, event, domain.WebhookEventIgnored, "event does not affect payments")
+	}
+
+	payment, err := s.findPayment(ctx, event)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok && appErr.Code == errors.ErrNotFound {
+			return s.processed(ctx, event, domain.WebhookEventIgnored, "unknown payment")
+		}
+		return err
+	}
+	event.PaymentID = payment.ID
+
+	before := payment.Status
+	changed, err := payment.Apply(event)
+	if err != nil {
+		// Out of order or contradicting what we know; kept for a look
+		s.logger.Warnf("Webhook event not applied: gateway=%s, event=%s, payment=%s, status=%s, error=%v",
+			event.Gateway, event.EventID, payment.ID, payment.Status, err)
+		return s.processed(ctx, event, domain.WebhookEventIgnored, err.Error())
+	}
+	if changed {
+		// A concurrent change fails the update; the redelivery applies the
+		// event to the payment as it is then
+		if err := s.repo.Update(ctx, payment); err != nil {
+			return err
+		}
+		s.logger.Infof("Payment %s moved from %s to %s by %s event %s", payment.ID, before, payment.Status, event.Gateway, event.EventID)
+	}
+
+	// Published before the event is marked applied, so if publishing fails
+	// the redelivery publishes again, even though the payment has moved
+	if event.Type == domain.WebhookPaymentSucceeded && payment.Status == domain.PaymentStatusCompleted {
+		if err := s.publisher.Publish(ctx, payment.Event(domain.PaymentEventCompleted, s.now())); err != nil {
+			return err
+		}
+	}
+	return s.processed(ctx, event, domain.WebhookEventApplied, "")
+}
+
+func (s *WebhookService) findPayment(ctx context.Context, event *domain.WebhookEvent) (*domain.Payment, error) {
+	if event.PaymentID != "" {
+		payment, err := s.repo.FindByID(ctx, event.PaymentID)
+		if err == nil || event.GatewayTransactionID == "" {
+			return payment, err
+		}
+	}
+	if event.GatewayTransactionID == "" {
+		return nil, errors.New(errors.ErrNotFound, "payment not found")
+	}
+	return s.repo.FindByGatewayTransactionID(ctx, event.Gateway, event.GatewayTransactionID)
+}
+
+func (s *WebhookService) processed(ctx context.Context, event *domain.WebhookEvent, status domain.WebhookEventStatus, reason string) error {
+	event.Processed(status, reason, s.now())
+	return s.events.Update(ctx, event)
+}
@@ -0,0 +1,296 @@
+package application_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/titan-commerce/backend/payment-service/internal/application"
+	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+type memoryPayments struct {
+	domain.Repository
+	mu        sync.Mutex
+	payments  map[string]domain.Payment
+	updates   int
+	updateErr error
+}
+
+func (m *memoryPayments) FindByID(ctx context.Context, paymentID string) (*domain.Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.payments[paymentID]
+	if !ok {
+		return nil, errors.New(errors.ErrNotFound, "payment not found")
+	}
+	p.Refunds = append([]string(nil), p.Refunds...)
+	return &p, nil
+}
+
+func (m *memoryPayments) FindByGatewayTransactionID(ctx context.Context, gateway domain.PaymentGateway, txnID string) (*domain.Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.payments {
+		if p.Gateway == gateway && p.GatewayTransactionID == txnID {
+			p.Refunds = append([]string(nil), p.Refunds...)
+			return &p, nil
+		}
+	}
+	return nil, errors.New(errors.ErrNotFound, "payment not found")
+}
+
+func (m *memoryPayments) Update(ctx context.Context, payment *domain.Payment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.updateErr != nil {
+		return m.updateErr
+	}
+	if m.payments[payment.ID].Version != payment.Version-1 {
+		return errors.New(errors.ErrConflict, "payment was modified by another transaction (optimistic lock)")
+	}
+	m.payments[payment.ID] = *payment
+	m.updates++
+	return nil
+}
+
+type memoryEvents struct {
+	mu     sync.Mutex
+	events map[string]domain.WebhookEvent
+}
+
+func (m *memoryEvents) Archive(ctx context.Context, event *domain.WebhookEvent) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := string(event.Gateway) + ":" + event.EventID
+	if _, ok := m.events[key]; ok {
+		return false, nil
+	}
+	m.events[key] = *event
+	return true, nil
+}
+
+func (m *memoryEvents) FindByEventID(ctx context.Context, gateway domain.PaymentGateway, eventID string) (*domain.WebhookEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.events[string(gateway)+":"+eventID]
+	if !ok {
+		return nil, errors.New(errors.ErrNotFound, "webhook event not found")
+	}
+	return &e, nil
+}
+
+func (m *memoryEvents) Update(ctx context.Context, event *domain.WebhookEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events[string(event.Gateway)+":"+event.EventID] = *event
+	return nil
+}
+
+func (m *memoryEvents) get(eventID string) domain.WebhookEvent {
+	e, _ := m.FindByEventID(context.Background(), domain.PaymentGatewayStripe, eventID)
+	return *e
+}
+
+// staticVerifier passes along the events it was given, or rejects all
+type staticVerifier struct {
+	events []domain.WebhookEvent
+	err    error
+}
+
+func (v *staticVerifier) VerifyWebhook(ctx context.Context, header http.Header, payload []byte) ([]*domain.WebhookEvent, error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+	events := make([]*domain.WebhookEvent, len(v.events))
+	for i := range v.events {
+		e := v.events[i]
+		e.Payload = payload
+		events[i] = &e
+	}
+	return events, nil
+}
+
+// memoryPublisher records what was published, or fails
+type memoryPublisher struct {
+	mu        sync.Mutex
+	published []domain.PaymentEvent
+	err       error
+}
+
+func (m *memoryPublisher) Publish(ctx context.Context, event *domain.PaymentEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.published = append(m.published, *event)
+	return nil
+}
+
+func setupWebhooks(t *testing.T, status domain.PaymentStatus) (*memoryPayments, *memoryEvents, *staticVerifier, *application.WebhookService) {
+	payments, events, verifier, _, service := setupWebhooksPublishing(t, status)
+	return payments, events, verifier, service
+}
+
+func setupWebhooksPublishing(t *testing.T, status domain.PaymentStatus) (*memoryPayments, *memoryEvents, *staticVerifier, *memoryPublisher, *application.WebhookService) {
+	payment, err := domain.NewPayment("order-1", "user-1", 100, "USD", domain.PaymentGatewayStripe, "idem-1")
+	require.NoError(t, err)
+	payment.ID = "pay-1"
+	require.NoError(t, payment.MarkProcessing("pi_1"))
+	switch status {
+	case domain.PaymentStatusCompleted:
+		require.NoError(t, payment.MarkCompleted())
+	case domain.PaymentStatusPending:
+		payment.Status, payment.GatewayTransactionID = domain.PaymentStatusPending, ""
+	}
+
+	payments := &memoryPayments{payments: map[string]domain.Payment{payment.ID: *payment}}
+	events := &memoryEvents{events: map[string]domain.WebhookEvent{}}
+	verifier := &staticVerifier{}
+	publisher := &memoryPublisher{}
+	service := application.NewWebhookService(payments, events, map[domain.PaymentGateway]application.WebhookVerifier{
+		domain.PaymentGatewayStripe: verifier,
+	}, publisher, logger.New(logger.Config{Level: "error", ServiceName: "test"}))
+	return payments, events, verifier, publisher, service
+}
+
+func stripeEvent(id string, typ domain.WebhookEventType) domain.WebhookEvent {
+	return domain.WebhookEvent{Gateway: domain.PaymentGatewayStripe, EventID: id, GatewayType: "test", Type: typ, GatewayTransactionID: "pi_1"}
+}
+
+func TestWebhookService_SucceededCompletesPaymentOnce(t *testing.T) {
+	payments, events, verifier, service := setupWebhooks(t, domain.PaymentStatusProcessing)
+	ctx := context.Background()
+	verifier.events = []domain.WebhookEvent{stripeEvent("evt_1", domain.WebhookPaymentSucceeded)}
+
+	require.NoError(t, service.HandleWebhook(ctx, domain.PaymentGatewayStripe, nil, []byte(`{"id":"evt_1"}`)))
+	// Redelivered
+	require.NoError(t, service.HandleWebhook(ctx, domain.PaymentGatewayStripe, nil, []byte(`{"id":"evt_1"}`)))
+
+	assert.Equal(t, domain.PaymentStatusCompleted, payments.payments["pay-1"].Status)
+	assert.Equal(t, 1, payments.updates)
+	archived := events.get("evt_1")
+	assert.Equal(t, domain.WebhookEventApplied, archived.Status)
+	assert.Equal(t, "pay-1", archived.PaymentID)
+	assert.Equal(t, `{"id":"evt_1"}`, string(archived.Payload))
+	assert.NotNil(t, archived.ProcessedAt)
+}
+
+func TestWebhookService_PublishesCompletedPayment(t *testing.T) {
+	_, events, verifier, publisher, service := setupWebhooksPublishing(t, domain.PaymentStatusProcessing)
+	ctx := context.Background()
+	verifier.events = []domain.WebhookEvent{stripeEvent("evt_1", domain.WebhookPaymentSucceeded)}
+
+	// Not published: the event stays unapplied so the redelivery publishes
+	publisher.err = errors.New(errors.ErrInternal, "stream unavailable")
+	assert.Error(t, service.HandleWebhook(ctx, domain.PaymentGatewayStripe, nil, []byte(`{}`)))
+	assert.Equal(t, domain.WebhookEventReceived, events.get("evt_1").Status)
+
+	publisher.err = nil
+	require.NoError(t, service.HandleWebhook(ctx, domain.PaymentGatewayStripe, nil, []byte(`{}`)))
+	require.NoError(t, service.HandleWebhook(ctx, domain.PaymentGatewayStripe, nil, []byte(`{}`)))
+
+	require.Len(t, publisher.published, 1)
+	published := publisher.published[0]
+	assert.Equal(t, domain.PaymentEventCompleted, published.Type)
+	assert.Equal(t, "pay-1", published.PaymentID)
+	assert.Equal(t, "order-1", published.OrderID)
+	assert.Equal(t, 100.0, published.Amount)
+	assert.Equal(t, domain.WebhookEventApplied, events.get("evt_1").Status)
+}
+
+func TestWebhookService_SucceededSettlesPendingPayment(t *testing.T) {
+	payments, _, verifier, service := setupWebhooks(t, domain.PaymentStatusPending)
+	event := stripeEvent("evt_1", domain.WebhookPaymentSucceeded)
+	event.PaymentID = "pay-1"
+	verifier.events = []domain.WebhookEvent{event}
+
+	require.NoError(t, service.HandleWebhook(context.Background(), domain.PaymentGatewayStripe, nil, []byte(`{}`)))
+
+	assert.Equal(t, domain.PaymentStatusCompleted, payments.payments["pay-1"].Status)
+	assert.Equal(t, "pi_1", payments.payments["pay-1"].GatewayTransactionID)
+}
+
+func TestWebhookService_OwnRefundIsNotCountedTwice(t *testing.T) {
+	payments, _, verifier, service := setupWebhooks(t, domain.PaymentStatusCompleted)
+	ctx := context.Background()
+
+	// Refunded through RefundPayment, then confirmed by webhook
+	payment := payments.payments["pay-1"]
+	require.NoError(t, payment.Refund("ref-1", 30))
+	payments.payments["pay-1"] = payment
+
+	own := stripeEvent("evt_1", domain.WebhookPaymentRefunded)
+	own.RefundID, own.RefundReference, own.Amount = "re_1", "ref-1", 30
+	elsewhere := stripeEvent("evt_2", domain.WebhookPaymentRefunded)
+	elsewhere.RefundID, elsewhere.Amount = "re_2", 20
+	verifier.events = []domain.WebhookEvent{own, elsewhere}
+
+	require.NoError(t, service.HandleWebhook(ctx, domain.PaymentGatewayStripe, nil, []byte(`{}`)))
+
+	assert.Equal(t, 50.0, payments.payments["pay-1"].RefundedAmount)
+	assert.Equal(t, domain.PaymentStatusPartiallyRefunded, payments.payments["pay-1"].Status)
+	assert.Equal(t, 1, payments.updates)
+}
+
+func TestWebhookService_Disputed(t *testing.T) {
+	payments, _, verifier, service := setupWebhooks(t, domain.PaymentStatusCompleted)
+	verifier.events = []domain.WebhookEvent{stripeEvent("evt_1", domain.WebhookPaymentDisputed)}
+
+	require.NoError(t, service.HandleWebhook(context.Background(), domain.PaymentGatewayStripe, nil, []byte(`{}`)))
+
+	assert.Equal(t, domain.PaymentStatusDisputed, payments.payments["pay-1"].Status)
+}
+
+func TestWebhookService_IgnoresWhatItCannotApply(t *testing.T) {
+	payments, events, verifier, service := setupWebhooks(t, domain.PaymentStatusCompleted)
+	unknown := stripeEvent("evt_2", domain.WebhookPaymentSucceeded)
+	unknown.GatewayTransactionID = "pi_other"
+	verifier.events = []domain.WebhookEvent{
+		stripeEvent("evt_1", domain.WebhookPaymentFailed), // After it completed
+		unknown,
+		stripeEvent("evt_3", ""),
+	}
+
+	require.NoError(t, service.HandleWebhook(context.Background(), domain.PaymentGatewayStripe, nil, []byte(`{}`)))
+
+	assert.Equal(t, domain.PaymentStatusCompleted, payments.payments["pay-1"].Status)
+	for _, id := range []string{"evt_1", "evt_2", "evt_3"} {
+		archived := events.get(id)
+		assert.Equal(t, domain.WebhookEventIgnored, archived.Status, id)
+		assert.NotEmpty(t, archived.Error, id)
+	}
+}
+
+func TestWebhookService_FailedApplyIsRetriedOnRedelivery(t *testing.T) {
+	payments, events, verifier, service := setupWebhooks(t, domain.PaymentStatusProcessing)
+	ctx := context.Background()
+	verifier.events = []domain.WebhookEvent{stripeEvent("evt_1", domain.WebhookPaymentSucceeded)}
+
+	payments.updateErr = errors.New(errors.ErrInternal, "database unavailable")
+	assert.Error(t, service.HandleWebhook(ctx, domain.PaymentGatewayStripe, nil, []byte(`{}`)))
+	assert.Equal(t, domain.WebhookEventReceived, events.get("evt_1").Status)
+
+	payments.updateErr = nil
+	require.NoError(t, service.HandleWebhook(ctx, domain.PaymentGatewayStripe, nil, []byte(`{}`)))
+	assert.Equal(t, domain.PaymentStatusCompleted, payments.payments["pay-1"].Status)
+	assert.Equal(t, domain.WebhookEventApplied, events.get("evt_1").Status)
+}
+
+func TestWebhookService_RejectsUnverified(t *testing.T) {
+	_, events, verifier, service := setupWebhooks(t, domain.PaymentStatusProcessing)
+	verifier.err = errors.New(errors.ErrUnauthorized, "invalid Stripe signature")
+
+	err := service.HandleWebhook(context.Background(), domain.PaymentGatewayStripe, nil, []byte(`{}`))
+	assert.Equal(t, errors.ErrUnauthorized, err.(*errors.AppError).Code)
+
+	err = service.HandleWebhook(context.Background(), domain.PaymentGatewayAdyen, nil, []byte(`{}`))
+	assert.Equal(t, errors.ErrNotFound, err.(*errors.AppError).Code)
+	assert.Empty(t, events.events)
+}
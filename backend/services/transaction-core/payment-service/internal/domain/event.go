@@ -0,0 +1,34 @@
+package domain
+
+import "time"
+
+// PaymentEventType names what a payment event reports
+type PaymentEventType string
+
+const (
+	PaymentEventCompleted PaymentEventType = "PaymentCompleted"
+)
+
+// PaymentEvent tells other services about a payment, e.g. order-service
+// that an order was paid
+type PaymentEvent struct {
+	Type       PaymentEventType `json:"type"`
+	PaymentID  string           `json:"payment_id"`
+	OrderID    string           `json:"order_id"`
+	UserID     string           `json:"user_id"`
+	Amount     float64          `json:"amount"`
+	Currency   string           `json:"currency"`
+	OccurredAt time.Time        `json:"occurred_at"`
+}
+
+func (p *Payment) Event(eventType PaymentEventType, now time.Time) *PaymentEvent {
+	return &PaymentEvent{
+		Type:       eventType,
+		PaymentID:  p.ID,
+		OrderID:    p.OrderID,
+		UserID:     p.UserID,
+		Amount:     p.Amount,
+		Currency:   p.Currency,
+		OccurredAt: now,
+	}
+}
@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// GatewayErrorKind says what a failed gateway call means for the payment
+type GatewayErrorKind string
+
+const (
+	// GatewayDeclined: the gateway refused the payment, e.g. a declined card;
+	// trying again will not help
+	GatewayDeclined GatewayErrorKind = "DECLINED"
+	// GatewayRetryable: the gateway could not be reached, timed out or was
+	// overloaded; the payment may or may not have gone through, so retry
+	// with the same idempotency key
+	GatewayRetryable GatewayErrorKind = "RETRYABLE"
+	// GatewayRejected: the gateway turned down the request itself, e.g. bad
+	// credentials or an unknown transaction
+	GatewayRejected GatewayErrorKind = "REJECTED"
+)
+
+// GatewayError is a payment gateway call that failed, classified by what
+// the caller should do about it
+type GatewayError struct {
+	Gateway    PaymentGateway
+	Kind       GatewayErrorKind
+	Code       string // The gateway's own code, e.g. a decline reason
+	Message    string
+	StatusCode int // HTTP status, 0 if no response came
+	Err        error
+}
+
+func (e *GatewayError) Error() string {
+	msg := fmt.Sprintf("%s %s", e.Gateway, e.Kind)
+	if e.Code != "" {
+		msg += " (" + e.Code + ")"
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *GatewayError) Unwrap() error { return e.Err }
+
+// GatewayErrorKindOf returns the kind of gateway error err is or wraps, or
+// "" if it is none
+func GatewayErrorKindOf(err error) GatewayErrorKind {
+	var gatewayErr *GatewayError
+	if errors.As(err, &gatewayErr) {
+		return gatewayErr.Kind
+	}
+	return ""
+}
@@ -1,6 +1,8 @@
 package domain
 
 import (
+	"fmt"
+	"math"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,6 +17,14 @@ const (
 	PaymentStatusCompleted  PaymentStatus = "COMPLETED"
 	PaymentStatusFailed     PaymentStatus = "FAILED"
 	PaymentStatusRefunded   PaymentStatus = "REFUNDED"
+
+	// PaymentStatusPartiallyRefunded is a completed payment with part of its
+	// amount given back, e.g. for returned items
+	PaymentStatusPartiallyRefunded PaymentStatus = "PARTIALLY_REFUNDED"
+
+	// PaymentStatusDisputed is a completed payment the buyer disputed with
+	// their bank, e.g. a chargeback
+	PaymentStatusDisputed PaymentStatus = "DISPUTED"
 )
 
 type PaymentGateway string
@@ -36,6 +46,9 @@ type Payment struct {
 	Status               PaymentStatus
 	GatewayTransactionID string
 	IdempotencyKey       string
+	RefundedAmount       float64           // Sum of all refunds issued so far
+	Refunds              []string          // Our refund keys and gateway refund IDs of recorded refunds
+	RefundIDs            map[string]string // Gateway refund ID by our refund key
 	CreatedAt            time.Time
 	UpdatedAt            time.Time
 	Version              int
@@ -100,7 +113,7 @@ func (p *Payment) MarkCompleted() error {
 
 // MarkFailed marks payment as failed
 func (p *Payment) MarkFailed(reason string) error {
-	if p.Status == PaymentStatusCompleted || p.Status == PaymentStatusRefunded {
+	if p.Status == PaymentStatusCompleted || p.Status == PaymentStatusRefunded || p.Status == PaymentStatusPartiallyRefunded || p.Status == PaymentStatusDisputed {
 		return errors.New(errors.ErrInvalidInput, "cannot fail completed or refunded payment")
 	}
 	p.Status = PaymentStatusFailed
@@ -109,13 +122,79 @@ func (p *Payment) MarkFailed(reason string) error {
 	return nil
 }
 
-// Refund issues a refund for this payment
-func (p *Payment) Refund() error {
-	if p.Status != PaymentStatusCompleted {
+// RefundableAmount is what can still be refunded
+func (p *Payment) RefundableAmount() float64 {
+	return p.Amount - p.RefundedAmount
+}
+
+// Refund gives back part or all of the payment under key, which names the
+// refund at the gateway. The payment is REFUNDED once nothing is left to
+// refund, and PARTIALLY_REFUNDED until then.
+func (p *Payment) Refund(key string, amount float64) error {
+	if key == "" {
+		return errors.New(errors.ErrInvalidInput, "refund key is required")
+	}
+	if p.Status != PaymentStatusCompleted && p.Status != PaymentStatusPartiallyRefunded {
 		return errors.New(errors.ErrInvalidInput, "only completed payments can be refunded")
 	}
-	p.Status = PaymentStatusRefunded
+	if amount <= 0 {
+		return errors.New(errors.ErrInvalidInput, "refund amount must be positive")
+	}
+	// Compare in cents so float rounding can't block refunding the remainder
+	if math.Round(amount*100) > math.Round(p.RefundableAmount()*100) {
+		return errors.New(errors.ErrInvalidInput, "refund amount exceeds the refundable amount")
+	}
+
+	p.RefundedAmount += amount
+	p.Status = PaymentStatusPartiallyRefunded
+	if math.Round(p.RefundableAmount()*100) == 0 {
+		p.RefundedAmount = p.Amount
+		p.Status = PaymentStatusRefunded
+	}
+	p.UpdatedAt = time.Now()
+	p.Version++
+	p.Refunds = append(p.Refunds, key)
+	return nil
+}
+
+// RecordRefundID remembers the gateway's ID of the refund made under key
+func (p *Payment) RecordRefundID(key, refundID string) {
+	if p.RefundIDs == nil {
+		p.RefundIDs = make(map[string]string)
+	}
+	p.RefundIDs[key] = refundID
+}
+
+// RefundID returns the gateway's ID of the refund made under key
+func (p *Payment) RefundID(key string) (string, bool) {
+	refundID, ok := p.RefundIDs[key]
+	return refundID, ok
+}
+
+// HasRefund reports whether the refund with the given reference is recorded
+func (p *Payment) HasRefund(reference string) bool {
+	for _, r := range p.Refunds {
+		if r == reference {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkDisputed marks a completed payment as disputed by the buyer
+func (p *Payment) MarkDisputed() error {
+	if p.Status != PaymentStatusCompleted && p.Status != PaymentStatusPartiallyRefunded {
+		return errors.New(errors.ErrInvalidInput, "only completed payments can be disputed")
+	}
+	p.Status = PaymentStatusDisputed
 	p.UpdatedAt = time.Now()
 	p.Version++
 	return nil
 }
+
+// RefundKey names the next refund when the caller brings no key of its own.
+// It changes with every change to the payment, so it only keeps a refund
+// retried before it was saved from reaching the gateway twice.
+func (p *Payment) RefundKey() string {
+	return fmt.Sprintf("%s-refund-%d", p.ID, p.Version+1)
+}
@@ -7,6 +7,7 @@ type Repository interface {
 	Save(ctx context.Context, payment *Payment) error
 	FindByID(ctx context.Context, paymentID string) (*Payment, error)
 	FindByOrderID(ctx context.Context, orderID string) (*Payment, error)
+	FindByGatewayTransactionID(ctx context.Context, gateway PaymentGateway, gatewayTransactionID string) (*Payment, error)
 	FindByIdempotencyKey(ctx context.Context, key string) (*Payment, error)
 	Update(ctx context.Context, payment *Payment) error
 }
@@ -14,6 +15,18 @@ type Repository interface {
 // PaymentGatewayProvider defines the interface for payment gateway integrations
 type PaymentGatewayProvider interface {
 	ProcessPayment(ctx context.Context, payment *Payment, paymentMethodID string) (gatewayTransactionID string, clientSecret string, err error)
-	RefundPayment(ctx context.Context, gatewayTransactionID string, amount float64) (refundID string, err error)
+	// RefundPayment gives back amount of a payment that already records the
+	// refund; refundKey names the refund for the gateway's idempotency
+	RefundPayment(ctx context.Context, payment *Payment, refundKey string, amount float64) (refundID string, err error)
 	VerifyPayment(ctx context.Context, gatewayTransactionID string) (verified bool, err error)
 }
+
+// WebhookEventRepository archives the webhook events gateways send
+type WebhookEventRepository interface {
+	// Archive stores a new event; it returns false if the gateway's event
+	// ID is already archived, storing nothing
+	Archive(ctx context.Context, event *WebhookEvent) (bool, error)
+	FindByEventID(ctx context.Context, gateway PaymentGateway, eventID string) (*WebhookEvent, error)
+	// Update records how processing the event went
+	Update(ctx context.Context, event *WebhookEvent) error
+}
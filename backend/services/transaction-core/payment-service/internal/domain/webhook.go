@@ -0,0 +1,138 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// WebhookEventType is what a gateway event means for the payment it is about
+type WebhookEventType string
+
+const (
+	WebhookPaymentSucceeded WebhookEventType = "PAYMENT_SUCCEEDED"
+	WebhookPaymentFailed    WebhookEventType = "PAYMENT_FAILED"
+	WebhookPaymentRefunded  WebhookEventType = "PAYMENT_REFUNDED"
+	WebhookPaymentDisputed  WebhookEventType = "PAYMENT_DISPUTED"
+)
+
+// WebhookEventStatus is how far an archived event got
+type WebhookEventStatus string
+
+const (
+	// WebhookEventReceived: archived but not applied yet, e.g. because
+	// applying it failed; a redelivery applies it again
+	WebhookEventReceived WebhookEventStatus = "RECEIVED"
+	// WebhookEventApplied: the payment was updated, or already agreed
+	WebhookEventApplied WebhookEventStatus = "APPLIED"
+	// WebhookEventIgnored: the event does not concern a payment of ours, or
+	// its payment cannot make the transition, e.g. a success after a failure
+	WebhookEventIgnored WebhookEventStatus = "IGNORED"
+)
+
+// WebhookEvent is a verified event a gateway pushed to us, kept with the
+// payload it came in for debugging
+type WebhookEvent struct {
+	ID          string
+	Gateway     PaymentGateway
+	EventID     string           // The gateway's; unique per gateway
+	GatewayType string           // The gateway's name for it, e.g. payment_intent.succeeded
+	Type        WebhookEventType // "" if it does not affect payments
+
+	// What identifies the payment: our payment ID if the gateway echoes it,
+	// the gateway's transaction ID otherwise
+	PaymentID            string
+	GatewayTransactionID string
+
+	RefundID        string  // Of refund events: the gateway's refund ID
+	RefundReference string  // Of refund events: our refund key, if we issued it
+	Amount          float64 // Of refund events
+	Reason          string  // Of failures and disputes
+
+	Payload     []byte // As received
+	Status      WebhookEventStatus
+	Error       string // Why it was ignored
+	OccurredAt  time.Time
+	ReceivedAt  time.Time
+	ProcessedAt *time.Time
+}
+
+// Processed records the outcome of applying the event
+func (e *WebhookEvent) Processed(status WebhookEventStatus, reason string, now time.Time) {
+	e.Status = status
+	e.Error = reason
+	e.ProcessedAt = &now
+}
+
+// Apply moves the payment along for a gateway event. It reports false if
+// the payment already reflects the event, e.g. for the confirmation of a
+// refund we issued, and fails if the payment cannot make the transition.
+func (p *Payment) Apply(event *WebhookEvent) (bool, error) {
+	// However many steps the event takes it, e.g. pending to completed, the
+	// payment is saved once, as one version
+	version := p.Version
+	changed, err := p.apply(event)
+	if changed {
+		p.Version = version + 1
+	}
+	return changed, err
+}
+
+func (p *Payment) apply(event *WebhookEvent) (bool, error) {
+	switch event.Type {
+	case WebhookPaymentSucceeded:
+		switch p.Status {
+		case PaymentStatusPending:
+			// The gateway took it though our call failed
+			if err := p.MarkProcessing(event.GatewayTransactionID); err != nil {
+				return false, err
+			}
+		case PaymentStatusProcessing:
+			// e.g. a PayPal order is confirmed by the ID of its capture
+			if event.GatewayTransactionID != "" {
+				p.GatewayTransactionID = event.GatewayTransactionID
+			}
+		case PaymentStatusCompleted, PaymentStatusPartiallyRefunded, PaymentStatusRefunded, PaymentStatusDisputed:
+			return false, nil
+		}
+		return applied(p.MarkCompleted())
+
+	case WebhookPaymentFailed:
+		if p.Status == PaymentStatusFailed {
+			return false, nil
+		}
+		return applied(p.MarkFailed(event.Reason))
+
+	case WebhookPaymentRefunded:
+		if p.HasRefund(event.RefundReference) || p.HasRefund(event.RefundID) {
+			return false, nil
+		}
+		// Issued at the gateway, e.g. from its dashboard, or by us and
+		// confirmed before we saved it
+		key := event.RefundReference
+		if key == "" {
+			key = p.RefundKey()
+		}
+		if err := p.Refund(key, event.Amount); err != nil {
+			return false, err
+		}
+		if event.RefundID != "" {
+			p.Refunds = append(p.Refunds, event.RefundID)
+			p.RecordRefundID(key, event.RefundID)
+		}
+		return true, nil
+
+	case WebhookPaymentDisputed:
+		if p.Status == PaymentStatusDisputed {
+			return false, nil
+		}
+		return applied(p.MarkDisputed())
+
+	default:
+		return false, errors.New(errors.ErrInvalidInput, "event does not affect payments")
+	}
+}
+
+func applied(err error) (bool, error) {
+	return err == nil, err
+}
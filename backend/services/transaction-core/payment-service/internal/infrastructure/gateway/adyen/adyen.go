@@ -0,0 +1,147 @@
+// Package adyen takes payments through Adyen's Checkout API
+package adyen
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+const (
+	DefaultBaseURL = "https://checkout-test.adyen.com"
+	apiVersion     = "/v71"
+)
+
+type Config struct {
+	gateway.Options
+	BaseURL         string
+	APIKey          string
+	MerchantAccount string
+}
+
+// Gateway pays with a shopper's stored card. Payments that need the
+// shopper, e.g. for 3-D Secure, come back with the action for the
+// frontend to perform as the client secret.
+type Gateway struct {
+	client          *gateway.Client
+	merchantAccount string
+	logger          *logger.Logger
+}
+
+func New(cfg Config, logger *logger.Logger) *Gateway {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	return &Gateway{
+		client: gateway.NewClient(gateway.Config{
+			Options:     cfg.Options,
+			Gateway:     domain.PaymentGatewayAdyen,
+			BaseURL:     cfg.BaseURL,
+			Signer:      gateway.APIKey("X-API-Key", cfg.APIKey),
+			DecodeError: decodeError,
+		}, logger),
+		merchantAccount: cfg.MerchantAccount,
+		logger:          logger,
+	}
+}
+
+type amount struct {
+	Value    int64  `json:"value"`
+	Currency string `json:"currency"`
+}
+
+type paymentResponse struct {
+	PSPReference      string          `json:"pspReference"`
+	ResultCode        string          `json:"resultCode"`
+	RefusalReason     string          `json:"refusalReason"`
+	RefusalReasonCode string          `json:"refusalReasonCode"`
+	Action            json.RawMessage `json:"action"`
+}
+
+func (g *Gateway) ProcessPayment(ctx context.Context, payment *domain.Payment, paymentMethodID string) (string, string, error) {
+	body := map[string]interface{}{
+		"merchantAccount":        g.merchantAccount,
+		"reference":              payment.ID,
+		"merchantOrderReference": payment.OrderID,
+		"amount":                 amount{Value: gateway.MinorUnits(payment.Amount, payment.Currency), Currency: payment.Currency},
+		"paymentMethod": map[string]string{
+			"type":                  "scheme",
+			"storedPaymentMethodId": paymentMethodID,
+		},
+		"shopperReference":         payment.UserID,
+		"shopperInteraction":       "ContAuth",
+		"recurringProcessingModel": "CardOnFile",
+	}
+
+	var resp paymentResponse
+	err := g.client.Do(ctx, &gateway.Request{
+		Method:         http.MethodPost,
+		Path:           apiVersion + "/payments",
+		IdempotencyKey: payment.IdempotencyKey,
+		JSON:           body,
+	}, &resp)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch resp.ResultCode {
+	case "Authorised", "Pending", "Received":
+		g.logger.Infof("Adyen payment %s: payment=%s, result=%s", resp.PSPReference, payment.ID, resp.ResultCode)
+		return resp.PSPReference, "", nil
+	case "RedirectShopper", "IdentifyShopper", "ChallengeShopper", "PresentToShopper":
+		g.logger.Infof("Adyen payment %s awaits the shopper: payment=%s, result=%s", resp.PSPReference, payment.ID, resp.ResultCode)
+		return resp.PSPReference, string(resp.Action), nil
+	case "Refused", "Cancelled":
+		return "", "", &domain.GatewayError{Gateway: domain.PaymentGatewayAdyen, Kind: domain.GatewayDeclined,
+			Code: resp.RefusalReasonCode, Message: resp.RefusalReason}
+	default:
+		return "", "", &domain.GatewayError{Gateway: domain.PaymentGatewayAdyen, Kind: domain.GatewayRejected,
+			Code: resp.ResultCode, Message: resp.RefusalReason}
+	}
+}
+
+func (g *Gateway) RefundPayment(ctx context.Context, payment *domain.Payment, refundKey string, refundAmount float64) (string, error) {
+	var resp struct {
+		PSPReference string `json:"pspReference"`
+		Status       string `json:"status"`
+	}
+	err := g.client.Do(ctx, &gateway.Request{
+		Method:         http.MethodPost,
+		Path:           apiVersion + "/payments/" + url.PathEscape(payment.GatewayTransactionID) + "/refunds",
+		IdempotencyKey: refundKey,
+		JSON: map[string]interface{}{
+			"merchantAccount": g.merchantAccount,
+			"reference":       refundKey,
+			"amount":          amount{Value: gateway.MinorUnits(refundAmount, payment.Currency), Currency: payment.Currency},
+		},
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.PSPReference, nil
+}
+
+// VerifyPayment is not offered: Adyen's Checkout API has no lookup, and
+// reports the outcome of payments by webhook only
+func (g *Gateway) VerifyPayment(ctx context.Context, gatewayTransactionID string) (bool, error) {
+	return false, &domain.GatewayError{Gateway: domain.PaymentGatewayAdyen, Kind: domain.GatewayRejected,
+		Code: "UNSUPPORTED", Message: "payments are confirmed by webhook"}
+}
+
+// decodeError reads Adyen's service error; refusals come as a 200 with a
+// resultCode instead
+func decodeError(status int, body []byte) (domain.GatewayErrorKind, string, string) {
+	var resp struct {
+		ErrorCode string `json:"errorCode"`
+		Message   string `json:"message"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return "", "", ""
+	}
+	return "", resp.ErrorCode, resp.Message
+}
@@ -0,0 +1,71 @@
+package adyen_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway/adyen"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway/simulator"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+func setup(t *testing.T, rules ...simulator.Rule) (*adyen.Gateway, *domain.Payment) {
+	srv := httptest.NewServer(simulator.New(simulator.Config{AdyenAPIKey: "key"}, rules))
+	t.Cleanup(srv.Close)
+
+	g := adyen.New(adyen.Config{
+		Options:         gateway.Options{Timeout: 200 * time.Millisecond, MaxAttempts: 2, Backoff: time.Millisecond},
+		BaseURL:         srv.URL,
+		APIKey:          "key",
+		MerchantAccount: "TitanECOM",
+	}, logger.New(logger.Config{Level: "error", ServiceName: "test"}))
+
+	payment, err := domain.NewPayment("order-1", "user-1", 42.50, "EUR", domain.PaymentGatewayAdyen, "idem-1")
+	require.NoError(t, err)
+	return g, payment
+}
+
+func TestGateway_AuthoriseAndRefund(t *testing.T) {
+	g, payment := setup(t)
+	ctx := context.Background()
+
+	psp, _, err := g.ProcessPayment(ctx, payment, "8415995487234100")
+	require.NoError(t, err)
+	assert.NotEmpty(t, psp)
+
+	require.NoError(t, payment.MarkProcessing(psp))
+	require.NoError(t, payment.MarkCompleted())
+	require.NoError(t, payment.Refund("ref-1", 10))
+	refundID, err := g.RefundPayment(ctx, payment, "ref-1", 10)
+	require.NoError(t, err)
+	assert.NotEmpty(t, refundID)
+}
+
+func TestGateway_Refused(t *testing.T) {
+	g, payment := setup(t, simulator.Rule{Outcome: simulator.Decline, Code: "12"})
+
+	_, _, err := g.ProcessPayment(context.Background(), payment, "8415995487234100")
+
+	var gatewayErr *domain.GatewayError
+	require.ErrorAs(t, err, &gatewayErr)
+	assert.Equal(t, domain.GatewayDeclined, gatewayErr.Kind)
+	assert.Equal(t, "12", gatewayErr.Code)
+	assert.Equal(t, "Not enough balance", gatewayErr.Message)
+}
+
+func TestGateway_OutageOutlastingRetries(t *testing.T) {
+	g, payment := setup(t, simulator.Rule{Outcome: simulator.Unavailable})
+
+	_, _, err := g.ProcessPayment(context.Background(), payment, "8415995487234100")
+
+	var gatewayErr *domain.GatewayError
+	require.ErrorAs(t, err, &gatewayErr)
+	assert.Equal(t, domain.GatewayRetryable, gatewayErr.Kind)
+	assert.Equal(t, 503, gatewayErr.StatusCode)
+}
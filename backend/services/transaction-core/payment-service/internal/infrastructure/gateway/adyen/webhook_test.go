@@ -0,0 +1,76 @@
+package adyen_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway/adyen"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+const hmacKey = "44782DEF547AAA06C910C43932B1EB0C71FC68D9D0C057550C48EC2ACF6BA056"
+
+// item renders a notification item signed as Adyen documents it
+func item(psp, original, reference string, value int64, eventCode, success string) string {
+	key, _ := hex.DecodeString(hmacKey)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.Join([]string{psp, original, "TitanECOM", reference, fmt.Sprint(value), "EUR", eventCode, success}, ":")))
+	return fmt.Sprintf(`{"NotificationRequestItem":{"additionalData":{"hmacSignature":%q},
+		"amount":{"value":%d,"currency":"EUR"},"eventCode":%q,"eventDate":"2026-10-18T12:00:00+02:00",
+		"merchantAccountCode":"TitanECOM","merchantReference":%q,"originalReference":%q,
+		"pspReference":%q,"reason":"","success":%q}}`,
+		base64.StdEncoding.EncodeToString(mac.Sum(nil)), value, eventCode, reference, original, psp, success)
+}
+
+func notification(items ...string) []byte {
+	return []byte(`{"live":"false","notificationItems":[` + strings.Join(items, ",") + `]}`)
+}
+
+func TestWebhookVerifier_ReadsSignedItems(t *testing.T) {
+	v, err := adyen.NewWebhookVerifier(hmacKey)
+	require.NoError(t, err)
+
+	events, err := v.VerifyWebhook(context.Background(), nil, notification(
+		item("PSP1", "", "pay-1", 4250, "AUTHORISATION", "true"),
+		item("PSP2", "PSP1", "pay-1-refund-4", 1000, "REFUND", "true"),
+		item("PSP1", "", "", 4250, "CHARGEBACK", "true"),
+	))
+
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, domain.WebhookPaymentSucceeded, events[0].Type)
+	assert.Equal(t, "pay-1", events[0].PaymentID)
+	assert.Equal(t, "PSP1", events[0].GatewayTransactionID)
+	assert.Equal(t, "PSP1:AUTHORISATION:true", events[0].EventID)
+
+	assert.Equal(t, domain.WebhookPaymentRefunded, events[1].Type)
+	assert.Equal(t, "PSP1", events[1].GatewayTransactionID)
+	assert.Equal(t, "pay-1-refund-4", events[1].RefundReference)
+	assert.Equal(t, 10.0, events[1].Amount)
+
+	assert.Equal(t, domain.WebhookPaymentDisputed, events[2].Type)
+	assert.Equal(t, "PSP1", events[2].GatewayTransactionID)
+}
+
+func TestWebhookVerifier_RejectsTamperedItem(t *testing.T) {
+	v, err := adyen.NewWebhookVerifier(hmacKey)
+	require.NoError(t, err)
+	tampered := strings.Replace(item("PSP2", "PSP1", "pay-1-refund-4", 1000, "REFUND", "true"), `"value":1000`, `"value":100000`, 1)
+
+	_, err = v.VerifyWebhook(context.Background(), nil, notification(
+		item("PSP1", "", "pay-1", 4250, "AUTHORISATION", "true"),
+		tampered,
+	))
+
+	require.Error(t, err)
+	assert.Equal(t, errors.ErrUnauthorized, err.(*errors.AppError).Code)
+}
@@ -0,0 +1,39 @@
+package gateway
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Currencies whose minor unit is not a hundredth, by their number of
+// decimals (ISO 4217)
+var currencyDecimals = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "JPY": 0, "KMF": 0, "KRW": 0, "MGA": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "JOD": 3, "KWD": 3, "OMR": 3, "TND": 3,
+}
+
+func decimals(currency string) int {
+	if n, ok := currencyDecimals[strings.ToUpper(currency)]; ok {
+		return n
+	}
+	return 2
+}
+
+// MinorUnits converts an amount to the currency's smallest unit, e.g.
+// cents, as Stripe and Adyen want it
+func MinorUnits(amount float64, currency string) int64 {
+	return int64(math.Round(amount * math.Pow10(decimals(currency))))
+}
+
+// FromMinorUnits converts an amount in the currency's smallest unit back
+func FromMinorUnits(units int64, currency string) float64 {
+	return float64(units) / math.Pow10(decimals(currency))
+}
+
+// DecimalAmount formats an amount with the currency's decimals, as PayPal
+// wants it
+func DecimalAmount(amount float64, currency string) string {
+	return strconv.FormatFloat(amount, 'f', decimals(currency), 64)
+}
@@ -0,0 +1,196 @@
+// Package gateway holds what the payment gateway adapters share: an HTTP
+// client that signs requests, times them out, retries what is safe to retry
+// and classifies failures as declined, retryable or rejected.
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// maxErrorBody is how much of an error response is read for classifying it
+const maxErrorBody = 64 << 10
+
+// ErrorDecoder reads a gateway's error response. It returns the gateway's
+// code and message, and a kind if the body says more than the status does,
+// e.g. a decline sent as 422; "" leaves the kind to the status.
+type ErrorDecoder func(status int, body []byte) (kind domain.GatewayErrorKind, code, message string)
+
+// Options tune how an adapter calls its gateway
+type Options struct {
+	Timeout     time.Duration // Per attempt
+	MaxAttempts int           // Of a retryable call; 0 or 1 attempts once
+	Backoff     time.Duration // Before the second attempt, doubling after
+}
+
+type Config struct {
+	Options
+	Gateway           domain.PaymentGateway
+	BaseURL           string
+	Signer            Signer
+	IdempotencyHeader string // Defaults to Idempotency-Key
+	DecodeError       ErrorDecoder
+}
+
+// Request is one gateway API call. Its body is JSON or, if Form is set,
+// form-encoded.
+type Request struct {
+	Method         string
+	Path           string
+	IdempotencyKey string // Makes a non-GET call safe to retry
+	JSON           interface{}
+	Form           url.Values
+}
+
+type Client struct {
+	cfg    Config
+	http   *http.Client
+	logger *logger.Logger
+}
+
+func NewClient(cfg Config, logger *logger.Logger) *Client {
+	if cfg.IdempotencyHeader == "" {
+		cfg.IdempotencyHeader = "Idempotency-Key"
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	return &Client{
+		cfg:    cfg,
+		http:   &http.Client{Timeout: cfg.Timeout},
+		logger: logger,
+	}
+}
+
+// Do sends the request and decodes a successful response into out, if
+// given. Every failure is a *domain.GatewayError. Retryable failures are
+// tried again with the same idempotency key while attempts are left; calls
+// without a key are only retried if they are GETs.
+func (c *Client) Do(ctx context.Context, req *Request, out interface{}) error {
+	body, contentType, err := encode(req)
+	if err != nil {
+		return c.fail(domain.GatewayRejected, 0, "", "invalid request", err)
+	}
+
+	retriable := req.Method == http.MethodGet || req.IdempotencyKey != ""
+	wait := c.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		err := c.attempt(ctx, req, body, contentType, out)
+		if err == nil {
+			return nil
+		}
+		if !retriable || attempt >= c.cfg.MaxAttempts || domain.GatewayErrorKindOf(err) != domain.GatewayRetryable {
+			return err
+		}
+		c.logger.Warnf("Gateway call failed, retrying: gateway=%s, %s %s, attempt=%d, error=%v",
+			c.cfg.Gateway, req.Method, req.Path, attempt, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, req *Request, body []byte, contentType string, out interface{}) error {
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, strings.TrimRight(c.cfg.BaseURL, "/")+req.Path, bytes.NewReader(body))
+	if err != nil {
+		return c.fail(domain.GatewayRejected, 0, "", "invalid request", err)
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	if req.IdempotencyKey != "" {
+		httpReq.Header.Set(c.cfg.IdempotencyHeader, req.IdempotencyKey)
+	}
+	if c.cfg.Signer != nil {
+		if err := c.cfg.Signer.Sign(ctx, httpReq, body); err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		// Timeouts, refused connections and cancelled calls alike: the
+		// gateway may have acted on the request or not
+		return c.fail(domain.GatewayRetryable, 0, "", "no response", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if out == nil {
+			return nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return c.fail(domain.GatewayRetryable, resp.StatusCode, "", "unreadable response", err)
+		}
+		return nil
+	}
+
+	errBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	kind, code, message := domain.GatewayErrorKind(""), "", ""
+	if c.cfg.DecodeError != nil {
+		kind, code, message = c.cfg.DecodeError(resp.StatusCode, errBody)
+	}
+	if kind == "" {
+		kind = KindOfStatus(resp.StatusCode)
+	}
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+	return c.fail(kind, resp.StatusCode, code, message, nil)
+}
+
+func (c *Client) fail(kind domain.GatewayErrorKind, status int, code, message string, err error) *domain.GatewayError {
+	return &domain.GatewayError{
+		Gateway:    c.cfg.Gateway,
+		Kind:       kind,
+		Code:       code,
+		Message:    message,
+		StatusCode: status,
+		Err:        err,
+	}
+}
+
+// KindOfStatus classifies an error status: overload, timeouts, conflicts on
+// an idempotency key still in use and server errors are retryable, 402 is a
+// decline and anything else is a rejected request
+func KindOfStatus(status int) domain.GatewayErrorKind {
+	switch {
+	case status == http.StatusRequestTimeout, status == http.StatusConflict,
+		status == http.StatusTooManyRequests, status >= 500:
+		return domain.GatewayRetryable
+	case status == http.StatusPaymentRequired:
+		return domain.GatewayDeclined
+	default:
+		return domain.GatewayRejected
+	}
+}
+
+func encode(req *Request) ([]byte, string, error) {
+	switch {
+	case req.Form != nil:
+		return []byte(req.Form.Encode()), "application/x-www-form-urlencoded", nil
+	case req.JSON != nil:
+		body, err := json.Marshal(req.JSON)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to marshal request: %w", err)
+		}
+		return body, "application/json", nil
+	default:
+		return nil, "", nil
+	}
+}
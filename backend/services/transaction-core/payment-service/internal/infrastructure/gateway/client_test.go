@@ -0,0 +1,98 @@
+package gateway_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+func newClient(url string, opts gateway.Options) *gateway.Client {
+	return gateway.NewClient(gateway.Config{
+		Options: opts,
+		Gateway: domain.PaymentGatewayStripe,
+		BaseURL: url,
+		Signer:  gateway.BearerToken("sk_test"),
+	}, logger.New(logger.Config{Level: "error", ServiceName: "test"}))
+}
+
+func TestClient_RetriesKeyedRequestUntilSuccess(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer sk_test", r.Header.Get("Authorization"))
+		assert.Equal(t, "key-1", r.Header.Get("Idempotency-Key"))
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"id":"ok"}`))
+	}))
+	defer srv.Close()
+
+	var out struct{ ID string }
+	err := newClient(srv.URL, gateway.Options{MaxAttempts: 3, Backoff: time.Millisecond}).
+		Do(context.Background(), &gateway.Request{Method: http.MethodPost, Path: "/x", IdempotencyKey: "key-1"}, &out)
+
+	require.NoError(t, err)
+	assert.Equal(t, "ok", out.ID)
+	assert.Equal(t, int32(3), calls)
+}
+
+func TestClient_DoesNotRetryUnkeyedPost(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	err := newClient(srv.URL, gateway.Options{MaxAttempts: 3, Backoff: time.Millisecond}).
+		Do(context.Background(), &gateway.Request{Method: http.MethodPost, Path: "/x"}, nil)
+
+	assert.Equal(t, domain.GatewayRetryable, domain.GatewayErrorKindOf(err))
+	assert.Equal(t, int32(1), calls)
+}
+
+func TestClient_TimeoutIsRetryable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	err := newClient(srv.URL, gateway.Options{Timeout: 20 * time.Millisecond}).
+		Do(context.Background(), &gateway.Request{Method: http.MethodGet, Path: "/x"}, nil)
+
+	assert.Equal(t, domain.GatewayRetryable, domain.GatewayErrorKindOf(err))
+}
+
+func TestKindOfStatus(t *testing.T) {
+	cases := map[int]domain.GatewayErrorKind{
+		http.StatusPaymentRequired:     domain.GatewayDeclined,
+		http.StatusTooManyRequests:     domain.GatewayRetryable,
+		http.StatusConflict:            domain.GatewayRetryable,
+		http.StatusInternalServerError: domain.GatewayRetryable,
+		http.StatusUnauthorized:        domain.GatewayRejected,
+		http.StatusBadRequest:          domain.GatewayRejected,
+	}
+	for status, kind := range cases {
+		assert.Equal(t, kind, gateway.KindOfStatus(status), "status %d", status)
+	}
+}
+
+func TestMinorUnits(t *testing.T) {
+	assert.Equal(t, int64(9999), gateway.MinorUnits(99.99, "USD"))
+	assert.Equal(t, int64(500), gateway.MinorUnits(500, "JPY"))
+	assert.Equal(t, "99.99", gateway.DecimalAmount(99.99, "USD"))
+	assert.Equal(t, 99.99, gateway.FromMinorUnits(9999, "usd"))
+}
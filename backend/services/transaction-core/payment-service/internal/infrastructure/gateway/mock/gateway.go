@@ -25,9 +25,9 @@ func (g *MockPaymentGateway) ProcessPayment(ctx context.Context, payment *domain
 	return gatewayTxnID, clientSecret, nil
 }
 
-func (g *MockPaymentGateway) RefundPayment(ctx context.Context, gatewayTransactionID string, amount float64) (string, error) {
+func (g *MockPaymentGateway) RefundPayment(ctx context.Context, payment *domain.Payment, refundKey string, amount float64) (string, error) {
 	refundID := "mock_refund_" + uuid.New().String()[:8]
-	g.logger.Infof("MOCK: Refunding transaction %s for $%.2f", gatewayTransactionID, amount)
+	g.logger.Infof("MOCK: Refunding transaction %s for $%.2f", payment.GatewayTransactionID, amount)
 	return refundID, nil
 }
 
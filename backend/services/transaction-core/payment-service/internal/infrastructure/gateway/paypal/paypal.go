@@ -0,0 +1,257 @@
+// Package paypal takes payments through PayPal's Orders v2 API
+package paypal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+const DefaultBaseURL = "https://api-m.paypal.com"
+
+// tokenMargin is how long before it expires an access token is renewed
+const tokenMargin = time.Minute
+
+// Issues PayPal answers a refused payment with
+var declineIssues = map[string]bool{
+	"INSTRUMENT_DECLINED":            true,
+	"PAYER_CANNOT_PAY":               true,
+	"PAYER_ACCOUNT_RESTRICTED":       true,
+	"PAYER_ACCOUNT_LOCKED_OR_CLOSED": true,
+	"TRANSACTION_REFUSED":            true,
+	"CARD_EXPIRED":                   true,
+	"COMPLIANCE_VIOLATION":           true,
+}
+
+type Config struct {
+	gateway.Options
+	BaseURL      string
+	ClientID     string
+	ClientSecret string
+}
+
+// Gateway creates and captures an order per payment. The payment method is
+// a vaulted payment token; a buyer who still has to approve is sent to the
+// approval link, returned as the client secret.
+type Gateway struct {
+	client *gateway.Client
+	logger *logger.Logger
+}
+
+func New(cfg Config, logger *logger.Logger) *Gateway {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	return &Gateway{
+		client: newClient(cfg, logger),
+		logger: logger,
+	}
+}
+
+// newClient returns a client for the REST API, signing in with the
+// client credentials
+func newClient(cfg Config, logger *logger.Logger) *gateway.Client {
+	tokens := &tokenSource{
+		client: gateway.NewClient(gateway.Config{
+			Options:     cfg.Options,
+			Gateway:     domain.PaymentGatewayPayPal,
+			BaseURL:     cfg.BaseURL,
+			Signer:      gateway.BasicAuth(cfg.ClientID, cfg.ClientSecret),
+			DecodeError: decodeError,
+		}, logger),
+	}
+	return gateway.NewClient(gateway.Config{
+		Options:           cfg.Options,
+		Gateway:           domain.PaymentGatewayPayPal,
+		BaseURL:           cfg.BaseURL,
+		Signer:            tokens,
+		IdempotencyHeader: "PayPal-Request-Id",
+		DecodeError:       decodeError,
+	}, logger)
+}
+
+type money struct {
+	CurrencyCode string `json:"currency_code"`
+	Value        string `json:"value"`
+}
+
+type capture struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+type order struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	PurchaseUnits []struct {
+		Payments struct {
+			Captures []capture `json:"captures"`
+		} `json:"payments"`
+	} `json:"purchase_units"`
+	Links []struct {
+		Href string `json:"href"`
+		Rel  string `json:"rel"`
+	} `json:"links"`
+}
+
+func (g *Gateway) ProcessPayment(ctx context.Context, payment *domain.Payment, paymentMethodID string) (string, string, error) {
+	body := map[string]interface{}{
+		"intent": "CAPTURE",
+		"purchase_units": []map[string]interface{}{{
+			"reference_id": payment.OrderID,
+			"custom_id":    payment.ID,
+			"amount":       money{CurrencyCode: payment.Currency, Value: gateway.DecimalAmount(payment.Amount, payment.Currency)},
+		}},
+		"payment_source": map[string]interface{}{
+			"token": map[string]string{"id": paymentMethodID, "type": "BILLING_AGREEMENT"},
+		},
+	}
+
+	var o order
+	err := g.client.Do(ctx, &gateway.Request{
+		Method:         http.MethodPost,
+		Path:           "/v2/checkout/orders",
+		IdempotencyKey: payment.IdempotencyKey,
+		JSON:           body,
+	}, &o)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Captured straight away: the capture is what gets refunded
+	for _, unit := range o.PurchaseUnits {
+		for _, c := range unit.Payments.Captures {
+			if c.Status == "DECLINED" || c.Status == "FAILED" {
+				return "", "", &domain.GatewayError{Gateway: domain.PaymentGatewayPayPal, Kind: domain.GatewayDeclined,
+					Code: c.Status, Message: "capture " + c.Status}
+			}
+			g.logger.Infof("PayPal order %s captured: payment=%s, capture=%s, status=%s", o.ID, payment.ID, c.ID, c.Status)
+			return c.ID, "", nil
+		}
+	}
+
+	// Otherwise the buyer has to approve the order first
+	approveURL := ""
+	for _, link := range o.Links {
+		if link.Rel == "payer-action" || link.Rel == "approve" {
+			approveURL = link.Href
+		}
+	}
+	g.logger.Infof("PayPal order %s awaits the buyer: payment=%s, status=%s", o.ID, payment.ID, o.Status)
+	return o.ID, approveURL, nil
+}
+
+func (g *Gateway) RefundPayment(ctx context.Context, payment *domain.Payment, refundKey string, amount float64) (string, error) {
+	var r capture
+	err := g.client.Do(ctx, &gateway.Request{
+		Method:         http.MethodPost,
+		Path:           "/v2/payments/captures/" + url.PathEscape(payment.GatewayTransactionID) + "/refund",
+		IdempotencyKey: refundKey,
+		JSON: map[string]interface{}{
+			"amount": money{CurrencyCode: payment.Currency, Value: gateway.DecimalAmount(amount, payment.Currency)},
+			// Tells the refund's webhook apart from refunds issued elsewhere
+			"custom_id": refundKey,
+		},
+	}, &r)
+	if err != nil {
+		return "", err
+	}
+	if r.Status == "FAILED" || r.Status == "CANCELLED" {
+		return "", &domain.GatewayError{Gateway: domain.PaymentGatewayPayPal, Kind: domain.GatewayDeclined,
+			Code: r.Status, Message: "refund " + r.Status}
+	}
+	return r.ID, nil
+}
+
+func (g *Gateway) VerifyPayment(ctx context.Context, gatewayTransactionID string) (bool, error) {
+	var c capture
+	err := g.client.Do(ctx, &gateway.Request{
+		Method: http.MethodGet,
+		Path:   "/v2/payments/captures/" + url.PathEscape(gatewayTransactionID),
+	}, &c)
+	if err != nil {
+		return false, err
+	}
+	return c.Status == "COMPLETED", nil
+}
+
+// decodeError reads PayPal's error object; refusals come as 422 with the
+// reason as the first detail's issue
+func decodeError(status int, body []byte) (domain.GatewayErrorKind, string, string) {
+	var resp struct {
+		Name             string `json:"name"`
+		Message          string `json:"message"`
+		Error            string `json:"error"` // OAuth errors
+		ErrorDescription string `json:"error_description"`
+		Details          []struct {
+			Issue       string `json:"issue"`
+			Description string `json:"description"`
+		} `json:"details"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return "", "", ""
+	}
+
+	if resp.Error != "" {
+		return "", resp.Error, resp.ErrorDescription
+	}
+	if len(resp.Details) > 0 {
+		detail := resp.Details[0]
+		if declineIssues[detail.Issue] {
+			return domain.GatewayDeclined, detail.Issue, detail.Description
+		}
+		return "", detail.Issue, detail.Description
+	}
+	return "", resp.Name, resp.Message
+}
+
+// tokenSource signs requests with an OAuth access token, fetched with the
+// client credentials and kept until shortly before it expires
+type tokenSource struct {
+	client *gateway.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func (t *tokenSource) Sign(ctx context.Context, req *http.Request, body []byte) error {
+	token, err := t.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (t *tokenSource) accessToken(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Now().Before(t.expiresAt) {
+		return t.token, nil
+	}
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"` // Seconds
+	}
+	err := t.client.Do(ctx, &gateway.Request{
+		Method: http.MethodPost,
+		Path:   "/v1/oauth2/token",
+		Form:   url.Values{"grant_type": {"client_credentials"}},
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+
+	t.token = resp.AccessToken
+	t.expiresAt = time.Now().Add(time.Duration(resp.ExpiresIn)*time.Second - tokenMargin)
+	return t.token, nil
+}
@@ -0,0 +1,85 @@
+package paypal_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway/paypal"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway/simulator"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+func setup(t *testing.T, rules ...simulator.Rule) (*paypal.Gateway, *domain.Payment) {
+	srv := httptest.NewServer(simulator.New(simulator.Config{PayPalClientID: "client", PayPalClientSecret: "secret"}, rules))
+	t.Cleanup(srv.Close)
+
+	g := paypal.New(paypal.Config{
+		Options:      gateway.Options{Timeout: 200 * time.Millisecond, MaxAttempts: 2, Backoff: time.Millisecond},
+		BaseURL:      srv.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+	}, logger.New(logger.Config{Level: "error", ServiceName: "test"}))
+
+	payment, err := domain.NewPayment("order-1", "user-1", 42.50, "EUR", domain.PaymentGatewayPayPal, "idem-1")
+	require.NoError(t, err)
+	return g, payment
+}
+
+func TestGateway_CaptureAndRefund(t *testing.T) {
+	g, payment := setup(t)
+	ctx := context.Background()
+
+	captureID, _, err := g.ProcessPayment(ctx, payment, "B-token")
+	require.NoError(t, err)
+
+	verified, err := g.VerifyPayment(ctx, captureID)
+	require.NoError(t, err)
+	assert.True(t, verified)
+
+	require.NoError(t, payment.MarkProcessing(captureID))
+	require.NoError(t, payment.MarkCompleted())
+	require.NoError(t, payment.Refund("ref-1", 42.50))
+	refundID, err := g.RefundPayment(ctx, payment, "ref-1", 42.50)
+	require.NoError(t, err)
+	assert.NotEmpty(t, refundID)
+}
+
+func TestGateway_PayerActionReturnsApprovalLink(t *testing.T) {
+	g, payment := setup(t, simulator.Rule{Outcome: simulator.ActionRequired})
+
+	orderID, approveURL, err := g.ProcessPayment(context.Background(), payment, "B-token")
+
+	require.NoError(t, err)
+	assert.NotEmpty(t, orderID)
+	assert.Contains(t, approveURL, orderID)
+}
+
+func TestGateway_Decline(t *testing.T) {
+	g, payment := setup(t, simulator.Rule{Outcome: simulator.Decline})
+
+	_, _, err := g.ProcessPayment(context.Background(), payment, "B-token")
+
+	var gatewayErr *domain.GatewayError
+	require.ErrorAs(t, err, &gatewayErr)
+	assert.Equal(t, domain.GatewayDeclined, gatewayErr.Kind)
+	assert.Equal(t, "INSTRUMENT_DECLINED", gatewayErr.Code)
+}
+
+func TestGateway_SlowResponseIsReplayedOnRetry(t *testing.T) {
+	g, payment := setup(t, simulator.Rule{Outcome: simulator.Slow, Delay: simulator.Duration(time.Second)})
+
+	// The first attempt times out after the order was captured; the retry
+	// carries the same PayPal-Request-Id and gets that capture back
+	captureID, _, err := g.ProcessPayment(context.Background(), payment, "B-token")
+
+	require.NoError(t, err)
+	verified, err := g.VerifyPayment(context.Background(), captureID)
+	require.NoError(t, err)
+	assert.True(t, verified)
+}
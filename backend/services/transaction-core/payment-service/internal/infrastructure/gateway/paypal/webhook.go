@@ -0,0 +1,156 @@
+package paypal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// DefaultTolerance is how old a webhook's transmission may be
+const DefaultTolerance = 5 * time.Minute
+
+// WebhookVerifier has PayPal check the transmission signature of a webhook
+// against the webhook's ID, through the verify-webhook-signature API,
+// rather than fetching and trusting signing certificates here. The
+// transmission time bounds replays to the tolerance.
+type WebhookVerifier struct {
+	client    *gateway.Client
+	webhookID string
+	tolerance time.Duration
+	now       func() time.Time
+}
+
+func NewWebhookVerifier(cfg Config, webhookID string, tolerance time.Duration, logger *logger.Logger) *WebhookVerifier {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	if tolerance == 0 {
+		tolerance = DefaultTolerance
+	}
+	return &WebhookVerifier{
+		client:    newClient(cfg, logger),
+		webhookID: webhookID,
+		tolerance: tolerance,
+		now:       time.Now,
+	}
+}
+
+type event struct {
+	ID         string    `json:"id"`
+	EventType  string    `json:"event_type"`
+	CreateTime time.Time `json:"create_time"`
+	Resource   struct {
+		ID            string `json:"id"`
+		Status        string `json:"status"`
+		CustomID      string `json:"custom_id"`
+		Amount        money  `json:"amount"`
+		StatusDetails struct {
+			Reason string `json:"reason"`
+		} `json:"status_details"`
+		Links []struct {
+			Href string `json:"href"`
+			Rel  string `json:"rel"`
+		} `json:"links"`
+
+		// Of disputes
+		Reason               string `json:"reason"`
+		DisputedTransactions []struct {
+			SellerTransactionID string `json:"seller_transaction_id"`
+		} `json:"disputed_transactions"`
+	} `json:"resource"`
+}
+
+func (v *WebhookVerifier) VerifyWebhook(ctx context.Context, header http.Header, payload []byte) ([]*domain.WebhookEvent, error) {
+	if err := v.verify(ctx, header, payload); err != nil {
+		return nil, err
+	}
+
+	var e event
+	if err := json.Unmarshal(payload, &e); err != nil || e.ID == "" {
+		return nil, errors.New(errors.ErrInvalidInput, "malformed PayPal event")
+	}
+
+	res := e.Resource
+	ev := &domain.WebhookEvent{
+		Gateway:     domain.PaymentGatewayPayPal,
+		EventID:     e.ID,
+		GatewayType: e.EventType,
+		Payload:     payload,
+		OccurredAt:  e.CreateTime,
+	}
+	switch e.EventType {
+	case "PAYMENT.CAPTURE.COMPLETED":
+		ev.Type, ev.PaymentID, ev.GatewayTransactionID = domain.WebhookPaymentSucceeded, res.CustomID, res.ID
+	case "PAYMENT.CAPTURE.DENIED", "PAYMENT.CAPTURE.DECLINED":
+		ev.Type, ev.PaymentID, ev.GatewayTransactionID = domain.WebhookPaymentFailed, res.CustomID, res.ID
+		ev.Reason = res.StatusDetails.Reason
+		if ev.Reason == "" {
+			ev.Reason = res.Status
+		}
+	case "PAYMENT.CAPTURE.REFUNDED":
+		// The resource is the refund; its "up" link is the capture
+		ev.Type, ev.RefundID, ev.RefundReference = domain.WebhookPaymentRefunded, res.ID, res.CustomID
+		for _, link := range res.Links {
+			if link.Rel == "up" {
+				ev.GatewayTransactionID = link.Href[strings.LastIndex(link.Href, "/")+1:]
+			}
+		}
+		amount, err := strconv.ParseFloat(res.Amount.Value, 64)
+		if err != nil {
+			return nil, errors.New(errors.ErrInvalidInput, "malformed PayPal refund amount")
+		}
+		ev.Amount = amount
+	case "CUSTOMER.DISPUTE.CREATED":
+		ev.Type, ev.Reason = domain.WebhookPaymentDisputed, res.Reason
+		if len(res.DisputedTransactions) > 0 {
+			ev.GatewayTransactionID = res.DisputedTransactions[0].SellerTransactionID
+		}
+	}
+	return []*domain.WebhookEvent{ev}, nil
+}
+
+func (v *WebhookVerifier) verify(ctx context.Context, header http.Header, payload []byte) error {
+	transmittedAt, err := time.Parse(time.RFC3339, header.Get("PAYPAL-TRANSMISSION-TIME"))
+	if err != nil || header.Get("PAYPAL-TRANSMISSION-SIG") == "" {
+		return errors.New(errors.ErrUnauthorized, "missing PayPal transmission signature")
+	}
+	if age := v.now().Sub(transmittedAt); age > v.tolerance || age < -v.tolerance {
+		return errors.New(errors.ErrUnauthorized, "PayPal transmission time outside tolerance")
+	}
+	if !json.Valid(payload) {
+		return errors.New(errors.ErrInvalidInput, "malformed PayPal event")
+	}
+
+	var resp struct {
+		VerificationStatus string `json:"verification_status"`
+	}
+	err = v.client.Do(ctx, &gateway.Request{
+		Method: http.MethodPost,
+		Path:   "/v1/notifications/verify-webhook-signature",
+		JSON: map[string]interface{}{
+			"auth_algo":         header.Get("PAYPAL-AUTH-ALGO"),
+			"cert_url":          header.Get("PAYPAL-CERT-URL"),
+			"transmission_id":   header.Get("PAYPAL-TRANSMISSION-ID"),
+			"transmission_sig":  header.Get("PAYPAL-TRANSMISSION-SIG"),
+			"transmission_time": header.Get("PAYPAL-TRANSMISSION-TIME"),
+			"webhook_id":        v.webhookID,
+			"webhook_event":     json.RawMessage(payload),
+		},
+	}, &resp)
+	if err != nil {
+		// PayPal redelivers once we can check it
+		return errors.Wrap(errors.ErrInternal, "failed to verify PayPal webhook", err)
+	}
+	if resp.VerificationStatus != "SUCCESS" {
+		return errors.New(errors.ErrUnauthorized, "invalid PayPal transmission signature")
+	}
+	return nil
+}
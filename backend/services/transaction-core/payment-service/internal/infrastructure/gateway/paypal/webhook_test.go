@@ -0,0 +1,78 @@
+package paypal_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway/paypal"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+const captureEvent = `{"id":"WH-1","event_type":"PAYMENT.CAPTURE.COMPLETED","create_time":"2026-10-18T12:00:00Z",
+	"resource":{"id":"CAP-1","status":"COMPLETED","custom_id":"pay-1","amount":{"currency_code":"EUR","value":"42.50"}}}`
+
+// verifyServer stands in for PayPal: tokens for anyone, and a valid
+// signature for transmissions signed "good" to webhook WH-ID
+func verifyServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token":"token","expires_in":3600}`))
+	})
+	mux.HandleFunc("POST /v1/notifications/verify-webhook-signature", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			TransmissionSig string          `json:"transmission_sig"`
+			WebhookID       string          `json:"webhook_id"`
+			WebhookEvent    json.RawMessage `json:"webhook_event"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		status := "FAILURE"
+		if req.TransmissionSig == "good" && req.WebhookID == "WH-ID" && json.Valid(req.WebhookEvent) {
+			status = "SUCCESS"
+		}
+		json.NewEncoder(w).Encode(map[string]string{"verification_status": status})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func transmission(sig string, at time.Time) http.Header {
+	header := http.Header{}
+	header.Set("PAYPAL-TRANSMISSION-ID", "T-1")
+	header.Set("PAYPAL-TRANSMISSION-SIG", sig)
+	header.Set("PAYPAL-TRANSMISSION-TIME", at.UTC().Format(time.RFC3339))
+	header.Set("PAYPAL-AUTH-ALGO", "SHA256withRSA")
+	header.Set("PAYPAL-CERT-URL", "https://api.paypal.com/v1/notifications/certs/CERT-1")
+	return header
+}
+
+func TestWebhookVerifier(t *testing.T) {
+	srv := verifyServer(t)
+	v := paypal.NewWebhookVerifier(paypal.Config{BaseURL: srv.URL, ClientID: "client", ClientSecret: "secret"}, "WH-ID", 0,
+		logger.New(logger.Config{Level: "error", ServiceName: "test"}))
+	ctx := context.Background()
+
+	events, err := v.VerifyWebhook(ctx, transmission("good", time.Now()), []byte(captureEvent))
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, domain.WebhookPaymentSucceeded, events[0].Type)
+	assert.Equal(t, "pay-1", events[0].PaymentID)
+	assert.Equal(t, "CAP-1", events[0].GatewayTransactionID)
+
+	for name, header := range map[string]http.Header{
+		"forged":   transmission("bad", time.Now()),
+		"replayed": transmission("good", time.Now().Add(-time.Hour)),
+	} {
+		_, err := v.VerifyWebhook(ctx, header, []byte(captureEvent))
+		require.Error(t, err, name)
+		assert.Equal(t, errors.ErrUnauthorized, err.(*errors.AppError).Code, name)
+	}
+}
@@ -0,0 +1,43 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+)
+
+// Signer authenticates a request to a gateway before it is sent; body is
+// the encoded request body
+type Signer interface {
+	Sign(ctx context.Context, req *http.Request, body []byte) error
+}
+
+// SignerFunc lets a function act as a Signer
+type SignerFunc func(ctx context.Context, req *http.Request, body []byte) error
+
+func (f SignerFunc) Sign(ctx context.Context, req *http.Request, body []byte) error {
+	return f(ctx, req, body)
+}
+
+// BearerToken signs with a fixed secret, e.g. a Stripe secret key
+func BearerToken(token string) Signer {
+	return SignerFunc(func(ctx context.Context, req *http.Request, body []byte) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// BasicAuth signs with a client ID and secret, e.g. for an OAuth token
+func BasicAuth(username, password string) Signer {
+	return SignerFunc(func(ctx context.Context, req *http.Request, body []byte) error {
+		req.SetBasicAuth(username, password)
+		return nil
+	})
+}
+
+// APIKey signs with a key in a header of its own, e.g. Adyen's X-API-Key
+func APIKey(header, key string) Signer {
+	return SignerFunc(func(ctx context.Context, req *http.Request, body []byte) error {
+		req.Header.Set(header, key)
+		return nil
+	})
+}
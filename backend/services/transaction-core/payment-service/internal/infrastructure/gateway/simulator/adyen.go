@@ -0,0 +1,126 @@
+package simulator
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const adyen = "adyen"
+
+// Adyen refusal reasons by code, for scripted declines
+var adyenRefusals = map[string]string{
+	"2":  "Refused",
+	"5":  "Blocked Card",
+	"6":  "Expired Card",
+	"12": "Not enough balance",
+	"24": "CVC Declined",
+}
+
+type adyenAmount struct {
+	Value    int64  `json:"value"`
+	Currency string `json:"currency"`
+}
+
+func (s *Server) routeAdyen() {
+	s.mux.HandleFunc("POST /v71/payments", s.adyenAuth(s.adyenPayment))
+	s.mux.HandleFunc("POST /v71/payments/{psp}/refunds", s.adyenAuth(s.adyenRefund))
+}
+
+func adyenError(status int, errorCode, errorType, message string) map[string]interface{} {
+	return map[string]interface{}{"status": status, "errorCode": errorCode, "errorType": errorType, "message": message}
+}
+
+func (s *Server) adyenAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.AdyenAPIKey != "" && r.Header.Get("X-API-Key") != s.cfg.AdyenAPIKey {
+			writeJSON(w, http.StatusUnauthorized, adyenError(http.StatusUnauthorized, "000", "security", "HTTP Status Response - Unauthorized"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) adyenPayment(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Amount        adyenAmount `json:"amount"`
+		Reference     string      `json:"reference"`
+		PaymentMethod struct {
+			StoredPaymentMethodID string `json:"storedPaymentMethodId"`
+		} `json:"paymentMethod"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, adyenError(http.StatusBadRequest, "702", "validation", "Structure of the request is invalid"))
+		return
+	}
+	if req.Amount.Value <= 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, adyenError(http.StatusUnprocessableEntity, "137", "validation", "Invalid amount specified"))
+		return
+	}
+
+	s.idempotent(w, r, adyen, "Idempotency-Key", func() (int, interface{}, time.Duration) {
+		d := s.decide(req.PaymentMethod.StoredPaymentMethodID)
+		switch d.outcome {
+		case Decline:
+			code := or(d.code, "2")
+			return http.StatusOK, map[string]interface{}{
+				"pspReference":      newID("")[:16],
+				"resultCode":        "Refused",
+				"refusalReason":     or(adyenRefusals[code], "Refused"),
+				"refusalReasonCode": code,
+				"merchantReference": req.Reference,
+			}, 0
+		case Unavailable:
+			return http.StatusServiceUnavailable, adyenError(http.StatusServiceUnavailable, "905", "internal", "Service unavailable"), 0
+		case ActionRequired:
+			p := s.take("", adyen, req.Amount.Value, req.Amount.Currency, "RedirectShopper")
+			return http.StatusOK, map[string]interface{}{
+				"pspReference":      p.ID,
+				"resultCode":        p.Status,
+				"merchantReference": req.Reference,
+				"action": map[string]string{
+					"type":   "redirect",
+					"method": "GET",
+					"url":    "https://checkoutshopper-test.adyen.com/checkoutshopper/threeDS/redirect?MD=" + p.ID,
+				},
+			}, 0
+		default:
+			p := s.take("", adyen, req.Amount.Value, req.Amount.Currency, "Authorised")
+			return http.StatusOK, map[string]interface{}{
+				"pspReference":      p.ID,
+				"resultCode":        p.Status,
+				"merchantReference": req.Reference,
+				"amount":            req.Amount,
+			}, d.delay
+		}
+	})
+}
+
+func (s *Server) adyenRefund(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Amount    adyenAmount `json:"amount"`
+		Reference string      `json:"reference"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, adyenError(http.StatusBadRequest, "702", "validation", "Structure of the request is invalid"))
+		return
+	}
+
+	s.idempotent(w, r, adyen, "Idempotency-Key", func() (int, interface{}, time.Duration) {
+		psp := r.PathValue("psp")
+		_, found, refunded := s.refund(adyen, psp, req.Amount.Value)
+		switch {
+		case !found:
+			return http.StatusUnprocessableEntity, adyenError(http.StatusUnprocessableEntity, "167", "validation", "Original pspReference required for this operation"), 0
+		case !refunded:
+			return http.StatusUnprocessableEntity, adyenError(http.StatusUnprocessableEntity, "137", "validation", "Invalid amount specified"), 0
+		}
+		return http.StatusCreated, map[string]interface{}{
+			"pspReference":        newID("")[:16],
+			"paymentPspReference": psp,
+			"reference":           req.Reference,
+			"status":              "received",
+			"amount":              req.Amount,
+		}, 0
+	})
+}
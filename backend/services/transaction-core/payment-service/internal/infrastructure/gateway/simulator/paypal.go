@@ -0,0 +1,166 @@
+package simulator
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway"
+)
+
+const paypal = "paypal"
+
+type paypalMoney struct {
+	CurrencyCode string `json:"currency_code"`
+	Value        string `json:"value"`
+}
+
+func (s *Server) routePayPal() {
+	s.mux.HandleFunc("POST /v1/oauth2/token", s.paypalToken)
+	s.mux.HandleFunc("POST /v2/checkout/orders", s.paypalAuth(s.paypalCreateOrder))
+	s.mux.HandleFunc("GET /v2/payments/captures/{id}", s.paypalAuth(s.paypalGetCapture))
+	s.mux.HandleFunc("POST /v2/payments/captures/{id}/refund", s.paypalAuth(s.paypalRefundCapture))
+}
+
+func paypalError(status int, name, issue, message string) map[string]interface{} {
+	body := map[string]interface{}{"name": name, "message": message}
+	if issue != "" {
+		body["details"] = []map[string]string{{"issue": issue, "description": message}}
+	}
+	return body
+}
+
+func (s *Server) paypalToken(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	if s.cfg.PayPalClientID != "" && (id != s.cfg.PayPalClientID || secret != s.cfg.PayPalClientSecret) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "invalid_client", "error_description": "Client Authentication failed",
+		})
+		return
+	}
+
+	token := newID("A21AA")
+	s.mu.Lock()
+	s.tokens[token] = true
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   32400,
+	})
+}
+
+func (s *Server) paypalAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.mu.Lock()
+		ok := s.tokens[token]
+		s.mu.Unlock()
+		if !ok {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{
+				"error": "invalid_token", "error_description": "Token signature verification failed",
+			})
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) paypalCreateOrder(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PurchaseUnits []struct {
+			ReferenceID string      `json:"reference_id"`
+			Amount      paypalMoney `json:"amount"`
+		} `json:"purchase_units"`
+		PaymentSource struct {
+			Token struct {
+				ID string `json:"id"`
+			} `json:"token"`
+		} `json:"payment_source"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.PurchaseUnits) != 1 {
+		writeJSON(w, http.StatusBadRequest, paypalError(http.StatusBadRequest, "INVALID_REQUEST", "MALFORMED_REQUEST_JSON", "Request is not well-formed"))
+		return
+	}
+	unit := req.PurchaseUnits[0]
+	amount, ok := parseDecimal(unit.Amount.Value, unit.Amount.CurrencyCode)
+	if !ok {
+		writeJSON(w, http.StatusUnprocessableEntity, paypalError(http.StatusUnprocessableEntity, "UNPROCESSABLE_ENTITY", "INVALID_PARAMETER_VALUE", "Invalid amount"))
+		return
+	}
+
+	s.idempotent(w, r, paypal, "PayPal-Request-Id", func() (int, interface{}, time.Duration) {
+		d := s.decide(req.PaymentSource.Token.ID)
+		orderID := newID("")[:17]
+		switch d.outcome {
+		case Decline:
+			return http.StatusUnprocessableEntity, paypalError(http.StatusUnprocessableEntity, "UNPROCESSABLE_ENTITY",
+				or(d.code, "INSTRUMENT_DECLINED"), "The instrument presented was either declined by the processor or bank"), 0
+		case Unavailable:
+			return http.StatusServiceUnavailable, paypalError(http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "", "Service Unavailable"), 0
+		case ActionRequired:
+			return http.StatusOK, map[string]interface{}{
+				"id":     orderID,
+				"status": "PAYER_ACTION_REQUIRED",
+				"links": []map[string]string{{
+					"href": "https://www.sandbox.paypal.com/checkoutnow?token=" + orderID,
+					"rel":  "payer-action",
+				}},
+			}, 0
+		default:
+			p := s.take("", paypal, amount, unit.Amount.CurrencyCode, "COMPLETED")
+			return http.StatusCreated, map[string]interface{}{
+				"id":     orderID,
+				"status": "COMPLETED",
+				"purchase_units": []map[string]interface{}{{
+					"reference_id": unit.ReferenceID,
+					"payments": map[string]interface{}{
+						"captures": []map[string]interface{}{{"id": p.ID, "status": p.Status, "amount": unit.Amount}},
+					},
+				}},
+			}, d.delay
+		}
+	})
+}
+
+func (s *Server) paypalGetCapture(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.find(paypal, r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, paypalError(http.StatusNotFound, "RESOURCE_NOT_FOUND", "INVALID_RESOURCE_ID", "Specified resource ID does not exist"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id": p.ID, "status": p.Status})
+}
+
+func (s *Server) paypalRefundCapture(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Amount paypalMoney `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, paypalError(http.StatusBadRequest, "INVALID_REQUEST", "MALFORMED_REQUEST_JSON", "Request is not well-formed"))
+		return
+	}
+	amount, _ := parseDecimal(req.Amount.Value, req.Amount.CurrencyCode)
+
+	s.idempotent(w, r, paypal, "PayPal-Request-Id", func() (int, interface{}, time.Duration) {
+		_, found, refunded := s.refund(paypal, r.PathValue("id"), amount)
+		switch {
+		case !found:
+			return http.StatusNotFound, paypalError(http.StatusNotFound, "RESOURCE_NOT_FOUND", "INVALID_RESOURCE_ID", "Specified resource ID does not exist"), 0
+		case !refunded:
+			return http.StatusUnprocessableEntity, paypalError(http.StatusUnprocessableEntity, "UNPROCESSABLE_ENTITY",
+				"REFUND_AMOUNT_EXCEEDED", "The refund amount must be less than or equal to the capture amount"), 0
+		}
+		return http.StatusCreated, map[string]interface{}{"id": newID("")[:17], "status": "COMPLETED", "amount": req.Amount}, 0
+	})
+}
+
+// parseDecimal reads a PayPal amount into minor units
+func parseDecimal(value, currency string) (int64, bool) {
+	var amount float64
+	if err := json.Unmarshal([]byte(value), &amount); err != nil || amount <= 0 {
+		return 0, false
+	}
+	return gateway.MinorUnits(amount, currency), true
+}
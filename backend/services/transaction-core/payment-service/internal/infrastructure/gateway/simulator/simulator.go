@@ -0,0 +1,287 @@
+// Package simulator serves enough of the Stripe, PayPal and Adyen APIs for
+// the gateway adapters to run against locally and in tests, with scripted
+// declines, outages, timeouts and slow responses.
+//
+// Payments approve unless a rule of the script matches their payment
+// method. Without a script, a payment method containing the name of an
+// outcome, e.g. pm_card_decline or tok_timeout, has that outcome.
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Outcome is what the simulator does with a payment
+type Outcome string
+
+const (
+	Approve Outcome = "approve"
+	// Decline refuses the payment the way the gateway refuses a card
+	Decline Outcome = "decline"
+	// Unavailable answers 503 without taking the payment
+	Unavailable Outcome = "unavailable"
+	// Timeout takes the payment but holds the response until the client
+	// gives up, so only a retry with the same idempotency key learns of it
+	Timeout Outcome = "timeout"
+	// Slow approves after the rule's delay
+	Slow Outcome = "slow"
+	// ActionRequired leaves the payment waiting for the buyer, e.g. for
+	// 3-D Secure or PayPal approval
+	ActionRequired Outcome = "action_required"
+)
+
+var outcomes = []Outcome{Decline, Unavailable, Timeout, Slow, ActionRequired}
+
+// Rule scripts the outcome of payments
+type Rule struct {
+	PaymentMethod string   `json:"payment_method"` // Matches payments with it; "" matches all
+	Outcome       Outcome  `json:"outcome"`
+	Code          string   `json:"code"`  // Decline reason; the gateway's generic one if empty
+	Delay         Duration `json:"delay"` // Of Slow and Timeout
+	Times         int      `json:"times"` // Matches this many payments, then lapses; 0 for all
+}
+
+// Duration reads as a Go duration string in scripts, e.g. "1.5s"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// LoadScript reads rules from a JSON file holding an array of them
+func LoadScript(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid script %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// Config holds the credentials the simulator accepts; an empty one lets
+// any caller in
+type Config struct {
+	StripeSecretKey    string
+	PayPalClientID     string
+	PayPalClientSecret string
+	AdyenAPIKey        string
+	SlowDelay          time.Duration // Of Slow rules without a delay; defaults to 2s
+	TimeoutDelay       time.Duration // Of Timeout rules without a delay; defaults to 60s
+}
+
+// payment is a payment the simulator took
+type payment struct {
+	ID       string
+	Gateway  string
+	Amount   int64 // Minor units
+	Currency string
+	Refunded int64
+	Status   string
+}
+
+// response is an answer kept for replay under an idempotency key
+type response struct {
+	status int
+	body   []byte
+}
+
+// decision is what a rule made of a payment
+type decision struct {
+	outcome Outcome
+	code    string
+	delay   time.Duration
+}
+
+type Server struct {
+	cfg Config
+	mux *http.ServeMux
+
+	mu       sync.Mutex
+	rules    []*Rule
+	payments map[string]*payment
+	replays  map[string]response // By gateway and idempotency key
+	tokens   map[string]bool     // PayPal access tokens handed out
+}
+
+func New(cfg Config, rules []Rule) *Server {
+	if cfg.SlowDelay == 0 {
+		cfg.SlowDelay = 2 * time.Second
+	}
+	if cfg.TimeoutDelay == 0 {
+		cfg.TimeoutDelay = 60 * time.Second
+	}
+
+	s := &Server{
+		cfg:      cfg,
+		mux:      http.NewServeMux(),
+		payments: make(map[string]*payment),
+		replays:  make(map[string]response),
+		tokens:   make(map[string]bool),
+	}
+	s.Script(rules...)
+	s.routeStripe()
+	s.routePayPal()
+	s.routeAdyen()
+	return s
+}
+
+// Script adds rules, tried in the order added before the ones added later
+func (s *Server) Script(rules ...Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range rules {
+		rule := rules[i]
+		s.rules = append(s.rules, &rule)
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// decide picks the outcome of a payment with the given method
+func (s *Server) decide(paymentMethod string) decision {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rule := range s.rules {
+		if rule.Times < 0 || (rule.PaymentMethod != "" && rule.PaymentMethod != paymentMethod) {
+			continue
+		}
+		if rule.Times > 0 {
+			if rule.Times--; rule.Times == 0 {
+				rule.Times = -1 // Lapsed
+			}
+		}
+		return s.decision(rule.Outcome, rule.Code, time.Duration(rule.Delay))
+	}
+
+	for _, outcome := range outcomes {
+		if strings.Contains(paymentMethod, string(outcome)) {
+			return s.decision(outcome, "", 0)
+		}
+	}
+	return decision{outcome: Approve}
+}
+
+func (s *Server) decision(outcome Outcome, code string, delay time.Duration) decision {
+	if delay == 0 {
+		switch outcome {
+		case Slow:
+			delay = s.cfg.SlowDelay
+		case Timeout:
+			delay = s.cfg.TimeoutDelay
+		}
+	}
+	return decision{outcome: outcome, code: code, delay: delay}
+}
+
+// take records a payment the gateway accepted
+func (s *Server) take(prefix, gateway string, amount int64, currency, status string) *payment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := &payment{
+		ID:       newID(prefix),
+		Gateway:  gateway,
+		Amount:   amount,
+		Currency: currency,
+		Status:   status,
+	}
+	s.payments[p.ID] = p
+	return p
+}
+
+func newID(prefix string) string {
+	return prefix + strings.ReplaceAll(uuid.New().String(), "-", "")[:24]
+}
+
+func (s *Server) find(gateway, id string) (payment, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.payments[id]
+	if !ok || p.Gateway != gateway {
+		return payment{}, false
+	}
+	return *p, true
+}
+
+// refund books a refund of amount against a payment, unless it is more
+// than is left
+func (s *Server) refund(gateway, id string, amount int64) (payment, bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.payments[id]
+	if !ok || p.Gateway != gateway {
+		return payment{}, false, false
+	}
+	if amount <= 0 || p.Refunded+amount > p.Amount {
+		return *p, true, false
+	}
+	p.Refunded += amount
+	return *p, true, true
+}
+
+// idempotent answers a replayed request with the response kept for its
+// key, or runs handle and keeps what it answers. Responses to requests the
+// gateway did not act on, i.e. 5xx, are not kept.
+func (s *Server) idempotent(w http.ResponseWriter, r *http.Request, gateway, header string, handle func() (int, interface{}, time.Duration)) {
+	key := r.Header.Get(header)
+	if key != "" {
+		s.mu.Lock()
+		kept, ok := s.replays[gateway+":"+key]
+		s.mu.Unlock()
+		if ok {
+			w.Header().Set("Idempotent-Replayed", "true")
+			writeRaw(w, kept.status, kept.body)
+			return
+		}
+	}
+
+	status, body, delay := handle()
+	data, _ := json.Marshal(body)
+	if key != "" && status < 500 {
+		s.mu.Lock()
+		s.replays[gateway+":"+key] = response{status: status, body: data}
+		s.mu.Unlock()
+	}
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	writeRaw(w, status, data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	data, _ := json.Marshal(body)
+	writeRaw(w, status, data)
+}
+
+func writeRaw(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,118 @@
+package simulator
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const stripe = "stripe"
+
+func (s *Server) routeStripe() {
+	s.mux.HandleFunc("POST /v1/payment_intents", s.stripeAuth(s.stripeCreateIntent))
+	s.mux.HandleFunc("GET /v1/payment_intents/{id}", s.stripeAuth(s.stripeGetIntent))
+	s.mux.HandleFunc("POST /v1/refunds", s.stripeAuth(s.stripeCreateRefund))
+}
+
+func (s *Server) stripeAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.StripeSecretKey != "" && r.Header.Get("Authorization") != "Bearer "+s.cfg.StripeSecretKey {
+			writeJSON(w, http.StatusUnauthorized, stripeError("invalid_request_error", "", "", "Invalid API Key provided"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+func stripeError(errorType, code, declineCode, message string) map[string]interface{} {
+	e := map[string]string{"type": errorType, "message": message}
+	if code != "" {
+		e["code"] = code
+	}
+	if declineCode != "" {
+		e["decline_code"] = declineCode
+	}
+	return map[string]interface{}{"error": e}
+}
+
+func stripeIntent(p payment, status string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            p.ID,
+		"object":        "payment_intent",
+		"amount":        p.Amount,
+		"currency":      p.Currency,
+		"status":        status,
+		"client_secret": p.ID + "_secret_sim",
+	}
+}
+
+func (s *Server) stripeCreateIntent(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, stripeError("invalid_request_error", "parameter_invalid", "", err.Error()))
+		return
+	}
+	amount, err := strconv.ParseInt(r.PostForm.Get("amount"), 10, 64)
+	if err != nil || amount <= 0 {
+		writeJSON(w, http.StatusBadRequest, stripeError("invalid_request_error", "parameter_invalid_integer", "", "Invalid amount"))
+		return
+	}
+	currency := strings.ToLower(r.PostForm.Get("currency"))
+
+	s.idempotent(w, r, stripe, "Idempotency-Key", func() (int, interface{}, time.Duration) {
+		d := s.decide(r.PostForm.Get("payment_method"))
+		switch d.outcome {
+		case Decline:
+			return http.StatusPaymentRequired, stripeError("card_error", "card_declined", or(d.code, "generic_decline"), "Your card was declined."), 0
+		case Unavailable:
+			return http.StatusServiceUnavailable, stripeError("api_error", "", "", "The Stripe API is temporarily unavailable."), 0
+		case ActionRequired:
+			p := s.take("pi_", stripe, amount, currency, "requires_action")
+			return http.StatusOK, stripeIntent(*p, p.Status), 0
+		default:
+			p := s.take("pi_", stripe, amount, currency, "succeeded")
+			return http.StatusOK, stripeIntent(*p, p.Status), d.delay
+		}
+	})
+}
+
+func (s *Server) stripeGetIntent(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.find(stripe, r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, stripeError("invalid_request_error", "resource_missing", "", "No such payment_intent"))
+		return
+	}
+	writeJSON(w, http.StatusOK, stripeIntent(p, p.Status))
+}
+
+func (s *Server) stripeCreateRefund(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, stripeError("invalid_request_error", "parameter_invalid", "", err.Error()))
+		return
+	}
+	amount, _ := strconv.ParseInt(r.PostForm.Get("amount"), 10, 64)
+
+	s.idempotent(w, r, stripe, "Idempotency-Key", func() (int, interface{}, time.Duration) {
+		p, found, refunded := s.refund(stripe, r.PostForm.Get("payment_intent"), amount)
+		switch {
+		case !found:
+			return http.StatusNotFound, stripeError("invalid_request_error", "resource_missing", "", "No such payment_intent"), 0
+		case !refunded:
+			return http.StatusBadRequest, stripeError("invalid_request_error", "amount_too_large", "", "Refund amount is greater than the unrefunded amount"), 0
+		}
+		return http.StatusOK, map[string]interface{}{
+			"id":             newID("re_"),
+			"object":         "refund",
+			"amount":         amount,
+			"payment_intent": p.ID,
+			"status":         "succeeded",
+		}, 0
+	})
+}
+
+func or(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
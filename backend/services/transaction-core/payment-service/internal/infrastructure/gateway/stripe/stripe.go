@@ -0,0 +1,166 @@
+// Package stripe takes payments through Stripe's PaymentIntents API
+package stripe
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+const DefaultBaseURL = "https://api.stripe.com"
+
+type Config struct {
+	gateway.Options
+	BaseURL   string
+	SecretKey string
+}
+
+// Gateway confirms a PaymentIntent per payment. The payment method is a
+// Stripe PaymentMethod ID; intents that need 3-D Secure come back with
+// their client secret for the frontend to finish.
+type Gateway struct {
+	client *gateway.Client
+	logger *logger.Logger
+}
+
+func New(cfg Config, logger *logger.Logger) *Gateway {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	return &Gateway{
+		client: gateway.NewClient(gateway.Config{
+			Options:     cfg.Options,
+			Gateway:     domain.PaymentGatewayStripe,
+			BaseURL:     cfg.BaseURL,
+			Signer:      gateway.BearerToken(cfg.SecretKey),
+			DecodeError: decodeError,
+		}, logger),
+		logger: logger,
+	}
+}
+
+type paymentIntent struct {
+	ID               string `json:"id"`
+	ClientSecret     string `json:"client_secret"`
+	Status           string `json:"status"`
+	LastPaymentError *struct {
+		Code        string `json:"code"`
+		DeclineCode string `json:"decline_code"`
+		Message     string `json:"message"`
+	} `json:"last_payment_error"`
+}
+
+type refund struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	FailureReason string `json:"failure_reason"`
+}
+
+func (g *Gateway) ProcessPayment(ctx context.Context, payment *domain.Payment, paymentMethodID string) (string, string, error) {
+	form := url.Values{
+		"amount":         {strconv.FormatInt(gateway.MinorUnits(payment.Amount, payment.Currency), 10)},
+		"currency":       {strings.ToLower(payment.Currency)},
+		"payment_method": {paymentMethodID},
+		"confirm":        {"true"},
+		// Off-session card payments; no redirect to come back from
+		"automatic_payment_methods[enabled]":         {"true"},
+		"automatic_payment_methods[allow_redirects]": {"never"},
+		"metadata[payment_id]":                       {payment.ID},
+		"metadata[order_id]":                         {payment.OrderID},
+	}
+
+	var intent paymentIntent
+	err := g.client.Do(ctx, &gateway.Request{
+		Method:         http.MethodPost,
+		Path:           "/v1/payment_intents",
+		IdempotencyKey: payment.IdempotencyKey,
+		Form:           form,
+	}, &intent)
+	if err != nil {
+		return "", "", err
+	}
+
+	if intent.Status == "requires_payment_method" || intent.Status == "canceled" {
+		declined := &domain.GatewayError{Gateway: domain.PaymentGatewayStripe, Kind: domain.GatewayDeclined, Code: intent.Status}
+		if e := intent.LastPaymentError; e != nil {
+			declined.Code, declined.Message = firstOf(e.DeclineCode, e.Code), e.Message
+		}
+		return "", "", declined
+	}
+
+	g.logger.Infof("Stripe payment intent %s: payment=%s, status=%s", intent.ID, payment.ID, intent.Status)
+	return intent.ID, intent.ClientSecret, nil
+}
+
+func (g *Gateway) RefundPayment(ctx context.Context, payment *domain.Payment, refundKey string, amount float64) (string, error) {
+	var r refund
+	err := g.client.Do(ctx, &gateway.Request{
+		Method:         http.MethodPost,
+		Path:           "/v1/refunds",
+		IdempotencyKey: refundKey,
+		Form: url.Values{
+			"payment_intent": {payment.GatewayTransactionID},
+			"amount":         {strconv.FormatInt(gateway.MinorUnits(amount, payment.Currency), 10)},
+			// Tells the refund's webhook apart from refunds issued elsewhere
+			"metadata[refund_key]": {refundKey},
+		},
+	}, &r)
+	if err != nil {
+		return "", err
+	}
+	if r.Status == "failed" || r.Status == "canceled" {
+		return "", &domain.GatewayError{Gateway: domain.PaymentGatewayStripe, Kind: domain.GatewayDeclined,
+			Code: firstOf(r.FailureReason, r.Status), Message: "refund " + r.Status}
+	}
+	return r.ID, nil
+}
+
+func (g *Gateway) VerifyPayment(ctx context.Context, gatewayTransactionID string) (bool, error) {
+	var intent paymentIntent
+	err := g.client.Do(ctx, &gateway.Request{
+		Method: http.MethodGet,
+		Path:   "/v1/payment_intents/" + url.PathEscape(gatewayTransactionID),
+	}, &intent)
+	if err != nil {
+		return false, err
+	}
+	return intent.Status == "succeeded", nil
+}
+
+// decodeError reads Stripe's error object; card errors are declines
+// whatever their status
+func decodeError(status int, body []byte) (domain.GatewayErrorKind, string, string) {
+	var resp struct {
+		Error struct {
+			Type        string `json:"type"`
+			Code        string `json:"code"`
+			DeclineCode string `json:"decline_code"`
+			Message     string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return "", "", ""
+	}
+
+	e := resp.Error
+	if e.Type == "card_error" {
+		return domain.GatewayDeclined, firstOf(e.DeclineCode, e.Code), e.Message
+	}
+	return "", e.Code, e.Message
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+package stripe_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway/simulator"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway/stripe"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+func setup(t *testing.T, rules ...simulator.Rule) (*stripe.Gateway, *domain.Payment) {
+	srv := httptest.NewServer(simulator.New(simulator.Config{StripeSecretKey: "sk_test"}, rules))
+	t.Cleanup(srv.Close)
+
+	g := stripe.New(stripe.Config{
+		Options:   gateway.Options{Timeout: 200 * time.Millisecond, MaxAttempts: 2, Backoff: time.Millisecond},
+		BaseURL:   srv.URL,
+		SecretKey: "sk_test",
+	}, logger.New(logger.Config{Level: "error", ServiceName: "test"}))
+
+	payment, err := domain.NewPayment("order-1", "user-1", 42.50, "USD", domain.PaymentGatewayStripe, "idem-1")
+	require.NoError(t, err)
+	return g, payment
+}
+
+func TestGateway_ApproveAndRefund(t *testing.T) {
+	g, payment := setup(t)
+	ctx := context.Background()
+
+	txnID, clientSecret, err := g.ProcessPayment(ctx, payment, "pm_card_visa")
+	require.NoError(t, err)
+	assert.NotEmpty(t, txnID)
+	assert.NotEmpty(t, clientSecret)
+
+	verified, err := g.VerifyPayment(ctx, txnID)
+	require.NoError(t, err)
+	assert.True(t, verified)
+
+	require.NoError(t, payment.MarkProcessing(txnID))
+	require.NoError(t, payment.MarkCompleted())
+	require.NoError(t, payment.Refund("ref-1", 40))
+	refundID, err := g.RefundPayment(ctx, payment, "ref-1", 40)
+	require.NoError(t, err)
+	assert.NotEmpty(t, refundID)
+
+	// More than is left is turned down
+	require.NoError(t, payment.Refund("ref-2", 2.50))
+	_, err = g.RefundPayment(ctx, payment, "ref-2", 5)
+	assert.Equal(t, domain.GatewayRejected, domain.GatewayErrorKindOf(err))
+}
+
+func TestGateway_Decline(t *testing.T) {
+	g, payment := setup(t, simulator.Rule{PaymentMethod: "pm_card_visa", Outcome: simulator.Decline, Code: "insufficient_funds"})
+
+	_, _, err := g.ProcessPayment(context.Background(), payment, "pm_card_visa")
+
+	var gatewayErr *domain.GatewayError
+	require.ErrorAs(t, err, &gatewayErr)
+	assert.Equal(t, domain.GatewayDeclined, gatewayErr.Kind)
+	assert.Equal(t, "insufficient_funds", gatewayErr.Code)
+}
+
+func TestGateway_RetriesAfterOutage(t *testing.T) {
+	g, payment := setup(t, simulator.Rule{Outcome: simulator.Unavailable, Times: 1})
+
+	txnID, _, err := g.ProcessPayment(context.Background(), payment, "pm_card_visa")
+
+	require.NoError(t, err)
+	assert.NotEmpty(t, txnID)
+}
+
+func TestGateway_TimeoutReplaysTakenPayment(t *testing.T) {
+	g, payment := setup(t, simulator.Rule{Outcome: simulator.Timeout, Delay: simulator.Duration(5 * time.Second)})
+	ctx := context.Background()
+
+	// The retry with the same key learns of the payment the timed out
+	// attempt took, instead of taking it again
+	txnID, _, err := g.ProcessPayment(ctx, payment, "pm_card_visa")
+	require.NoError(t, err)
+
+	again, _, err := g.ProcessPayment(ctx, payment, "pm_card_visa")
+	require.NoError(t, err)
+	assert.Equal(t, txnID, again)
+}
+
+func TestGateway_BadKeyIsRejected(t *testing.T) {
+	_, payment := setup(t)
+	srv := httptest.NewServer(simulator.New(simulator.Config{StripeSecretKey: "sk_test"}, nil))
+	defer srv.Close()
+	g := stripe.New(stripe.Config{BaseURL: srv.URL, SecretKey: "sk_wrong"},
+		logger.New(logger.Config{Level: "error", ServiceName: "test"}))
+
+	_, _, err := g.ProcessPayment(context.Background(), payment, "pm_card_visa")
+
+	assert.Equal(t, domain.GatewayRejected, domain.GatewayErrorKindOf(err))
+}
@@ -0,0 +1,140 @@
+package stripe
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// DefaultTolerance is how old a signed webhook may be, as Stripe's own
+// libraries default to
+const DefaultTolerance = 5 * time.Minute
+
+// WebhookVerifier checks the Stripe-Signature header: an HMAC-SHA256 of the
+// timestamp and payload under the endpoint's signing secret. The signed
+// timestamp bounds replays to the tolerance.
+type WebhookVerifier struct {
+	secret    string
+	tolerance time.Duration
+	now       func() time.Time
+}
+
+func NewWebhookVerifier(secret string, tolerance time.Duration) *WebhookVerifier {
+	if tolerance == 0 {
+		tolerance = DefaultTolerance
+	}
+	return &WebhookVerifier{secret: secret, tolerance: tolerance, now: time.Now}
+}
+
+type event struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+	Data    struct {
+		Object struct {
+			ID            string            `json:"id"`
+			Amount        int64             `json:"amount"`
+			Currency      string            `json:"currency"`
+			Status        string            `json:"status"`
+			Reason        string            `json:"reason"`
+			PaymentIntent string            `json:"payment_intent"`
+			Metadata      map[string]string `json:"metadata"`
+
+			LastPaymentError *struct {
+				Code        string `json:"code"`
+				DeclineCode string `json:"decline_code"`
+			} `json:"last_payment_error"`
+		} `json:"object"`
+	} `json:"data"`
+}
+
+func (v *WebhookVerifier) VerifyWebhook(ctx context.Context, header http.Header, payload []byte) ([]*domain.WebhookEvent, error) {
+	if err := v.verify(header.Get("Stripe-Signature"), payload); err != nil {
+		return nil, err
+	}
+
+	var e event
+	if err := json.Unmarshal(payload, &e); err != nil || e.ID == "" {
+		return nil, errors.New(errors.ErrInvalidInput, "malformed Stripe event")
+	}
+
+	obj := e.Data.Object
+	ev := &domain.WebhookEvent{
+		Gateway:     domain.PaymentGatewayStripe,
+		EventID:     e.ID,
+		GatewayType: e.Type,
+		Payload:     payload,
+		OccurredAt:  time.Unix(e.Created, 0),
+	}
+	switch e.Type {
+	case "payment_intent.succeeded":
+		ev.Type, ev.PaymentID, ev.GatewayTransactionID = domain.WebhookPaymentSucceeded, obj.Metadata["payment_id"], obj.ID
+	case "payment_intent.payment_failed", "payment_intent.canceled":
+		ev.Type, ev.PaymentID, ev.GatewayTransactionID = domain.WebhookPaymentFailed, obj.Metadata["payment_id"], obj.ID
+		ev.Reason = obj.Status
+		if pe := obj.LastPaymentError; pe != nil {
+			ev.Reason = firstOf(pe.DeclineCode, pe.Code)
+		}
+	case "refund.created", "refund.updated":
+		// Pending refunds follow as refund.updated
+		if obj.Status == "succeeded" {
+			ev.Type, ev.GatewayTransactionID = domain.WebhookPaymentRefunded, obj.PaymentIntent
+			ev.RefundID, ev.RefundReference = obj.ID, obj.Metadata["refund_key"]
+			ev.Amount = gateway.FromMinorUnits(obj.Amount, obj.Currency)
+		}
+	case "charge.dispute.created":
+		ev.Type, ev.GatewayTransactionID, ev.Reason = domain.WebhookPaymentDisputed, obj.PaymentIntent, obj.Reason
+	}
+	return []*domain.WebhookEvent{ev}, nil
+}
+
+// verify checks a header of the form t=<unix>,v1=<hex>[,v1=<hex>...];
+// several v1 signatures are sent while the secret is being rolled
+func (v *WebhookVerifier) verify(header string, payload []byte) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return errors.New(errors.ErrUnauthorized, "missing Stripe signature")
+	}
+
+	if age := v.now().Sub(time.Unix(signedAt, 0)); age > v.tolerance || age < -v.tolerance {
+		return errors.New(errors.ErrUnauthorized, "Stripe signature timestamp outside tolerance")
+	}
+
+	expected := Sign(v.secret, signedAt, payload)
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+	return errors.New(errors.ErrUnauthorized, "invalid Stripe signature")
+}
+
+// Sign computes the v1 signature of a payload signed at the given time
+func Sign(secret string, signedAt int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(signedAt, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,57 @@
+package stripe_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/payment-service/internal/infrastructure/gateway/stripe"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+const refundEvent = `{"id":"evt_1","type":"refund.created","created":1700000000,"data":{"object":{
+	"id":"re_1","object":"refund","amount":1250,"currency":"usd","status":"succeeded",
+	"payment_intent":"pi_1","metadata":{"refund_key":"pay-1-refund-4"}}}}`
+
+func signed(secret string, at time.Time, payload string) http.Header {
+	header := http.Header{}
+	header.Set("Stripe-Signature", fmt.Sprintf("t=%d,v1=%s", at.Unix(), stripe.Sign(secret, at.Unix(), []byte(payload))))
+	return header
+}
+
+func TestWebhookVerifier_ReadsSignedEvent(t *testing.T) {
+	v := stripe.NewWebhookVerifier("whsec_test", 0)
+
+	events, err := v.VerifyWebhook(context.Background(), signed("whsec_test", time.Now(), refundEvent), []byte(refundEvent))
+
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	e := events[0]
+	assert.Equal(t, "evt_1", e.EventID)
+	assert.Equal(t, domain.WebhookPaymentRefunded, e.Type)
+	assert.Equal(t, "pi_1", e.GatewayTransactionID)
+	assert.Equal(t, "re_1", e.RefundID)
+	assert.Equal(t, "pay-1-refund-4", e.RefundReference)
+	assert.Equal(t, 12.50, e.Amount)
+	assert.Equal(t, refundEvent, string(e.Payload))
+}
+
+func TestWebhookVerifier_RejectsForgedAndReplayed(t *testing.T) {
+	v := stripe.NewWebhookVerifier("whsec_test", 5*time.Minute)
+	cases := map[string]http.Header{
+		"wrong secret": signed("whsec_other", time.Now(), refundEvent),
+		"tampered":     signed("whsec_test", time.Now(), refundEvent+" "),
+		"replayed":     signed("whsec_test", time.Now().Add(-time.Hour), refundEvent),
+		"unsigned":     {},
+	}
+	for name, header := range cases {
+		_, err := v.VerifyWebhook(context.Background(), header, []byte(refundEvent))
+		require.Error(t, err, name)
+		assert.Equal(t, errors.ErrUnauthorized, err.(*errors.AppError).Code, name)
+	}
+}
@@ -3,12 +3,14 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"time"
 
 	"github.com/titan-commerce/backend/payment-service/internal/domain"
 	"github.com/titan-commerce/backend/pkg/errors"
 	"github.com/titan-commerce/backend/pkg/logger"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type PaymentRepository struct {
@@ -38,14 +40,14 @@ func (r *PaymentRepository) Save(ctx context.Context, payment *domain.Payment) e
 	query := `
 		INSERT INTO payments (
 			id, order_id, user_id, amount, currency, gateway, status,
-			gateway_transaction_id, idempotency_key, created_at, updated_at, version
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			gateway_transaction_id, idempotency_key, refunded_amount, refunds, refund_ids, created_at, updated_at, version
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 	`
 
 	_, err := r.db.ExecContext(ctx, query,
 		payment.ID, payment.OrderID, payment.UserID, payment.Amount, payment.Currency,
 		payment.Gateway, payment.Status, payment.GatewayTransactionID, payment.IdempotencyKey,
-		payment.CreatedAt, payment.UpdatedAt, payment.Version,
+		payment.RefundedAmount, pq.Array(payment.Refunds), refundIDs(payment.RefundIDs), payment.CreatedAt, payment.UpdatedAt, payment.Version,
 	)
 
 	if err != nil {
@@ -58,7 +60,7 @@ func (r *PaymentRepository) Save(ctx context.Context, payment *domain.Payment) e
 func (r *PaymentRepository) FindByID(ctx context.Context, paymentID string) (*domain.Payment, error) {
 	query := `
 		SELECT id, order_id, user_id, amount, currency, gateway, status,
-			   gateway_transaction_id, idempotency_key, created_at, updated_at, version
+			   gateway_transaction_id, idempotency_key, refunded_amount, refunds, refund_ids, created_at, updated_at, version
 		FROM payments WHERE id = $1
 	`
 
@@ -66,7 +68,7 @@ func (r *PaymentRepository) FindByID(ctx context.Context, paymentID string) (*do
 	err := r.db.QueryRowContext(ctx, query, paymentID).Scan(
 		&payment.ID, &payment.OrderID, &payment.UserID, &payment.Amount, &payment.Currency,
 		&payment.Gateway, &payment.Status, &payment.GatewayTransactionID, &payment.IdempotencyKey,
-		&payment.CreatedAt, &payment.UpdatedAt, &payment.Version,
+		&payment.RefundedAmount, pq.Array(&payment.Refunds), (*refundIDs)(&payment.RefundIDs), &payment.CreatedAt, &payment.UpdatedAt, &payment.Version,
 	)
 
 	if err == sql.ErrNoRows {
@@ -82,7 +84,7 @@ func (r *PaymentRepository) FindByID(ctx context.Context, paymentID string) (*do
 func (r *PaymentRepository) FindByIdempotencyKey(ctx context.Context, idempotencyKey string) (*domain.Payment, error) {
 	query := `
 		SELECT id, order_id, user_id, amount, currency, gateway, status,
-			   gateway_transaction_id, idempotency_key, created_at, updated_at, version
+			   gateway_transaction_id, idempotency_key, refunded_amount, refunds, refund_ids, created_at, updated_at, version
 		FROM payments WHERE idempotency_key = $1
 	`
 
@@ -90,7 +92,7 @@ func (r *PaymentRepository) FindByIdempotencyKey(ctx context.Context, idempotenc
 	err := r.db.QueryRowContext(ctx, query, idempotencyKey).Scan(
 		&payment.ID, &payment.OrderID, &payment.UserID, &payment.Amount, &payment.Currency,
 		&payment.Gateway, &payment.Status, &payment.GatewayTransactionID, &payment.IdempotencyKey,
-		&payment.CreatedAt, &payment.UpdatedAt, &payment.Version,
+		&payment.RefundedAmount, pq.Array(&payment.Refunds), (*refundIDs)(&payment.RefundIDs), &payment.CreatedAt, &payment.UpdatedAt, &payment.Version,
 	)
 
 	if err == sql.ErrNoRows {
@@ -106,7 +108,7 @@ func (r *PaymentRepository) FindByIdempotencyKey(ctx context.Context, idempotenc
 func (r *PaymentRepository) FindByOrderID(ctx context.Context, orderID string) (*domain.Payment, error) {
 	query := `
 		SELECT id, order_id, user_id, amount, currency, gateway, status,
-			   gateway_transaction_id, idempotency_key, created_at, updated_at, version
+			   gateway_transaction_id, idempotency_key, refunded_amount, refunds, refund_ids, created_at, updated_at, version
 		FROM payments WHERE order_id = $1
 	`
 
@@ -114,7 +116,31 @@ func (r *PaymentRepository) FindByOrderID(ctx context.Context, orderID string) (
 	err := r.db.QueryRowContext(ctx, query, orderID).Scan(
 		&payment.ID, &payment.OrderID, &payment.UserID, &payment.Amount, &payment.Currency,
 		&payment.Gateway, &payment.Status, &payment.GatewayTransactionID, &payment.IdempotencyKey,
-		&payment.CreatedAt, &payment.UpdatedAt, &payment.Version,
+		&payment.RefundedAmount, pq.Array(&payment.Refunds), (*refundIDs)(&payment.RefundIDs), &payment.CreatedAt, &payment.UpdatedAt, &payment.Version,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, errors.New(errors.ErrNotFound, "payment not found")
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to find payment", err)
+	}
+
+	return &payment, nil
+}
+
+func (r *PaymentRepository) FindByGatewayTransactionID(ctx context.Context, gateway domain.PaymentGateway, gatewayTransactionID string) (*domain.Payment, error) {
+	query := `
+		SELECT id, order_id, user_id, amount, currency, gateway, status,
+			   gateway_transaction_id, idempotency_key, refunded_amount, refunds, refund_ids, created_at, updated_at, version
+		FROM payments WHERE gateway = $1 AND gateway_transaction_id = $2
+	`
+
+	var payment domain.Payment
+	err := r.db.QueryRowContext(ctx, query, gateway, gatewayTransactionID).Scan(
+		&payment.ID, &payment.OrderID, &payment.UserID, &payment.Amount, &payment.Currency,
+		&payment.Gateway, &payment.Status, &payment.GatewayTransactionID, &payment.IdempotencyKey,
+		&payment.RefundedAmount, pq.Array(&payment.Refunds), (*refundIDs)(&payment.RefundIDs), &payment.CreatedAt, &payment.UpdatedAt, &payment.Version,
 	)
 
 	if err == sql.ErrNoRows {
@@ -130,12 +156,13 @@ func (r *PaymentRepository) FindByOrderID(ctx context.Context, orderID string) (
 func (r *PaymentRepository) Update(ctx context.Context, payment *domain.Payment) error {
 	query := `
 		UPDATE payments
-		SET status = $1, gateway_transaction_id = $2, updated_at = $3, version = $4
-		WHERE id = $5 AND version = $6
+		SET status = $1, gateway_transaction_id = $2, refunded_amount = $3, refunds = $4, refund_ids = $5,
+			updated_at = $6, version = $7
+		WHERE id = $8 AND version = $9
 	`
 
 	result, err := r.db.ExecContext(ctx, query,
-		payment.Status, payment.GatewayTransactionID, payment.UpdatedAt,
+		payment.Status, payment.GatewayTransactionID, payment.RefundedAmount, pq.Array(payment.Refunds), refundIDs(payment.RefundIDs), payment.UpdatedAt,
 		payment.Version, payment.ID, payment.Version-1,
 	)
 
@@ -158,3 +185,21 @@ func (r *PaymentRepository) Update(ctx context.Context, payment *domain.Payment)
 func (r *PaymentRepository) Close() error {
 	return r.db.Close()
 }
+
+// refundIDs stores a payment's gateway refund IDs by refund key as JSONB
+type refundIDs map[string]string
+
+func (r refundIDs) Value() (driver.Value, error) {
+	if r == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(map[string]string(r))
+}
+
+func (r *refundIDs) Scan(src interface{}) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return errors.New(errors.ErrInternal, "refund IDs are not JSON")
+	}
+	return json.Unmarshal(b, (*map[string]string)(r))
+}
@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// WebhookEventRepository archives webhook events in webhook_events, raw
+// payload included
+type WebhookEventRepository struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
+
+func NewWebhookEventRepository(databaseURL string, logger *logger.Logger) (*WebhookEventRepository, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to connect to database", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to ping database", err)
+	}
+
+	return &WebhookEventRepository{db: db, logger: logger}, nil
+}
+
+func (r *WebhookEventRepository) Archive(ctx context.Context, event *domain.WebhookEvent) (bool, error) {
+	query := `
+		INSERT INTO webhook_events (
+			id, gateway, event_id, gateway_type, type, payment_id, gateway_transaction_id,
+			payload, status, error, occurred_at, received_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (gateway, event_id) DO NOTHING
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		event.ID, event.Gateway, event.EventID, event.GatewayType, event.Type, event.PaymentID,
+		event.GatewayTransactionID, event.Payload, event.Status, event.Error, nullTime(event.OccurredAt), event.ReceivedAt,
+	)
+	if err != nil {
+		return false, errors.Wrap(errors.ErrInternal, "failed to archive webhook event", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(errors.ErrInternal, "failed to get rows affected", err)
+	}
+	return rows == 1, nil
+}
+
+func (r *WebhookEventRepository) FindByEventID(ctx context.Context, gateway domain.PaymentGateway, eventID string) (*domain.WebhookEvent, error) {
+	query := `
+		SELECT id, gateway, event_id, gateway_type, type, payment_id, gateway_transaction_id,
+			   payload, status, error, occurred_at, received_at, processed_at
+		FROM webhook_events WHERE gateway = $1 AND event_id = $2
+	`
+
+	var event domain.WebhookEvent
+	var occurredAt, processedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, gateway, eventID).Scan(
+		&event.ID, &event.Gateway, &event.EventID, &event.GatewayType, &event.Type, &event.PaymentID,
+		&event.GatewayTransactionID, &event.Payload, &event.Status, &event.Error,
+		&occurredAt, &event.ReceivedAt, &processedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errors.New(errors.ErrNotFound, "webhook event not found")
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to find webhook event", err)
+	}
+
+	event.OccurredAt = occurredAt.Time
+	if processedAt.Valid {
+		event.ProcessedAt = &processedAt.Time
+	}
+	return &event, nil
+}
+
+func (r *WebhookEventRepository) Update(ctx context.Context, event *domain.WebhookEvent) error {
+	query := `
+		UPDATE webhook_events
+		SET payment_id = $1, status = $2, error = $3, processed_at = $4
+		WHERE id = $5
+	`
+
+	_, err := r.db.ExecContext(ctx, query, event.PaymentID, event.Status, event.Error, event.ProcessedAt, event.ID)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to update webhook event", err)
+	}
+	return nil
+}
+
+func (r *WebhookEventRepository) Close() error {
+	return r.db.Close()
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,59 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+const (
+	// PaymentEventsStream is read by order-service with a consumer group
+	PaymentEventsStream = "payment_events"
+	paymentEventsMaxLen = 100000
+)
+
+// RedisPaymentEventPublisher appends payment events to a Redis stream
+type RedisPaymentEventPublisher struct {
+	client *redis.Client
+}
+
+func NewRedisPaymentEventPublisher(addr, password string) (*RedisPaymentEventPublisher, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to connect to Redis", err)
+	}
+
+	return &RedisPaymentEventPublisher{client: client}, nil
+}
+
+func (p *RedisPaymentEventPublisher) Publish(ctx context.Context, event *domain.PaymentEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to marshal payment event", err)
+	}
+
+	err = p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: PaymentEventsStream,
+		MaxLen: paymentEventsMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"type":     string(event.Type),
+			"order_id": event.OrderID,
+			"event":    data,
+		},
+	}).Err()
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to publish payment event", err)
+	}
+	return nil
+}
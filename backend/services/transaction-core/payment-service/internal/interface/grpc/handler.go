@@ -61,8 +61,19 @@ func (s *PaymentServiceServer) GetPayment(ctx context.Context, req *pb.GetPaymen
 	}, nil
 }
 
+func (s *PaymentServiceServer) GetPaymentByOrder(ctx context.Context, req *pb.GetPaymentByOrderRequest) (*pb.GetPaymentByOrderResponse, error) {
+	payment, err := s.service.GetPaymentByOrder(ctx, req.OrderId)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	return &pb.GetPaymentByOrderResponse{
+		Payment: domainToProto(payment),
+	}, nil
+}
+
 func (s *PaymentServiceServer) RefundPayment(ctx context.Context, req *pb.RefundPaymentRequest) (*pb.RefundPaymentResponse, error) {
-	refundID, err := s.service.RefundPayment(ctx, req.PaymentId, req.Amount, req.Reason)
+	refundID, err := s.service.RefundPayment(ctx, req.PaymentId, req.Amount, req.Reason, req.IdempotencyKey)
 	if err != nil {
 		s.logger.Error(err, "failed to refund payment")
 		return nil, status.Error(codes.Internal, err.Error())
@@ -84,5 +95,6 @@ func domainToProto(payment *domain.Payment) *pb.Payment {
 		Gateway:              string(payment.Gateway),
 		Status:               string(payment.Status),
 		GatewayTransactionId: payment.GatewayTransactionID,
+		RefundedAmount:       payment.RefundedAmount,
 	}
 }
@@ -0,0 +1,65 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/titan-commerce/backend/payment-service/internal/application"
+	"github.com/titan-commerce/backend/payment-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+)
+
+// maxPayload bounds what is read of a webhook request
+const maxPayload = 1 << 20
+
+// WebhookHandler receives gateway webhooks at POST /webhooks/{gateway},
+// e.g. /webhooks/stripe. A 2xx tells the gateway the event landed; anything
+// else has it deliver the event again later.
+type WebhookHandler struct {
+	service *application.WebhookService
+	logger  *logger.Logger
+	mux     *http.ServeMux
+}
+
+func NewWebhookHandler(service *application.WebhookService, logger *logger.Logger) *WebhookHandler {
+	h := &WebhookHandler{service: service, logger: logger, mux: http.NewServeMux()}
+	h.mux.HandleFunc("POST /webhooks/{gateway}", h.handleWebhook)
+	return h
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *WebhookHandler) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	gateway := domain.PaymentGateway(strings.ToUpper(r.PathValue("gateway")))
+
+	// Signatures cover the payload byte for byte, so it is kept as read
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxPayload+1))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if len(payload) > maxPayload {
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if err := h.service.HandleWebhook(r.Context(), gateway, r.Header, payload); err != nil {
+		status := http.StatusInternalServerError
+		if appErr, ok := err.(*errors.AppError); ok {
+			status = appErr.HTTPStatus
+		}
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	// Adyen wants its notifications acknowledged in so many words
+	if gateway == domain.PaymentGatewayAdyen {
+		w.Write([]byte("[accepted]"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
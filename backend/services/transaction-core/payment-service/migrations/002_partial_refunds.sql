@@ -0,0 +1,6 @@
+-- Partial refunds: a payment tracks how much of it has been given back
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS refunded_amount DECIMAL(10, 2) NOT NULL DEFAULT 0;
+
+-- Payments refunded before this migration were always refunded in full
+UPDATE payments SET refunded_amount = amount WHERE status = 'REFUNDED';
@@ -0,0 +1,28 @@
+-- Webhooks: events gateways push about payments, archived as received
+
+-- References of recorded refunds, so a gateway's confirmation of a refund
+-- we issued is not counted again
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS refunds TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_payments_gateway_transaction_id ON payments(gateway, gateway_transaction_id);
+
+CREATE TABLE IF NOT EXISTS webhook_events (
+    id VARCHAR(36) PRIMARY KEY,
+    gateway VARCHAR(50) NOT NULL,
+    event_id VARCHAR(255) NOT NULL,
+    gateway_type VARCHAR(100) NOT NULL,
+    type VARCHAR(30) NOT NULL DEFAULT '',
+    payment_id VARCHAR(36) NOT NULL DEFAULT '',
+    gateway_transaction_id VARCHAR(255) NOT NULL DEFAULT '',
+    payload BYTEA NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    occurred_at TIMESTAMP,
+    received_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    processed_at TIMESTAMP,
+    -- Deduplicates redeliveries and replays
+    UNIQUE (gateway, event_id)
+);
+
+CREATE INDEX idx_webhook_events_payment_id ON webhook_events(payment_id);
+CREATE INDEX idx_webhook_events_received_at ON webhook_events(received_at DESC);
@@ -0,0 +1,4 @@
+-- Refund IDs: the gateway's ID of each refund we issued, by our refund key, so
+-- a caller retrying a refund gets back the one already made
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS refund_ids JSONB NOT NULL DEFAULT '{}';
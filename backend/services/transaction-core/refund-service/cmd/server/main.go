@@ -8,6 +8,7 @@ import (
 	"syscall"
 
 	"github.com/titan-commerce/backend/refund-service/internal/application"
+	"github.com/titan-commerce/backend/refund-service/internal/infrastructure/clients"
 	"github.com/titan-commerce/backend/refund-service/internal/infrastructure/postgres"
 	handler "github.com/titan-commerce/backend/refund-service/internal/interface/grpc"
 	pb "github.com/titan-commerce/backend/refund-service/proto/refund/v1"
@@ -38,8 +39,20 @@ func main() {
 		log.Fatal(err, "Failed to initialize refund repository")
 	}
 
-	// Initialize application service (no gateway for now, handled internally)
-	refundService := application.NewRefundService(refundRepo, nil, log)
+	// Refunds are issued through payment-service, which also finds the
+	// payment of an order being refunded
+	paymentAddr := os.Getenv("PAYMENT_SERVICE_ADDR")
+	if paymentAddr == "" {
+		paymentAddr = "payment-service:9000"
+	}
+	payments, err := clients.NewPaymentClient(paymentAddr)
+	if err != nil {
+		log.Fatal(err, "Failed to initialize payment-service client")
+	}
+	defer payments.Close()
+
+	// Initialize application service
+	refundService := application.NewRefundService(refundRepo, payments, payments, log)
 
 	// Initialize gRPC server
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
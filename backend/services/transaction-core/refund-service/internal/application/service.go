@@ -2,65 +2,158 @@ package application
 
 import (
 	"context"
+	"math"
 
 	"github.com/titan-commerce/backend/refund-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
 	"github.com/titan-commerce/backend/pkg/logger"
 )
 
 type RefundRepository interface {
 	Save(ctx context.Context, refund *domain.Refund) error
 	FindByID(ctx context.Context, refundID string) (*domain.Refund, error)
+	FindByReturnID(ctx context.Context, returnID string) (*domain.Refund, error) // nil if the return has no refund yet
+	FindByIdempotencyKey(ctx context.Context, key string) (*domain.Refund, error) // nil if no refund was made under key
 	Update(ctx context.Context, refund *domain.Refund) error
 }
 
 type PaymentGateway interface {
-	ProcessRefund(ctx context.Context, paymentID string, amount float64) (string, error)
+	// ProcessRefund refunds amount of the payment under refundID, so a retry
+	// of a refund that went through returns it instead of refunding again
+	ProcessRefund(ctx context.Context, refundID, paymentID string, amount float64) (string, error)
+}
+
+// PaymentLookup finds the captured payment for an order
+type PaymentLookup interface {
+	FindPaymentByOrder(ctx context.Context, orderID string) (*OrderPayment, error)
+}
+
+// OrderPayment is the payment an order was paid with
+type OrderPayment struct {
+	PaymentID      string
+	Amount         float64
+	RefundedAmount float64
+}
+
+// Refundable is what is left of the payment to refund
+func (p *OrderPayment) Refundable() float64 {
+	return p.Amount - p.RefundedAmount
 }
 
 type RefundService struct {
-	repo    RefundRepository
-	gateway PaymentGateway
-	logger  *logger.Logger
+	repo     RefundRepository
+	gateway  PaymentGateway
+	payments PaymentLookup
+	logger   *logger.Logger
 }
 
-func NewRefundService(repo RefundRepository, gateway PaymentGateway, logger *logger.Logger) *RefundService {
+func NewRefundService(repo RefundRepository, gateway PaymentGateway, payments PaymentLookup, logger *logger.Logger) *RefundService {
 	return &RefundService{
-		repo:    repo,
-		gateway: gateway,
-		logger:  logger,
+		repo:     repo,
+		gateway:  gateway,
+		payments: payments,
+		logger:   logger,
+	}
+}
+
+// ProcessRefund initiates a refund (Command). With an idempotency key it
+// refunds once per key: a repeated call returns the existing refund, and
+// retries it if it failed. Reusing a key for another payment or amount is a
+// conflict.
+func (s *RefundService) ProcessRefund(ctx context.Context, idempotencyKey, paymentID, orderID string, amount float64, reason string) (*domain.Refund, error) {
+	var refund *domain.Refund
+	if idempotencyKey != "" {
+		existing, err := s.repo.FindByIdempotencyKey(ctx, idempotencyKey)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			if existing.PaymentID != paymentID || math.Round(existing.Amount*100) != math.Round(amount*100) {
+				return nil, errors.New(errors.ErrConflict, "idempotency key was used for another refund")
+			}
+			if existing.Status != domain.RefundStatusFailed {
+				return existing, nil
+			}
+			refund = existing
+		}
+	}
+
+	if refund == nil {
+		var err error
+		refund, err = domain.NewRefund(paymentID, orderID, amount, reason)
+		if err != nil {
+			return nil, err
+		}
+		refund.IdempotencyKey = idempotencyKey
+
+		if err := s.repo.Save(ctx, refund); err != nil {
+			s.logger.Error(err, "failed to save refund")
+			return nil, err
+		}
 	}
+
+	if err := s.settle(ctx, refund); err != nil {
+		return refund, err
+	}
+
+	s.logger.Infof("Refund processed: refund=%s, payment=%s, amount=%.2f", refund.ID, paymentID, amount)
+	return refund, nil
 }
 
-// ProcessRefund initiates a refund (Command)
-func (s *RefundService) ProcessRefund(ctx context.Context, paymentID, orderID string, amount float64, reason string) (*domain.Refund, error) {
-	refund, err := domain.NewRefund(paymentID, orderID, amount, reason)
+// ProcessReturnRefund refunds the lines of an item return against the order's
+// payment (Command). It is idempotent per return: a repeated call returns the
+// existing refund, and retries it if it failed.
+func (s *RefundService) ProcessReturnRefund(ctx context.Context, orderID, returnID string, lines []domain.RefundLine, reason string) (*domain.Refund, error) {
+	refund, err := s.repo.FindByReturnID(ctx, returnID)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := s.repo.Save(ctx, refund); err != nil {
-		s.logger.Error(err, "failed to save refund")
-		return nil, err
+	if refund == nil {
+		payment, err := s.payments.FindPaymentByOrder(ctx, orderID)
+		if err != nil {
+			return nil, err
+		}
+
+		refund, err = domain.NewReturnRefund(payment.PaymentID, orderID, returnID, lines, reason)
+		if err != nil {
+			return nil, err
+		}
+		// Compare in cents so float rounding can't block refunding the remainder
+		if math.Round(refund.Amount*100) > math.Round(payment.Refundable()*100) {
+			return nil, errors.New(errors.ErrInvalidInput, "refund amount exceeds the refundable amount")
+		}
+		if err := s.repo.Save(ctx, refund); err != nil {
+			s.logger.Error(err, "failed to save refund")
+			return nil, err
+		}
+	} else if refund.Status != domain.RefundStatusFailed {
+		return refund, nil
 	}
 
-	// Process refund via payment gateway
-	gatewayRefundID, err := s.gateway.ProcessRefund(ctx, paymentID, amount)
+	if err := s.settle(ctx, refund); err != nil {
+		return refund, err
+	}
+
+	s.logger.Infof("Return refund processed: refund=%s, return=%s, order=%s, amount=%.2f",
+		refund.ID, returnID, orderID, refund.Amount)
+	return refund, nil
+}
+
+// settle sends a saved refund to the payment gateway and records the outcome
+func (s *RefundService) settle(ctx context.Context, refund *domain.Refund) error {
+	gatewayRefundID, err := s.gateway.ProcessRefund(ctx, refund.ID, refund.PaymentID, refund.Amount)
 	if err != nil {
 		refund.Fail()
 		s.repo.Update(ctx, refund)
 		s.logger.Error(err, "gateway refund failed")
-		return refund, err
+		return err
 	}
 
 	refund.Process(gatewayRefundID)
 	refund.Complete()
 
-	if err := s.repo.Update(ctx, refund); err != nil {
-		return refund, err
-	}
-
-	s.logger.Infof("Refund processed: refund=%s, payment=%s, amount=%.2f", refund.ID, paymentID, amount)
-	return refund, nil
+	return s.repo.Update(ctx, refund)
 }
 
 // GetRefund retrieves refund status (Query)
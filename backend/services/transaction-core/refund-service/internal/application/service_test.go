@@ -0,0 +1,227 @@
+package application_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+	"github.com/titan-commerce/backend/refund-service/internal/application"
+	"github.com/titan-commerce/backend/refund-service/internal/domain"
+)
+
+type memoryRefunds struct {
+	mu      sync.Mutex
+	refunds map[string]domain.Refund
+}
+
+func (m *memoryRefunds) Save(ctx context.Context, refund *domain.Refund) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refunds[refund.ID] = *refund
+	return nil
+}
+
+func (m *memoryRefunds) FindByID(ctx context.Context, refundID string) (*domain.Refund, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.refunds[refundID]
+	if !ok {
+		return nil, errors.New(errors.ErrNotFound, "refund not found")
+	}
+	return &r, nil
+}
+
+func (m *memoryRefunds) FindByReturnID(ctx context.Context, returnID string) (*domain.Refund, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.refunds {
+		if r.ReturnID == returnID {
+			return &r, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryRefunds) FindByIdempotencyKey(ctx context.Context, key string) (*domain.Refund, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.refunds {
+		if r.IdempotencyKey == key {
+			return &r, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryRefunds) Update(ctx context.Context, refund *domain.Refund) error {
+	return m.Save(ctx, refund)
+}
+
+// fakePayments is payment-service holding one payment of order-1
+type fakePayments struct {
+	payment   application.OrderPayment
+	refunded  []float64
+	err       error
+	lostReply bool              // Refunds, but answers with an error
+	byKey     map[string]string // Refund made under each idempotency key
+}
+
+func (f *fakePayments) FindPaymentByOrder(ctx context.Context, orderID string) (*application.OrderPayment, error) {
+	if orderID != "order-1" {
+		return nil, errors.New(errors.ErrNotFound, "order has no payment")
+	}
+	p := f.payment
+	return &p, nil
+}
+
+func (f *fakePayments) ProcessRefund(ctx context.Context, refundID, paymentID string, amount float64) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	gatewayRefundID, ok := f.byKey[refundID]
+	if !ok {
+		gatewayRefundID = fmt.Sprintf("re_%d", len(f.byKey)+1)
+		f.byKey[refundID] = gatewayRefundID
+		f.refunded = append(f.refunded, amount)
+		f.payment.RefundedAmount += amount
+	}
+	if f.lostReply {
+		return "", errors.New(errors.ErrPaymentFailed, "payment-service refund failed")
+	}
+	return gatewayRefundID, nil
+}
+
+func setupRefunds(amount, refunded float64) (*memoryRefunds, *fakePayments, *application.RefundService) {
+	refunds := &memoryRefunds{refunds: map[string]domain.Refund{}}
+	payments := &fakePayments{
+		payment: application.OrderPayment{PaymentID: "pay-1", Amount: amount, RefundedAmount: refunded},
+		byKey:   map[string]string{},
+	}
+	service := application.NewRefundService(refunds, payments, payments, logger.New(logger.Config{Level: "error", ServiceName: "test"}))
+	return refunds, payments, service
+}
+
+func TestRefundService_ReturnRefundSplitsAmountPerLine(t *testing.T) {
+	_, payments, service := setupRefunds(100, 0)
+	lines := []domain.RefundLine{
+		{ProductID: "prod-1", Quantity: 2, Amount: 30},
+		{ProductID: "prod-2", Quantity: 1, Amount: 12.5},
+	}
+
+	refund, err := service.ProcessReturnRefund(context.Background(), "order-1", "ret-1", lines, "damaged")
+	require.NoError(t, err)
+
+	assert.Equal(t, 42.5, refund.Amount)
+	assert.Equal(t, lines, refund.Lines)
+	assert.Equal(t, "pay-1", refund.PaymentID)
+	assert.Equal(t, "ret-1", refund.ReturnID)
+	assert.Equal(t, domain.RefundStatusCompleted, refund.Status)
+	assert.Equal(t, []float64{42.5}, payments.refunded)
+}
+
+func TestRefundService_ReturnRefundRejectsOverRefund(t *testing.T) {
+	refunds, payments, service := setupRefunds(100, 80)
+	ctx := context.Background()
+
+	_, err := service.ProcessReturnRefund(ctx, "order-1", "ret-1", []domain.RefundLine{
+		{ProductID: "prod-1", Quantity: 1, Amount: 15},
+		{ProductID: "prod-2", Quantity: 1, Amount: 15},
+	}, "")
+	require.Error(t, err)
+	assert.Equal(t, errors.ErrInvalidInput, err.(*errors.AppError).Code)
+	assert.Empty(t, refunds.refunds)
+	assert.Empty(t, payments.refunded)
+
+	// Exactly what is left is fine
+	refund, err := service.ProcessReturnRefund(ctx, "order-1", "ret-2", []domain.RefundLine{
+		{ProductID: "prod-1", Quantity: 1, Amount: 15},
+		{ProductID: "prod-2", Quantity: 1, Amount: 5},
+	}, "")
+	require.NoError(t, err)
+	assert.Equal(t, 20.0, refund.Amount)
+}
+
+func TestRefundService_ReturnRefundIsIdempotent(t *testing.T) {
+	_, payments, service := setupRefunds(100, 0)
+	ctx := context.Background()
+	lines := []domain.RefundLine{{ProductID: "prod-1", Quantity: 1, Amount: 40}}
+
+	payments.err = errors.New(errors.ErrPaymentFailed, "gateway unavailable")
+	failed, err := service.ProcessReturnRefund(ctx, "order-1", "ret-1", lines, "")
+	require.Error(t, err)
+	assert.Equal(t, domain.RefundStatusFailed, failed.Status)
+
+	// Retried once it failed, then left alone
+	payments.err = nil
+	retried, err := service.ProcessReturnRefund(ctx, "order-1", "ret-1", lines, "")
+	require.NoError(t, err)
+	again, err := service.ProcessReturnRefund(ctx, "order-1", "ret-1", lines, "")
+	require.NoError(t, err)
+
+	assert.Equal(t, failed.ID, retried.ID)
+	assert.Equal(t, retried.ID, again.ID)
+	assert.Equal(t, domain.RefundStatusCompleted, again.Status)
+	assert.Equal(t, []float64{40}, payments.refunded)
+}
+
+func TestRefundService_ReturnRefundRetryAfterLostReply(t *testing.T) {
+	_, payments, service := setupRefunds(100, 0)
+	ctx := context.Background()
+	lines := []domain.RefundLine{{ProductID: "prod-1", Quantity: 1, Amount: 40}}
+
+	// payment-service refunded, but the reply never arrived
+	payments.lostReply = true
+	failed, err := service.ProcessReturnRefund(ctx, "order-1", "ret-1", lines, "")
+	require.Error(t, err)
+	assert.Equal(t, domain.RefundStatusFailed, failed.Status)
+
+	payments.lostReply = false
+	retried, err := service.ProcessReturnRefund(ctx, "order-1", "ret-1", lines, "")
+	require.NoError(t, err)
+
+	assert.Equal(t, domain.RefundStatusCompleted, retried.Status)
+	assert.Equal(t, "re_1", retried.GatewayRefundID)
+	assert.Equal(t, []float64{40}, payments.refunded)
+}
+
+func TestRefundService_ReturnRefundWithoutPayment(t *testing.T) {
+	_, _, service := setupRefunds(100, 0)
+
+	_, err := service.ProcessReturnRefund(context.Background(), "order-2", "ret-1", []domain.RefundLine{
+		{ProductID: "prod-1", Quantity: 1, Amount: 10},
+	}, "")
+	require.Error(t, err)
+	assert.Equal(t, errors.ErrNotFound, err.(*errors.AppError).Code)
+}
+
+func TestRefundService_RefundIsIdempotentPerKey(t *testing.T) {
+	_, payments, service := setupRefunds(100, 0)
+	ctx := context.Background()
+
+	payments.err = errors.New(errors.ErrPaymentFailed, "gateway unavailable")
+	failed, err := service.ProcessRefund(ctx, "key-1", "pay-1", "order-1", 100, "rejected")
+	require.Error(t, err)
+	assert.Equal(t, domain.RefundStatusFailed, failed.Status)
+
+	// Retried once it failed, then left alone
+	payments.err = nil
+	retried, err := service.ProcessRefund(ctx, "key-1", "pay-1", "order-1", 100, "rejected")
+	require.NoError(t, err)
+	again, err := service.ProcessRefund(ctx, "key-1", "pay-1", "order-1", 100, "rejected")
+	require.NoError(t, err)
+
+	assert.Equal(t, failed.ID, retried.ID)
+	assert.Equal(t, retried.ID, again.ID)
+	assert.Equal(t, domain.RefundStatusCompleted, again.Status)
+	assert.Equal(t, []float64{100}, payments.refunded)
+
+	// The key belongs to that refund
+	_, err = service.ProcessRefund(ctx, "key-1", "pay-1", "order-1", 50, "rejected")
+	require.Error(t, err)
+	assert.Equal(t, errors.ErrConflict, err.(*errors.AppError).Code)
+}
@@ -11,6 +11,9 @@ type Refund struct {
 	ID              string
 	PaymentID       string
 	OrderID         string
+	ReturnID        string       // Set when the refund settles an item return
+	IdempotencyKey  string       // Set by callers that retry; one refund per key
+	Lines           []RefundLine // Per-item breakdown of Amount for a return
 	Amount          float64
 	Reason          string
 	Status          RefundStatus
@@ -19,6 +22,13 @@ type Refund struct {
 	ProcessedAt     *time.Time
 }
 
+// RefundLine is the amount refunded for one returned order line
+type RefundLine struct {
+	ProductID string  `json:"product_id"`
+	Quantity  int     `json:"quantity"`
+	Amount    float64 `json:"amount"`
+}
+
 type RefundStatus string
 
 const (
@@ -47,6 +57,33 @@ func NewRefund(paymentID, orderID string, amount float64, reason string) (*Refun
 	}, nil
 }
 
+// NewReturnRefund creates a refund for items returned on an order. The amount
+// is the sum of its lines.
+func NewReturnRefund(paymentID, orderID, returnID string, lines []RefundLine, reason string) (*Refund, error) {
+	if returnID == "" {
+		return nil, errors.New(errors.ErrInvalidInput, "return ID is required")
+	}
+	if len(lines) == 0 {
+		return nil, errors.New(errors.ErrInvalidInput, "return refund must have at least one line")
+	}
+
+	var amount float64
+	for _, line := range lines {
+		if line.ProductID == "" || line.Quantity <= 0 || line.Amount < 0 {
+			return nil, errors.New(errors.ErrInvalidInput, "invalid refund line")
+		}
+		amount += line.Amount
+	}
+
+	refund, err := NewRefund(paymentID, orderID, amount, reason)
+	if err != nil {
+		return nil, err
+	}
+	refund.ReturnID = returnID
+	refund.Lines = lines
+	return refund, nil
+}
+
 func (r *Refund) Process(gatewayRefundID string) {
 	r.Status = RefundStatusProcessing
 	r.GatewayRefundID = gatewayRefundID
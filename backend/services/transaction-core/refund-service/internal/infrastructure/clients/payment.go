@@ -0,0 +1,64 @@
+package clients
+
+import (
+	"context"
+
+	paymentpb "github.com/titan-commerce/backend/payment-service/proto/payment/v1"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/refund-service/internal/application"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// PaymentClient refunds and looks up payments with payment-service
+type PaymentClient struct {
+	conn   *grpc.ClientConn
+	client paymentpb.PaymentServiceClient
+}
+
+// NewPaymentClient dials payment-service at addr, e.g. payment-service:9000.
+// The connection is made lazily, so a payment-service that is down fails
+// the calls rather than startup.
+func NewPaymentClient(addr string) (*PaymentClient, error) {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to dial payment-service", err)
+	}
+	return &PaymentClient{conn: conn, client: paymentpb.NewPaymentServiceClient(conn)}, nil
+}
+
+func (c *PaymentClient) Close() error {
+	return c.conn.Close()
+}
+
+// ProcessRefund refunds amount of the payment; payment-service rejects more
+// than is left to refund. The refund ID is the idempotency key, so a retry
+// returns the refund payment-service already made.
+func (c *PaymentClient) ProcessRefund(ctx context.Context, refundID, paymentID string, amount float64) (string, error) {
+	resp, err := c.client.RefundPayment(ctx, &paymentpb.RefundPaymentRequest{
+		PaymentId:      paymentID,
+		Amount:         amount,
+		IdempotencyKey: refundID,
+	})
+	if err != nil {
+		return "", errors.Wrap(errors.ErrPaymentFailed, "payment-service refund failed", err)
+	}
+	return resp.RefundId, nil
+}
+
+func (c *PaymentClient) FindPaymentByOrder(ctx context.Context, orderID string) (*application.OrderPayment, error) {
+	resp, err := c.client.GetPaymentByOrder(ctx, &paymentpb.GetPaymentByOrderRequest{OrderId: orderID})
+	if status.Code(err) == codes.NotFound {
+		return nil, errors.Wrap(errors.ErrNotFound, "order has no payment", err)
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to look up the payment of the order", err)
+	}
+	return &application.OrderPayment{
+		PaymentID:      resp.Payment.PaymentId,
+		Amount:         resp.Payment.Amount,
+		RefundedAmount: resp.Payment.RefundedAmount,
+	}, nil
+}
@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/titan-commerce/backend/refund-service/internal/domain"
@@ -35,12 +36,17 @@ func NewRefundRepository(databaseURL string, logger *logger.Logger) (*RefundRepo
 
 func (r *RefundRepository) Save(ctx context.Context, refund *domain.Refund) error {
 	query := `
-		INSERT INTO refunds (id, payment_id, order_id, amount, reason, status, gateway_refund_id, created_at, processed_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO refunds (id, payment_id, order_id, return_id, idempotency_key, lines, amount, reason, status, gateway_refund_id, created_at, processed_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8, $9, $10, $11, $12)
 	`
 
-	_, err := r.db.ExecContext(ctx, query,
-		refund.ID, refund.PaymentID, refund.OrderID, refund.Amount, refund.Reason,
+	linesJSON, err := json.Marshal(refund.Lines)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to marshal refund lines", err)
+	}
+
+	_, err = r.db.ExecContext(ctx, query,
+		refund.ID, refund.PaymentID, refund.OrderID, refund.ReturnID, refund.IdempotencyKey, string(linesJSON), refund.Amount, refund.Reason,
 		refund.Status, refund.GatewayRefundID, refund.CreatedAt, refund.ProcessedAt)
 
 	if err != nil {
@@ -52,15 +58,11 @@ func (r *RefundRepository) Save(ctx context.Context, refund *domain.Refund) erro
 
 func (r *RefundRepository) FindByID(ctx context.Context, refundID string) (*domain.Refund, error) {
 	query := `
-		SELECT id, payment_id, order_id, amount, reason, status, gateway_refund_id, created_at, processed_at
+		SELECT id, payment_id, order_id, COALESCE(return_id, ''), COALESCE(idempotency_key, ''), lines, amount, reason, status, gateway_refund_id, created_at, processed_at
 		FROM refunds WHERE id = $1
 	`
 
-	var refund domain.Refund
-	err := r.db.QueryRowContext(ctx, query, refundID).Scan(
-		&refund.ID, &refund.PaymentID, &refund.OrderID, &refund.Amount, &refund.Reason,
-		&refund.Status, &refund.GatewayRefundID, &refund.CreatedAt, &refund.ProcessedAt)
-
+	refund, err := scanRefund(r.db.QueryRowContext(ctx, query, refundID))
 	if err == sql.ErrNoRows {
 		return nil, errors.New(errors.ErrNotFound, "refund not found")
 	}
@@ -68,6 +70,60 @@ func (r *RefundRepository) FindByID(ctx context.Context, refundID string) (*doma
 		return nil, errors.Wrap(errors.ErrInternal, "failed to find refund", err)
 	}
 
+	return refund, nil
+}
+
+// FindByReturnID returns the refund issued for an item return, or nil if
+// there is none yet
+func (r *RefundRepository) FindByReturnID(ctx context.Context, returnID string) (*domain.Refund, error) {
+	query := `
+		SELECT id, payment_id, order_id, COALESCE(return_id, ''), COALESCE(idempotency_key, ''), lines, amount, reason, status, gateway_refund_id, created_at, processed_at
+		FROM refunds WHERE return_id = $1
+	`
+
+	refund, err := scanRefund(r.db.QueryRowContext(ctx, query, returnID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to find refund", err)
+	}
+
+	return refund, nil
+}
+
+// FindByIdempotencyKey returns the refund made under key, or nil if there
+// is none yet
+func (r *RefundRepository) FindByIdempotencyKey(ctx context.Context, key string) (*domain.Refund, error) {
+	query := `
+		SELECT id, payment_id, order_id, COALESCE(return_id, ''), COALESCE(idempotency_key, ''), lines, amount, reason, status, gateway_refund_id, created_at, processed_at
+		FROM refunds WHERE idempotency_key = $1
+	`
+
+	refund, err := scanRefund(r.db.QueryRowContext(ctx, query, key))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to find refund", err)
+	}
+
+	return refund, nil
+}
+
+func scanRefund(row *sql.Row) (*domain.Refund, error) {
+	var refund domain.Refund
+	var linesJSON []byte
+	err := row.Scan(
+		&refund.ID, &refund.PaymentID, &refund.OrderID, &refund.ReturnID, &refund.IdempotencyKey, &linesJSON, &refund.Amount, &refund.Reason,
+		&refund.Status, &refund.GatewayRefundID, &refund.CreatedAt, &refund.ProcessedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(linesJSON, &refund.Lines); err != nil {
+		return nil, err
+	}
 	return &refund, nil
 }
 
@@ -6,6 +6,7 @@ import (
 	"github.com/titan-commerce/backend/refund-service/internal/application"
 	"github.com/titan-commerce/backend/refund-service/internal/domain"
 	pb "github.com/titan-commerce/backend/refund-service/proto/refund/v1"
+	"github.com/titan-commerce/backend/pkg/errors"
 	"github.com/titan-commerce/backend/pkg/logger"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -25,7 +26,7 @@ func NewRefundServiceServer(service *application.RefundService, logger *logger.L
 }
 
 func (s *RefundServiceServer) ProcessRefund(ctx context.Context, req *pb.ProcessRefundRequest) (*pb.ProcessRefundResponse, error) {
-	refund, err := s.service.ProcessRefund(ctx, req.PaymentId, req.OrderId, req.Amount, req.Reason)
+	refund, err := s.service.ProcessRefund(ctx, req.IdempotencyKey, req.PaymentId, req.OrderId, req.Amount, req.Reason)
 	if err != nil {
 		s.logger.Error(err, "failed to process refund")
 		return nil, status.Error(codes.Internal, err.Error())
@@ -36,6 +37,27 @@ func (s *RefundServiceServer) ProcessRefund(ctx context.Context, req *pb.Process
 	}, nil
 }
 
+func (s *RefundServiceServer) ProcessReturnRefund(ctx context.Context, req *pb.ProcessReturnRefundRequest) (*pb.ProcessReturnRefundResponse, error) {
+	lines := make([]domain.RefundLine, len(req.Lines))
+	for i, line := range req.Lines {
+		lines[i] = domain.RefundLine{
+			ProductID: line.ProductId,
+			Quantity:  int(line.Quantity),
+			Amount:    line.Amount,
+		}
+	}
+
+	refund, err := s.service.ProcessReturnRefund(ctx, req.OrderId, req.ReturnId, lines, req.Reason)
+	if err != nil {
+		s.logger.Error(err, "failed to process return refund")
+		return nil, toStatus(err)
+	}
+
+	return &pb.ProcessReturnRefundResponse{
+		Refund: domainToProto(refund),
+	}, nil
+}
+
 func (s *RefundServiceServer) GetRefund(ctx context.Context, req *pb.GetRefundRequest) (*pb.GetRefundResponse, error) {
 	refund, err := s.service.GetRefund(ctx, req.RefundId)
 	if err != nil {
@@ -48,6 +70,15 @@ func (s *RefundServiceServer) GetRefund(ctx context.Context, req *pb.GetRefundRe
 }
 
 func domainToProto(refund *domain.Refund) *pb.Refund {
+	lines := make([]*pb.RefundLine, len(refund.Lines))
+	for i, line := range refund.Lines {
+		lines[i] = &pb.RefundLine{
+			ProductId: line.ProductID,
+			Quantity:  int32(line.Quantity),
+			Amount:    line.Amount,
+		}
+	}
+
 	return &pb.Refund{
 		RefundId:        refund.ID,
 		PaymentId:       refund.PaymentID,
@@ -56,5 +87,14 @@ func domainToProto(refund *domain.Refund) *pb.Refund {
 		Reason:          refund.Reason,
 		Status:          string(refund.Status),
 		GatewayRefundId: refund.GatewayRefundID,
+		ReturnId:        refund.ReturnID,
+		Lines:           lines,
+	}
+}
+
+func toStatus(err error) error {
+	if appErr, ok := err.(*errors.AppError); ok {
+		return appErr.ToGRPCError()
 	}
+	return status.Error(codes.Internal, err.Error())
 }
@@ -0,0 +1,7 @@
+-- Refunds for item returns carry the return they settle and a per-line breakdown
+
+ALTER TABLE refunds ADD COLUMN IF NOT EXISTS return_id VARCHAR(36);
+ALTER TABLE refunds ADD COLUMN IF NOT EXISTS lines JSONB NOT NULL DEFAULT '[]';
+
+-- At most one refund per return, so retried requests can't refund twice
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refunds_return_id ON refunds(return_id) WHERE return_id IS NOT NULL;
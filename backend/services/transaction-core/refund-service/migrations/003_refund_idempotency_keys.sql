@@ -0,0 +1,6 @@
+-- Refunds requested with an idempotency key, e.g. of a payment an order
+-- rejected, are made once per key
+
+ALTER TABLE refunds ADD COLUMN IF NOT EXISTS idempotency_key VARCHAR(128);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refunds_idempotency_key ON refunds(idempotency_key) WHERE idempotency_key IS NOT NULL;
@@ -1,11 +1,18 @@
 ﻿package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/titan-commerce/backend/pkg/config"
+	"github.com/titan-commerce/backend/pkg/errors"
 	"github.com/titan-commerce/backend/pkg/logger"
+	"github.com/titan-commerce/backend/voucher-service/internal/application"
+	"github.com/titan-commerce/backend/voucher-service/internal/infrastructure/postgres"
 )
 
 func main() {
@@ -23,6 +30,106 @@ func main() {
 	})
 
 	log.Info("voucher-service starting...")
-	// TODO: Implement service
-	select {}
+
+	// Initialize repository
+	repo, err := postgres.NewVoucherRepository(cfg.DatabaseURL, log)
+	if err != nil {
+		log.Fatal(err, "Failed to initialize voucher repository")
+	}
+
+	// Initialize application service
+	voucherService := application.NewVoucherService(repo, log)
+
+	// HTTP endpoints
+	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+
+	// Look up a voucher a user can use, e.g. for checkout to price a cart
+	http.HandleFunc("/api/v1/vouchers/lookup", func(w http.ResponseWriter, r *http.Request) {
+		voucher, _, err := voucherService.ValidateVoucher(r.Context(), r.URL.Query().Get("code"), r.URL.Query().Get("user_id"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"code":  voucher.Code,
+			"type":  voucher.Type,
+			"value": voucher.Value,
+		})
+	})
+
+	// Redeem a voucher under a key, e.g. a checkout session
+	http.HandleFunc("/api/v1/vouchers/redeem", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			Key    string `json:"key"`
+			Code   string `json:"code"`
+			UserID string `json:"user_id"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		voucher, err := voucherService.RedeemVoucher(r.Context(), req.Key, req.Code, req.UserID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": voucher.Code, "value": voucher.Value})
+	})
+
+	// Release a voucher redeemed under a key, e.g. a checkout given up
+	http.HandleFunc("/api/v1/vouchers/release", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			Key  string `json:"key"`
+			Code string `json:"code"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		if err := voucherService.ReleaseVoucher(r.Context(), req.Key, req.Code); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"success": true})
+	})
+
+	go func() {
+		addr := fmt.Sprintf(":%d", cfg.HTTPPort)
+		log.Infof("Voucher service listening on %s", addr)
+		if err := http.ListenAndServe(addr, nil); err != nil {
+			log.Fatal(err, "Failed to serve HTTP")
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Info("Shutting down voucher-service")
+}
+
+// writeError answers with the error's HTTP status, or 500 if it has none
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if appErr, ok := err.(*errors.AppError); ok {
+		status = appErr.HTTPStatus
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 }
@@ -4,6 +4,7 @@ go 1.23
 
 require (
 	github.com/google/uuid v1.5.0
+	github.com/lib/pq v1.10.9
 	github.com/titan-commerce/backend/pkg v0.0.0
 )
 
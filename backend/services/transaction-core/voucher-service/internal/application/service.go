@@ -2,8 +2,10 @@ package application
 
 import (
 	"context"
+	"time"
 
 	"github.com/titan-commerce/backend/voucher-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
 	"github.com/titan-commerce/backend/pkg/logger"
 )
 
@@ -11,6 +13,8 @@ type VoucherRepository interface {
 	Save(ctx context.Context, voucher *domain.Voucher) error
 	FindByCode(ctx context.Context, code string) (*domain.Voucher, error)
 	FindByUserID(ctx context.Context, userID string) ([]*domain.Voucher, error)
+	// Update saves a redeem or a release; it fails with ErrConflict if the
+	// voucher was redeemed or released by someone else meanwhile
 	Update(ctx context.Context, voucher *domain.Voucher) error
 }
 
@@ -57,14 +61,21 @@ func (s *VoucherService) ValidateVoucher(ctx context.Context, code, userID strin
 	return voucher, "", nil
 }
 
-// RedeemVoucher marks voucher as used (Command)
-func (s *VoucherService) RedeemVoucher(ctx context.Context, code, userID string) (*domain.Voucher, error) {
-	voucher, _, err := s.ValidateVoucher(ctx, code, userID)
+// RedeemVoucher marks voucher as used under key, e.g. a checkout (Command).
+// Redeeming it again under the same key does nothing.
+func (s *VoucherService) RedeemVoucher(ctx context.Context, key, code, userID string) (*domain.Voucher, error) {
+	voucher, err := s.repo.FindByCode(ctx, code)
 	if err != nil {
 		return nil, err
 	}
+	if voucher.Used && voucher.RedeemedBy == key {
+		return voucher, nil
+	}
 
-	if err := voucher.Redeem(); err != nil {
+	if canUse, reason := voucher.CanUse(userID); !canUse {
+		return nil, errors.New(errors.ErrInvalidInput, reason)
+	}
+	if err := voucher.Redeem(key); err != nil {
 		return nil, err
 	}
 
@@ -76,6 +87,25 @@ func (s *VoucherService) RedeemVoucher(ctx context.Context, code, userID string)
 	return voucher, nil
 }
 
+// ReleaseVoucher makes a voucher redeemed under key usable again (Command).
+// Releasing a voucher not redeemed under key does nothing.
+func (s *VoucherService) ReleaseVoucher(ctx context.Context, key, code string) error {
+	voucher, err := s.repo.FindByCode(ctx, code)
+	if err != nil {
+		return err
+	}
+	if !voucher.Release(key) {
+		return nil
+	}
+
+	if err := s.repo.Update(ctx, voucher); err != nil {
+		return err
+	}
+
+	s.logger.Infof("Voucher released: code=%s, key=%s", code, key)
+	return nil
+}
+
 // GetUserVouchers retrieves all vouchers for a user (Query)
 func (s *VoucherService) GetUserVouchers(ctx context.Context, userID string) ([]*domain.Voucher, error) {
 	return s.repo.FindByUserID(ctx, userID)
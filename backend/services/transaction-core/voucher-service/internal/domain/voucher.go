@@ -23,6 +23,7 @@ type Voucher struct {
 	UserID      string // Assigned to specific user
 	Used        bool
 	UsedAt      *time.Time
+	RedeemedBy  string // Key the voucher was redeemed under, e.g. a checkout
 	ExpiresAt   time.Time
 	CreatedAt   time.Time
 }
@@ -60,7 +61,12 @@ func (v *Voucher) CanUse(userID string) (bool, string) {
 	return true, ""
 }
 
-func (v *Voucher) Redeem() error {
+// Redeem uses the voucher up under key. Redeeming it again under the same
+// key does nothing.
+func (v *Voucher) Redeem(key string) error {
+	if v.Used && v.RedeemedBy == key {
+		return nil
+	}
 	if v.Used {
 		return errors.New(errors.ErrInvalidInput, "voucher already used")
 	}
@@ -71,5 +77,19 @@ func (v *Voucher) Redeem() error {
 	v.Used = true
 	now := time.Now()
 	v.UsedAt = &now
+	v.RedeemedBy = key
 	return nil
 }
+
+// Release makes a voucher redeemed under key usable again, e.g. when the
+// checkout that redeemed it was given up. It reports whether anything
+// changed: a voucher not redeemed under key is left as it is.
+func (v *Voucher) Release(key string) bool {
+	if !v.Used || v.RedeemedBy != key {
+		return false
+	}
+	v.Used = false
+	v.UsedAt = nil
+	v.RedeemedBy = ""
+	return true
+}
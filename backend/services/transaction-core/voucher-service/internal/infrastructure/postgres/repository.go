@@ -0,0 +1,119 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+	"github.com/titan-commerce/backend/voucher-service/internal/domain"
+)
+
+const voucherColumns = `id, code, type, value, user_id, used, used_at, redeemed_by, expires_at, created_at`
+
+type VoucherRepository struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
+
+func NewVoucherRepository(databaseURL string, logger *logger.Logger) (*VoucherRepository, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to connect to database", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to ping database", err)
+	}
+
+	logger.Info("Voucher PostgreSQL repository initialized")
+	return &VoucherRepository{db: db, logger: logger}, nil
+}
+
+func (r *VoucherRepository) Save(ctx context.Context, voucher *domain.Voucher) error {
+	query := `INSERT INTO vouchers (` + voucherColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	_, err := r.db.ExecContext(ctx, query,
+		voucher.ID, voucher.Code, voucher.Type, voucher.Value, voucher.UserID,
+		voucher.Used, voucher.UsedAt, voucher.RedeemedBy, voucher.ExpiresAt, voucher.CreatedAt)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to save voucher", err)
+	}
+	return nil
+}
+
+func (r *VoucherRepository) FindByCode(ctx context.Context, code string) (*domain.Voucher, error) {
+	query := `SELECT ` + voucherColumns + ` FROM vouchers WHERE code = $1`
+
+	voucher, err := scanVoucher(r.db.QueryRowContext(ctx, query, code))
+	if err == sql.ErrNoRows {
+		return nil, errors.New(errors.ErrNotFound, "voucher not found")
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to find voucher", err)
+	}
+	return voucher, nil
+}
+
+func (r *VoucherRepository) FindByUserID(ctx context.Context, userID string) ([]*domain.Voucher, error) {
+	query := `SELECT ` + voucherColumns + ` FROM vouchers WHERE user_id = $1 ORDER BY created_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to find vouchers", err)
+	}
+	defer rows.Close()
+
+	var vouchers []*domain.Voucher
+	for rows.Next() {
+		voucher, err := scanVoucher(rows)
+		if err != nil {
+			return nil, errors.Wrap(errors.ErrInternal, "failed to scan voucher", err)
+		}
+		vouchers = append(vouchers, voucher)
+	}
+	return vouchers, rows.Err()
+}
+
+// Update saves a redeem or a release. Both flip used, so the row must still
+// have the opposite value; otherwise another redeem or release won.
+func (r *VoucherRepository) Update(ctx context.Context, voucher *domain.Voucher) error {
+	query := `UPDATE vouchers SET used = $1, used_at = $2, redeemed_by = $3
+		WHERE id = $4 AND used = NOT $1`
+
+	result, err := r.db.ExecContext(ctx, query, voucher.Used, voucher.UsedAt, voucher.RedeemedBy, voucher.ID)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to update voucher", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to get rows affected", err)
+	}
+	if rows == 0 {
+		return errors.New(errors.ErrConflict, "voucher was redeemed or released meanwhile")
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanVoucher(row scanner) (*domain.Voucher, error) {
+	var voucher domain.Voucher
+	var usedAt sql.NullTime
+	if err := row.Scan(&voucher.ID, &voucher.Code, &voucher.Type, &voucher.Value, &voucher.UserID,
+		&voucher.Used, &usedAt, &voucher.RedeemedBy, &voucher.ExpiresAt, &voucher.CreatedAt); err != nil {
+		return nil, err
+	}
+	if usedAt.Valid {
+		voucher.UsedAt = &usedAt.Time
+	}
+	return &voucher, nil
+}
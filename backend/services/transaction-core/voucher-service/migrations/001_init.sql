@@ -0,0 +1,16 @@
+-- Vouchers; a used voucher records the key it was redeemed under, so a
+-- retried redeem or release of the same checkout is recognised
+CREATE TABLE IF NOT EXISTS vouchers (
+    id VARCHAR(64) PRIMARY KEY,
+    code VARCHAR(64) NOT NULL UNIQUE,
+    type VARCHAR(20) NOT NULL,
+    value DECIMAL(12, 2) NOT NULL,
+    user_id VARCHAR(64) NOT NULL DEFAULT '',
+    used BOOLEAN NOT NULL DEFAULT false,
+    used_at TIMESTAMP,
+    redeemed_by VARCHAR(128) NOT NULL DEFAULT '',
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_vouchers_user ON vouchers(user_id);
@@ -43,8 +43,13 @@ func main() {
 		log.Fatal(err, "Failed to initialize transaction repository")
 	}
 
+	holdRepo, err := postgres.NewHoldRepository(cfg.DatabaseURL, log)
+	if err != nil {
+		log.Fatal(err, "Failed to initialize hold repository")
+	}
+
 	// Initialize application service
-	walletService := application.NewWalletService(walletRepo, txnRepo, log)
+	walletService := application.NewWalletService(walletRepo, txnRepo, holdRepo, log)
 
 	// Initialize gRPC server
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
@@ -2,8 +2,10 @@ package application
 
 import (
 	"context"
+	"math"
 
 	"github.com/titan-commerce/backend/wallet-service/internal/domain"
+	"github.com/titan-commerce/backend/pkg/errors"
 	"github.com/titan-commerce/backend/pkg/logger"
 )
 
@@ -18,16 +20,26 @@ type TransactionRepository interface {
 	FindByWalletID(ctx context.Context, walletID string, page, pageSize int) ([]*domain.Transaction, int, error)
 }
 
+// HoldRepository saves a hold together with the wallet balances it moved
+type HoldRepository interface {
+	FindByID(ctx context.Context, holdID string) (*domain.Hold, error)
+	FindByReference(ctx context.Context, reference string) (*domain.Hold, error)
+	Create(ctx context.Context, wallet *domain.Wallet, hold *domain.Hold) error
+	Update(ctx context.Context, wallet *domain.Wallet, hold *domain.Hold, from domain.HoldStatus) error
+}
+
 type WalletService struct {
 	walletRepo WalletRepository
 	txnRepo    TransactionRepository
+	holdRepo   HoldRepository
 	logger     *logger.Logger
 }
 
-func NewWalletService(walletRepo WalletRepository, txnRepo TransactionRepository, logger *logger.Logger) *WalletService {
+func NewWalletService(walletRepo WalletRepository, txnRepo TransactionRepository, holdRepo HoldRepository, logger *logger.Logger) *WalletService {
 	return &WalletService{
 		walletRepo: walletRepo,
 		txnRepo:    txnRepo,
+		holdRepo:   holdRepo,
 		logger:     logger,
 	}
 }
@@ -93,57 +105,133 @@ func (s *WalletService) Withdraw(ctx context.Context, userID string, amount floa
 	return wallet, nil
 }
 
-// HoldFunds holds funds in escrow (Command)
-func (s *WalletService) HoldFunds(ctx context.Context, userID, orderID string, amount float64) (string, error) {
+// HoldFunds holds funds in escrow for reference, e.g. an order or a
+// checkout (Command). A retry with the same reference returns the hold
+// already placed instead of holding again.
+func (s *WalletService) HoldFunds(ctx context.Context, userID, reference string, amount float64) (*domain.Hold, error) {
+	if hold, err := s.existingHold(ctx, userID, reference, amount); hold != nil || err != nil {
+		return hold, err
+	}
+
 	wallet, err := s.GetBalance(ctx, userID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if err := wallet.HoldFunds(amount); err != nil {
-		return "", err
+	hold, err := domain.NewHold(wallet, reference, amount)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := s.walletRepo.Update(ctx, wallet); err != nil {
-		return "", err
+	if err := s.holdRepo.Create(ctx, wallet, hold); err != nil {
+		// A concurrent retry may have placed it first
+		if existing, findErr := s.existingHold(ctx, userID, reference, amount); existing != nil {
+			return existing, nil
+		} else if findErr != nil {
+			return nil, findErr
+		}
+		return nil, err
 	}
 
-	holdID := orderID // Use order ID as hold ID for simplicity
-	txn := domain.NewTransaction(wallet.WalletID, "HOLD", amount, "Escrow for order: "+orderID)
-	if err := s.txnRepo.Save(ctx, txn); err != nil {
-		s.logger.Error(err, "failed to save transaction")
+	s.recordTransaction(ctx, wallet.WalletID, "HOLD", amount, "Escrow for: "+reference)
+
+	s.logger.Infof("Hold funds: user=%s, amount=%.2f, reference=%s, hold=%s", userID, amount, reference, hold.HoldID)
+	return hold, nil
+}
+
+// existingHold returns the hold already placed for reference, if any. It
+// fails with ErrConflict if that hold is for another user or amount.
+func (s *WalletService) existingHold(ctx context.Context, userID, reference string, amount float64) (*domain.Hold, error) {
+	hold, err := s.holdRepo.FindByReference(ctx, reference)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok && appErr.Code == errors.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if hold.UserID != userID || math.Round(hold.Amount*100) != math.Round(amount*100) {
+		return nil, errors.New(errors.ErrConflict, "reference already has a different hold")
+	}
+	s.logger.Infof("Hold for reference %s already placed: %s", reference, hold.HoldID)
+	return hold, nil
+}
+
+// ReleaseFunds ends a hold (Command): toUser gives the funds back to the
+// user, otherwise they are captured. Releasing a hold that already ended
+// that way again does nothing.
+func (s *WalletService) ReleaseFunds(ctx context.Context, holdID string, toUser bool) error {
+	hold, err := s.holdRepo.FindByID(ctx, holdID)
+	if err != nil {
+		return err
+	}
+
+	target, txnType := domain.HoldStatusCaptured, "RELEASE"
+	if toUser {
+		target, txnType = domain.HoldStatusReleased, "REFUND"
+	}
+	if hold.Status == target {
+		return nil
 	}
 
-	s.logger.Infof("Hold funds: user=%s, amount=%.2f, order=%s", userID, amount, orderID)
-	return holdID, nil
+	wallet, err := s.GetBalance(ctx, hold.UserID)
+	if err != nil {
+		return err
+	}
+
+	if toUser {
+		err = hold.Release(wallet)
+	} else {
+		err = hold.Capture(wallet)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.holdRepo.Update(ctx, wallet, hold, domain.HoldStatusHeld); err != nil {
+		return err
+	}
+
+	s.recordTransaction(ctx, wallet.WalletID, txnType, hold.Amount, "Release for hold: "+holdID)
+
+	s.logger.Infof("Release funds: hold=%s, amount=%.2f, to user=%v", holdID, hold.Amount, toUser)
+	return nil
 }
 
-// ReleaseFunds releases held funds (Command)
-func (s *WalletService) ReleaseFunds(ctx context.Context, userID, holdID string, amount float64, refund bool) error {
-	wallet, err := s.GetBalance(ctx, userID)
+// RefundHold gives the funds of a captured hold back to the user (Command).
+// Refunding a hold again does nothing.
+func (s *WalletService) RefundHold(ctx context.Context, holdID string) error {
+	hold, err := s.holdRepo.FindByID(ctx, holdID)
 	if err != nil {
 		return err
 	}
+	if hold.Status == domain.HoldStatusRefunded {
+		return nil
+	}
 
-	if err := wallet.ReleaseFunds(amount, refund); err != nil {
+	wallet, err := s.GetBalance(ctx, hold.UserID)
+	if err != nil {
 		return err
 	}
 
-	if err := s.walletRepo.Update(ctx, wallet); err != nil {
+	if err := hold.Refund(wallet); err != nil {
 		return err
 	}
 
-	txnType := "RELEASE"
-	if refund {
-		txnType = "REFUND"
+	if err := s.holdRepo.Update(ctx, wallet, hold, domain.HoldStatusCaptured); err != nil {
+		return err
 	}
-	txn := domain.NewTransaction(wallet.WalletID, txnType, amount, "Release for hold: "+holdID)
+
+	s.recordTransaction(ctx, wallet.WalletID, "REFUND", hold.Amount, "Refund of hold: "+holdID)
+
+	s.logger.Infof("Refund hold: hold=%s, amount=%.2f", holdID, hold.Amount)
+	return nil
+}
+
+func (s *WalletService) recordTransaction(ctx context.Context, walletID, txnType string, amount float64, description string) {
+	txn := domain.NewTransaction(walletID, txnType, amount, description)
 	if err := s.txnRepo.Save(ctx, txn); err != nil {
 		s.logger.Error(err, "failed to save transaction")
 	}
-
-	s.logger.Infof("Release funds: user=%s, amount=%.2f, refund=%v", userID, amount, refund)
-	return nil
 }
 
 // GetTransactions retrieves transaction history (Query)
@@ -0,0 +1,95 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/titan-commerce/backend/pkg/errors"
+)
+
+// HoldStatus is where a hold's funds stand
+type HoldStatus string
+
+const (
+	HoldStatusHeld     HoldStatus = "HELD"
+	HoldStatusCaptured HoldStatus = "CAPTURED" // Taken, e.g. by the order
+	HoldStatusReleased HoldStatus = "RELEASED" // Given back before capture
+	HoldStatusRefunded HoldStatus = "REFUNDED" // Given back after capture
+)
+
+// Hold is money set aside from a wallet's available balance in escrow. It
+// is placed once per reference, e.g. a checkout, and then either captured
+// or released; a captured hold may be refunded once.
+type Hold struct {
+	HoldID    string
+	WalletID  string
+	UserID    string
+	Reference string
+	Amount    float64
+	Status    HoldStatus
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// NewHold holds amount of the wallet's available balance for reference
+func NewHold(wallet *Wallet, reference string, amount float64) (*Hold, error) {
+	if reference == "" {
+		return nil, errors.New(errors.ErrInvalidInput, "hold reference is required")
+	}
+	if err := wallet.HoldFunds(amount); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &Hold{
+		HoldID:    uuid.New().String(),
+		WalletID:  wallet.WalletID,
+		UserID:    wallet.UserID,
+		Reference: reference,
+		Amount:    amount,
+		Status:    HoldStatusHeld,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// Capture takes the held funds out of the wallet
+func (h *Hold) Capture(wallet *Wallet) error {
+	if h.Status != HoldStatusHeld {
+		return errors.New(errors.ErrConflict, "only held funds can be captured, hold is "+string(h.Status))
+	}
+	if err := wallet.ReleaseFunds(h.Amount, false); err != nil {
+		return err
+	}
+	h.transition(HoldStatusCaptured)
+	return nil
+}
+
+// Release gives the held funds back to the wallet's available balance
+func (h *Hold) Release(wallet *Wallet) error {
+	if h.Status != HoldStatusHeld {
+		return errors.New(errors.ErrConflict, "only held funds can be released, hold is "+string(h.Status))
+	}
+	if err := wallet.ReleaseFunds(h.Amount, true); err != nil {
+		return err
+	}
+	h.transition(HoldStatusReleased)
+	return nil
+}
+
+// Refund gives captured funds back to the wallet's available balance
+func (h *Hold) Refund(wallet *Wallet) error {
+	if h.Status != HoldStatusCaptured {
+		return errors.New(errors.ErrConflict, "only captured funds can be refunded, hold is "+string(h.Status))
+	}
+	if err := wallet.Deposit(h.Amount); err != nil {
+		return err
+	}
+	h.transition(HoldStatusRefunded)
+	return nil
+}
+
+func (h *Hold) transition(status HoldStatus) {
+	h.Status = status
+	h.UpdatedAt = time.Now()
+}
@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	stderrors "errors"
+
+	"github.com/lib/pq"
+	"github.com/titan-commerce/backend/pkg/errors"
+	"github.com/titan-commerce/backend/pkg/logger"
+	"github.com/titan-commerce/backend/wallet-service/internal/domain"
+)
+
+const holdColumns = `hold_id, wallet_id, user_id, reference, amount, status, created_at, updated_at`
+
+// HoldRepository stores holds together with the wallet balances they move,
+// in one transaction
+type HoldRepository struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
+
+func NewHoldRepository(databaseURL string, logger *logger.Logger) (*HoldRepository, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to connect to database", err)
+	}
+
+	logger.Info("Hold PostgreSQL repository initialized")
+	return &HoldRepository{db: db, logger: logger}, nil
+}
+
+func (r *HoldRepository) FindByID(ctx context.Context, holdID string) (*domain.Hold, error) {
+	return r.findOne(ctx, `WHERE hold_id = $1`, holdID)
+}
+
+func (r *HoldRepository) FindByReference(ctx context.Context, reference string) (*domain.Hold, error) {
+	return r.findOne(ctx, `WHERE reference = $1`, reference)
+}
+
+func (r *HoldRepository) findOne(ctx context.Context, where string, arg string) (*domain.Hold, error) {
+	query := `SELECT ` + holdColumns + ` FROM wallet_holds ` + where
+
+	var hold domain.Hold
+	err := r.db.QueryRowContext(ctx, query, arg).Scan(
+		&hold.HoldID, &hold.WalletID, &hold.UserID, &hold.Reference,
+		&hold.Amount, &hold.Status, &hold.CreatedAt, &hold.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errors.New(errors.ErrNotFound, "hold not found")
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInternal, "failed to find hold", err)
+	}
+	return &hold, nil
+}
+
+// Create stores a new hold with the wallet it was taken from. It fails with
+// ErrConflict if the reference already has a hold or the wallet changed.
+func (r *HoldRepository) Create(ctx context.Context, wallet *domain.Wallet, hold *domain.Hold) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		if err := updateWallet(ctx, tx, wallet); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO wallet_holds (`+holdColumns+`)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, hold.HoldID, hold.WalletID, hold.UserID, hold.Reference,
+			hold.Amount, hold.Status, hold.CreatedAt, hold.UpdatedAt,
+		)
+		if isUniqueViolation(err) {
+			return errors.New(errors.ErrConflict, "reference already has a hold")
+		}
+		if err != nil {
+			return errors.Wrap(errors.ErrInternal, "failed to save hold", err)
+		}
+		return nil
+	})
+}
+
+// Update saves the hold's new status with the wallet change it made. It
+// fails with ErrConflict if the hold left status from, or the wallet
+// changed, since they were loaded.
+func (r *HoldRepository) Update(ctx context.Context, wallet *domain.Wallet, hold *domain.Hold, from domain.HoldStatus) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE wallet_holds SET status = $1, updated_at = $2
+			WHERE hold_id = $3 AND status = $4
+		`, hold.Status, hold.UpdatedAt, hold.HoldID, from)
+		if err != nil {
+			return errors.Wrap(errors.ErrInternal, "failed to update hold", err)
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return errors.Wrap(errors.ErrInternal, "failed to get rows affected", err)
+		}
+		if rows == 0 {
+			return errors.New(errors.ErrConflict, "hold was modified by another transaction")
+		}
+		return updateWallet(ctx, tx, wallet)
+	})
+}
+
+func (r *HoldRepository) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(errors.ErrInternal, "failed to commit transaction", err)
+	}
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return stderrors.As(err, &pqErr) && pqErr.Code == "23505"
+}
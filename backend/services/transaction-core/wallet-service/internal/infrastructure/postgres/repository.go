@@ -77,13 +77,24 @@ func (r *WalletRepository) FindByUserID(ctx context.Context, userID string) (*do
 }
 
 func (r *WalletRepository) Update(ctx context.Context, wallet *domain.Wallet) error {
+	return updateWallet(ctx, r.db, wallet)
+}
+
+// execer runs statements on the database or within a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// updateWallet saves the wallet's balances unless it changed since it was
+// loaded (optimistic lock)
+func updateWallet(ctx context.Context, db execer, wallet *domain.Wallet) error {
 	query := `
 		UPDATE wallets
 		SET available_balance = $1, held_balance = $2, updated_at = $3, version = $4
 		WHERE wallet_id = $5 AND version = $6
 	`
 
-	result, err := r.db.ExecContext(ctx, query,
+	result, err := db.ExecContext(ctx, query,
 		wallet.AvailableBalance, wallet.HeldBalance, wallet.UpdatedAt,
 		wallet.Version, wallet.WalletID, wallet.Version-1,
 	)
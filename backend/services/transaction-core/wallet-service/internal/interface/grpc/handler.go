@@ -5,6 +5,7 @@ import (
 
 	"github.com/titan-commerce/backend/wallet-service/internal/application"
 	pb "github.com/titan-commerce/backend/wallet-service/proto/wallet/v1"
+	"github.com/titan-commerce/backend/pkg/errors"
 	"github.com/titan-commerce/backend/pkg/logger"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -61,28 +62,43 @@ func (s *WalletServiceServer) Deposit(ctx context.Context, req *pb.DepositReques
 }
 
 func (s *WalletServiceServer) HoldFunds(ctx context.Context, req *pb.HoldFundsRequest) (*pb.HoldFundsResponse, error) {
-	holdID, err := s.service.HoldFunds(ctx, req.UserId, req.OrderId, req.Amount)
+	hold, err := s.service.HoldFunds(ctx, req.UserId, req.OrderId, req.Amount)
 	if err != nil {
 		s.logger.Error(err, "failed to hold funds")
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, toStatus(err)
 	}
 
 	return &pb.HoldFundsResponse{
 		Success: true,
-		HoldId:  holdID,
+		HoldId:  hold.HoldID,
 	}, nil
 }
 
 func (s *WalletServiceServer) ReleaseFunds(ctx context.Context, req *pb.ReleaseFundsRequest) (*pb.ReleaseFundsResponse, error) {
-	// Extract userID from holdID or lookup
-	// For simplicity, assuming holdID format includes userID
-	err := s.service.ReleaseFunds(ctx, "", req.HoldId, 0, req.ReleaseToUser)
-	if err != nil {
+	if err := s.service.ReleaseFunds(ctx, req.HoldId, req.ReleaseToUser); err != nil {
 		s.logger.Error(err, "failed to release funds")
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, toStatus(err)
 	}
 
 	return &pb.ReleaseFundsResponse{
 		Success: true,
 	}, nil
 }
+
+func (s *WalletServiceServer) RefundHold(ctx context.Context, req *pb.RefundHoldRequest) (*pb.RefundHoldResponse, error) {
+	if err := s.service.RefundHold(ctx, req.HoldId); err != nil {
+		s.logger.Error(err, "failed to refund hold")
+		return nil, toStatus(err)
+	}
+
+	return &pb.RefundHoldResponse{
+		Success: true,
+	}, nil
+}
+
+func toStatus(err error) error {
+	if appErr, ok := err.(*errors.AppError); ok {
+		return appErr.ToGRPCError()
+	}
+	return status.Error(codes.Internal, err.Error())
+}
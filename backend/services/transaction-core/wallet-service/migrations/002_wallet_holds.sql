@@ -0,0 +1,15 @@
+-- Holds: funds set aside in escrow, once per reference, so a retried
+-- HoldFunds returns the first hold and ReleaseFunds knows what it releases
+
+CREATE TABLE IF NOT EXISTS wallet_holds (
+    hold_id VARCHAR(36) PRIMARY KEY,
+    wallet_id VARCHAR(36) NOT NULL REFERENCES wallets(wallet_id),
+    user_id VARCHAR(36) NOT NULL,
+    reference VARCHAR(255) NOT NULL UNIQUE,
+    amount DECIMAL(10, 2) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_wallet_holds_wallet_id ON wallet_holds(wallet_id);
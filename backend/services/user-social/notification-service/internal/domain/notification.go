@@ -14,6 +14,9 @@ const (
 	NotificationTypeShipmentUpdate NotificationType = "SHIPMENT_UPDATE"
 	NotificationTypeFlashSaleAlert NotificationType = "FLASH_SALE_ALERT"
 	NotificationTypeCoinReward     NotificationType = "COIN_REWARD"
+	NotificationTypePriceDrop      NotificationType = "PRICE_DROP"     // A product on a followed list got cheaper
+	NotificationTypeBackInStock    NotificationType = "BACK_IN_STOCK"  // A product on a followed list can be bought again
+	NotificationTypeCartAbandoned  NotificationType = "CART_ABANDONED" // A reminder of a cart left idle
 )
 
 type NotificationChannel string
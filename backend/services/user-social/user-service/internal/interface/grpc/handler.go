@@ -75,5 +75,10 @@ func domainUserToProto(user *domain.User) *pb.User {
 		PhoneNumber: user.PhoneNumber,
 		AvatarUrl:   user.AvatarURL,
 		Addresses:   nil,
+		Preferences: &pb.Preferences{
+			EmailNotifications: user.Preferences.EmailNotifications,
+			SmsNotifications:   user.Preferences.SMSNotifications,
+			PreferredLanguage:  user.Preferences.PreferredLanguage,
+		},
 	}
 }